@@ -0,0 +1,103 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type ChaosDrillHandler struct {
+	drillService services.IChaosDrillService
+	logger       logger.ILogger
+}
+
+func NewChaosDrillHandler(drillService services.IChaosDrillService, logger logger.ILogger) *ChaosDrillHandler {
+	return &ChaosDrillHandler{
+		drillService: drillService,
+		logger:       logger,
+	}
+}
+
+func (h *ChaosDrillHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	drills := rg.Group("/chaos/drills")
+	{
+		drills.POST("", h.RunDrill)
+		drills.GET("", h.ListDrills)
+		drills.GET("/:id", h.GetDrill)
+	}
+}
+
+// RunDrill starts a chaos drill
+// @Summary Run chaos drill
+// @Description Kills the leader, pauses or disconnects a node, or fills its disk, then measures time to new leader, availability and data loss. Clusters in prod stacks need force.
+// @Tags Chaos Drills
+// @Accept json
+// @Produce json
+// @Param request body dto.RunChaosDrillRequest true "Drill scenario"
+// @Success 202 {object} dto.ChaosDrillInfo
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/chaos/drills [post]
+func (h *ChaosDrillHandler) RunDrill(c *gin.Context) {
+	var req dto.RunChaosDrillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	drill, err := h.drillService.RunDrill(c.Request.Context(), c.GetString("user_id"), req)
+	if err != nil {
+		h.logger.Error("failed to start chaos drill", zap.String("target_id", req.TargetID), zap.String("scenario", req.Scenario), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, drill)
+}
+
+// ListDrills lists drills, newest first
+// @Summary List chaos drills
+// @Tags Chaos Drills
+// @Produce json
+// @Param target_type query string false "postgres or nginx"
+// @Param target_id query string false "Cluster ID"
+// @Param limit query int false "Maximum drills" default(50)
+// @Success 200 {array} dto.ChaosDrillInfo
+// @Router /api/v1/chaos/drills [get]
+func (h *ChaosDrillHandler) ListDrills(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	drills, err := h.drillService.ListDrills(c.Request.Context(), c.Query("target_type"), c.Query("target_id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, drills)
+}
+
+// GetDrill returns a drill and its report
+// @Summary Get chaos drill report
+// @Tags Chaos Drills
+// @Produce json
+// @Param id path string true "Drill ID"
+// @Success 200 {object} dto.ChaosDrillInfo
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/chaos/drills/{id} [get]
+func (h *ChaosDrillHandler) GetDrill(c *gin.Context) {
+	drill, err := h.drillService.GetDrill(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, drill)
+}
@@ -1,25 +1,69 @@
 package http
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/services"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
 
+const (
+	// maxBuildContextSize limits the build context archive uploaded for a build job
+	maxBuildContextSize = 512 << 20
+	// maxUploadSize limits a file or archive uploaded into an environment
+	maxUploadSize = 1 << 30
+)
+
 type DinDHandler struct {
 	dinDService services.IDinDService
 	logger      logger.ILogger
+	// terminalUpgrader only accepts WebSocket handshakes from the allowed browser origins, so another
+	// site cannot open a terminal with the token or cookies of a logged-in user
+	terminalUpgrader websocket.Upgrader
 }
 
-func NewDinDHandler(dinDService services.IDinDService, logger logger.ILogger) *DinDHandler {
+func NewDinDHandler(dinDService services.IDinDService, logger logger.ILogger, allowedOrigins []string) *DinDHandler {
 	return &DinDHandler{
 		dinDService: dinDService,
 		logger:      logger,
+		terminalUpgrader: websocket.Upgrader{
+			CheckOrigin: originChecker(allowedOrigins),
+		},
+	}
+}
+
+// originChecker accepts requests without an Origin header (non-browser clients), same-origin
+// requests and the given origins
+func originChecker(allowedOrigins []string) func(r *http.Request) bool {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if allowed[strings.ToLower(origin)] {
+			return true
+		}
+		parsed, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(parsed.Host, r.Host)
 	}
 }
 
@@ -33,18 +77,51 @@ func (h *DinDHandler) RegisterRoutes(r *gin.RouterGroup) {
 		dind.DELETE("/environments/:id", h.DeleteEnvironment)
 		dind.POST("/environments/:id/start", h.StartEnvironment)
 		dind.POST("/environments/:id/stop", h.StopEnvironment)
+		dind.POST("/environments/:id/resize", h.ResizeEnvironment)
+		dind.POST("/environments/:id/extend", h.ExtendEnvironment)
+
+		// Snapshots
+		dind.POST("/environments/:id/snapshots", h.CreateSnapshot)
+		dind.GET("/environments/:id/snapshots", h.ListEnvironmentSnapshots)
+		dind.GET("/snapshots", h.ListSnapshots)
+		dind.GET("/snapshots/:snapshotId", h.GetSnapshot)
+		dind.DELETE("/snapshots/:snapshotId", h.DeleteSnapshot)
 
 		// Docker operations inside DinD
 		dind.POST("/environments/:id/exec", h.ExecCommand)
 		dind.POST("/environments/:id/build", h.BuildImage)
 		dind.POST("/environments/:id/compose", h.RunCompose)
 		dind.POST("/environments/:id/pull", h.PullImage)
+		dind.GET("/environments/:id/history", h.GetCommandHistory)
+
+		// File transfer
+		dind.POST("/environments/:id/files", h.UploadFile)
+		dind.GET("/environments/:id/files", h.DownloadFile)
 
 		// Info retrieval
 		dind.GET("/environments/:id/containers", h.ListContainers)
 		dind.GET("/environments/:id/images", h.ListImages)
 		dind.GET("/environments/:id/logs", h.GetLogs)
 		dind.GET("/environments/:id/stats", h.GetStats)
+
+		// Interactive terminal
+		dind.GET("/environments/:id/terminal", h.Terminal)
+		dind.GET("/environments/:id/terminal/sessions", h.ListTerminalSessions)
+		dind.GET("/environments/:id/terminal/sessions/:sessionId", h.GetTerminalSession)
+
+		// Background jobs
+		dind.POST("/environments/:id/jobs/build", h.StartBuildJob)
+		dind.POST("/environments/:id/jobs/pull", h.StartPullJob)
+		dind.POST("/environments/:id/jobs/compose", h.StartComposeJob)
+		dind.GET("/environments/:id/jobs", h.ListJobs)
+		dind.GET("/environments/:id/jobs/:jobId", h.GetJob)
+		dind.GET("/environments/:id/jobs/:jobId/stream", h.StreamJob)
+		dind.POST("/environments/:id/jobs/:jobId/cancel", h.CancelJob)
+
+		// Shared registry
+		dind.GET("/registry", h.GetRegistry)
+		dind.POST("/environments/:id/registry/push", h.PushToRegistry)
+		dind.POST("/environments/:id/registry/pull", h.PullFromRegistry)
 	}
 }
 
@@ -228,6 +305,250 @@ func (h *DinDHandler) StopEnvironment(c *gin.Context) {
 	})
 }
 
+// ResizeEnvironment switches the resource plan of a running DinD environment
+// @Summary Resize DinD Environment
+// @Description Apply a new resource plan in place, or recreate the container with its images and containers kept when that fails
+// @Tags DinD
+// @Accept json
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param request body dto.ResizeDinDEnvironmentRequest true "New resource plan"
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/environments/{id}/resize [post]
+func (h *DinDHandler) ResizeEnvironment(c *gin.Context) {
+	id := c.Param("id")
+
+	var req dto.ResizeDinDEnvironmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	env, err := h.dinDService.ResizeEnvironment(c.Request.Context(), id, req)
+	if err != nil {
+		h.logger.Error("failed to resize DinD environment", zap.String("env_id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to resize environment",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Environment resized successfully",
+		Data:    env,
+	})
+}
+
+// ExtendEnvironment extends the TTL of a DinD environment
+// @Summary Extend DinD Environment TTL
+// @Description Push back the expiry; an environment stopped on expiry is started again if it is still in its grace period
+// @Tags DinD
+// @Accept json
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param request body dto.ExtendDinDEnvironmentRequest true "Hours to add"
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/environments/{id}/extend [post]
+func (h *DinDHandler) ExtendEnvironment(c *gin.Context) {
+	id := c.Param("id")
+
+	var req dto.ExtendDinDEnvironmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	env, err := h.dinDService.ExtendEnvironment(c.Request.Context(), id, req)
+	if err != nil {
+		h.logger.Error("failed to extend DinD environment", zap.String("env_id", id), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to extend environment",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Environment extended successfully",
+		Data:    env,
+	})
+}
+
+// CreateSnapshot snapshots a DinD environment with its images, containers and volumes. The
+// snapshot is taken in the background; it can be restored once its status is ready.
+// @Summary Create DinD Snapshot
+// @Tags DinD
+// @Accept json
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param request body dto.CreateDinDSnapshotRequest true "Snapshot name"
+// @Success 202 {object} dto.APIResponse
+// @Router /dind/environments/{id}/snapshots [post]
+func (h *DinDHandler) CreateSnapshot(c *gin.Context) {
+	id := c.Param("id")
+
+	var req dto.CreateDinDSnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	snapshot, err := h.dinDService.CreateSnapshot(c.Request.Context(), id, c.GetString("user_id"), req)
+	if err != nil {
+		h.logger.Error("failed to create DinD snapshot", zap.String("env_id", id), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to create snapshot",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Snapshot is being created",
+		Data:    snapshot,
+	})
+}
+
+// ListEnvironmentSnapshots lists the snapshots taken of a DinD environment
+// @Summary List DinD Environment Snapshots
+// @Tags DinD
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/environments/{id}/snapshots [get]
+func (h *DinDHandler) ListEnvironmentSnapshots(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+
+	snapshots, err := h.dinDService.ListEnvironmentSnapshots(c.Request.Context(), id, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Environment not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Snapshots retrieved successfully",
+		Data:    snapshots,
+	})
+}
+
+// ListSnapshots lists the snapshots of the current user with their total size
+// @Summary List DinD Snapshots
+// @Tags DinD
+// @Produce json
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/snapshots [get]
+func (h *DinDHandler) ListSnapshots(c *gin.Context) {
+	snapshots, err := h.dinDService.ListSnapshots(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to list snapshots",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Snapshots retrieved successfully",
+		Data:    snapshots,
+	})
+}
+
+// GetSnapshot returns a snapshot
+// @Summary Get DinD Snapshot
+// @Tags DinD
+// @Produce json
+// @Param snapshotId path string true "Snapshot ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/snapshots/{snapshotId} [get]
+func (h *DinDHandler) GetSnapshot(c *gin.Context) {
+	snapshotID := c.Param("snapshotId")
+
+	snapshot, err := h.dinDService.GetSnapshot(c.Request.Context(), snapshotID, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Snapshot not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Snapshot retrieved successfully",
+		Data:    snapshot,
+	})
+}
+
+// DeleteSnapshot deletes a snapshot with its image and data volume
+// @Summary Delete DinD Snapshot
+// @Tags DinD
+// @Produce json
+// @Param snapshotId path string true "Snapshot ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/snapshots/{snapshotId} [delete]
+func (h *DinDHandler) DeleteSnapshot(c *gin.Context) {
+	snapshotID := c.Param("snapshotId")
+
+	if err := h.dinDService.DeleteSnapshot(c.Request.Context(), snapshotID, c.GetString("user_id")); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to delete snapshot",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Snapshot deleted successfully",
+	})
+}
+
 // ExecCommand executes a docker command inside the DinD environment
 // @Summary Execute Docker Command
 // @Description Run any docker command inside the DinD environment
@@ -256,7 +577,7 @@ func (h *DinDHandler) ExecCommand(c *gin.Context) {
 		zap.String("env_id", id),
 		zap.String("command", req.Command))
 
-	resp, err := h.dinDService.ExecCommand(c.Request.Context(), id, req)
+	resp, err := h.dinDService.ExecCommand(c.Request.Context(), id, c.GetString("user_id"), req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
@@ -385,96 +706,866 @@ func (h *DinDHandler) PullImage(c *gin.Context) {
 	})
 }
 
-// ListContainers lists all containers inside DinD environment
-func (h *DinDHandler) ListContainers(c *gin.Context) {
+// UploadFile uploads a file into a directory of a DinD environment, or with extract=true
+// unpacks a tar or tar.gz archive there, e.g. a build context or compose project
+// @Summary Upload File to DinD Environment
+// @Tags DinD
+// @Accept mpfd
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param path formData string true "Target directory"
+// @Param extract formData bool false "Unpack the upload as a tar archive"
+// @Param file formData file true "File or archive"
+// @Success 201 {object} dto.APIResponse
+// @Router /dind/environments/{id}/files [post]
+func (h *DinDHandler) UploadFile(c *gin.Context) {
 	id := c.Param("id")
+	userID := c.GetString("user_id")
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
 
-	resp, err := h.dinDService.ListContainers(c.Request.Context(), id)
+	var req dto.DinDUploadRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+	file, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to list containers",
+			Code:    "INVALID_REQUEST",
+			Message: "File is required",
 			Error:   err.Error(),
 		})
 		return
 	}
-
-	c.JSON(http.StatusOK, dto.APIResponse{
-		Success: true,
-		Code:    "SUCCESS",
-		Message: "Containers retrieved successfully",
-		Data:    resp,
-	})
-}
-
-// ListImages lists all images inside DinD environment
-func (h *DinDHandler) ListImages(c *gin.Context) {
-	id := c.Param("id")
-
-	resp, err := h.dinDService.ListImages(c.Request.Context(), id)
+	content, err := file.Open()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to list images",
+			Code:    "INVALID_REQUEST",
+			Message: "Failed to read upload",
 			Error:   err.Error(),
 		})
 		return
 	}
+	defer content.Close()
 
-	c.JSON(http.StatusOK, dto.APIResponse{
-		Success: true,
-		Code:    "SUCCESS",
-		Message: "Images retrieved successfully",
-		Data:    resp,
-	})
-}
-
-// GetLogs gets logs from DinD container
-func (h *DinDHandler) GetLogs(c *gin.Context) {
-	id := c.Param("id")
-	tailStr := c.DefaultQuery("tail", "100")
-	tail, _ := strconv.Atoi(tailStr)
-
-	resp, err := h.dinDService.GetLogs(c.Request.Context(), id, tail)
+	resp, err := h.dinDService.UploadFile(c.Request.Context(), id, userID, req, file.Filename, file.Size, content)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+		h.logger.Error("failed to upload to DinD environment", zap.String("env_id", id), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to get logs",
+			Code:    "BAD_REQUEST",
+			Message: "Failed to upload file",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.APIResponse{
+	c.JSON(http.StatusCreated, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
-		Message: "Logs retrieved successfully",
+		Message: "File uploaded successfully",
 		Data:    resp,
 	})
 }
 
-// GetStats gets resource statistics of DinD environment
-func (h *DinDHandler) GetStats(c *gin.Context) {
+// DownloadFile downloads a file, or a directory as tar or tar.gz, from a DinD environment
+// @Summary Download File from DinD Environment
+// @Tags DinD
+// @Produce octet-stream
+// @Param id path string true "Environment ID"
+// @Param path query string true "File or directory"
+// @Param format query string false "raw, tar or tar.gz"
+// @Success 200 {file} file
+// @Router /dind/environments/{id}/files [get]
+func (h *DinDHandler) DownloadFile(c *gin.Context) {
 	id := c.Param("id")
+	userID := c.GetString("user_id")
 
-	resp, err := h.dinDService.GetStats(c.Request.Context(), id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+	var req dto.DinDDownloadRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to get stats",
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid query parameters",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.APIResponse{
-		Success: true,
-		Code:    "SUCCESS",
+	download, err := h.dinDService.DownloadFile(c.Request.Context(), id, userID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to download file",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer download.Reader.Close()
+
+	c.Header("Content-Type", download.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", download.Name))
+	if download.Size >= 0 {
+		c.Header("Content-Length", strconv.FormatInt(download.Size, 10))
+	}
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, download.Reader); err != nil {
+		// The status is already sent; the client sees a cut-off body
+		h.logger.Error("failed to stream download", zap.String("env_id", id), zap.String("path", req.Path), zap.Error(err))
+	}
+}
+
+// GetCommandHistory returns the command history of a DinD environment. With export=csv or
+// export=json all matching entries are downloaded as a file instead of a page.
+// @Summary Get DinD Command History
+// @Tags DinD
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Entries per page" default(50)
+// @Param exit_code query int false "Only commands with this exit code"
+// @Param since query string false "Executed at or after (RFC3339)"
+// @Param until query string false "Executed before (RFC3339)"
+// @Param q query string false "Full-text search over command and output"
+// @Param export query string false "Download all matches: csv or json"
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/environments/{id}/history [get]
+func (h *DinDHandler) GetCommandHistory(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+
+	var query dto.DinDHistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid query parameters",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if query.Export != "" {
+		h.exportCommandHistory(c, id, userID, query)
+		return
+	}
+
+	history, err := h.dinDService.GetCommandHistory(c.Request.Context(), id, userID, query)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Failed to get command history",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Command history retrieved successfully",
+		Data:    history,
+	})
+}
+
+func (h *DinDHandler) exportCommandHistory(c *gin.Context, id, userID string, query dto.DinDHistoryQuery) {
+	contentType := "text/csv"
+	if query.Export == "json" {
+		contentType = "application/json"
+	}
+	filename := fmt.Sprintf("dind-%s-history-%s.%s", id, time.Now().Format("20060102-150405"), query.Export)
+	// Headers are only sent with the first write, so an early error can still be answered with JSON
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if err := h.dinDService.ExportCommandHistory(c.Request.Context(), id, userID, query, c.Writer); err != nil {
+		h.logger.Error("failed to export command history", zap.String("env_id", id), zap.Error(err))
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusNotFound, dto.APIResponse{
+				Success: false,
+				Code:    "NOT_FOUND",
+				Message: "Failed to export command history",
+				Error:   err.Error(),
+			})
+		}
+	}
+}
+
+// ListContainers lists all containers inside DinD environment
+func (h *DinDHandler) ListContainers(c *gin.Context) {
+	id := c.Param("id")
+
+	resp, err := h.dinDService.ListContainers(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to list containers",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Containers retrieved successfully",
+		Data:    resp,
+	})
+}
+
+// ListImages lists all images inside DinD environment
+func (h *DinDHandler) ListImages(c *gin.Context) {
+	id := c.Param("id")
+
+	resp, err := h.dinDService.ListImages(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to list images",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Images retrieved successfully",
+		Data:    resp,
+	})
+}
+
+// GetLogs gets logs from DinD container
+func (h *DinDHandler) GetLogs(c *gin.Context) {
+	id := c.Param("id")
+	tailStr := c.DefaultQuery("tail", "100")
+	tail, _ := strconv.Atoi(tailStr)
+
+	resp, err := h.dinDService.GetLogs(c.Request.Context(), id, tail)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to get logs",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Logs retrieved successfully",
+		Data:    resp,
+	})
+}
+
+// GetStats gets resource statistics of DinD environment
+func (h *DinDHandler) GetStats(c *gin.Context) {
+	id := c.Param("id")
+
+	resp, err := h.dinDService.GetStats(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to get stats",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
 		Message: "Stats retrieved successfully",
 		Data:    resp,
 	})
 }
+
+// Terminal attaches a WebSocket to an interactive TTY inside the DinD environment
+// @Summary Open DinD Terminal
+// @Description WebSocket. Browsers pass the JWT as ?token=. Send {"type":"input","data":"..."} or raw binary frames
+// @Description as keystrokes and {"type":"resize","rows":40,"cols":120} on resize; output arrives as binary frames
+// @Description and a final {"type":"exit"} message. Sessions without input for the idle timeout are closed,
+// @Description and whatever still runs in them is killed. Browser origins must be allowed by the service.
+// @Tags DinD
+// @Param id path string true "Environment ID"
+// @Param cmd query string false "Command to run through sh -c instead of /bin/sh"
+// @Param rows query int false "Initial rows"
+// @Param cols query int false "Initial columns"
+// @Param token query string false "JWT, for clients that cannot set the Authorization header"
+// @Success 101
+// @Failure 403 {object} dto.APIResponse
+// @Router /dind/environments/{id}/terminal [get]
+func (h *DinDHandler) Terminal(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+
+	var req dto.DinDTerminalRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid terminal parameters",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if !h.terminalUpgrader.CheckOrigin(c.Request) {
+		c.JSON(http.StatusForbidden, dto.APIResponse{
+			Success: false,
+			Code:    "FORBIDDEN",
+			Message: "Origin not allowed",
+		})
+		return
+	}
+
+	// The exec is started before the upgrade so that errors still reach the client as JSON
+	terminal, err := h.dinDService.OpenTerminal(c.Request.Context(), id, userID, req)
+	if err != nil {
+		h.logger.Error("failed to open DinD terminal", zap.String("env_id", id), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to open terminal",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	conn, err := h.terminalUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		h.logger.Error("terminal websocket upgrade failed", zap.String("env_id", id), zap.Error(err))
+		h.dinDService.CloseTerminal(context.Background(), terminal, "client_closed")
+		return
+	}
+	defer conn.Close()
+
+	var writeMu sync.Mutex
+	closed := make(chan string, 2)
+
+	// Terminal output -> client
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := terminal.Read(buf)
+			if n > 0 {
+				writeMu.Lock()
+				writeErr := conn.WriteMessage(websocket.BinaryMessage, buf[:n])
+				writeMu.Unlock()
+				if writeErr != nil {
+					closed <- "client_closed"
+					return
+				}
+			}
+			if err != nil {
+				closed <- "exited"
+				return
+			}
+		}
+	}()
+
+	// Client -> terminal; only input counts as activity for the idle timeout
+	go func() {
+		resetIdle := func() {
+			if terminal.IdleTimeout > 0 {
+				conn.SetReadDeadline(time.Now().Add(terminal.IdleTimeout))
+			}
+		}
+		resetIdle()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					closed <- "idle_timeout"
+				} else {
+					closed <- "client_closed"
+				}
+				return
+			}
+
+			if messageType == websocket.BinaryMessage {
+				terminal.Write(data)
+				resetIdle()
+				continue
+			}
+			var msg dto.DinDTerminalMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			switch msg.Type {
+			case "input":
+				terminal.Write([]byte(msg.Data))
+				resetIdle()
+			case "resize":
+				if err := terminal.Resize(context.Background(), msg.Rows, msg.Cols); err != nil {
+					h.logger.Warn("failed to resize terminal", zap.String("session_id", terminal.SessionID), zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	reason := <-closed
+	exitCode := h.dinDService.CloseTerminal(context.Background(), terminal, reason)
+
+	writeMu.Lock()
+	conn.WriteJSON(dto.DinDTerminalMessage{Type: "exit", ExitCode: exitCode, Reason: reason})
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason), time.Now().Add(time.Second))
+	writeMu.Unlock()
+}
+
+// ListTerminalSessions lists the recorded terminal sessions of a DinD environment
+// @Summary List DinD Terminal Sessions
+// @Tags DinD
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/environments/{id}/terminal/sessions [get]
+func (h *DinDHandler) ListTerminalSessions(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+
+	sessions, err := h.dinDService.ListTerminalSessions(c.Request.Context(), id, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Environment not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Terminal sessions retrieved successfully",
+		Data:    sessions,
+	})
+}
+
+// GetTerminalSession returns a recorded terminal session with its transcript
+// @Summary Get DinD Terminal Session
+// @Tags DinD
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param sessionId path string true "Session ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/environments/{id}/terminal/sessions/{sessionId} [get]
+func (h *DinDHandler) GetTerminalSession(c *gin.Context) {
+	id := c.Param("id")
+	sessionID := c.Param("sessionId")
+	userID := c.GetString("user_id")
+
+	session, err := h.dinDService.GetTerminalSession(c.Request.Context(), id, userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Terminal session not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Terminal session retrieved successfully",
+		Data:    session,
+	})
+}
+
+// StartBuildJob builds an image in the background. The request is either JSON with an inline
+// Dockerfile, or multipart with a tar or tar.gz build context in the "context" field.
+// @Summary Start DinD Build Job
+// @Tags DinD
+// @Accept json,mpfd
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Success 202 {object} dto.APIResponse
+// @Router /dind/environments/{id}/jobs/build [post]
+func (h *DinDHandler) StartBuildJob(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetString("user_id")
+
+	var job *dto.DinDJobInfo
+	var err error
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBuildContextSize)
+		var req dto.BuildContextRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.APIResponse{
+				Success: false,
+				Code:    "INVALID_REQUEST",
+				Message: "Invalid request body",
+				Error:   err.Error(),
+			})
+			return
+		}
+		// Without an archive, context_path names a directory uploaded to the environment before
+		var buildContext io.Reader
+		file, fileErr := c.FormFile("context")
+		if fileErr != nil && req.ContextPath == "" {
+			c.JSON(http.StatusBadRequest, dto.APIResponse{
+				Success: false,
+				Code:    "INVALID_REQUEST",
+				Message: "Build context archive or context_path is required",
+				Error:   fileErr.Error(),
+			})
+			return
+		}
+		if file != nil {
+			archive, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, dto.APIResponse{
+					Success: false,
+					Code:    "INVALID_REQUEST",
+					Message: "Failed to read build context",
+					Error:   err.Error(),
+				})
+				return
+			}
+			defer archive.Close()
+			buildContext = archive
+		}
+		job, err = h.dinDService.StartBuildContextJob(c.Request.Context(), id, userID, req, buildContext)
+	} else {
+		var req dto.BuildImageRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.APIResponse{
+				Success: false,
+				Code:    "INVALID_REQUEST",
+				Message: "Invalid request body",
+				Error:   err.Error(),
+			})
+			return
+		}
+		job, err = h.dinDService.StartBuildJob(c.Request.Context(), id, userID, req)
+	}
+	h.respondJobStarted(c, id, job, err, "build")
+}
+
+// StartPullJob pulls an image in the background
+// @Summary Start DinD Pull Job
+// @Tags DinD
+// @Accept json
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param request body dto.PullImageRequest true "Image to pull"
+// @Success 202 {object} dto.APIResponse
+// @Router /dind/environments/{id}/jobs/pull [post]
+func (h *DinDHandler) StartPullJob(c *gin.Context) {
+	id := c.Param("id")
+
+	var req dto.PullImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	job, err := h.dinDService.StartPullJob(c.Request.Context(), id, c.GetString("user_id"), req)
+	h.respondJobStarted(c, id, job, err, "pull")
+}
+
+// StartComposeJob runs a docker-compose action in the background
+// @Summary Start DinD Compose Job
+// @Tags DinD
+// @Accept json
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param request body dto.ComposeRequest true "Compose file and action"
+// @Success 202 {object} dto.APIResponse
+// @Router /dind/environments/{id}/jobs/compose [post]
+func (h *DinDHandler) StartComposeJob(c *gin.Context) {
+	id := c.Param("id")
+
+	var req dto.ComposeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	job, err := h.dinDService.StartComposeJob(c.Request.Context(), id, c.GetString("user_id"), req)
+	h.respondJobStarted(c, id, job, err, "compose")
+}
+
+func (h *DinDHandler) respondJobStarted(c *gin.Context, id string, job *dto.DinDJobInfo, err error, jobType string) {
+	if err != nil {
+		h.logger.Error("failed to start DinD job", zap.String("env_id", id), zap.String("type", jobType), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to start " + jobType + " job",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Job started",
+		Data:    job,
+	})
+}
+
+// ListJobs lists the background jobs of a DinD environment
+// @Summary List DinD Jobs
+// @Tags DinD
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/environments/{id}/jobs [get]
+func (h *DinDHandler) ListJobs(c *gin.Context) {
+	id := c.Param("id")
+
+	jobs, err := h.dinDService.ListJobs(c.Request.Context(), id, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Environment not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Jobs retrieved successfully",
+		Data:    jobs,
+	})
+}
+
+// GetJob returns a background job with its output
+// @Summary Get DinD Job
+// @Tags DinD
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param jobId path string true "Job ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/environments/{id}/jobs/{jobId} [get]
+func (h *DinDHandler) GetJob(c *gin.Context) {
+	id := c.Param("id")
+	jobID := c.Param("jobId")
+
+	job, err := h.dinDService.GetJob(c.Request.Context(), id, c.GetString("user_id"), jobID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Job not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Job retrieved successfully",
+		Data:    job,
+	})
+}
+
+// StreamJob streams the output of a job as server-sent events: "output" events with the output
+// so far and then live chunks, and a final "done" event with the job once it has finished
+// @Summary Stream DinD Job Output
+// @Tags DinD
+// @Produce text/event-stream
+// @Param id path string true "Environment ID"
+// @Param jobId path string true "Job ID"
+// @Router /dind/environments/{id}/jobs/{jobId}/stream [get]
+func (h *DinDHandler) StreamJob(c *gin.Context) {
+	id := c.Param("id")
+	jobID := c.Param("jobId")
+	userID := c.GetString("user_id")
+
+	stream, err := h.dinDService.StreamJob(c.Request.Context(), id, userID, jobID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Job not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer stream.Close()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	if len(stream.Backlog) > 0 {
+		c.SSEvent("output", string(stream.Backlog))
+	}
+	c.Writer.Flush()
+
+	live := stream.Live
+	c.Stream(func(w io.Writer) bool {
+		if live == nil {
+			return false
+		}
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case chunk, ok := <-live:
+			if !ok {
+				live = nil
+				return false
+			}
+			c.SSEvent("output", string(chunk))
+			return true
+		}
+	})
+	if c.Request.Context().Err() != nil {
+		return
+	}
+
+	// The channel also closes when the client fell behind; the job then still runs
+	job, err := h.dinDService.GetJob(context.Background(), id, userID, jobID)
+	if err != nil {
+		return
+	}
+	job.Output = ""
+	c.SSEvent("done", job)
+	c.Writer.Flush()
+}
+
+// CancelJob cancels a running background job
+// @Summary Cancel DinD Job
+// @Tags DinD
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param jobId path string true "Job ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/environments/{id}/jobs/{jobId}/cancel [post]
+func (h *DinDHandler) CancelJob(c *gin.Context) {
+	id := c.Param("id")
+	jobID := c.Param("jobId")
+
+	if err := h.dinDService.CancelJob(c.Request.Context(), id, c.GetString("user_id"), jobID); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to cancel job",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Job cancellation requested",
+	})
+}
+
+// GetRegistry returns the shared registry and the images in the namespace of the current user
+// @Summary Get DinD Registry
+// @Tags DinD
+// @Produce json
+// @Success 200 {object} dto.APIResponse
+// @Router /dind/registry [get]
+func (h *DinDHandler) GetRegistry(c *gin.Context) {
+	registry, err := h.dinDService.GetRegistry(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to get registry",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Registry retrieved successfully",
+		Data:    registry,
+	})
+}
+
+// PushToRegistry pushes an image of an environment to the namespace of the current user in
+// the shared registry, in the background
+// @Summary Push DinD Image to Registry
+// @Tags DinD
+// @Accept json
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param request body dto.DinDRegistryPushRequest true "Image to push"
+// @Success 202 {object} dto.APIResponse
+// @Router /dind/environments/{id}/registry/push [post]
+func (h *DinDHandler) PushToRegistry(c *gin.Context) {
+	id := c.Param("id")
+
+	var req dto.DinDRegistryPushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	job, err := h.dinDService.PushToRegistry(c.Request.Context(), id, c.GetString("user_id"), req)
+	h.respondJobStarted(c, id, job, err, "push")
+}
+
+// PullFromRegistry pulls an image from the namespace of the current user in the shared
+// registry into an environment, in the background
+// @Summary Pull DinD Image from Registry
+// @Tags DinD
+// @Accept json
+// @Produce json
+// @Param id path string true "Environment ID"
+// @Param request body dto.DinDRegistryPullRequest true "Image to pull"
+// @Success 202 {object} dto.APIResponse
+// @Router /dind/environments/{id}/registry/pull [post]
+func (h *DinDHandler) PullFromRegistry(c *gin.Context) {
+	id := c.Param("id")
+
+	var req dto.DinDRegistryPullRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	job, err := h.dinDService.PullFromRegistry(c.Request.Context(), id, c.GetString("user_id"), req)
+	h.respondJobStarted(c, id, job, err, "pull")
+}
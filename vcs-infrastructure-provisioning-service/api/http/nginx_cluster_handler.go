@@ -1,7 +1,11 @@
 package http
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -40,9 +44,15 @@ func (h *NginxClusterHandler) RegisterRoutes(r *gin.RouterGroup) {
 		// Node operations
 		clusterGroup.POST("/:id/nodes", h.AddNode)
 		clusterGroup.DELETE("/:id/nodes/:nodeId", h.RemoveNode)
+		clusterGroup.POST("/:id/resize", h.ResizeCluster)
+		clusterGroup.GET("/:id/operations", h.ListOperations)
+		clusterGroup.GET("/:id/operations/:operationId", h.GetOperation)
 
 		// Configuration
 		clusterGroup.PUT("/:id/config", h.UpdateClusterConfig)
+		clusterGroup.GET("/:id/config/revisions", h.ListConfigRevisions)
+		clusterGroup.GET("/:id/config/revisions/:revision", h.GetConfigRevision)
+		clusterGroup.POST("/:id/config/rollback", h.RollbackConfig)
 
 		// Upstreams
 		clusterGroup.GET("/:id/upstreams", h.ListUpstreams)
@@ -50,19 +60,62 @@ func (h *NginxClusterHandler) RegisterRoutes(r *gin.RouterGroup) {
 		clusterGroup.PUT("/:id/upstreams/:upstreamId", h.UpdateUpstream)
 		clusterGroup.DELETE("/:id/upstreams/:upstreamId", h.DeleteUpstream)
 
+		// Stream proxies
+		clusterGroup.GET("/:id/streams", h.ListStreamProxies)
+		clusterGroup.POST("/:id/streams", h.AddStreamProxy)
+		clusterGroup.PUT("/:id/streams/:streamId", h.UpdateStreamProxy)
+		clusterGroup.DELETE("/:id/streams/:streamId", h.DeleteStreamProxy)
+
 		// Server blocks
 		clusterGroup.GET("/:id/server-blocks", h.ListServerBlocks)
 		clusterGroup.POST("/:id/server-blocks", h.AddServerBlock)
 		clusterGroup.DELETE("/:id/server-blocks/:blockId", h.DeleteServerBlock)
 
+		// Locations
+		clusterGroup.GET("/:id/server-blocks/:blockId/locations", h.ListLocations)
+		clusterGroup.POST("/:id/server-blocks/:blockId/locations", h.AddLocation)
+		clusterGroup.PUT("/:id/server-blocks/:blockId/locations/:locationId", h.UpdateLocation)
+		clusterGroup.DELETE("/:id/server-blocks/:blockId/locations/:locationId", h.DeleteLocation)
+
+		// Traffic Policies
+		clusterGroup.GET("/:id/server-blocks/:blockId/locations/:locationId/traffic", h.GetTrafficPolicy)
+		clusterGroup.PUT("/:id/server-blocks/:blockId/locations/:locationId/traffic", h.SetTrafficPolicy)
+		clusterGroup.POST("/:id/server-blocks/:blockId/locations/:locationId/traffic/switch", h.SwitchTraffic)
+		clusterGroup.POST("/:id/server-blocks/:blockId/locations/:locationId/traffic/rollback", h.RollbackTrafficPolicy)
+
+		// Access Policies
+		clusterGroup.GET("/:id/access-policies", h.ListAccessPolicies)
+		clusterGroup.POST("/:id/access-policies", h.CreateAccessPolicy)
+		clusterGroup.PUT("/:id/access-policies/:policyId", h.UpdateAccessPolicy)
+		clusterGroup.DELETE("/:id/access-policies/:policyId", h.DeleteAccessPolicy)
+		clusterGroup.POST("/:id/access-policies/:policyId/users", h.SetBasicAuthUser)
+		clusterGroup.DELETE("/:id/access-policies/:policyId/users/:username", h.DeleteBasicAuthUser)
+
 		// Health & Monitoring
 		clusterGroup.GET("/:id/health", h.GetClusterHealth)
 		clusterGroup.GET("/:id/metrics", h.GetClusterMetrics)
+		clusterGroup.GET("/:id/metrics/history", h.GetMetricsHistory)
 
 		// Failover
 		clusterGroup.POST("/:id/failover", h.TriggerFailover)
 		clusterGroup.GET("/:id/failover-history", h.GetFailoverHistory)
+
+		// Certificates
+		clusterGroup.GET("/:id/certificates", h.ListCertificates)
+		clusterGroup.POST("/:id/certificates", h.UploadCertificate)
+		clusterGroup.POST("/:id/certificates/csr", h.CreateCertificateCSR)
+		clusterGroup.POST("/:id/certificates/self-signed", h.IssueSelfSignedCertificate)
+		clusterGroup.POST("/:id/certificates/acme", h.RequestACMECertificate)
+		clusterGroup.GET("/:id/certificates/:certId", h.GetCertificate)
+		clusterGroup.POST("/:id/certificates/:certId/complete", h.CompleteCertificateCSR)
+		clusterGroup.POST("/:id/certificates/:certId/renew", h.RenewCertificate)
+		clusterGroup.POST("/:id/certificates/:certId/deploy", h.DeployCertificate)
+		clusterGroup.POST("/:id/certificates/:certId/default", h.SetDefaultCertificate)
+		clusterGroup.DELETE("/:id/certificates/:certId", h.DeleteCertificate)
 	}
+
+	// auth_request target for locations fronted by the platform JWT
+	r.GET("/nginx/auth/verify", h.VerifyAuth)
 }
 
 // CreateCluster creates a new Nginx HA cluster
@@ -325,6 +378,111 @@ func (h *NginxClusterHandler) RemoveNode(c *gin.Context) {
 	})
 }
 
+// ResizeCluster changes CPU/memory limits of all nodes
+// @Summary Resize Cluster Nodes
+// @Description Starts a background operation; backups are resized before the master and each node is updated live or recreated with its config restored
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.ResizeNginxClusterRequest true "Resize request"
+// @Success 202 {object} dto.ClusterOperationInfo "Resize started"
+// @Router /api/v1/nginx/cluster/{id}/resize [post]
+func (h *NginxClusterHandler) ResizeCluster(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var req dto.ResizeNginxClusterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	op, err := h.clusterService.ResizeCluster(c.Request.Context(), clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to resize cluster", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to resize cluster",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Cluster resize started",
+		Data:    op,
+	})
+}
+
+// ListOperations lists tracked operations of a cluster
+// @Summary List Cluster Operations
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 200 {array} dto.ClusterOperationInfo
+// @Router /api/v1/nginx/cluster/{id}/operations [get]
+func (h *NginxClusterHandler) ListOperations(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	ops, err := h.clusterService.ListOperations(c.Request.Context(), clusterID)
+	if err != nil {
+		h.logger.Error("failed to list operations", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to list operations",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Operations retrieved",
+		Data:    ops,
+	})
+}
+
+// GetOperation returns the progress of a cluster operation
+// @Summary Get Cluster Operation
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param operationId path string true "Operation ID"
+// @Success 200 {object} dto.ClusterOperationInfo
+// @Router /api/v1/nginx/cluster/{id}/operations/{operationId} [get]
+func (h *NginxClusterHandler) GetOperation(c *gin.Context) {
+	clusterID := c.Param("id")
+	operationID := c.Param("operationId")
+
+	op, err := h.clusterService.GetOperation(c.Request.Context(), clusterID, operationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Operation not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Operation retrieved",
+		Data:    op,
+	})
+}
+
 // UpdateClusterConfig updates nginx configuration
 // @Summary Update Cluster Config
 // @Tags Nginx Cluster
@@ -335,6 +493,7 @@ func (h *NginxClusterHandler) RemoveNode(c *gin.Context) {
 // @Router /api/v1/nginx/cluster/{id}/config [put]
 func (h *NginxClusterHandler) UpdateClusterConfig(c *gin.Context) {
 	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
 
 	var req dto.UpdateNginxClusterConfigRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -347,7 +506,7 @@ func (h *NginxClusterHandler) UpdateClusterConfig(c *gin.Context) {
 		return
 	}
 
-	if err := h.clusterService.UpdateClusterConfig(c.Request.Context(), clusterID, req); err != nil {
+	if err := h.clusterService.UpdateClusterConfig(c.Request.Context(), userID, clusterID, req); err != nil {
 		h.logger.Error("failed to update config", zap.String("cluster_id", clusterID), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
@@ -365,6 +524,141 @@ func (h *NginxClusterHandler) UpdateClusterConfig(c *gin.Context) {
 	})
 }
 
+// ListConfigRevisions lists the stored nginx.conf revisions of a cluster
+// @Summary List Config Revisions
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param limit query int false "Maximum number of revisions" default(50)
+// @Success 200 {object} dto.NginxConfigRevisionListResponse
+// @Router /api/v1/nginx/cluster/{id}/config/revisions [get]
+func (h *NginxClusterHandler) ListConfigRevisions(c *gin.Context) {
+	clusterID := c.Param("id")
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "limit must be a positive integer",
+		})
+		return
+	}
+
+	result, err := h.clusterService.ListConfigRevisions(c.Request.Context(), clusterID, limit)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Failed to list config revisions",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// GetConfigRevision returns one config revision with its diff
+// @Summary Get Config Revision
+// @Description Returns the config and diff of a revision. With against the diff is computed against that revision.
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param revision path int true "Revision number"
+// @Param against query int false "Revision to diff against"
+// @Success 200 {object} dto.NginxConfigRevisionInfo
+// @Router /api/v1/nginx/cluster/{id}/config/revisions/{revision} [get]
+func (h *NginxClusterHandler) GetConfigRevision(c *gin.Context) {
+	clusterID := c.Param("id")
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid revision number",
+		})
+		return
+	}
+	against := 0
+	if value := c.Query("against"); value != "" {
+		if against, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, dto.APIResponse{
+				Success: false,
+				Code:    "BAD_REQUEST",
+				Message: "Invalid against revision number",
+			})
+			return
+		}
+	}
+
+	result, err := h.clusterService.GetConfigRevision(c.Request.Context(), clusterID, revision, against)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Failed to get config revision",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// RollbackConfig reapplies the config of an earlier revision
+// @Summary Rollback Config
+// @Description Stores the config of an earlier revision as a new revision, validates it with nginx -t and applies it to a canary node before the rest
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.RollbackNginxConfigRequest true "Rollback request"
+// @Success 200 {object} dto.NginxConfigRevisionInfo
+// @Router /api/v1/nginx/cluster/{id}/config/rollback [post]
+func (h *NginxClusterHandler) RollbackConfig(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	var req dto.RollbackNginxConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.RollbackConfig(c.Request.Context(), userID, clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to rollback config", zap.String("cluster_id", clusterID), zap.Int("revision", req.Revision), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to rollback config",
+			Data:    result,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Config rolled back successfully",
+		Data:    result,
+	})
+}
+
 // ListUpstreams lists all upstreams
 // @Summary List Upstreams
 // @Tags Nginx Cluster
@@ -404,6 +698,7 @@ func (h *NginxClusterHandler) ListUpstreams(c *gin.Context) {
 // @Router /api/v1/nginx/cluster/{id}/upstreams [post]
 func (h *NginxClusterHandler) AddUpstream(c *gin.Context) {
 	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
 
 	var req dto.AddNginxUpstreamRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -416,7 +711,7 @@ func (h *NginxClusterHandler) AddUpstream(c *gin.Context) {
 		return
 	}
 
-	if err := h.clusterService.AddUpstream(c.Request.Context(), clusterID, req); err != nil {
+	if err := h.clusterService.AddUpstream(c.Request.Context(), userID, clusterID, req); err != nil {
 		h.logger.Error("failed to add upstream", zap.String("cluster_id", clusterID), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
@@ -445,6 +740,7 @@ func (h *NginxClusterHandler) AddUpstream(c *gin.Context) {
 // @Router /api/v1/nginx/cluster/{id}/upstreams/{upstreamId} [put]
 func (h *NginxClusterHandler) UpdateUpstream(c *gin.Context) {
 	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
 	upstreamID := c.Param("upstreamId")
 
 	var req dto.UpdateNginxUpstreamRequest
@@ -458,7 +754,7 @@ func (h *NginxClusterHandler) UpdateUpstream(c *gin.Context) {
 		return
 	}
 
-	if err := h.clusterService.UpdateUpstream(c.Request.Context(), clusterID, upstreamID, req); err != nil {
+	if err := h.clusterService.UpdateUpstream(c.Request.Context(), userID, clusterID, upstreamID, req); err != nil {
 		h.logger.Error("failed to update upstream", zap.String("cluster_id", clusterID), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
@@ -485,9 +781,10 @@ func (h *NginxClusterHandler) UpdateUpstream(c *gin.Context) {
 // @Router /api/v1/nginx/cluster/{id}/upstreams/{upstreamId} [delete]
 func (h *NginxClusterHandler) DeleteUpstream(c *gin.Context) {
 	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
 	upstreamID := c.Param("upstreamId")
 
-	if err := h.clusterService.DeleteUpstream(c.Request.Context(), clusterID, upstreamID); err != nil {
+	if err := h.clusterService.DeleteUpstream(c.Request.Context(), userID, clusterID, upstreamID); err != nil {
 		h.logger.Error("failed to delete upstream", zap.String("cluster_id", clusterID), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
@@ -505,23 +802,22 @@ func (h *NginxClusterHandler) DeleteUpstream(c *gin.Context) {
 	})
 }
 
-// ListServerBlocks lists all server blocks
-// @Summary List Server Blocks
+// ListAccessPolicies lists the access policies of a cluster
+// @Summary List Access Policies
 // @Tags Nginx Cluster
 // @Produce json
 // @Param id path string true "Cluster ID"
-// @Success 200 {array} dto.ServerBlockInfo
-// @Router /api/v1/nginx/cluster/{id}/server-blocks [get]
-func (h *NginxClusterHandler) ListServerBlocks(c *gin.Context) {
+// @Success 200 {array} dto.NginxAccessPolicyInfo
+// @Router /api/v1/nginx/cluster/{id}/access-policies [get]
+func (h *NginxClusterHandler) ListAccessPolicies(c *gin.Context) {
 	clusterID := c.Param("id")
 
-	result, err := h.clusterService.ListServerBlocks(c.Request.Context(), clusterID)
+	result, err := h.clusterService.ListAccessPolicies(c.Request.Context(), clusterID)
 	if err != nil {
-		h.logger.Error("failed to list server blocks", zap.String("cluster_id", clusterID), zap.Error(err))
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+		c.JSON(http.StatusNotFound, dto.APIResponse{
 			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to list server blocks",
+			Code:    "NOT_FOUND",
+			Message: "Cluster not found",
 			Error:   err.Error(),
 		})
 		return
@@ -530,22 +826,26 @@ func (h *NginxClusterHandler) ListServerBlocks(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
+		Message: "Access policies retrieved successfully",
 		Data:    result,
 	})
 }
 
-// AddServerBlock adds a server block
-// @Summary Add Server Block
+// CreateAccessPolicy restricts a server block or location by address, basic auth or auth_request
+// @Summary Create Access Policy
+// @Description Leave location_id empty to protect the whole server block.
 // @Tags Nginx Cluster
 // @Accept json
+// @Produce json
 // @Param id path string true "Cluster ID"
-// @Param request body dto.AddNginxServerBlockRequest true "Add server block request"
-// @Success 201 {object} dto.APIResponse
-// @Router /api/v1/nginx/cluster/{id}/server-blocks [post]
-func (h *NginxClusterHandler) AddServerBlock(c *gin.Context) {
+// @Param request body dto.CreateNginxAccessPolicyRequest true "Create access policy request"
+// @Success 201 {object} dto.NginxAccessPolicyInfo
+// @Router /api/v1/nginx/cluster/{id}/access-policies [post]
+func (h *NginxClusterHandler) CreateAccessPolicy(c *gin.Context) {
 	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
 
-	var req dto.AddNginxServerBlockRequest
+	var req dto.CreateNginxAccessPolicyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
@@ -556,12 +856,13 @@ func (h *NginxClusterHandler) AddServerBlock(c *gin.Context) {
 		return
 	}
 
-	if err := h.clusterService.AddServerBlock(c.Request.Context(), clusterID, req); err != nil {
-		h.logger.Error("failed to add server block", zap.String("cluster_id", clusterID), zap.Error(err))
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+	result, err := h.clusterService.CreateAccessPolicy(c.Request.Context(), userID, clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to create access policy", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to add server block",
+			Code:    "BAD_REQUEST",
+			Message: "Failed to create access policy",
 			Error:   err.Error(),
 		})
 		return
@@ -570,56 +871,44 @@ func (h *NginxClusterHandler) AddServerBlock(c *gin.Context) {
 	c.JSON(http.StatusCreated, dto.APIResponse{
 		Success: true,
 		Code:    "CREATED",
-		Message: "Server block added successfully",
+		Message: "Access policy created successfully",
+		Data:    result,
 	})
 }
 
-// DeleteServerBlock deletes a server block
-// @Summary Delete Server Block
+// UpdateAccessPolicy replaces the rules of an access policy
+// @Summary Update Access Policy
 // @Tags Nginx Cluster
+// @Accept json
+// @Produce json
 // @Param id path string true "Cluster ID"
-// @Param blockId path string true "Block ID"
-// @Success 200 {object} dto.APIResponse
-// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId} [delete]
-func (h *NginxClusterHandler) DeleteServerBlock(c *gin.Context) {
+// @Param policyId path string true "Policy ID"
+// @Param request body dto.UpdateNginxAccessPolicyRequest true "Update access policy request"
+// @Success 200 {object} dto.NginxAccessPolicyInfo
+// @Router /api/v1/nginx/cluster/{id}/access-policies/{policyId} [put]
+func (h *NginxClusterHandler) UpdateAccessPolicy(c *gin.Context) {
 	clusterID := c.Param("id")
-	blockID := c.Param("blockId")
+	userID := c.GetString("user_id")
+	policyID := c.Param("policyId")
 
-	if err := h.clusterService.DeleteServerBlock(c.Request.Context(), clusterID, blockID); err != nil {
-		h.logger.Error("failed to delete server block", zap.String("cluster_id", clusterID), zap.Error(err))
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+	var req dto.UpdateNginxAccessPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to delete server block",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.APIResponse{
-		Success: true,
-		Code:    "SUCCESS",
-		Message: "Server block deleted successfully",
-	})
-}
-
-// GetClusterHealth returns cluster health status
-// @Summary Get Cluster Health
-// @Tags Nginx Cluster
-// @Produce json
-// @Param id path string true "Cluster ID"
-// @Success 200 {object} dto.NginxClusterHealthResponse
-// @Router /api/v1/nginx/cluster/{id}/health [get]
-func (h *NginxClusterHandler) GetClusterHealth(c *gin.Context) {
-	clusterID := c.Param("id")
-
-	result, err := h.clusterService.GetClusterHealth(c.Request.Context(), clusterID)
+	result, err := h.clusterService.UpdateAccessPolicy(c.Request.Context(), userID, clusterID, policyID, req)
 	if err != nil {
-		h.logger.Error("failed to get cluster health", zap.String("cluster_id", clusterID), zap.Error(err))
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+		h.logger.Error("failed to update access policy", zap.String("cluster_id", clusterID), zap.String("policy_id", policyID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to get cluster health",
+			Code:    "BAD_REQUEST",
+			Message: "Failed to update access policy",
 			Error:   err.Error(),
 		})
 		return
@@ -628,27 +917,29 @@ func (h *NginxClusterHandler) GetClusterHealth(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
+		Message: "Access policy updated successfully",
 		Data:    result,
 	})
 }
 
-// GetClusterMetrics returns cluster metrics
-// @Summary Get Cluster Metrics
+// DeleteAccessPolicy removes an access policy and its basic auth users
+// @Summary Delete Access Policy
 // @Tags Nginx Cluster
-// @Produce json
 // @Param id path string true "Cluster ID"
-// @Success 200 {object} dto.NginxClusterMetricsResponse
-// @Router /api/v1/nginx/cluster/{id}/metrics [get]
-func (h *NginxClusterHandler) GetClusterMetrics(c *gin.Context) {
+// @Param policyId path string true "Policy ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /api/v1/nginx/cluster/{id}/access-policies/{policyId} [delete]
+func (h *NginxClusterHandler) DeleteAccessPolicy(c *gin.Context) {
 	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+	policyID := c.Param("policyId")
 
-	result, err := h.clusterService.GetClusterMetrics(c.Request.Context(), clusterID)
-	if err != nil {
-		h.logger.Error("failed to get cluster metrics", zap.String("cluster_id", clusterID), zap.Error(err))
+	if err := h.clusterService.DeleteAccessPolicy(c.Request.Context(), userID, clusterID, policyID); err != nil {
+		h.logger.Error("failed to delete access policy", zap.String("cluster_id", clusterID), zap.String("policy_id", policyID), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
 			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to get cluster metrics",
+			Message: "Failed to delete access policy",
 			Error:   err.Error(),
 		})
 		return
@@ -657,23 +948,944 @@ func (h *NginxClusterHandler) GetClusterMetrics(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
-		Data:    result,
+		Message: "Access policy deleted successfully",
 	})
 }
 
-// TriggerFailover manually triggers failover
-// @Summary Trigger Failover
+// SetBasicAuthUser adds a basic auth user to a policy or resets its password
+// @Summary Set Basic Auth User
+// @Description The password is stored as a bcrypt hash and never returned.
 // @Tags Nginx Cluster
 // @Accept json
 // @Produce json
 // @Param id path string true "Cluster ID"
-// @Param request body dto.TriggerNginxFailoverRequest true "Failover request"
+// @Param policyId path string true "Policy ID"
+// @Param request body dto.SetNginxBasicAuthUserRequest true "Basic auth user"
+// @Success 200 {object} dto.NginxAccessPolicyInfo
+// @Router /api/v1/nginx/cluster/{id}/access-policies/{policyId}/users [post]
+func (h *NginxClusterHandler) SetBasicAuthUser(c *gin.Context) {
+	clusterID := c.Param("id")
+	policyID := c.Param("policyId")
+
+	var req dto.SetNginxBasicAuthUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.SetBasicAuthUser(c.Request.Context(), clusterID, policyID, req)
+	if err != nil {
+		h.logger.Error("failed to set basic auth user", zap.String("cluster_id", clusterID), zap.String("policy_id", policyID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to set basic auth user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Basic auth user saved successfully",
+		Data:    result,
+	})
+}
+
+// DeleteBasicAuthUser removes a basic auth user from a policy
+// @Summary Delete Basic Auth User
+// @Tags Nginx Cluster
+// @Param id path string true "Cluster ID"
+// @Param policyId path string true "Policy ID"
+// @Param username path string true "Username"
+// @Success 200 {object} dto.APIResponse
+// @Router /api/v1/nginx/cluster/{id}/access-policies/{policyId}/users/{username} [delete]
+func (h *NginxClusterHandler) DeleteBasicAuthUser(c *gin.Context) {
+	clusterID := c.Param("id")
+	policyID := c.Param("policyId")
+	username := c.Param("username")
+
+	if err := h.clusterService.DeleteBasicAuthUser(c.Request.Context(), clusterID, policyID, username); err != nil {
+		h.logger.Error("failed to delete basic auth user", zap.String("cluster_id", clusterID), zap.String("policy_id", policyID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to delete basic auth user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Basic auth user deleted successfully",
+	})
+}
+
+// VerifyAuth is the auth_request endpoint for locations fronted by the platform JWT. The JWT
+// middleware has already rejected the request with 401 when the token is missing or invalid.
+// @Summary Verify Platform Token
+// @Description Returns 204 with the caller in X-User-ID; used as an nginx auth_request_url.
+// @Tags Nginx Cluster
+// @Success 204
+// @Failure 401 {object} dto.APIResponse
+// @Router /api/v1/nginx/auth/verify [get]
+func (h *NginxClusterHandler) VerifyAuth(c *gin.Context) {
+	c.Header("X-User-ID", c.GetString("user_id"))
+	c.Status(http.StatusNoContent)
+}
+
+// ListStreamProxies lists the TCP/UDP stream proxies of a cluster
+// @Summary List Stream Proxies
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 200 {array} dto.NginxStreamProxyInfo
+// @Router /api/v1/nginx/cluster/{id}/streams [get]
+func (h *NginxClusterHandler) ListStreamProxies(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	result, err := h.clusterService.ListStreamProxies(c.Request.Context(), clusterID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Cluster not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Stream proxies retrieved successfully",
+		Data:    result,
+	})
+}
+
+// AddStreamProxy adds a TCP/UDP stream proxy and publishes its port on every node
+// @Summary Add Stream Proxy
+// @Description Nodes whose published ports change are recreated one at a time, backups first.
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.AddNginxStreamProxyRequest true "Add stream proxy request"
+// @Success 201 {object} dto.NginxStreamProxyInfo
+// @Router /api/v1/nginx/cluster/{id}/streams [post]
+func (h *NginxClusterHandler) AddStreamProxy(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	var req dto.AddNginxStreamProxyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.AddStreamProxy(c.Request.Context(), userID, clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to add stream proxy", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to add stream proxy",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "CREATED",
+		Message: "Stream proxy added successfully",
+		Data:    result,
+	})
+}
+
+// UpdateStreamProxy replaces a stream proxy
+// @Summary Update Stream Proxy
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param streamId path string true "Stream ID"
+// @Param request body dto.UpdateNginxStreamProxyRequest true "Update stream proxy request"
+// @Success 200 {object} dto.NginxStreamProxyInfo
+// @Router /api/v1/nginx/cluster/{id}/streams/{streamId} [put]
+func (h *NginxClusterHandler) UpdateStreamProxy(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+	streamID := c.Param("streamId")
+
+	var req dto.UpdateNginxStreamProxyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.UpdateStreamProxy(c.Request.Context(), userID, clusterID, streamID, req)
+	if err != nil {
+		h.logger.Error("failed to update stream proxy", zap.String("cluster_id", clusterID), zap.String("stream_id", streamID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to update stream proxy",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Stream proxy updated successfully",
+		Data:    result,
+	})
+}
+
+// DeleteStreamProxy deletes a stream proxy and unpublishes its port
+// @Summary Delete Stream Proxy
+// @Tags Nginx Cluster
+// @Param id path string true "Cluster ID"
+// @Param streamId path string true "Stream ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /api/v1/nginx/cluster/{id}/streams/{streamId} [delete]
+func (h *NginxClusterHandler) DeleteStreamProxy(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+	streamID := c.Param("streamId")
+
+	if err := h.clusterService.DeleteStreamProxy(c.Request.Context(), userID, clusterID, streamID); err != nil {
+		h.logger.Error("failed to delete stream proxy", zap.String("cluster_id", clusterID), zap.String("stream_id", streamID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to delete stream proxy",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Stream proxy deleted successfully",
+	})
+}
+
+// ListServerBlocks lists all server blocks
+// @Summary List Server Blocks
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 200 {array} dto.ServerBlockInfo
+// @Router /api/v1/nginx/cluster/{id}/server-blocks [get]
+func (h *NginxClusterHandler) ListServerBlocks(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	result, err := h.clusterService.ListServerBlocks(c.Request.Context(), clusterID)
+	if err != nil {
+		h.logger.Error("failed to list server blocks", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to list server blocks",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// AddServerBlock adds a server block
+// @Summary Add Server Block
+// @Tags Nginx Cluster
+// @Accept json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.AddNginxServerBlockRequest true "Add server block request"
+// @Success 201 {object} dto.APIResponse
+// @Router /api/v1/nginx/cluster/{id}/server-blocks [post]
+func (h *NginxClusterHandler) AddServerBlock(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	var req dto.AddNginxServerBlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := h.clusterService.AddServerBlock(c.Request.Context(), userID, clusterID, req); err != nil {
+		h.logger.Error("failed to add server block", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to add server block",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "CREATED",
+		Message: "Server block added successfully",
+	})
+}
+
+// DeleteServerBlock deletes a server block
+// @Summary Delete Server Block
+// @Tags Nginx Cluster
+// @Param id path string true "Cluster ID"
+// @Param blockId path string true "Block ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId} [delete]
+func (h *NginxClusterHandler) DeleteServerBlock(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+	blockID := c.Param("blockId")
+
+	if err := h.clusterService.DeleteServerBlock(c.Request.Context(), userID, clusterID, blockID); err != nil {
+		h.logger.Error("failed to delete server block", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to delete server block",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Server block deleted successfully",
+	})
+}
+
+// ListLocations lists the locations of a server block
+// @Summary List Locations
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param blockId path string true "Block ID"
+// @Success 200 {array} dto.LocationInfo
+// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId}/locations [get]
+func (h *NginxClusterHandler) ListLocations(c *gin.Context) {
+	clusterID := c.Param("id")
+	blockID := c.Param("blockId")
+
+	result, err := h.clusterService.ListLocations(c.Request.Context(), clusterID, blockID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Failed to list locations",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// AddLocation adds a location to a server block
+// @Summary Add Location
+// @Description Adds a location (optional modifier =, ~, ~*, ^~) and re-applies the generated nginx.conf
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param blockId path string true "Block ID"
+// @Param request body dto.AddNginxLocationRequest true "Add location request"
+// @Success 201 {object} dto.LocationInfo
+// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId}/locations [post]
+func (h *NginxClusterHandler) AddLocation(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+	blockID := c.Param("blockId")
+
+	var req dto.AddNginxLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.AddLocation(c.Request.Context(), userID, clusterID, blockID, req)
+	if err != nil {
+		h.logger.Error("failed to add location", zap.String("cluster_id", clusterID), zap.String("block_id", blockID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to add location",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "CREATED",
+		Message: "Location added successfully",
+		Data:    result,
+	})
+}
+
+// UpdateLocation replaces a location of a server block
+// @Summary Update Location
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param blockId path string true "Block ID"
+// @Param locationId path string true "Location ID"
+// @Param request body dto.UpdateNginxLocationRequest true "Update location request"
+// @Success 200 {object} dto.LocationInfo
+// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId}/locations/{locationId} [put]
+func (h *NginxClusterHandler) UpdateLocation(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+	blockID := c.Param("blockId")
+	locationID := c.Param("locationId")
+
+	var req dto.UpdateNginxLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.UpdateLocation(c.Request.Context(), userID, clusterID, blockID, locationID, req)
+	if err != nil {
+		h.logger.Error("failed to update location", zap.String("cluster_id", clusterID), zap.String("location_id", locationID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to update location",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Location updated successfully",
+		Data:    result,
+	})
+}
+
+// DeleteLocation deletes a location from a server block
+// @Summary Delete Location
+// @Tags Nginx Cluster
+// @Param id path string true "Cluster ID"
+// @Param blockId path string true "Block ID"
+// @Param locationId path string true "Location ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId}/locations/{locationId} [delete]
+func (h *NginxClusterHandler) DeleteLocation(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+	blockID := c.Param("blockId")
+	locationID := c.Param("locationId")
+
+	if err := h.clusterService.DeleteLocation(c.Request.Context(), userID, clusterID, blockID, locationID); err != nil {
+		h.logger.Error("failed to delete location", zap.String("cluster_id", clusterID), zap.String("location_id", locationID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to delete location",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Location deleted successfully",
+	})
+}
+
+// GetTrafficPolicy returns the traffic policy of a location with its history
+// @Summary Get Traffic Policy
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param blockId path string true "Block ID"
+// @Param locationId path string true "Location ID"
+// @Success 200 {object} dto.NginxTrafficPolicyInfo
+// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId}/locations/{locationId}/traffic [get]
+func (h *NginxClusterHandler) GetTrafficPolicy(c *gin.Context) {
+	clusterID := c.Param("id")
+	blockID := c.Param("blockId")
+	locationID := c.Param("locationId")
+
+	result, err := h.clusterService.GetTrafficPolicy(c.Request.Context(), clusterID, blockID, locationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Location not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Traffic policy retrieved successfully",
+		Data:    result,
+	})
+}
+
+// SetTrafficPolicy replaces the traffic policy of a location
+// @Summary Set Traffic Policy
+// @Description Weighted split between proxy_pass and a canary upstream, or blue/green between two upstreams. Requests with the route header or cookie go to the other upstream.
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param blockId path string true "Block ID"
+// @Param locationId path string true "Location ID"
+// @Param request body dto.SetNginxTrafficPolicyRequest true "Traffic policy"
+// @Success 200 {object} dto.NginxTrafficPolicyInfo
+// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId}/locations/{locationId}/traffic [put]
+func (h *NginxClusterHandler) SetTrafficPolicy(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+	blockID := c.Param("blockId")
+	locationID := c.Param("locationId")
+
+	var req dto.SetNginxTrafficPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.SetTrafficPolicy(c.Request.Context(), userID, clusterID, blockID, locationID, req)
+	if err != nil {
+		h.logger.Error("failed to set traffic policy", zap.String("cluster_id", clusterID), zap.String("location_id", locationID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to set traffic policy",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Traffic policy applied successfully",
+		Data:    result,
+	})
+}
+
+// SwitchTraffic flips a blue/green location to the upstream that is not serving traffic
+// @Summary Switch Blue/Green Traffic
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param blockId path string true "Block ID"
+// @Param locationId path string true "Location ID"
+// @Param request body dto.SwitchNginxTrafficRequest false "Switch request"
+// @Success 200 {object} dto.NginxTrafficPolicyInfo
+// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId}/locations/{locationId}/traffic/switch [post]
+func (h *NginxClusterHandler) SwitchTraffic(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+	blockID := c.Param("blockId")
+	locationID := c.Param("locationId")
+
+	var req dto.SwitchNginxTrafficRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.SwitchTraffic(c.Request.Context(), userID, clusterID, blockID, locationID, req)
+	if err != nil {
+		h.logger.Error("failed to switch traffic", zap.String("cluster_id", clusterID), zap.String("location_id", locationID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to switch traffic",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Traffic switched successfully",
+		Data:    result,
+	})
+}
+
+// RollbackTrafficPolicy restores an earlier traffic policy version
+// @Summary Roll Back Traffic Policy
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param blockId path string true "Block ID"
+// @Param locationId path string true "Location ID"
+// @Param request body dto.RollbackNginxTrafficPolicyRequest false "Rollback request, previous version when empty"
+// @Success 200 {object} dto.NginxTrafficPolicyInfo
+// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId}/locations/{locationId}/traffic/rollback [post]
+func (h *NginxClusterHandler) RollbackTrafficPolicy(c *gin.Context) {
+	clusterID := c.Param("id")
+	userID := c.GetString("user_id")
+	blockID := c.Param("blockId")
+	locationID := c.Param("locationId")
+
+	var req dto.RollbackNginxTrafficPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.RollbackTrafficPolicy(c.Request.Context(), userID, clusterID, blockID, locationID, req)
+	if err != nil {
+		h.logger.Error("failed to roll back traffic policy", zap.String("cluster_id", clusterID), zap.String("location_id", locationID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Failed to roll back traffic policy",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Traffic policy rolled back successfully",
+		Data:    result,
+	})
+}
+
+// GetClusterHealth returns cluster health status
+// @Summary Get Cluster Health
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 200 {object} dto.NginxClusterHealthResponse
+// @Router /api/v1/nginx/cluster/{id}/health [get]
+func (h *NginxClusterHandler) GetClusterHealth(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	result, err := h.clusterService.GetClusterHealth(c.Request.Context(), clusterID)
+	if err != nil {
+		h.logger.Error("failed to get cluster health", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to get cluster health",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// GetClusterMetrics returns cluster metrics
+// @Summary Get Cluster Metrics
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 200 {object} dto.NginxClusterMetricsResponse
+// @Router /api/v1/nginx/cluster/{id}/metrics [get]
+func (h *NginxClusterHandler) GetClusterMetrics(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	result, err := h.clusterService.GetClusterMetrics(c.Request.Context(), clusterID)
+	if err != nil {
+		h.logger.Error("failed to get cluster metrics", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to get cluster metrics",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// GetMetricsHistory returns stored metric samples
+// @Summary Get Metrics History
+// @Description Per-node samples scraped every 15 seconds from stub_status and the access log, newest first. Defaults to the last hour. Samples are kept for 7 days in the provisioning database only; they are not indexed into Elasticsearch with the monitoring service's metrics.
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param node_id query string false "Only samples of this node"
+// @Param from query string false "Start time (RFC3339)"
+// @Param to query string false "End time (RFC3339)"
+// @Param limit query int false "Maximum number of samples (default 500)"
+// @Success 200 {object} dto.NginxMetricsHistoryResponse
+// @Router /api/v1/nginx/cluster/{id}/metrics/history [get]
+func (h *NginxClusterHandler) GetMetricsHistory(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var from, to time.Time
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.APIResponse{
+				Success: false,
+				Code:    "BAD_REQUEST",
+				Message: "Invalid " + param.name + " time, expected RFC3339",
+				Error:   err.Error(),
+			})
+			return
+		}
+		*param.value = parsed
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	result, err := h.clusterService.GetMetricsHistory(c.Request.Context(), clusterID, c.Query("node_id"), from, to, limit)
+	if err != nil {
+		h.logger.Error("failed to get metrics history", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to get metrics history",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// TriggerFailover manually triggers failover
+// @Summary Trigger Failover
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.TriggerNginxFailoverRequest true "Failover request"
 // @Success 200 {object} dto.NginxFailoverResponse
 // @Router /api/v1/nginx/cluster/{id}/failover [post]
 func (h *NginxClusterHandler) TriggerFailover(c *gin.Context) {
 	clusterID := c.Param("id")
 
-	var req dto.TriggerNginxFailoverRequest
+	var req dto.TriggerNginxFailoverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.TriggerFailover(c.Request.Context(), clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to trigger failover", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to trigger failover",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Failover triggered successfully",
+		Data:    result,
+	})
+}
+
+// GetFailoverHistory returns failover history
+// @Summary Get Failover History
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 200 {object} dto.NginxFailoverHistoryResponse
+// @Router /api/v1/nginx/cluster/{id}/failover-history [get]
+func (h *NginxClusterHandler) GetFailoverHistory(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	result, err := h.clusterService.GetFailoverHistory(c.Request.Context(), clusterID)
+	if err != nil {
+		h.logger.Error("failed to get failover history", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to get failover history",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// ListCertificates lists the certificates stored for a cluster
+// @Summary List Certificates
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 200 {array} dto.NginxCertificateInfo
+// @Router /api/v1/nginx/cluster/{id}/certificates [get]
+func (h *NginxClusterHandler) ListCertificates(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	result, err := h.clusterService.ListCertificates(c.Request.Context(), clusterID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to list certificates",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// GetCertificate returns one certificate
+// @Summary Get Certificate
+// @Description Returns the certificate details; pending CSR certificates include the CSR to hand to a CA
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param certId path string true "Certificate ID"
+// @Success 200 {object} dto.NginxCertificateInfo
+// @Router /api/v1/nginx/cluster/{id}/certificates/{certId} [get]
+func (h *NginxClusterHandler) GetCertificate(c *gin.Context) {
+	clusterID := c.Param("id")
+	certID := c.Param("certId")
+
+	result, err := h.clusterService.GetCertificate(c.Request.Context(), clusterID, certID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Failed to get certificate",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// UploadCertificate imports a certificate with its private key
+// @Summary Upload Certificate
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.UploadNginxCertificateRequest true "Certificate and key in PEM"
+// @Success 201 {object} dto.NginxCertificateInfo
+// @Router /api/v1/nginx/cluster/{id}/certificates [post]
+func (h *NginxClusterHandler) UploadCertificate(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var req dto.UploadNginxCertificateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
@@ -684,13 +1896,102 @@ func (h *NginxClusterHandler) TriggerFailover(c *gin.Context) {
 		return
 	}
 
-	result, err := h.clusterService.TriggerFailover(c.Request.Context(), clusterID, req)
+	result, err := h.clusterService.UploadCertificate(c.Request.Context(), clusterID, req)
 	if err != nil {
-		h.logger.Error("failed to trigger failover", zap.String("cluster_id", clusterID), zap.Error(err))
+		h.logger.Error("failed to upload certificate", zap.String("cluster_id", clusterID), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
 			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to trigger failover",
+			Message: "Failed to upload certificate",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "CREATED",
+		Message: "Certificate uploaded successfully",
+		Data:    result,
+	})
+}
+
+// CreateCertificateCSR generates a private key and a CSR
+// @Summary Create CSR
+// @Description Generates a key and a CSR; attach the signed certificate with the complete endpoint
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.CreateNginxCSRRequest true "CSR request"
+// @Success 201 {object} dto.NginxCertificateInfo
+// @Router /api/v1/nginx/cluster/{id}/certificates/csr [post]
+func (h *NginxClusterHandler) CreateCertificateCSR(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var req dto.CreateNginxCSRRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.CreateCertificateCSR(c.Request.Context(), clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to create CSR", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to create CSR",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "CREATED",
+		Message: "CSR created successfully",
+		Data:    result,
+	})
+}
+
+// CompleteCertificateCSR attaches the signed certificate to a pending CSR
+// @Summary Complete CSR
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param certId path string true "Certificate ID"
+// @Param request body dto.CompleteNginxCSRRequest true "Signed certificate in PEM"
+// @Success 200 {object} dto.NginxCertificateInfo
+// @Router /api/v1/nginx/cluster/{id}/certificates/{certId}/complete [post]
+func (h *NginxClusterHandler) CompleteCertificateCSR(c *gin.Context) {
+	clusterID := c.Param("id")
+	certID := c.Param("certId")
+
+	var req dto.CompleteNginxCSRRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.CompleteCertificateCSR(c.Request.Context(), clusterID, certID, req)
+	if err != nil {
+		h.logger.Error("failed to complete CSR", zap.String("certificate_id", certID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to complete CSR",
 			Error:   err.Error(),
 		})
 		return
@@ -699,28 +2000,117 @@ func (h *NginxClusterHandler) TriggerFailover(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
-		Message: "Failover triggered successfully",
+		Message: "Certificate activated successfully",
 		Data:    result,
 	})
 }
 
-// GetFailoverHistory returns failover history
-// @Summary Get Failover History
+// IssueSelfSignedCertificate issues a self-signed certificate
+// @Summary Issue Self-Signed Certificate
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.IssueSelfSignedCertificateRequest true "Self-signed certificate request"
+// @Success 201 {object} dto.NginxCertificateInfo
+// @Router /api/v1/nginx/cluster/{id}/certificates/self-signed [post]
+func (h *NginxClusterHandler) IssueSelfSignedCertificate(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var req dto.IssueSelfSignedCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.IssueSelfSignedCertificate(c.Request.Context(), clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to issue self-signed certificate", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to issue certificate",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "CREATED",
+		Message: "Certificate issued successfully",
+		Data:    result,
+	})
+}
+
+// RequestACMECertificate orders a certificate from an ACME CA
+// @Summary Request ACME Certificate
+// @Description Orders a certificate over ACME HTTP-01. The certificate is pending until the order completes; poll it with the get endpoint.
 // @Tags Nginx Cluster
+// @Accept json
 // @Produce json
 // @Param id path string true "Cluster ID"
-// @Success 200 {object} dto.NginxFailoverHistoryResponse
-// @Router /api/v1/nginx/cluster/{id}/failover-history [get]
-func (h *NginxClusterHandler) GetFailoverHistory(c *gin.Context) {
+// @Param request body dto.RequestACMECertificateRequest true "ACME request"
+// @Success 202 {object} dto.NginxCertificateInfo
+// @Router /api/v1/nginx/cluster/{id}/certificates/acme [post]
+func (h *NginxClusterHandler) RequestACMECertificate(c *gin.Context) {
 	clusterID := c.Param("id")
 
-	result, err := h.clusterService.GetFailoverHistory(c.Request.Context(), clusterID)
+	var req dto.RequestACMECertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.clusterService.RequestACMECertificate(c.Request.Context(), clusterID, req)
 	if err != nil {
-		h.logger.Error("failed to get failover history", zap.String("cluster_id", clusterID), zap.Error(err))
+		h.logger.Error("failed to request ACME certificate", zap.String("cluster_id", clusterID), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
 			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to get failover history",
+			Message: "Failed to request certificate",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Certificate order started",
+		Data:    result,
+	})
+}
+
+// RenewCertificate renews a self-signed or ACME certificate
+// @Summary Renew Certificate
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param certId path string true "Certificate ID"
+// @Success 200 {object} dto.NginxCertificateInfo
+// @Router /api/v1/nginx/cluster/{id}/certificates/{certId}/renew [post]
+func (h *NginxClusterHandler) RenewCertificate(c *gin.Context) {
+	clusterID := c.Param("id")
+	certID := c.Param("certId")
+
+	result, err := h.clusterService.RenewCertificate(c.Request.Context(), clusterID, certID)
+	if err != nil {
+		h.logger.Error("failed to renew certificate", zap.String("certificate_id", certID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to renew certificate",
 			Error:   err.Error(),
 		})
 		return
@@ -729,6 +2119,98 @@ func (h *NginxClusterHandler) GetFailoverHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
+		Message: "Certificate renewal started",
 		Data:    result,
 	})
 }
+
+// DeployCertificate writes a certificate to every node and reloads nginx
+// @Summary Deploy Certificate
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param certId path string true "Certificate ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /api/v1/nginx/cluster/{id}/certificates/{certId}/deploy [post]
+func (h *NginxClusterHandler) DeployCertificate(c *gin.Context) {
+	clusterID := c.Param("id")
+	certID := c.Param("certId")
+
+	if err := h.clusterService.DeployCertificate(c.Request.Context(), clusterID, certID); err != nil {
+		h.logger.Error("failed to deploy certificate", zap.String("certificate_id", certID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to deploy certificate",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Certificate deployed successfully",
+	})
+}
+
+// SetDefaultCertificate makes a certificate the cluster default
+// @Summary Set Default Certificate
+// @Description The default certificate serves TLS server blocks that have no ssl_cert_id
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param certId path string true "Certificate ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /api/v1/nginx/cluster/{id}/certificates/{certId}/default [post]
+func (h *NginxClusterHandler) SetDefaultCertificate(c *gin.Context) {
+	clusterID := c.Param("id")
+	certID := c.Param("certId")
+
+	if err := h.clusterService.SetDefaultCertificate(c.Request.Context(), clusterID, certID); err != nil {
+		h.logger.Error("failed to set default certificate", zap.String("certificate_id", certID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to set default certificate",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Default certificate updated successfully",
+	})
+}
+
+// DeleteCertificate deletes a certificate that is not in use
+// @Summary Delete Certificate
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param certId path string true "Certificate ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /api/v1/nginx/cluster/{id}/certificates/{certId} [delete]
+func (h *NginxClusterHandler) DeleteCertificate(c *gin.Context) {
+	clusterID := c.Param("id")
+	certID := c.Param("certId")
+
+	if err := h.clusterService.DeleteCertificate(c.Request.Context(), clusterID, certID); err != nil {
+		h.logger.Error("failed to delete certificate", zap.String("certificate_id", certID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to delete certificate",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Certificate deleted successfully",
+	})
+}
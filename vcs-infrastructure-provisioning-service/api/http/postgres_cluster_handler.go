@@ -2,8 +2,10 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
@@ -13,6 +15,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// maxImportSize limits a dump uploaded for import
+const maxImportSize = 10 << 30
+
 type PostgreSQLClusterHandler struct {
 	clusterService services.IPostgreSQLClusterService
 	logger         logger.ILogger
@@ -865,3 +870,649 @@ func (h *PostgreSQLClusterHandler) GetTableData(c *gin.Context) {
 
 	c.JSON(http.StatusOK, data)
 }
+
+// ==================== Upgrade & Operations Endpoints ====================
+
+// UpgradeCluster upgrades the PostgreSQL version of a cluster
+// @Summary Upgrade PostgreSQL version
+// @Description Minor versions are rolled node by node; major versions replicate into a new cluster and cut over. Use dry_run to only run pre-flight checks.
+// @Tags PostgreSQL Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.UpgradeClusterRequest true "Upgrade options"
+// @Success 200 {object} dto.UpgradeClusterResponse "Dry run result"
+// @Success 202 {object} dto.UpgradeClusterResponse "Upgrade started"
+// @Router /api/v1/postgres/cluster/{id}/upgrade [post]
+func (h *PostgreSQLClusterHandler) UpgradeCluster(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var req dto.UpgradeClusterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.clusterService.UpgradeCluster(c.Request.Context(), clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to upgrade cluster", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.DryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	c.JSON(http.StatusAccepted, result)
+}
+
+// ResizeCluster changes CPU/memory limits of all cluster nodes
+// @Summary Resize cluster nodes
+// @Description Nodes are resized one at a time (replicas first) via live update, falling back to recreating the container on the same volume. The leader is switched over before being recreated.
+// @Tags PostgreSQL Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.ResizeClusterRequest true "New per-node resources"
+// @Success 202 {object} dto.ClusterOperationInfo "Resize started"
+// @Router /api/v1/postgres/cluster/{id}/resize [post]
+func (h *PostgreSQLClusterHandler) ResizeCluster(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var req dto.ResizeClusterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	op, err := h.clusterService.ResizeCluster(c.Request.Context(), clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to resize cluster", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, op)
+}
+
+// ListOperations lists tracked operations of a cluster
+// @Summary List cluster operations
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 200 {array} dto.ClusterOperationInfo
+// @Router /api/v1/postgres/cluster/{id}/operations [get]
+func (h *PostgreSQLClusterHandler) ListOperations(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	ops, err := h.clusterService.ListOperations(c.Request.Context(), clusterID)
+	if err != nil {
+		h.logger.Error("failed to list operations", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ops)
+}
+
+// GetOperation returns the progress of a cluster operation
+// @Summary Get cluster operation
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param operationId path string true "Operation ID"
+// @Success 200 {object} dto.ClusterOperationInfo
+// @Router /api/v1/postgres/cluster/{id}/operations/{operationId} [get]
+func (h *PostgreSQLClusterHandler) GetOperation(c *gin.Context) {
+	clusterID := c.Param("id")
+	operationID := c.Param("operationId")
+
+	op, err := h.clusterService.GetOperation(c.Request.Context(), clusterID, operationID)
+	if err != nil {
+		h.logger.Error("failed to get operation", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, op)
+}
+
+// ==================== Standby (DR) Endpoints ====================
+
+// CreateStandbyCluster creates a DR standby cluster replicating from the given cluster
+// @Summary Create standby cluster
+// @Description Creates a new cluster in its own network as a Patroni standby_cluster that continuously replicates from the source cluster
+// @Tags PostgreSQL Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Source cluster ID"
+// @Param request body dto.CreateStandbyClusterRequest true "Standby cluster options"
+// @Success 201 {object} dto.ClusterInfoResponse
+// @Router /api/v1/postgres/cluster/{id}/standbys [post]
+func (h *PostgreSQLClusterHandler) CreateStandbyCluster(c *gin.Context) {
+	sourceClusterID := c.Param("id")
+
+	var req dto.CreateStandbyClusterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		userID = "system"
+	}
+
+	// The initial base backup can take a while, don't tie it to the HTTP request
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+
+	cluster, err := h.clusterService.CreateStandbyCluster(ctx, userID.(string), sourceClusterID, req)
+	if err != nil {
+		h.logger.Error("failed to create standby cluster", zap.String("source_cluster_id", sourceClusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, cluster)
+}
+
+// GetStandbyStatus returns replication lag between a standby cluster and its source
+// @Summary Get standby replication status
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Standby cluster ID"
+// @Success 200 {object} dto.StandbyStatusResponse
+// @Router /api/v1/postgres/cluster/{id}/standby/status [get]
+func (h *PostgreSQLClusterHandler) GetStandbyStatus(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	status, err := h.clusterService.GetStandbyStatus(c.Request.Context(), clusterID)
+	if err != nil {
+		h.logger.Error("failed to get standby status", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// PromoteStandbyCluster promotes a standby cluster to a standalone read-write cluster
+// @Summary Promote standby cluster
+// @Description Stops following the source cluster; used for DR drills and real disasters
+// @Tags PostgreSQL Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Standby cluster ID"
+// @Param request body dto.PromoteStandbyRequest false "Promotion options"
+// @Success 200 {object} dto.ClusterInfoResponse
+// @Router /api/v1/postgres/cluster/{id}/standby/promote [post]
+func (h *PostgreSQLClusterHandler) PromoteStandbyCluster(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var req dto.PromoteStandbyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		// Allow empty body (all fields optional)
+		req = dto.PromoteStandbyRequest{}
+	}
+
+	cluster, err := h.clusterService.PromoteStandbyCluster(c.Request.Context(), clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to promote standby cluster", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cluster)
+}
+
+// ==================== Extension Endpoints ====================
+
+// ListExtensions lists available and installed extensions of a database
+// @Summary List extensions
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param database path string true "Database name"
+// @Success 200 {object} dto.ListExtensionsResponse
+// @Router /api/v1/postgres/cluster/{id}/databases/{database}/extensions [get]
+func (h *PostgreSQLClusterHandler) ListExtensions(c *gin.Context) {
+	clusterID := c.Param("id")
+	database := c.Param("database")
+
+	result, err := h.clusterService.ListExtensions(c.Request.Context(), clusterID, database)
+	if err != nil {
+		h.logger.Error("failed to list extensions", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// CreateExtension enables an extension in a database
+// @Summary Create extension
+// @Description Extensions that need shared_preload_libraries are preloaded through the Patroni config with a rolling restart first (202 with the operation)
+// @Tags PostgreSQL Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param database path string true "Database name"
+// @Param request body dto.CreateExtensionRequest true "Extension"
+// @Success 201 {object} dto.ExtensionChangeResponse "Extension created"
+// @Success 202 {object} dto.ExtensionChangeResponse "Rolling restart started"
+// @Router /api/v1/postgres/cluster/{id}/databases/{database}/extensions [post]
+func (h *PostgreSQLClusterHandler) CreateExtension(c *gin.Context) {
+	clusterID := c.Param("id")
+	database := c.Param("database")
+
+	var req dto.CreateExtensionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.clusterService.CreateExtension(c.Request.Context(), clusterID, database, req)
+	if err != nil {
+		h.logger.Error("failed to create extension", zap.String("cluster_id", clusterID), zap.String("extension", req.Name), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.Operation != nil {
+		c.JSON(http.StatusAccepted, result)
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+// DropExtension removes an extension from a database
+// @Summary Drop extension
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param database path string true "Database name"
+// @Param name path string true "Extension name"
+// @Param cascade query bool false "Drop dependent objects"
+// @Success 200 {object} dto.ExtensionChangeResponse
+// @Router /api/v1/postgres/cluster/{id}/databases/{database}/extensions/{name} [delete]
+func (h *PostgreSQLClusterHandler) DropExtension(c *gin.Context) {
+	clusterID := c.Param("id")
+	database := c.Param("database")
+	name := c.Param("name")
+	cascade := c.Query("cascade") == "true"
+
+	result, err := h.clusterService.DropExtension(c.Request.Context(), clusterID, database, name, cascade)
+	if err != nil {
+		h.logger.Error("failed to drop extension", zap.String("cluster_id", clusterID), zap.String("extension", name), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ==================== Query Insights Endpoints ====================
+
+// GetQueryInsights returns top statements, long-running queries and lock chains of every node
+// @Summary Get query insights
+// @Description Reads pg_stat_statements, pg_stat_activity and pg_locks on the leader and replicas
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param limit query int false "Statements per top list" default(10)
+// @Param min_duration query int false "Minimum runtime in seconds for long-running queries" default(5)
+// @Success 200 {object} dto.QueryInsightsResponse
+// @Router /api/v1/postgres/cluster/{id}/insights [get]
+func (h *PostgreSQLClusterHandler) GetQueryInsights(c *gin.Context) {
+	clusterID := c.Param("id")
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	minDuration, err := strconv.Atoi(c.DefaultQuery("min_duration", "5"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid min_duration"})
+		return
+	}
+
+	result, err := h.clusterService.GetQueryInsights(c.Request.Context(), clusterID, limit, time.Duration(minDuration)*time.Second)
+	if err != nil {
+		h.logger.Error("failed to get query insights", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// CancelQuery cancels a running query or terminates its backend
+// @Summary Cancel or terminate a query
+// @Tags PostgreSQL Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.CancelQueryRequest true "Backend to signal"
+// @Success 200 {object} map[string]string
+// @Router /api/v1/postgres/cluster/{id}/insights/cancel [post]
+func (h *PostgreSQLClusterHandler) CancelQuery(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var req dto.CancelQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.clusterService.CancelQuery(c.Request.Context(), clusterID, req); err != nil {
+		h.logger.Error("failed to cancel query", zap.String("cluster_id", clusterID), zap.Int("pid", req.PID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "query cancelled"
+	if req.Terminate {
+		message = "backend terminated"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// CreateQuerySnapshot stores the current pg_stat_statements counters for later comparison
+// @Summary Create query snapshot
+// @Tags PostgreSQL Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.CreateQuerySnapshotRequest false "Snapshot label"
+// @Success 201 {object} dto.QuerySnapshotInfo
+// @Router /api/v1/postgres/cluster/{id}/insights/snapshots [post]
+func (h *PostgreSQLClusterHandler) CreateQuerySnapshot(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var req dto.CreateQuerySnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		// Allow empty body (all fields optional)
+		req = dto.CreateQuerySnapshotRequest{}
+	}
+
+	result, err := h.clusterService.CreateQuerySnapshot(c.Request.Context(), clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to create query snapshot", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// ListQuerySnapshots lists manual and scheduled snapshots, newest first
+// @Summary List query snapshots
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param limit query int false "Maximum snapshots" default(50)
+// @Success 200 {array} dto.QuerySnapshotInfo
+// @Router /api/v1/postgres/cluster/{id}/insights/snapshots [get]
+func (h *PostgreSQLClusterHandler) ListQuerySnapshots(c *gin.Context) {
+	clusterID := c.Param("id")
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	snapshots, err := h.clusterService.ListQuerySnapshots(c.Request.Context(), clusterID, limit)
+	if err != nil {
+		h.logger.Error("failed to list query snapshots", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshots)
+}
+
+// CompareQuerySnapshots shows per-query activity between two snapshots
+// @Summary Compare query snapshots
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param from query string true "Earlier snapshot ID"
+// @Param to query string true "Later snapshot ID"
+// @Success 200 {object} dto.QuerySnapshotComparison
+// @Router /api/v1/postgres/cluster/{id}/insights/snapshots/compare [get]
+func (h *PostgreSQLClusterHandler) CompareQuerySnapshots(c *gin.Context) {
+	clusterID := c.Param("id")
+	fromID := c.Query("from")
+	toID := c.Query("to")
+	if fromID == "" || toID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to snapshot IDs are required"})
+		return
+	}
+
+	result, err := h.clusterService.CompareQuerySnapshots(c.Request.Context(), clusterID, fromID, toID)
+	if err != nil {
+		h.logger.Error("failed to compare query snapshots", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ==================== Logical Dump/Restore Endpoints ====================
+
+// ExportDatabase streams a logical dump of one database
+// @Summary Export database (pg_dump)
+// @Tags PostgreSQL Cluster
+// @Produce octet-stream
+// @Param id path string true "Cluster ID"
+// @Param database path string true "Database name"
+// @Param format query string false "custom (pg_restore) or plain (SQL)" default(custom)
+// @Param tables query []string false "Only dump these tables"
+// @Param exclude_tables query []string false "Skip these tables"
+// @Param schema_only query bool false "Dump only the schema"
+// @Param data_only query bool false "Dump only the data"
+// @Success 200 {file} file
+// @Router /api/v1/postgres/cluster/{id}/databases/{database}/export [get]
+func (h *PostgreSQLClusterHandler) ExportDatabase(c *gin.Context) {
+	clusterID := c.Param("id")
+	database := c.Param("database")
+
+	var opts dto.DumpOptions
+	if err := c.ShouldBindQuery(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.dump", database, time.Now().Format("20060102-150405"))
+	contentType := "application/octet-stream"
+	if opts.Format == "plain" {
+		filename = fmt.Sprintf("%s-%s.sql", database, time.Now().Format("20060102-150405"))
+		contentType = "application/sql"
+	}
+	// Headers are only sent with the first chunk, so early errors can still be answered with JSON
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if err := h.clusterService.ExportDatabase(c.Request.Context(), clusterID, database, opts, c.Writer); err != nil {
+		h.logger.Error("failed to export database", zap.String("cluster_id", clusterID), zap.String("database", database), zap.Error(err))
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// ImportDatabase loads an uploaded dump into a database
+// @Summary Import database (pg_restore / psql)
+// @Description Custom-format archives are restored with pg_restore, anything else is run as SQL. The database is created when missing. Uploads are limited to 10 GiB.
+// @Tags PostgreSQL Cluster
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param database path string true "Database name"
+// @Param file formData file true "Dump file"
+// @Param clean formData bool false "Drop existing objects first (custom format only)"
+// @Success 202 {object} dto.ClusterOperationInfo
+// @Router /api/v1/postgres/cluster/{id}/databases/{database}/import [post]
+func (h *PostgreSQLClusterHandler) ImportDatabase(c *gin.Context) {
+	clusterID := c.Param("id")
+	database := c.Param("database")
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	var req dto.ImportDatabaseRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(importErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		if status := importErrorStatus(err); status == http.StatusRequestEntityTooLarge {
+			c.JSON(status, gin.H{"error": fmt.Sprintf("dump exceeds %d bytes", int64(maxImportSize))})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dump file is required"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	op, err := h.clusterService.ImportDatabase(c.Request.Context(), clusterID, database, req, file)
+	if err != nil {
+		h.logger.Error("failed to import database", zap.String("cluster_id", clusterID), zap.String("database", database), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, op)
+}
+
+// importErrorStatus maps an upload error to 413 when the dump is over maxImportSize
+func importErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// CopyDatabase copies a database from another managed cluster into this one
+// @Summary Copy database between clusters
+// @Description Pipes pg_dump from the source cluster into pg_restore on this cluster, optionally limited to some tables
+// @Tags PostgreSQL Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Target cluster ID"
+// @Param database path string true "Target database name"
+// @Param request body dto.CopyDatabaseRequest true "Copy source and filters"
+// @Success 202 {object} dto.ClusterOperationInfo
+// @Router /api/v1/postgres/cluster/{id}/databases/{database}/copy [post]
+func (h *PostgreSQLClusterHandler) CopyDatabase(c *gin.Context) {
+	clusterID := c.Param("id")
+	database := c.Param("database")
+
+	var req dto.CopyDatabaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	op, err := h.clusterService.CopyDatabase(c.Request.Context(), clusterID, database, req)
+	if err != nil {
+		h.logger.Error("failed to copy database", zap.String("cluster_id", clusterID), zap.String("source_cluster_id", req.SourceClusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, op)
+}
+
+// ==================== TLS Endpoints ====================
+
+// GetTLSStatus returns the TLS state and node certificates of a cluster
+// @Summary Get cluster TLS status
+// @Description Shows whether TLS is enabled, the platform CA and the active certificate of each node
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 200 {object} dto.ClusterTLSStatus
+// @Router /api/v1/postgres/cluster/{id}/tls [get]
+func (h *PostgreSQLClusterHandler) GetTLSStatus(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	status, err := h.clusterService.GetTLSStatus(c.Request.Context(), clusterID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// EnableTLS turns on TLS for client and replication connections
+// @Summary Enable TLS
+// @Description Issues node certificates from the platform CA, enables ssl on every node with a reload, then refuses non-TLS remote connections and makes replicas verify the leader
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 202 {object} dto.ClusterOperationInfo
+// @Router /api/v1/postgres/cluster/{id}/tls/enable [post]
+func (h *PostgreSQLClusterHandler) EnableTLS(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	op, err := h.clusterService.EnableTLS(c.Request.Context(), clusterID)
+	if err != nil {
+		h.logger.Error("failed to enable TLS", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, op)
+}
+
+// DisableTLS turns TLS off again
+// @Summary Disable TLS
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 202 {object} dto.ClusterOperationInfo
+// @Router /api/v1/postgres/cluster/{id}/tls/disable [post]
+func (h *PostgreSQLClusterHandler) DisableTLS(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	op, err := h.clusterService.DisableTLS(c.Request.Context(), clusterID)
+	if err != nil {
+		h.logger.Error("failed to disable TLS", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, op)
+}
+
+// RotateCertificates replaces node certificates with a rolling reload
+// @Summary Rotate node certificates
+// @Description Issues new certificates and reloads one node at a time; a node failing verification keeps its old certificate
+// @Tags PostgreSQL Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 202 {object} dto.ClusterOperationInfo
+// @Router /api/v1/postgres/cluster/{id}/tls/rotate [post]
+func (h *PostgreSQLClusterHandler) RotateCertificates(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	op, err := h.clusterService.RotateCertificates(c.Request.Context(), clusterID)
+	if err != nil {
+		h.logger.Error("failed to rotate certificates", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, op)
+}
@@ -1,11 +1,16 @@
 # PowerShell script to build custom Docker images for PostgreSQL HA Cluster
+param([string[]]$PgMajors = @("17"))
+
 Write-Host "=== Building Custom Docker Images for PostgreSQL HA Cluster ===" -ForegroundColor Green
 
-# Build Patroni PostgreSQL image
-Write-Host "`nBuilding iaas-patroni-postgres:17..." -ForegroundColor Cyan
-Set-Location docker\patroni
-docker build -t iaas-patroni-postgres:17 .
-Set-Location ..\..
+# Build Patroni PostgreSQL images, one per major version
+# (e.g. -PgMajors 17,18 to provide the target of a major upgrade)
+foreach ($PgMajor in $PgMajors) {
+    Write-Host "`nBuilding iaas-patroni-postgres:$PgMajor..." -ForegroundColor Cyan
+    Set-Location docker\patroni
+    docker build --build-arg PG_MAJOR=$PgMajor -t iaas-patroni-postgres:$PgMajor .
+    Set-Location ..\..
+}
 
 # Build HAProxy image
 Write-Host "`nBuilding iaas-haproxy:latest..." -ForegroundColor Cyan
@@ -19,5 +24,11 @@ Set-Location docker\etcd
 docker build -t iaas-etcd:v3.5.11 .
 Set-Location ..\..
 
+# Build nginx + keepalived image
+Write-Host "`nBuilding iaas-nginx-keepalived:latest..." -ForegroundColor Cyan
+Set-Location docker\nginx-keepalived
+docker build -t iaas-nginx-keepalived:latest .
+Set-Location ..\..
+
 Write-Host "`n=== All images built successfully! ===" -ForegroundColor Green
 docker images | Select-String iaas
@@ -3,11 +3,14 @@ set -e
 
 echo "=== Building Custom Docker Images for PostgreSQL HA Cluster ==="
 
-# Build Patroni PostgreSQL image
-echo "Building iaas-patroni-postgres:17..."
-cd docker/patroni
-docker build -t iaas-patroni-postgres:17 .
-cd ../..
+# Build Patroni PostgreSQL images, one per major version
+# (e.g. PG_MAJORS="17 18" to provide the target of a major upgrade)
+for PG_MAJOR in ${PG_MAJORS:-17}; do
+  echo "Building iaas-patroni-postgres:${PG_MAJOR}..."
+  cd docker/patroni
+  docker build --build-arg PG_MAJOR=${PG_MAJOR} -t iaas-patroni-postgres:${PG_MAJOR} .
+  cd ../..
+done
 
 # Build HAProxy image
 echo "Building iaas-haproxy:latest..."
@@ -21,5 +24,11 @@ cd docker/etcd
 docker build -t iaas-etcd:v3.5.11 .
 cd ../..
 
+# Build nginx + keepalived image
+echo "Building iaas-nginx-keepalived:latest..."
+cd docker/nginx-keepalived
+docker build -t iaas-nginx-keepalived:latest .
+cd ../..
+
 echo "=== All images built successfully! ==="
 docker images | grep iaas
@@ -17,6 +17,7 @@ import (
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/env"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/middlewares"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/pki"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/services"
 	"github.com/gin-contrib/cors"
@@ -47,6 +48,10 @@ func main() {
 		&entities.ClusterNode{},
 		&entities.EtcdNode{},
 		&entities.FailoverEvent{},
+		&entities.ClusterOperation{},
+		&entities.QuerySnapshot{},
+		&entities.CertificateAuthority{},
+		&entities.NodeCertificate{},
 		&entities.Stack{},
 		&entities.StackResource{},
 		&entities.StackTemplate{},
@@ -59,15 +64,34 @@ func main() {
 		&entities.NginxServerBlock{},
 		&entities.NginxLocation{},
 		&entities.NginxFailoverEvent{},
+		&entities.NginxClusterOperation{},
+		&entities.NginxConfigRevision{},
+		&entities.NginxCertificate{},
+		&entities.NginxUpstreamHealthEvent{},
+		&entities.NginxMetricSample{},
+		&entities.NginxTrafficPolicyRevision{},
+		&entities.NginxStreamProxy{},
+		&entities.NginxStreamServer{},
+		&entities.NginxStreamPort{},
+		&entities.NginxAccessPolicy{},
+		&entities.NginxBasicAuthUser{},
 		// DinD (Docker-in-Docker) entities
 		&entities.DinDEnvironment{},
 		&entities.DinDCommandHistory{},
+		&entities.DinDTerminalSession{},
+		&entities.DinDJob{},
+		&entities.DinDSnapshot{},
 		// ClickHouse entities
 		&entities.ClickHouseCluster{},
 		&entities.ClickHouseNode{},
+		// Chaos drills
+		&entities.ChaosDrill{},
 	); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
+	if err := repositories.MigrateDinDIndexes(postgresDb); err != nil {
+		log.Fatalf("Failed to create DinD indexes: %v", err)
+	}
 
 	dockerService, err := docker.NewDockerService(logger)
 	if err != nil {
@@ -86,11 +110,17 @@ func main() {
 	stackRepo := repositories.NewStackRepository(postgresDb)
 	dinDRepo := repositories.NewDinDRepository(postgresDb)
 	clickhouseRepo := repositories.NewClickHouseRepository(postgresDb)
+	chaosDrillRepo := repositories.NewChaosDrillRepository(postgresDb)
+
+	keyCipher, err := pki.NewKeyCipher(envConfig.PKIEnv.KeyEncryptionSecret)
+	if err != nil {
+		log.Fatalf("Failed to init key encryption (set PKI_KEY_ENCRYPTION_SECRET): %v", err)
+	}
 
 	cacheService := services.NewCacheService(redisClient)
-	clusterService := services.NewPostgreSQLClusterService(infraRepo, clusterRepo, dockerService, kafkaProducer, cacheService, logger)
-	nginxClusterService := services.NewNginxClusterService(infraRepo, nginxClusterRepo, dockerService, kafkaProducer, logger)
-	dinDService := services.NewDinDService(dinDRepo, infraRepo, dockerService, kafkaProducer, logger)
+	clusterService := services.NewPostgreSQLClusterService(infraRepo, clusterRepo, dockerService, kafkaProducer, cacheService, keyCipher, logger)
+	nginxClusterService := services.NewNginxClusterService(infraRepo, nginxClusterRepo, dockerService, kafkaProducer, keyCipher, logger, envConfig.ACMEEnv)
+	dinDService := services.NewDinDService(dinDRepo, infraRepo, dockerService, kafkaProducer, logger, envConfig.DinDEnv)
 	clickhouseService := services.NewClickHouseService(infraRepo, clickhouseRepo, dockerService, logger)
 	autoDeployService := services.NewAutoDeployService(clickhouseService, clusterService, dockerService, logger)
 	stackService := services.NewStackService(
@@ -102,6 +132,7 @@ func main() {
 		nginxClusterRepo,
 		dinDService,
 	)
+	chaosDrillService := services.NewChaosDrillService(chaosDrillRepo, clusterRepo, nginxClusterRepo, stackRepo, dockerService, logger)
 
 	kafkaConsumer := kafka.NewEventConsumer(envConfig.KafkaEnv, cacheService, logger)
 	defer kafkaConsumer.Close()
@@ -126,18 +157,38 @@ func main() {
 	}
 	defer eventListenerService.Stop()
 
+	clusterService.StartQuerySnapshots(ctx)
+	clusterService.StartCertificateRotation(ctx)
+	clusterService.RecoverOperations(ctx)
+	nginxClusterService.RecoverOperations(ctx)
+	nginxClusterService.StartVRRPMonitor(ctx)
+	nginxClusterService.StartCertificateRenewal(ctx)
+	nginxClusterService.StartUpstreamHealthChecker(ctx)
+	nginxClusterService.StartMetricsCollector(ctx)
+	dinDService.StartTTLReaper(ctx)
+	dinDService.StartHistoryRetention(ctx)
+	dinDService.RecoverSnapshots(ctx)
+	dinDService.StartRegistry(ctx)
+	chaosDrillService.RecoverDrills(ctx)
+
 	jwtMiddleware := middlewares.NewJWTMiddleware(envConfig.AuthEnv.JWTSecret)
 
+	// Browser origins of the frontend, for CORS and the WebSocket origin check of DinD terminals
+	allowedOrigins := []string{"http://localhost:3000", "http://localhost:3001", "http://frontend.localhost"}
+
 	clusterHandler := httpHandler.NewPostgreSQLClusterHandler(clusterService, logger)
 	nginxClusterHandler := httpHandler.NewNginxClusterHandler(nginxClusterService, logger)
 	stackHandler := httpHandler.NewStackHandler(stackService)
-	dinDHandler := httpHandler.NewDinDHandler(dinDService, logger)
+	dinDHandler := httpHandler.NewDinDHandler(dinDService, logger, allowedOrigins)
 	clickhouseHandler := httpHandler.NewClickHouseHandler(clickhouseService)
 	autoDeployHandler := httpHandler.NewAutoDeployHandler(autoDeployService, logger)
+	chaosDrillHandler := httpHandler.NewChaosDrillHandler(chaosDrillService, logger)
 
-	r := gin.Default()
+	// gin.Default() would log the ?token= JWT of WebSocket requests
+	r := gin.New()
+	r.Use(middlewares.AccessLogger(), gin.Recovery())
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:3001", "http://frontend.localhost"},
+		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
@@ -157,6 +208,7 @@ func main() {
 	dinDHandler.RegisterRoutes(apiV1)
 	clickhouseHandler.RegisterRoutes(apiV1)
 	autoDeployHandler.RegisterRoutes(apiV1)
+	chaosDrillHandler.RegisterRoutes(apiV1)
 
 	// PostgreSQL Cluster routes
 	clusterGroup := apiV1.Group("/postgres/cluster")
@@ -204,6 +256,40 @@ func main() {
 		clusterGroup.GET("/:id/databases/:database/tables", clusterHandler.GetTables)
 		clusterGroup.GET("/:id/databases/:database/tables/:table/schema", clusterHandler.GetTableSchema)
 		clusterGroup.GET("/:id/databases/:database/tables/:table/data", clusterHandler.GetTableData)
+
+		// Version upgrades & operations
+		clusterGroup.POST("/:id/upgrade", clusterHandler.UpgradeCluster)
+		clusterGroup.POST("/:id/resize", clusterHandler.ResizeCluster)
+		clusterGroup.GET("/:id/operations", clusterHandler.ListOperations)
+		clusterGroup.GET("/:id/operations/:operationId", clusterHandler.GetOperation)
+
+		// Standby (DR) clusters
+		clusterGroup.POST("/:id/standbys", clusterHandler.CreateStandbyCluster)
+		clusterGroup.GET("/:id/standby/status", clusterHandler.GetStandbyStatus)
+		clusterGroup.POST("/:id/standby/promote", clusterHandler.PromoteStandbyCluster)
+
+		// Extensions
+		clusterGroup.GET("/:id/databases/:database/extensions", clusterHandler.ListExtensions)
+		clusterGroup.POST("/:id/databases/:database/extensions", clusterHandler.CreateExtension)
+		clusterGroup.DELETE("/:id/databases/:database/extensions/:name", clusterHandler.DropExtension)
+
+		// Query insights
+		clusterGroup.GET("/:id/insights", clusterHandler.GetQueryInsights)
+		clusterGroup.POST("/:id/insights/cancel", clusterHandler.CancelQuery)
+		clusterGroup.POST("/:id/insights/snapshots", clusterHandler.CreateQuerySnapshot)
+		clusterGroup.GET("/:id/insights/snapshots", clusterHandler.ListQuerySnapshots)
+		clusterGroup.GET("/:id/insights/snapshots/compare", clusterHandler.CompareQuerySnapshots)
+
+		// Logical dump/restore
+		clusterGroup.GET("/:id/databases/:database/export", clusterHandler.ExportDatabase)
+		clusterGroup.POST("/:id/databases/:database/import", clusterHandler.ImportDatabase)
+		clusterGroup.POST("/:id/databases/:database/copy", clusterHandler.CopyDatabase)
+
+		// TLS
+		clusterGroup.GET("/:id/tls", clusterHandler.GetTLSStatus)
+		clusterGroup.POST("/:id/tls/enable", clusterHandler.EnableTLS)
+		clusterGroup.POST("/:id/tls/disable", clusterHandler.DisableTLS)
+		clusterGroup.POST("/:id/tls/rotate", clusterHandler.RotateCertificates)
 	}
 
 	quit := make(chan os.Signal, 1)
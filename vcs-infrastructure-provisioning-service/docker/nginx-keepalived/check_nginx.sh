@@ -0,0 +1,3 @@
+#!/bin/sh
+# Keepalived health script: the node leaves MASTER when nginx stops answering the health path
+exec wget -q -T 2 -O /dev/null "http://127.0.0.1${1:-/health}"
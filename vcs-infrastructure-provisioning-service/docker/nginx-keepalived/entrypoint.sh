@@ -0,0 +1,15 @@
+#!/bin/sh
+set -e
+
+# The platform renders keepalived.conf and passes it base64 encoded. Later priority
+# changes are pushed into the running container, so an existing file is kept.
+if [ -n "$KEEPALIVED_CONF" ]; then
+  if [ ! -f /etc/keepalived/keepalived.conf ]; then
+    echo "$KEEPALIVED_CONF" | base64 -d > /etc/keepalived/keepalived.conf
+  fi
+  echo "INIT" > /var/run/keepalived/state
+  keepalived --log-console --pid=/var/run/keepalived.pid -f /etc/keepalived/keepalived.conf
+  echo "Keepalived started with /etc/keepalived/keepalived.conf"
+fi
+
+exec /docker-entrypoint.sh "$@"
@@ -0,0 +1,5 @@
+#!/bin/sh
+# Called by keepalived on every VRRP transition: <type> <name> <state> <priority>
+STATE="$3"
+echo "$STATE" > /var/run/keepalived/state
+echo "$(date +%s) $STATE $4" >> /var/run/keepalived/transitions.log
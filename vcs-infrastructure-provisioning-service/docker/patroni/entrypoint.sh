@@ -102,6 +102,36 @@ PGPASS_EOF
 chmod 600 /opt/secretpg/pgpass
 export PGPASSFILE=/opt/secretpg/pgpass
 
+# Standby cluster (DR): bootstrap from and keep following a remote primary
+STANDBY_CLUSTER_CONFIG=""
+if [ -n "${STANDBY_HOST}" ]; then
+  echo "Configuring standby cluster following ${STANDBY_HOST}:${STANDBY_PORT:-5432}"
+  echo "${STANDBY_HOST}:${STANDBY_PORT:-5432}:*:replicator:${REPLICATION_PASSWORD:-replicator_pass}" >> /opt/secretpg/pgpass
+  STANDBY_CLUSTER_CONFIG="standby_cluster:
+      host: ${STANDBY_HOST}
+      port: ${STANDBY_PORT:-5432}
+      create_replica_methods:
+        - basebackup"
+fi
+
+# TLS: the provisioning service copies the node certificate into /etc/patroni/tls before the
+# container starts and removes it when TLS is turned off, so the files decide whether TLS is on.
+# Remote clients then have to use TLS and replicas verify the leader against the platform CA.
+TLS_PARAMETERS=""
+HBA_HOST="host"
+REPLICATION_SSLROOTCERT=""
+if [ -f /etc/patroni/tls/server.crt ] && [ -f /etc/patroni/tls/server.key ]; then
+  echo "TLS certificate found, enabling TLS..."
+  chmod 600 /etc/patroni/tls/server.key
+  TLS_PARAMETERS="ssl: 'on'
+        ssl_cert_file: /etc/patroni/tls/server.crt
+        ssl_key_file: /etc/patroni/tls/server.key
+        ssl_ca_file: /etc/patroni/tls/ca.crt"
+  HBA_HOST="hostssl"
+  REPLICATION_SSLMODE="verify-ca"
+  REPLICATION_SSLROOTCERT="sslrootcert: /etc/patroni/tls/ca.crt"
+fi
+
 # Wait for etcd before proceeding
 wait_for_etcd
 
@@ -142,6 +172,7 @@ bootstrap:
     loop_wait: 10
     retry_timeout: 10
     maximum_lag_on_failover: 1048576
+    ${STANDBY_CLUSTER_CONFIG}
     postgresql:
       use_pg_rewind: true
       use_slots: true
@@ -163,11 +194,12 @@ bootstrap:
         work_mem: 4MB
         synchronous_commit: ${SYNCHRONOUS_COMMIT:-local}
         synchronous_standby_names: '${SYNCHRONOUS_STANDBY_NAMES:-}'
+        ${TLS_PARAMETERS}
       pg_hba:
         - local   all             all                                 peer
         - host    replication     replicator   127.0.0.1/32           trust
-        - host    replication     replicator   0.0.0.0/0              scram-sha-256
-        - host    all             all          0.0.0.0/0              scram-sha-256
+        - ${HBA_HOST}    replication     replicator   0.0.0.0/0              scram-sha-256
+        - ${HBA_HOST}    all             all          0.0.0.0/0              scram-sha-256
       recovery_conf:
         restore_command: '${RESTORE_COMMAND:-pgbackrest --stanza=${SCOPE} archive-get %f "%p"}'
 
@@ -191,12 +223,14 @@ postgresql:
   listen: 0.0.0.0:5432
   connect_address: ${PATRONI_NAME}:5432
   data_dir: ${PGDATA}
-  bin_dir: /usr/lib/postgresql/17/bin
+  bin_dir: /usr/lib/postgresql/${PG_VERSION:-17}/bin
   pgpass: /opt/secretpg/pgpass
   authentication:
     replication:
       username: replicator
       password: ${REPLICATION_PASSWORD}
+      sslmode: ${REPLICATION_SSLMODE:-prefer}
+      ${REPLICATION_SSLROOTCERT}
     superuser:
       username: postgres
       password: ${POSTGRES_PASSWORD}
@@ -214,8 +248,8 @@ postgresql:
   pg_hba:
     - local   all             all                                 peer
     - host    replication     replicator   127.0.0.1/32           trust
-    - host    replication     replicator   0.0.0.0/0              scram-sha-256
-    - host    all             all          0.0.0.0/0              scram-sha-256
+    - ${HBA_HOST}    replication     replicator   0.0.0.0/0              scram-sha-256
+    - ${HBA_HOST}    all             all          0.0.0.0/0              scram-sha-256
 
 watchdog:
   mode: ${WATCHDOG_MODE:-off}
@@ -262,7 +296,7 @@ if [ -d "\${PGDATA}" ]; then
 fi
 
 # Run pg_basebackup with password from environment
-/usr/lib/postgresql/17/bin/pg_basebackup \\
+/usr/lib/postgresql/${PG_VERSION:-17}/bin/pg_basebackup \\
   -h "\${MASTER_HOST}" \\
   -p "\${MASTER_PORT:-5432}" \\
   -U replicator \\
@@ -0,0 +1,66 @@
+package dto
+
+// RunChaosDrillRequest starts a failure scenario against a Postgres or nginx cluster
+type RunChaosDrillRequest struct {
+	TargetType      string `json:"target_type" binding:"required,oneof=postgres nginx"`
+	TargetID        string `json:"target_id" binding:"required"` // cluster ID
+	Scenario        string `json:"scenario" binding:"required,oneof=kill_leader pause_node disconnect_node fill_disk"`
+	NodeID          string `json:"node_id"`                                            // defaults to the current leader/master
+	DurationSeconds int    `json:"duration_seconds" binding:"omitempty,min=5,max=600"` // how long the fault is held (default: 30)
+	FillMB          int    `json:"fill_mb" binding:"omitempty,min=1,max=10240"`        // fill_disk only (required), refused if less than 64 MB would stay free
+	Force           bool   `json:"force"`                                              // required on stacks tagged prod
+}
+
+// ChaosDrillInfo describes a drill and, once finished, its report
+type ChaosDrillInfo struct {
+	ID              string            `json:"id"`
+	TargetType      string            `json:"target_type"`
+	TargetID        string            `json:"target_id"`
+	Scenario        string            `json:"scenario"`
+	TargetNodeID    string            `json:"target_node_id"`
+	Status          string            `json:"status"` // running, completed, failed
+	DurationSeconds int               `json:"duration_seconds"`
+	Forced          bool              `json:"forced"`
+	Report          *ChaosDrillReport `json:"report,omitempty"`
+	ErrorMessage    string            `json:"error_message,omitempty"`
+	StartedAt       string            `json:"started_at"`
+	CompletedAt     string            `json:"completed_at,omitempty"`
+}
+
+// ChaosDrillReport holds what was measured during a drill
+type ChaosDrillReport struct {
+	OldLeader              string               `json:"old_leader"`
+	NewLeader              string               `json:"new_leader,omitempty"`
+	LeaderChanged          bool                 `json:"leader_changed"`
+	TimeToNewLeaderSeconds *float64             `json:"time_to_new_leader_seconds,omitempty"`
+	ClusterRecoverySeconds *float64             `json:"cluster_recovery_seconds,omitempty"` // after the fault was reverted
+	Availability           ProbeAvailability    `json:"availability"`                       // writes for postgres, HTTP requests for nginx
+	DataLoss               *DrillDataLoss       `json:"data_loss,omitempty"`                // postgres only
+	Timeline               []DrillTimelineEvent `json:"timeline"`
+}
+
+// ProbeAvailability summarises the probes sent once per second during a drill
+type ProbeAvailability struct {
+	Attempts             int      `json:"attempts"`
+	Succeeded            int      `json:"succeeded"`
+	AvailabilityPercent  float64  `json:"availability_percent"`
+	LongestOutageSeconds float64  `json:"longest_outage_seconds"`
+	FirstFailureSeconds  *float64 `json:"first_failure_seconds,omitempty"` // after fault injection
+	RecoveredSeconds     *float64 `json:"recovered_seconds,omitempty"`     // first success after the first failure
+}
+
+// DrillDataLoss compares acknowledged writes with what the new leader has
+type DrillDataLoss struct {
+	LastAckedLSN  string `json:"last_acked_lsn"`
+	PromotionLSN  string `json:"promotion_lsn,omitempty"` // last WAL replayed by the new leader before promotion
+	LSNLossBytes  int64  `json:"lsn_loss_bytes"`
+	AckedWrites   int    `json:"acked_writes"`
+	LostWrites    int    `json:"lost_writes"`
+	LostWriteSeqs []int  `json:"lost_write_seqs,omitempty"`
+}
+
+// DrillTimelineEvent is one step of a drill, relative to fault injection
+type DrillTimelineEvent struct {
+	OffsetSeconds float64 `json:"offset_seconds"`
+	Event         string  `json:"event"`
+}
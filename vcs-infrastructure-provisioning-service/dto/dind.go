@@ -1,5 +1,10 @@
 package dto
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // CreateDinDEnvironmentRequest - Tạo môi trường Docker-in-Docker mới
 type CreateDinDEnvironmentRequest struct {
 	Name         string `json:"name" binding:"required"`         // Tên environment
@@ -7,6 +12,47 @@ type CreateDinDEnvironmentRequest struct {
 	Description  string `json:"description"`                     // Mô tả
 	AutoCleanup  bool   `json:"auto_cleanup"`                    // Tự động xóa sau TTL
 	TTLHours     int    `json:"ttl_hours"`                       // Thời gian sống (giờ)
+	FromSnapshot string `json:"from_snapshot"`                   // Tạo từ snapshot (ID), copy images, containers và volumes
+}
+
+// ResizeDinDEnvironmentRequest - Đổi gói tài nguyên của môi trường DinD
+type ResizeDinDEnvironmentRequest struct {
+	ResourcePlan  string `json:"resource_plan" binding:"required,oneof=small medium large"`
+	ForceRecreate bool   `json:"force_recreate"` // Tạo lại container thay vì cập nhật trực tiếp
+}
+
+// ExtendDinDEnvironmentRequest - Gia hạn TTL của môi trường DinD, kể cả khi đang trong grace period
+type ExtendDinDEnvironmentRequest struct {
+	Hours int `json:"hours" binding:"required,min=1,max=720"`
+}
+
+// CreateDinDSnapshotRequest - Tạo snapshot từ môi trường DinD
+type CreateDinDSnapshotRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// DinDSnapshotInfo - Thông tin snapshot
+type DinDSnapshotInfo struct {
+	ID                string   `json:"id"`
+	EnvironmentID     string   `json:"environment_id"`
+	Name              string   `json:"name"`
+	Description       string   `json:"description"`
+	Status            string   `json:"status"` // creating, ready, failed
+	Error             string   `json:"error,omitempty"`
+	ResourcePlan      string   `json:"resource_plan"`
+	RunningContainers []string `json:"running_containers"`
+	ImageSize         int64    `json:"image_size_bytes"`
+	DataSize          int64    `json:"data_size_bytes"`
+	TotalSize         int64    `json:"total_size_bytes"`
+	CreatedAt         string   `json:"created_at"`
+}
+
+// DinDSnapshotListResponse - Danh sách snapshot kèm tổng dung lượng
+type DinDSnapshotListResponse struct {
+	Snapshots  []DinDSnapshotInfo `json:"snapshots"`
+	TotalCount int                `json:"total_count"`
+	TotalSize  int64              `json:"total_size_bytes"`
 }
 
 // DinDEnvironmentInfo - Thông tin môi trường DinD
@@ -27,6 +73,9 @@ type DinDEnvironmentInfo struct {
 	CreatedAt        string `json:"created_at"`
 	UpdatedAt        string `json:"updated_at"`
 	ExpiresAt        string `json:"expires_at,omitempty"`
+	ExpiredAt        string `json:"expired_at,omitempty"`  // Bị dừng do hết hạn
+	DeletesAt        string `json:"deletes_at,omitempty"`  // Bị xóa nếu không gia hạn trước thời điểm này
+	SnapshotID       string `json:"snapshot_id,omitempty"` // Snapshot được restore
 }
 
 // ExecCommandRequest - Chạy docker command trong DinD environment
@@ -44,6 +93,37 @@ type ExecCommandResponse struct {
 	ExecutedAt string `json:"executed_at"`
 }
 
+// DinDHistoryQuery - Tìm kiếm lịch sử command (phân trang, lọc, full-text search)
+type DinDHistoryQuery struct {
+	Page     int       `form:"page"`                                          // Trang (default: 1)
+	PageSize int       `form:"page_size" binding:"omitempty,max=500"`         // Số bản ghi mỗi trang (default: 50)
+	ExitCode *int      `form:"exit_code"`                                     // Lọc theo exit code
+	Since    time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"` // Từ thời điểm (RFC3339)
+	Until    time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"` // Đến thời điểm (RFC3339)
+	Search   string    `form:"q"`                                             // Full-text search trên command và output
+	Export   string    `form:"export" binding:"omitempty,oneof=csv json"`     // Xuất toàn bộ kết quả: csv, json
+}
+
+// DinDCommandHistoryInfo - Một command trong lịch sử
+type DinDCommandHistoryInfo struct {
+	ID            string `json:"id"`
+	EnvironmentID string `json:"environment_id"`
+	UserID        string `json:"user_id,omitempty"`
+	Command       string `json:"command"`
+	Output        string `json:"output"`
+	ExitCode      int    `json:"exit_code"`
+	DurationMs    int    `json:"duration_ms"`
+	ExecutedAt    string `json:"executed_at"`
+}
+
+// DinDCommandHistoryResponse - Một trang lịch sử command
+type DinDCommandHistoryResponse struct {
+	Entries    []DinDCommandHistoryInfo `json:"entries"`
+	TotalCount int64                    `json:"total_count"`
+	Page       int                      `json:"page"`
+	PageSize   int                      `json:"page_size"`
+}
+
 // BuildImageRequest - Build Docker image trong DinD environment
 type BuildImageRequest struct {
 	Dockerfile string            `json:"dockerfile" binding:"required"` // Nội dung Dockerfile
@@ -66,10 +146,12 @@ type BuildImageResponse struct {
 
 // ComposeRequest - Chạy docker-compose trong DinD environment
 type ComposeRequest struct {
-	ComposeContent string `json:"compose_content" binding:"required"` // Nội dung docker-compose.yml
-	Action         string `json:"action" binding:"required"`          // up, down, restart, logs, ps
-	ServiceName    string `json:"service_name"`                       // Tên service cụ thể (optional)
-	Detach         bool   `json:"detach"`                             // Run in background
+	ComposeContent string `json:"compose_content" binding:"required_without=ProjectDir"` // Nội dung docker-compose.yml
+	Action         string `json:"action" binding:"required"`                             // up, down, restart, logs, ps
+	ServiceName    string `json:"service_name"`                                          // Tên service cụ thể (optional)
+	Detach         bool   `json:"detach"`                                                // Run in background
+	ProjectDir     string `json:"project_dir"`                                           // Thư mục project đã upload trong environment
+	ComposeFile    string `json:"compose_file"`                                          // File compose trong project_dir (default: docker-compose.yml)
 }
 
 // ComposeResponse - Kết quả docker-compose
@@ -151,3 +233,111 @@ type PullImageResponse struct {
 	Success bool   `json:"success"`
 }
 
+// DinDTerminalRequest - Tham số mở terminal, truyền qua query string của WebSocket
+type DinDTerminalRequest struct {
+	Command string `form:"cmd"`  // Chạy qua sh -c, mặc định /bin/sh
+	Rows    uint   `form:"rows"` // Kích thước terminal ban đầu
+	Cols    uint   `form:"cols"`
+}
+
+// DinDTerminalMessage - Message điều khiển của WebSocket terminal.
+// Client gửi input/resize (binary frame được coi là input thô), server gửi output dạng binary và exit khi kết thúc.
+type DinDTerminalMessage struct {
+	Type     string `json:"type"` // input, resize, exit
+	Data     string `json:"data,omitempty"`
+	Rows     uint   `json:"rows,omitempty"`
+	Cols     uint   `json:"cols,omitempty"`
+	ExitCode int    `json:"exit_code"`
+	Reason   string `json:"reason,omitempty"` // exited, client_closed, idle_timeout
+}
+
+// DinDTerminalSessionInfo - Thông tin phiên terminal đã ghi lại
+type DinDTerminalSessionInfo struct {
+	ID            string `json:"id"`
+	EnvironmentID string `json:"environment_id"`
+	UserID        string `json:"user_id"`
+	Command       string `json:"command"`
+	Transcript    string `json:"transcript,omitempty"` // Chỉ có khi lấy chi tiết một phiên
+	Truncated     bool   `json:"truncated"`
+	BytesIn       int64  `json:"bytes_in"`
+	BytesOut      int64  `json:"bytes_out"`
+	ExitCode      int    `json:"exit_code"`
+	CloseReason   string `json:"close_reason"`
+	StartedAt     string `json:"started_at"`
+	EndedAt       string `json:"ended_at,omitempty"`
+}
+
+// BuildContextRequest - Build image từ build context dạng tarball (multipart form, file ở field "context")
+type BuildContextRequest struct {
+	ImageName   string   `form:"image_name" json:"image_name" binding:"required"`
+	Tag         string   `form:"tag" json:"tag"`
+	Dockerfile  string   `form:"dockerfile" json:"dockerfile"` // Đường dẫn trong context, mặc định Dockerfile
+	BuildArgs   []string `form:"build_arg" json:"build_args"`  // KEY=VALUE, có thể lặp lại
+	NoCache     bool     `form:"no_cache" json:"no_cache"`
+	ContextPath string   `form:"context_path" json:"context_path"` // Thư mục đã upload trong environment, thay cho file context
+}
+
+// DinDUploadRequest - Upload file hoặc tarball vào environment
+type DinDUploadRequest struct {
+	Path    string `form:"path" binding:"required"` // Thư mục đích, tạo nếu chưa có
+	Extract bool   `form:"extract"`                 // Giải nén tar/tar.gz vào thư mục thay vì lưu nguyên file
+}
+
+// DinDUploadResponse - Kết quả upload
+type DinDUploadResponse struct {
+	Path      string `json:"path"` // File đã ghi, hoặc thư mục đã giải nén vào
+	Size      int64  `json:"size"`
+	Extracted bool   `json:"extracted"`
+}
+
+// DinDDownloadRequest - Download file hoặc thư mục từ environment
+type DinDDownloadRequest struct {
+	Path   string `form:"path" binding:"required"`
+	Format string `form:"format" binding:"omitempty,oneof=raw tar tar.gz"` // Mặc định: raw cho file, tar cho thư mục
+}
+
+// DinDJobInfo - Thông tin job chạy nền (build, pull, compose, push)
+type DinDJobInfo struct {
+	ID            string                 `json:"id"`
+	EnvironmentID string                 `json:"environment_id"`
+	UserID        string                 `json:"user_id"`
+	Type          string                 `json:"type"`   // build, pull, compose, push
+	Status        string                 `json:"status"` // running, succeeded, failed, cancelled
+	Request       json.RawMessage        `json:"request,omitempty"`
+	Output        string                 `json:"output,omitempty"` // Chỉ có khi lấy chi tiết một job
+	Truncated     bool                   `json:"truncated"`
+	Result        map[string]interface{} `json:"result,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+	CreatedAt     string                 `json:"created_at"`
+	FinishedAt    string                 `json:"finished_at,omitempty"`
+	Duration      string                 `json:"duration,omitempty"`
+}
+
+// DinDRegistryPushRequest - Push image từ environment lên namespace của user trong registry dùng chung
+type DinDRegistryPushRequest struct {
+	Image string `json:"image" binding:"required"` // Image trong environment (e.g., myapp:1.0)
+	Name  string `json:"name"`                     // Tên trong namespace (mặc định: tên image)
+	Tag   string `json:"tag"`                      // Mặc định: tag của image
+}
+
+// DinDRegistryPullRequest - Pull image từ namespace của user vào environment
+type DinDRegistryPullRequest struct {
+	Image     string `json:"image" binding:"required"` // Tên trong namespace kèm tag (e.g., myapp:1.0)
+	LocalName string `json:"local_name"`               // Tag lại trong environment (mặc định: image)
+}
+
+// DinDRegistryInfo - Registry dùng chung và các image trong namespace của user
+type DinDRegistryInfo struct {
+	Enabled   bool                `json:"enabled"`
+	Mirror    string              `json:"mirror,omitempty"`   // Registry mirror của các DinD daemon
+	Registry  string              `json:"registry,omitempty"` // Registry dùng chung, dùng để push/pull giữa các environment
+	Namespace string              `json:"namespace,omitempty"` // Environment của user đăng nhập registry bằng tên này và chỉ push/pull được trong namespace này
+	Images    []DinDRegistryImage `json:"images"`
+}
+
+// DinDRegistryImage - Image trong namespace của user
+type DinDRegistryImage struct {
+	Name      string   `json:"name"`
+	Reference string   `json:"reference"` // Dùng với docker pull trong environment
+	Tags      []string `json:"tags"`
+}
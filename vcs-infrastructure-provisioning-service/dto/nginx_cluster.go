@@ -69,6 +69,7 @@ type CreateUpstreamRequest struct {
 	Servers     []CreateUpstreamServerRequest `json:"servers" binding:"required"`
 	HealthCheck bool                          `json:"health_check"`
 	HealthPath  string                        `json:"health_path"`
+	Version     string                        `json:"version"` // Release deployed behind the upstream
 }
 
 // CreateUpstreamServerRequest defines a backend server
@@ -85,12 +86,14 @@ type CreateServerBlockRequest struct {
 	ServerName string                  `json:"server_name" binding:"required"`
 	ListenPort int                     `json:"listen_port"`
 	SSLEnabled bool                    `json:"ssl_enabled"`
+	SSLCertID  string                  `json:"ssl_cert_id"` // Certificate from the cluster store, default certificate when empty
 	RootPath   string                  `json:"root_path"`
 	Locations  []CreateLocationRequest `json:"locations"`
 }
 
 // CreateLocationRequest defines a location block
 type CreateLocationRequest struct {
+	Modifier     string            `json:"modifier"` // "", =, ~, ~*, ^~
 	Path         string            `json:"path" binding:"required"`
 	ProxyPass    string            `json:"proxy_pass"`
 	ProxyHeaders map[string]string `json:"proxy_headers"`
@@ -155,30 +158,48 @@ type ServerBlockInfo struct {
 
 // LocationInfo location block information
 type LocationInfo struct {
-	ID           string            `json:"id"`
-	Path         string            `json:"path"`
-	ProxyPass    string            `json:"proxy_pass,omitempty"`
-	ProxyHeaders map[string]string `json:"proxy_headers,omitempty"`
-	CacheEnabled bool              `json:"cache_enabled"`
-	RateLimit    int               `json:"rate_limit"`
+	ID           string              `json:"id"`
+	Modifier     string              `json:"modifier,omitempty"`
+	Path         string              `json:"path"`
+	ProxyPass    string              `json:"proxy_pass,omitempty"`
+	ProxyHeaders map[string]string   `json:"proxy_headers,omitempty"`
+	CacheEnabled bool                `json:"cache_enabled"`
+	RateLimit    int                 `json:"rate_limit"`
+	Traffic      *NginxTrafficPolicy `json:"traffic,omitempty"`
 }
 
 // UpstreamInfo represents upstream backend information
 type UpstreamInfo struct {
-	ID       string          `json:"id"`
-	Name     string          `json:"name"`
-	Policy   string          `json:"policy"` // round_robin, least_conn, ip_hash
-	Backends []BackendServer `json:"backends"`
+	ID            string                    `json:"id"`
+	Name          string                    `json:"name"`
+	Policy        string                    `json:"policy"` // round_robin, least_conn, ip_hash
+	HealthCheck   bool                      `json:"health_check"`
+	HealthPath    string                    `json:"health_path,omitempty"`
+	Version       string                    `json:"version,omitempty"`
+	Backends      []BackendServer           `json:"backends"`
+	HealthHistory []UpstreamHealthEventInfo `json:"health_history,omitempty"` // Latest first
 }
 
 // BackendServer represents a backend server in upstream
 type BackendServer struct {
-	Address     string `json:"address"`
-	Port        int    `json:"port,omitempty"`
-	Weight      int    `json:"weight,omitempty"`
-	MaxFails    int    `json:"max_fails,omitempty"`
-	FailTimeout string `json:"fail_timeout,omitempty"`
-	IsBackup    bool   `json:"is_backup,omitempty"`
+	Address       string `json:"address"`
+	Port          int    `json:"port,omitempty"`
+	Weight        int    `json:"weight,omitempty"`
+	MaxFails      int    `json:"max_fails,omitempty"`
+	FailTimeout   string `json:"fail_timeout,omitempty"`
+	IsBackup      bool   `json:"is_backup,omitempty"`
+	IsDown        bool   `json:"is_down"`
+	HealthStatus  string `json:"health_status,omitempty"` // unknown, healthy, unhealthy
+	LastCheckedAt string `json:"last_checked_at,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+}
+
+// UpstreamHealthEventInfo a backend marked down or up by the health checker
+type UpstreamHealthEventInfo struct {
+	Address    string `json:"address"`
+	Status     string `json:"status"` // down, up
+	Reason     string `json:"reason"`
+	OccurredAt string `json:"occurred_at"`
 }
 
 // ================== Cluster Operations ==================
@@ -194,6 +215,115 @@ type UpdateNginxClusterConfigRequest struct {
 	ReloadAll   bool   `json:"reload_all"` // Reload all nodes
 }
 
+// ================== Certificates ==================
+
+// NginxCertificateInfo certificate stored for a cluster, without its private key
+type NginxCertificateInfo struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Source        string   `json:"source"` // uploaded, csr, self_signed, acme
+	Status        string   `json:"status"` // pending, active, expired, failed
+	CommonName    string   `json:"common_name"`
+	DNSNames      []string `json:"dns_names"`
+	Issuer        string   `json:"issuer,omitempty"`
+	SerialNumber  string   `json:"serial_number,omitempty"`
+	Fingerprint   string   `json:"fingerprint,omitempty"`
+	NotBefore     string   `json:"not_before,omitempty"`
+	NotAfter      string   `json:"not_after,omitempty"`
+	DaysRemaining int      `json:"days_remaining"`
+	AutoRenew     bool     `json:"auto_renew"`
+	IsDefault     bool     `json:"is_default"`
+	UsedBy        []string `json:"used_by,omitempty"` // server names of blocks using the certificate
+	CSRPEM        string   `json:"csr_pem,omitempty"`
+	LastError     string   `json:"last_error,omitempty"`
+	RenewedAt     string   `json:"renewed_at,omitempty"`
+	CreatedAt     string   `json:"created_at"`
+}
+
+// UploadNginxCertificateRequest import an existing certificate chain and key
+type UploadNginxCertificateRequest struct {
+	Name           string `json:"name" binding:"required"`
+	CertificatePEM string `json:"certificate_pem" binding:"required"` // Leaf first, then intermediates
+	PrivateKeyPEM  string `json:"private_key_pem" binding:"required"`
+}
+
+// CreateNginxCSRRequest generate a key and CSR to be signed by an external CA
+type CreateNginxCSRRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	CommonName   string   `json:"common_name" binding:"required"`
+	DNSNames     []string `json:"dns_names"`
+	Organization string   `json:"organization"`
+}
+
+// CompleteNginxCSRRequest attach the certificate signed for a CSR
+type CompleteNginxCSRRequest struct {
+	CertificatePEM string `json:"certificate_pem" binding:"required"`
+}
+
+// IssueSelfSignedCertificateRequest issue a self-signed certificate
+type IssueSelfSignedCertificateRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	CommonName string   `json:"common_name" binding:"required"`
+	DNSNames   []string `json:"dns_names"`
+	ValidDays  int      `json:"valid_days"` // default: 365
+	AutoRenew  bool     `json:"auto_renew"`
+}
+
+// RequestACMECertificateRequest issue a certificate over ACME HTTP-01, answered by the cluster itself
+type RequestACMECertificateRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	Domains      []string `json:"domains" binding:"required,min=1"`
+	Email        string   `json:"email"`
+	DirectoryURL string   `json:"directory_url"` // default: ACME_DIRECTORY_URL or Let's Encrypt
+}
+
+// ================== Config Revisions ==================
+
+// NginxConfigRevisionInfo stored nginx.conf revision
+type NginxConfigRevisionInfo struct {
+	Revision     int    `json:"revision"`
+	Checksum     string `json:"checksum"`
+	Author       string `json:"author"`
+	Reason       string `json:"reason"`
+	Status       string `json:"status"` // pending, applied, partial, failed
+	Current      bool   `json:"current"`
+	RollbackOf   int    `json:"rollback_of,omitempty"`
+	CanaryNodeID string `json:"canary_node_id,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+	CreatedAt    string `json:"created_at"`
+	AppliedAt    string `json:"applied_at,omitempty"`
+	Diff         string `json:"diff,omitempty"`
+	Config       string `json:"config,omitempty"`
+}
+
+// NginxConfigRevisionListResponse revision history of a cluster
+type NginxConfigRevisionListResponse struct {
+	ClusterID       string                    `json:"cluster_id"`
+	CurrentRevision int                       `json:"current_revision"`
+	Revisions       []NginxConfigRevisionInfo `json:"revisions"`
+}
+
+// RollbackNginxConfigRequest reapply the config of an earlier revision
+type RollbackNginxConfigRequest struct {
+	Revision int    `json:"revision" binding:"required,min=1"`
+	Reason   string `json:"reason"`
+}
+
+// ResizeNginxClusterRequest change CPU/memory limits of all nodes
+type ResizeNginxClusterRequest struct {
+	CPUPerNode    int64 `json:"cpu_per_node" binding:"required,min=1"`    // CPU limit in nanocores
+	MemoryPerNode int64 `json:"memory_per_node" binding:"required,min=1"` // Memory limit in bytes
+	ForceRecreate bool  `json:"force_recreate"`                           // Recreate containers instead of live update
+}
+
+// NginxNodeResizeInfo how a single node was resized, kept in the "nodes" detail of the resize operation
+type NginxNodeResizeInfo struct {
+	NodeID string `json:"node_id"`
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Method string `json:"method"` // live, recreate
+}
+
 // AddUpstreamRequest add upstream to cluster
 type AddNginxUpstreamRequest struct {
 	Name        string                        `json:"name" binding:"required"`
@@ -201,6 +331,7 @@ type AddNginxUpstreamRequest struct {
 	Servers     []CreateUpstreamServerRequest `json:"servers" binding:"required"`
 	HealthCheck bool                          `json:"health_check"`
 	HealthPath  string                        `json:"health_path"`
+	Version     string                        `json:"version"` // Release deployed behind the upstream
 }
 
 // UpdateUpstreamRequest update upstream configuration
@@ -209,6 +340,7 @@ type UpdateNginxUpstreamRequest struct {
 	Servers     []CreateUpstreamServerRequest `json:"servers"`
 	HealthCheck bool                          `json:"health_check"`
 	HealthPath  string                        `json:"health_path"`
+	Version     string                        `json:"version"` // Release deployed behind the upstream
 }
 
 // AddServerBlockRequest add a server block
@@ -216,12 +348,24 @@ type AddNginxServerBlockRequest struct {
 	ServerName string                  `json:"server_name" binding:"required"`
 	ListenPort int                     `json:"listen_port"`
 	SSLEnabled bool                    `json:"ssl_enabled"`
+	SSLCertID  string                  `json:"ssl_cert_id"` // Certificate from the cluster store, default certificate when empty
 	RootPath   string                  `json:"root_path"`
 	Locations  []CreateLocationRequest `json:"locations"`
 }
 
 // AddLocationRequest add a location to server block
 type AddNginxLocationRequest struct {
+	Modifier     string            `json:"modifier"` // "", =, ~, ~*, ^~
+	Path         string            `json:"path" binding:"required"`
+	ProxyPass    string            `json:"proxy_pass"` // upstream name or http(s) URL
+	ProxyHeaders map[string]string `json:"proxy_headers"`
+	CacheEnabled bool              `json:"cache_enabled"`
+	RateLimit    int               `json:"rate_limit"`
+}
+
+// UpdateNginxLocationRequest replaces a location of a server block
+type UpdateNginxLocationRequest struct {
+	Modifier     string            `json:"modifier"`
 	Path         string            `json:"path" binding:"required"`
 	ProxyPass    string            `json:"proxy_pass"`
 	ProxyHeaders map[string]string `json:"proxy_headers"`
@@ -229,6 +373,169 @@ type AddNginxLocationRequest struct {
 	RateLimit    int               `json:"rate_limit"`
 }
 
+// ================== Access Policies ==================
+
+// NginxAccessRules access rules of a server block or location. A location policy replaces the
+// server block rules of the kinds it sets and inherits the others.
+type NginxAccessRules struct {
+	Allow               []string `json:"allow"`                           // Addresses or CIDRs; everything else is denied when set
+	Deny                []string `json:"deny"`                            // Checked before allow
+	Satisfy             string   `json:"satisfy"`                         // all (default): address and auth checks must pass, any: one is enough
+	BasicAuth           bool     `json:"basic_auth"`                      // Users are managed through the users endpoints
+	BasicAuthRealm      string   `json:"basic_auth_realm"`                // Default "Restricted"
+	AuthRequestURL      string   `json:"auth_request_url"`                // Upstream name or http(s) URL, e.g. the platform's /api/v1/nginx/auth/verify
+	AuthResponseHeaders []string `json:"auth_response_headers,omitempty"` // Copied from the auth response to the backend request, e.g. X-User-ID
+}
+
+// CreateNginxAccessPolicyRequest adds an access policy to a server block or one of its locations
+type CreateNginxAccessPolicyRequest struct {
+	ServerBlockID string `json:"server_block_id" binding:"required"`
+	LocationID    string `json:"location_id"` // Whole server block when empty
+	NginxAccessRules
+}
+
+// UpdateNginxAccessPolicyRequest replaces the rules of an access policy
+type UpdateNginxAccessPolicyRequest struct {
+	NginxAccessRules
+}
+
+// SetNginxBasicAuthUserRequest adds a basic auth user or resets its password
+type SetNginxBasicAuthUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// NginxAccessPolicyInfo access policy with its basic auth users
+type NginxAccessPolicyInfo struct {
+	ID            string `json:"id"`
+	ServerBlockID string `json:"server_block_id"`
+	ServerName    string `json:"server_name,omitempty"`
+	LocationID    string `json:"location_id,omitempty"`
+	LocationPath  string `json:"location_path,omitempty"`
+	NginxAccessRules
+	Users     []string `json:"users"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// ================== Stream Proxies ==================
+
+// NginxStreamServer a backend of a TCP/UDP stream proxy
+type NginxStreamServer struct {
+	Address     string `json:"address" binding:"required"` // host:port
+	Weight      int    `json:"weight"`
+	MaxFails    int    `json:"max_fails"`
+	FailTimeout int    `json:"fail_timeout"` // seconds
+	IsBackup    bool   `json:"is_backup"`
+}
+
+// AddNginxStreamProxyRequest proxies a TCP or UDP port, e.g. Postgres, Redis or syslog
+type AddNginxStreamProxyRequest struct {
+	Name           string              `json:"name" binding:"required"`
+	Protocol       string              `json:"protocol"` // tcp (default), udp
+	ListenPort     int                 `json:"listen_port" binding:"required,min=1,max=65535"`
+	HostPort       int                 `json:"host_port" binding:"omitempty,min=1,max=65535"` // First host port tried when publishing, listen_port when empty
+	Algorithm      string              `json:"algorithm"`                                     // round_robin, least_conn, hash
+	ConnectTimeout int                 `json:"connect_timeout"`                               // seconds, default 10
+	Timeout        int                 `json:"timeout"`                                       // seconds of inactivity, default 600
+	TLSEnabled     bool                `json:"tls_enabled"`                                   // Terminate TLS, tcp only
+	SSLCertID      string              `json:"ssl_cert_id"`                                   // Certificate from the cluster store, default certificate when empty
+	Servers        []NginxStreamServer `json:"servers" binding:"required,min=1,dive"`
+}
+
+// UpdateNginxStreamProxyRequest replaces a stream proxy
+type UpdateNginxStreamProxyRequest struct {
+	Name           string              `json:"name" binding:"required"`
+	Protocol       string              `json:"protocol"`
+	ListenPort     int                 `json:"listen_port" binding:"required,min=1,max=65535"`
+	HostPort       int                 `json:"host_port" binding:"omitempty,min=1,max=65535"`
+	Algorithm      string              `json:"algorithm"`
+	ConnectTimeout int                 `json:"connect_timeout"`
+	Timeout        int                 `json:"timeout"`
+	TLSEnabled     bool                `json:"tls_enabled"`
+	SSLCertID      string              `json:"ssl_cert_id"`
+	Servers        []NginxStreamServer `json:"servers" binding:"required,min=1,dive"`
+}
+
+// NginxStreamProxyInfo stream proxy with the host ports published on each node
+type NginxStreamProxyInfo struct {
+	ID             string                `json:"id"`
+	Name           string                `json:"name"`
+	Protocol       string                `json:"protocol"`
+	ListenPort     int                   `json:"listen_port"`
+	Algorithm      string                `json:"algorithm"`
+	ConnectTimeout int                   `json:"connect_timeout"`
+	Timeout        int                   `json:"timeout"`
+	TLSEnabled     bool                  `json:"tls_enabled"`
+	SSLCertID      string                `json:"ssl_cert_id,omitempty"`
+	Servers        []NginxStreamServer   `json:"servers"`
+	Ports          []NginxStreamPortInfo `json:"ports"`
+	CreatedAt      string                `json:"created_at"`
+}
+
+// NginxStreamPortInfo host port a node publishes for a stream proxy
+type NginxStreamPortInfo struct {
+	NodeID   string `json:"node_id"`
+	NodeName string `json:"node_name"`
+	HostPort int    `json:"host_port"`
+}
+
+// ================== Traffic Policies ==================
+
+// NginxTrafficPolicy splits or switches the traffic of a location between its proxy_pass
+// upstream (stable/blue) and a secondary upstream (canary/green)
+type NginxTrafficPolicy struct {
+	Mode              string `json:"mode"`                         // "" (off), split, blue_green
+	SecondaryUpstream string `json:"secondary_upstream,omitempty"` // Upstream name of the canary or green release
+	SecondaryWeight   int    `json:"secondary_weight"`             // split: percent of requests sent to the secondary upstream
+	ActiveUpstream    string `json:"active_upstream,omitempty"`    // blue_green: upstream receiving the traffic
+	Sticky            bool   `json:"sticky"`                       // split by client address instead of per request
+	RouteHeader       string `json:"route_header,omitempty"`       // Requests with this header go to the other upstream
+	RouteHeaderValue  string `json:"route_header_value,omitempty"` // Any value when empty
+	RouteCookie       string `json:"route_cookie,omitempty"`
+	RouteCookieValue  string `json:"route_cookie_value,omitempty"`
+}
+
+// SetNginxTrafficPolicyRequest replaces the traffic policy of a location
+type SetNginxTrafficPolicyRequest struct {
+	NginxTrafficPolicy
+	Reason string `json:"reason"`
+}
+
+// SwitchNginxTrafficRequest flips a blue/green location to the other upstream
+type SwitchNginxTrafficRequest struct {
+	Reason string `json:"reason"`
+}
+
+// RollbackNginxTrafficPolicyRequest restores an earlier traffic policy version
+type RollbackNginxTrafficPolicyRequest struct {
+	Version int    `json:"version"` // Previous version when 0
+	Reason  string `json:"reason"`
+}
+
+// NginxTrafficPolicyInfo traffic policy of a location with its history
+type NginxTrafficPolicyInfo struct {
+	LocationID       string                           `json:"location_id"`
+	Path             string                           `json:"path"`
+	PrimaryUpstream  string                           `json:"primary_upstream"`
+	PrimaryVersion   string                           `json:"primary_version,omitempty"`
+	SecondaryVersion string                           `json:"secondary_version,omitempty"`
+	Version          int                              `json:"version"`
+	Policy           NginxTrafficPolicy               `json:"policy"`
+	History          []NginxTrafficPolicyRevisionInfo `json:"history,omitempty"` // Latest first
+}
+
+// NginxTrafficPolicyRevisionInfo a stored version of a traffic policy
+type NginxTrafficPolicyRevisionInfo struct {
+	Version         int                `json:"version"`
+	PrimaryUpstream string             `json:"primary_upstream"`
+	Policy          NginxTrafficPolicy `json:"policy"`
+	ConfigRevision  int                `json:"config_revision"`
+	Author          string             `json:"author"`
+	Reason          string             `json:"reason,omitempty"`
+	CreatedAt       string             `json:"created_at"`
+}
+
 // ================== Health & Monitoring ==================
 
 // NginxClusterHealthResponse health check response
@@ -309,21 +616,52 @@ type NginxClusterMetricsResponse struct {
 	RequestsPerSec float64            `json:"requests_per_sec"`
 	ActiveConns    int                `json:"active_connections"`
 	Status2xx      int64              `json:"status_2xx"`
+	Status3xx      int64              `json:"status_3xx"`
 	Status4xx      int64              `json:"status_4xx"`
 	Status5xx      int64              `json:"status_5xx"`
 	AvgLatencyMs   float64            `json:"avg_latency_ms"`
 	NodeMetrics    []NginxNodeMetrics `json:"node_metrics"`
 }
 
-// NginxNodeMetrics individual node metrics
+// NginxNodeMetrics individual node metrics; status counts and latencies cover the last scrape window
 type NginxNodeMetrics struct {
-	NodeID         string  `json:"node_id"`
-	NodeName       string  `json:"node_name"`
-	Role           string  `json:"role"`
-	TotalRequests  int64   `json:"total_requests"`
-	RequestsPerSec float64 `json:"requests_per_sec"`
-	ActiveConns    int     `json:"active_connections"`
-	Status2xx      int64   `json:"status_2xx"`
-	Status4xx      int64   `json:"status_4xx"`
-	Status5xx      int64   `json:"status_5xx"`
+	NodeID           string             `json:"node_id"`
+	NodeName         string             `json:"node_name"`
+	Role             string             `json:"role"`
+	CollectedAt      string             `json:"collected_at,omitempty"`
+	WindowSeconds    float64            `json:"window_seconds,omitempty"`
+	TotalRequests    int64              `json:"total_requests"`
+	RequestsPerSec   float64            `json:"requests_per_sec"`
+	ActiveConns      int                `json:"active_connections"`
+	Reading          int                `json:"reading"`
+	Writing          int                `json:"writing"`
+	Waiting          int                `json:"waiting"`
+	Accepts          int64              `json:"accepts"`
+	Handled          int64              `json:"handled"`
+	LoggedRequests   int64              `json:"logged_requests"`
+	Status1xx        int64              `json:"status_1xx"`
+	Status2xx        int64              `json:"status_2xx"`
+	Status3xx        int64              `json:"status_3xx"`
+	Status4xx        int64              `json:"status_4xx"`
+	Status5xx        int64              `json:"status_5xx"`
+	AvgLatencyMs     float64            `json:"avg_latency_ms"`
+	RequestTime      LatencyPercentiles `json:"request_time"`
+	UpstreamConnect  LatencyPercentiles `json:"upstream_connect_time"`
+	UpstreamHeader   LatencyPercentiles `json:"upstream_header_time"`
+	UpstreamResponse LatencyPercentiles `json:"upstream_response_time"`
+}
+
+// LatencyPercentiles latency percentiles in milliseconds
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50_ms"`
+	P95 float64 `json:"p95_ms"`
+	P99 float64 `json:"p99_ms"`
+}
+
+// NginxMetricsHistoryResponse stored metric samples, newest first
+type NginxMetricsHistoryResponse struct {
+	ClusterID string             `json:"cluster_id"`
+	From      string             `json:"from"`
+	To        string             `json:"to"`
+	Samples   []NginxNodeMetrics `json:"samples"`
 }
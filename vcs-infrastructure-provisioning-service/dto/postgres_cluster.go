@@ -58,7 +58,10 @@ type CreateClusterRequest struct {
 	Databases []ClusterDatabase `json:"databases,omitempty"`
 
 	// Security
-	EnableTLS bool `json:"enable_tls,omitempty"`
+	EnableTLS bool `json:"enable_tls,omitempty"` // TLS with node certificates from the platform CA
+
+	// Image overrides the Patroni PostgreSQL image (default: postgre_db)
+	Image string `json:"image,omitempty"`
 }
 
 // ClusterUser defines user with roles
@@ -101,6 +104,11 @@ type ClusterInfoResponse struct {
 	UpdatedAt         string `json:"updated_at"`
 	HAProxyPort       int    `json:"haproxy_port"`
 	MaxReplicationLag int64  `json:"max_replication_lag"`
+
+	// Set while the cluster replicates from another cluster as a DR standby
+	StandbyOfClusterID string `json:"standby_of_cluster_id,omitempty"`
+
+	TLSEnabled bool `json:"tls_enabled"`
 }
 
 // PostgresConnectionInfo consolidated connection details
@@ -110,6 +118,9 @@ type PostgresConnectionInfo struct {
 	Username string `json:"username"`
 	Database string `json:"database"`
 	SSLMode  string `json:"ssl_mode,omitempty"`
+
+	ConnectionString string `json:"connection_string,omitempty"`
+	CACertificate    string `json:"ca_certificate,omitempty"` // PEM of the platform CA, needed for verify-full
 }
 
 // ConnectionPoint represents connection endpoint (primary or replica)
@@ -350,3 +361,270 @@ type IndexInfo struct {
 	IsPrimary bool     `json:"is_primary"`
 	Type      string   `json:"type"` // btree, hash, gin, gist
 }
+
+// UpgradeClusterRequest for upgrading the PostgreSQL version of a cluster
+type UpgradeClusterRequest struct {
+	TargetVersion string `json:"target_version" binding:"required"`                          // e.g. 16.4 (minor) or 17 (major)
+	Method        string `json:"method,omitempty" binding:"omitempty,oneof=rolling logical"` // rolling (minor), logical (major); auto-detected
+	Image         string `json:"image,omitempty"`                                            // Target image (default: iaas-patroni-postgres:<target major>)
+	DryRun        bool   `json:"dry_run,omitempty"`                                          // Run pre-flight checks and return the plan only
+	KeepSource    bool   `json:"keep_source,omitempty"`                                      // Major upgrade: keep the old cluster running after cutover
+}
+
+// UpgradeClusterResponse returns pre-flight results, the upgrade plan and the tracking operation
+type UpgradeClusterResponse struct {
+	ClusterID      string                `json:"cluster_id"`
+	CurrentVersion string                `json:"current_version"`
+	TargetVersion  string                `json:"target_version"`
+	UpgradeType    string                `json:"upgrade_type"` // minor, major
+	Method         string                `json:"method"`       // rolling, logical
+	Image          string                `json:"image"`
+	DryRun         bool                  `json:"dry_run"`
+	Checks         []PreflightCheck      `json:"checks"`
+	Plan           []string              `json:"plan"`
+	Operation      *ClusterOperationInfo `json:"operation,omitempty"`
+}
+
+// ResizeClusterRequest for changing CPU/memory limits of every node
+type ResizeClusterRequest struct {
+	CPUPerNode    int64 `json:"cpu_per_node" binding:"required,min=1"`      // CPU cores per node
+	MemoryPerNode int64 `json:"memory_per_node" binding:"required,min=128"` // Memory in MB per node
+	ForceRecreate bool  `json:"force_recreate,omitempty"`                   // Recreate containers instead of live update
+}
+
+// PreflightCheck result of a single pre-flight check
+type PreflightCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+}
+
+// ClusterOperationInfo represents a tracked long-running cluster operation
+type ClusterOperationInfo struct {
+	ID            string                 `json:"id"`
+	ClusterID     string                 `json:"cluster_id"`
+	OperationType string                 `json:"operation_type"` // upgrade, resize, ...
+	Status        string                 `json:"status"`         // running, completed, failed
+	Progress      int                    `json:"progress"`       // 0-100
+	CurrentStep   string                 `json:"current_step"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+	ErrorMessage  string                 `json:"error_message,omitempty"`
+	StartedAt     string                 `json:"started_at"`
+	CompletedAt   string                 `json:"completed_at,omitempty"`
+}
+
+// CreateStandbyClusterRequest for creating a DR standby cluster that follows a source cluster
+type CreateStandbyClusterRequest struct {
+	ClusterName   string `json:"cluster_name" binding:"required"`
+	NodeCount     int    `json:"node_count,omitempty" binding:"omitempty,min=1,max=10"` // Default: same as source
+	CPUPerNode    int64  `json:"cpu_per_node,omitempty"`                                // Default: same as source
+	MemoryPerNode int64  `json:"memory_per_node,omitempty"`                             // Default: same as source
+}
+
+// StandbyStatusResponse replication state between a standby cluster and its source
+type StandbyStatusResponse struct {
+	ClusterID        string  `json:"cluster_id"`
+	SourceClusterID  string  `json:"source_cluster_id"`
+	StandbyLeader    string  `json:"standby_leader"`
+	SourceLeader     string  `json:"source_leader"`
+	Streaming        bool    `json:"streaming"`          // WAL receiver is connected
+	SourceLSN        string  `json:"source_lsn"`         // Current WAL position on the source primary
+	ReceiveLSN       string  `json:"receive_lsn"`        // Last WAL position received by the standby
+	ReplayLSN        string  `json:"replay_lsn"`         // Last WAL position replayed by the standby
+	LagBytes         int64   `json:"lag_bytes"`          // source_lsn - replay_lsn
+	ReplayLagSeconds float64 `json:"replay_lag_seconds"` // Age of the last replayed transaction
+	LastReplayedAt   string  `json:"last_replayed_at,omitempty"`
+	CheckedAt        string  `json:"checked_at"`
+}
+
+// PromoteStandbyRequest for promoting a standby cluster to a standalone cluster
+type PromoteStandbyRequest struct {
+	Reason string `json:"reason,omitempty"` // e.g. dr_drill (default: manual)
+}
+
+// ExtensionInfo describes an extension available in the cluster image
+type ExtensionInfo struct {
+	Name             string `json:"name"`
+	DefaultVersion   string `json:"default_version"`
+	InstalledVersion string `json:"installed_version,omitempty"`
+	Schema           string `json:"schema,omitempty"`
+	Installed        bool   `json:"installed"`
+	RequiresPreload  bool   `json:"requires_preload"` // Needs shared_preload_libraries
+	Preloaded        bool   `json:"preloaded"`
+	Comment          string `json:"comment,omitempty"`
+}
+
+// ListExtensionsResponse extensions of a database
+type ListExtensionsResponse struct {
+	ClusterID              string          `json:"cluster_id"`
+	Database               string          `json:"database"`
+	SharedPreloadLibraries []string        `json:"shared_preload_libraries"`
+	Extensions             []ExtensionInfo `json:"extensions"`
+}
+
+// CreateExtensionRequest for enabling an extension in a database
+type CreateExtensionRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Schema  string `json:"schema,omitempty"`
+	Version string `json:"version,omitempty"`
+	Cascade bool   `json:"cascade,omitempty"` // Also install required extensions
+}
+
+// ExtensionChangeResponse result of creating or dropping an extension
+type ExtensionChangeResponse struct {
+	ClusterID       string                `json:"cluster_id"`
+	Database        string                `json:"database"`
+	Extension       string                `json:"extension"`
+	Action          string                `json:"action"` // created, dropped, pending
+	RequiresRestart bool                  `json:"requires_restart"`
+	Operation       *ClusterOperationInfo `json:"operation,omitempty"` // Rolling restart when the library must be preloaded first
+}
+
+// QueryInsightsResponse workload insights of every Patroni node in a cluster
+type QueryInsightsResponse struct {
+	ClusterID   string             `json:"cluster_id"`
+	Nodes       []NodeQueryInsight `json:"nodes"`
+	CollectedAt string             `json:"collected_at"`
+}
+
+// NodeQueryInsight statements, activity and lock waits of a single node
+type NodeQueryInsight struct {
+	NodeID                string           `json:"node_id"`
+	NodeName              string           `json:"node_name"`
+	Role                  string           `json:"role"` // leader, replica
+	StatStatementsEnabled bool             `json:"stat_statements_enabled"`
+	TopByTotalTime        []QueryStatistic `json:"top_by_total_time"`
+	TopByMeanTime         []QueryStatistic `json:"top_by_mean_time"`
+	LongRunning           []ActiveQuery    `json:"long_running"`
+	BlockingChains        []LockWaitInfo   `json:"blocking_chains"`
+	Error                 string           `json:"error,omitempty"`
+}
+
+// QueryStatistic aggregated pg_stat_statements counters of a normalized query
+type QueryStatistic struct {
+	QueryID     string  `json:"query_id"`
+	Database    string  `json:"database"`
+	Calls       int64   `json:"calls"`
+	TotalTimeMs float64 `json:"total_time_ms"`
+	MeanTimeMs  float64 `json:"mean_time_ms"`
+	Rows        int64   `json:"rows"`
+	Query       string  `json:"query"`
+}
+
+// ActiveQuery a query currently running on a node
+type ActiveQuery struct {
+	PID             int     `json:"pid"`
+	Database        string  `json:"database"`
+	Username        string  `json:"username"`
+	ApplicationName string  `json:"application_name"`
+	ClientAddr      string  `json:"client_addr"`
+	State           string  `json:"state"`
+	WaitEventType   string  `json:"wait_event_type,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Query           string  `json:"query"`
+}
+
+// LockWaitInfo a backend waiting on locks and the chain of backends blocking it
+type LockWaitInfo struct {
+	BlockedPID       int     `json:"blocked_pid"`
+	BlockedUser      string  `json:"blocked_user"`
+	BlockedQuery     string  `json:"blocked_query"`
+	WaitingFor       string  `json:"waiting_for"` // Lock modes and relations not yet granted
+	WaitSeconds      float64 `json:"wait_seconds"`
+	BlockingPIDs     []int   `json:"blocking_pids"`
+	Chain            []int   `json:"chain"` // blocked pid -> ... -> root blocker
+	RootBlockerPID   int     `json:"root_blocker_pid"`
+	RootBlockerQuery string  `json:"root_blocker_query,omitempty"`
+}
+
+// CancelQueryRequest for cancelling or terminating a backend
+type CancelQueryRequest struct {
+	NodeID    string `json:"node_id" binding:"required"`
+	PID       int    `json:"pid" binding:"required"`
+	Terminate bool   `json:"terminate,omitempty"` // pg_terminate_backend instead of pg_cancel_backend
+}
+
+// CreateQuerySnapshotRequest for capturing pg_stat_statements counters
+type CreateQuerySnapshotRequest struct {
+	Label string `json:"label,omitempty"` // e.g. before-deploy-v1.2
+}
+
+// QuerySnapshotInfo a stored query snapshot
+type QuerySnapshotInfo struct {
+	ID         string           `json:"id"`
+	ClusterID  string           `json:"cluster_id"`
+	Label      string           `json:"label,omitempty"`
+	Source     string           `json:"source"` // manual, scheduled
+	NodeID     string           `json:"node_id"`
+	CapturedAt string           `json:"captured_at"`
+	Truncated  bool             `json:"truncated"` // Only the top statements by total time were kept
+	Statements []QueryStatistic `json:"statements,omitempty"`
+}
+
+// QuerySnapshotComparison differences between two snapshots
+type QuerySnapshotComparison struct {
+	ClusterID string            `json:"cluster_id"`
+	From      QuerySnapshotInfo `json:"from"`
+	To        QuerySnapshotInfo `json:"to"`
+	Queries   []QueryDelta      `json:"queries"` // Ordered by total time spent between the snapshots
+}
+
+// QueryDelta change of a query's counters between two snapshots
+type QueryDelta struct {
+	QueryID        string  `json:"query_id"`
+	Database       string  `json:"database"`
+	Query          string  `json:"query"`
+	Calls          int64   `json:"calls"`            // Calls between the snapshots
+	TotalTimeMs    float64 `json:"total_time_ms"`    // Time spent between the snapshots
+	MeanTimeMs     float64 `json:"mean_time_ms"`     // Mean time of calls between the snapshots
+	MeanTimeBefore float64 `json:"mean_time_before"` // Mean time in the first snapshot
+	MeanTimeChange float64 `json:"mean_time_change"` // Percent change of mean time
+	New            bool    `json:"new"`              // Not present in the first snapshot, which kept every statement
+	Unknown        bool    `json:"unknown"`          // Not in the truncated first snapshot; counters are totals since the last stats reset
+}
+
+// DumpOptions selects the format and contents of a logical dump
+type DumpOptions struct {
+	Format        string   `form:"format" json:"format" binding:"omitempty,oneof=custom plain"` // custom (pg_restore) or plain SQL, default custom
+	Tables        []string `form:"tables" json:"tables,omitempty"`                              // only dump these tables (pg_dump patterns)
+	ExcludeTables []string `form:"exclude_tables" json:"exclude_tables,omitempty"`              // skip these tables (pg_dump patterns)
+	SchemaOnly    bool     `form:"schema_only" json:"schema_only"`
+	DataOnly      bool     `form:"data_only" json:"data_only"`
+}
+
+// ImportDatabaseRequest holds the form fields sent along with an uploaded dump
+type ImportDatabaseRequest struct {
+	Clean bool `form:"clean"` // drop existing objects before recreating them (custom format only)
+}
+
+// CopyDatabaseRequest for copying a database of another managed cluster into this cluster
+type CopyDatabaseRequest struct {
+	SourceClusterID string   `json:"source_cluster_id" binding:"required"`
+	SourceDatabase  string   `json:"source_database"` // defaults to the target database name
+	Tables          []string `json:"tables,omitempty"`
+	ExcludeTables   []string `json:"exclude_tables,omitempty"`
+	SchemaOnly      bool     `json:"schema_only"`
+	DataOnly        bool     `json:"data_only"`
+	Clean           bool     `json:"clean"` // drop existing objects in the target first, e.g. when refreshing staging
+}
+
+// ClusterTLSStatus shows the TLS setup and node certificates of a cluster
+type ClusterTLSStatus struct {
+	ClusterID     string                `json:"cluster_id"`
+	Enabled       bool                  `json:"enabled"`
+	CACertificate string                `json:"ca_certificate,omitempty"`
+	CAExpiresAt   string                `json:"ca_expires_at,omitempty"`
+	Nodes         []NodeCertificateInfo `json:"nodes"`
+}
+
+// NodeCertificateInfo describes the active server certificate of a node
+type NodeCertificateInfo struct {
+	NodeID       string   `json:"node_id"`
+	CommonName   string   `json:"common_name"`
+	DNSNames     []string `json:"dns_names"`
+	SerialNumber string   `json:"serial_number"`
+	Fingerprint  string   `json:"fingerprint"` // SHA-256
+	NotBefore    string   `json:"not_before"`
+	NotAfter     string   `json:"not_after"`
+	DaysLeft     int      `json:"days_left"`
+}
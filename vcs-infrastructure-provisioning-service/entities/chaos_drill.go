@@ -0,0 +1,22 @@
+package entities
+
+import (
+	"time"
+)
+
+// ChaosDrill records a scripted failure scenario run against a cluster and the measured outcome
+type ChaosDrill struct {
+	ID              string    `gorm:"primaryKey;type:varchar(36)"`
+	TargetType      string    `gorm:"type:varchar(20);not null;index"` // postgres, nginx
+	TargetID        string    `gorm:"type:varchar(36);not null;index"` // cluster ID
+	Scenario        string    `gorm:"type:varchar(50);not null"`       // kill_leader, pause_node, disconnect_node, fill_disk
+	TargetNodeID    string    `gorm:"type:varchar(36)"`
+	Status          string    `gorm:"type:varchar(20);not null"` // running, completed, failed
+	DurationSeconds int       `gorm:"default:30"`                // how long the fault is held
+	Forced          bool      `gorm:"default:false"`             // ran on a prod stack
+	UserID          string    `gorm:"type:varchar(36)"`
+	Report          string    `gorm:"type:text"` // JSON
+	ErrorMessage    string    `gorm:"type:text"`
+	StartedAt       time.Time `gorm:"autoCreateTime"`
+	CompletedAt     *time.Time
+}
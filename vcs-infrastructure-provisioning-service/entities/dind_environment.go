@@ -23,6 +23,10 @@ type DinDEnvironment struct {
 	AutoCleanup      bool      `gorm:"default:false"`
 	TTLHours         int       `gorm:"default:0"` // 0 = no expiration
 	ExpiresAt        time.Time `gorm:"index"`
+	ExpiryWarned     bool      `gorm:"default:false"` // Đã gửi cảnh báo sắp hết hạn
+	ExpiredAt        time.Time // Thời điểm bị dừng do hết hạn, bị xóa sau grace period
+	DataVolume       string    `gorm:"type:varchar(255)"` // Named volume cho /var/lib/docker, rỗng nếu là anonymous volume
+	SnapshotID       string    `gorm:"type:varchar(36)"`  // Snapshot được restore, nếu có
 	UserID           string    `gorm:"type:varchar(36);index"`
 	CreatedAt        time.Time `gorm:"autoCreateTime"`
 	UpdatedAt        time.Time `gorm:"autoUpdateTime"`
@@ -37,11 +41,12 @@ func (DinDEnvironment) TableName() string {
 type DinDCommandHistory struct {
 	ID            string    `gorm:"primaryKey;type:varchar(36)"`
 	EnvironmentID string    `gorm:"type:varchar(36);not null;index"`
+	UserID        string    `gorm:"type:varchar(36);index"` // Người chạy command
 	Command       string    `gorm:"type:text;not null"`
 	Output        string    `gorm:"type:text"`
 	ExitCode      int       `gorm:"default:0"`
 	Duration      int       `gorm:"default:0"` // milliseconds
-	ExecutedAt    time.Time `gorm:"autoCreateTime"`
+	ExecutedAt    time.Time `gorm:"autoCreateTime;index"`
 }
 
 // TableName - Tên bảng trong database
@@ -49,3 +54,68 @@ func (DinDCommandHistory) TableName() string {
 	return "dind_command_history"
 }
 
+// DinDTerminalSession - Phiên terminal tương tác (TTY qua WebSocket), lưu lại để audit
+type DinDTerminalSession struct {
+	ID            string    `gorm:"primaryKey;type:varchar(36)"`
+	EnvironmentID string    `gorm:"type:varchar(36);not null;index"`
+	UserID        string    `gorm:"type:varchar(36);index"`
+	Command       string    `gorm:"type:text;not null"`
+	Transcript    string    `gorm:"type:text"` // Output của terminal (bao gồm cả phần echo input)
+	Truncated     bool      `gorm:"default:false"`
+	BytesIn       int64     `gorm:"default:0"`
+	BytesOut      int64     `gorm:"default:0"`
+	ExitCode      int       `gorm:"default:-1"`       // -1 = chưa kết thúc hoặc không lấy được
+	CloseReason   string    `gorm:"type:varchar(50)"` // exited, client_closed, idle_timeout
+	StartedAt     time.Time `gorm:"autoCreateTime"`
+	EndedAt       time.Time
+}
+
+// TableName - Tên bảng trong database
+func (DinDTerminalSession) TableName() string {
+	return "dind_terminal_sessions"
+}
+
+// DinDJob - Build, pull hoặc compose chạy nền, output được stream trực tiếp và lưu lại khi kết thúc
+type DinDJob struct {
+	ID            string    `gorm:"primaryKey;type:varchar(36)"`
+	EnvironmentID string    `gorm:"type:varchar(36);not null;index"`
+	UserID        string    `gorm:"type:varchar(36);index"`
+	Type          string    `gorm:"type:varchar(20);not null"`          // build, pull, compose, push
+	Status        string    `gorm:"type:varchar(20);default:'running'"` // running, succeeded, failed, cancelled
+	Request       string    `gorm:"type:text"`                          // JSON của request
+	Output        string    `gorm:"type:text"`
+	Truncated     bool      `gorm:"default:false"`
+	Result        string    `gorm:"type:text"` // JSON, ví dụ image_id của build
+	Error         string    `gorm:"type:text"`
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+	FinishedAt    time.Time
+}
+
+// TableName - Tên bảng trong database
+func (DinDJob) TableName() string {
+	return "dind_jobs"
+}
+
+// DinDSnapshot - Snapshot của môi trường DinD: filesystem của container (image) và /var/lib/docker (volume)
+type DinDSnapshot struct {
+	ID                string    `gorm:"primaryKey;type:varchar(36)"`
+	EnvironmentID     string    `gorm:"type:varchar(36);not null;index"` // Môi trường nguồn, có thể đã bị xóa
+	UserID            string    `gorm:"type:varchar(36);index"`
+	Name              string    `gorm:"type:varchar(255);not null"`
+	Description       string    `gorm:"type:text"`
+	Status            string    `gorm:"type:varchar(20);default:'creating'"` // creating, ready, failed
+	Error             string    `gorm:"type:text"`
+	Image             string    `gorm:"type:varchar(255)"` // Image commit từ container
+	DataVolume        string    `gorm:"type:varchar(255)"` // Bản sao /var/lib/docker
+	ResourcePlan      string    `gorm:"type:varchar(20)"`
+	RunningContainers string    `gorm:"type:text"` // ID các container đang chạy bên trong, khởi động lại khi restore
+	ImageSize         int64     `gorm:"default:0"` // Bytes thêm vào so với image docker:dind
+	DataSize          int64     `gorm:"default:0"` // Bytes của /var/lib/docker
+	CreatedAt         time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName - Tên bảng trong database
+func (DinDSnapshot) TableName() string {
+	return "dind_snapshots"
+}
+
@@ -30,8 +30,9 @@ type NginxCluster struct {
 
 	// SSL/TLS
 	SSLEnabled        bool   `gorm:"default:false"`
-	SSLCertificate    string `gorm:"type:text"`
+	SSLCertificate    string `gorm:"type:text"` // Legacy inline certificate, new clusters use DefaultCertID
 	SSLPrivateKey     string `gorm:"type:text"`
+	DefaultCertID     string `gorm:"type:varchar(36)"` // NginxCertificate used by TLS server blocks without SSLCertID
 	SSLProtocols      string `gorm:"type:varchar(100);default:'TLSv1.2 TLSv1.3'"`
 	SSLSessionTimeout string `gorm:"type:varchar(20);default:'1d'"`
 
@@ -62,7 +63,8 @@ type NginxCluster struct {
 	GzipTypes     string `gorm:"type:varchar(500);default:'text/plain text/css application/json application/javascript'"`
 
 	// Config
-	NginxConfig string `gorm:"type:text"` // Generated nginx.conf
+	NginxConfig    string `gorm:"type:text"` // Generated nginx.conf
+	ConfigRevision int    `gorm:"default:0"` // Revision currently applied to the nodes
 
 	// Resources
 	CPULimit    int64 `gorm:"default:0"`
@@ -106,6 +108,7 @@ type NginxClusterUpstream struct {
 	Algorithm   string       `gorm:"type:varchar(20);default:'round_robin'"` // round_robin, least_conn, ip_hash
 	HealthCheck bool         `gorm:"default:true"`
 	HealthPath  string       `gorm:"type:varchar(255);default:'/health'"`
+	Version     string       `gorm:"type:varchar(100)"` // Release deployed behind this upstream, e.g. v1.4.2
 	CreatedAt   time.Time    `gorm:"autoCreateTime"`
 	UpdatedAt   time.Time    `gorm:"autoUpdateTime"`
 }
@@ -123,15 +126,110 @@ type NginxUpstreamServer struct {
 	MaxFails    int                  `gorm:"default:3"`
 	FailTimeout int                  `gorm:"default:30"` // seconds
 	IsBackup    bool                 `gorm:"default:false"`
-	IsDown      bool                 `gorm:"default:false"`
-	CreatedAt   time.Time            `gorm:"autoCreateTime"`
-	UpdatedAt   time.Time            `gorm:"autoUpdateTime"`
+	IsDown      bool                 `gorm:"default:false"` // Set by the upstream health checker
+
+	// Active health check state
+	HealthStatus         string `gorm:"type:varchar(20);default:'unknown'"` // unknown, healthy, unhealthy
+	ConsecutiveFailures  int    `gorm:"default:0"`
+	ConsecutiveSuccesses int    `gorm:"default:0"`
+	LastCheckedAt        *time.Time
+	LastError            string `gorm:"type:varchar(255)"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 }
 
 func (NginxUpstreamServer) TableName() string {
 	return "nginx_upstream_servers"
 }
 
+// NginxAccessPolicy restricts a server block, or one of its locations, by client address,
+// HTTP basic auth and an auth_request endpoint
+type NginxAccessPolicy struct {
+	ID                  string    `gorm:"primaryKey;type:varchar(36)"`
+	ClusterID           string    `gorm:"type:varchar(36);not null;index"`
+	ServerBlockID       string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_nginx_access_policy_scope"`
+	LocationID          string    `gorm:"type:varchar(36);uniqueIndex:idx_nginx_access_policy_scope"` // Empty for the whole server block
+	AllowCIDRs          string    `gorm:"type:text"`                                                  // JSON array
+	DenyCIDRs           string    `gorm:"type:text"`                                                  // JSON array
+	Satisfy             string    `gorm:"type:varchar(10);default:'all'"`                             // all, any
+	BasicAuthEnabled    bool      `gorm:"default:false"`
+	BasicAuthRealm      string    `gorm:"type:varchar(100)"`
+	AuthRequestURL      string    `gorm:"type:varchar(500)"` // 2xx allows the request, 401/403 deny it
+	AuthResponseHeaders string    `gorm:"type:text"`         // JSON array of auth response headers passed to the backend
+	CreatedAt           time.Time `gorm:"autoCreateTime"`
+	UpdatedAt           time.Time `gorm:"autoUpdateTime"`
+}
+
+func (NginxAccessPolicy) TableName() string {
+	return "nginx_access_policies"
+}
+
+// NginxBasicAuthUser is a user of the htpasswd file of an access policy
+type NginxBasicAuthUser struct {
+	ID           string    `gorm:"primaryKey;type:varchar(36)"`
+	PolicyID     string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_nginx_basic_auth_user"`
+	Username     string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_nginx_basic_auth_user"`
+	PasswordHash string    `gorm:"type:varchar(255);not null"` // bcrypt
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+func (NginxBasicAuthUser) TableName() string {
+	return "nginx_basic_auth_users"
+}
+
+// NginxStreamProxy is a TCP/UDP proxy rendered into the stream {} section of nginx.conf
+type NginxStreamProxy struct {
+	ID             string       `gorm:"primaryKey;type:varchar(36)"`
+	ClusterID      string       `gorm:"type:varchar(36);not null;index"`
+	Cluster        NginxCluster `gorm:"foreignKey:ClusterID"`
+	Name           string       `gorm:"type:varchar(100);not null"`
+	Protocol       string       `gorm:"type:varchar(10);default:'tcp'"`         // tcp, udp
+	ListenPort     int          `gorm:"not null"`                               // Port nginx listens on inside the node containers
+	HostPort       int          `gorm:"default:0"`                              // First host port tried when publishing, ListenPort when 0
+	Algorithm      string       `gorm:"type:varchar(20);default:'round_robin'"` // round_robin, least_conn, hash
+	ConnectTimeout int          `gorm:"default:10"`                             // seconds
+	Timeout        int          `gorm:"default:600"`                            // seconds of inactivity before a session is closed
+	TLSEnabled     bool         `gorm:"default:false"`                          // Terminate TLS, tcp only
+	SSLCertID      string       `gorm:"type:varchar(36)"`                       // Default certificate when empty
+	CreatedAt      time.Time    `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time    `gorm:"autoUpdateTime"`
+}
+
+func (NginxStreamProxy) TableName() string {
+	return "nginx_stream_proxies"
+}
+
+type NginxStreamServer struct {
+	ID          string           `gorm:"primaryKey;type:varchar(36)"`
+	StreamID    string           `gorm:"type:varchar(36);not null;index"`
+	Stream      NginxStreamProxy `gorm:"foreignKey:StreamID"`
+	Address     string           `gorm:"type:varchar(255);not null"` // host:port
+	Weight      int              `gorm:"default:1"`
+	MaxFails    int              `gorm:"default:3"`
+	FailTimeout int              `gorm:"default:30"` // seconds
+	IsBackup    bool             `gorm:"default:false"`
+}
+
+func (NginxStreamServer) TableName() string {
+	return "nginx_stream_servers"
+}
+
+// NginxStreamPort is the host port a node container publishes for a stream proxy
+type NginxStreamPort struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	StreamID  string    `gorm:"type:varchar(36);not null;index"`
+	NodeID    string    `gorm:"type:varchar(36);not null;index"`
+	Protocol  string    `gorm:"type:varchar(10);not null"`
+	HostPort  int       `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (NginxStreamPort) TableName() string {
+	return "nginx_stream_ports"
+}
+
 type NginxServerBlock struct {
 	ID         string       `gorm:"primaryKey;type:varchar(36)"`
 	ClusterID  string       `gorm:"type:varchar(36);not null;index"`
@@ -139,7 +237,7 @@ type NginxServerBlock struct {
 	ServerName string       `gorm:"type:varchar(255);not null"` // domain name
 	ListenPort int          `gorm:"default:80"`
 	SSLEnabled bool         `gorm:"default:false"`
-	SSLCertID  string       `gorm:"type:varchar(36)"`
+	SSLCertID  string       `gorm:"type:varchar(36)"` // NginxCertificate deployed as /etc/nginx/ssl/<id>.crt
 	RootPath   string       `gorm:"type:varchar(255)"`
 	IndexFiles string       `gorm:"type:varchar(255);default:'index.html index.htm'"`
 	CreatedAt  time.Time    `gorm:"autoCreateTime"`
@@ -154,19 +252,89 @@ type NginxLocation struct {
 	ID            string           `gorm:"primaryKey;type:varchar(36)"`
 	ServerBlockID string           `gorm:"type:varchar(36);not null;index"`
 	ServerBlock   NginxServerBlock `gorm:"foreignKey:ServerBlockID"`
+	Modifier      string           `gorm:"type:varchar(5)"`            // "", =, ~, ~*, ^~
 	Path          string           `gorm:"type:varchar(255);not null"` // /api, /static, etc.
 	ProxyPass     string           `gorm:"type:varchar(255)"`          // upstream name or URL
 	ProxyHeaders  string           `gorm:"type:text"`                  // JSON of proxy headers
 	CacheEnabled  bool             `gorm:"default:false"`
 	RateLimit     int              `gorm:"default:0"` // requests per second
-	CreatedAt     time.Time        `gorm:"autoCreateTime"`
-	UpdatedAt     time.Time        `gorm:"autoUpdateTime"`
+
+	// Traffic policy between ProxyPass (stable/blue) and SecondaryUpstream (canary/green)
+	TrafficMode       string `gorm:"type:varchar(20)"` // "", split, blue_green
+	SecondaryUpstream string `gorm:"type:varchar(100)"`
+	SecondaryWeight   int    `gorm:"default:0"`         // split: percent of requests sent to SecondaryUpstream
+	ActiveUpstream    string `gorm:"type:varchar(100)"` // blue_green: upstream receiving the traffic
+	StickySplit       bool   `gorm:"default:false"`     // split by client address instead of per request
+	RouteHeader       string `gorm:"type:varchar(100)"` // requests carrying this header go to the other upstream
+	RouteHeaderValue  string `gorm:"type:varchar(255)"`
+	RouteCookie       string `gorm:"type:varchar(100)"`
+	RouteCookieValue  string `gorm:"type:varchar(255)"`
+	TrafficVersion    int    `gorm:"default:0"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 }
 
 func (NginxLocation) TableName() string {
 	return "nginx_locations"
 }
 
+// NginxCertificate is a TLS certificate of a cluster, deployed to every node as /etc/nginx/ssl/<id>.crt and .key
+type NginxCertificate struct {
+	ID             string       `gorm:"primaryKey;type:varchar(36)"`
+	ClusterID      string       `gorm:"type:varchar(36);not null;index"`
+	Cluster        NginxCluster `gorm:"foreignKey:ClusterID"`
+	Name           string       `gorm:"type:varchar(100);not null"`
+	Source         string       `gorm:"type:varchar(20);not null"` // uploaded, csr, self_signed, acme
+	Status         string       `gorm:"type:varchar(20);not null"` // pending, active, failed
+	CommonName     string       `gorm:"type:varchar(255)"`
+	DNSNames       string       `gorm:"type:text"` // JSON array
+	CertPEM        string       `gorm:"type:text"` // Leaf followed by the intermediates
+	KeyPEM         string       `gorm:"type:text"`
+	CSRPEM         string       `gorm:"type:text"`
+	Issuer         string       `gorm:"type:varchar(255)"`
+	SerialNumber   string       `gorm:"type:varchar(64)"`
+	Fingerprint    string       `gorm:"type:varchar(64)"`
+	NotBefore      *time.Time
+	NotAfter       *time.Time `gorm:"index"`
+	AutoRenew      bool       `gorm:"default:false"`
+	ValidDays      int        `gorm:"default:0"` // Validity requested for self-signed renewals
+	ACMEDirectory  string     `gorm:"type:varchar(255)"`
+	ACMEEmail      string     `gorm:"type:varchar(255)"`
+	ACMEAccountKey string     `gorm:"type:text"` // Reused on renewal so the account stays the same
+	LastError      string     `gorm:"type:text"`
+	RenewedAt      *time.Time
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+}
+
+func (NginxCertificate) TableName() string {
+	return "nginx_certificates"
+}
+
+// NginxConfigRevision is an immutable snapshot of a cluster's nginx.conf and how it was rolled out
+type NginxConfigRevision struct {
+	ID           string       `gorm:"primaryKey;type:varchar(36)"`
+	ClusterID    string       `gorm:"type:varchar(36);not null;uniqueIndex:idx_nginx_config_revision"`
+	Cluster      NginxCluster `gorm:"foreignKey:ClusterID"`
+	Revision     int          `gorm:"not null;uniqueIndex:idx_nginx_config_revision"`
+	Config       string       `gorm:"type:text;not null"`
+	Checksum     string       `gorm:"type:varchar(64)"` // SHA-256 of Config
+	Diff         string       `gorm:"type:text"`        // Unified diff against the config applied when the revision was created
+	Author       string       `gorm:"type:varchar(100)"`
+	Reason       string       `gorm:"type:varchar(500)"`
+	RollbackOf   int          `gorm:"default:0"`                 // Source revision when created by a rollback
+	Status       string       `gorm:"type:varchar(20);not null"` // pending, applied, partial, failed
+	CanaryNodeID string       `gorm:"type:varchar(36)"`
+	ErrorMessage string       `gorm:"type:text"`
+	CreatedAt    time.Time    `gorm:"autoCreateTime"`
+	AppliedAt    *time.Time
+}
+
+func (NginxConfigRevision) TableName() string {
+	return "nginx_config_revisions"
+}
+
 type NginxFailoverEvent struct {
 	ID            string       `gorm:"primaryKey;type:varchar(36)"`
 	ClusterID     string       `gorm:"type:varchar(36);not null;index"`
@@ -183,3 +351,103 @@ type NginxFailoverEvent struct {
 func (NginxFailoverEvent) TableName() string {
 	return "nginx_failover_events"
 }
+
+// NginxClusterOperation tracks long-running operations (resize, ...) on a cluster
+type NginxClusterOperation struct {
+	ID            string       `gorm:"primaryKey;type:varchar(36)"`
+	ClusterID     string       `gorm:"type:varchar(36);not null;index"`
+	Cluster       NginxCluster `gorm:"foreignKey:ClusterID"`
+	OperationType string       `gorm:"type:varchar(50);not null"` // resize
+	Status        string       `gorm:"type:varchar(20);not null"` // running, completed, failed
+	Progress      int          `gorm:"default:0"`                 // 0-100
+	CurrentStep   string       `gorm:"type:varchar(255)"`
+	Details       string       `gorm:"type:text"` // JSON
+	ErrorMessage  string       `gorm:"type:text"`
+	StartedAt     time.Time    `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time    `gorm:"autoUpdateTime"`
+	CompletedAt   *time.Time
+}
+
+func (NginxClusterOperation) TableName() string {
+	return "nginx_cluster_operations"
+}
+
+// NginxUpstreamHealthEvent records an upstream server being marked down or up by the health checker
+type NginxUpstreamHealthEvent struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)"`
+	ClusterID  string    `gorm:"type:varchar(36);not null;index"`
+	UpstreamID string    `gorm:"type:varchar(36);not null;index"`
+	Address    string    `gorm:"type:varchar(255);not null"`
+	Status     string    `gorm:"type:varchar(20)"` // down, up
+	Reason     string    `gorm:"type:varchar(255)"`
+	OccurredAt time.Time `gorm:"autoCreateTime;index"`
+}
+
+func (NginxUpstreamHealthEvent) TableName() string {
+	return "nginx_upstream_health_events"
+}
+
+// NginxMetricSample is one scrape of a node: stub_status counters plus the access log lines written since the previous scrape
+// Samples are the only store of nginx metrics history; they are pruned after 7 days.
+type NginxMetricSample struct {
+	ID            string    `gorm:"primaryKey;type:varchar(36)"`
+	ClusterID     string    `gorm:"type:varchar(36);not null;index:idx_nginx_metric_samples_cluster_time,priority:1"`
+	NodeID        string    `gorm:"type:varchar(36);not null;index"`
+	NodeName      string    `gorm:"type:varchar(100)"`
+	CollectedAt   time.Time `gorm:"not null;index:idx_nginx_metric_samples_cluster_time,priority:2"`
+	WindowSeconds float64
+
+	// stub_status
+	ActiveConns    int
+	Reading        int
+	Writing        int
+	Waiting        int
+	Accepts        int64
+	Handled        int64
+	Requests       int64 // Total since nginx started
+	RequestsPerSec float64
+
+	// Access log, within the window
+	LoggedRequests int64
+	Status1xx      int64
+	Status2xx      int64
+	Status3xx      int64
+	Status4xx      int64
+	Status5xx      int64
+
+	// Latency percentiles in milliseconds, from rt, uct, uht and urt of the log format
+	RequestTimeAvg      float64
+	RequestTimeP50      float64
+	RequestTimeP95      float64
+	RequestTimeP99      float64
+	UpstreamConnectP50  float64
+	UpstreamConnectP95  float64
+	UpstreamConnectP99  float64
+	UpstreamHeaderP50   float64
+	UpstreamHeaderP95   float64
+	UpstreamHeaderP99   float64
+	UpstreamResponseP50 float64
+	UpstreamResponseP95 float64
+	UpstreamResponseP99 float64
+}
+
+func (NginxMetricSample) TableName() string {
+	return "nginx_metric_samples"
+}
+
+// NginxTrafficPolicyRevision is a version of the traffic policy of a location, kept so a release can be flipped back
+type NginxTrafficPolicyRevision struct {
+	ID             string    `gorm:"primaryKey;type:varchar(36)"`
+	ClusterID      string    `gorm:"type:varchar(36);not null;index"`
+	LocationID     string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_nginx_traffic_revision"`
+	Version        int       `gorm:"not null;uniqueIndex:idx_nginx_traffic_revision"`
+	Policy         string    `gorm:"type:text"` // JSON snapshot of proxy_pass and the policy fields
+	ConfigRevision int       // Config revision that applied this version
+	Author         string    `gorm:"type:varchar(36)"`
+	Reason         string    `gorm:"type:varchar(255)"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+func (NginxTrafficPolicyRevision) TableName() string {
+	return "nginx_traffic_policy_revisions"
+}
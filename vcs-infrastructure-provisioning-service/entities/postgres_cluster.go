@@ -27,6 +27,8 @@ type PostgreSQLCluster struct {
 	StorageSize        int            `gorm:"default:0"`
 	CPULimit           int64          `gorm:"default:0"`
 	MemoryLimit        int64          `gorm:"default:0"`
+	StandbyOfClusterID string         `gorm:"type:varchar(36);index"` // Source cluster while running as a Patroni standby_cluster
+	TLSEnabled         bool           `gorm:"default:false"`
 	CreatedAt          time.Time      `gorm:"autoCreateTime"`
 	UpdatedAt          time.Time      `gorm:"autoUpdateTime"`
 }
@@ -68,3 +70,58 @@ type FailoverEvent struct {
 	TriggeredBy    string            `gorm:"type:varchar(50)"` // system, user
 	OccurredAt     time.Time         `gorm:"autoCreateTime"`
 }
+
+// ClusterOperation tracks long-running operations (upgrade, resize, ...) on a cluster
+type ClusterOperation struct {
+	ID            string            `gorm:"primaryKey;type:varchar(36)"`
+	ClusterID     string            `gorm:"type:varchar(36);not null;index"`
+	Cluster       PostgreSQLCluster `gorm:"foreignKey:ClusterID"`
+	OperationType string            `gorm:"type:varchar(50);not null"` // upgrade, resize, extension, ...
+	Status        string            `gorm:"type:varchar(20);not null"` // pending, running, completed, failed
+	Progress      int               `gorm:"default:0"`                 // 0-100
+	CurrentStep   string            `gorm:"type:varchar(255)"`
+	Details       string            `gorm:"type:text"` // JSON
+	ErrorMessage  string            `gorm:"type:text"`
+	StartedAt     time.Time         `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time         `gorm:"autoUpdateTime"`
+	CompletedAt   *time.Time
+}
+
+// QuerySnapshot stores pg_stat_statements counters of a cluster leader at a point in time
+type QuerySnapshot struct {
+	ID         string            `gorm:"primaryKey;type:varchar(36)"`
+	ClusterID  string            `gorm:"type:varchar(36);not null;index"`
+	Cluster    PostgreSQLCluster `gorm:"foreignKey:ClusterID"`
+	Label      string            `gorm:"type:varchar(255)"`
+	Source     string            `gorm:"type:varchar(20);not null"` // manual, scheduled
+	NodeID     string            `gorm:"type:varchar(36)"`
+	Statements string            `gorm:"type:text"`     // JSON
+	Truncated  bool              `gorm:"default:false"` // Only the top statements by total time were kept
+	CapturedAt time.Time         `gorm:"autoCreateTime;index"`
+}
+
+// CertificateAuthority is a platform-internal CA used to sign server certificates
+type CertificateAuthority struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	Name      string    `gorm:"type:varchar(100);not null;uniqueIndex"`
+	CertPEM   string    `gorm:"type:text;not null"`
+	KeyPEM    string    `gorm:"type:text;not null"`
+	NotAfter  time.Time `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// NodeCertificate is the TLS server certificate issued to a cluster node; the latest one per node is active
+type NodeCertificate struct {
+	ID           string            `gorm:"primaryKey;type:varchar(36)"`
+	ClusterID    string            `gorm:"type:varchar(36);not null;index"`
+	Cluster      PostgreSQLCluster `gorm:"foreignKey:ClusterID"`
+	NodeID       string            `gorm:"type:varchar(36);not null;index"`
+	CommonName   string            `gorm:"type:varchar(255)"`
+	DNSNames     string            `gorm:"type:text"` // JSON array
+	SerialNumber string            `gorm:"type:varchar(64)"`
+	CertPEM      string            `gorm:"type:text;not null"`
+	KeyPEM       string            `gorm:"type:text;not null"`
+	NotBefore    time.Time
+	NotAfter     time.Time `gorm:"index"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
@@ -27,13 +27,31 @@ type IDockerService interface {
 	StartContainer(ctx context.Context, containerID string) error
 	StopContainer(ctx context.Context, containerID string) error
 	RestartContainer(ctx context.Context, containerID string) error
+	KillContainer(ctx context.Context, containerID, signal string) error
+	PauseContainer(ctx context.Context, containerID string) error
+	UnpauseContainer(ctx context.Context, containerID string) error
 	RemoveContainer(ctx context.Context, containerID string) error
+	RenameContainer(ctx context.Context, containerID, newName string) error
+	UpdateContainerResources(ctx context.Context, containerID string, resources ResourceConfig) error
 	GetContainerStats(ctx context.Context, containerID string) (types.ContainerStats, error)
 	GetContainerLogs(ctx context.Context, containerID string, tail int) ([]string, error)
+	GetContainerLogsRange(ctx context.Context, containerID string, since, until time.Time) ([]string, error)
 	ExecCommand(ctx context.Context, containerID string, cmd []string) (string, error)
+	ExecCommandWithExitCode(ctx context.Context, containerID string, cmd []string) (string, int, error)
+	ExecStream(ctx context.Context, containerID string, cmd []string, stdin io.Reader, stdout io.Writer) error
+	ExecTTY(ctx context.Context, containerID string, cmd []string, rows, cols uint) (*ExecSession, error)
+	CopyToContainer(ctx context.Context, containerID, dstDir string, archive io.Reader) error
+	CopyToContainerAsOwner(ctx context.Context, containerID, dstDir string, archive io.Reader) error
+	CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error)
 	InspectContainer(ctx context.Context, containerID string) (*types.ContainerJSON, error)
+	CommitContainer(ctx context.Context, containerID, reference string, labels map[string]string) (string, error)
+	RunContainer(ctx context.Context, config ContainerConfig) (string, error)
+	InspectImage(ctx context.Context, reference string) (*types.ImageInspect, error)
+	RemoveImage(ctx context.Context, reference string) error
 	CreateNetwork(ctx context.Context, networkName string) (string, error)
 	RemoveNetwork(ctx context.Context, networkID string) error
+	ConnectNetwork(ctx context.Context, networkID, containerID string, aliases []string) error
+	DisconnectNetwork(ctx context.Context, networkID, containerID string) error
 	CreateVolume(ctx context.Context, volumeName string) error
 	RemoveVolume(ctx context.Context, volumeName string) error
 	ListenToEvents(ctx context.Context, eventChan chan<- events.Message) error
@@ -44,13 +62,14 @@ type ContainerConfig struct {
 	Name         string
 	Image        string
 	Env          []string
-	Ports        map[string]string
+	Ports        map[string]string // container port ("80" or "514/udp") -> host port
 	Volumes      map[string]string
 	Network      string
 	NetworkAlias string
 	Cmd          []string
 	Resources    ResourceConfig
-	Privileged   bool // For Docker-in-Docker containers
+	Privileged   bool     // For Docker-in-Docker containers
+	CapAdd       []string // Extra kernel capabilities, e.g. NET_ADMIN for keepalived
 	Labels       map[string]string
 }
 
@@ -100,7 +119,9 @@ func (ds *dockerService) CreateContainer(ctx context.Context, config ContainerCo
 	portBindings := nat.PortMap{}
 	exposedPorts := nat.PortSet{}
 	for containerPort, hostPort := range config.Ports {
-		port, err := nat.NewPort("tcp", containerPort)
+		// "80" publishes a TCP port, "514/udp" a UDP one
+		proto, portNumber := nat.SplitProtoPort(containerPort)
+		port, err := nat.NewPort(proto, portNumber)
 		if err != nil {
 			return "", err
 		}
@@ -124,6 +145,7 @@ func (ds *dockerService) CreateContainer(ctx context.Context, config ContainerCo
 	hostConfig := &container.HostConfig{
 		PortBindings: portBindings,
 		Binds:        binds,
+		CapAdd:       config.CapAdd,
 		Resources: container.Resources{
 			NanoCPUs: config.Resources.CPULimit,
 			Memory:   config.Resources.MemoryLimit,
@@ -262,6 +284,39 @@ func (ds *dockerService) RestartContainer(ctx context.Context, containerID strin
 	return nil
 }
 
+// KillContainer sends a signal (SIGKILL when empty) to the container's main process
+func (ds *dockerService) KillContainer(ctx context.Context, containerID, signal string) error {
+	if signal == "" {
+		signal = "SIGKILL"
+	}
+	if err := ds.client.ContainerKill(ctx, containerID, signal); err != nil {
+		ds.logger.Error("failed to kill container", zap.String("container_id", containerID), zap.Error(err))
+		return err
+	}
+	ds.logger.Info("container killed", zap.String("container_id", containerID), zap.String("signal", signal))
+	return nil
+}
+
+// PauseContainer freezes all processes of a container
+func (ds *dockerService) PauseContainer(ctx context.Context, containerID string) error {
+	if err := ds.client.ContainerPause(ctx, containerID); err != nil {
+		ds.logger.Error("failed to pause container", zap.String("container_id", containerID), zap.Error(err))
+		return err
+	}
+	ds.logger.Info("container paused", zap.String("container_id", containerID))
+	return nil
+}
+
+// UnpauseContainer resumes a paused container
+func (ds *dockerService) UnpauseContainer(ctx context.Context, containerID string) error {
+	if err := ds.client.ContainerUnpause(ctx, containerID); err != nil {
+		ds.logger.Error("failed to unpause container", zap.String("container_id", containerID), zap.Error(err))
+		return err
+	}
+	ds.logger.Info("container unpaused", zap.String("container_id", containerID))
+	return nil
+}
+
 func (ds *dockerService) RemoveContainer(ctx context.Context, containerID string) error {
 	if err := ds.client.ContainerRemove(ctx, containerID, container.RemoveOptions{
 		Force:         true,
@@ -274,6 +329,39 @@ func (ds *dockerService) RemoveContainer(ctx context.Context, containerID string
 	return nil
 }
 
+func (ds *dockerService) RenameContainer(ctx context.Context, containerID, newName string) error {
+	if err := ds.client.ContainerRename(ctx, containerID, newName); err != nil {
+		ds.logger.Error("failed to rename container", zap.String("container_id", containerID), zap.Error(err))
+		return err
+	}
+	ds.logger.Info("container renamed", zap.String("container_id", containerID), zap.String("name", newName))
+	return nil
+}
+
+// UpdateContainerResources changes CPU/memory limits of a running container in place
+func (ds *dockerService) UpdateContainerResources(ctx context.Context, containerID string, resources ResourceConfig) error {
+	update := container.UpdateConfig{
+		Resources: container.Resources{
+			NanoCPUs: resources.CPULimit,
+			Memory:   resources.MemoryLimit,
+		},
+	}
+	// Keep Docker's default swap allowance (2x memory) so lowering or raising memory does not conflict with the old swap limit
+	if resources.MemoryLimit > 0 {
+		update.Resources.MemorySwap = resources.MemoryLimit * 2
+	}
+
+	if _, err := ds.client.ContainerUpdate(ctx, containerID, update); err != nil {
+		ds.logger.Error("failed to update container resources", zap.String("container_id", containerID), zap.Error(err))
+		return err
+	}
+	ds.logger.Info("container resources updated",
+		zap.String("container_id", containerID),
+		zap.Int64("nano_cpus", resources.CPULimit),
+		zap.Int64("memory", resources.MemoryLimit))
+	return nil
+}
+
 func (ds *dockerService) GetContainerStats(ctx context.Context, containerID string) (types.ContainerStats, error) {
 	stats, err := ds.client.ContainerStats(ctx, containerID, false)
 	if err != nil {
@@ -319,6 +407,36 @@ func (ds *dockerService) GetContainerLogs(ctx context.Context, containerID strin
 	return result, nil
 }
 
+// GetContainerLogsRange returns the stdout lines a container wrote in [since, until), so consecutive
+// windows never return a line twice
+func (ds *dockerService) GetContainerLogsRange(ctx context.Context, containerID string, since, until time.Time) ([]string, error) {
+	options := container.LogsOptions{
+		ShowStdout: true,
+		Since:      fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()),
+		Until:      fmt.Sprintf("%d.%09d", until.Unix(), until.Nanosecond()),
+	}
+
+	logs, err := ds.client.ContainerLogs(ctx, containerID, options)
+	if err != nil {
+		ds.logger.Error("failed to get container logs", zap.String("container_id", containerID), zap.Error(err))
+		return nil, err
+	}
+	defer logs.Close()
+
+	var stdout bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, io.Discard, logs); err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result, nil
+}
+
 func (ds *dockerService) ExecCommand(ctx context.Context, containerID string, cmd []string) (string, error) {
 	execConfig := types.ExecConfig{
 		AttachStdout: true,
@@ -354,6 +472,181 @@ func (ds *dockerService) ExecCommand(ctx context.Context, containerID string, cm
 	return output, nil
 }
 
+// ExecCommandWithExitCode is ExecCommand that also reports the exit code of the command
+func (ds *dockerService) ExecCommandWithExitCode(ctx context.Context, containerID string, cmd []string) (string, int, error) {
+	execConfig := types.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	}
+
+	execResp, err := ds.client.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		ds.logger.Error("failed to create exec", zap.String("container_id", containerID), zap.Error(err))
+		return "", -1, err
+	}
+
+	attachResp, err := ds.client.ContainerExecAttach(ctx, execResp.ID, types.ExecStartCheck{})
+	if err != nil {
+		ds.logger.Error("failed to attach exec", zap.String("exec_id", execResp.ID), zap.Error(err))
+		return "", -1, err
+	}
+	defer attachResp.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, attachResp.Reader); err != nil {
+		return "", -1, err
+	}
+
+	inspect, err := ds.client.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return "", -1, err
+	}
+	return stdout.String() + stderr.String(), inspect.ExitCode, nil
+}
+
+// ExecStream runs a command with stdin fed from the reader (when set) and stdout streamed to the writer.
+// Unlike ExecCommand it checks the exit code and returns the captured stderr on failure.
+func (ds *dockerService) ExecStream(ctx context.Context, containerID string, cmd []string, stdin io.Reader, stdout io.Writer) error {
+	execConfig := types.ExecConfig{
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	}
+
+	execResp, err := ds.client.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		ds.logger.Error("failed to create exec", zap.String("container_id", containerID), zap.Error(err))
+		return err
+	}
+
+	attachResp, err := ds.client.ContainerExecAttach(ctx, execResp.ID, types.ExecStartCheck{})
+	if err != nil {
+		ds.logger.Error("failed to attach exec", zap.String("exec_id", execResp.ID), zap.Error(err))
+		return err
+	}
+	defer attachResp.Close()
+
+	if stdin != nil {
+		go func() {
+			if _, err := io.Copy(attachResp.Conn, stdin); err != nil {
+				ds.logger.Warn("exec stdin copy interrupted", zap.String("exec_id", execResp.ID), zap.Error(err))
+			}
+			attachResp.CloseWrite()
+		}()
+	}
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	var stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(stdout, &stderr, attachResp.Reader); err != nil {
+		return err
+	}
+
+	inspect, err := ds.client.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return err
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("%s exited with code %d: %s", cmd[0], inspect.ExitCode, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// CopyToContainer extracts a tar archive, optionally compressed, into an existing directory of the container
+func (ds *dockerService) CopyToContainer(ctx context.Context, containerID, dstDir string, archive io.Reader) error {
+	if err := ds.client.CopyToContainer(ctx, containerID, dstDir, archive, types.CopyToContainerOptions{}); err != nil {
+		ds.logger.Error("failed to copy to container", zap.String("container_id", containerID), zap.String("path", dstDir), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// CopyToContainerAsOwner is CopyToContainer with the extracted entries owned by the user the container runs as
+func (ds *dockerService) CopyToContainerAsOwner(ctx context.Context, containerID, dstDir string, archive io.Reader) error {
+	if err := ds.client.CopyToContainer(ctx, containerID, dstDir, archive, types.CopyToContainerOptions{CopyUIDGID: true}); err != nil {
+		ds.logger.Error("failed to copy to container", zap.String("container_id", containerID), zap.String("path", dstDir), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// CopyFromContainer returns a file or directory of the container as a tar archive, with the
+// stat of the path. The caller closes the archive.
+func (ds *dockerService) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error) {
+	return ds.client.CopyFromContainer(ctx, containerID, srcPath)
+}
+
+// ExecSession is an interactive exec attached to a TTY. A TTY merges stdout and stderr, so the
+// output is read as is instead of through stdcopy.
+type ExecSession struct {
+	ID     string
+	client *client.Client
+	resp   types.HijackedResponse
+}
+
+// ExecTTY starts cmd with a pseudo terminal of the given size and keeps its streams attached
+func (ds *dockerService) ExecTTY(ctx context.Context, containerID string, cmd []string, rows, cols uint) (*ExecSession, error) {
+	consoleSize := &[2]uint{rows, cols}
+	execConfig := types.ExecConfig{
+		Tty:          true,
+		ConsoleSize:  consoleSize,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          []string{"TERM=xterm-256color"},
+		Cmd:          cmd,
+	}
+
+	execResp, err := ds.client.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		ds.logger.Error("failed to create exec", zap.String("container_id", containerID), zap.Error(err))
+		return nil, err
+	}
+
+	attachResp, err := ds.client.ContainerExecAttach(ctx, execResp.ID, types.ExecStartCheck{Tty: true, ConsoleSize: consoleSize})
+	if err != nil {
+		ds.logger.Error("failed to attach exec", zap.String("exec_id", execResp.ID), zap.Error(err))
+		return nil, err
+	}
+	return &ExecSession{ID: execResp.ID, client: ds.client, resp: attachResp}, nil
+}
+
+// Read returns terminal output
+func (e *ExecSession) Read(p []byte) (int, error) {
+	return e.resp.Reader.Read(p)
+}
+
+// Write sends keystrokes to the terminal
+func (e *ExecSession) Write(p []byte) (int, error) {
+	return e.resp.Conn.Write(p)
+}
+
+// Resize changes the terminal size, e.g. when the browser window is resized
+func (e *ExecSession) Resize(ctx context.Context, rows, cols uint) error {
+	return e.client.ContainerExecResize(ctx, e.ID, container.ResizeOptions{Height: rows, Width: cols})
+}
+
+// ExitCode returns the exit code of the command, or -1 while it is still running
+func (e *ExecSession) ExitCode(ctx context.Context) (int, error) {
+	inspect, err := e.client.ContainerExecInspect(ctx, e.ID)
+	if err != nil {
+		return -1, err
+	}
+	if inspect.Running {
+		return -1, nil
+	}
+	return inspect.ExitCode, nil
+}
+
+// Close detaches from the terminal; closing stdin ends an interactive shell
+func (e *ExecSession) Close() error {
+	e.resp.Close()
+	return nil
+}
+
 func (ds *dockerService) InspectContainer(ctx context.Context, containerID string) (*types.ContainerJSON, error) {
 	inspect, err := ds.client.ContainerInspect(ctx, containerID)
 	if err != nil {
@@ -363,6 +656,88 @@ func (ds *dockerService) InspectContainer(ctx context.Context, containerID strin
 	return &inspect, nil
 }
 
+// CommitContainer saves the filesystem of a container as an image. Volumes are not part of it.
+// The container is not paused for the commit; callers pause it themselves when they need a
+// consistent copy.
+func (ds *dockerService) CommitContainer(ctx context.Context, containerID, reference string, labels map[string]string) (string, error) {
+	resp, err := ds.client.ContainerCommit(ctx, containerID, container.CommitOptions{
+		Reference: reference,
+		Config:    &container.Config{Labels: labels},
+	})
+	if err != nil {
+		ds.logger.Error("failed to commit container", zap.String("container_id", containerID), zap.Error(err))
+		return "", err
+	}
+	ds.logger.Info("container committed", zap.String("container_id", containerID), zap.String("image", reference))
+	return resp.ID, nil
+}
+
+// RunContainer runs a one-off container to completion and removes it. It returns the output of
+// the container, and an error when it exits with a non-zero code.
+func (ds *dockerService) RunContainer(ctx context.Context, config ContainerConfig) (string, error) {
+	binds := []string{}
+	for hostPath, containerPath := range config.Volumes {
+		binds = append(binds, fmt.Sprintf("%s:%s", hostPath, containerPath))
+	}
+
+	resp, err := ds.client.ContainerCreate(ctx,
+		&container.Config{Image: config.Image, Env: config.Env, Cmd: config.Cmd, Labels: config.Labels},
+		&container.HostConfig{Binds: binds},
+		nil, nil, config.Name)
+	if err != nil {
+		ds.logger.Error("failed to create container", zap.Error(err))
+		return "", err
+	}
+	defer ds.client.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+
+	waitCh, errCh := ds.client.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
+	if err := ds.client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return "", err
+	}
+
+	var exitCode int64
+	select {
+	case result := <-waitCh:
+		exitCode = result.StatusCode
+	case err := <-errCh:
+		return "", err
+	}
+
+	logs, err := ds.client.ContainerLogs(ctx, resp.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return "", err
+	}
+	defer logs.Close()
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, logs); err != nil {
+		return "", err
+	}
+
+	if exitCode != 0 {
+		return stdout.String(), fmt.Errorf("%s exited with code %d: %s", config.Image, exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// InspectImage returns the details of a local image
+func (ds *dockerService) InspectImage(ctx context.Context, reference string) (*types.ImageInspect, error) {
+	inspect, _, err := ds.client.ImageInspectWithRaw(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	return &inspect, nil
+}
+
+// RemoveImage untags and deletes an image. Layers still used by containers are kept.
+func (ds *dockerService) RemoveImage(ctx context.Context, reference string) error {
+	if _, err := ds.client.ImageRemove(ctx, reference, types.ImageRemoveOptions{Force: true, PruneChildren: true}); err != nil {
+		ds.logger.Error("failed to remove image", zap.String("image", reference), zap.Error(err))
+		return err
+	}
+	ds.logger.Info("image removed", zap.String("image", reference))
+	return nil
+}
+
 func (ds *dockerService) CreateNetwork(ctx context.Context, networkName string) (string, error) {
 	filter := filters.NewArgs()
 	filter.Add("name", networkName)
@@ -397,6 +772,32 @@ func (ds *dockerService) RemoveNetwork(ctx context.Context, networkID string) er
 	return nil
 }
 
+// ConnectNetwork attaches a running container to an additional network
+func (ds *dockerService) ConnectNetwork(ctx context.Context, networkID, containerID string, aliases []string) error {
+	if err := ds.client.NetworkConnect(ctx, networkID, containerID, &network.EndpointSettings{Aliases: aliases}); err != nil {
+		ds.logger.Error("failed to connect container to network",
+			zap.String("network_id", networkID),
+			zap.String("container_id", containerID),
+			zap.Error(err))
+		return err
+	}
+	ds.logger.Info("container connected to network", zap.String("network_id", networkID), zap.String("container_id", containerID))
+	return nil
+}
+
+// DisconnectNetwork detaches a container from a network
+func (ds *dockerService) DisconnectNetwork(ctx context.Context, networkID, containerID string) error {
+	if err := ds.client.NetworkDisconnect(ctx, networkID, containerID, true); err != nil {
+		ds.logger.Error("failed to disconnect container from network",
+			zap.String("network_id", networkID),
+			zap.String("container_id", containerID),
+			zap.Error(err))
+		return err
+	}
+	ds.logger.Info("container disconnected from network", zap.String("network_id", networkID), zap.String("container_id", containerID))
+	return nil
+}
+
 func (ds *dockerService) CreateVolume(ctx context.Context, volumeName string) error {
 	filter := filters.NewArgs()
 	filter.Add("name", volumeName)
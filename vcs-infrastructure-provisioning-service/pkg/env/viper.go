@@ -1,6 +1,8 @@
 package env
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -12,12 +14,40 @@ type Env struct {
 	GRPCEnv     GRPCEnv
 	HTTPEnv     HTTPEnv
 	AuthEnv     AuthEnv
+	ACMEEnv     ACMEEnv
+	DinDEnv     DinDEnv
+	PKIEnv      PKIEnv
 }
 
 type AuthEnv struct {
 	JWTSecret string
 }
 
+// ACMEEnv holds the defaults for certificates issued over ACME
+type ACMEEnv struct {
+	DirectoryURL string
+	Email        string
+	CACertFile   string // Extra root CA for the ACME server, e.g. Pebble's test CA
+}
+
+// PKIEnv holds the secret private keys of issued certificates are encrypted with in the database
+type PKIEnv struct {
+	KeyEncryptionSecret string
+}
+
+// DinDEnv controls how expiring DinD environments are reaped, how long terminals may idle,
+// how much command history is kept and the registries shared by all environments
+type DinDEnv struct {
+	TTLWarningBefore    time.Duration // Warning event this long before an environment expires
+	TTLGracePeriod      time.Duration // Expired environments stay stopped this long before they are deleted
+	TerminalIdleTimeout time.Duration // Terminal sessions without input for this long are closed
+	HistoryRetention    time.Duration // Command history older than this is deleted
+	HistoryMaxEntries   int           // Command history kept per environment
+	RegistryEnabled     bool          // Run a pull-through mirror and a registry shared by DinD daemons
+	RegistryUpstream    string        // Registry the mirror caches
+	RegistrySecret      string        // Secret the registry password of each user is derived from
+}
+
 type PostgresEnv struct {
 	PostgresHost     string
 	PostgresPort     string
@@ -62,6 +92,15 @@ func LoadEnv() (*Env, error) {
 
 	viper.ReadInConfig()
 
+	viper.SetDefault("DIND_TTL_WARNING_BEFORE", "1h")
+	viper.SetDefault("DIND_TTL_GRACE_PERIOD", "24h")
+	viper.SetDefault("DIND_TERMINAL_IDLE_TIMEOUT", "15m")
+	viper.SetDefault("DIND_HISTORY_RETENTION", "720h")
+	viper.SetDefault("DIND_HISTORY_MAX_ENTRIES", 1000)
+	viper.SetDefault("DIND_REGISTRY_ENABLED", true)
+	viper.SetDefault("DIND_REGISTRY_UPSTREAM", "https://registry-1.docker.io")
+	viper.SetDefault("DIND_REGISTRY_SECRET", viper.GetString("PKI_KEY_ENCRYPTION_SECRET"))
+
 	return &Env{
 		PostgresEnv: PostgresEnv{
 			PostgresHost:     viper.GetString("POSTGRES_HOST"),
@@ -96,6 +135,24 @@ func LoadEnv() (*Env, error) {
 		AuthEnv: AuthEnv{
 			JWTSecret: viper.GetString("JWT_SECRET"),
 		},
+		ACMEEnv: ACMEEnv{
+			DirectoryURL: viper.GetString("ACME_DIRECTORY_URL"),
+			Email:        viper.GetString("ACME_EMAIL"),
+			CACertFile:   viper.GetString("ACME_CA_CERT_FILE"),
+		},
+		PKIEnv: PKIEnv{
+			KeyEncryptionSecret: viper.GetString("PKI_KEY_ENCRYPTION_SECRET"),
+		},
+		DinDEnv: DinDEnv{
+			TTLWarningBefore:    viper.GetDuration("DIND_TTL_WARNING_BEFORE"),
+			TTLGracePeriod:      viper.GetDuration("DIND_TTL_GRACE_PERIOD"),
+			TerminalIdleTimeout: viper.GetDuration("DIND_TERMINAL_IDLE_TIMEOUT"),
+			HistoryRetention:    viper.GetDuration("DIND_HISTORY_RETENTION"),
+			HistoryMaxEntries:   viper.GetInt("DIND_HISTORY_MAX_ENTRIES"),
+			RegistryEnabled:     viper.GetBool("DIND_REGISTRY_ENABLED"),
+			RegistryUpstream:    viper.GetString("DIND_REGISTRY_UPSTREAM"),
+			RegistrySecret:      viper.GetString("DIND_REGISTRY_SECRET"),
+		},
 	}, nil
 }
 
@@ -0,0 +1,16 @@
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactToken(t *testing.T) {
+	assert.Equal(t, "/api/v1/dind/environments/1/terminal?token=REDACTED",
+		RedactToken("/api/v1/dind/environments/1/terminal?token=eyJhbGciOi.eyJzdWIiOi.sig"))
+	assert.Equal(t, "/terminal?rows=40&token=REDACTED&cols=120",
+		RedactToken("/terminal?rows=40&token=abc&cols=120"))
+	assert.Equal(t, "/terminal?mytoken=abc", RedactToken("/terminal?mytoken=abc"))
+	assert.Equal(t, "/health", RedactToken("/health"))
+}
@@ -22,6 +22,11 @@ func NewJWTMiddleware(jwtSecret string) *JWTMiddleware {
 func (m *JWTMiddleware) CheckBearerAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		// Browsers cannot set headers on WebSocket or EventSource connections, so the token may come as a query parameter
+		streaming := strings.EqualFold(c.GetHeader("Upgrade"), "websocket") || strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+		if authHeader == "" && c.Query("token") != "" && streaming {
+			authHeader = "Bearer " + c.Query("token")
+		}
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
 			c.Abort()
@@ -0,0 +1,66 @@
+package pki
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// sealedPrefix marks a value encrypted by KeyCipher; anything else is a key stored before encryption
+const sealedPrefix = "enc:v1:"
+
+// KeyCipher encrypts private keys before they are stored, with AES-256-GCM under a key derived from a secret
+type KeyCipher struct {
+	aead cipher.AEAD
+}
+
+// NewKeyCipher derives the encryption key from secret
+func NewKeyCipher(secret string) (*KeyCipher, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("key encryption secret is empty")
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyCipher{aead: aead}, nil
+}
+
+// Seal encrypts a PEM private key for storage
+func (c *KeyCipher) Seal(keyPEM []byte) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, keyPEM, nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a stored private key. Keys stored before encryption was introduced are returned as they are.
+func (c *KeyCipher) Open(stored string) ([]byte, error) {
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		return []byte(stored), nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode private key: %w", err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted private key is truncated")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	keyPEM, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+	return keyPEM, nil
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"gorm.io/gorm"
+)
+
+type IChaosDrillRepository interface {
+	Create(drill *entities.ChaosDrill) error
+	Update(drill *entities.ChaosDrill) error
+	FindByID(id string) (*entities.ChaosDrill, error)
+	List(targetType, targetID string, limit int) ([]entities.ChaosDrill, error)
+	FindRunning(targetType, targetID string) (*entities.ChaosDrill, error)
+	ListRunning() ([]entities.ChaosDrill, error)
+}
+
+type chaosDrillRepository struct {
+	db *gorm.DB
+}
+
+func NewChaosDrillRepository(db *gorm.DB) IChaosDrillRepository {
+	return &chaosDrillRepository{db: db}
+}
+
+func (r *chaosDrillRepository) Create(drill *entities.ChaosDrill) error {
+	return r.db.Create(drill).Error
+}
+
+func (r *chaosDrillRepository) Update(drill *entities.ChaosDrill) error {
+	return r.db.Save(drill).Error
+}
+
+func (r *chaosDrillRepository) FindByID(id string) (*entities.ChaosDrill, error) {
+	var drill entities.ChaosDrill
+	err := r.db.First(&drill, "id = ?", id).Error
+	return &drill, err
+}
+
+func (r *chaosDrillRepository) List(targetType, targetID string, limit int) ([]entities.ChaosDrill, error) {
+	var drills []entities.ChaosDrill
+	query := r.db.Order("started_at DESC").Limit(limit)
+	if targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	err := query.Find(&drills).Error
+	return drills, err
+}
+
+func (r *chaosDrillRepository) FindRunning(targetType, targetID string) (*entities.ChaosDrill, error) {
+	var drill entities.ChaosDrill
+	err := r.db.Where("target_type = ? AND target_id = ? AND status = ?", targetType, targetID, "running").
+		First(&drill).Error
+	return &drill, err
+}
+
+func (r *chaosDrillRepository) ListRunning() ([]entities.ChaosDrill, error) {
+	var drills []entities.ChaosDrill
+	err := r.db.Find(&drills, "status = ?", "running").Error
+	return drills, err
+}
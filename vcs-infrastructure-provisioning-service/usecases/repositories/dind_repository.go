@@ -1,6 +1,9 @@
 package repositories
 
 import (
+	"strings"
+	"time"
+
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
 	"gorm.io/gorm"
 )
@@ -10,12 +13,40 @@ type IDinDRepository interface {
 	Update(env *entities.DinDEnvironment) error
 	Delete(id string) error
 	FindByID(id string) (*entities.DinDEnvironment, error)
+	ListAll() ([]entities.DinDEnvironment, error)
 	FindByInfrastructureID(infraID string) (*entities.DinDEnvironment, error)
 	FindByUserID(userID string) ([]entities.DinDEnvironment, error)
 	FindByContainerID(containerID string) (*entities.DinDEnvironment, error)
 	FindExpired() ([]entities.DinDEnvironment, error)
+	FindExpiring(before time.Time) ([]entities.DinDEnvironment, error)
+	MarkExpiryWarned(id string) error
 	CreateCommandHistory(history *entities.DinDCommandHistory) error
 	GetCommandHistory(environmentID string, limit int) ([]entities.DinDCommandHistory, error)
+	SearchCommandHistory(environmentID string, filter CommandHistoryFilter, limit, offset int) ([]entities.DinDCommandHistory, int64, error)
+	TrimCommandHistory(olderThan time.Time, keep int) (int64, error)
+	CreateTerminalSession(session *entities.DinDTerminalSession) error
+	UpdateTerminalSession(session *entities.DinDTerminalSession) error
+	FindTerminalSession(id string) (*entities.DinDTerminalSession, error)
+	ListTerminalSessions(environmentID string, limit int) ([]entities.DinDTerminalSession, error)
+	CreateJob(job *entities.DinDJob) error
+	UpdateJob(job *entities.DinDJob) error
+	FindJob(id string) (*entities.DinDJob, error)
+	ListJobs(environmentID string, limit int) ([]entities.DinDJob, error)
+	CreateSnapshot(snapshot *entities.DinDSnapshot) error
+	UpdateSnapshot(snapshot *entities.DinDSnapshot) error
+	DeleteSnapshot(id string) error
+	FindSnapshot(id string) (*entities.DinDSnapshot, error)
+	ListSnapshotsByEnvironment(environmentID string) ([]entities.DinDSnapshot, error)
+	ListSnapshotsByUser(userID string) ([]entities.DinDSnapshot, error)
+	ListSnapshotsByStatus(status string) ([]entities.DinDSnapshot, error)
+}
+
+// CommandHistoryFilter narrows down command history; zero values do not filter
+type CommandHistoryFilter struct {
+	ExitCode *int
+	Since    time.Time
+	Until    time.Time
+	Search   string // Full-text search over command and output
 }
 
 type dinDRepository struct {
@@ -37,6 +68,8 @@ func (r *dinDRepository) Update(env *entities.DinDEnvironment) error {
 func (r *dinDRepository) Delete(id string) error {
 	// Delete command history first
 	r.db.Where("environment_id = ?", id).Delete(&entities.DinDCommandHistory{})
+	r.db.Where("environment_id = ?", id).Delete(&entities.DinDTerminalSession{})
+	r.db.Where("environment_id = ?", id).Delete(&entities.DinDJob{})
 	return r.db.Delete(&entities.DinDEnvironment{}, "id = ?", id).Error
 }
 
@@ -49,6 +82,12 @@ func (r *dinDRepository) FindByID(id string) (*entities.DinDEnvironment, error)
 	return &env, nil
 }
 
+func (r *dinDRepository) ListAll() ([]entities.DinDEnvironment, error) {
+	var envs []entities.DinDEnvironment
+	err := r.db.Find(&envs).Error
+	return envs, err
+}
+
 func (r *dinDRepository) FindByInfrastructureID(infraID string) (*entities.DinDEnvironment, error) {
 	var env entities.DinDEnvironment
 	err := r.db.Where("infrastructure_id = ?", infraID).First(&env).Error
@@ -79,6 +118,19 @@ func (r *dinDRepository) FindExpired() ([]entities.DinDEnvironment, error) {
 	return envs, err
 }
 
+// FindExpiring returns environments expiring before the given time that have not been warned yet
+func (r *dinDRepository) FindExpiring(before time.Time) ([]entities.DinDEnvironment, error) {
+	var envs []entities.DinDEnvironment
+	err := r.db.Where("auto_cleanup = ? AND expiry_warned = ? AND expires_at >= NOW() AND expires_at < ?", true, false, before).
+		Find(&envs).Error
+	return envs, err
+}
+
+// MarkExpiryWarned only touches the flag so an extension saved meanwhile is not overwritten
+func (r *dinDRepository) MarkExpiryWarned(id string) error {
+	return r.db.Model(&entities.DinDEnvironment{}).Where("id = ?", id).Update("expiry_warned", true).Error
+}
+
 func (r *dinDRepository) CreateCommandHistory(history *entities.DinDCommandHistory) error {
 	return r.db.Create(history).Error
 }
@@ -93,3 +145,168 @@ func (r *dinDRepository) GetCommandHistory(environmentID string, limit int) ([]e
 	return history, err
 }
 
+// commandHistorySearchVector is the text search document of a history entry. SearchCommandHistory
+// must use the exact expression of idx_dind_command_history_search for the index to be used.
+const commandHistorySearchVector = "to_tsvector('simple', command || ' ' || coalesce(output, ''))"
+
+// likeEscaper escapes the LIKE wildcards so that searches match them literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// MigrateDinDIndexes creates the indexes AutoMigrate cannot express, such as the GIN index
+// behind the command history text search
+func MigrateDinDIndexes(db *gorm.DB) error {
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_dind_command_history_search ON dind_command_history USING gin (" + commandHistorySearchVector + ")").Error
+}
+
+// SearchCommandHistory returns a page of matching history, newest first, with the total number of matches
+func (r *dinDRepository) SearchCommandHistory(environmentID string, filter CommandHistoryFilter, limit, offset int) ([]entities.DinDCommandHistory, int64, error) {
+	var history []entities.DinDCommandHistory
+	var count int64
+
+	query := r.db.Model(&entities.DinDCommandHistory{}).Where("environment_id = ?", environmentID)
+	if filter.ExitCode != nil {
+		query = query.Where("exit_code = ?", *filter.ExitCode)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("executed_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("executed_at < ?", filter.Until)
+	}
+	if filter.Search != "" {
+		// Word search via text search, plus a substring match on the command for flags and paths
+		query = query.Where("("+commandHistorySearchVector+" @@ websearch_to_tsquery('simple', ?) OR command ILIKE ?)",
+			filter.Search, "%"+likeEscaper.Replace(filter.Search)+"%")
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("executed_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&history).Error
+	return history, count, err
+}
+
+// TrimCommandHistory deletes history older than olderThan and, per environment, everything
+// beyond the newest keep entries. A zero olderThan or keep disables that limit.
+func (r *dinDRepository) TrimCommandHistory(olderThan time.Time, keep int) (int64, error) {
+	var deleted int64
+	if !olderThan.IsZero() {
+		result := r.db.Where("executed_at < ?", olderThan).Delete(&entities.DinDCommandHistory{})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		deleted = result.RowsAffected
+	}
+	if keep <= 0 {
+		return deleted, nil
+	}
+
+	result := r.db.Exec(`DELETE FROM dind_command_history WHERE id IN (
+		SELECT id FROM (
+			SELECT id, row_number() OVER (PARTITION BY environment_id ORDER BY executed_at DESC) AS position
+			FROM dind_command_history
+		) ranked WHERE position > ?
+	)`, keep)
+	return deleted + result.RowsAffected, result.Error
+}
+
+func (r *dinDRepository) CreateTerminalSession(session *entities.DinDTerminalSession) error {
+	return r.db.Create(session).Error
+}
+
+func (r *dinDRepository) UpdateTerminalSession(session *entities.DinDTerminalSession) error {
+	return r.db.Save(session).Error
+}
+
+func (r *dinDRepository) FindTerminalSession(id string) (*entities.DinDTerminalSession, error) {
+	var session entities.DinDTerminalSession
+	err := r.db.Where("id = ?", id).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListTerminalSessions returns the newest sessions first, without their transcripts
+func (r *dinDRepository) ListTerminalSessions(environmentID string, limit int) ([]entities.DinDTerminalSession, error) {
+	var sessions []entities.DinDTerminalSession
+	query := r.db.Omit("transcript").Where("environment_id = ?", environmentID).Order("started_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *dinDRepository) CreateJob(job *entities.DinDJob) error {
+	return r.db.Create(job).Error
+}
+
+// UpdateJob only updates an existing row, so a job finishing after its environment was deleted
+// is not stored again
+func (r *dinDRepository) UpdateJob(job *entities.DinDJob) error {
+	return r.db.Model(job).Select("*").Omit("created_at").Updates(job).Error
+}
+
+func (r *dinDRepository) FindJob(id string) (*entities.DinDJob, error) {
+	var job entities.DinDJob
+	err := r.db.Where("id = ?", id).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListJobs returns the newest jobs first, without their output
+func (r *dinDRepository) ListJobs(environmentID string, limit int) ([]entities.DinDJob, error) {
+	var jobs []entities.DinDJob
+	query := r.db.Omit("output").Where("environment_id = ?", environmentID).Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *dinDRepository) CreateSnapshot(snapshot *entities.DinDSnapshot) error {
+	return r.db.Create(snapshot).Error
+}
+
+func (r *dinDRepository) UpdateSnapshot(snapshot *entities.DinDSnapshot) error {
+	return r.db.Save(snapshot).Error
+}
+
+func (r *dinDRepository) DeleteSnapshot(id string) error {
+	return r.db.Delete(&entities.DinDSnapshot{}, "id = ?", id).Error
+}
+
+func (r *dinDRepository) FindSnapshot(id string) (*entities.DinDSnapshot, error) {
+	var snapshot entities.DinDSnapshot
+	err := r.db.Where("id = ?", id).First(&snapshot).Error
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (r *dinDRepository) ListSnapshotsByEnvironment(environmentID string) ([]entities.DinDSnapshot, error) {
+	var snapshots []entities.DinDSnapshot
+	err := r.db.Where("environment_id = ?", environmentID).Order("created_at DESC").Find(&snapshots).Error
+	return snapshots, err
+}
+
+func (r *dinDRepository) ListSnapshotsByUser(userID string) ([]entities.DinDSnapshot, error) {
+	var snapshots []entities.DinDSnapshot
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&snapshots).Error
+	return snapshots, err
+}
+
+func (r *dinDRepository) ListSnapshotsByStatus(status string) ([]entities.DinDSnapshot, error) {
+	var snapshots []entities.DinDSnapshot
+	err := r.db.Where("status = ?", status).Find(&snapshots).Error
+	return snapshots, err
+}
+
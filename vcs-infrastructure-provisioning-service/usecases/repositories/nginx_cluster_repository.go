@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"time"
+
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
 	"gorm.io/gorm"
 )
@@ -36,6 +38,45 @@ type INginxClusterRepository interface {
 	UpdateUpstreamServer(server *entities.NginxUpstreamServer) error
 	DeleteUpstreamServer(id string) error
 	DeleteUpstreamServersByUpstreamID(upstreamID string) error
+	UpdateUpstreamServerHealth(server *entities.NginxUpstreamServer) error
+
+	// Upstream health event operations
+	CreateUpstreamHealthEvent(event *entities.NginxUpstreamHealthEvent) error
+	ListUpstreamHealthEvents(upstreamID string, limit int) ([]entities.NginxUpstreamHealthEvent, error)
+	DeleteUpstreamHealthEventsBefore(before time.Time) error
+
+	// Access policy operations
+	CreateAccessPolicy(policy *entities.NginxAccessPolicy) error
+	FindAccessPolicyByID(id string) (*entities.NginxAccessPolicy, error)
+	FindAccessPolicyByScope(serverBlockID, locationID string) (*entities.NginxAccessPolicy, error)
+	ListAccessPolicies(clusterID string) ([]entities.NginxAccessPolicy, error)
+	UpdateAccessPolicy(policy *entities.NginxAccessPolicy) error
+	DeleteAccessPolicy(id string) error
+
+	// Basic auth user operations
+	CreateBasicAuthUser(user *entities.NginxBasicAuthUser) error
+	FindBasicAuthUser(policyID, username string) (*entities.NginxBasicAuthUser, error)
+	ListBasicAuthUsers(policyID string) ([]entities.NginxBasicAuthUser, error)
+	UpdateBasicAuthUser(user *entities.NginxBasicAuthUser) error
+	DeleteBasicAuthUser(id string) error
+	DeleteBasicAuthUsersByPolicyID(policyID string) error
+
+	// Stream proxy operations
+	CreateStreamProxy(stream *entities.NginxStreamProxy) error
+	FindStreamProxyByID(id string) (*entities.NginxStreamProxy, error)
+	ListStreamProxies(clusterID string) ([]entities.NginxStreamProxy, error)
+	UpdateStreamProxy(stream *entities.NginxStreamProxy) error
+	DeleteStreamProxy(id string) error
+	CreateStreamServer(server *entities.NginxStreamServer) error
+	ListStreamServers(streamID string) ([]entities.NginxStreamServer, error)
+	DeleteStreamServersByStreamID(streamID string) error
+
+	// Stream port operations
+	CreateStreamPort(port *entities.NginxStreamPort) error
+	ListStreamPorts() ([]entities.NginxStreamPort, error)
+	ListStreamPortsByNode(nodeID string) ([]entities.NginxStreamPort, error)
+	DeleteStreamPortsByStreamID(streamID string) error
+	DeleteStreamPortsByNodeID(nodeID string) error
 
 	// Server block operations
 	CreateServerBlock(block *entities.NginxServerBlock) error
@@ -55,6 +96,40 @@ type INginxClusterRepository interface {
 	// Failover event operations
 	CreateFailoverEvent(event *entities.NginxFailoverEvent) error
 	ListFailoverEvents(clusterID string) ([]entities.NginxFailoverEvent, error)
+
+	// Operations
+	CreateOperation(op *entities.NginxClusterOperation) error
+	UpdateOperation(op *entities.NginxClusterOperation) error
+	FindOperationByID(id string) (*entities.NginxClusterOperation, error)
+	ListOperations(clusterID string) ([]entities.NginxClusterOperation, error)
+	FindRunningOperation(clusterID, opType string) (*entities.NginxClusterOperation, error)
+	ListRunningOperations() ([]entities.NginxClusterOperation, error)
+
+	// Config revision operations
+	CreateConfigRevision(revision *entities.NginxConfigRevision) error
+	UpdateConfigRevision(revision *entities.NginxConfigRevision) error
+	FindConfigRevision(clusterID string, revision int) (*entities.NginxConfigRevision, error)
+	FindLatestConfigRevision(clusterID string) (*entities.NginxConfigRevision, error)
+	ListConfigRevisions(clusterID string, limit int) ([]entities.NginxConfigRevision, error)
+
+	// Traffic policy revision operations
+	CreateTrafficPolicyRevision(revision *entities.NginxTrafficPolicyRevision) error
+	FindTrafficPolicyRevision(locationID string, version int) (*entities.NginxTrafficPolicyRevision, error)
+	ListTrafficPolicyRevisions(locationID string, limit int) ([]entities.NginxTrafficPolicyRevision, error)
+
+	// Metric sample operations
+	CreateMetricSample(sample *entities.NginxMetricSample) error
+	FindLatestMetricSample(nodeID string) (*entities.NginxMetricSample, error)
+	ListMetricSamples(clusterID, nodeID string, from, to time.Time, limit int) ([]entities.NginxMetricSample, error)
+	DeleteMetricSamplesBefore(before time.Time) error
+
+	// Certificate operations
+	CreateCertificate(cert *entities.NginxCertificate) error
+	FindCertificateByID(id string) (*entities.NginxCertificate, error)
+	ListCertificates(clusterID string) ([]entities.NginxCertificate, error)
+	ListAutoRenewCertificates(before time.Time) ([]entities.NginxCertificate, error)
+	UpdateCertificate(cert *entities.NginxCertificate) error
+	DeleteCertificate(id string) error
 }
 
 type nginxClusterRepository struct {
@@ -180,6 +255,162 @@ func (r *nginxClusterRepository) DeleteUpstreamServersByUpstreamID(upstreamID st
 	return r.db.Delete(&entities.NginxUpstreamServer{}, "upstream_id = ?", upstreamID).Error
 }
 
+// UpdateUpstreamServerHealth only updates the health columns, so a server deleted meanwhile is not recreated
+func (r *nginxClusterRepository) UpdateUpstreamServerHealth(server *entities.NginxUpstreamServer) error {
+	return r.db.Model(&entities.NginxUpstreamServer{}).Where("id = ?", server.ID).Updates(map[string]interface{}{
+		"is_down":               server.IsDown,
+		"health_status":         server.HealthStatus,
+		"consecutive_failures":  server.ConsecutiveFailures,
+		"consecutive_successes": server.ConsecutiveSuccesses,
+		"last_checked_at":       server.LastCheckedAt,
+		"last_error":            server.LastError,
+	}).Error
+}
+
+// ================== Upstream Health Event Operations ==================
+
+func (r *nginxClusterRepository) CreateUpstreamHealthEvent(event *entities.NginxUpstreamHealthEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *nginxClusterRepository) ListUpstreamHealthEvents(upstreamID string, limit int) ([]entities.NginxUpstreamHealthEvent, error) {
+	var events []entities.NginxUpstreamHealthEvent
+	err := r.db.Where("upstream_id = ?", upstreamID).Order("occurred_at DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (r *nginxClusterRepository) DeleteUpstreamHealthEventsBefore(before time.Time) error {
+	return r.db.Delete(&entities.NginxUpstreamHealthEvent{}, "occurred_at < ?", before).Error
+}
+
+// ================== Access Policy Operations ==================
+
+func (r *nginxClusterRepository) CreateAccessPolicy(policy *entities.NginxAccessPolicy) error {
+	return r.db.Create(policy).Error
+}
+
+func (r *nginxClusterRepository) FindAccessPolicyByID(id string) (*entities.NginxAccessPolicy, error) {
+	var policy entities.NginxAccessPolicy
+	err := r.db.First(&policy, "id = ?", id).Error
+	return &policy, err
+}
+
+func (r *nginxClusterRepository) FindAccessPolicyByScope(serverBlockID, locationID string) (*entities.NginxAccessPolicy, error) {
+	var policy entities.NginxAccessPolicy
+	err := r.db.First(&policy, "server_block_id = ? AND location_id = ?", serverBlockID, locationID).Error
+	return &policy, err
+}
+
+func (r *nginxClusterRepository) ListAccessPolicies(clusterID string) ([]entities.NginxAccessPolicy, error) {
+	var policies []entities.NginxAccessPolicy
+	err := r.db.Where("cluster_id = ?", clusterID).Order("created_at ASC").Find(&policies).Error
+	return policies, err
+}
+
+func (r *nginxClusterRepository) UpdateAccessPolicy(policy *entities.NginxAccessPolicy) error {
+	return r.db.Save(policy).Error
+}
+
+func (r *nginxClusterRepository) DeleteAccessPolicy(id string) error {
+	return r.db.Delete(&entities.NginxAccessPolicy{}, "id = ?", id).Error
+}
+
+// ================== Basic Auth User Operations ==================
+
+func (r *nginxClusterRepository) CreateBasicAuthUser(user *entities.NginxBasicAuthUser) error {
+	return r.db.Create(user).Error
+}
+
+func (r *nginxClusterRepository) FindBasicAuthUser(policyID, username string) (*entities.NginxBasicAuthUser, error) {
+	var user entities.NginxBasicAuthUser
+	err := r.db.First(&user, "policy_id = ? AND username = ?", policyID, username).Error
+	return &user, err
+}
+
+func (r *nginxClusterRepository) ListBasicAuthUsers(policyID string) ([]entities.NginxBasicAuthUser, error) {
+	var users []entities.NginxBasicAuthUser
+	err := r.db.Where("policy_id = ?", policyID).Order("username ASC").Find(&users).Error
+	return users, err
+}
+
+func (r *nginxClusterRepository) UpdateBasicAuthUser(user *entities.NginxBasicAuthUser) error {
+	return r.db.Save(user).Error
+}
+
+func (r *nginxClusterRepository) DeleteBasicAuthUser(id string) error {
+	return r.db.Delete(&entities.NginxBasicAuthUser{}, "id = ?", id).Error
+}
+
+func (r *nginxClusterRepository) DeleteBasicAuthUsersByPolicyID(policyID string) error {
+	return r.db.Delete(&entities.NginxBasicAuthUser{}, "policy_id = ?", policyID).Error
+}
+
+// ================== Stream Proxy Operations ==================
+
+func (r *nginxClusterRepository) CreateStreamProxy(stream *entities.NginxStreamProxy) error {
+	return r.db.Create(stream).Error
+}
+
+func (r *nginxClusterRepository) FindStreamProxyByID(id string) (*entities.NginxStreamProxy, error) {
+	var stream entities.NginxStreamProxy
+	err := r.db.First(&stream, "id = ?", id).Error
+	return &stream, err
+}
+
+func (r *nginxClusterRepository) ListStreamProxies(clusterID string) ([]entities.NginxStreamProxy, error) {
+	var streams []entities.NginxStreamProxy
+	err := r.db.Where("cluster_id = ?", clusterID).Order("listen_port ASC").Find(&streams).Error
+	return streams, err
+}
+
+func (r *nginxClusterRepository) UpdateStreamProxy(stream *entities.NginxStreamProxy) error {
+	return r.db.Save(stream).Error
+}
+
+func (r *nginxClusterRepository) DeleteStreamProxy(id string) error {
+	return r.db.Delete(&entities.NginxStreamProxy{}, "id = ?", id).Error
+}
+
+func (r *nginxClusterRepository) CreateStreamServer(server *entities.NginxStreamServer) error {
+	return r.db.Create(server).Error
+}
+
+func (r *nginxClusterRepository) ListStreamServers(streamID string) ([]entities.NginxStreamServer, error) {
+	var servers []entities.NginxStreamServer
+	err := r.db.Find(&servers, "stream_id = ?", streamID).Error
+	return servers, err
+}
+
+func (r *nginxClusterRepository) DeleteStreamServersByStreamID(streamID string) error {
+	return r.db.Delete(&entities.NginxStreamServer{}, "stream_id = ?", streamID).Error
+}
+
+// ================== Stream Port Operations ==================
+
+func (r *nginxClusterRepository) CreateStreamPort(port *entities.NginxStreamPort) error {
+	return r.db.Create(port).Error
+}
+
+func (r *nginxClusterRepository) ListStreamPorts() ([]entities.NginxStreamPort, error) {
+	var ports []entities.NginxStreamPort
+	err := r.db.Find(&ports).Error
+	return ports, err
+}
+
+func (r *nginxClusterRepository) ListStreamPortsByNode(nodeID string) ([]entities.NginxStreamPort, error) {
+	var ports []entities.NginxStreamPort
+	err := r.db.Find(&ports, "node_id = ?", nodeID).Error
+	return ports, err
+}
+
+func (r *nginxClusterRepository) DeleteStreamPortsByStreamID(streamID string) error {
+	return r.db.Delete(&entities.NginxStreamPort{}, "stream_id = ?", streamID).Error
+}
+
+func (r *nginxClusterRepository) DeleteStreamPortsByNodeID(nodeID string) error {
+	return r.db.Delete(&entities.NginxStreamPort{}, "node_id = ?", nodeID).Error
+}
+
 // ================== Server Block Operations ==================
 
 func (r *nginxClusterRepository) CreateServerBlock(block *entities.NginxServerBlock) error {
@@ -247,3 +478,160 @@ func (r *nginxClusterRepository) ListFailoverEvents(clusterID string) ([]entitie
 	err := r.db.Order("occurred_at DESC").Find(&events, "cluster_id = ?", clusterID).Error
 	return events, err
 }
+
+// ================== Cluster Operations ==================
+
+func (r *nginxClusterRepository) CreateOperation(op *entities.NginxClusterOperation) error {
+	return r.db.Create(op).Error
+}
+
+func (r *nginxClusterRepository) UpdateOperation(op *entities.NginxClusterOperation) error {
+	return r.db.Save(op).Error
+}
+
+func (r *nginxClusterRepository) FindOperationByID(id string) (*entities.NginxClusterOperation, error) {
+	var op entities.NginxClusterOperation
+	err := r.db.First(&op, "id = ?", id).Error
+	return &op, err
+}
+
+func (r *nginxClusterRepository) ListOperations(clusterID string) ([]entities.NginxClusterOperation, error) {
+	var ops []entities.NginxClusterOperation
+	err := r.db.Order("started_at DESC").Find(&ops, "cluster_id = ?", clusterID).Error
+	return ops, err
+}
+
+func (r *nginxClusterRepository) FindRunningOperation(clusterID, opType string) (*entities.NginxClusterOperation, error) {
+	var op entities.NginxClusterOperation
+	err := r.db.First(&op, "cluster_id = ? AND operation_type = ? AND status = ?", clusterID, opType, "running").Error
+	if err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+func (r *nginxClusterRepository) ListRunningOperations() ([]entities.NginxClusterOperation, error) {
+	var ops []entities.NginxClusterOperation
+	err := r.db.Find(&ops, "status = ?", "running").Error
+	return ops, err
+}
+
+// ================== Config Revision Operations ==================
+
+func (r *nginxClusterRepository) CreateConfigRevision(revision *entities.NginxConfigRevision) error {
+	return r.db.Create(revision).Error
+}
+
+func (r *nginxClusterRepository) UpdateConfigRevision(revision *entities.NginxConfigRevision) error {
+	return r.db.Save(revision).Error
+}
+
+func (r *nginxClusterRepository) FindConfigRevision(clusterID string, revision int) (*entities.NginxConfigRevision, error) {
+	var rev entities.NginxConfigRevision
+	err := r.db.First(&rev, "cluster_id = ? AND revision = ?", clusterID, revision).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+func (r *nginxClusterRepository) FindLatestConfigRevision(clusterID string) (*entities.NginxConfigRevision, error) {
+	var rev entities.NginxConfigRevision
+	err := r.db.Order("revision DESC").First(&rev, "cluster_id = ?", clusterID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// ListConfigRevisions returns revisions newest first without their config and diff bodies
+func (r *nginxClusterRepository) ListConfigRevisions(clusterID string, limit int) ([]entities.NginxConfigRevision, error) {
+	var revisions []entities.NginxConfigRevision
+	query := r.db.Omit("config", "diff").Order("revision DESC").Where("cluster_id = ?", clusterID)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&revisions).Error
+	return revisions, err
+}
+
+// ================== Traffic Policy Revision Operations ==================
+
+func (r *nginxClusterRepository) CreateTrafficPolicyRevision(revision *entities.NginxTrafficPolicyRevision) error {
+	return r.db.Create(revision).Error
+}
+
+func (r *nginxClusterRepository) FindTrafficPolicyRevision(locationID string, version int) (*entities.NginxTrafficPolicyRevision, error) {
+	var revision entities.NginxTrafficPolicyRevision
+	err := r.db.First(&revision, "location_id = ? AND version = ?", locationID, version).Error
+	return &revision, err
+}
+
+func (r *nginxClusterRepository) ListTrafficPolicyRevisions(locationID string, limit int) ([]entities.NginxTrafficPolicyRevision, error) {
+	var revisions []entities.NginxTrafficPolicyRevision
+	err := r.db.Where("location_id = ?", locationID).Order("version DESC").Limit(limit).Find(&revisions).Error
+	return revisions, err
+}
+
+// ================== Metric Sample Operations ==================
+
+func (r *nginxClusterRepository) CreateMetricSample(sample *entities.NginxMetricSample) error {
+	return r.db.Create(sample).Error
+}
+
+func (r *nginxClusterRepository) FindLatestMetricSample(nodeID string) (*entities.NginxMetricSample, error) {
+	var sample entities.NginxMetricSample
+	err := r.db.Where("node_id = ?", nodeID).Order("collected_at DESC").First(&sample).Error
+	return &sample, err
+}
+
+// ListMetricSamples returns the samples of a cluster in a time range, newest first; nodeID is optional
+func (r *nginxClusterRepository) ListMetricSamples(clusterID, nodeID string, from, to time.Time, limit int) ([]entities.NginxMetricSample, error) {
+	var samples []entities.NginxMetricSample
+	query := r.db.Where("cluster_id = ? AND collected_at >= ? AND collected_at <= ?", clusterID, from, to)
+	if nodeID != "" {
+		query = query.Where("node_id = ?", nodeID)
+	}
+	err := query.Order("collected_at DESC").Limit(limit).Find(&samples).Error
+	return samples, err
+}
+
+func (r *nginxClusterRepository) DeleteMetricSamplesBefore(before time.Time) error {
+	return r.db.Delete(&entities.NginxMetricSample{}, "collected_at < ?", before).Error
+}
+
+// ================== Certificate Operations ==================
+
+func (r *nginxClusterRepository) CreateCertificate(cert *entities.NginxCertificate) error {
+	return r.db.Create(cert).Error
+}
+
+func (r *nginxClusterRepository) FindCertificateByID(id string) (*entities.NginxCertificate, error) {
+	var cert entities.NginxCertificate
+	err := r.db.First(&cert, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func (r *nginxClusterRepository) ListCertificates(clusterID string) ([]entities.NginxCertificate, error) {
+	var certs []entities.NginxCertificate
+	err := r.db.Order("created_at ASC").Find(&certs, "cluster_id = ?", clusterID).Error
+	return certs, err
+}
+
+// ListAutoRenewCertificates returns active auto-renewing certificates that expire before the given time
+func (r *nginxClusterRepository) ListAutoRenewCertificates(before time.Time) ([]entities.NginxCertificate, error) {
+	var certs []entities.NginxCertificate
+	err := r.db.Where("auto_renew = ? AND status = ? AND not_after < ?", true, "active", before).Find(&certs).Error
+	return certs, err
+}
+
+func (r *nginxClusterRepository) UpdateCertificate(cert *entities.NginxCertificate) error {
+	return r.db.Save(cert).Error
+}
+
+func (r *nginxClusterRepository) DeleteCertificate(id string) error {
+	return r.db.Delete(&entities.NginxCertificate{}, "id = ?", id).Error
+}
@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"time"
+
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
 	"gorm.io/gorm"
 )
@@ -22,6 +24,24 @@ type IPostgreSQLClusterRepository interface {
 	// Failover events
 	CreateFailoverEvent(event *entities.FailoverEvent) error
 	ListFailoverEvents(clusterID string) ([]entities.FailoverEvent, error)
+	// Operations
+	CreateOperation(op *entities.ClusterOperation) error
+	UpdateOperation(op *entities.ClusterOperation) error
+	FindOperationByID(id string) (*entities.ClusterOperation, error)
+	ListOperations(clusterID string) ([]entities.ClusterOperation, error)
+	FindRunningOperation(clusterID string) (*entities.ClusterOperation, error)
+	ListRunningOperations() ([]entities.ClusterOperation, error)
+	// Query snapshots
+	CreateQuerySnapshot(snapshot *entities.QuerySnapshot) error
+	FindQuerySnapshotByID(id string) (*entities.QuerySnapshot, error)
+	ListQuerySnapshots(clusterID string, limit int) ([]entities.QuerySnapshot, error)
+	DeleteQuerySnapshotsBefore(before time.Time) (int64, error)
+	ListAll() ([]entities.PostgreSQLCluster, error)
+	// TLS certificates
+	FindCertificateAuthority(name string) (*entities.CertificateAuthority, error)
+	CreateCertificateAuthority(ca *entities.CertificateAuthority) error
+	CreateNodeCertificate(cert *entities.NodeCertificate) error
+	FindLatestNodeCertificate(nodeID string) (*entities.NodeCertificate, error)
 }
 
 type postgreSQLClusterRepository struct {
@@ -103,3 +123,86 @@ func (r *postgreSQLClusterRepository) ListFailoverEvents(clusterID string) ([]en
 	err := r.db.Order("occurred_at DESC").Find(&events, "cluster_id = ?", clusterID).Error
 	return events, err
 }
+
+func (r *postgreSQLClusterRepository) CreateOperation(op *entities.ClusterOperation) error {
+	return r.db.Create(op).Error
+}
+
+func (r *postgreSQLClusterRepository) UpdateOperation(op *entities.ClusterOperation) error {
+	return r.db.Save(op).Error
+}
+
+func (r *postgreSQLClusterRepository) FindOperationByID(id string) (*entities.ClusterOperation, error) {
+	var op entities.ClusterOperation
+	err := r.db.First(&op, "id = ?", id).Error
+	return &op, err
+}
+
+func (r *postgreSQLClusterRepository) ListOperations(clusterID string) ([]entities.ClusterOperation, error) {
+	var ops []entities.ClusterOperation
+	err := r.db.Order("started_at DESC").Find(&ops, "cluster_id = ?", clusterID).Error
+	return ops, err
+}
+
+func (r *postgreSQLClusterRepository) FindRunningOperation(clusterID string) (*entities.ClusterOperation, error) {
+	var op entities.ClusterOperation
+	err := r.db.First(&op, "cluster_id = ? AND status = ?", clusterID, "running").Error
+	if err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+func (r *postgreSQLClusterRepository) ListRunningOperations() ([]entities.ClusterOperation, error) {
+	var ops []entities.ClusterOperation
+	err := r.db.Find(&ops, "status = ?", "running").Error
+	return ops, err
+}
+
+func (r *postgreSQLClusterRepository) CreateQuerySnapshot(snapshot *entities.QuerySnapshot) error {
+	return r.db.Create(snapshot).Error
+}
+
+func (r *postgreSQLClusterRepository) FindQuerySnapshotByID(id string) (*entities.QuerySnapshot, error) {
+	var snapshot entities.QuerySnapshot
+	err := r.db.First(&snapshot, "id = ?", id).Error
+	return &snapshot, err
+}
+
+func (r *postgreSQLClusterRepository) ListQuerySnapshots(clusterID string, limit int) ([]entities.QuerySnapshot, error) {
+	var snapshots []entities.QuerySnapshot
+	err := r.db.Select("id", "cluster_id", "label", "source", "node_id", "captured_at").
+		Order("captured_at DESC").Limit(limit).Find(&snapshots, "cluster_id = ?", clusterID).Error
+	return snapshots, err
+}
+
+func (r *postgreSQLClusterRepository) DeleteQuerySnapshotsBefore(before time.Time) (int64, error) {
+	result := r.db.Where("source = ? AND captured_at < ?", "scheduled", before).Delete(&entities.QuerySnapshot{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *postgreSQLClusterRepository) ListAll() ([]entities.PostgreSQLCluster, error) {
+	var clusters []entities.PostgreSQLCluster
+	err := r.db.Preload("Infrastructure").Find(&clusters).Error
+	return clusters, err
+}
+
+func (r *postgreSQLClusterRepository) FindCertificateAuthority(name string) (*entities.CertificateAuthority, error) {
+	var ca entities.CertificateAuthority
+	err := r.db.First(&ca, "name = ?", name).Error
+	return &ca, err
+}
+
+func (r *postgreSQLClusterRepository) CreateCertificateAuthority(ca *entities.CertificateAuthority) error {
+	return r.db.Create(ca).Error
+}
+
+func (r *postgreSQLClusterRepository) CreateNodeCertificate(cert *entities.NodeCertificate) error {
+	return r.db.Create(cert).Error
+}
+
+func (r *postgreSQLClusterRepository) FindLatestNodeCertificate(nodeID string) (*entities.NodeCertificate, error) {
+	var cert entities.NodeCertificate
+	err := r.db.Order("created_at DESC").First(&cert, "node_id = ?", nodeID).Error
+	return &cert, err
+}
@@ -0,0 +1,920 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	drillProbeInterval   = 1 * time.Second
+	drillRecoveryTimeout = 2 * time.Minute
+	drillProbeTable      = "iaas_chaos_probe"
+	drillFillReserveMB   = 64
+	drillFillMaxMB       = 10240
+)
+
+type IChaosDrillService interface {
+	RunDrill(ctx context.Context, userID string, req dto.RunChaosDrillRequest) (*dto.ChaosDrillInfo, error)
+	GetDrill(ctx context.Context, drillID string) (*dto.ChaosDrillInfo, error)
+	ListDrills(ctx context.Context, targetType, targetID string, limit int) ([]dto.ChaosDrillInfo, error)
+	RecoverDrills(ctx context.Context)
+}
+
+type chaosDrillService struct {
+	drillRepo   repositories.IChaosDrillRepository
+	clusterRepo repositories.IPostgreSQLClusterRepository
+	nginxRepo   repositories.INginxClusterRepository
+	stackRepo   repositories.IStackRepository
+	dockerSvc   docker.IDockerService
+	logger      logger.ILogger
+}
+
+func NewChaosDrillService(
+	drillRepo repositories.IChaosDrillRepository,
+	clusterRepo repositories.IPostgreSQLClusterRepository,
+	nginxRepo repositories.INginxClusterRepository,
+	stackRepo repositories.IStackRepository,
+	dockerSvc docker.IDockerService,
+	logger logger.ILogger,
+) IChaosDrillService {
+	return &chaosDrillService{
+		drillRepo:   drillRepo,
+		clusterRepo: clusterRepo,
+		nginxRepo:   nginxRepo,
+		stackRepo:   stackRepo,
+		dockerSvc:   dockerSvc,
+		logger:      logger,
+	}
+}
+
+// drillNode is a cluster node as seen by a drill, independent of the cluster type
+type drillNode struct {
+	ID          string
+	Name        string
+	ContainerID string
+}
+
+// drillRun holds the state of one drill; the cluster-specific parts are plugged in as functions
+type drillRun struct {
+	drill     *entities.ChaosDrill
+	req       dto.RunChaosDrillRequest
+	networkID string
+	target    drillNode
+	oldLeader drillNode
+	nodes     map[string]drillNode
+	injected  time.Time
+	report    dto.ChaosDrillReport
+	probes    probeTracker
+
+	// setup prepares the cluster for probing before the baseline probe
+	setup func(ctx context.Context) error
+	// currentLeader returns the node ID holding the leader (postgres) or master (nginx) role
+	currentLeader func(ctx context.Context) (string, error)
+	// probe sends one write (postgres) or HTTP request (nginx) through the cluster entry point
+	probe func(ctx context.Context, seq int) bool
+	// targetHealthy reports whether the faulted node is serving again
+	targetHealthy func(ctx context.Context) bool
+	// finish runs cluster-specific checks after recovery
+	finish func(ctx context.Context) error
+	// teardown removes what setup created, whether or not the drill succeeded
+	teardown func(ctx context.Context)
+}
+
+func (r *drillRun) event(format string, args ...interface{}) {
+	offset := 0.0
+	if !r.injected.IsZero() {
+		offset = roundSeconds(time.Since(r.injected))
+	}
+	r.report.Timeline = append(r.report.Timeline, dto.DrillTimelineEvent{
+		OffsetSeconds: offset,
+		Event:         fmt.Sprintf(format, args...),
+	})
+}
+
+// probeTracker turns once-per-second probe results into availability figures
+type probeTracker struct {
+	attempts     int
+	succeeded    int
+	outageStart  time.Time
+	longest      time.Duration
+	firstFailure *float64
+	recovered    *float64
+}
+
+func (p *probeTracker) record(ok bool, at, injected time.Time) {
+	p.attempts++
+	if ok {
+		p.succeeded++
+		if !p.outageStart.IsZero() {
+			if outage := at.Sub(p.outageStart); outage > p.longest {
+				p.longest = outage
+			}
+			p.outageStart = time.Time{}
+			if p.recovered == nil {
+				seconds := roundSeconds(at.Sub(injected))
+				p.recovered = &seconds
+			}
+		}
+		return
+	}
+	if p.outageStart.IsZero() {
+		p.outageStart = at
+	}
+	if p.firstFailure == nil {
+		seconds := roundSeconds(at.Sub(injected))
+		p.firstFailure = &seconds
+	}
+}
+
+func (p *probeTracker) summary(end time.Time) dto.ProbeAvailability {
+	longest := p.longest
+	if !p.outageStart.IsZero() && end.Sub(p.outageStart) > longest {
+		longest = end.Sub(p.outageStart)
+	}
+	availability := dto.ProbeAvailability{
+		Attempts:             p.attempts,
+		Succeeded:            p.succeeded,
+		LongestOutageSeconds: roundSeconds(longest),
+		FirstFailureSeconds:  p.firstFailure,
+		RecoveredSeconds:     p.recovered,
+	}
+	if p.attempts > 0 {
+		availability.AvailabilityPercent = float64(int(float64(p.succeeded)/float64(p.attempts)*10000)) / 100
+	}
+	return availability
+}
+
+// RunDrill validates the scenario, refuses prod stacks unless forced and runs the drill in the background
+func (s *chaosDrillService) RunDrill(ctx context.Context, userID string, req dto.RunChaosDrillRequest) (*dto.ChaosDrillInfo, error) {
+	if req.DurationSeconds == 0 {
+		req.DurationSeconds = 30
+	}
+	if req.Scenario == "fill_disk" && req.TargetType != "postgres" {
+		return nil, fmt.Errorf("fill_disk is only supported for postgres clusters")
+	}
+	if req.Scenario == "fill_disk" && req.FillMB <= 0 {
+		return nil, fmt.Errorf("fill_mb is required for fill_disk")
+	}
+	if _, err := s.drillRepo.FindRunning(req.TargetType, req.TargetID); err == nil {
+		return nil, fmt.Errorf("a drill is already running on %s cluster %s", req.TargetType, req.TargetID)
+	}
+
+	drill := &entities.ChaosDrill{
+		ID:              uuid.New().String(),
+		TargetType:      req.TargetType,
+		TargetID:        req.TargetID,
+		Scenario:        req.Scenario,
+		Status:          "running",
+		DurationSeconds: req.DurationSeconds,
+		UserID:          userID,
+	}
+	run := &drillRun{drill: drill, req: req, nodes: map[string]drillNode{}}
+
+	var infraID string
+	var err error
+	switch req.TargetType {
+	case "postgres":
+		infraID, err = s.preparePostgresDrill(ctx, run)
+	case "nginx":
+		infraID, err = s.prepareNginxDrill(ctx, run)
+	default:
+		err = fmt.Errorf("unsupported target type: %s", req.TargetType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.isProdInfrastructure(infraID) {
+		if !req.Force {
+			return nil, fmt.Errorf("cluster belongs to a prod stack, set force to run the drill anyway")
+		}
+		drill.Forced = true
+	}
+
+	drill.TargetNodeID = run.target.ID
+	if err := s.drillRepo.Create(drill); err != nil {
+		return nil, fmt.Errorf("failed to save drill: %w", err)
+	}
+	s.logger.Info("chaos drill started",
+		zap.String("drill_id", drill.ID),
+		zap.String("target_type", req.TargetType),
+		zap.String("target_id", req.TargetID),
+		zap.String("scenario", req.Scenario),
+		zap.String("node_id", run.target.ID),
+		zap.Bool("forced", drill.Forced))
+
+	go func() {
+		bgCtx, cancel := context.WithTimeout(context.Background(), time.Duration(req.DurationSeconds)*time.Second+10*time.Minute)
+		defer cancel()
+		s.finishDrill(run, s.runDrill(bgCtx, run))
+	}()
+
+	return toChaosDrillDTO(drill), nil
+}
+
+// GetDrill returns a drill with its report
+func (s *chaosDrillService) GetDrill(ctx context.Context, drillID string) (*dto.ChaosDrillInfo, error) {
+	drill, err := s.drillRepo.FindByID(drillID)
+	if err != nil {
+		return nil, fmt.Errorf("drill not found: %w", err)
+	}
+	return toChaosDrillDTO(drill), nil
+}
+
+// ListDrills returns drills newest first, optionally for one cluster
+func (s *chaosDrillService) ListDrills(ctx context.Context, targetType, targetID string, limit int) ([]dto.ChaosDrillInfo, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	drills, err := s.drillRepo.List(targetType, targetID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list drills: %w", err)
+	}
+	result := make([]dto.ChaosDrillInfo, 0, len(drills))
+	for i := range drills {
+		result = append(result, *toChaosDrillDTO(&drills[i]))
+	}
+	return result, nil
+}
+
+func (s *chaosDrillService) runDrill(ctx context.Context, run *drillRun) error {
+	run.report.OldLeader = run.oldLeader.Name
+	run.report.Timeline = []dto.DrillTimelineEvent{}
+
+	if err := run.setup(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		teardownCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		run.teardown(teardownCtx)
+	}()
+	// Never break a cluster that is already failing
+	if !run.probe(ctx, 0) {
+		return fmt.Errorf("baseline probe failed, cluster is not healthy enough for a drill")
+	}
+	run.event("baseline probe succeeded, leader is %s", run.oldLeader.Name)
+
+	revert, err := s.injectFault(ctx, run)
+	if err != nil {
+		return fmt.Errorf("failed to inject %s: %w", run.req.Scenario, err)
+	}
+	reverted := false
+	defer func() {
+		if !reverted {
+			if err := revert(context.Background()); err != nil {
+				s.logger.Error("failed to revert chaos fault", zap.String("drill_id", run.drill.ID), zap.Error(err))
+			}
+		}
+	}()
+
+	seq := 1
+	holdUntil := run.injected.Add(time.Duration(run.req.DurationSeconds) * time.Second)
+	for time.Now().Before(holdUntil) {
+		s.observe(ctx, run, seq)
+		seq++
+		time.Sleep(drillProbeInterval)
+	}
+
+	reverted = true
+	if err := revert(ctx); err != nil {
+		run.event("failed to revert fault: %v", err)
+		return fmt.Errorf("failed to revert fault: %w", err)
+	}
+	revertedAt := time.Now()
+	run.event("fault reverted")
+
+	deadline := revertedAt.Add(drillRecoveryTimeout)
+	for time.Now().Before(deadline) {
+		s.observe(ctx, run, seq)
+		seq++
+		if run.targetHealthy(ctx) {
+			if _, err := run.currentLeader(ctx); err == nil {
+				seconds := roundSeconds(time.Since(revertedAt))
+				run.report.ClusterRecoverySeconds = &seconds
+				run.event("cluster recovered")
+				break
+			}
+		}
+		time.Sleep(drillProbeInterval)
+	}
+	if run.report.ClusterRecoverySeconds == nil {
+		run.event("cluster did not recover within %s", drillRecoveryTimeout)
+	}
+	run.report.Availability = run.probes.summary(time.Now())
+
+	if leaderID, err := run.currentLeader(ctx); err == nil {
+		run.report.NewLeader = run.nodes[leaderID].Name
+		run.report.LeaderChanged = leaderID != run.oldLeader.ID
+	}
+	return run.finish(ctx)
+}
+
+// observe sends one probe and checks whether another node took over leadership
+func (s *chaosDrillService) observe(ctx context.Context, run *drillRun, seq int) {
+	ok := run.probe(ctx, seq)
+	run.probes.record(ok, time.Now(), run.injected)
+
+	if run.report.TimeToNewLeaderSeconds != nil {
+		return
+	}
+	leaderID, err := run.currentLeader(ctx)
+	if err == nil && leaderID != run.oldLeader.ID && leaderID != "" {
+		seconds := roundSeconds(time.Since(run.injected))
+		run.report.TimeToNewLeaderSeconds = &seconds
+		run.event("%s took over", run.nodes[leaderID].Name)
+	}
+}
+
+// injectFault applies the scenario to the target node and returns the function that undoes it
+func (s *chaosDrillService) injectFault(ctx context.Context, run *drillRun) (func(context.Context) error, error) {
+	target := run.target
+	var revert func(context.Context) error
+
+	switch run.req.Scenario {
+	case "kill_leader":
+		if err := s.dockerSvc.KillContainer(ctx, target.ContainerID, "SIGKILL"); err != nil {
+			return nil, err
+		}
+		revert = func(ctx context.Context) error { return s.dockerSvc.StartContainer(ctx, target.ContainerID) }
+
+	case "pause_node":
+		if err := s.dockerSvc.PauseContainer(ctx, target.ContainerID); err != nil {
+			return nil, err
+		}
+		revert = func(ctx context.Context) error { return s.dockerSvc.UnpauseContainer(ctx, target.ContainerID) }
+
+	case "disconnect_node":
+		aliases, err := s.networkAliases(ctx, target.ContainerID, run.networkID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.dockerSvc.DisconnectNetwork(ctx, run.networkID, target.ContainerID); err != nil {
+			return nil, err
+		}
+		revert = func(ctx context.Context) error {
+			return s.dockerSvc.ConnectNetwork(ctx, run.networkID, target.ContainerID, aliases)
+		}
+
+	case "fill_disk":
+		fillPath, sizeMB, err := s.fillDisk(ctx, target.ContainerID, run.req.FillMB)
+		if err != nil {
+			return nil, err
+		}
+		run.event("allocated %d MB at %s", sizeMB, fillPath)
+		revert = func(ctx context.Context) error {
+			return s.dockerSvc.ExecStream(ctx, target.ContainerID, []string{"rm", "-f", fillPath}, nil, nil)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown scenario %s", run.req.Scenario)
+	}
+
+	run.injected = time.Now()
+	run.event("%s injected on %s", run.req.Scenario, target.Name)
+	return revert, nil
+}
+
+// fillDisk allocates fillMB next to the data directory, refusing to leave less than a small reserve
+// free since the volume is usually shared with the host
+func (s *chaosDrillService) fillDisk(ctx context.Context, containerID string, fillMB int) (string, int, error) {
+	if fillMB <= 0 || fillMB > drillFillMaxMB {
+		return "", 0, fmt.Errorf("fill_mb must be between 1 and %d", drillFillMaxMB)
+	}
+	dataDir, fillPath, err := s.fillPath(ctx, containerID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var out bytes.Buffer
+	if err := s.dockerSvc.ExecStream(ctx, containerID, []string{"df", "-Pk", dataDir}, nil, &out); err != nil {
+		return "", 0, fmt.Errorf("failed to read free space: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return "", 0, fmt.Errorf("unexpected df output: %s", out.String())
+	}
+	availableKB, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("unexpected df output: %s", out.String())
+	}
+	if availableMB := int(availableKB / 1024); fillMB > availableMB-drillFillReserveMB {
+		return "", 0, fmt.Errorf("fill_mb %d would leave less than %d MB of the %d MB free", fillMB, drillFillReserveMB, availableMB)
+	}
+
+	size := fmt.Sprintf("%dM", fillMB)
+	if err := s.dockerSvc.ExecStream(ctx, containerID, []string{"fallocate", "-l", size, fillPath}, nil, nil); err != nil {
+		// Not every filesystem supports fallocate
+		if err := s.dockerSvc.ExecStream(ctx, containerID,
+			[]string{"dd", "if=/dev/zero", "of=" + fillPath, "bs=1M", fmt.Sprintf("count=%d", fillMB)}, nil, nil); err != nil {
+			s.dockerSvc.ExecStream(ctx, containerID, []string{"rm", "-f", fillPath}, nil, nil)
+			return "", 0, fmt.Errorf("failed to fill disk: %w", err)
+		}
+	}
+	return fillPath, fillMB, nil
+}
+
+// fillPath returns the data directory of a node and the file fill_disk allocates next to it
+func (s *chaosDrillService) fillPath(ctx context.Context, containerID string) (string, string, error) {
+	dataDir, err := execPSQL(ctx, s.dockerSvc, containerID, "postgres", "SHOW data_directory")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find data directory: %w", err)
+	}
+	return dataDir, path.Join(path.Dir(dataDir), "iaas_chaos_fill"), nil
+}
+
+// networkAliases returns the aliases of a container on a network so a reconnect restores its DNS names
+func (s *chaosDrillService) networkAliases(ctx context.Context, containerID, networkID string) ([]string, error) {
+	inspect, err := s.dockerSvc.InspectContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	if inspect.NetworkSettings != nil {
+		for name, endpoint := range inspect.NetworkSettings.Networks {
+			if endpoint != nil && (name == networkID || endpoint.NetworkID == networkID) {
+				return endpoint.Aliases, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("container is not attached to network %s", networkID)
+}
+
+func (s *chaosDrillService) preparePostgresDrill(ctx context.Context, run *drillRun) (string, error) {
+	cluster, err := s.clusterRepo.FindByID(run.req.TargetID)
+	if err != nil {
+		return "", fmt.Errorf("cluster not found: %w", err)
+	}
+	if cluster.Infrastructure.Status != entities.StatusRunning {
+		return "", fmt.Errorf("cluster must be running (status: %s)", cluster.Infrastructure.Status)
+	}
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+	if len(members) < 2 {
+		return "", fmt.Errorf("drills need at least 2 Patroni nodes")
+	}
+
+	var proxyContainer string
+	for _, node := range nodes {
+		if node.Role == "haproxy" {
+			proxyContainer = node.ContainerID
+		}
+	}
+	if proxyContainer == "" {
+		return "", fmt.Errorf("cluster has no HAProxy node to probe writes through")
+	}
+	proxyInspect, err := s.dockerSvc.InspectContainer(ctx, proxyContainer)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect HAProxy: %w", err)
+	}
+	proxyHost := strings.TrimPrefix(proxyInspect.Name, "/")
+
+	byName := map[string]string{}
+	for i := range members {
+		name, err := patroniNodeName(ctx, s.dockerSvc, &members[i])
+		if err != nil {
+			return "", err
+		}
+		run.nodes[members[i].ID] = drillNode{ID: members[i].ID, Name: name, ContainerID: members[i].ContainerID}
+		byName[name] = members[i].ID
+	}
+
+	leader, err := patroniLeader(ctx, s.dockerSvc, members)
+	if err != nil {
+		return "", err
+	}
+	run.oldLeader = run.nodes[leader.ID]
+	if err := s.pickTarget(run); err != nil {
+		return "", err
+	}
+	run.networkID = cluster.NetworkID
+
+	var probeNode drillNode
+	for _, node := range run.nodes {
+		if node.ID != run.target.ID {
+			probeNode = node
+			break
+		}
+	}
+
+	run.setup = func(ctx context.Context) error {
+		if _, err := execPSQL(ctx, s.dockerSvc, leader.ContainerID, "postgres", fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s (drill_id varchar(36) NOT NULL, seq int NOT NULL, written_at timestamptz NOT NULL DEFAULT now())",
+			drillProbeTable)); err != nil {
+			return fmt.Errorf("failed to create probe table: %w", err)
+		}
+		return nil
+	}
+
+	// The DCS view of a surviving node knows the leader even while the old one is unreachable
+	run.currentLeader = func(ctx context.Context) (string, error) {
+		var out bytes.Buffer
+		if err := s.dockerSvc.ExecStream(ctx, probeNode.ContainerID, []string{"curl", "-sf", "http://localhost:8008/cluster"}, nil, &out); err != nil {
+			return "", err
+		}
+		var state struct {
+			Members []struct {
+				Name string `json:"name"`
+				Role string `json:"role"`
+			} `json:"members"`
+		}
+		if err := json.Unmarshal(out.Bytes(), &state); err != nil {
+			return "", err
+		}
+		for _, member := range state.Members {
+			if member.Role == "leader" || member.Role == "standby_leader" || member.Role == "master" {
+				return byName[member.Name], nil
+			}
+		}
+		return "", fmt.Errorf("no leader")
+	}
+
+	ackedSeqs := make([]int, 0)
+	lastAckedLSN := ""
+	run.probe = func(ctx context.Context, seq int) bool {
+		probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		var out bytes.Buffer
+		err := s.dockerSvc.ExecStream(probeCtx, probeNode.ContainerID, []string{
+			"env", "PGPASSWORD=" + cluster.Password, "PGCONNECT_TIMEOUT=2",
+			"psql", "-h", proxyHost, "-p", "5000", "-U", "postgres", "-d", "postgres", "-t", "-A", "-c",
+			fmt.Sprintf("INSERT INTO %s (drill_id, seq) VALUES ('%s', %d) RETURNING pg_current_wal_lsn()", drillProbeTable, run.drill.ID, seq),
+		}, nil, &out)
+		if err != nil {
+			return false
+		}
+		ackedSeqs = append(ackedSeqs, seq)
+		lastAckedLSN = strings.TrimSpace(out.String())
+		return true
+	}
+
+	run.targetHealthy = func(ctx context.Context) bool {
+		return s.dockerSvc.ExecStream(ctx, run.target.ContainerID, []string{"curl", "-sf", "http://localhost:8008/health"}, nil, nil) == nil
+	}
+
+	run.finish = func(ctx context.Context) error {
+		leaderID, err := run.currentLeader(ctx)
+		if err != nil {
+			return fmt.Errorf("no leader after drill: %w", err)
+		}
+		leaderNode := run.nodes[leaderID]
+		loss := &dto.DrillDataLoss{LastAckedLSN: lastAckedLSN, AckedWrites: len(ackedSeqs)}
+
+		// A promoted replica keeps reporting the last WAL position it replayed as a standby
+		if leaderID != run.oldLeader.ID {
+			promotion, err := execPSQL(ctx, s.dockerSvc, leaderNode.ContainerID, "postgres", "SELECT pg_last_wal_replay_lsn()")
+			if err == nil && promotion != "" {
+				loss.PromotionLSN = promotion
+				acked, okAcked := parseLSN(lastAckedLSN)
+				promoted, okPromoted := parseLSN(promotion)
+				if okAcked && okPromoted && acked > promoted {
+					loss.LSNLossBytes = int64(acked - promoted)
+				}
+			}
+		}
+
+		rows, err := execPSQL(ctx, s.dockerSvc, leaderNode.ContainerID, "postgres",
+			fmt.Sprintf("SELECT string_agg(seq::text, ',') FROM %s WHERE drill_id = '%s'", drillProbeTable, run.drill.ID))
+		if err != nil {
+			return fmt.Errorf("failed to read probe writes: %w", err)
+		}
+		present := map[int]bool{}
+		for _, value := range strings.Split(rows, ",") {
+			if seq, err := strconv.Atoi(value); err == nil {
+				present[seq] = true
+			}
+		}
+		for _, seq := range ackedSeqs {
+			if !present[seq] {
+				loss.LostWriteSeqs = append(loss.LostWriteSeqs, seq)
+			}
+		}
+		loss.LostWrites = len(loss.LostWriteSeqs)
+		run.report.DataLoss = loss
+		return nil
+	}
+
+	run.teardown = func(ctx context.Context) {
+		if err := s.dropProbeTable(ctx, cluster.ID); err != nil {
+			s.logger.Warn("failed to drop chaos probe table", zap.String("drill_id", run.drill.ID), zap.Error(err))
+		}
+	}
+
+	return cluster.InfrastructureID, nil
+}
+
+func (s *chaosDrillService) prepareNginxDrill(ctx context.Context, run *drillRun) (string, error) {
+	cluster, err := s.nginxRepo.FindByID(run.req.TargetID)
+	if err != nil {
+		return "", fmt.Errorf("nginx cluster not found: %w", err)
+	}
+	if cluster.Infrastructure.Status != entities.StatusRunning {
+		return "", fmt.Errorf("cluster must be running (status: %s)", cluster.Infrastructure.Status)
+	}
+	nodes, err := s.nginxRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+	if len(nodes) < 2 {
+		return "", fmt.Errorf("drills need at least 2 nginx nodes")
+	}
+	for _, node := range nodes {
+		run.nodes[node.ID] = drillNode{ID: node.ID, Name: node.Name, ContainerID: node.ContainerID}
+	}
+
+	master, err := s.nginxRepo.FindMasterNode(cluster.ID)
+	if err != nil {
+		return "", fmt.Errorf("master node not found: %w", err)
+	}
+	run.oldLeader = run.nodes[master.ID]
+	if err := s.pickTarget(run); err != nil {
+		return "", err
+	}
+	run.networkID = cluster.NetworkID
+
+	var probeNode drillNode
+	for _, node := range nodes {
+		if node.ID != run.target.ID {
+			probeNode = run.nodes[node.ID]
+			break
+		}
+	}
+
+	// Clients reach the cluster through the VIP, so that is what availability is measured on
+	vip := strings.SplitN(cluster.VirtualIP, "/", 2)[0]
+	if vip == "" {
+		return "", fmt.Errorf("cluster has no virtual IP to probe")
+	}
+	healthPath := cluster.HealthCheckPath
+	if healthPath == "" {
+		healthPath = "/health"
+	}
+	request := func(ctx context.Context, host string) bool {
+		probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		return s.dockerSvc.ExecStream(probeCtx, probeNode.ContainerID,
+			[]string{"wget", "-q", "-T", "2", "-O", "/dev/null", "http://" + host + healthPath}, nil, nil) == nil
+	}
+
+	// Follows the recorded master, which moves on failover
+	run.currentLeader = func(ctx context.Context) (string, error) {
+		master, err := s.nginxRepo.FindMasterNode(cluster.ID)
+		if err != nil {
+			return "", err
+		}
+		return master.ID, nil
+	}
+	run.probe = func(ctx context.Context, seq int) bool {
+		return request(ctx, vip)
+	}
+	run.targetHealthy = func(ctx context.Context) bool {
+		return request(ctx, run.target.Name)
+	}
+	run.setup = func(ctx context.Context) error { return nil }
+	run.finish = func(ctx context.Context) error { return nil }
+	run.teardown = func(ctx context.Context) {}
+
+	return cluster.InfrastructureID, nil
+}
+
+// pickTarget resolves the node to fault: the leader by default, and always for kill_leader
+func (s *chaosDrillService) pickTarget(run *drillRun) error {
+	if run.req.NodeID == "" {
+		run.target = run.oldLeader
+		return nil
+	}
+	node, ok := run.nodes[run.req.NodeID]
+	if !ok {
+		return fmt.Errorf("node %s not found in cluster", run.req.NodeID)
+	}
+	if run.req.Scenario == "kill_leader" && node.ID != run.oldLeader.ID {
+		return fmt.Errorf("node %s is not the current leader", node.ID)
+	}
+	run.target = node
+	return nil
+}
+
+// isProdInfrastructure reports whether the infrastructure belongs to a stack tagged or configured as prod.
+// It fails closed: only an infrastructure known to be outside any stack counts as not prod.
+func (s *chaosDrillService) isProdInfrastructure(infraID string) bool {
+	resource, err := s.stackRepo.FindResourceByInfrastructureID(infraID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false
+	}
+	if err != nil {
+		s.logger.Warn("failed to look up stack of infrastructure, treating it as prod", zap.String("infrastructure_id", infraID), zap.Error(err))
+		return true
+	}
+	stack, err := s.stackRepo.FindByID(resource.StackID)
+	if err != nil {
+		s.logger.Warn("failed to load stack, treating it as prod", zap.String("stack_id", resource.StackID), zap.Error(err))
+		return true
+	}
+	if isProdLabel(stack.Environment) {
+		return true
+	}
+	if strings.TrimSpace(stack.Tags) == "" {
+		return false
+	}
+
+	var tags []string
+	if err := json.Unmarshal([]byte(stack.Tags), &tags); err != nil {
+		return true
+	}
+	for _, tag := range tags {
+		if isProdLabel(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func isProdLabel(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	return value == "prod" || value == "production"
+}
+
+func (s *chaosDrillService) finishDrill(run *drillRun, err error) {
+	drill := run.drill
+	now := time.Now()
+	drill.CompletedAt = &now
+	if err != nil {
+		drill.Status = "failed"
+		drill.ErrorMessage = err.Error()
+		s.logger.Error("chaos drill failed", zap.String("drill_id", drill.ID), zap.Error(err))
+	} else {
+		drill.Status = "completed"
+		s.logger.Info("chaos drill completed", zap.String("drill_id", drill.ID))
+	}
+	if reportJSON, marshalErr := json.Marshal(run.report); marshalErr == nil {
+		drill.Report = string(reportJSON)
+	}
+	if updateErr := s.drillRepo.Update(drill); updateErr != nil {
+		s.logger.Warn("failed to update drill", zap.String("drill_id", drill.ID), zap.Error(updateErr))
+	}
+}
+
+// RecoverDrills fails drills left running by a previous process and reverts their faults,
+// so a restart mid-drill does not leave a node paused, stopped, disconnected or out of disk
+func (s *chaosDrillService) RecoverDrills(ctx context.Context) {
+	drills, err := s.drillRepo.ListRunning()
+	if err != nil {
+		s.logger.Warn("failed to list interrupted chaos drills", zap.Error(err))
+		return
+	}
+	for i := range drills {
+		drill := &drills[i]
+		message := "interrupted by a service restart"
+		if err := s.revertInterruptedDrill(ctx, drill); err != nil {
+			message = fmt.Sprintf("%s; failed to revert %s: %v", message, drill.Scenario, err)
+		}
+		now := time.Now()
+		drill.Status = "failed"
+		drill.ErrorMessage = message
+		drill.CompletedAt = &now
+		if err := s.drillRepo.Update(drill); err != nil {
+			s.logger.Warn("failed to update drill", zap.String("drill_id", drill.ID), zap.Error(err))
+			continue
+		}
+		s.logger.Warn("chaos drill interrupted", zap.String("drill_id", drill.ID), zap.String("error", message))
+	}
+}
+
+func (s *chaosDrillService) revertInterruptedDrill(ctx context.Context, drill *entities.ChaosDrill) error {
+	var containerID, networkID string
+	switch drill.TargetType {
+	case "postgres":
+		defer func() {
+			if err := s.dropProbeTable(ctx, drill.TargetID); err != nil {
+				s.logger.Warn("failed to drop chaos probe table", zap.String("drill_id", drill.ID), zap.Error(err))
+			}
+		}()
+		cluster, err := s.clusterRepo.FindByID(drill.TargetID)
+		if err != nil {
+			return err
+		}
+		node, err := s.clusterRepo.FindNodeByID(drill.TargetNodeID)
+		if err != nil {
+			return err
+		}
+		containerID, networkID = node.ContainerID, cluster.NetworkID
+	case "nginx":
+		cluster, err := s.nginxRepo.FindByID(drill.TargetID)
+		if err != nil {
+			return err
+		}
+		node, err := s.nginxRepo.FindNodeByID(drill.TargetNodeID)
+		if err != nil {
+			return err
+		}
+		containerID, networkID = node.ContainerID, cluster.NetworkID
+	default:
+		return fmt.Errorf("unsupported target type: %s", drill.TargetType)
+	}
+
+	inspect, err := s.dockerSvc.InspectContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	switch drill.Scenario {
+	case "kill_leader":
+		if !inspect.State.Running {
+			return s.dockerSvc.StartContainer(ctx, containerID)
+		}
+	case "pause_node":
+		if inspect.State.Paused {
+			return s.dockerSvc.UnpauseContainer(ctx, containerID)
+		}
+	case "disconnect_node":
+		if _, err := s.networkAliases(ctx, containerID, networkID); err != nil {
+			// The aliases were lost with the process; the container name still resolves
+			return s.dockerSvc.ConnectNetwork(ctx, networkID, containerID, nil)
+		}
+	case "fill_disk":
+		_, fillPath, err := s.fillPath(ctx, containerID)
+		if err != nil {
+			return err
+		}
+		return s.dockerSvc.ExecStream(ctx, containerID, []string{"rm", "-f", fillPath}, nil, nil)
+	}
+	return nil
+}
+
+// dropProbeTable removes the table postgres drills write their probes to
+func (s *chaosDrillService) dropProbeTable(ctx context.Context, clusterID string) error {
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return err
+	}
+	leader, err := patroniLeader(ctx, s.dockerSvc, patroniMembers(nodes))
+	if err != nil {
+		return err
+	}
+	_, err = execPSQL(ctx, s.dockerSvc, leader.ContainerID, "postgres", fmt.Sprintf("DROP TABLE IF EXISTS %s", drillProbeTable))
+	return err
+}
+
+func toChaosDrillDTO(drill *entities.ChaosDrill) *dto.ChaosDrillInfo {
+	info := &dto.ChaosDrillInfo{
+		ID:              drill.ID,
+		TargetType:      drill.TargetType,
+		TargetID:        drill.TargetID,
+		Scenario:        drill.Scenario,
+		TargetNodeID:    drill.TargetNodeID,
+		Status:          drill.Status,
+		DurationSeconds: drill.DurationSeconds,
+		Forced:          drill.Forced,
+		ErrorMessage:    drill.ErrorMessage,
+		StartedAt:       drill.StartedAt.Format(time.RFC3339),
+	}
+	if drill.Report != "" {
+		var report dto.ChaosDrillReport
+		if err := json.Unmarshal([]byte(drill.Report), &report); err == nil {
+			info.Report = &report
+		}
+	}
+	if drill.CompletedAt != nil {
+		info.CompletedAt = drill.CompletedAt.Format(time.RFC3339)
+	}
+	return info
+}
+
+// parseLSN converts a pg_lsn such as 0/3000148 to a byte position
+func parseLSN(lsn string) (uint64, bool) {
+	parts := strings.SplitN(strings.TrimSpace(lsn), "/", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+	high, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	low, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return high<<32 | low, true
+}
+
+func roundSeconds(d time.Duration) float64 {
+	return float64(d.Milliseconds()/100) / 10
+}
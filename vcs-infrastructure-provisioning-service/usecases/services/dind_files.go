@@ -0,0 +1,211 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+)
+
+// dindDownloadLimit caps how much is read out of an environment in one download
+const dindDownloadLimit = 1 << 30
+
+// DinDDownload is a file, or a directory as an archive, read from a DinD environment
+type DinDDownload struct {
+	Name        string
+	Size        int64 // -1 when not known up front
+	ContentType string
+	Reader      io.ReadCloser
+}
+
+// UploadFile copies an upload into a directory of a DinD environment. The upload is stored as
+// name, or with Extract set unpacked as a tar archive (plain or gzip).
+func (s *dinDService) UploadFile(ctx context.Context, id, userID string, req dto.DinDUploadRequest, name string, size int64, content io.Reader) (*dto.DinDUploadResponse, error) {
+	env, err := s.findUserEnvironment(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if env.Status != "running" {
+		return nil, fmt.Errorf("environment is not running")
+	}
+	dstDir, err := dindPath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if !req.Extract && (name == "." || name == "/") {
+		return nil, fmt.Errorf("file name is required")
+	}
+
+	if err := s.dockerSvc.ExecStream(ctx, env.ContainerID, []string{"mkdir", "-p", dstDir}, nil, nil); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dstDir, err)
+	}
+
+	archive := content
+	if !req.Extract {
+		// The archive API only takes tarballs, so a single file is wrapped on the fly
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		go func() {
+			tw := tar.NewWriter(pw)
+			err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg})
+			if err == nil {
+				_, err = io.CopyN(tw, content, size)
+			}
+			if err == nil {
+				err = tw.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		archive = pr
+	}
+
+	if err := s.dockerSvc.CopyToContainer(ctx, env.ContainerID, dstDir, archive); err != nil {
+		return nil, fmt.Errorf("failed to copy into environment: %w", err)
+	}
+
+	resp := &dto.DinDUploadResponse{Path: dstDir, Size: size, Extracted: req.Extract}
+	if !req.Extract {
+		resp.Path = path.Join(dstDir, name)
+	}
+	s.logger.Info("uploaded to DinD environment",
+		zap.String("env_id", id),
+		zap.String("path", resp.Path),
+		zap.Int64("size", size),
+		zap.Bool("extracted", req.Extract))
+	return resp, nil
+}
+
+// DownloadFile reads a file or directory out of a DinD environment. Files are returned as is
+// unless an archive format is asked for; directories always come as tar or tar.gz. This also
+// works while the environment is stopped.
+func (s *dinDService) DownloadFile(ctx context.Context, id, userID string, req dto.DinDDownloadRequest) (*DinDDownload, error) {
+	env, err := s.findUserEnvironment(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if env.ContainerID == "" {
+		return nil, fmt.Errorf("environment has no container")
+	}
+	srcPath, err := dindPath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, stat, err := s.dockerSvc.CopyFromContainer(ctx, env.ContainerID, srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", srcPath, err)
+	}
+
+	format := req.Format
+	if format == "" {
+		format = "raw"
+		if stat.Mode.IsDir() {
+			format = "tar"
+		}
+	}
+
+	if format == "raw" {
+		if !stat.Mode.IsRegular() {
+			archive.Close()
+			return nil, fmt.Errorf("%s is not a regular file, download it as tar or tar.gz", srcPath)
+		}
+		if stat.Size > dindDownloadLimit {
+			archive.Close()
+			return nil, fmt.Errorf("%s is larger than the download limit of %d bytes", srcPath, dindDownloadLimit)
+		}
+		tr := tar.NewReader(archive)
+		header, err := tr.Next()
+		if err != nil {
+			archive.Close()
+			return nil, fmt.Errorf("failed to read %s: %w", srcPath, err)
+		}
+		return &DinDDownload{
+			Name:        stat.Name,
+			Size:        header.Size,
+			ContentType: "application/octet-stream",
+			Reader:      readCloser{Reader: tr, Closer: archive},
+		}, nil
+	}
+
+	// The stat of a directory does not tell its content size; measure it when the daemon is up
+	if stat.Mode.IsDir() && env.Status == "running" {
+		output, err := s.dockerSvc.ExecCommand(ctx, env.ContainerID, []string{"du", "-sb", srcPath})
+		if fields := strings.Fields(output); err == nil && len(fields) > 0 {
+			if size, err := strconv.ParseInt(fields[0], 10, 64); err == nil && size > dindDownloadLimit {
+				archive.Close()
+				return nil, fmt.Errorf("%s is larger than the download limit of %d bytes", srcPath, dindDownloadLimit)
+			}
+		}
+	}
+
+	limited := &limitedReader{r: archive, remaining: dindDownloadLimit}
+	download := &DinDDownload{
+		Name:        stat.Name + ".tar",
+		Size:        -1,
+		ContentType: "application/x-tar",
+		Reader:      readCloser{Reader: limited, Closer: archive},
+	}
+	if format == "tar.gz" {
+		pr, pw := io.Pipe()
+		go func() {
+			gz := gzip.NewWriter(pw)
+			_, err := io.Copy(gz, limited)
+			if err == nil {
+				err = gz.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		download.Name += ".gz"
+		download.ContentType = "application/gzip"
+		download.Reader = readCloser{Reader: pr, Closer: closerFunc(func() error {
+			pr.Close()
+			return archive.Close()
+		})}
+	}
+	return download, nil
+}
+
+// dindPath validates a path inside an environment and returns it cleaned
+func dindPath(p string) (string, error) {
+	if !path.IsAbs(p) || strings.ContainsRune(p, 0) {
+		return "", fmt.Errorf("path must be absolute: %q", p)
+	}
+	return path.Clean(p), nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// limitedReader fails instead of ending quietly once more than remaining bytes are read, so a
+// cut-off download is not mistaken for a complete one
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, fmt.Errorf("download exceeds the limit of %d bytes", dindDownloadLimit)
+	}
+	return n, err
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDinDPath(t *testing.T) {
+	for input, want := range map[string]string{
+		"/workspace":              "/workspace",
+		"/workspace/":             "/workspace",
+		"/workspace/../etc/hosts": "/etc/hosts",
+		"/a//b/./c":               "/a/b/c",
+		"/":                       "/",
+	} {
+		got, err := dindPath(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"", "workspace", "./workspace", "../etc", "/work\x00space"} {
+		_, err := dindPath(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	within := &limitedReader{r: strings.NewReader("hello"), remaining: 5}
+	data, err := io.ReadAll(within)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	over := &limitedReader{r: strings.NewReader("hello world"), remaining: 5}
+	_, err = io.ReadAll(over)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the limit")
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+)
+
+const (
+	dindHistoryPageSize       = 50
+	dindHistoryExportBatch    = 500
+	dindHistoryRetentionEvery = time.Hour
+)
+
+// GetCommandHistory returns a page of the command history of an environment, newest first
+func (s *dinDService) GetCommandHistory(ctx context.Context, id, userID string, query dto.DinDHistoryQuery) (*dto.DinDCommandHistoryResponse, error) {
+	if _, err := s.findUserEnvironment(id, userID); err != nil {
+		return nil, err
+	}
+
+	page, pageSize := query.Page, query.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = dindHistoryPageSize
+	}
+
+	history, total, err := s.dinDRepo.SearchCommandHistory(id, historyFilter(query), pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search command history: %w", err)
+	}
+
+	entries := make([]dto.DinDCommandHistoryInfo, 0, len(history))
+	for i := range history {
+		entries = append(entries, toCommandHistoryInfo(&history[i]))
+	}
+	return &dto.DinDCommandHistoryResponse{
+		Entries:    entries,
+		TotalCount: total,
+		Page:       page,
+		PageSize:   pageSize,
+	}, nil
+}
+
+// ExportCommandHistory writes all history matching the query as CSV or as a JSON array.
+// Entries are read in batches, so large histories are not held in memory.
+func (s *dinDService) ExportCommandHistory(ctx context.Context, id, userID string, query dto.DinDHistoryQuery, w io.Writer) error {
+	if _, err := s.findUserEnvironment(id, userID); err != nil {
+		return err
+	}
+
+	filter := historyFilter(query)
+	// Pin the end so entries recorded during the export do not shift the batches
+	if filter.Until.IsZero() {
+		filter.Until = time.Now()
+	}
+
+	var csvWriter *csv.Writer
+	if query.Export == "csv" {
+		csvWriter = csv.NewWriter(w)
+		csvWriter.Write([]string{"id", "executed_at", "user_id", "command", "exit_code", "duration_ms", "output"})
+	} else if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	written := 0
+	for offset := 0; ; offset += dindHistoryExportBatch {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		history, _, err := s.dinDRepo.SearchCommandHistory(id, filter, dindHistoryExportBatch, offset)
+		if err != nil {
+			return fmt.Errorf("failed to read command history: %w", err)
+		}
+
+		for i := range history {
+			entry := toCommandHistoryInfo(&history[i])
+			if csvWriter != nil {
+				csvWriter.Write([]string{entry.ID, entry.ExecutedAt, entry.UserID, entry.Command,
+					strconv.Itoa(entry.ExitCode), strconv.Itoa(entry.DurationMs), entry.Output})
+				continue
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if written > 0 {
+				data = append([]byte(","), data...)
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			written++
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		if len(history) < dindHistoryExportBatch {
+			break
+		}
+	}
+
+	if csvWriter == nil {
+		_, err := io.WriteString(w, "]")
+		return err
+	}
+	return nil
+}
+
+// StartHistoryRetention periodically trims command history to the configured age and number
+// of entries per environment
+func (s *dinDService) StartHistoryRetention(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(dindHistoryRetentionEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.trimHistory()
+			}
+		}
+	}()
+}
+
+func (s *dinDService) trimHistory() {
+	var olderThan time.Time
+	if s.dindConfig.HistoryRetention > 0 {
+		olderThan = time.Now().Add(-s.dindConfig.HistoryRetention)
+	}
+	deleted, err := s.dinDRepo.TrimCommandHistory(olderThan, s.dindConfig.HistoryMaxEntries)
+	if err != nil {
+		s.logger.Warn("failed to trim DinD command history", zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		s.logger.Info("DinD command history trimmed", zap.Int64("deleted", deleted))
+	}
+}
+
+func historyFilter(query dto.DinDHistoryQuery) repositories.CommandHistoryFilter {
+	return repositories.CommandHistoryFilter{
+		ExitCode: query.ExitCode,
+		Since:    query.Since,
+		Until:    query.Until,
+		Search:   query.Search,
+	}
+}
+
+func toCommandHistoryInfo(history *entities.DinDCommandHistory) dto.DinDCommandHistoryInfo {
+	return dto.DinDCommandHistoryInfo{
+		ID:            history.ID,
+		EnvironmentID: history.EnvironmentID,
+		UserID:        history.UserID,
+		Command:       history.Command,
+		Output:        history.Output,
+		ExitCode:      history.ExitCode,
+		DurationMs:    history.Duration,
+		ExecutedAt:    history.ExecutedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,593 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+const (
+	dindJobsDir               = "/tmp/iaas-jobs"
+	dindComposeFile           = "/compose/docker-compose.yml"
+	dindJobOutputLimit        = 1 << 20
+	dindJobTimeout            = 2 * time.Hour
+	dindMaxJobsPerEnvironment = 4
+	dindJobsListLimit         = 50
+
+	dindJobRunning   = "running"
+	dindJobSucceeded = "succeeded"
+	dindJobFailed    = "failed"
+	dindJobCancelled = "cancelled"
+)
+
+// dindJobRun is a job in progress. It collects the output for storage and fans it out to the
+// clients streaming it.
+type dindJobRun struct {
+	environmentID string
+	cancel        context.CancelFunc
+
+	mu          sync.Mutex
+	output      bytes.Buffer
+	truncated   bool
+	cancelled   bool
+	done        bool
+	subscribers map[chan []byte]struct{}
+}
+
+func (r *dindJobRun) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	room := dindJobOutputLimit - r.output.Len()
+	if len(p) > room {
+		r.truncated = true
+	}
+	r.output.Write(p[:max(0, min(len(p), room))])
+
+	chunk := append([]byte(nil), p...)
+	for ch := range r.subscribers {
+		select {
+		case ch <- chunk:
+		default:
+			// A client that cannot keep up is dropped rather than stalling the job
+			delete(r.subscribers, ch)
+			close(ch)
+		}
+	}
+	return len(p), nil
+}
+
+// subscribe returns the output so far and a channel with the output that follows. The channel
+// is nil once the job has finished.
+func (r *dindJobRun) subscribe() ([]byte, chan []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	backlog := append([]byte(nil), r.output.Bytes()...)
+	if r.done {
+		return backlog, nil
+	}
+	ch := make(chan []byte, 256)
+	r.subscribers[ch] = struct{}{}
+	return backlog, ch
+}
+
+func (r *dindJobRun) unsubscribe(ch chan []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.subscribers[ch]; ok {
+		delete(r.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (r *dindJobRun) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = true
+	for ch := range r.subscribers {
+		close(ch)
+	}
+	r.subscribers = nil
+}
+
+// DinDJobStream is the output of a job: what was written so far, then live chunks until the job ends
+type DinDJobStream struct {
+	Backlog []byte
+	Live    <-chan []byte // nil when the job has already finished
+	Close   func()
+}
+
+// StartBuildJob builds an image from an inline Dockerfile in the background
+func (s *dinDService) StartBuildJob(ctx context.Context, id, userID string, req dto.BuildImageRequest) (*dto.DinDJobInfo, error) {
+	env, err := s.runningEnvironment(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	jobID := uuid.New().String()
+	contextDir := path.Join(dindJobsDir, jobID, "context")
+	writeCmd := []string{"sh", "-c", fmt.Sprintf("mkdir -p %s && cat > %s/Dockerfile", contextDir, contextDir)}
+	if err := s.dockerSvc.ExecStream(ctx, env.ContainerID, writeCmd, strings.NewReader(req.Dockerfile), nil); err != nil {
+		return nil, fmt.Errorf("failed to write Dockerfile: %w", err)
+	}
+
+	args := buildArgs(req.BuildArgs)
+	build := dto.BuildContextRequest{ImageName: req.ImageName, Tag: req.Tag, BuildArgs: args, NoCache: req.NoCache}
+	return s.startBuild(env, jobID, userID, req, contextDir, build)
+}
+
+// StartBuildContextJob unpacks an uploaded build context (tar or tar.gz) and builds it with
+// BuildKit in the background. Without an upload, the directory at ContextPath in the
+// environment is built in place.
+func (s *dinDService) StartBuildContextJob(ctx context.Context, id, userID string, req dto.BuildContextRequest, buildContext io.Reader) (*dto.DinDJobInfo, error) {
+	env, err := s.runningEnvironment(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Dockerfile != "" {
+		dockerfile, ok := relativeInnerPath(req.Dockerfile)
+		if !ok {
+			return nil, fmt.Errorf("dockerfile must be a path inside the build context")
+		}
+		req.Dockerfile = dockerfile
+	}
+	for _, arg := range req.BuildArgs {
+		if !strings.Contains(arg, "=") {
+			return nil, fmt.Errorf("invalid build arg %q, expected KEY=VALUE", arg)
+		}
+	}
+
+	jobID := uuid.New().String()
+	if buildContext == nil {
+		contextDir, err := dindPath(req.ContextPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.dockerSvc.ExecStream(ctx, env.ContainerID, []string{"test", "-d", contextDir}, nil, nil); err != nil {
+			return nil, fmt.Errorf("build context %s is not a directory", contextDir)
+		}
+		return s.startBuild(env, jobID, userID, req, contextDir, req)
+	}
+
+	contextDir := path.Join(dindJobsDir, jobID, "context")
+	reader := bufio.NewReader(buildContext)
+	flags := "-xf"
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		flags = "-xzf"
+	}
+	extractCmd := []string{"sh", "-c", fmt.Sprintf("mkdir -p %s && tar %s - -C %s", contextDir, flags, contextDir)}
+	if err := s.dockerSvc.ExecStream(ctx, env.ContainerID, extractCmd, reader, nil); err != nil {
+		s.dockerSvc.ExecCommand(ctx, env.ContainerID, []string{"rm", "-rf", path.Join(dindJobsDir, jobID)})
+		return nil, fmt.Errorf("failed to unpack build context: %w", err)
+	}
+
+	return s.startBuild(env, jobID, userID, req, contextDir, req)
+}
+
+func (s *dinDService) startBuild(env *entities.DinDEnvironment, jobID, userID string, request interface{}, contextDir string, req dto.BuildContextRequest) (*dto.DinDJobInfo, error) {
+	tag := req.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	imageName := fmt.Sprintf("%s:%s", req.ImageName, tag)
+	dockerfile := req.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+
+	cmd := []string{"env", "DOCKER_BUILDKIT=1", "docker", "build", "--progress=plain",
+		"-t", imageName, "-f", path.Join(contextDir, dockerfile)}
+	if req.NoCache {
+		cmd = append(cmd, "--no-cache")
+	}
+	for _, arg := range req.BuildArgs {
+		cmd = append(cmd, "--build-arg", arg)
+	}
+	cmd = append(cmd, contextDir)
+
+	return s.startJob(env, jobID, userID, "build", request, cmd, func(ctx context.Context) map[string]interface{} {
+		result := map[string]interface{}{"image": imageName}
+		inspectCmd := []string{"docker", "image", "inspect", imageName, "--format", "{{.Id}} {{.Size}}"}
+		if output, err := s.dockerSvc.ExecCommand(ctx, env.ContainerID, inspectCmd); err == nil {
+			parts := strings.Fields(output)
+			if len(parts) >= 2 {
+				result["image_id"] = parts[0]
+				result["size"] = parts[1]
+			}
+		}
+		return result
+	})
+}
+
+// StartPullJob pulls an image in the background
+func (s *dinDService) StartPullJob(ctx context.Context, id, userID string, req dto.PullImageRequest) (*dto.DinDJobInfo, error) {
+	env, err := s.runningEnvironment(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Username != "" {
+		loginCmd := []string{"docker", "login", "-u", req.Username, "--password-stdin"}
+		if registry := imageRegistry(req.Image); registry != "" {
+			loginCmd = append(loginCmd, registry)
+		}
+		if err := s.dockerSvc.ExecStream(ctx, env.ContainerID, loginCmd, strings.NewReader(req.Password), nil); err != nil {
+			return nil, fmt.Errorf("registry login failed: %w", err)
+		}
+	}
+
+	request := req
+	request.Password = ""
+	cmd := []string{"docker", "pull", req.Image}
+	return s.startJob(env, uuid.New().String(), userID, "pull", request, cmd, func(ctx context.Context) map[string]interface{} {
+		result := map[string]interface{}{"image": req.Image}
+		inspectCmd := []string{"docker", "image", "inspect", req.Image, "--format", "{{.RepoDigests}}"}
+		if output, err := s.dockerSvc.ExecCommand(ctx, env.ContainerID, inspectCmd); err == nil {
+			result["digest"] = strings.TrimSpace(output)
+		}
+		return result
+	})
+}
+
+// StartComposeJob runs a docker-compose action in the background. The compose file is written
+// where RunCompose keeps it, so both work on the same project; with ProjectDir set the
+// project uploaded there is used instead.
+func (s *dinDService) StartComposeJob(ctx context.Context, id, userID string, req dto.ComposeRequest) (*dto.DinDJobInfo, error) {
+	env, err := s.runningEnvironment(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	composeFile, err := composeFilePath(req)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := []string{"docker-compose", "-f", composeFile}
+	switch req.Action {
+	case "up":
+		cmd = append(cmd, "up")
+		if req.Detach {
+			cmd = append(cmd, "-d")
+		}
+	case "down", "restart", "logs", "ps":
+		cmd = append(cmd, req.Action)
+	default:
+		return nil, fmt.Errorf("unknown action: %s", req.Action)
+	}
+	if req.ServiceName != "" {
+		cmd = append(cmd, req.ServiceName)
+	}
+
+	if req.ComposeContent != "" {
+		writeCmd := []string{"sh", "-c", fmt.Sprintf("mkdir -p %s && cat > %s", path.Dir(composeFile), composeFile)}
+		if err := s.dockerSvc.ExecStream(ctx, env.ContainerID, writeCmd, strings.NewReader(req.ComposeContent), nil); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", composeFile, err)
+		}
+	}
+
+	return s.startJob(env, uuid.New().String(), userID, "compose", req, cmd, func(ctx context.Context) map[string]interface{} {
+		servicesCmd := []string{"docker-compose", "-f", composeFile, "config", "--services"}
+		output, _ := s.dockerSvc.ExecCommand(ctx, env.ContainerID, servicesCmd)
+		return map[string]interface{}{"action": req.Action, "services": strings.Fields(output)}
+	})
+}
+
+// startJob records the job and runs cmd in the background, with stderr merged into stdout.
+// result runs after a successful command to collect what the job produced.
+func (s *dinDService) startJob(env *entities.DinDEnvironment, jobID, userID, jobType string, request interface{}, cmd []string, result func(ctx context.Context) map[string]interface{}) (*dto.DinDJobInfo, error) {
+	s.jobsMu.Lock()
+	running := 0
+	for _, run := range s.jobs {
+		if run.environmentID == env.ID {
+			running++
+		}
+	}
+	if running >= dindMaxJobsPerEnvironment {
+		s.jobsMu.Unlock()
+		s.dockerSvc.ExecCommand(context.Background(), env.ContainerID, []string{"rm", "-rf", path.Join(dindJobsDir, jobID)})
+		return nil, fmt.Errorf("environment already runs %d jobs", running)
+	}
+
+	requestJSON, _ := json.Marshal(request)
+	job := &entities.DinDJob{
+		ID:            jobID,
+		EnvironmentID: env.ID,
+		UserID:        userID,
+		Type:          jobType,
+		Status:        dindJobRunning,
+		Request:       string(requestJSON),
+	}
+	if err := s.dinDRepo.CreateJob(job); err != nil {
+		s.jobsMu.Unlock()
+		return nil, fmt.Errorf("failed to record job: %w", err)
+	}
+
+	runCtx, cancel := context.WithTimeout(context.Background(), dindJobTimeout)
+	run := &dindJobRun{environmentID: env.ID, cancel: cancel, subscribers: make(map[chan []byte]struct{})}
+	s.jobs[jobID] = run
+	s.jobsMu.Unlock()
+
+	s.logger.Info("DinD job started",
+		zap.String("env_id", env.ID),
+		zap.String("job_id", jobID),
+		zap.String("type", jobType),
+		zap.Strings("cmd", cmd))
+
+	go s.runJob(runCtx, env, job, run, cmd, result)
+	return s.toJobInfo(job, false), nil
+}
+
+func (s *dinDService) runJob(ctx context.Context, env *entities.DinDEnvironment, job *entities.DinDJob, run *dindJobRun, cmd []string, result func(ctx context.Context) map[string]interface{}) {
+	jobDir := path.Join(dindJobsDir, job.ID)
+	pidFile := path.Join(jobDir, "pid")
+
+	// The exec itself is not tied to ctx: cancelling signals the command, whose output keeps
+	// streaming until it has actually stopped
+	stopKill := context.AfterFunc(ctx, func() {
+		killCmd := []string{"sh", "-c", fmt.Sprintf("kill -TERM $(cat %s) 2>/dev/null", pidFile)}
+		s.dockerSvc.ExecCommand(context.Background(), env.ContainerID, killCmd)
+	})
+	wrapped := append([]string{"sh", "-c", `mkdir -p "$(dirname "$0")" && echo $$ > "$0" && exec "$@" 2>&1`, pidFile}, cmd...)
+	err := s.dockerSvc.ExecStream(context.Background(), env.ContainerID, wrapped, nil, run)
+	stopKill()
+
+	run.mu.Lock()
+	cancelled := run.cancelled
+	run.mu.Unlock()
+	switch {
+	case cancelled:
+		job.Status = dindJobCancelled
+	case ctx.Err() == context.DeadlineExceeded:
+		job.Status = dindJobFailed
+		job.Error = fmt.Sprintf("timed out after %s", dindJobTimeout)
+	case err != nil:
+		// Output goes to stdout, so the error only carries the exit code
+		job.Status = dindJobFailed
+		job.Error = fmt.Sprintf("%s failed: %s", job.Type, strings.TrimSuffix(strings.TrimSpace(err.Error()), ":"))
+	default:
+		job.Status = dindJobSucceeded
+		if resultJSON, err := json.Marshal(result(context.Background())); err == nil {
+			job.Result = string(resultJSON)
+		}
+	}
+	run.cancel()
+	s.dockerSvc.ExecCommand(context.Background(), env.ContainerID, []string{"rm", "-rf", jobDir})
+
+	run.mu.Lock()
+	job.Output = strings.ReplaceAll(strings.ToValidUTF8(run.output.String(), "\uFFFD"), "\x00", "")
+	job.Truncated = run.truncated
+	run.mu.Unlock()
+	job.FinishedAt = time.Now()
+	if err := s.dinDRepo.UpdateJob(job); err != nil {
+		s.logger.Error("failed to store DinD job", zap.String("job_id", job.ID), zap.Error(err))
+	}
+
+	// Streams see the end only after the final state is stored, so they can read it back
+	run.finish()
+	s.jobsMu.Lock()
+	delete(s.jobs, job.ID)
+	s.jobsMu.Unlock()
+
+	s.logger.Info("DinD job finished",
+		zap.String("env_id", env.ID),
+		zap.String("job_id", job.ID),
+		zap.String("status", job.Status),
+		zap.Duration("duration", job.FinishedAt.Sub(job.CreatedAt)))
+}
+
+// CancelJob stops a running job; it ends as cancelled once the command has exited
+func (s *dinDService) CancelJob(ctx context.Context, id, userID, jobID string) error {
+	job, err := s.findJob(id, userID, jobID)
+	if err != nil {
+		return err
+	}
+	s.jobsMu.Lock()
+	run, ok := s.jobs[job.ID]
+	s.jobsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("job is not running")
+	}
+
+	run.mu.Lock()
+	run.cancelled = true
+	run.mu.Unlock()
+	run.cancel()
+	s.logger.Info("DinD job cancelled", zap.String("env_id", id), zap.String("job_id", jobID))
+	return nil
+}
+
+// cancelJobs cancels the running jobs of an environment that is going away
+func (s *dinDService) cancelJobs(environmentID string) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	for _, run := range s.jobs {
+		if run.environmentID != environmentID {
+			continue
+		}
+		run.mu.Lock()
+		run.cancelled = true
+		run.mu.Unlock()
+		run.cancel()
+	}
+}
+
+// ListJobs lists the jobs of an environment, newest first
+func (s *dinDService) ListJobs(ctx context.Context, id, userID string) ([]dto.DinDJobInfo, error) {
+	if _, err := s.findUserEnvironment(id, userID); err != nil {
+		return nil, err
+	}
+	jobs, err := s.dinDRepo.ListJobs(id, dindJobsListLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]dto.DinDJobInfo, 0, len(jobs))
+	for i := range jobs {
+		result = append(result, *s.toJobInfo(&jobs[i], false))
+	}
+	return result, nil
+}
+
+// GetJob returns a job with its output, the output so far while it is still running
+func (s *dinDService) GetJob(ctx context.Context, id, userID, jobID string) (*dto.DinDJobInfo, error) {
+	job, err := s.findJob(id, userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return s.toJobInfo(job, true), nil
+}
+
+// StreamJob follows the output of a job. Finished jobs return their stored output only.
+func (s *dinDService) StreamJob(ctx context.Context, id, userID, jobID string) (*DinDJobStream, error) {
+	job, err := s.findJob(id, userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.jobsMu.Lock()
+	run, ok := s.jobs[job.ID]
+	s.jobsMu.Unlock()
+	if ok {
+		backlog, ch := run.subscribe()
+		if ch != nil {
+			return &DinDJobStream{Backlog: backlog, Live: ch, Close: func() { run.unsubscribe(ch) }}, nil
+		}
+		// Finished between the lookups; the stored output is complete by now
+		if job, err = s.findJob(id, userID, jobID); err != nil {
+			return nil, err
+		}
+	}
+	return &DinDJobStream{Backlog: []byte(job.Output), Close: func() {}}, nil
+}
+
+// runningEnvironment loads an environment of the user that can run docker commands
+func (s *dinDService) runningEnvironment(id, userID string) (*entities.DinDEnvironment, error) {
+	env, err := s.findUserEnvironment(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if env.Status != "running" {
+		return nil, fmt.Errorf("environment is not running")
+	}
+	return env, nil
+}
+
+func (s *dinDService) findJob(id, userID, jobID string) (*entities.DinDJob, error) {
+	if _, err := s.findUserEnvironment(id, userID); err != nil {
+		return nil, err
+	}
+	job, err := s.dinDRepo.FindJob(jobID)
+	if err != nil || job.EnvironmentID != id {
+		return nil, fmt.Errorf("job not found")
+	}
+	return job, nil
+}
+
+func (s *dinDService) toJobInfo(job *entities.DinDJob, withOutput bool) *dto.DinDJobInfo {
+	info := &dto.DinDJobInfo{
+		ID:            job.ID,
+		EnvironmentID: job.EnvironmentID,
+		UserID:        job.UserID,
+		Type:          job.Type,
+		Status:        job.Status,
+		Truncated:     job.Truncated,
+		Error:         job.Error,
+		CreatedAt:     job.CreatedAt.Format(time.RFC3339),
+	}
+	if job.Request != "" {
+		info.Request = json.RawMessage(job.Request)
+	}
+	if job.Result != "" {
+		json.Unmarshal([]byte(job.Result), &info.Result)
+	}
+
+	s.jobsMu.Lock()
+	run, running := s.jobs[job.ID]
+	s.jobsMu.Unlock()
+	switch {
+	case running:
+		if withOutput {
+			run.mu.Lock()
+			info.Output = run.output.String()
+			info.Truncated = run.truncated
+			run.mu.Unlock()
+		}
+	case job.Status == dindJobRunning:
+		// Jobs do not survive a restart of the service
+		info.Status = dindJobFailed
+		info.Error = "interrupted by a restart of the provisioning service"
+	default:
+		if withOutput {
+			info.Output = job.Output
+		}
+	}
+	if !job.FinishedAt.IsZero() {
+		info.FinishedAt = job.FinishedAt.Format(time.RFC3339)
+		info.Duration = job.FinishedAt.Sub(job.CreatedAt).Round(time.Millisecond).String()
+	}
+	return info
+}
+
+// composeFilePath returns the compose file of a request: the file in its project directory,
+// or the shared /compose project
+func composeFilePath(req dto.ComposeRequest) (string, error) {
+	if req.ProjectDir == "" {
+		return dindComposeFile, nil
+	}
+	dir, err := dindPath(req.ProjectDir)
+	if err != nil {
+		return "", err
+	}
+	file := req.ComposeFile
+	if file == "" {
+		file = "docker-compose.yml"
+	}
+	file, ok := relativeInnerPath(file)
+	if !ok {
+		return "", fmt.Errorf("compose file must be a path inside the project directory")
+	}
+	return path.Join(dir, file), nil
+}
+
+// relativeInnerPath cleans a path that has to stay inside some directory
+func relativeInnerPath(p string) (string, bool) {
+	p = path.Clean(p)
+	if path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
+
+// imageRegistry returns the registry host of an image reference, empty for Docker Hub
+func imageRegistry(image string) string {
+	host, _, found := strings.Cut(image, "/")
+	if !found || !(strings.ContainsAny(host, ".:") || host == "localhost") {
+		return ""
+	}
+	return host
+}
+
+// buildArgs turns a build args map into sorted KEY=VALUE pairs
+func buildArgs(args map[string]string) []string {
+	pairs := make([]string, 0, len(args))
+	for key, value := range args {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
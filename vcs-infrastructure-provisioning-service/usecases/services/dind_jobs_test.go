@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+// fakeDinDJobRepo adds stored jobs to the environments of fakeDinDEnvRepo
+type fakeDinDJobRepo struct {
+	fakeDinDEnvRepo
+	jobs []entities.DinDJob
+}
+
+func (r *fakeDinDJobRepo) FindJob(id string) (*entities.DinDJob, error) {
+	for i := range r.jobs {
+		if r.jobs[i].ID == id {
+			return &r.jobs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func (r *fakeDinDJobRepo) ListJobs(environmentID string, limit int) ([]entities.DinDJob, error) {
+	var jobs []entities.DinDJob
+	for _, job := range r.jobs {
+		if job.EnvironmentID == environmentID {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func TestJobsOfOtherUserNotFound(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeDinDJobRepo{
+		fakeDinDEnvRepo: fakeDinDEnvRepo{envs: []entities.DinDEnvironment{{ID: "a", UserID: "alice", Status: "running", ContainerID: "container-a"}}},
+		jobs:            []entities.DinDJob{{ID: "j1", EnvironmentID: "a", Type: "build", Status: "succeeded", Output: "done"}},
+	}
+	svc := &dinDService{dinDRepo: repo, jobs: map[string]*dindJobRun{}, logger: nopLogger{}}
+
+	jobs, err := svc.ListJobs(ctx, "a", "alice")
+	require.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	job, err := svc.GetJob(ctx, "a", "alice", "j1")
+	require.NoError(t, err)
+	assert.Equal(t, "done", job.Output)
+
+	_, err = svc.ListJobs(ctx, "a", "bob")
+	assert.EqualError(t, err, "environment not found")
+	_, err = svc.GetJob(ctx, "a", "bob", "j1")
+	assert.EqualError(t, err, "environment not found")
+	_, err = svc.StreamJob(ctx, "a", "bob", "j1")
+	assert.EqualError(t, err, "environment not found")
+	err = svc.CancelJob(ctx, "a", "bob", "j1")
+	assert.EqualError(t, err, "environment not found")
+	_, err = svc.StartPullJob(ctx, "a", "bob", dto.PullImageRequest{Image: "nginx"})
+	assert.EqualError(t, err, "environment not found")
+	_, err = svc.StartComposeJob(ctx, "a", "bob", dto.ComposeRequest{})
+	assert.EqualError(t, err, "environment not found")
+}
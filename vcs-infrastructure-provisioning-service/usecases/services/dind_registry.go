@@ -0,0 +1,546 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+)
+
+const (
+	dindRegistryImage      = "registry:2"
+	dindRegistryProxyImage = "nginx:1.27-alpine"
+	dindRegistryRetry      = time.Minute
+
+	// dindRegistryNetwork is where the registries are created. Environments reach them over a
+	// network of their own (registryNetworkName); they only joined this one in earlier versions.
+	dindRegistryNetwork = "iaas-dind-registry"
+
+	// The mirror caches the upstream registry and is read-only; images are pushed to the
+	// shared registry, one namespace per user. Environments reach the shared registry through
+	// an nginx proxy under its name, which authenticates each user and confines them to their
+	// namespace; the store behind it is only on dindRegistryNetwork.
+	dindMirrorName        = "iaas-dind-registry-mirror"
+	dindRegistryName      = "iaas-dind-registry"
+	dindRegistryStoreName = "iaas-dind-registry-store"
+	dindRegistryPort      = "5000"
+	dindRegistryHtpasswd  = "/etc/nginx/htpasswd"
+)
+
+// registryProxyConfig is the nginx config of the registry proxy. The user a request
+// authenticates as must be the namespace in its path, and blobs may only be mounted from
+// repositories of that namespace. The catalog and everything else outside namespaces is refused.
+const registryProxyConfig = `worker_processes 1;
+events { worker_connections 1024; }
+http {
+    map $upstream_http_docker_distribution_api_version $docker_distribution_api_version {
+        "" "registry/2.0";
+    }
+    map $arg_from $mount_namespace {
+        "" $namespace;
+        "~^(?<from>[a-z0-9._-]+)(/|%2[Ff])" $from;
+        default "";
+    }
+    server {
+        listen 5000;
+        resolver 127.0.0.11 valid=30s;
+        client_max_body_size 0;
+        chunked_transfer_encoding on;
+        proxy_http_version 1.1;
+        proxy_request_buffering off;
+        proxy_buffering off;
+        proxy_read_timeout 900;
+        proxy_set_header Host $http_host;
+        proxy_set_header X-Forwarded-Proto $scheme;
+        add_header Docker-Distribution-Api-Version $docker_distribution_api_version always;
+        auth_basic "DinD registry";
+        auth_basic_user_file ` + dindRegistryHtpasswd + `;
+        set $store http://` + dindRegistryStoreName + `:` + dindRegistryPort + `;
+
+        location = /v2/ {
+            proxy_pass $store;
+        }
+        location ~ ^/v2/(?<namespace>[a-z0-9._-]+)/ {
+            if ($remote_user != $namespace) {
+                return 403;
+            }
+            if ($mount_namespace != $namespace) {
+                return 403;
+            }
+            proxy_pass $store;
+        }
+        location / {
+            return 404;
+        }
+    }
+}
+`
+
+// registryProxyCmd writes the config of the proxy and an htpasswd file without users before
+// starting nginx; users are added as environments log in
+var registryProxyCmd = []string{"sh", "-c", `printf '%s' "$REGISTRY_PROXY_CONFIG" > /etc/nginx/nginx.conf && ` +
+	`touch ` + dindRegistryHtpasswd + ` && chown root:nginx ` + dindRegistryHtpasswd + ` && chmod 640 ` + dindRegistryHtpasswd + ` && ` +
+	`exec nginx -g 'daemon off;'`}
+
+// registryAddUserScript sets the htpasswd line ($1) of a user ($0) in the proxy. nginx reads the
+// file on every request, so it needs no reload.
+const registryAddUserScript = `f=` + dindRegistryHtpasswd + `; grep -qxF "$1" "$f" && exit 0; ` +
+	`awk -F: -v u="$0" '$1 != u' "$f" > "$f.tmp" && echo "$1" >> "$f.tmp" && ` +
+	`chown root:nginx "$f.tmp" && chmod 640 "$f.tmp" && mv "$f.tmp" "$f"`
+
+var (
+	registryRepoPattern = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?:/[a-z0-9]+(?:[._-][a-z0-9]+)*)*$`)
+	registryTagPattern  = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	// A namespace is a single path component, so that one never prefixes another
+	registryNamespacePattern = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*$`)
+)
+
+// StartRegistry runs the registry mirror and the registry shared by DinD environments, retrying
+// until both are up. Environments created before that use Docker Hub directly.
+func (s *dinDService) StartRegistry(ctx context.Context) {
+	if !s.dindConfig.RegistryEnabled {
+		return
+	}
+	if s.dindConfig.RegistrySecret == "" {
+		s.logger.Warn("DinD registry disabled: no secret to derive registry credentials from")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(dindRegistryRetry)
+		defer ticker.Stop()
+		for {
+			err := s.ensureRegistry(ctx)
+			if err == nil {
+				s.registryReady.Store(true)
+				s.logger.Info("DinD registry mirror ready",
+					zap.String("mirror", s.mirrorURL()),
+					zap.String("registry", s.registryHost()))
+				return
+			}
+			s.logger.Warn("failed to start DinD registry mirror", zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *dinDService) ensureRegistry(ctx context.Context) error {
+	if _, err := s.dockerSvc.CreateNetwork(ctx, dindRegistryNetwork); err != nil {
+		return fmt.Errorf("failed to create registry network: %w", err)
+	}
+
+	// The proxy comes after the store it forwards to
+	registries := []struct {
+		name   string
+		image  string
+		env    []string
+		cmd    []string
+		volume string
+	}{
+		{
+			name:   dindMirrorName,
+			image:  dindRegistryImage,
+			env:    []string{"REGISTRY_PROXY_REMOTEURL=" + s.dindConfig.RegistryUpstream},
+			volume: dindMirrorName + "-data",
+		},
+		{
+			// Keeps the volume of the registry that environments reached directly before
+			name:   dindRegistryStoreName,
+			image:  dindRegistryImage,
+			env:    []string{"REGISTRY_STORAGE_DELETE_ENABLED=true"},
+			volume: dindRegistryName + "-data",
+		},
+		{
+			name:  dindRegistryName,
+			image: dindRegistryProxyImage,
+			env:   []string{"REGISTRY_PROXY_CONFIG=" + registryProxyConfig},
+			cmd:   registryProxyCmd,
+		},
+	}
+	for _, registry := range registries {
+		if info, err := s.dockerSvc.InspectContainer(ctx, registry.name); err == nil {
+			if info.Config != nil && info.Config.Image == registry.image {
+				if !info.State.Running {
+					if err := s.dockerSvc.StartContainer(ctx, info.ID); err != nil {
+						return fmt.Errorf("failed to start %s: %w", registry.name, err)
+					}
+				}
+				continue
+			}
+			// Earlier versions ran the registry without authentication under the name of the proxy
+			if err := s.dockerSvc.RemoveContainer(ctx, info.ID); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", registry.name, err)
+			}
+		}
+
+		var volumes map[string]string
+		if registry.volume != "" {
+			if err := s.dockerSvc.CreateVolume(ctx, registry.volume); err != nil {
+				return fmt.Errorf("failed to create volume %s: %w", registry.volume, err)
+			}
+			volumes = map[string]string{registry.volume: "/var/lib/registry"}
+		}
+		containerID, err := s.dockerSvc.CreateContainer(ctx, docker.ContainerConfig{
+			Name:         registry.name,
+			Image:        registry.image,
+			Env:          registry.env,
+			Cmd:          registry.cmd,
+			Volumes:      volumes,
+			Network:      dindRegistryNetwork,
+			NetworkAlias: registry.name,
+			Labels:       map[string]string{"iaas.dind.registry": registry.name},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", registry.name, err)
+		}
+		if err := s.dockerSvc.StartContainer(ctx, containerID); err != nil {
+			return fmt.Errorf("failed to start %s: %w", registry.name, err)
+		}
+	}
+	s.reattachEnvironments(ctx)
+	return nil
+}
+
+// registryNetworkName is the network between one environment and the registries
+func registryNetworkName(envID string) string {
+	return fmt.Sprintf("dind-registry-%s", envID)
+}
+
+// attachRegistry connects an environment to the mirror and the registry proxy over a network of
+// its own. They join every such network but environments never share one: dockerd listens on
+// :2375 without TLS, so on a common network any tenant could drive the daemon of another.
+func (s *dinDService) attachRegistry(ctx context.Context, envID, containerID string) error {
+	network := registryNetworkName(envID)
+	if _, err := s.dockerSvc.CreateNetwork(ctx, network); err != nil {
+		return fmt.Errorf("failed to create registry network: %w", err)
+	}
+	for _, name := range []string{dindMirrorName, dindRegistryName} {
+		if err := s.joinNetwork(ctx, network, name, []string{name}); err != nil {
+			return fmt.Errorf("failed to connect %s: %w", name, err)
+		}
+	}
+	return s.joinNetwork(ctx, network, containerID, nil)
+}
+
+// joinNetwork connects a container to a network unless it already is
+func (s *dinDService) joinNetwork(ctx context.Context, network, containerID string, aliases []string) error {
+	info, err := s.dockerSvc.InspectContainer(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	if _, ok := info.NetworkSettings.Networks[network]; ok {
+		return nil
+	}
+	return s.dockerSvc.ConnectNetwork(ctx, network, containerID, aliases)
+}
+
+// detachRegistry removes the registry network of a deleted environment
+func (s *dinDService) detachRegistry(ctx context.Context, envID string) {
+	network := registryNetworkName(envID)
+	for _, name := range []string{dindMirrorName, dindRegistryName} {
+		if info, err := s.dockerSvc.InspectContainer(ctx, name); err == nil {
+			if _, ok := info.NetworkSettings.Networks[network]; ok {
+				s.dockerSvc.DisconnectNetwork(ctx, network, name)
+			}
+		}
+	}
+	s.dockerSvc.RemoveNetwork(ctx, network)
+}
+
+// reattachEnvironments moves environments off the network the registries are created on,
+// which earlier versions shared between all environments, and reconnects recreated registries
+// to the network of each environment
+func (s *dinDService) reattachEnvironments(ctx context.Context) {
+	envs, err := s.dinDRepo.ListAll()
+	if err != nil {
+		s.logger.Warn("failed to list DinD environments for the registry", zap.Error(err))
+		return
+	}
+	for _, env := range envs {
+		if env.ContainerID == "" {
+			continue
+		}
+		info, err := s.dockerSvc.InspectContainer(ctx, env.ContainerID)
+		if err != nil {
+			continue
+		}
+		_, shared := info.NetworkSettings.Networks[dindRegistryNetwork]
+		_, own := info.NetworkSettings.Networks[registryNetworkName(env.ID)]
+		if !shared && !own {
+			continue
+		}
+		if shared {
+			if err := s.dockerSvc.DisconnectNetwork(ctx, dindRegistryNetwork, env.ContainerID); err != nil {
+				s.logger.Error("failed to move DinD environment off the shared registry network",
+					zap.String("env_id", env.ID), zap.Error(err))
+				continue
+			}
+		}
+		if err := s.attachRegistry(ctx, env.ID, env.ContainerID); err != nil {
+			s.logger.Warn("failed to connect DinD environment to the registry", zap.String("env_id", env.ID), zap.Error(err))
+			continue
+		}
+		// Environments of earlier versions have no registry login yet
+		if env.UserID != "" && info.State.Running {
+			if err := s.loginRegistry(ctx, env.ContainerID, env.UserID); err != nil {
+				s.logger.Warn("failed to log DinD environment in to the registry", zap.String("env_id", env.ID), zap.Error(err))
+			}
+		}
+	}
+}
+
+// registryCredentials are the registry password of a namespace and its htpasswd line. Both are
+// derived from the registry secret, so they survive restarts without being stored. The password
+// is random enough that a salted SHA-1 in the htpasswd file is as good as a slow hash.
+func (s *dinDService) registryCredentials(namespace string) (string, string) {
+	mac := hmac.New(sha256.New, []byte(s.dindConfig.RegistrySecret))
+	mac.Write([]byte("password:" + namespace))
+	password := hex.EncodeToString(mac.Sum(nil))
+
+	mac.Reset()
+	mac.Write([]byte("salt:" + namespace))
+	salt := mac.Sum(nil)[:8]
+	digest := sha1.Sum(append([]byte(password), salt...))
+	return password, namespace + ":{SSHA}" + base64.StdEncoding.EncodeToString(append(digest[:], salt...))
+}
+
+// loginRegistry lets an environment push to and pull from the namespace of a user: the proxy
+// learns the credentials of the namespace and docker in the environment logs in with them
+func (s *dinDService) loginRegistry(ctx context.Context, containerID, userID string) error {
+	namespace, err := registryNamespace(userID)
+	if err != nil {
+		return err
+	}
+	password, htpasswdLine := s.registryCredentials(namespace)
+
+	s.registryMu.Lock()
+	err = s.dockerSvc.ExecStream(ctx, dindRegistryName, []string{"sh", "-c", registryAddUserScript, namespace, htpasswdLine}, nil, nil)
+	s.registryMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to add registry user: %w", err)
+	}
+
+	cmd := []string{"docker", "login", "--username", namespace, "--password-stdin", s.registryHost()}
+	if err := s.dockerSvc.ExecStream(ctx, containerID, cmd, strings.NewReader(password), nil); err != nil {
+		return fmt.Errorf("failed to log in to the registry: %w", err)
+	}
+	return nil
+}
+
+func (s *dinDService) mirrorURL() string {
+	return fmt.Sprintf("http://%s:%s", dindMirrorName, dindRegistryPort)
+}
+
+func (s *dinDService) registryHost() string {
+	return fmt.Sprintf("%s:%s", dindRegistryName, dindRegistryPort)
+}
+
+// daemonArgs are the dockerd flags of a new environment: the mirror for Docker Hub pulls, and
+// both registries as insecure since they are only reachable on internal networks
+func (s *dinDService) daemonArgs() []string {
+	if !s.registryReady.Load() {
+		return nil
+	}
+	return []string{
+		"--registry-mirror=" + s.mirrorURL(),
+		fmt.Sprintf("--insecure-registry=%s:%s", dindMirrorName, dindRegistryPort),
+		"--insecure-registry=" + s.registryHost(),
+	}
+}
+
+// GetRegistry describes the shared registry and lists the images in the namespace of a user
+func (s *dinDService) GetRegistry(ctx context.Context, userID string) (*dto.DinDRegistryInfo, error) {
+	info := &dto.DinDRegistryInfo{
+		Enabled: s.registryReady.Load(),
+		Images:  []dto.DinDRegistryImage{},
+	}
+	if !info.Enabled {
+		return info, nil
+	}
+	namespace, err := registryNamespace(userID)
+	if err != nil {
+		return nil, err
+	}
+	info.Mirror = s.mirrorURL()
+	info.Registry = s.registryHost()
+	info.Namespace = namespace
+
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := s.registryAPI(ctx, "/v2/_catalog?n=10000", &catalog); err != nil {
+		return nil, fmt.Errorf("failed to list registry: %w", err)
+	}
+	for _, repository := range catalog.Repositories {
+		if !strings.HasPrefix(repository, namespace+"/") {
+			continue
+		}
+		var tags struct {
+			Tags []string `json:"tags"`
+		}
+		if err := s.registryAPI(ctx, "/v2/"+repository+"/tags/list", &tags); err != nil {
+			s.logger.Warn("failed to list registry tags", zap.String("repository", repository), zap.Error(err))
+		}
+		// Repositories whose tags were all deleted are still in the catalog
+		if len(tags.Tags) == 0 {
+			continue
+		}
+		sort.Strings(tags.Tags)
+		info.Images = append(info.Images, dto.DinDRegistryImage{
+			Name:      strings.TrimPrefix(repository, namespace+"/"),
+			Reference: s.registryHost() + "/" + repository,
+			Tags:      tags.Tags,
+		})
+	}
+	return info, nil
+}
+
+// registryAPI queries the store from inside its container, which is not published on the host
+// and sits behind the proxy for everyone else
+func (s *dinDService) registryAPI(ctx context.Context, apiPath string, v interface{}) error {
+	cmd := []string{"wget", "-qO-", fmt.Sprintf("http://localhost:%s%s", dindRegistryPort, apiPath)}
+	output, exitCode, err := s.dockerSvc.ExecCommandWithExitCode(ctx, dindRegistryStoreName, cmd)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("registry request %s failed: %s", apiPath, strings.TrimSpace(output))
+	}
+	return json.Unmarshal([]byte(output), v)
+}
+
+// PushToRegistry pushes an image of an environment into the namespace of the user in the
+// shared registry, as a background job
+func (s *dinDService) PushToRegistry(ctx context.Context, id, userID string, req dto.DinDRegistryPushRequest) (*dto.DinDJobInfo, error) {
+	env, err := s.registryEnvironment(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := registryNamespace(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	repository, tag := splitImageTag(req.Image)
+	name := req.Name
+	if name == "" {
+		name = repository[strings.LastIndex(repository, "/")+1:]
+	}
+	if req.Tag != "" {
+		tag = req.Tag
+	}
+	if !registryRepoPattern.MatchString(name) || !registryTagPattern.MatchString(tag) {
+		return nil, fmt.Errorf("invalid image name %q or tag %q", name, tag)
+	}
+
+	target := fmt.Sprintf("%s/%s/%s:%s", s.registryHost(), namespace, name, tag)
+	cmd := []string{"sh", "-c", `docker tag "$0" "$1" && docker push "$1"`, req.Image, target}
+	return s.startJob(env, uuid.New().String(), userID, "push", req, cmd, func(ctx context.Context) map[string]interface{} {
+		result := map[string]interface{}{"reference": target}
+		inspectCmd := []string{"docker", "image", "inspect", target, "--format", "{{range .RepoDigests}}{{println .}}{{end}}"}
+		if output, err := s.dockerSvc.ExecCommand(ctx, env.ContainerID, inspectCmd); err == nil {
+			for _, digest := range strings.Fields(output) {
+				if strings.HasPrefix(digest, s.registryHost()+"/") {
+					result["digest"] = digest
+				}
+			}
+		}
+		return result
+	})
+}
+
+// PullFromRegistry pulls an image from the namespace of the user into an environment, as a
+// background job, and tags it with its short name
+func (s *dinDService) PullFromRegistry(ctx context.Context, id, userID string, req dto.DinDRegistryPullRequest) (*dto.DinDJobInfo, error) {
+	env, err := s.registryEnvironment(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := registryNamespace(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	name, tag := splitImageTag(req.Image)
+	if !registryRepoPattern.MatchString(name) || !registryTagPattern.MatchString(tag) {
+		return nil, fmt.Errorf("invalid image %q", req.Image)
+	}
+	localName := req.LocalName
+	if localName == "" {
+		localName = name + ":" + tag
+	}
+
+	source := fmt.Sprintf("%s/%s/%s:%s", s.registryHost(), namespace, name, tag)
+	cmd := []string{"sh", "-c", `docker pull "$0" && docker tag "$0" "$1"`, source, localName}
+	return s.startJob(env, uuid.New().String(), userID, "pull", req, cmd, func(ctx context.Context) map[string]interface{} {
+		return map[string]interface{}{"reference": source, "image": localName}
+	})
+}
+
+// registryEnvironment loads a running environment of the user that can reach the shared registry
+func (s *dinDService) registryEnvironment(ctx context.Context, id, userID string) (*entities.DinDEnvironment, error) {
+	if !s.registryReady.Load() {
+		return nil, fmt.Errorf("registry is not available")
+	}
+	env, err := s.findUserEnvironment(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if env.Status != "running" {
+		return nil, fmt.Errorf("environment is not running")
+	}
+	info, err := s.dockerSvc.InspectContainer(ctx, env.ContainerID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := info.NetworkSettings.Networks[registryNetworkName(env.ID)]; !ok {
+		return nil, fmt.Errorf("environment was created without access to the registry")
+	}
+	// The registries may have been recreated since the environment was attached, and the
+	// proxy with them
+	if err := s.attachRegistry(ctx, env.ID, env.ContainerID); err != nil {
+		return nil, err
+	}
+	if err := s.loginRegistry(ctx, env.ContainerID, userID); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// registryNamespace is the namespace of a user in the shared registry, and the user name the
+// environments of that user log in to the registry proxy with. Only that login may push to or
+// pull from it.
+func registryNamespace(userID string) (string, error) {
+	namespace := strings.ToLower(userID)
+	if !registryNamespacePattern.MatchString(namespace) {
+		return "", fmt.Errorf("no registry namespace for user %q", userID)
+	}
+	return namespace, nil
+}
+
+// splitImageTag splits name:tag, defaulting the tag to latest
+func splitImageTag(image string) (string, string) {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/env"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+)
+
+// fakeNetworkDocker keeps which containers are on which network; other docker methods are not used
+type fakeNetworkDocker struct {
+	docker.IDockerService
+	networks map[string]map[string]bool
+}
+
+func newFakeNetworkDocker() *fakeNetworkDocker {
+	return &fakeNetworkDocker{networks: map[string]map[string]bool{}}
+}
+
+func (d *fakeNetworkDocker) CreateNetwork(ctx context.Context, name string) (string, error) {
+	if d.networks[name] == nil {
+		d.networks[name] = map[string]bool{}
+	}
+	return name, nil
+}
+
+func (d *fakeNetworkDocker) RemoveNetwork(ctx context.Context, name string) error {
+	if len(d.networks[name]) > 0 {
+		return fmt.Errorf("network %s has active endpoints", name)
+	}
+	delete(d.networks, name)
+	return nil
+}
+
+func (d *fakeNetworkDocker) ConnectNetwork(ctx context.Context, name, containerID string, aliases []string) error {
+	if d.networks[name] == nil {
+		return fmt.Errorf("network %s not found", name)
+	}
+	d.networks[name][containerID] = true
+	return nil
+}
+
+func (d *fakeNetworkDocker) DisconnectNetwork(ctx context.Context, name, containerID string) error {
+	delete(d.networks[name], containerID)
+	return nil
+}
+
+func (d *fakeNetworkDocker) InspectContainer(ctx context.Context, containerID string) (*types.ContainerJSON, error) {
+	networks := map[string]*network.EndpointSettings{}
+	for name, members := range d.networks {
+		if members[containerID] {
+			networks[name] = &network.EndpointSettings{}
+		}
+	}
+	return &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: containerID, State: &types.ContainerState{Running: true}},
+		NetworkSettings:   &types.NetworkSettings{Networks: networks},
+	}, nil
+}
+
+// reachable reports whether two containers share a network
+func (d *fakeNetworkDocker) reachable(a, b string) bool {
+	for _, members := range d.networks {
+		if members[a] && members[b] {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeDinDEnvRepo struct {
+	repositories.IDinDRepository
+	envs []entities.DinDEnvironment
+}
+
+func (r *fakeDinDEnvRepo) ListAll() ([]entities.DinDEnvironment, error) {
+	return r.envs, nil
+}
+
+func (r *fakeDinDEnvRepo) FindByID(id string) (*entities.DinDEnvironment, error) {
+	for i := range r.envs {
+		if r.envs[i].ID == id {
+			return &r.envs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, fields ...zap.Field) {}
+func (nopLogger) Info(msg string, fields ...zap.Field)  {}
+func (nopLogger) Warn(msg string, fields ...zap.Field)  {}
+func (nopLogger) Error(msg string, fields ...zap.Field) {}
+func (nopLogger) Fatal(msg string, fields ...zap.Field) {}
+func (nopLogger) Sync() error                           { return nil }
+func (l nopLogger) With(fields ...zap.Field) logger.ILogger {
+	return l
+}
+
+func newRegistryTestService(envs ...entities.DinDEnvironment) (*dinDService, *fakeNetworkDocker) {
+	dockerSvc := newFakeNetworkDocker()
+	dockerSvc.CreateNetwork(context.Background(), dindRegistryNetwork)
+	dockerSvc.ConnectNetwork(context.Background(), dindRegistryNetwork, dindMirrorName, nil)
+	dockerSvc.ConnectNetwork(context.Background(), dindRegistryNetwork, dindRegistryName, nil)
+	return &dinDService{
+		dinDRepo:  &fakeDinDEnvRepo{envs: envs},
+		dockerSvc: dockerSvc,
+		logger:    nopLogger{},
+	}, dockerSvc
+}
+
+func TestAttachRegistryIsolatesEnvironments(t *testing.T) {
+	ctx := context.Background()
+	svc, dockerSvc := newRegistryTestService()
+
+	require.NoError(t, svc.attachRegistry(ctx, "a", "container-a"))
+	require.NoError(t, svc.attachRegistry(ctx, "b", "container-b"))
+	// Attaching again, as after a resize or a restart, changes nothing
+	require.NoError(t, svc.attachRegistry(ctx, "a", "container-a"))
+
+	for _, container := range []string{"container-a", "container-b"} {
+		assert.True(t, dockerSvc.reachable(container, dindMirrorName), container)
+		assert.True(t, dockerSvc.reachable(container, dindRegistryName), container)
+		assert.False(t, dockerSvc.networks[dindRegistryNetwork][container], container)
+	}
+	assert.False(t, dockerSvc.reachable("container-a", "container-b"))
+	assert.Len(t, dockerSvc.networks[registryNetworkName("a")], 3)
+
+	// Deleting an environment removes its container before its registry network
+	dockerSvc.DisconnectNetwork(ctx, registryNetworkName("b"), "container-b")
+	svc.detachRegistry(ctx, "b")
+	assert.NotContains(t, dockerSvc.networks, registryNetworkName("b"))
+	assert.True(t, dockerSvc.reachable("container-a", dindRegistryName))
+}
+
+func TestReattachEnvironmentsLeavesSharedNetwork(t *testing.T) {
+	ctx := context.Background()
+	svc, dockerSvc := newRegistryTestService(
+		entities.DinDEnvironment{ID: "a", ContainerID: "container-a"},
+		entities.DinDEnvironment{ID: "b", ContainerID: "container-b"},
+		entities.DinDEnvironment{ID: "c", ContainerID: "container-c"},
+		entities.DinDEnvironment{ID: "d"},
+	)
+	// a and b were attached by an earlier version to the network of the registries, c never was
+	dockerSvc.ConnectNetwork(ctx, dindRegistryNetwork, "container-a", nil)
+	dockerSvc.ConnectNetwork(ctx, dindRegistryNetwork, "container-b", nil)
+	dockerSvc.CreateNetwork(ctx, "dind-network-c")
+	dockerSvc.ConnectNetwork(ctx, "dind-network-c", "container-c", nil)
+	require.True(t, dockerSvc.reachable("container-a", "container-b"))
+
+	svc.reattachEnvironments(ctx)
+
+	assert.False(t, dockerSvc.reachable("container-a", "container-b"))
+	for _, container := range []string{"container-a", "container-b"} {
+		assert.True(t, dockerSvc.reachable(container, dindMirrorName), container)
+		assert.True(t, dockerSvc.reachable(container, dindRegistryName), container)
+	}
+	assert.False(t, dockerSvc.reachable("container-c", dindRegistryName))
+	assert.NotContains(t, dockerSvc.networks, registryNetworkName("c"))
+}
+
+func TestReattachEnvironmentsAfterRegistryRecreated(t *testing.T) {
+	ctx := context.Background()
+	svc, dockerSvc := newRegistryTestService(entities.DinDEnvironment{ID: "a", ContainerID: "container-a"})
+	require.NoError(t, svc.attachRegistry(ctx, "a", "container-a"))
+
+	// A recreated registry is only on the network it was created on
+	dockerSvc.DisconnectNetwork(ctx, registryNetworkName("a"), dindRegistryName)
+	require.False(t, dockerSvc.reachable("container-a", dindRegistryName))
+
+	svc.reattachEnvironments(ctx)
+	assert.True(t, dockerSvc.reachable("container-a", dindRegistryName))
+}
+
+func TestRegistryRejectsEnvironmentOfOtherUser(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newRegistryTestService(entities.DinDEnvironment{ID: "a", UserID: "alice", Status: "running", ContainerID: "container-a"})
+	svc.registryReady.Store(true)
+
+	_, err := svc.PushToRegistry(ctx, "a", "bob", dto.DinDRegistryPushRequest{Image: "app:v1"})
+	require.Error(t, err)
+	assert.Equal(t, "environment not found", err.Error())
+
+	_, err = svc.PullFromRegistry(ctx, "a", "bob", dto.DinDRegistryPullRequest{Image: "app:v1"})
+	require.Error(t, err)
+	assert.Equal(t, "environment not found", err.Error())
+}
+
+// fakeRegistryDocker adds the registry containers, by name and image, and the commands run in
+// containers to fakeNetworkDocker
+type fakeRegistryDocker struct {
+	*fakeNetworkDocker
+	images  map[string]string
+	created []docker.ContainerConfig
+	removed []string
+	execs   [][]string
+	stdins  []string
+}
+
+func (d *fakeRegistryDocker) InspectContainer(ctx context.Context, containerID string) (*types.ContainerJSON, error) {
+	image, ok := d.images[containerID]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", containerID)
+	}
+	info, _ := d.fakeNetworkDocker.InspectContainer(ctx, containerID)
+	info.Config = &container.Config{Image: image}
+	return info, nil
+}
+
+func (d *fakeRegistryDocker) RemoveContainer(ctx context.Context, containerID string) error {
+	delete(d.images, containerID)
+	d.removed = append(d.removed, containerID)
+	return nil
+}
+
+func (d *fakeRegistryDocker) CreateVolume(ctx context.Context, volumeName string) error {
+	return nil
+}
+
+func (d *fakeRegistryDocker) CreateContainer(ctx context.Context, config docker.ContainerConfig) (string, error) {
+	d.images[config.Name] = config.Image
+	d.created = append(d.created, config)
+	return config.Name, nil
+}
+
+func (d *fakeRegistryDocker) StartContainer(ctx context.Context, containerID string) error {
+	return nil
+}
+
+func (d *fakeRegistryDocker) ExecStream(ctx context.Context, containerID string, cmd []string, stdin io.Reader, stdout io.Writer) error {
+	d.execs = append(d.execs, append([]string{containerID}, cmd...))
+	input := ""
+	if stdin != nil {
+		data, _ := io.ReadAll(stdin)
+		input = string(data)
+	}
+	d.stdins = append(d.stdins, input)
+	return nil
+}
+
+func TestEnsureRegistryReplacesUnauthenticatedRegistry(t *testing.T) {
+	_, networkDocker := newRegistryTestService()
+	dockerSvc := &fakeRegistryDocker{
+		fakeNetworkDocker: networkDocker,
+		// An earlier version ran the registry itself under the name of the proxy
+		images: map[string]string{dindMirrorName: dindRegistryImage, dindRegistryName: dindRegistryImage},
+	}
+	svc := &dinDService{dinDRepo: &fakeDinDEnvRepo{}, dockerSvc: dockerSvc, logger: nopLogger{}}
+
+	require.NoError(t, svc.ensureRegistry(context.Background()))
+
+	assert.Equal(t, []string{dindRegistryName}, dockerSvc.removed)
+	require.Len(t, dockerSvc.created, 2)
+	store, proxy := dockerSvc.created[0], dockerSvc.created[1]
+	assert.Equal(t, dindRegistryStoreName, store.Name)
+	assert.Equal(t, dindRegistryImage, store.Image)
+	assert.Equal(t, map[string]string{dindRegistryName + "-data": "/var/lib/registry"}, store.Volumes, "images pushed before are kept")
+	assert.Equal(t, dindRegistryName, proxy.Name)
+	assert.Equal(t, dindRegistryProxyImage, proxy.Image)
+	assert.Equal(t, registryProxyCmd, proxy.Cmd)
+	assert.Empty(t, proxy.Volumes)
+
+	// Up to date registries are left alone
+	dockerSvc.created, dockerSvc.removed = nil, nil
+	require.NoError(t, svc.ensureRegistry(context.Background()))
+	assert.Empty(t, dockerSvc.created)
+	assert.Empty(t, dockerSvc.removed)
+}
+
+// sshaMatches checks a password against an {SSHA} htpasswd hash the way nginx does
+func sshaMatches(hash, password string) bool {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(hash, "{SSHA}"))
+	if err != nil || len(raw) <= sha1.Size {
+		return false
+	}
+	digest := sha1.Sum(append([]byte(password), raw[sha1.Size:]...))
+	return bytes.Equal(digest[:], raw[:sha1.Size])
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	svc := &dinDService{dindConfig: env.DinDEnv{RegistrySecret: "secret"}}
+
+	alicePassword, aliceLine := svc.registryCredentials("alice")
+	again, sameLine := svc.registryCredentials("alice")
+	assert.Equal(t, alicePassword, again, "credentials survive restarts")
+	assert.Equal(t, aliceLine, sameLine)
+
+	bobPassword, bobLine := svc.registryCredentials("bob")
+	assert.NotEqual(t, alicePassword, bobPassword)
+
+	user, hash, ok := strings.Cut(aliceLine, ":")
+	require.True(t, ok)
+	assert.Equal(t, "alice", user)
+	assert.True(t, sshaMatches(hash, alicePassword))
+	assert.False(t, sshaMatches(hash, bobPassword))
+	assert.NotContains(t, aliceLine, alicePassword)
+	assert.True(t, strings.HasPrefix(bobLine, "bob:{SSHA}"))
+
+	other := &dinDService{dindConfig: env.DinDEnv{RegistrySecret: "other"}}
+	otherPassword, _ := other.registryCredentials("alice")
+	assert.NotEqual(t, alicePassword, otherPassword)
+}
+
+func TestLoginRegistry(t *testing.T) {
+	_, networkDocker := newRegistryTestService()
+	dockerSvc := &fakeRegistryDocker{fakeNetworkDocker: networkDocker, images: map[string]string{}}
+	svc := &dinDService{dockerSvc: dockerSvc, logger: nopLogger{}, dindConfig: env.DinDEnv{RegistrySecret: "secret"}}
+
+	require.NoError(t, svc.loginRegistry(context.Background(), "container-a", "Alice"))
+
+	password, htpasswdLine := svc.registryCredentials("alice")
+	require.Len(t, dockerSvc.execs, 2)
+	assert.Equal(t, []string{dindRegistryName, "sh", "-c", registryAddUserScript, "alice", htpasswdLine}, dockerSvc.execs[0])
+	assert.Equal(t, []string{"container-a", "docker", "login", "--username", "alice", "--password-stdin", svc.registryHost()}, dockerSvc.execs[1])
+	assert.Equal(t, password, dockerSvc.stdins[1], "the password is not on the command line")
+
+	assert.Error(t, svc.loginRegistry(context.Background(), "container-b", ""))
+	assert.Len(t, dockerSvc.execs, 2)
+}
+
+func TestSplitImageTag(t *testing.T) {
+	for image, want := range map[string][2]string{
+		"nginx":                       {"nginx", "latest"},
+		"nginx:1.25":                  {"nginx", "1.25"},
+		"library/nginx:alpine":        {"library/nginx", "alpine"},
+		"localhost:5000/app":          {"localhost:5000/app", "latest"},
+		"localhost:5000/app:v1":       {"localhost:5000/app", "v1"},
+		"iaas-dind-registry:5000/u/x": {"iaas-dind-registry:5000/u/x", "latest"},
+	} {
+		name, tag := splitImageTag(image)
+		assert.Equal(t, want, [2]string{name, tag}, image)
+	}
+}
+
+func TestRegistryNamespace(t *testing.T) {
+	namespace, err := registryNamespace("User-42")
+	require.NoError(t, err)
+	assert.Equal(t, "user-42", namespace)
+
+	namespace, err = registryNamespace("2f1c7a9e-0b1d-4c55-9a57-0e3c1d2b4f6a")
+	require.NoError(t, err)
+	assert.Equal(t, "2f1c7a9e-0b1d-4c55-9a57-0e3c1d2b4f6a", namespace)
+
+	for _, userID := range []string{"", "../admin", "a/b", "-lead", "user 1", "user:1"} {
+		_, err := registryNamespace(userID)
+		assert.Error(t, err, userID)
+	}
+}
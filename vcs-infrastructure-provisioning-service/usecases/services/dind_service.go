@@ -3,13 +3,18 @@ package services
 import (
 	"context"
 	"fmt"
+	"io"
+	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/kafka"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/env"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
 	"github.com/google/uuid"
@@ -25,13 +30,55 @@ type IDinDService interface {
 	DeleteEnvironment(ctx context.Context, id string) error
 	StartEnvironment(ctx context.Context, id string) error
 	StopEnvironment(ctx context.Context, id string) error
+	ResizeEnvironment(ctx context.Context, id string, req dto.ResizeDinDEnvironmentRequest) (*dto.DinDEnvironmentInfo, error)
+	ExtendEnvironment(ctx context.Context, id string, req dto.ExtendDinDEnvironmentRequest) (*dto.DinDEnvironmentInfo, error)
+	StartTTLReaper(ctx context.Context)
 
 	// Docker operations inside DinD
-	ExecCommand(ctx context.Context, id string, req dto.ExecCommandRequest) (*dto.ExecCommandResponse, error)
+	ExecCommand(ctx context.Context, id, userID string, req dto.ExecCommandRequest) (*dto.ExecCommandResponse, error)
 	BuildImage(ctx context.Context, id string, req dto.BuildImageRequest) (*dto.BuildImageResponse, error)
 	RunCompose(ctx context.Context, id string, req dto.ComposeRequest) (*dto.ComposeResponse, error)
 	PullImage(ctx context.Context, id string, req dto.PullImageRequest) (*dto.PullImageResponse, error)
 
+	// Snapshots
+	CreateSnapshot(ctx context.Context, id, userID string, req dto.CreateDinDSnapshotRequest) (*dto.DinDSnapshotInfo, error)
+	GetSnapshot(ctx context.Context, snapshotID, userID string) (*dto.DinDSnapshotInfo, error)
+	ListSnapshots(ctx context.Context, userID string) (*dto.DinDSnapshotListResponse, error)
+	ListEnvironmentSnapshots(ctx context.Context, id, userID string) (*dto.DinDSnapshotListResponse, error)
+	DeleteSnapshot(ctx context.Context, snapshotID, userID string) error
+	RecoverSnapshots(ctx context.Context)
+
+	// File transfer
+	UploadFile(ctx context.Context, id, userID string, req dto.DinDUploadRequest, name string, size int64, content io.Reader) (*dto.DinDUploadResponse, error)
+	DownloadFile(ctx context.Context, id, userID string, req dto.DinDDownloadRequest) (*DinDDownload, error)
+
+	// Interactive terminal
+	OpenTerminal(ctx context.Context, id, userID string, req dto.DinDTerminalRequest) (*DinDTerminal, error)
+	CloseTerminal(ctx context.Context, terminal *DinDTerminal, reason string) int
+	ListTerminalSessions(ctx context.Context, id, userID string) ([]dto.DinDTerminalSessionInfo, error)
+	GetTerminalSession(ctx context.Context, id, userID, sessionID string) (*dto.DinDTerminalSessionInfo, error)
+
+	// Command history
+	GetCommandHistory(ctx context.Context, id, userID string, query dto.DinDHistoryQuery) (*dto.DinDCommandHistoryResponse, error)
+	ExportCommandHistory(ctx context.Context, id, userID string, query dto.DinDHistoryQuery, w io.Writer) error
+	StartHistoryRetention(ctx context.Context)
+
+	// Background jobs
+	StartBuildJob(ctx context.Context, id, userID string, req dto.BuildImageRequest) (*dto.DinDJobInfo, error)
+	StartBuildContextJob(ctx context.Context, id, userID string, req dto.BuildContextRequest, buildContext io.Reader) (*dto.DinDJobInfo, error)
+	StartPullJob(ctx context.Context, id, userID string, req dto.PullImageRequest) (*dto.DinDJobInfo, error)
+	StartComposeJob(ctx context.Context, id, userID string, req dto.ComposeRequest) (*dto.DinDJobInfo, error)
+	ListJobs(ctx context.Context, id, userID string) ([]dto.DinDJobInfo, error)
+	GetJob(ctx context.Context, id, userID, jobID string) (*dto.DinDJobInfo, error)
+	StreamJob(ctx context.Context, id, userID, jobID string) (*DinDJobStream, error)
+	CancelJob(ctx context.Context, id, userID, jobID string) error
+
+	// Shared registry
+	StartRegistry(ctx context.Context)
+	GetRegistry(ctx context.Context, userID string) (*dto.DinDRegistryInfo, error)
+	PushToRegistry(ctx context.Context, id, userID string, req dto.DinDRegistryPushRequest) (*dto.DinDJobInfo, error)
+	PullFromRegistry(ctx context.Context, id, userID string, req dto.DinDRegistryPullRequest) (*dto.DinDJobInfo, error)
+
 	// Info retrieval
 	ListContainers(ctx context.Context, id string) (*dto.ListContainersResponse, error)
 	ListImages(ctx context.Context, id string) (*dto.ListImagesResponse, error)
@@ -45,6 +92,18 @@ type dinDService struct {
 	dockerSvc     docker.IDockerService
 	kafkaProducer kafka.IKafkaProducer
 	logger        logger.ILogger
+	dindConfig    env.DinDEnv
+
+	jobsMu sync.Mutex
+	jobs   map[string]*dindJobRun
+
+	// snapshotsMu guards activeSnapshots, the snapshots this process is still taking
+	snapshotsMu     sync.Mutex
+	activeSnapshots map[string]bool
+
+	registryReady atomic.Bool
+	// registryMu serializes changes to the htpasswd file of the registry proxy
+	registryMu sync.Mutex
 }
 
 func NewDinDService(
@@ -53,6 +112,7 @@ func NewDinDService(
 	dockerSvc docker.IDockerService,
 	kafkaProducer kafka.IKafkaProducer,
 	logger logger.ILogger,
+	dindConfig env.DinDEnv,
 ) IDinDService {
 	return &dinDService{
 		dinDRepo:      dinDRepo,
@@ -60,6 +120,8 @@ func NewDinDService(
 		dockerSvc:     dockerSvc,
 		kafkaProducer: kafkaProducer,
 		logger:        logger,
+		dindConfig:    dindConfig,
+		jobs:          make(map[string]*dindJobRun),
 	}
 }
 
@@ -75,6 +137,18 @@ func (s *dinDService) getResourceLimits(plan string) (string, string) {
 	}
 }
 
+// getPlanResources returns docker resource limits (nanocores, bytes) based on plan
+func (s *dinDService) getPlanResources(plan string) docker.ResourceConfig {
+	switch plan {
+	case "small":
+		return docker.ResourceConfig{CPULimit: 1000000000, MemoryLimit: 1073741824} // 1 CPU, 1GB
+	case "large":
+		return docker.ResourceConfig{CPULimit: 4000000000, MemoryLimit: 4294967296} // 4 CPUs, 4GB
+	default: // medium
+		return docker.ResourceConfig{CPULimit: 2000000000, MemoryLimit: 2147483648} // 2 CPUs, 2GB
+	}
+}
+
 // CreateEnvironment creates a new Docker-in-Docker environment
 func (s *dinDService) CreateEnvironment(ctx context.Context, userID string, req dto.CreateDinDEnvironmentRequest) (*dto.DinDEnvironmentInfo, error) {
 	infraID := uuid.New().String()
@@ -84,6 +158,18 @@ func (s *dinDService) CreateEnvironment(ctx context.Context, userID string, req
 		zap.String("name", req.Name),
 		zap.String("user_id", userID))
 
+	// A snapshot to restore is checked before anything is created
+	var snapshot *entities.DinDSnapshot
+	if req.FromSnapshot != "" {
+		var err error
+		if snapshot, err = s.readySnapshot(req.FromSnapshot, userID); err != nil {
+			return nil, err
+		}
+		if req.ResourcePlan == "" {
+			req.ResourcePlan = snapshot.ResourcePlan
+		}
+	}
+
 	// Create infrastructure record
 	infra := &entities.Infrastructure{
 		ID:     infraID,
@@ -116,6 +202,7 @@ func (s *dinDService) CreateEnvironment(ctx context.Context, userID string, req
 		Description:      req.Description,
 		AutoCleanup:      req.AutoCleanup,
 		TTLHours:         req.TTLHours,
+		SnapshotID:       req.FromSnapshot,
 		UserID:           userID,
 	}
 
@@ -140,39 +227,34 @@ func (s *dinDService) CreateEnvironment(ctx context.Context, userID string, req
 	// Create DinD container
 	containerName := fmt.Sprintf("iaas-dind-%s", envID)
 
-	// Convert limits to proper format
-	cpuNano := int64(0)
-	memBytes := int64(0)
-	switch cpuLimit {
-	case "1":
-		cpuNano = 1000000000 // 1 CPU
-	case "2":
-		cpuNano = 2000000000 // 2 CPUs
-	case "4":
-		cpuNano = 4000000000 // 4 CPUs
-	}
-	switch memoryLimit {
-	case "1g":
-		memBytes = 1073741824 // 1GB
-	case "2g":
-		memBytes = 2147483648 // 2GB
-	case "4g":
-		memBytes = 4294967296 // 4GB
-	}
-
 	containerConfig := docker.ContainerConfig{
 		Name:  containerName,
 		Image: "docker:dind", // Official Docker-in-Docker image
 		Env: []string{
 			"DOCKER_TLS_CERTDIR=", // Disable TLS for simplicity
 		},
-		Network: networkName,
-		Resources: docker.ResourceConfig{
-			CPULimit:    cpuNano,
-			MemoryLimit: memBytes,
-		},
+		Network:    networkName,
+		Resources:  s.getPlanResources(req.ResourcePlan),
 		Privileged: true, // Required for DinD
 	}
+	daemonArgs := s.daemonArgs()
+	containerConfig.Cmd = daemonArgs
+
+	if snapshot != nil {
+		dataVolume, err := s.restoreSnapshotData(ctx, snapshot, envID)
+		if err != nil {
+			s.logger.Error("failed to restore DinD snapshot", zap.String("snapshot_id", snapshot.ID), zap.Error(err))
+			env.Status = "failed"
+			s.dinDRepo.Update(env)
+			infra.Status = entities.StatusFailed
+			s.infraRepo.Update(infra)
+			return nil, err
+		}
+		env.DataVolume = dataVolume
+		containerConfig.Image = snapshot.Image
+		containerConfig.Cmd = append(append([]string{}, dindRestoredCmd...), daemonArgs...)
+		containerConfig.Volumes = map[string]string{dataVolume: dindDataDir}
+	}
 
 	containerID, err := s.dockerSvc.CreateDinDContainer(ctx, containerConfig)
 	if err != nil {
@@ -187,6 +269,13 @@ func (s *dinDService) CreateEnvironment(ctx context.Context, userID string, req
 	env.ContainerID = containerID
 	env.ContainerName = containerName
 
+	// The registry mirror and registry are reached over a network of the environment
+	if daemonArgs != nil {
+		if err := s.attachRegistry(ctx, envID, containerID); err != nil {
+			s.logger.Warn("failed to connect DinD environment to registry network", zap.Error(err))
+		}
+	}
+
 	// Start the container
 	if err := s.dockerSvc.StartContainer(ctx, containerID); err != nil {
 		s.logger.Error("failed to start DinD container", zap.Error(err))
@@ -202,18 +291,18 @@ func (s *dinDService) CreateEnvironment(ctx context.Context, userID string, req
 	if err := s.waitForDinDReady(ctx, containerID, 30*time.Second); err != nil {
 		s.logger.Warn("Docker daemon may not be fully ready", zap.Error(err))
 	}
-
-	// Get container IP
-	if containerInfo, err := s.dockerSvc.InspectContainer(ctx, containerID); err == nil {
-		for _, network := range containerInfo.NetworkSettings.Networks {
-			if network.IPAddress != "" {
-				env.IPAddress = network.IPAddress
-				env.DockerHost = fmt.Sprintf("tcp://%s:2375", network.IPAddress)
-				break
-			}
+	if snapshot != nil {
+		s.startSnapshotContainers(ctx, containerID, snapshot)
+	}
+	if daemonArgs != nil && userID != "" {
+		if err := s.loginRegistry(ctx, containerID, userID); err != nil {
+			s.logger.Warn("failed to log DinD environment in to the registry", zap.String("env_id", envID), zap.Error(err))
 		}
 	}
 
+	// Get container IP
+	s.refreshAddress(ctx, env)
+
 	env.Status = "running"
 	s.dinDRepo.Update(env)
 
@@ -230,6 +319,16 @@ func (s *dinDService) CreateEnvironment(ctx context.Context, userID string, req
 	return s.GetEnvironment(ctx, envID)
 }
 
+// findUserEnvironment loads an environment owned by userID. Environments of other users are
+// reported as not found so that their IDs cannot be probed.
+func (s *dinDService) findUserEnvironment(id, userID string) (*entities.DinDEnvironment, error) {
+	env, err := s.dinDRepo.FindByID(id)
+	if err != nil || (env.UserID != "" && env.UserID != userID) {
+		return nil, fmt.Errorf("environment not found")
+	}
+	return env, nil
+}
+
 // GetEnvironment retrieves environment info
 func (s *dinDService) GetEnvironment(ctx context.Context, id string) (*dto.DinDEnvironmentInfo, error) {
 	env, err := s.dinDRepo.FindByID(id)
@@ -294,17 +393,25 @@ func (s *dinDService) DeleteEnvironment(ctx context.Context, id string) error {
 	if err != nil {
 		return err
 	}
+	s.cancelJobs(id)
 
 	// Stop and remove container
 	if env.ContainerID != "" {
 		s.dockerSvc.StopContainer(ctx, env.ContainerID)
 		s.dockerSvc.RemoveContainer(ctx, env.ContainerID)
 	}
+	if env.DataVolume != "" {
+		s.dockerSvc.RemoveVolume(ctx, env.DataVolume)
+	}
+	s.dockerSvc.RemoveImage(ctx, fmt.Sprintf("%s:%s", dindResizeImage, id))
 
 	// Remove network
 	if env.NetworkID != "" {
 		s.dockerSvc.RemoveNetwork(ctx, env.NetworkID)
 	}
+	if s.dindConfig.RegistryEnabled {
+		s.detachRegistry(ctx, id)
+	}
 
 	// Delete from database
 	if err := s.dinDRepo.Delete(id); err != nil {
@@ -329,6 +436,9 @@ func (s *dinDService) StartEnvironment(ctx context.Context, id string) error {
 	if err != nil {
 		return err
 	}
+	if !env.ExpiredAt.IsZero() {
+		return fmt.Errorf("environment has expired, extend it to start it again")
+	}
 
 	if err := s.dockerSvc.StartContainer(ctx, env.ContainerID); err != nil {
 		return err
@@ -347,6 +457,7 @@ func (s *dinDService) StopEnvironment(ctx context.Context, id string) error {
 	if err != nil {
 		return err
 	}
+	s.cancelJobs(id)
 
 	if err := s.dockerSvc.StopContainer(ctx, env.ContainerID); err != nil {
 		return err
@@ -359,8 +470,191 @@ func (s *dinDService) StopEnvironment(ctx context.Context, id string) error {
 	return nil
 }
 
+// ResizeEnvironment switches the resource plan of an environment. Limits are updated in place
+// when possible; otherwise, or with force_recreate, the container is recreated from a commit of
+// itself with its docker data kept in a volume, so images and containers survive.
+func (s *dinDService) ResizeEnvironment(ctx context.Context, id string, req dto.ResizeDinDEnvironmentRequest) (*dto.DinDEnvironmentInfo, error) {
+	env, err := s.dinDRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if env.ResourcePlan == req.ResourcePlan && !req.ForceRecreate {
+		return nil, fmt.Errorf("environment already uses the %s plan", req.ResourcePlan)
+	}
+
+	resources := s.getPlanResources(req.ResourcePlan)
+	method := "live"
+	if req.ForceRecreate {
+		method = "recreate"
+	} else if err := s.dockerSvc.UpdateContainerResources(ctx, env.ContainerID, resources); err != nil {
+		s.logger.Warn("live resize failed, recreating DinD environment", zap.String("id", id), zap.Error(err))
+		method = "recreate"
+	}
+	if method == "recreate" {
+		// Recreating outlives a client that gives up waiting
+		if err := s.recreateEnvironment(context.WithoutCancel(ctx), env, resources); err != nil {
+			return nil, fmt.Errorf("failed to resize environment: %w", err)
+		}
+	}
+
+	s.logger.Info("DinD environment resized",
+		zap.String("id", id),
+		zap.String("from_plan", env.ResourcePlan),
+		zap.String("to_plan", req.ResourcePlan),
+		zap.String("method", method))
+
+	env.ResourcePlan = req.ResourcePlan
+	env.CPULimit, env.MemoryLimit = s.getResourceLimits(req.ResourcePlan)
+	s.dinDRepo.Update(env)
+
+	s.publishEvent(ctx, env, "resized")
+	return s.toDTO(env), nil
+}
+
+// recreateEnvironment replaces the container of an environment with one on new resources. The
+// old container is committed to an image and its /var/lib/docker moved to a named volume first;
+// it is only removed once the new one is up, and restored if anything fails before that.
+func (s *dinDService) recreateEnvironment(ctx context.Context, env *entities.DinDEnvironment, resources docker.ResourceConfig) error {
+	s.cancelJobs(env.ID)
+
+	oldInfo, err := s.dockerSvc.InspectContainer(ctx, env.ContainerID)
+	if err != nil {
+		return err
+	}
+	wasRunning := oldInfo.State.Running
+	var innerContainers []string
+	if wasRunning {
+		// Containers the daemon would not restart itself are started again afterwards
+		output, err := s.dockerSvc.ExecCommand(ctx, env.ContainerID, []string{"docker", "ps", "-q", "--no-trunc"})
+		if err != nil {
+			return fmt.Errorf("failed to list running containers: %w", err)
+		}
+		innerContainers = strings.Fields(output)
+	}
+
+	oldVolume, err := s.dataVolume(ctx, env)
+	if err != nil {
+		return err
+	}
+	if wasRunning {
+		if err := s.dockerSvc.StopContainer(ctx, env.ContainerID); err != nil {
+			return fmt.Errorf("failed to stop environment: %w", err)
+		}
+	}
+	restartOld := func() {
+		if wasRunning {
+			s.dockerSvc.StartContainer(ctx, env.ContainerID)
+		}
+	}
+
+	image := fmt.Sprintf("%s:%s", dindResizeImage, env.ID)
+	previousImage := ""
+	if imageInfo, err := s.dockerSvc.InspectImage(ctx, image); err == nil {
+		previousImage = imageInfo.ID
+	}
+	if _, err := s.dockerSvc.CommitContainer(ctx, env.ContainerID, image, map[string]string{"iaas.dind.environment": env.ID}); err != nil {
+		restartOld()
+		return fmt.Errorf("failed to commit environment: %w", err)
+	}
+
+	// The anonymous volume of a new environment goes away with its container
+	volume := oldVolume
+	if env.DataVolume == "" {
+		volume = fmt.Sprintf("iaas-dind-data-%s", env.ID)
+		if _, err := s.copyDataVolume(ctx, oldVolume, volume); err != nil {
+			restartOld()
+			return fmt.Errorf("failed to copy %s: %w", dindDataDir, err)
+		}
+	}
+
+	oldName := env.ContainerName + "-resizing"
+	if err := s.dockerSvc.RenameContainer(ctx, env.ContainerID, oldName); err != nil {
+		if volume != oldVolume {
+			s.dockerSvc.RemoveVolume(ctx, volume)
+		}
+		restartOld()
+		return err
+	}
+	rollback := func(newID string, cause error) error {
+		if newID != "" {
+			s.dockerSvc.RemoveContainer(ctx, newID)
+		}
+		if volume != oldVolume {
+			s.dockerSvc.RemoveVolume(ctx, volume)
+		}
+		s.dockerSvc.RenameContainer(ctx, env.ContainerID, env.ContainerName)
+		restartOld()
+		return cause
+	}
+
+	daemonArgs := s.daemonArgs()
+	containerID, err := s.dockerSvc.CreateDinDContainer(ctx, docker.ContainerConfig{
+		Name:       env.ContainerName,
+		Image:      image,
+		Env:        []string{"DOCKER_TLS_CERTDIR="},
+		Network:    fmt.Sprintf("dind-network-%s", env.ID),
+		Resources:  resources,
+		Privileged: true,
+		Cmd:        append(append([]string{}, dindRestoredCmd...), daemonArgs...),
+		Volumes:    map[string]string{volume: dindDataDir},
+	})
+	if err != nil {
+		return rollback("", fmt.Errorf("failed to create container: %w", err))
+	}
+	if daemonArgs != nil {
+		if err := s.attachRegistry(ctx, env.ID, containerID); err != nil {
+			s.logger.Warn("failed to connect DinD environment to registry network", zap.Error(err))
+		}
+	}
+	if wasRunning {
+		if err := s.dockerSvc.StartContainer(ctx, containerID); err != nil {
+			return rollback(containerID, fmt.Errorf("failed to start container: %w", err))
+		}
+		if err := s.waitForDinDReady(ctx, containerID, 2*time.Minute); err != nil {
+			return rollback(containerID, err)
+		}
+		if len(innerContainers) > 0 {
+			output, exitCode, err := s.dockerSvc.ExecCommandWithExitCode(ctx, containerID, append([]string{"docker", "start"}, innerContainers...))
+			if err != nil || exitCode != 0 {
+				s.logger.Warn("failed to start containers after resize",
+					zap.String("env_id", env.ID),
+					zap.String("output", strings.TrimSpace(output)),
+					zap.Error(err))
+			}
+		}
+	}
+
+	if err := s.dockerSvc.RemoveContainer(ctx, env.ContainerID); err != nil {
+		s.logger.Warn("failed to remove old DinD container", zap.String("container_id", env.ContainerID), zap.Error(err))
+	}
+	if previousImage != "" {
+		s.dockerSvc.RemoveImage(ctx, previousImage)
+	}
+
+	env.ContainerID = containerID
+	env.DataVolume = volume
+	s.refreshAddress(ctx, env)
+	return nil
+}
+
+// refreshAddress records the address of the environment on its own network
+func (s *dinDService) refreshAddress(ctx context.Context, env *entities.DinDEnvironment) {
+	containerInfo, err := s.dockerSvc.InspectContainer(ctx, env.ContainerID)
+	if err != nil {
+		return
+	}
+	for name, network := range containerInfo.NetworkSettings.Networks {
+		if network.IPAddress != "" && name != dindRegistryNetwork && name != registryNetworkName(env.ID) {
+			env.IPAddress = network.IPAddress
+			env.DockerHost = fmt.Sprintf("tcp://%s:2375", network.IPAddress)
+			return
+		}
+	}
+}
+
 // ExecCommand executes a docker command inside the DinD environment
-func (s *dinDService) ExecCommand(ctx context.Context, id string, req dto.ExecCommandRequest) (*dto.ExecCommandResponse, error) {
+func (s *dinDService) ExecCommand(ctx context.Context, id, userID string, req dto.ExecCommandRequest) (*dto.ExecCommandResponse, error) {
 	env, err := s.dinDRepo.FindByID(id)
 	if err != nil {
 		return nil, err
@@ -379,10 +673,9 @@ func (s *dinDService) ExecCommand(ctx context.Context, id string, req dto.ExecCo
 		return nil, fmt.Errorf("empty command")
 	}
 
-	output, err := s.dockerSvc.ExecCommand(ctx, env.ContainerID, cmd)
+	output, exitCode, err := s.dockerSvc.ExecCommandWithExitCode(ctx, env.ContainerID, cmd)
 
 	duration := time.Since(startTime)
-	exitCode := 0
 	if err != nil {
 		exitCode = 1
 		output = err.Error()
@@ -392,6 +685,7 @@ func (s *dinDService) ExecCommand(ctx context.Context, id string, req dto.ExecCo
 	history := &entities.DinDCommandHistory{
 		ID:            uuid.New().String(),
 		EnvironmentID: id,
+		UserID:        userID,
 		Command:       req.Command,
 		Output:        output,
 		ExitCode:      exitCode,
@@ -482,28 +776,35 @@ func (s *dinDService) RunCompose(ctx context.Context, id string, req dto.Compose
 		return nil, fmt.Errorf("environment is not running")
 	}
 
-	// Create docker-compose.yml inside container
-	composeCmd := []string{"sh", "-c", fmt.Sprintf("mkdir -p /compose && cat > /compose/docker-compose.yml << 'COMPOSEFILE'\n%s\nCOMPOSEFILE", req.ComposeContent)}
-	if _, err := s.dockerSvc.ExecCommand(ctx, env.ContainerID, composeCmd); err != nil {
-		return nil, fmt.Errorf("failed to create docker-compose.yml: %w", err)
+	composeFile, err := composeFilePath(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create docker-compose.yml inside container, unless the project was uploaded
+	if req.ComposeContent != "" {
+		composeCmd := []string{"sh", "-c", fmt.Sprintf("mkdir -p %s && cat > %s << 'COMPOSEFILE'\n%s\nCOMPOSEFILE", path.Dir(composeFile), composeFile, req.ComposeContent)}
+		if _, err := s.dockerSvc.ExecCommand(ctx, env.ContainerID, composeCmd); err != nil {
+			return nil, fmt.Errorf("failed to create docker-compose.yml: %w", err)
+		}
 	}
 
 	// Run docker-compose command
 	var cmd []string
 	switch req.Action {
 	case "up":
-		cmd = []string{"docker-compose", "-f", "/compose/docker-compose.yml", "up"}
+		cmd = []string{"docker-compose", "-f", composeFile, "up"}
 		if req.Detach {
 			cmd = append(cmd, "-d")
 		}
 	case "down":
-		cmd = []string{"docker-compose", "-f", "/compose/docker-compose.yml", "down"}
+		cmd = []string{"docker-compose", "-f", composeFile, "down"}
 	case "restart":
-		cmd = []string{"docker-compose", "-f", "/compose/docker-compose.yml", "restart"}
+		cmd = []string{"docker-compose", "-f", composeFile, "restart"}
 	case "logs":
-		cmd = []string{"docker-compose", "-f", "/compose/docker-compose.yml", "logs"}
+		cmd = []string{"docker-compose", "-f", composeFile, "logs"}
 	case "ps":
-		cmd = []string{"docker-compose", "-f", "/compose/docker-compose.yml", "ps"}
+		cmd = []string{"docker-compose", "-f", composeFile, "ps"}
 	default:
 		return nil, fmt.Errorf("unknown action: %s", req.Action)
 	}
@@ -516,7 +817,7 @@ func (s *dinDService) RunCompose(ctx context.Context, id string, req dto.Compose
 	success := err == nil
 
 	// Get list of services
-	servicesCmd := []string{"docker-compose", "-f", "/compose/docker-compose.yml", "config", "--services"}
+	servicesCmd := []string{"docker-compose", "-f", composeFile, "config", "--services"}
 	servicesOutput, _ := s.dockerSvc.ExecCommand(ctx, env.ContainerID, servicesCmd)
 	services := strings.Fields(servicesOutput)
 
@@ -735,6 +1036,7 @@ func (s *dinDService) toDTO(env *entities.DinDEnvironment) *dto.DinDEnvironmentI
 		Description:      env.Description,
 		AutoCleanup:      env.AutoCleanup,
 		TTLHours:         env.TTLHours,
+		SnapshotID:       env.SnapshotID,
 		CreatedAt:        env.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:        env.UpdatedAt.Format(time.RFC3339),
 	}
@@ -742,6 +1044,10 @@ func (s *dinDService) toDTO(env *entities.DinDEnvironment) *dto.DinDEnvironmentI
 	if !env.ExpiresAt.IsZero() {
 		info.ExpiresAt = env.ExpiresAt.Format(time.RFC3339)
 	}
+	if !env.ExpiredAt.IsZero() {
+		info.ExpiredAt = env.ExpiredAt.Format(time.RFC3339)
+		info.DeletesAt = env.ExpiredAt.Add(s.dindConfig.TTLGracePeriod).Format(time.RFC3339)
+	}
 
 	return info
 }
@@ -763,6 +1069,12 @@ func (s *dinDService) publishEvent(ctx context.Context, env *entities.DinDEnviro
 			"resource_plan": env.ResourcePlan,
 		},
 	}
+	if !env.ExpiresAt.IsZero() {
+		event.Metadata["expires_at"] = env.ExpiresAt.Format(time.RFC3339)
+	}
+	if !env.ExpiredAt.IsZero() {
+		event.Metadata["deletes_at"] = env.ExpiredAt.Add(s.dindConfig.TTLGracePeriod).Format(time.RFC3339)
+	}
 
 	s.kafkaProducer.PublishEvent(ctx, event)
 }
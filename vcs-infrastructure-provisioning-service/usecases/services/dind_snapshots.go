@@ -0,0 +1,400 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+)
+
+const (
+	dindImage         = "docker:dind"
+	dindDataDir       = "/var/lib/docker"
+	dindSnapshotImage = "iaas-dind-snapshot"
+	dindResizeImage   = "iaas-dind-resize"
+
+	dindSnapshotCreating = "creating"
+	dindSnapshotReady    = "ready"
+	dindSnapshotFailed   = "failed"
+)
+
+// dindRestoredCmd starts dockerd in a container created from a snapshot. The committed
+// filesystem still has the pid file and runtime state of the daemon it was taken from. Daemon
+// flags go after it, following a placeholder for $0.
+var dindRestoredCmd = []string{"sh", "-c", `rm -rf /run/docker.pid /run/docker /run/containerd && exec dockerd-entrypoint.sh "$@"`, "sh"}
+
+// CreateSnapshot starts a snapshot of an environment: its container filesystem is committed to
+// an image and its /var/lib/docker copied to a volume. A running environment is paused
+// meanwhile, so the copy is consistent and its containers carry on afterwards.
+func (s *dinDService) CreateSnapshot(ctx context.Context, id, userID string, req dto.CreateDinDSnapshotRequest) (*dto.DinDSnapshotInfo, error) {
+	env, err := s.findUserEnvironment(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if env.ContainerID == "" {
+		return nil, fmt.Errorf("environment has no container")
+	}
+	existing, err := s.dinDRepo.ListSnapshotsByEnvironment(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range existing {
+		if snapshot.Status == dindSnapshotCreating {
+			return nil, fmt.Errorf("snapshot %s of this environment is still being created", snapshot.ID)
+		}
+	}
+	dataVolume, err := s.dataVolume(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &entities.DinDSnapshot{
+		ID:            uuid.New().String(),
+		EnvironmentID: id,
+		UserID:        userID,
+		Name:          req.Name,
+		Description:   req.Description,
+		Status:        dindSnapshotCreating,
+		ResourcePlan:  env.ResourcePlan,
+	}
+	if err := s.dinDRepo.CreateSnapshot(snapshot); err != nil {
+		return nil, fmt.Errorf("failed to record snapshot: %w", err)
+	}
+
+	s.logger.Info("creating DinD snapshot",
+		zap.String("env_id", id),
+		zap.String("snapshot_id", snapshot.ID),
+		zap.String("data_volume", dataVolume))
+	s.setSnapshotActive(snapshot.ID, true)
+	go s.takeSnapshot(env, dataVolume, snapshot)
+
+	return toSnapshotInfo(snapshot), nil
+}
+
+func (s *dinDService) takeSnapshot(env *entities.DinDEnvironment, dataVolume string, snapshot *entities.DinDSnapshot) {
+	ctx := context.Background()
+	start := time.Now()
+	defer s.setSnapshotActive(snapshot.ID, false)
+
+	if err := s.captureSnapshot(ctx, env, dataVolume, snapshot); err != nil {
+		s.logger.Error("failed to create DinD snapshot", zap.String("snapshot_id", snapshot.ID), zap.Error(err))
+		s.removeSnapshotArtifacts(ctx, snapshot)
+		snapshot.Status = dindSnapshotFailed
+		snapshot.Error = err.Error()
+	} else {
+		snapshot.Status = dindSnapshotReady
+		s.logger.Info("DinD snapshot created",
+			zap.String("snapshot_id", snapshot.ID),
+			zap.Int64("image_size", snapshot.ImageSize),
+			zap.Int64("data_size", snapshot.DataSize),
+			zap.Duration("duration", time.Since(start)))
+		s.publishEvent(ctx, env, "snapshotted")
+	}
+
+	if err := s.dinDRepo.UpdateSnapshot(snapshot); err != nil {
+		s.logger.Error("failed to store DinD snapshot", zap.String("snapshot_id", snapshot.ID), zap.Error(err))
+	}
+}
+
+func (s *dinDService) captureSnapshot(ctx context.Context, env *entities.DinDEnvironment, dataVolume string, snapshot *entities.DinDSnapshot) error {
+	containerInfo, err := s.dockerSvc.InspectContainer(ctx, env.ContainerID)
+	if err != nil {
+		return err
+	}
+
+	if containerInfo.State.Running {
+		// Containers the daemon would not restart itself are started again on restore
+		output, err := s.dockerSvc.ExecCommand(ctx, env.ContainerID, []string{"docker", "ps", "-q", "--no-trunc"})
+		if err != nil {
+			return fmt.Errorf("failed to list running containers: %w", err)
+		}
+		snapshot.RunningContainers = strings.Join(strings.Fields(output), " ")
+
+		if err := s.dockerSvc.PauseContainer(ctx, env.ContainerID); err != nil {
+			return fmt.Errorf("failed to pause environment: %w", err)
+		}
+		defer s.dockerSvc.UnpauseContainer(ctx, env.ContainerID)
+	}
+
+	snapshot.Image = snapshotImageName(snapshot.ID)
+	labels := map[string]string{"iaas.dind.snapshot": snapshot.ID, "iaas.dind.environment": env.ID}
+	if _, err := s.dockerSvc.CommitContainer(ctx, env.ContainerID, snapshot.Image, labels); err != nil {
+		return fmt.Errorf("failed to commit environment: %w", err)
+	}
+
+	snapshot.DataVolume = snapshotVolumeName(snapshot.ID)
+	size, err := s.copyDataVolume(ctx, dataVolume, snapshot.DataVolume)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w", dindDataDir, err)
+	}
+	snapshot.DataSize = size
+
+	// The image size includes the base image; only what the environment added is counted
+	if image, err := s.dockerSvc.InspectImage(ctx, snapshot.Image); err == nil {
+		snapshot.ImageSize = image.Size
+		if base, err := s.dockerSvc.InspectImage(ctx, containerInfo.Image); err == nil {
+			snapshot.ImageSize = max(0, image.Size-base.Size)
+		}
+	}
+	return nil
+}
+
+func (s *dinDService) setSnapshotActive(snapshotID string, active bool) {
+	s.snapshotsMu.Lock()
+	defer s.snapshotsMu.Unlock()
+	if s.activeSnapshots == nil {
+		s.activeSnapshots = make(map[string]bool)
+	}
+	if active {
+		s.activeSnapshots[snapshotID] = true
+	} else {
+		delete(s.activeSnapshots, snapshotID)
+	}
+}
+
+func (s *dinDService) snapshotActive(snapshotID string) bool {
+	s.snapshotsMu.Lock()
+	defer s.snapshotsMu.Unlock()
+	return s.activeSnapshots[snapshotID]
+}
+
+// RecoverSnapshots fails the snapshots a previous run of the service left in "creating". Their
+// environments may still be paused from the copy, so they are resumed.
+func (s *dinDService) RecoverSnapshots(ctx context.Context) {
+	snapshots, err := s.dinDRepo.ListSnapshotsByStatus(dindSnapshotCreating)
+	if err != nil {
+		s.logger.Error("failed to list interrupted DinD snapshots", zap.Error(err))
+		return
+	}
+	for i := range snapshots {
+		snapshot := &snapshots[i]
+		if s.snapshotActive(snapshot.ID) {
+			continue
+		}
+		s.abandonSnapshot(ctx, snapshot)
+		snapshot.Status = dindSnapshotFailed
+		snapshot.Error = "interrupted by a restart of the service"
+		if err := s.dinDRepo.UpdateSnapshot(snapshot); err != nil {
+			s.logger.Error("failed to store DinD snapshot", zap.String("snapshot_id", snapshot.ID), zap.Error(err))
+			continue
+		}
+		s.logger.Warn("interrupted DinD snapshot marked as failed",
+			zap.String("snapshot_id", snapshot.ID),
+			zap.String("env_id", snapshot.EnvironmentID))
+	}
+}
+
+// abandonSnapshot resumes the environment of an unfinished snapshot and removes what was
+// already written of it
+func (s *dinDService) abandonSnapshot(ctx context.Context, snapshot *entities.DinDSnapshot) {
+	if env, err := s.dinDRepo.FindByID(snapshot.EnvironmentID); err == nil && env.ContainerID != "" {
+		if info, err := s.dockerSvc.InspectContainer(ctx, env.ContainerID); err == nil && info.State.Paused {
+			if err := s.dockerSvc.UnpauseContainer(ctx, env.ContainerID); err != nil {
+				s.logger.Error("failed to resume DinD environment", zap.String("env_id", env.ID), zap.Error(err))
+			}
+		}
+	}
+	// Artifacts are named after the snapshot, so they are found even if the record lacks them
+	snapshot.Image = snapshotImageName(snapshot.ID)
+	snapshot.DataVolume = snapshotVolumeName(snapshot.ID)
+	s.removeSnapshotArtifacts(ctx, snapshot)
+	snapshot.Image, snapshot.DataVolume = "", ""
+	snapshot.ImageSize, snapshot.DataSize = 0, 0
+}
+
+func snapshotImageName(snapshotID string) string {
+	return fmt.Sprintf("%s:%s", dindSnapshotImage, snapshotID)
+}
+
+func snapshotVolumeName(snapshotID string) string {
+	return fmt.Sprintf("iaas-dind-snapshot-%s", snapshotID)
+}
+
+// restoreSnapshotData copies the docker data of a snapshot into a new volume for an
+// environment, so the snapshot stays usable for further copies
+func (s *dinDService) restoreSnapshotData(ctx context.Context, snapshot *entities.DinDSnapshot, envID string) (string, error) {
+	volume := fmt.Sprintf("iaas-dind-data-%s", envID)
+	if _, err := s.copyDataVolume(ctx, snapshot.DataVolume, volume); err != nil {
+		return "", fmt.Errorf("failed to restore snapshot data: %w", err)
+	}
+	return volume, nil
+}
+
+// copyDataVolume copies one volume into a new one and returns the size of the copy
+func (s *dinDService) copyDataVolume(ctx context.Context, from, to string) (int64, error) {
+	if err := s.dockerSvc.CreateVolume(ctx, to); err != nil {
+		return 0, err
+	}
+	output, err := s.dockerSvc.RunContainer(ctx, docker.ContainerConfig{
+		Image:   dindImage,
+		Cmd:     []string{"sh", "-c", "cp -a /source/. /target/ && du -sb /target"},
+		Volumes: map[string]string{from: "/source:ro", to: "/target"},
+		Labels:  map[string]string{"iaas.dind.volume-copy": to},
+	})
+	if err != nil {
+		s.dockerSvc.RemoveVolume(ctx, to)
+		return 0, err
+	}
+
+	var size int64
+	if fields := strings.Fields(output); len(fields) > 0 {
+		size, _ = strconv.ParseInt(fields[0], 10, 64)
+	}
+	return size, nil
+}
+
+// startSnapshotContainers starts the containers that were running when the snapshot was taken
+func (s *dinDService) startSnapshotContainers(ctx context.Context, containerID string, snapshot *entities.DinDSnapshot) {
+	ids := strings.Fields(snapshot.RunningContainers)
+	if len(ids) == 0 {
+		return
+	}
+	output, exitCode, err := s.dockerSvc.ExecCommandWithExitCode(ctx, containerID, append([]string{"docker", "start"}, ids...))
+	if err != nil || exitCode != 0 {
+		s.logger.Warn("failed to start snapshot containers",
+			zap.String("snapshot_id", snapshot.ID),
+			zap.String("output", strings.TrimSpace(output)),
+			zap.Error(err))
+		return
+	}
+	s.logger.Info("snapshot containers started", zap.String("snapshot_id", snapshot.ID), zap.Int("count", len(ids)))
+}
+
+// dataVolume returns the volume holding /var/lib/docker of an environment
+func (s *dinDService) dataVolume(ctx context.Context, env *entities.DinDEnvironment) (string, error) {
+	if env.DataVolume != "" {
+		return env.DataVolume, nil
+	}
+	containerInfo, err := s.dockerSvc.InspectContainer(ctx, env.ContainerID)
+	if err != nil {
+		return "", err
+	}
+	for _, mount := range containerInfo.Mounts {
+		if mount.Destination == dindDataDir && mount.Name != "" {
+			return mount.Name, nil
+		}
+	}
+	return "", fmt.Errorf("environment has no volume for %s", dindDataDir)
+}
+
+// readySnapshot loads a snapshot a user may restore. Snapshots recorded without a user belong
+// to the owner of the environment they were taken of.
+func (s *dinDService) readySnapshot(snapshotID, userID string) (*entities.DinDSnapshot, error) {
+	snapshot, err := s.dinDRepo.FindSnapshot(snapshotID)
+	if err != nil || (snapshot.UserID != "" && snapshot.UserID != userID) {
+		return nil, fmt.Errorf("snapshot not found")
+	}
+	if snapshot.UserID == "" {
+		if _, err := s.findUserEnvironment(snapshot.EnvironmentID, userID); err != nil {
+			return nil, fmt.Errorf("snapshot not found")
+		}
+	}
+	if snapshot.Status != dindSnapshotReady {
+		return nil, fmt.Errorf("snapshot is %s", snapshot.Status)
+	}
+	return snapshot, nil
+}
+
+// GetSnapshot returns a snapshot of the user
+func (s *dinDService) GetSnapshot(ctx context.Context, snapshotID, userID string) (*dto.DinDSnapshotInfo, error) {
+	snapshot, err := s.dinDRepo.FindSnapshot(snapshotID)
+	if err != nil || (snapshot.UserID != "" && snapshot.UserID != userID) {
+		return nil, fmt.Errorf("snapshot not found")
+	}
+	return toSnapshotInfo(snapshot), nil
+}
+
+// ListSnapshots lists the snapshots of a user with their total size
+func (s *dinDService) ListSnapshots(ctx context.Context, userID string) (*dto.DinDSnapshotListResponse, error) {
+	snapshots, err := s.dinDRepo.ListSnapshotsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return toSnapshotList(snapshots), nil
+}
+
+// ListEnvironmentSnapshots lists the snapshots of the user taken of an environment with their total size
+func (s *dinDService) ListEnvironmentSnapshots(ctx context.Context, id, userID string) (*dto.DinDSnapshotListResponse, error) {
+	if _, err := s.findUserEnvironment(id, userID); err != nil {
+		return nil, err
+	}
+	snapshots, err := s.dinDRepo.ListSnapshotsByEnvironment(id)
+	if err != nil {
+		return nil, err
+	}
+	owned := make([]entities.DinDSnapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		if snapshot.UserID == "" || snapshot.UserID == userID {
+			owned = append(owned, snapshot)
+		}
+	}
+	return toSnapshotList(owned), nil
+}
+
+// DeleteSnapshot removes a snapshot with its image and volume. Environments restored from it
+// keep working: they have their own copy of the data, and the image layers they use stay.
+// A snapshot left in "creating" by an earlier run of the service can be deleted as well.
+func (s *dinDService) DeleteSnapshot(ctx context.Context, snapshotID, userID string) error {
+	snapshot, err := s.dinDRepo.FindSnapshot(snapshotID)
+	if err != nil || (snapshot.UserID != "" && snapshot.UserID != userID) {
+		return fmt.Errorf("snapshot not found")
+	}
+	if snapshot.Status == dindSnapshotCreating {
+		if s.snapshotActive(snapshotID) {
+			return fmt.Errorf("snapshot is still being created")
+		}
+		s.abandonSnapshot(ctx, snapshot)
+	}
+
+	s.removeSnapshotArtifacts(ctx, snapshot)
+	if err := s.dinDRepo.DeleteSnapshot(snapshotID); err != nil {
+		return err
+	}
+	s.logger.Info("DinD snapshot deleted", zap.String("snapshot_id", snapshotID))
+	return nil
+}
+
+func (s *dinDService) removeSnapshotArtifacts(ctx context.Context, snapshot *entities.DinDSnapshot) {
+	if snapshot.Image != "" {
+		s.dockerSvc.RemoveImage(ctx, snapshot.Image)
+	}
+	if snapshot.DataVolume != "" {
+		s.dockerSvc.RemoveVolume(ctx, snapshot.DataVolume)
+	}
+}
+
+func toSnapshotList(snapshots []entities.DinDSnapshot) *dto.DinDSnapshotListResponse {
+	resp := &dto.DinDSnapshotListResponse{Snapshots: make([]dto.DinDSnapshotInfo, 0, len(snapshots))}
+	for i := range snapshots {
+		info := toSnapshotInfo(&snapshots[i])
+		resp.Snapshots = append(resp.Snapshots, *info)
+		resp.TotalSize += info.TotalSize
+	}
+	resp.TotalCount = len(resp.Snapshots)
+	return resp
+}
+
+func toSnapshotInfo(snapshot *entities.DinDSnapshot) *dto.DinDSnapshotInfo {
+	return &dto.DinDSnapshotInfo{
+		ID:                snapshot.ID,
+		EnvironmentID:     snapshot.EnvironmentID,
+		Name:              snapshot.Name,
+		Description:       snapshot.Description,
+		Status:            snapshot.Status,
+		Error:             snapshot.Error,
+		ResourcePlan:      snapshot.ResourcePlan,
+		RunningContainers: strings.Fields(snapshot.RunningContainers),
+		ImageSize:         snapshot.ImageSize,
+		DataSize:          snapshot.DataSize,
+		TotalSize:         snapshot.ImageSize + snapshot.DataSize,
+		CreatedAt:         snapshot.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+// fakeDinDSnapshotRepo adds stored snapshots to the environments of fakeDinDEnvRepo
+type fakeDinDSnapshotRepo struct {
+	fakeDinDEnvRepo
+	snapshots []entities.DinDSnapshot
+}
+
+func (r *fakeDinDSnapshotRepo) FindSnapshot(id string) (*entities.DinDSnapshot, error) {
+	for i := range r.snapshots {
+		if r.snapshots[i].ID == id {
+			return &r.snapshots[i], nil
+		}
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func TestToSnapshotInfoTotalSize(t *testing.T) {
+	info := toSnapshotInfo(&entities.DinDSnapshot{
+		ID:                "s1",
+		Status:            dindSnapshotReady,
+		RunningContainers: "abc def",
+		ImageSize:         300,
+		DataSize:          1200,
+		CreatedAt:         time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+
+	assert.Equal(t, int64(300), info.ImageSize)
+	assert.Equal(t, int64(1200), info.DataSize)
+	assert.Equal(t, int64(1500), info.TotalSize)
+	assert.Equal(t, []string{"abc", "def"}, info.RunningContainers)
+	assert.Equal(t, "2024-01-02T03:04:05Z", info.CreatedAt)
+}
+
+func TestToSnapshotListTotalSize(t *testing.T) {
+	list := toSnapshotList([]entities.DinDSnapshot{
+		{ID: "s1", ImageSize: 100, DataSize: 1000},
+		{ID: "s2", ImageSize: 50, DataSize: 0},
+		// A failed snapshot has no artifacts left and counts for nothing
+		{ID: "s3", Status: dindSnapshotFailed},
+	})
+
+	assert.Equal(t, 3, list.TotalCount)
+	assert.Equal(t, int64(1150), list.TotalSize)
+	assert.Equal(t, int64(1100), list.Snapshots[0].TotalSize)
+
+	empty := toSnapshotList(nil)
+	assert.Equal(t, 0, empty.TotalCount)
+	assert.Equal(t, int64(0), empty.TotalSize)
+	assert.NotNil(t, empty.Snapshots)
+}
+
+func TestSnapshotsOfOtherUserNotFound(t *testing.T) {
+	repo := &fakeDinDSnapshotRepo{
+		fakeDinDEnvRepo: fakeDinDEnvRepo{envs: []entities.DinDEnvironment{{ID: "a", UserID: "alice", Status: "running", ContainerID: "container-a"}}},
+		snapshots: []entities.DinDSnapshot{
+			{ID: "s1", EnvironmentID: "a", UserID: "alice", Status: dindSnapshotReady},
+			// Recorded before snapshots had a user
+			{ID: "s2", EnvironmentID: "a", Status: dindSnapshotReady},
+		},
+	}
+	svc := &dinDService{dinDRepo: repo, logger: nopLogger{}}
+
+	_, err := svc.CreateSnapshot(context.Background(), "a", "bob", dto.CreateDinDSnapshotRequest{Name: "before-upgrade"})
+	assert.EqualError(t, err, "environment not found")
+
+	for _, snapshotID := range []string{"s1", "s2"} {
+		snapshot, err := svc.readySnapshot(snapshotID, "alice")
+		require.NoError(t, err, snapshotID)
+		assert.Equal(t, snapshotID, snapshot.ID)
+
+		_, err = svc.readySnapshot(snapshotID, "bob")
+		assert.EqualError(t, err, "snapshot not found", snapshotID)
+	}
+}
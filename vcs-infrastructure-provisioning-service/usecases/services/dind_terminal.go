@@ -0,0 +1,288 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+)
+
+const (
+	dindTerminalShell         = "/bin/sh"
+	dindTerminalRows          = 24
+	dindTerminalCols          = 80
+	dindTranscriptLimit       = 1 << 20
+	dindTerminalSessionsLimit = 50
+	// dindTranscriptFlushInterval is how often the transcript of an open session is stored, so a
+	// restart of the service loses at most this much of it
+	dindTranscriptFlushInterval = 5 * time.Second
+)
+
+// DinDTerminal is an open TTY session in a DinD environment. Output read through it is kept
+// as the session transcript, up to dindTranscriptLimit bytes.
+type DinDTerminal struct {
+	SessionID   string
+	IdleTimeout time.Duration
+
+	exec        *docker.ExecSession
+	containerID string
+	mu          sync.Mutex
+	session     *entities.DinDTerminalSession
+	transcript  bytes.Buffer
+	dirty       bool
+	done        chan struct{}
+	flushed     chan struct{}
+}
+
+// Read returns terminal output and records it
+func (t *DinDTerminal) Read(p []byte) (int, error) {
+	n, err := t.exec.Read(p)
+	if n > 0 {
+		t.mu.Lock()
+		t.session.BytesOut += int64(n)
+		room := dindTranscriptLimit - t.transcript.Len()
+		if n > room {
+			t.session.Truncated = true
+		}
+		t.transcript.Write(p[:max(0, min(n, room))])
+		t.dirty = true
+		t.mu.Unlock()
+	}
+	return n, err
+}
+
+// Write sends input to the terminal. Input is not recorded separately: the TTY echoes it into
+// the output, except for what the program hides such as passwords.
+func (t *DinDTerminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	t.session.BytesIn += int64(len(p))
+	t.dirty = true
+	t.mu.Unlock()
+	return t.exec.Write(p)
+}
+
+// Resize changes the terminal size
+func (t *DinDTerminal) Resize(ctx context.Context, rows, cols uint) error {
+	if rows == 0 || cols == 0 {
+		return fmt.Errorf("invalid terminal size %dx%d", cols, rows)
+	}
+	return t.exec.Resize(ctx, rows, cols)
+}
+
+// OpenTerminal starts an interactive shell, or the given command through sh -c, in a DinD environment
+func (s *dinDService) OpenTerminal(ctx context.Context, id, userID string, req dto.DinDTerminalRequest) (*DinDTerminal, error) {
+	env, err := s.findUserEnvironment(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if env.Status != "running" {
+		return nil, fmt.Errorf("environment is not running")
+	}
+
+	sessionID := uuid.New().String()
+	command := strings.TrimSpace(req.Command)
+	program := dindTerminalShell
+	if command == "" {
+		command = dindTerminalShell
+	} else {
+		program = "sh -c " + shellQuote(command)
+	}
+	// The pid file lets CloseTerminal kill the session when the client goes away; closing the
+	// TTY alone does not stop a command that ignores its input
+	cmd := []string{"sh", "-c", fmt.Sprintf("echo $$ > %s && exec %s", terminalPIDFile(sessionID), program)}
+	rows, cols := req.Rows, req.Cols
+	if rows == 0 || cols == 0 {
+		rows, cols = dindTerminalRows, dindTerminalCols
+	}
+
+	exec, err := s.dockerSvc.ExecTTY(ctx, env.ContainerID, cmd, rows, cols)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start terminal: %w", err)
+	}
+
+	session := &entities.DinDTerminalSession{
+		ID:            sessionID,
+		EnvironmentID: id,
+		UserID:        userID,
+		Command:       command,
+		ExitCode:      -1,
+	}
+	if err := s.dinDRepo.CreateTerminalSession(session); err != nil {
+		exec.Close()
+		return nil, fmt.Errorf("failed to record terminal session: %w", err)
+	}
+
+	s.logger.Info("DinD terminal session opened",
+		zap.String("env_id", id),
+		zap.String("session_id", session.ID),
+		zap.String("user_id", userID),
+		zap.String("command", command))
+
+	terminal := &DinDTerminal{
+		SessionID:   session.ID,
+		IdleTimeout: s.dindConfig.TerminalIdleTimeout,
+		exec:        exec,
+		containerID: env.ContainerID,
+		session:     session,
+		done:        make(chan struct{}),
+		flushed:     make(chan struct{}),
+	}
+	go s.flushTranscript(terminal)
+	return terminal, nil
+}
+
+func terminalPIDFile(sessionID string) string {
+	return "/tmp/.dind-terminal-" + sessionID + ".pid"
+}
+
+// flushTranscript stores the transcript of an open session periodically until CloseTerminal
+func (s *dinDService) flushTranscript(terminal *DinDTerminal) {
+	defer close(terminal.flushed)
+	ticker := time.NewTicker(dindTranscriptFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-terminal.done:
+			return
+		case <-ticker.C:
+			terminal.mu.Lock()
+			if !terminal.dirty {
+				terminal.mu.Unlock()
+				continue
+			}
+			terminal.session.Transcript = sanitizeTranscript(terminal.transcript.String())
+			terminal.dirty = false
+			snapshot := *terminal.session
+			terminal.mu.Unlock()
+
+			if err := s.dinDRepo.UpdateTerminalSession(&snapshot); err != nil {
+				s.logger.Warn("failed to store terminal transcript", zap.String("session_id", snapshot.ID), zap.Error(err))
+			}
+		}
+	}
+}
+
+// sanitizeTranscript makes output storable: Postgres text columns reject NUL bytes and invalid
+// UTF-8, e.g. a rune cut at the limit
+func sanitizeTranscript(transcript string) string {
+	return strings.ReplaceAll(strings.ToValidUTF8(transcript, "\uFFFD"), "\x00", "")
+}
+
+// killTerminal ends every process of the session. The shell runs as a session leader on its TTY,
+// so its session ID is the pid recorded when it started.
+func (s *dinDService) killTerminal(ctx context.Context, terminal *DinDTerminal) {
+	pidFile := terminalPIDFile(terminal.SessionID)
+	script := fmt.Sprintf(`pid=$(cat %[1]s 2>/dev/null) && [ -n "$pid" ] && { pkill -HUP -s "$pid"; sleep 1; pkill -KILL -s "$pid" || kill -KILL "$pid"; }; rm -f %[1]s`, pidFile)
+	if err := s.dockerSvc.ExecStream(ctx, terminal.containerID, []string{"sh", "-c", script}, nil, nil); err != nil {
+		s.logger.Warn("failed to kill terminal processes", zap.String("session_id", terminal.SessionID), zap.Error(err))
+	}
+}
+
+// CloseTerminal detaches from the terminal, kills what is still running in it and stores the
+// session with its transcript. It returns the exit code of the command, -1 when it was killed.
+func (s *dinDService) CloseTerminal(ctx context.Context, terminal *DinDTerminal, reason string) int {
+	terminal.exec.Close()
+	close(terminal.done)
+	<-terminal.flushed
+
+	// Closing stdin ends an interactive shell; give it a moment to report its exit code
+	exitCode := terminalExitCode(ctx, terminal)
+	if exitCode < 0 {
+		s.killTerminal(ctx, terminal)
+	} else {
+		s.dockerSvc.ExecStream(ctx, terminal.containerID, []string{"rm", "-f", terminalPIDFile(terminal.SessionID)}, nil, nil)
+	}
+
+	terminal.mu.Lock()
+	session := terminal.session
+	session.Transcript = sanitizeTranscript(terminal.transcript.String())
+	session.ExitCode = exitCode
+	session.CloseReason = reason
+	session.EndedAt = time.Now()
+	err := s.dinDRepo.UpdateTerminalSession(session)
+	terminal.mu.Unlock()
+	if err != nil {
+		s.logger.Error("failed to store terminal session", zap.String("session_id", session.ID), zap.Error(err))
+	}
+
+	s.logger.Info("DinD terminal session closed",
+		zap.String("env_id", session.EnvironmentID),
+		zap.String("session_id", session.ID),
+		zap.String("reason", reason),
+		zap.Int("exit_code", exitCode))
+	return exitCode
+}
+
+// terminalExitCode waits up to a second for the command of a terminal to exit
+func terminalExitCode(ctx context.Context, terminal *DinDTerminal) int {
+	for i := 0; i < 10; i++ {
+		code, err := terminal.exec.ExitCode(ctx)
+		if err != nil {
+			return -1
+		}
+		if code >= 0 {
+			return code
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return -1
+}
+
+// ListTerminalSessions lists the recorded terminal sessions of an environment, newest first
+func (s *dinDService) ListTerminalSessions(ctx context.Context, id, userID string) ([]dto.DinDTerminalSessionInfo, error) {
+	if _, err := s.findUserEnvironment(id, userID); err != nil {
+		return nil, err
+	}
+	sessions, err := s.dinDRepo.ListTerminalSessions(id, dindTerminalSessionsLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]dto.DinDTerminalSessionInfo, 0, len(sessions))
+	for i := range sessions {
+		result = append(result, toTerminalSessionInfo(&sessions[i]))
+	}
+	return result, nil
+}
+
+// GetTerminalSession returns a recorded terminal session with its transcript
+func (s *dinDService) GetTerminalSession(ctx context.Context, id, userID, sessionID string) (*dto.DinDTerminalSessionInfo, error) {
+	if _, err := s.findUserEnvironment(id, userID); err != nil {
+		return nil, err
+	}
+	session, err := s.dinDRepo.FindTerminalSession(sessionID)
+	if err != nil || session.EnvironmentID != id {
+		return nil, fmt.Errorf("terminal session not found")
+	}
+	info := toTerminalSessionInfo(session)
+	return &info, nil
+}
+
+func toTerminalSessionInfo(session *entities.DinDTerminalSession) dto.DinDTerminalSessionInfo {
+	info := dto.DinDTerminalSessionInfo{
+		ID:            session.ID,
+		EnvironmentID: session.EnvironmentID,
+		UserID:        session.UserID,
+		Command:       session.Command,
+		Transcript:    session.Transcript,
+		Truncated:     session.Truncated,
+		BytesIn:       session.BytesIn,
+		BytesOut:      session.BytesOut,
+		ExitCode:      session.ExitCode,
+		CloseReason:   session.CloseReason,
+		StartedAt:     session.StartedAt.Format(time.RFC3339),
+	}
+	if !session.EndedAt.IsZero() {
+		info.EndedAt = session.EndedAt.Format(time.RFC3339)
+	}
+	return info
+}
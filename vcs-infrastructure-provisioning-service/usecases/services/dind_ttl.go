@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+const dindReaperInterval = time.Minute
+
+// ExtendEnvironment pushes back the expiry of an environment. An environment the reaper already
+// stopped can still be extended during the grace period; it is started again.
+func (s *dinDService) ExtendEnvironment(ctx context.Context, id string, req dto.ExtendDinDEnvironmentRequest) (*dto.DinDEnvironmentInfo, error) {
+	env, err := s.dinDRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !env.AutoCleanup || env.ExpiresAt.IsZero() {
+		return nil, fmt.Errorf("environment has no TTL")
+	}
+
+	extension := time.Duration(req.Hours) * time.Hour
+	expired := !env.ExpiredAt.IsZero()
+	if expired {
+		if err := s.dockerSvc.StartContainer(ctx, env.ContainerID); err != nil {
+			return nil, fmt.Errorf("failed to start expired environment: %w", err)
+		}
+		env.Status = "running"
+		env.ExpiredAt = time.Time{}
+		if infra, err := s.infraRepo.FindByID(env.InfrastructureID); err == nil {
+			infra.Status = entities.StatusRunning
+			s.infraRepo.Update(infra)
+		}
+	}
+	if env.ExpiresAt.Before(time.Now()) {
+		env.ExpiresAt = time.Now()
+	}
+	env.ExpiresAt = env.ExpiresAt.Add(extension)
+	env.ExpiryWarned = false
+	if err := s.dinDRepo.Update(env); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("DinD environment extended",
+		zap.String("id", id),
+		zap.Int("hours", req.Hours),
+		zap.Bool("was_expired", expired),
+		zap.Time("expires_at", env.ExpiresAt))
+	s.publishEvent(ctx, env, "extended")
+	return s.toDTO(env), nil
+}
+
+// StartTTLReaper warns about environments that are about to expire, stops expired ones and
+// deletes them once the grace period has passed without an extension
+func (s *dinDService) StartTTLReaper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(dindReaperInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.warnExpiring(ctx)
+				s.reapExpired(ctx)
+			}
+		}
+	}()
+}
+
+func (s *dinDService) warnExpiring(ctx context.Context) {
+	envs, err := s.dinDRepo.FindExpiring(time.Now().Add(s.dindConfig.TTLWarningBefore))
+	if err != nil {
+		s.logger.Warn("failed to list expiring DinD environments", zap.Error(err))
+		return
+	}
+	for i := range envs {
+		env := &envs[i]
+		s.publishEvent(ctx, env, "expiring")
+		if err := s.dinDRepo.MarkExpiryWarned(env.ID); err != nil {
+			s.logger.Warn("failed to mark DinD environment as warned", zap.String("id", env.ID), zap.Error(err))
+			continue
+		}
+		s.logger.Info("DinD environment expiring soon", zap.String("id", env.ID), zap.Time("expires_at", env.ExpiresAt))
+	}
+}
+
+func (s *dinDService) reapExpired(ctx context.Context) {
+	envs, err := s.dinDRepo.FindExpired()
+	if err != nil {
+		s.logger.Warn("failed to list expired DinD environments", zap.Error(err))
+		return
+	}
+	for i := range envs {
+		env := &envs[i]
+		if env.ExpiredAt.IsZero() {
+			s.expireEnvironment(ctx, env)
+			continue
+		}
+		if time.Since(env.ExpiredAt) < s.dindConfig.TTLGracePeriod {
+			continue
+		}
+		if err := s.DeleteEnvironment(ctx, env.ID); err != nil {
+			s.logger.Error("failed to delete expired DinD environment", zap.String("id", env.ID), zap.Error(err))
+			continue
+		}
+		s.logger.Info("expired DinD environment deleted", zap.String("id", env.ID))
+	}
+}
+
+// expireEnvironment stops an environment that reached its expiry; it is kept for the grace period
+func (s *dinDService) expireEnvironment(ctx context.Context, env *entities.DinDEnvironment) {
+	if env.ContainerID != "" {
+		if err := s.dockerSvc.StopContainer(ctx, env.ContainerID); err != nil {
+			s.logger.Error("failed to stop expired DinD environment", zap.String("id", env.ID), zap.Error(err))
+			return
+		}
+	}
+	env.Status = "stopped"
+	env.ExpiredAt = time.Now()
+	if err := s.dinDRepo.Update(env); err != nil {
+		s.logger.Error("failed to mark DinD environment as expired", zap.String("id", env.ID), zap.Error(err))
+		return
+	}
+
+	if infra, err := s.infraRepo.FindByID(env.InfrastructureID); err == nil {
+		infra.Status = entities.StatusStopped
+		s.infraRepo.Update(infra)
+	}
+
+	s.publishEvent(ctx, env, "expired")
+	s.logger.Info("DinD environment expired",
+		zap.String("id", env.ID),
+		zap.Time("deletes_at", env.ExpiredAt.Add(s.dindConfig.TTLGracePeriod)))
+}
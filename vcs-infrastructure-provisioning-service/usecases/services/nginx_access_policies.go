@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+var basicAuthUsernamePattern = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+
+// htpasswdBcryptCost is the bcrypt cost of basic auth passwords. nginx checks the hash on every
+// request inside a worker process, so DefaultCost (about 50ms per check) would stall the worker;
+// cost 5 takes around 2ms. Hashes stored earlier keep their cost until the password is reset.
+const htpasswdBcryptCost = 5
+
+// ListAccessPolicies lists the access policies of a cluster with their basic auth users
+func (s *nginxClusterService) ListAccessPolicies(ctx context.Context, clusterID string) ([]dto.NginxAccessPolicyInfo, error) {
+	if _, err := s.clusterRepo.FindByID(clusterID); err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	policies, err := s.clusterRepo.ListAccessPolicies(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]dto.NginxAccessPolicyInfo, 0, len(policies))
+	for _, policy := range policies {
+		result = append(result, s.accessPolicyInfo(policy))
+	}
+	return result, nil
+}
+
+// CreateAccessPolicy attaches an access policy to a server block or one of its locations.
+// The policy is removed again when nginx rejects the regenerated config.
+func (s *nginxClusterService) CreateAccessPolicy(ctx context.Context, userID, clusterID string, req dto.CreateNginxAccessPolicyRequest) (*dto.NginxAccessPolicyInfo, error) {
+	block, err := s.findServerBlock(clusterID, req.ServerBlockID)
+	if err != nil {
+		return nil, err
+	}
+	scope := "server block " + block.ServerName
+	if req.LocationID != "" {
+		location, err := s.findLocation(clusterID, block.ID, req.LocationID)
+		if err != nil {
+			return nil, err
+		}
+		scope = fmt.Sprintf("location %s of %s", location.Path, block.ServerName)
+	}
+	if _, err := s.clusterRepo.FindAccessPolicyByScope(req.ServerBlockID, req.LocationID); err == nil {
+		return nil, fmt.Errorf("%s already has an access policy", scope)
+	}
+
+	policy := &entities.NginxAccessPolicy{
+		ID:            uuid.New().String(),
+		ClusterID:     clusterID,
+		ServerBlockID: req.ServerBlockID,
+		LocationID:    req.LocationID,
+	}
+	setAccessRules(policy, req.NginxAccessRules)
+	if err := s.validateAccessPolicy(clusterID, policy); err != nil {
+		return nil, err
+	}
+
+	if err := s.clusterRepo.CreateAccessPolicy(policy); err != nil {
+		return nil, fmt.Errorf("failed to create access policy: %w", err)
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "add access policy to "+scope); err != nil {
+		s.clusterRepo.DeleteAccessPolicy(policy.ID)
+		return nil, err
+	}
+
+	info := s.accessPolicyInfo(*policy)
+	return &info, nil
+}
+
+// UpdateAccessPolicy replaces the rules of an access policy; the previous rules are restored
+// when the regenerated config cannot be applied
+func (s *nginxClusterService) UpdateAccessPolicy(ctx context.Context, userID, clusterID, policyID string, req dto.UpdateNginxAccessPolicyRequest) (*dto.NginxAccessPolicyInfo, error) {
+	policy, err := s.findAccessPolicy(clusterID, policyID)
+	if err != nil {
+		return nil, err
+	}
+	previous := *policy
+
+	setAccessRules(policy, req.NginxAccessRules)
+	if err := s.validateAccessPolicy(clusterID, policy); err != nil {
+		return nil, err
+	}
+	if err := s.clusterRepo.UpdateAccessPolicy(policy); err != nil {
+		return nil, fmt.Errorf("failed to update access policy: %w", err)
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "update access policy "+policyID); err != nil {
+		if restoreErr := s.clusterRepo.UpdateAccessPolicy(&previous); restoreErr != nil {
+			s.logger.Error("failed to restore access policy", zap.String("policy_id", policyID), zap.Error(restoreErr))
+		}
+		return nil, err
+	}
+
+	info := s.accessPolicyInfo(*policy)
+	return &info, nil
+}
+
+// DeleteAccessPolicy removes an access policy together with its basic auth users
+func (s *nginxClusterService) DeleteAccessPolicy(ctx context.Context, userID, clusterID, policyID string) error {
+	policy, err := s.findAccessPolicy(clusterID, policyID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.clusterRepo.DeleteAccessPolicy(policyID); err != nil {
+		return fmt.Errorf("failed to delete access policy: %w", err)
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "delete access policy "+policyID); err != nil {
+		if restoreErr := s.clusterRepo.CreateAccessPolicy(policy); restoreErr != nil {
+			s.logger.Error("failed to restore access policy", zap.String("policy_id", policyID), zap.Error(restoreErr))
+		}
+		return err
+	}
+
+	s.clusterRepo.DeleteBasicAuthUsersByPolicyID(policyID)
+	s.removeAuthFile(ctx, clusterID, policyID)
+	return nil
+}
+
+// SetBasicAuthUser adds a basic auth user to a policy, or resets the password of an existing one.
+// Only the htpasswd file changes, so nginx picks it up without a reload.
+func (s *nginxClusterService) SetBasicAuthUser(ctx context.Context, clusterID, policyID string, req dto.SetNginxBasicAuthUserRequest) (*dto.NginxAccessPolicyInfo, error) {
+	policy, err := s.findAccessPolicy(clusterID, policyID)
+	if err != nil {
+		return nil, err
+	}
+	if !basicAuthUsernamePattern.MatchString(req.Username) || len(req.Username) > 100 {
+		return nil, fmt.Errorf("invalid username %q", req.Username)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), htpasswdBcryptCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if user, err := s.clusterRepo.FindBasicAuthUser(policyID, req.Username); err == nil {
+		user.PasswordHash = string(hash)
+		if err := s.clusterRepo.UpdateBasicAuthUser(user); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+	} else {
+		user := &entities.NginxBasicAuthUser{
+			ID:           uuid.New().String(),
+			PolicyID:     policyID,
+			Username:     req.Username,
+			PasswordHash: string(hash),
+		}
+		if err := s.clusterRepo.CreateBasicAuthUser(user); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+	}
+
+	if err := s.deployAuthFile(ctx, policy); err != nil {
+		return nil, err
+	}
+	info := s.accessPolicyInfo(*policy)
+	return &info, nil
+}
+
+// DeleteBasicAuthUser removes a basic auth user from a policy
+func (s *nginxClusterService) DeleteBasicAuthUser(ctx context.Context, clusterID, policyID, username string) error {
+	policy, err := s.findAccessPolicy(clusterID, policyID)
+	if err != nil {
+		return err
+	}
+	user, err := s.clusterRepo.FindBasicAuthUser(policyID, username)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+	if err := s.clusterRepo.DeleteBasicAuthUser(user.ID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return s.deployAuthFile(ctx, policy)
+}
+
+// deleteAccessPolicies drops the policies left behind by a deleted server block or location.
+// The config no longer references them, so only the rows and htpasswd files remain.
+func (s *nginxClusterService) deleteAccessPolicies(ctx context.Context, clusterID string, match func(entities.NginxAccessPolicy) bool) {
+	policies, err := s.clusterRepo.ListAccessPolicies(clusterID)
+	if err != nil {
+		s.logger.Warn("failed to list access policies", zap.String("cluster_id", clusterID), zap.Error(err))
+		return
+	}
+	for _, policy := range policies {
+		if !match(policy) {
+			continue
+		}
+		s.clusterRepo.DeleteBasicAuthUsersByPolicyID(policy.ID)
+		if err := s.clusterRepo.DeleteAccessPolicy(policy.ID); err != nil {
+			s.logger.Warn("failed to delete access policy", zap.String("policy_id", policy.ID), zap.Error(err))
+			continue
+		}
+		s.removeAuthFile(ctx, clusterID, policy.ID)
+	}
+}
+
+// validateAccessPolicy renders the policy once so that it is rejected before anything is stored
+func (s *nginxClusterService) validateAccessPolicy(clusterID string, policy *entities.NginxAccessPolicy) error {
+	upstreamNames, err := s.clusterUpstreamNames(clusterID)
+	if err != nil {
+		return err
+	}
+	_, err = accessView(policy, upstreamNames)
+	return err
+}
+
+// installAuthFiles writes the htpasswd file of every basic auth policy of the cluster to a node
+func (s *nginxClusterService) installAuthFiles(ctx context.Context, cluster *entities.NginxCluster, containerID string) error {
+	policies, err := s.clusterRepo.ListAccessPolicies(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list access policies: %w", err)
+	}
+	for _, policy := range policies {
+		if !policy.BasicAuthEnabled {
+			continue
+		}
+		if err := s.writeAuthFile(ctx, containerID, policy.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deployAuthFile pushes the htpasswd file of a policy to every node after its users changed
+func (s *nginxClusterService) deployAuthFile(ctx context.Context, policy *entities.NginxAccessPolicy) error {
+	if !policy.BasicAuthEnabled {
+		return nil
+	}
+	nodes, err := s.clusterRepo.ListNodes(policy.ClusterID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	failedNodes := []string{}
+	for _, node := range nodes {
+		if err := s.writeAuthFile(ctx, node.ContainerID, policy.ID); err != nil {
+			s.logger.Error("failed to write htpasswd file", zap.String("node_id", node.ID), zap.Error(err))
+			failedNodes = append(failedNodes, node.Name)
+		}
+	}
+	if len(failedNodes) > 0 {
+		return fmt.Errorf("htpasswd update failed on nodes: %s", strings.Join(failedNodes, ", "))
+	}
+	return nil
+}
+
+// writeAuthFile writes the users of a policy as an htpasswd file readable by the nginx workers.
+// A policy without users still gets a file, which denies everyone instead of failing requests.
+func (s *nginxClusterService) writeAuthFile(ctx context.Context, containerID, policyID string) error {
+	users, err := s.clusterRepo.ListBasicAuthUsers(policyID)
+	if err != nil {
+		return fmt.Errorf("failed to list basic auth users: %w", err)
+	}
+	var content strings.Builder
+	for _, user := range users {
+		content.WriteString(user.Username + ":" + user.PasswordHash + "\n")
+	}
+
+	path := fmt.Sprintf("%s/%s", nginxHtpasswdDir, policyID)
+	if err := s.writeNginxFile(ctx, containerID, path, content.String()); err != nil {
+		return fmt.Errorf("failed to write htpasswd file: %w", err)
+	}
+	cmd := fmt.Sprintf("chown root:nginx %s && chmod 640 %s || chmod 644 %s", path, path, path)
+	return s.dockerSvc.ExecStream(ctx, containerID, []string{"sh", "-c", cmd}, nil, nil)
+}
+
+// removeAuthFile deletes the htpasswd file of a removed policy from every node
+func (s *nginxClusterService) removeAuthFile(ctx context.Context, clusterID, policyID string) {
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return
+	}
+	path := fmt.Sprintf("%s/%s", nginxHtpasswdDir, policyID)
+	for _, node := range nodes {
+		if err := s.dockerSvc.ExecStream(ctx, node.ContainerID, []string{"rm", "-f", path}, nil, nil); err != nil {
+			s.logger.Warn("failed to remove htpasswd file", zap.String("node_id", node.ID), zap.Error(err))
+		}
+	}
+}
+
+func (s *nginxClusterService) findAccessPolicy(clusterID, policyID string) (*entities.NginxAccessPolicy, error) {
+	policy, err := s.clusterRepo.FindAccessPolicyByID(policyID)
+	if err != nil || policy.ClusterID != clusterID {
+		return nil, fmt.Errorf("access policy not found")
+	}
+	return policy, nil
+}
+
+func (s *nginxClusterService) accessPolicyInfo(policy entities.NginxAccessPolicy) dto.NginxAccessPolicyInfo {
+	info := dto.NginxAccessPolicyInfo{
+		ID:               policy.ID,
+		ServerBlockID:    policy.ServerBlockID,
+		LocationID:       policy.LocationID,
+		NginxAccessRules: toAccessRules(policy),
+		Users:            []string{},
+		CreatedAt:        policy.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:        policy.UpdatedAt.Format(time.RFC3339),
+	}
+	if block, err := s.clusterRepo.FindServerBlockByID(policy.ServerBlockID); err == nil {
+		info.ServerName = block.ServerName
+	}
+	if policy.LocationID != "" {
+		if location, err := s.clusterRepo.FindLocationByID(policy.LocationID); err == nil {
+			info.LocationPath = location.Path
+		}
+	}
+	if users, err := s.clusterRepo.ListBasicAuthUsers(policy.ID); err == nil {
+		for _, user := range users {
+			info.Users = append(info.Users, user.Username)
+		}
+	}
+	return info
+}
+
+func setAccessRules(policy *entities.NginxAccessPolicy, rules dto.NginxAccessRules) {
+	allow, _ := json.Marshal(rules.Allow)
+	deny, _ := json.Marshal(rules.Deny)
+	headers, _ := json.Marshal(rules.AuthResponseHeaders)
+	policy.AllowCIDRs = string(allow)
+	policy.DenyCIDRs = string(deny)
+	policy.Satisfy = rules.Satisfy
+	if policy.Satisfy == "" {
+		policy.Satisfy = "all"
+	}
+	policy.BasicAuthEnabled = rules.BasicAuth
+	policy.BasicAuthRealm = rules.BasicAuthRealm
+	policy.AuthRequestURL = rules.AuthRequestURL
+	policy.AuthResponseHeaders = string(headers)
+}
+
+func toAccessRules(policy entities.NginxAccessPolicy) dto.NginxAccessRules {
+	rules := dto.NginxAccessRules{
+		Allow:          []string{},
+		Deny:           []string{},
+		Satisfy:        policy.Satisfy,
+		BasicAuth:      policy.BasicAuthEnabled,
+		BasicAuthRealm: policy.BasicAuthRealm,
+		AuthRequestURL: policy.AuthRequestURL,
+	}
+	json.Unmarshal([]byte(policy.AllowCIDRs), &rules.Allow)
+	json.Unmarshal([]byte(policy.DenyCIDRs), &rules.Deny)
+	json.Unmarshal([]byte(policy.AuthResponseHeaders), &rules.AuthResponseHeaders)
+	return rules
+}
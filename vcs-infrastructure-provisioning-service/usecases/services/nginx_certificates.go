@@ -0,0 +1,810 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/pki"
+)
+
+const (
+	certStatusPending = "pending"
+	certStatusActive  = "active"
+	certStatusFailed  = "failed"
+	certStatusExpired = "expired"
+
+	certSourceUploaded   = "uploaded"
+	certSourceCSR        = "csr"
+	certSourceSelfSigned = "self_signed"
+	certSourceACME       = "acme"
+
+	certRenewBefore        = 30 * 24 * time.Hour
+	certRenewalInterval    = 12 * time.Hour
+	defaultSelfSignedDays  = 365
+	acmeIssueTimeout       = 10 * time.Minute
+	acmeHTTP01ChallengeTyp = "http-01"
+)
+
+// ListCertificates lists the certificates stored for a cluster
+func (s *nginxClusterService) ListCertificates(ctx context.Context, clusterID string) ([]dto.NginxCertificateInfo, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	certs, err := s.clusterRepo.ListCertificates(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificates: %w", err)
+	}
+	blocks, _ := s.clusterRepo.ListServerBlocks(clusterID)
+
+	result := make([]dto.NginxCertificateInfo, 0, len(certs))
+	for i := range certs {
+		result = append(result, toCertificateInfo(&certs[i], cluster, blocks))
+	}
+	return result, nil
+}
+
+// GetCertificate returns one certificate, including its CSR while it waits to be signed
+func (s *nginxClusterService) GetCertificate(ctx context.Context, clusterID, certID string) (*dto.NginxCertificateInfo, error) {
+	cluster, cert, err := s.findCertificate(clusterID, certID)
+	if err != nil {
+		return nil, err
+	}
+	return s.certificateInfo(cert, cluster), nil
+}
+
+// UploadCertificate imports a certificate chain with its private key and deploys it to the nodes
+func (s *nginxClusterService) UploadCertificate(ctx context.Context, clusterID string, req dto.UploadNginxCertificateRequest) (*dto.NginxCertificateInfo, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	cert, err := s.importCertificate(cluster.ID, req.Name, req.CertificatePEM, req.PrivateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	s.deployAndRecord(ctx, cluster, cert)
+	return s.certificateInfo(cert, cluster), nil
+}
+
+// CreateCertificateCSR generates a key and a CSR; the certificate stays pending until the signed
+// certificate is attached with CompleteCertificateCSR
+func (s *nginxClusterService) CreateCertificateCSR(ctx context.Context, clusterID string, req dto.CreateNginxCSRRequest) (*dto.NginxCertificateInfo, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	names, err := certificateNames(req.CommonName, req.DNSNames)
+	if err != nil {
+		return nil, err
+	}
+
+	key, keyPEM, err := pki.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	csrPEM, err := pki.CreateCSR(key, req.CommonName, req.Organization, names)
+	if err != nil {
+		return nil, err
+	}
+	sealedKey, err := s.keyCipher.Seal(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	dnsNames, _ := json.Marshal(names)
+	cert := &entities.NginxCertificate{
+		ID:         uuid.New().String(),
+		ClusterID:  cluster.ID,
+		Name:       req.Name,
+		Source:     certSourceCSR,
+		Status:     certStatusPending,
+		CommonName: req.CommonName,
+		DNSNames:   string(dnsNames),
+		KeyPEM:     sealedKey,
+		CSRPEM:     string(csrPEM),
+	}
+	if err := s.clusterRepo.CreateCertificate(cert); err != nil {
+		return nil, fmt.Errorf("failed to save certificate: %w", err)
+	}
+	return s.certificateInfo(cert, cluster), nil
+}
+
+// CompleteCertificateCSR attaches the certificate an external CA signed for a pending CSR
+func (s *nginxClusterService) CompleteCertificateCSR(ctx context.Context, clusterID, certID string, req dto.CompleteNginxCSRRequest) (*dto.NginxCertificateInfo, error) {
+	cluster, cert, err := s.findCertificate(clusterID, certID)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Source != certSourceCSR {
+		return nil, fmt.Errorf("certificate %s was not created from a CSR", cert.Name)
+	}
+	keyPEM, err := s.keyCipher.Open(cert.KeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.activateCertificate(cert, []byte(req.CertificatePEM), keyPEM); err != nil {
+		return nil, err
+	}
+	if err := s.clusterRepo.UpdateCertificate(cert); err != nil {
+		return nil, fmt.Errorf("failed to save certificate: %w", err)
+	}
+	s.deployAndRecord(ctx, cluster, cert)
+	return s.certificateInfo(cert, cluster), nil
+}
+
+// IssueSelfSignedCertificate issues a self-signed certificate and deploys it to the nodes
+func (s *nginxClusterService) IssueSelfSignedCertificate(ctx context.Context, clusterID string, req dto.IssueSelfSignedCertificateRequest) (*dto.NginxCertificateInfo, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	names, err := certificateNames(req.CommonName, req.DNSNames)
+	if err != nil {
+		return nil, err
+	}
+	validDays := req.ValidDays
+	if validDays <= 0 {
+		validDays = defaultSelfSignedDays
+	}
+
+	dnsNames, _ := json.Marshal(names)
+	cert := &entities.NginxCertificate{
+		ID:         uuid.New().String(),
+		ClusterID:  cluster.ID,
+		Name:       req.Name,
+		Source:     certSourceSelfSigned,
+		CommonName: req.CommonName,
+		DNSNames:   string(dnsNames),
+		AutoRenew:  req.AutoRenew,
+		ValidDays:  validDays,
+	}
+	if err := s.issueSelfSigned(cert); err != nil {
+		return nil, err
+	}
+	if err := s.clusterRepo.CreateCertificate(cert); err != nil {
+		return nil, fmt.Errorf("failed to save certificate: %w", err)
+	}
+	s.deployAndRecord(ctx, cluster, cert)
+	return s.certificateInfo(cert, cluster), nil
+}
+
+// RequestACMECertificate starts an ACME order answered over HTTP-01 by the cluster nodes.
+// The certificate is returned pending and becomes active once the order is finalized.
+func (s *nginxClusterService) RequestACMECertificate(ctx context.Context, clusterID string, req dto.RequestACMECertificateRequest) (*dto.NginxCertificateInfo, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	for _, domain := range req.Domains {
+		if strings.HasPrefix(domain, "*.") {
+			return nil, fmt.Errorf("wildcard domain %s cannot be validated over HTTP-01", domain)
+		}
+	}
+	names, err := certificateNames(req.Domains[0], req.Domains)
+	if err != nil {
+		return nil, err
+	}
+
+	directory := req.DirectoryURL
+	if directory == "" {
+		directory = s.acmeConfig.DirectoryURL
+	}
+	if directory == "" {
+		directory = acme.LetsEncryptURL
+	}
+	email := req.Email
+	if email == "" {
+		email = s.acmeConfig.Email
+	}
+
+	dnsNames, _ := json.Marshal(names)
+	cert := &entities.NginxCertificate{
+		ID:            uuid.New().String(),
+		ClusterID:     cluster.ID,
+		Name:          req.Name,
+		Source:        certSourceACME,
+		Status:        certStatusPending,
+		CommonName:    names[0],
+		DNSNames:      string(dnsNames),
+		AutoRenew:     true,
+		ACMEDirectory: directory,
+		ACMEEmail:     email,
+	}
+	if err := s.clusterRepo.CreateCertificate(cert); err != nil {
+		return nil, fmt.Errorf("failed to save certificate: %w", err)
+	}
+
+	go s.runACMEIssue(cert.ID)
+	return s.certificateInfo(cert, cluster), nil
+}
+
+// RenewCertificate reissues a self-signed certificate right away and starts a new order for
+// an ACME certificate. Uploaded and CSR certificates have to be replaced by their owner.
+func (s *nginxClusterService) RenewCertificate(ctx context.Context, clusterID, certID string) (*dto.NginxCertificateInfo, error) {
+	cluster, cert, err := s.findCertificate(clusterID, certID)
+	if err != nil {
+		return nil, err
+	}
+	switch cert.Source {
+	case certSourceSelfSigned:
+		if err := s.renewCertificate(ctx, cert); err != nil {
+			return nil, err
+		}
+	case certSourceACME:
+		go s.runACMEIssue(cert.ID)
+	default:
+		return nil, fmt.Errorf("%s certificates cannot be renewed by the platform, upload a new one", cert.Source)
+	}
+	return s.certificateInfo(cert, cluster), nil
+}
+
+// DeployCertificate writes the certificate to every node again and reloads nginx
+func (s *nginxClusterService) DeployCertificate(ctx context.Context, clusterID, certID string) error {
+	cluster, cert, err := s.findCertificate(clusterID, certID)
+	if err != nil {
+		return err
+	}
+	if cert.Status != certStatusActive {
+		return fmt.Errorf("certificate %s is %s", cert.Name, cert.Status)
+	}
+	return s.deployCertificate(ctx, cluster, cert)
+}
+
+// SetDefaultCertificate makes a certificate the one used by TLS server blocks without ssl_cert_id
+func (s *nginxClusterService) SetDefaultCertificate(ctx context.Context, clusterID, certID string) error {
+	cluster, cert, err := s.findCertificate(clusterID, certID)
+	if err != nil {
+		return err
+	}
+	if cert.Status != certStatusActive {
+		return fmt.Errorf("certificate %s is %s", cert.Name, cert.Status)
+	}
+	cluster.DefaultCertID = cert.ID
+	if err := s.clusterRepo.Update(cluster); err != nil {
+		return fmt.Errorf("failed to update cluster: %w", err)
+	}
+	return s.deployCertificate(ctx, cluster, cert)
+}
+
+// DeleteCertificate removes a certificate that is neither the default nor used by a server block
+func (s *nginxClusterService) DeleteCertificate(ctx context.Context, clusterID, certID string) error {
+	cluster, cert, err := s.findCertificate(clusterID, certID)
+	if err != nil {
+		return err
+	}
+	if cluster.DefaultCertID == cert.ID {
+		return fmt.Errorf("certificate %s is the cluster default", cert.Name)
+	}
+	blocks, _ := s.clusterRepo.ListServerBlocks(clusterID)
+	for _, block := range blocks {
+		if block.SSLCertID == cert.ID {
+			return fmt.Errorf("certificate %s is used by server block %s", cert.Name, block.ServerName)
+		}
+	}
+	streams, _ := s.clusterRepo.ListStreamProxies(clusterID)
+	for _, stream := range streams {
+		if stream.SSLCertID == cert.ID {
+			return fmt.Errorf("certificate %s is used by stream %s", cert.Name, stream.Name)
+		}
+	}
+	if err := s.clusterRepo.DeleteCertificate(cert.ID); err != nil {
+		return fmt.Errorf("failed to delete certificate: %w", err)
+	}
+
+	nodes, _ := s.clusterRepo.ListNodes(clusterID)
+	files := fmt.Sprintf("%s/%s.crt %s/%s.key", nginxSSLDir, cert.ID, nginxSSLDir, cert.ID)
+	for _, node := range nodes {
+		s.dockerSvc.ExecStream(ctx, node.ContainerID, []string{"sh", "-c", "rm -f " + files}, nil, nil)
+	}
+	return nil
+}
+
+// StartCertificateRenewal renews auto-renewing certificates that expire within 30 days, once at
+// startup and then on every tick, so a restart never postpones a due renewal by a whole interval
+func (s *nginxClusterService) StartCertificateRenewal(ctx context.Context) {
+	go func() {
+		s.renewDueCertificates(ctx)
+
+		ticker := time.NewTicker(certRenewalInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.renewDueCertificates(ctx)
+			}
+		}
+	}()
+}
+
+func (s *nginxClusterService) renewDueCertificates(ctx context.Context) {
+	certs, err := s.clusterRepo.ListAutoRenewCertificates(time.Now().Add(certRenewBefore))
+	if err != nil {
+		s.logger.Warn("failed to list certificates for renewal", zap.Error(err))
+		return
+	}
+	for i := range certs {
+		if ctx.Err() != nil {
+			return
+		}
+		renewCtx, cancel := context.WithTimeout(ctx, acmeIssueTimeout)
+		if err := s.renewCertificate(renewCtx, &certs[i]); err != nil {
+			s.logger.Error("certificate renewal failed", zap.String("certificate_id", certs[i].ID), zap.Error(err))
+		}
+		cancel()
+	}
+}
+
+// renewCertificate reissues a certificate in place and deploys it. A failed renewal keeps the
+// current certificate active and records the error.
+func (s *nginxClusterService) renewCertificate(ctx context.Context, cert *entities.NginxCertificate) error {
+	var err error
+	switch cert.Source {
+	case certSourceSelfSigned:
+		err = s.issueSelfSigned(cert)
+	case certSourceACME:
+		err = s.issueACME(ctx, cert)
+	default:
+		return fmt.Errorf("%s certificates cannot be renewed by the platform", cert.Source)
+	}
+	if err != nil {
+		cert.LastError = err.Error()
+		s.clusterRepo.UpdateCertificate(cert)
+		return err
+	}
+
+	now := time.Now()
+	cert.RenewedAt = &now
+	if err := s.clusterRepo.UpdateCertificate(cert); err != nil {
+		return fmt.Errorf("failed to save certificate: %w", err)
+	}
+	cluster, err := s.clusterRepo.FindByID(cert.ClusterID)
+	if err != nil {
+		return fmt.Errorf("cluster not found: %w", err)
+	}
+	s.deployAndRecord(ctx, cluster, cert)
+	s.logger.Info("certificate renewed", zap.String("certificate_id", cert.ID), zap.String("name", cert.Name))
+	return nil
+}
+
+// runACMEIssue runs an ACME order in the background for a new or renewing certificate
+func (s *nginxClusterService) runACMEIssue(certID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), acmeIssueTimeout)
+	defer cancel()
+
+	cert, err := s.clusterRepo.FindCertificateByID(certID)
+	if err != nil {
+		return
+	}
+	if cert.Status == certStatusActive {
+		if err := s.renewCertificate(ctx, cert); err != nil {
+			s.logger.Error("ACME renewal failed", zap.String("certificate_id", certID), zap.Error(err))
+		}
+		return
+	}
+
+	if err := s.issueACME(ctx, cert); err != nil {
+		s.logger.Error("ACME issuance failed", zap.String("certificate_id", certID), zap.Error(err))
+		cert.Status = certStatusFailed
+		cert.LastError = err.Error()
+		s.clusterRepo.UpdateCertificate(cert)
+		return
+	}
+	if err := s.clusterRepo.UpdateCertificate(cert); err != nil {
+		s.logger.Error("failed to save ACME certificate", zap.String("certificate_id", certID), zap.Error(err))
+		return
+	}
+	cluster, err := s.clusterRepo.FindByID(cert.ClusterID)
+	if err != nil {
+		return
+	}
+	s.deployAndRecord(ctx, cluster, cert)
+	s.logger.Info("ACME certificate issued", zap.String("certificate_id", certID), zap.String("common_name", cert.CommonName))
+}
+
+// issueACME completes an ACME order, placing the HTTP-01 responses in the ACME webroot of
+// every node so the challenge succeeds whichever node holds the VIP
+func (s *nginxClusterService) issueACME(ctx context.Context, cert *entities.NginxCertificate) error {
+	var domains []string
+	if err := json.Unmarshal([]byte(cert.DNSNames), &domains); err != nil || len(domains) == 0 {
+		return fmt.Errorf("certificate has no domains")
+	}
+
+	if cert.ACMEAccountKey == "" {
+		_, accountPEM, err := pki.GenerateKey()
+		if err != nil {
+			return err
+		}
+		if cert.ACMEAccountKey, err = s.keyCipher.Seal(accountPEM); err != nil {
+			return err
+		}
+	}
+	accountPEM, err := s.keyCipher.Open(cert.ACMEAccountKey)
+	if err != nil {
+		return err
+	}
+	accountKey, err := pki.ParsePrivateKey(accountPEM)
+	if err != nil {
+		return fmt.Errorf("invalid ACME account key: %w", err)
+	}
+	httpClient, err := s.acmeHTTPClient()
+	if err != nil {
+		return err
+	}
+	client := &acme.Client{Key: accountKey, DirectoryURL: cert.ACMEDirectory, HTTPClient: httpClient}
+
+	account := &acme.Account{}
+	if cert.ACMEEmail != "" {
+		account.Contact = []string{"mailto:" + cert.ACMEEmail}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return fmt.Errorf("failed to create ACME order: %w", err)
+	}
+
+	nodes, err := s.clusterRepo.ListNodes(cert.ClusterID)
+	if err != nil || len(nodes) == 0 {
+		return fmt.Errorf("cluster has no nodes to answer HTTP-01 challenges")
+	}
+	var written []string
+	defer func() {
+		if len(written) == 0 {
+			return
+		}
+		cleanup := []string{"rm", "-f"}
+		cleanup = append(cleanup, written...)
+		for _, node := range nodes {
+			s.dockerSvc.ExecStream(context.Background(), node.ContainerID, cleanup, nil, nil)
+		}
+	}()
+
+	for _, authzURL := range order.AuthzURLs {
+		authz, err := client.GetAuthorization(ctx, authzURL)
+		if err != nil {
+			return fmt.Errorf("failed to get ACME authorization: %w", err)
+		}
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+
+		var challenge *acme.Challenge
+		for _, c := range authz.Challenges {
+			if c.Type == acmeHTTP01ChallengeTyp {
+				challenge = c
+				break
+			}
+		}
+		if challenge == nil {
+			return fmt.Errorf("ACME server offers no HTTP-01 challenge for %s", authz.Identifier.Value)
+		}
+
+		response, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return fmt.Errorf("failed to build challenge response: %w", err)
+		}
+		path := nginxACMEWebroot + client.HTTP01ChallengePath(challenge.Token)
+		for _, node := range nodes {
+			if err := s.writeNginxFile(ctx, node.ContainerID, path, response); err != nil {
+				return fmt.Errorf("failed to write challenge on %s: %w", node.Name, err)
+			}
+		}
+		written = append(written, path)
+
+		if _, err := client.Accept(ctx, challenge); err != nil {
+			return fmt.Errorf("failed to accept challenge for %s: %w", authz.Identifier.Value, err)
+		}
+		if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+			return fmt.Errorf("authorization for %s failed: %w", authz.Identifier.Value, err)
+		}
+	}
+
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return fmt.Errorf("ACME order failed: %w", err)
+	}
+
+	key, keyPEM, err := pki.GenerateKey()
+	if err != nil {
+		return err
+	}
+	csrPEM, err := pki.CreateCSR(key, domains[0], "", domains)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(csrPEM)
+	der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, block.Bytes, true)
+	if err != nil {
+		return fmt.Errorf("failed to finalize ACME order: %w", err)
+	}
+	return s.activateCertificate(cert, pki.EncodeChain(der), keyPEM)
+}
+
+// acmeHTTPClient trusts the configured extra CA on top of the system roots
+func (s *nginxClusterService) acmeHTTPClient() (*http.Client, error) {
+	if s.acmeConfig.CACertFile == "" {
+		return http.DefaultClient, nil
+	}
+	caPEM, err := os.ReadFile(s.acmeConfig.CACertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACME CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", s.acmeConfig.CACertFile)
+	}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}, nil
+}
+
+// importCertificate validates an uploaded chain and key and stores them as an active certificate
+func (s *nginxClusterService) importCertificate(clusterID, name, certPEM, keyPEM string) (*entities.NginxCertificate, error) {
+	cert := &entities.NginxCertificate{
+		ID:        uuid.New().String(),
+		ClusterID: clusterID,
+		Name:      name,
+		Source:    certSourceUploaded,
+	}
+	if err := s.activateCertificate(cert, []byte(certPEM), []byte(keyPEM)); err != nil {
+		return nil, err
+	}
+	if cert.NotAfter.Before(time.Now()) {
+		return nil, fmt.Errorf("certificate expired on %s", cert.NotAfter.Format(time.RFC3339))
+	}
+	if err := s.clusterRepo.CreateCertificate(cert); err != nil {
+		return nil, fmt.Errorf("failed to save certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// issueSelfSigned replaces the certificate material with a new self-signed certificate
+func (s *nginxClusterService) issueSelfSigned(cert *entities.NginxCertificate) error {
+	var names []string
+	json.Unmarshal([]byte(cert.DNSNames), &names)
+	validDays := cert.ValidDays
+	if validDays <= 0 {
+		validDays = defaultSelfSignedDays
+	}
+	issued, err := pki.SelfSignedCertificate(cert.CommonName, names, time.Duration(validDays)*24*time.Hour)
+	if err != nil {
+		return err
+	}
+	return s.activateCertificate(cert, issued.CertPEM, issued.KeyPEM)
+}
+
+// activateCertificate checks that the chain matches the key and copies the leaf details and the
+// encrypted key onto the record
+func (s *nginxClusterService) activateCertificate(cert *entities.NginxCertificate, certPEM, keyPEM []byte) error {
+	leaf, err := pki.ParseKeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := pki.Fingerprint(certPEM)
+	if err != nil {
+		return err
+	}
+	sealedKey, err := s.keyCipher.Seal(keyPEM)
+	if err != nil {
+		return err
+	}
+
+	names := leaf.DNSNames
+	for _, ip := range leaf.IPAddresses {
+		names = append(names, ip.String())
+	}
+	dnsNames, _ := json.Marshal(names)
+	notBefore, notAfter := leaf.NotBefore, leaf.NotAfter
+
+	cert.CertPEM = string(certPEM)
+	cert.KeyPEM = sealedKey
+	cert.CommonName = leaf.Subject.CommonName
+	cert.DNSNames = string(dnsNames)
+	cert.Issuer = leaf.Issuer.CommonName
+	cert.SerialNumber = leaf.SerialNumber.Text(16)
+	cert.Fingerprint = fingerprint
+	cert.NotBefore = &notBefore
+	cert.NotAfter = &notAfter
+	cert.Status = certStatusActive
+	cert.LastError = ""
+	return nil
+}
+
+// deployAndRecord deploys a certificate and keeps a deploy failure on the record instead of failing the caller
+func (s *nginxClusterService) deployAndRecord(ctx context.Context, cluster *entities.NginxCluster, cert *entities.NginxCertificate) {
+	if err := s.deployCertificate(ctx, cluster, cert); err != nil {
+		s.logger.Warn("certificate deploy incomplete", zap.String("certificate_id", cert.ID), zap.Error(err))
+		cert.LastError = err.Error()
+		s.clusterRepo.UpdateCertificate(cert)
+	}
+}
+
+// deployCertificate writes a certificate to every node, then validates and reloads nginx there
+func (s *nginxClusterService) deployCertificate(ctx context.Context, cluster *entities.NginxCluster, cert *entities.NginxCertificate) error {
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	failedNodes := []string{}
+	for _, node := range nodes {
+		err := s.writeCertificateFiles(ctx, node.ContainerID, cert.ID, cert.CertPEM, cert.KeyPEM)
+		if err == nil && cluster.DefaultCertID == cert.ID {
+			err = s.writeCertificateFiles(ctx, node.ContainerID, nginxDefaultCertName, cert.CertPEM, cert.KeyPEM)
+		}
+		if err == nil {
+			err = s.dockerSvc.ExecStream(ctx, node.ContainerID, []string{"nginx", "-t", "-q"}, nil, nil)
+		}
+		if err == nil {
+			err = s.dockerSvc.ExecStream(ctx, node.ContainerID, []string{"nginx", "-s", "reload"}, nil, nil)
+		}
+		if err != nil {
+			s.logger.Error("failed to deploy certificate", zap.String("node", node.Name), zap.Error(err))
+			failedNodes = append(failedNodes, node.Name)
+		}
+	}
+	if len(failedNodes) > 0 {
+		return fmt.Errorf("certificate deploy failed on nodes: %s", strings.Join(failedNodes, ", "))
+	}
+	return nil
+}
+
+// installTLSFiles writes every active certificate of the cluster to a node, plus the default
+// certificate used by TLS server blocks without a certificate of their own
+func (s *nginxClusterService) installTLSFiles(ctx context.Context, cluster *entities.NginxCluster, containerID string) error {
+	certs, err := s.clusterRepo.ListCertificates(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list certificates: %w", err)
+	}
+	defaultWritten := false
+	for _, cert := range certs {
+		if cert.Status != certStatusActive {
+			continue
+		}
+		if err := s.writeCertificateFiles(ctx, containerID, cert.ID, cert.CertPEM, cert.KeyPEM); err != nil {
+			return err
+		}
+		if cert.ID == cluster.DefaultCertID {
+			if err := s.writeCertificateFiles(ctx, containerID, nginxDefaultCertName, cert.CertPEM, cert.KeyPEM); err != nil {
+				return err
+			}
+			defaultWritten = true
+		}
+	}
+
+	// Clusters created before the certificate store keep their inline certificate
+	if !defaultWritten && cluster.SSLCertificate != "" && cluster.SSLPrivateKey != "" {
+		return s.writeCertificateFiles(ctx, containerID, nginxDefaultCertName, cluster.SSLCertificate, cluster.SSLPrivateKey)
+	}
+	return nil
+}
+
+// writeCertificateFiles writes <name>.crt and <name>.key into the nginx SSL directory of a node.
+// storedKey is the key as stored in the database and is decrypted here.
+func (s *nginxClusterService) writeCertificateFiles(ctx context.Context, containerID, name, certPEM, storedKey string) error {
+	keyPEM, err := s.keyCipher.Open(storedKey)
+	if err != nil {
+		return err
+	}
+	certPath := fmt.Sprintf("%s/%s.crt", nginxSSLDir, name)
+	keyPath := fmt.Sprintf("%s/%s.key", nginxSSLDir, name)
+	if err := s.writeNginxFile(ctx, containerID, certPath, certPEM); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	// The key file is created with mode 600 so it is never readable by others, not even briefly
+	cmd := []string{"sh", "-c", fmt.Sprintf("umask 077 && mkdir -p %s && cat > %s && chmod 600 %s", nginxSSLDir, keyPath, keyPath)}
+	if err := s.dockerSvc.ExecStream(ctx, containerID, cmd, bytes.NewReader(keyPEM), nil); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	return nil
+}
+
+func (s *nginxClusterService) findCertificate(clusterID, certID string) (*entities.NginxCluster, *entities.NginxCertificate, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	cert, err := s.clusterRepo.FindCertificateByID(certID)
+	if err != nil || cert.ClusterID != clusterID {
+		return nil, nil, fmt.Errorf("certificate not found")
+	}
+	return cluster, cert, nil
+}
+
+func (s *nginxClusterService) certificateInfo(cert *entities.NginxCertificate, cluster *entities.NginxCluster) *dto.NginxCertificateInfo {
+	blocks, _ := s.clusterRepo.ListServerBlocks(cluster.ID)
+	info := toCertificateInfo(cert, cluster, blocks)
+	if cert.Status == certStatusPending {
+		info.CSRPEM = cert.CSRPEM
+	}
+	return &info
+}
+
+// certificateNames puts the common name first and drops duplicates and unsafe values
+func certificateNames(commonName string, names []string) ([]string, error) {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, name := range append([]string{commonName}, names...) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if err := nginxSafeValue("domain", name); err != nil {
+			return nil, err
+		}
+		if strings.ContainsAny(name, " \t/") {
+			return nil, fmt.Errorf("invalid domain %q", name)
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("at least one domain is required")
+	}
+	return result, nil
+}
+
+func toCertificateInfo(cert *entities.NginxCertificate, cluster *entities.NginxCluster, blocks []entities.NginxServerBlock) dto.NginxCertificateInfo {
+	var names []string
+	json.Unmarshal([]byte(cert.DNSNames), &names)
+
+	info := dto.NginxCertificateInfo{
+		ID:           cert.ID,
+		Name:         cert.Name,
+		Source:       cert.Source,
+		Status:       cert.Status,
+		CommonName:   cert.CommonName,
+		DNSNames:     names,
+		Issuer:       cert.Issuer,
+		SerialNumber: cert.SerialNumber,
+		Fingerprint:  cert.Fingerprint,
+		AutoRenew:    cert.AutoRenew,
+		IsDefault:    cluster.DefaultCertID == cert.ID,
+		LastError:    cert.LastError,
+		CreatedAt:    cert.CreatedAt.Format(time.RFC3339),
+	}
+	if cert.NotBefore != nil {
+		info.NotBefore = cert.NotBefore.Format(time.RFC3339)
+	}
+	if cert.NotAfter != nil {
+		info.NotAfter = cert.NotAfter.Format(time.RFC3339)
+		info.DaysRemaining = int(time.Until(*cert.NotAfter).Hours() / 24)
+		if cert.Status == certStatusActive && cert.NotAfter.Before(time.Now()) {
+			info.Status = certStatusExpired
+			info.DaysRemaining = 0
+		}
+	}
+	if cert.RenewedAt != nil {
+		info.RenewedAt = cert.RenewedAt.Format(time.RFC3339)
+	}
+	for _, block := range blocks {
+		if block.SSLCertID == cert.ID {
+			info.UsedBy = append(info.UsedBy, block.ServerName)
+		}
+	}
+	return info
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/pki"
+)
+
+func TestIssueSelfSignedSealsKey(t *testing.T) {
+	keyCipher, err := pki.NewKeyCipher("test-secret")
+	require.NoError(t, err)
+	svc := &nginxClusterService{keyCipher: keyCipher}
+
+	cert := &entities.NginxCertificate{CommonName: "example.com", DNSNames: `["example.com"]`}
+	require.NoError(t, svc.issueSelfSigned(cert))
+
+	assert.Equal(t, certStatusActive, cert.Status)
+	assert.False(t, strings.Contains(cert.KeyPEM, "PRIVATE KEY"), "key must not be stored in plaintext")
+
+	keyPEM, err := keyCipher.Open(cert.KeyPEM)
+	require.NoError(t, err)
+	_, err = pki.ParseKeyPair([]byte(cert.CertPEM), keyPEM)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ListLocations lists the locations of a server block
+func (s *nginxClusterService) ListLocations(ctx context.Context, clusterID, blockID string) ([]dto.LocationInfo, error) {
+	if _, err := s.findServerBlock(clusterID, blockID); err != nil {
+		return nil, err
+	}
+	locations, err := s.clusterRepo.ListLocations(blockID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]dto.LocationInfo, 0, len(locations))
+	for _, loc := range locations {
+		result = append(result, toLocationInfo(loc))
+	}
+	return result, nil
+}
+
+// AddLocation adds a location to a server block and applies the regenerated config.
+// The location is removed again when nginx rejects the result.
+func (s *nginxClusterService) AddLocation(ctx context.Context, userID, clusterID, blockID string, req dto.AddNginxLocationRequest) (*dto.LocationInfo, error) {
+	if _, err := s.findServerBlock(clusterID, blockID); err != nil {
+		return nil, err
+	}
+
+	headers, _ := json.Marshal(req.ProxyHeaders)
+	location := &entities.NginxLocation{
+		ID:            uuid.New().String(),
+		ServerBlockID: blockID,
+		Modifier:      req.Modifier,
+		Path:          req.Path,
+		ProxyPass:     req.ProxyPass,
+		ProxyHeaders:  string(headers),
+		CacheEnabled:  req.CacheEnabled,
+		RateLimit:     req.RateLimit,
+	}
+	if err := s.validateLocation(clusterID, location); err != nil {
+		return nil, err
+	}
+
+	if err := s.clusterRepo.CreateLocation(location); err != nil {
+		return nil, fmt.Errorf("failed to save location: %w", err)
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "add location "+location.Path); err != nil {
+		s.clusterRepo.DeleteLocation(location.ID)
+		return nil, err
+	}
+
+	info := toLocationInfo(*location)
+	return &info, nil
+}
+
+// UpdateLocation replaces a location; the previous version is restored when nginx rejects the result
+func (s *nginxClusterService) UpdateLocation(ctx context.Context, userID, clusterID, blockID, locationID string, req dto.UpdateNginxLocationRequest) (*dto.LocationInfo, error) {
+	location, err := s.findLocation(clusterID, blockID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	previous := *location
+
+	headers, _ := json.Marshal(req.ProxyHeaders)
+	location.Modifier = req.Modifier
+	location.Path = req.Path
+	location.ProxyPass = req.ProxyPass
+	location.ProxyHeaders = string(headers)
+	location.CacheEnabled = req.CacheEnabled
+	location.RateLimit = req.RateLimit
+	if err := s.validateLocation(clusterID, location); err != nil {
+		return nil, err
+	}
+
+	if err := s.clusterRepo.UpdateLocation(location); err != nil {
+		return nil, fmt.Errorf("failed to save location: %w", err)
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "update location "+location.Path); err != nil {
+		if restoreErr := s.clusterRepo.UpdateLocation(&previous); restoreErr != nil {
+			s.logger.Error("failed to restore location", zap.String("location_id", locationID), zap.Error(restoreErr))
+		}
+		return nil, err
+	}
+
+	info := toLocationInfo(*location)
+	return &info, nil
+}
+
+// DeleteLocation removes a location; it is put back when the regenerated config cannot be applied
+func (s *nginxClusterService) DeleteLocation(ctx context.Context, userID, clusterID, blockID, locationID string) error {
+	location, err := s.findLocation(clusterID, blockID, locationID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.clusterRepo.DeleteLocation(locationID); err != nil {
+		return fmt.Errorf("failed to delete location: %w", err)
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "delete location "+location.Path); err != nil {
+		if restoreErr := s.clusterRepo.CreateLocation(location); restoreErr != nil {
+			s.logger.Error("failed to restore location", zap.String("location_id", locationID), zap.Error(restoreErr))
+		}
+		return err
+	}
+	s.deleteAccessPolicies(ctx, clusterID, func(policy entities.NginxAccessPolicy) bool {
+		return policy.LocationID == locationID
+	})
+	return nil
+}
+
+// validateLocation checks modifier, path and proxy_pass before anything is stored
+func (s *nginxClusterService) validateLocation(clusterID string, location *entities.NginxLocation) error {
+	if err := validateLocationPath(location.Modifier, location.Path); err != nil {
+		return err
+	}
+	if location.RateLimit < 0 {
+		return fmt.Errorf("rate_limit must not be negative")
+	}
+
+	siblings, err := s.clusterRepo.ListLocations(location.ServerBlockID)
+	if err != nil {
+		return fmt.Errorf("failed to list locations: %w", err)
+	}
+	for _, other := range siblings {
+		if other.ID != location.ID && other.Modifier == location.Modifier && other.Path == location.Path {
+			return fmt.Errorf("location %s %s already exists in this server block", location.Modifier, location.Path)
+		}
+	}
+
+	if location.ProxyPass == "" && location.TrafficMode == "" {
+		return nil
+	}
+	upstreamNames, err := s.clusterUpstreamNames(clusterID)
+	if err != nil {
+		return err
+	}
+	// A traffic policy stays attached when the location is replaced
+	if err := validateTrafficPolicy(*location, upstreamNames); err != nil {
+		return err
+	}
+	target, err := nginxProxyTarget(location.ProxyPass, upstreamNames)
+	if err != nil {
+		return err
+	}
+	return validateRegexProxyPass(location.Modifier, target)
+}
+
+func (s *nginxClusterService) findServerBlock(clusterID, blockID string) (*entities.NginxServerBlock, error) {
+	block, err := s.clusterRepo.FindServerBlockByID(blockID)
+	if err != nil || block.ClusterID != clusterID {
+		return nil, fmt.Errorf("server block not found")
+	}
+	return block, nil
+}
+
+func (s *nginxClusterService) findLocation(clusterID, blockID, locationID string) (*entities.NginxLocation, error) {
+	if _, err := s.findServerBlock(clusterID, blockID); err != nil {
+		return nil, err
+	}
+	location, err := s.clusterRepo.FindLocationByID(locationID)
+	if err != nil || location.ServerBlockID != blockID {
+		return nil, fmt.Errorf("location not found")
+	}
+	return location, nil
+}
+
+func toLocationInfo(loc entities.NginxLocation) dto.LocationInfo {
+	var headers map[string]string
+	json.Unmarshal([]byte(loc.ProxyHeaders), &headers)
+	info := dto.LocationInfo{
+		ID:           loc.ID,
+		Modifier:     loc.Modifier,
+		Path:         loc.Path,
+		ProxyPass:    loc.ProxyPass,
+		ProxyHeaders: headers,
+		CacheEnabled: loc.CacheEnabled,
+		RateLimit:    loc.RateLimit,
+	}
+	if loc.TrafficMode != "" {
+		policy := toTrafficPolicy(loc)
+		info.Traffic = &policy
+	}
+	return info
+}
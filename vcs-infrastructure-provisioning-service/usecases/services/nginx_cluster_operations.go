@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+// ListOperations returns tracked operations for a cluster, newest first
+func (s *nginxClusterService) ListOperations(ctx context.Context, clusterID string) ([]dto.ClusterOperationInfo, error) {
+	ops, err := s.clusterRepo.ListOperations(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+
+	result := make([]dto.ClusterOperationInfo, len(ops))
+	for i := range ops {
+		result[i] = toNginxOperationDTO(&ops[i])
+	}
+	return result, nil
+}
+
+// GetOperation returns a single tracked operation
+func (s *nginxClusterService) GetOperation(ctx context.Context, clusterID, operationID string) (*dto.ClusterOperationInfo, error) {
+	op, err := s.clusterRepo.FindOperationByID(operationID)
+	if err != nil {
+		return nil, fmt.Errorf("operation not found: %w", err)
+	}
+	if op.ClusterID != clusterID {
+		return nil, fmt.Errorf("operation does not belong to this cluster")
+	}
+
+	info := toNginxOperationDTO(op)
+	return &info, nil
+}
+
+func toNginxOperationDTO(op *entities.NginxClusterOperation) dto.ClusterOperationInfo {
+	info := dto.ClusterOperationInfo{
+		ID:            op.ID,
+		ClusterID:     op.ClusterID,
+		OperationType: op.OperationType,
+		Status:        op.Status,
+		Progress:      op.Progress,
+		CurrentStep:   op.CurrentStep,
+		ErrorMessage:  op.ErrorMessage,
+		StartedAt:     op.StartedAt.Format(time.RFC3339),
+	}
+	if op.Details != "" {
+		json.Unmarshal([]byte(op.Details), &info.Details)
+	}
+	if op.CompletedAt != nil {
+		info.CompletedAt = op.CompletedAt.Format(time.RFC3339)
+	}
+	return info
+}
+
+// startOperation records a new running operation for the cluster
+func (s *nginxClusterService) startOperation(clusterID, opType string, details map[string]interface{}) (*entities.NginxClusterOperation, error) {
+	detailsJSON, _ := json.Marshal(details)
+	op := &entities.NginxClusterOperation{
+		ID:            uuid.New().String(),
+		ClusterID:     clusterID,
+		OperationType: opType,
+		Status:        "running",
+		CurrentStep:   "starting",
+		Details:       string(detailsJSON),
+	}
+	if err := s.clusterRepo.CreateOperation(op); err != nil {
+		return nil, fmt.Errorf("failed to create operation record: %w", err)
+	}
+	return op, nil
+}
+
+// setOperationStep records progress of a running operation
+func (s *nginxClusterService) setOperationStep(op *entities.NginxClusterOperation, progress int, step string) {
+	op.Progress = progress
+	op.CurrentStep = step
+	if err := s.clusterRepo.UpdateOperation(op); err != nil {
+		s.logger.Warn("failed to update operation", zap.String("operation_id", op.ID), zap.Error(err))
+	}
+	s.logger.Info("nginx cluster operation progress",
+		zap.String("operation_id", op.ID),
+		zap.String("type", op.OperationType),
+		zap.Int("progress", progress),
+		zap.String("step", step))
+}
+
+// setOperationDetail adds a key to the operation details JSON
+func (s *nginxClusterService) setOperationDetail(op *entities.NginxClusterOperation, key string, value interface{}) {
+	details := map[string]interface{}{}
+	if op.Details != "" {
+		json.Unmarshal([]byte(op.Details), &details)
+	}
+	details[key] = value
+	detailsJSON, _ := json.Marshal(details)
+	op.Details = string(detailsJSON)
+	s.clusterRepo.UpdateOperation(op)
+}
+
+// finishOperation marks an operation completed, or failed when err is set
+func (s *nginxClusterService) finishOperation(op *entities.NginxClusterOperation, err error) {
+	now := time.Now()
+	op.CompletedAt = &now
+	if err != nil {
+		op.Status = "failed"
+		op.ErrorMessage = err.Error()
+		s.logger.Error("nginx cluster operation failed", zap.String("operation_id", op.ID), zap.String("type", op.OperationType), zap.Error(err))
+	} else {
+		op.Status = "completed"
+		op.Progress = 100
+		op.CurrentStep = "done"
+		s.logger.Info("nginx cluster operation completed", zap.String("operation_id", op.ID), zap.String("type", op.OperationType))
+	}
+	if updateErr := s.clusterRepo.UpdateOperation(op); updateErr != nil {
+		s.logger.Warn("failed to update operation", zap.String("operation_id", op.ID), zap.Error(updateErr))
+	}
+}
+
+// RecoverOperations fails operations left running by a previous process, which would otherwise
+// block every later resize of their cluster. Nodes stopped halfway through being recreated are
+// started again, and a node recreated without its new container ID being stored is picked up
+// by name and gets its configuration again.
+func (s *nginxClusterService) RecoverOperations(ctx context.Context) {
+	ops, err := s.clusterRepo.ListRunningOperations()
+	if err != nil {
+		s.logger.Warn("failed to list interrupted nginx cluster operations", zap.Error(err))
+		return
+	}
+	for i := range ops {
+		op := &ops[i]
+		message := "interrupted by a service restart"
+		if problems := s.recoverClusterNodes(ctx, op.ClusterID); len(problems) > 0 {
+			message = fmt.Sprintf("%s; %s", message, strings.Join(problems, "; "))
+		}
+		s.finishOperation(op, errors.New(message))
+	}
+}
+
+// recoverClusterNodes starts the stopped nodes of a running cluster and returns what could not
+// be repaired
+func (s *nginxClusterService) recoverClusterNodes(ctx context.Context, clusterID string) []string {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil || cluster.Infrastructure.Status != entities.StatusRunning {
+		return nil
+	}
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to list nodes: %v", err)}
+	}
+
+	var problems []string
+	for i := range nodes {
+		node := &nodes[i]
+		info, err := s.dockerSvc.InspectContainer(ctx, node.ContainerID)
+		recreated := false
+		if err != nil {
+			// Containers are named after their node
+			if info, err = s.dockerSvc.InspectContainer(ctx, node.Name); err != nil {
+				problems = append(problems, fmt.Sprintf("container of node %s is missing", node.Name))
+				continue
+			}
+			node.ContainerID = info.ID
+			recreated = true
+		}
+		if info.State == nil || !info.State.Running {
+			if err := s.dockerSvc.StartContainer(ctx, node.ContainerID); err != nil {
+				problems = append(problems, fmt.Sprintf("failed to start node %s: %v", node.Name, err))
+				continue
+			}
+		}
+		if !recreated {
+			continue
+		}
+		if containerInfo, err := s.dockerSvc.InspectContainer(ctx, node.ContainerID); err == nil && containerInfo.NetworkSettings != nil {
+			node.IPAddress = containerInfo.NetworkSettings.IPAddress
+		}
+		if err := s.clusterRepo.UpdateNode(node); err != nil {
+			problems = append(problems, fmt.Sprintf("failed to update node %s: %v", node.Name, err))
+			continue
+		}
+		if err := s.restoreNodeFiles(ctx, cluster, node); err != nil {
+			problems = append(problems, fmt.Sprintf("node %s: %v", node.Name, err))
+		}
+	}
+	return problems
+}
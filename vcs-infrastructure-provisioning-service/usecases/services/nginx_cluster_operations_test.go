@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+)
+
+// fakeNginxOperationRepo keeps operations and nodes in memory; other repository methods are not used
+type fakeNginxOperationRepo struct {
+	repositories.INginxClusterRepository
+	cluster *entities.NginxCluster
+	nodes   []entities.NginxNode
+	ops     map[string]*entities.NginxClusterOperation
+}
+
+func (r *fakeNginxOperationRepo) FindByID(id string) (*entities.NginxCluster, error) {
+	return r.cluster, nil
+}
+
+func (r *fakeNginxOperationRepo) ListNodes(clusterID string) ([]entities.NginxNode, error) {
+	return r.nodes, nil
+}
+
+func (r *fakeNginxOperationRepo) UpdateNode(node *entities.NginxNode) error {
+	for i := range r.nodes {
+		if r.nodes[i].ID == node.ID {
+			r.nodes[i] = *node
+		}
+	}
+	return nil
+}
+
+func (r *fakeNginxOperationRepo) CreateOperation(op *entities.NginxClusterOperation) error {
+	stored := *op
+	r.ops[op.ID] = &stored
+	return nil
+}
+
+func (r *fakeNginxOperationRepo) UpdateOperation(op *entities.NginxClusterOperation) error {
+	stored := *op
+	r.ops[op.ID] = &stored
+	return nil
+}
+
+func (r *fakeNginxOperationRepo) FindRunningOperation(clusterID, opType string) (*entities.NginxClusterOperation, error) {
+	for _, op := range r.ops {
+		if op.ClusterID == clusterID && op.OperationType == opType && op.Status == "running" {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func (r *fakeNginxOperationRepo) ListRunningOperations() ([]entities.NginxClusterOperation, error) {
+	var ops []entities.NginxClusterOperation
+	for _, op := range r.ops {
+		if op.Status == "running" {
+			ops = append(ops, *op)
+		}
+	}
+	return ops, nil
+}
+
+// fakeNginxNodeDocker resolves containers by ID or name
+type fakeNginxNodeDocker struct {
+	docker.IDockerService
+	names   map[string]string // name -> ID
+	running map[string]bool
+}
+
+func (d *fakeNginxNodeDocker) InspectContainer(ctx context.Context, ref string) (*types.ContainerJSON, error) {
+	id := ref
+	if named, ok := d.names[ref]; ok {
+		id = named
+	}
+	running, ok := d.running[id]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", ref)
+	}
+	return &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: id, State: &types.ContainerState{Running: running}},
+		NetworkSettings:   &types.NetworkSettings{DefaultNetworkSettings: types.DefaultNetworkSettings{IPAddress: "10.0.0.9"}},
+	}, nil
+}
+
+func (d *fakeNginxNodeDocker) StartContainer(ctx context.Context, containerID string) error {
+	d.running[containerID] = true
+	return nil
+}
+
+func TestRecoverNginxOperationsUnblocksResize(t *testing.T) {
+	repo := &fakeNginxOperationRepo{
+		cluster: &entities.NginxCluster{ID: "c1", Infrastructure: entities.Infrastructure{Status: entities.StatusRunning}},
+		nodes: []entities.NginxNode{
+			{ID: "n1", Name: "web-nginx-1", ContainerID: "old-1"},
+			{ID: "n2", Name: "web-nginx-2", ContainerID: "c-2"},
+		},
+		ops: map[string]*entities.NginxClusterOperation{},
+	}
+	// Node 1 was recreated but its new ID never stored; node 2 was stopped and not started again
+	dockerSvc := &fakeNginxNodeDocker{
+		names:   map[string]string{"web-nginx-1": "new-1", "web-nginx-2": "c-2"},
+		running: map[string]bool{"new-1": true, "c-2": false},
+	}
+	svc := &nginxClusterService{clusterRepo: repo, dockerSvc: dockerSvc, logger: nopLogger{}}
+
+	resize, err := svc.startOperation("c1", "resize", nil)
+	require.NoError(t, err)
+
+	svc.RecoverOperations(context.Background())
+
+	recovered := repo.ops[resize.ID]
+	assert.Equal(t, "failed", recovered.Status)
+	assert.Equal(t, "interrupted by a service restart", recovered.ErrorMessage)
+	assert.Equal(t, "new-1", repo.nodes[0].ContainerID)
+	assert.True(t, dockerSvc.running["c-2"])
+
+	_, err = repo.FindRunningOperation("c1", "resize")
+	assert.Error(t, err, "no resize is left running")
+}
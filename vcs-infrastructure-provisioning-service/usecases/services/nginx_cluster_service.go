@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"net"
+	"net/url"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -16,7 +18,9 @@ import (
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/kafka"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/env"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/pki"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
 )
 
@@ -32,28 +36,83 @@ type INginxClusterService interface {
 	// Node operations
 	AddNode(ctx context.Context, clusterID string, req dto.AddNginxNodeRequest) (*dto.NginxNodeInfo, error)
 	RemoveNode(ctx context.Context, clusterID, nodeID string) error
+	ResizeCluster(ctx context.Context, clusterID string, req dto.ResizeNginxClusterRequest) (*dto.ClusterOperationInfo, error)
+
+	// Operations
+	ListOperations(ctx context.Context, clusterID string) ([]dto.ClusterOperationInfo, error)
+	GetOperation(ctx context.Context, clusterID, operationID string) (*dto.ClusterOperationInfo, error)
+	RecoverOperations(ctx context.Context)
 
 	// Configuration
-	UpdateClusterConfig(ctx context.Context, clusterID string, req dto.UpdateNginxClusterConfigRequest) error
+	UpdateClusterConfig(ctx context.Context, userID, clusterID string, req dto.UpdateNginxClusterConfigRequest) error
+
+	// Config revisions
+	ListConfigRevisions(ctx context.Context, clusterID string, limit int) (*dto.NginxConfigRevisionListResponse, error)
+	GetConfigRevision(ctx context.Context, clusterID string, revision, against int) (*dto.NginxConfigRevisionInfo, error)
+	RollbackConfig(ctx context.Context, userID, clusterID string, req dto.RollbackNginxConfigRequest) (*dto.NginxConfigRevisionInfo, error)
 
 	// Upstreams
-	AddUpstream(ctx context.Context, clusterID string, req dto.AddNginxUpstreamRequest) error
-	UpdateUpstream(ctx context.Context, clusterID, upstreamID string, req dto.UpdateNginxUpstreamRequest) error
-	DeleteUpstream(ctx context.Context, clusterID, upstreamID string) error
+	AddUpstream(ctx context.Context, userID, clusterID string, req dto.AddNginxUpstreamRequest) error
+	UpdateUpstream(ctx context.Context, userID, clusterID, upstreamID string, req dto.UpdateNginxUpstreamRequest) error
+	DeleteUpstream(ctx context.Context, userID, clusterID, upstreamID string) error
 	ListUpstreams(ctx context.Context, clusterID string) ([]dto.UpstreamInfo, error)
 
 	// Server blocks
-	AddServerBlock(ctx context.Context, clusterID string, req dto.AddNginxServerBlockRequest) error
-	DeleteServerBlock(ctx context.Context, clusterID, blockID string) error
+	AddServerBlock(ctx context.Context, userID, clusterID string, req dto.AddNginxServerBlockRequest) error
+	DeleteServerBlock(ctx context.Context, userID, clusterID, blockID string) error
 	ListServerBlocks(ctx context.Context, clusterID string) ([]dto.ServerBlockInfo, error)
 
+	// Locations
+	ListLocations(ctx context.Context, clusterID, blockID string) ([]dto.LocationInfo, error)
+	AddLocation(ctx context.Context, userID, clusterID, blockID string, req dto.AddNginxLocationRequest) (*dto.LocationInfo, error)
+	UpdateLocation(ctx context.Context, userID, clusterID, blockID, locationID string, req dto.UpdateNginxLocationRequest) (*dto.LocationInfo, error)
+	DeleteLocation(ctx context.Context, userID, clusterID, blockID, locationID string) error
+
+	// Access Policies
+	ListAccessPolicies(ctx context.Context, clusterID string) ([]dto.NginxAccessPolicyInfo, error)
+	CreateAccessPolicy(ctx context.Context, userID, clusterID string, req dto.CreateNginxAccessPolicyRequest) (*dto.NginxAccessPolicyInfo, error)
+	UpdateAccessPolicy(ctx context.Context, userID, clusterID, policyID string, req dto.UpdateNginxAccessPolicyRequest) (*dto.NginxAccessPolicyInfo, error)
+	DeleteAccessPolicy(ctx context.Context, userID, clusterID, policyID string) error
+	SetBasicAuthUser(ctx context.Context, clusterID, policyID string, req dto.SetNginxBasicAuthUserRequest) (*dto.NginxAccessPolicyInfo, error)
+	DeleteBasicAuthUser(ctx context.Context, clusterID, policyID, username string) error
+
+	// Stream Proxies
+	ListStreamProxies(ctx context.Context, clusterID string) ([]dto.NginxStreamProxyInfo, error)
+	AddStreamProxy(ctx context.Context, userID, clusterID string, req dto.AddNginxStreamProxyRequest) (*dto.NginxStreamProxyInfo, error)
+	UpdateStreamProxy(ctx context.Context, userID, clusterID, streamID string, req dto.UpdateNginxStreamProxyRequest) (*dto.NginxStreamProxyInfo, error)
+	DeleteStreamProxy(ctx context.Context, userID, clusterID, streamID string) error
+
+	// Traffic Policies
+	GetTrafficPolicy(ctx context.Context, clusterID, blockID, locationID string) (*dto.NginxTrafficPolicyInfo, error)
+	SetTrafficPolicy(ctx context.Context, userID, clusterID, blockID, locationID string, req dto.SetNginxTrafficPolicyRequest) (*dto.NginxTrafficPolicyInfo, error)
+	SwitchTraffic(ctx context.Context, userID, clusterID, blockID, locationID string, req dto.SwitchNginxTrafficRequest) (*dto.NginxTrafficPolicyInfo, error)
+	RollbackTrafficPolicy(ctx context.Context, userID, clusterID, blockID, locationID string, req dto.RollbackNginxTrafficPolicyRequest) (*dto.NginxTrafficPolicyInfo, error)
+
 	// Health & Monitoring
 	GetClusterHealth(ctx context.Context, clusterID string) (*dto.NginxClusterHealthResponse, error)
 	GetClusterMetrics(ctx context.Context, clusterID string) (*dto.NginxClusterMetricsResponse, error)
+	GetMetricsHistory(ctx context.Context, clusterID, nodeID string, from, to time.Time, limit int) (*dto.NginxMetricsHistoryResponse, error)
+	StartMetricsCollector(ctx context.Context)
 
 	// Failover
 	TriggerFailover(ctx context.Context, clusterID string, req dto.TriggerNginxFailoverRequest) (*dto.NginxFailoverResponse, error)
 	GetFailoverHistory(ctx context.Context, clusterID string) (*dto.NginxFailoverHistoryResponse, error)
+	StartVRRPMonitor(ctx context.Context)
+	StartUpstreamHealthChecker(ctx context.Context)
+
+	// Certificates
+	ListCertificates(ctx context.Context, clusterID string) ([]dto.NginxCertificateInfo, error)
+	GetCertificate(ctx context.Context, clusterID, certID string) (*dto.NginxCertificateInfo, error)
+	UploadCertificate(ctx context.Context, clusterID string, req dto.UploadNginxCertificateRequest) (*dto.NginxCertificateInfo, error)
+	CreateCertificateCSR(ctx context.Context, clusterID string, req dto.CreateNginxCSRRequest) (*dto.NginxCertificateInfo, error)
+	CompleteCertificateCSR(ctx context.Context, clusterID, certID string, req dto.CompleteNginxCSRRequest) (*dto.NginxCertificateInfo, error)
+	IssueSelfSignedCertificate(ctx context.Context, clusterID string, req dto.IssueSelfSignedCertificateRequest) (*dto.NginxCertificateInfo, error)
+	RequestACMECertificate(ctx context.Context, clusterID string, req dto.RequestACMECertificateRequest) (*dto.NginxCertificateInfo, error)
+	RenewCertificate(ctx context.Context, clusterID, certID string) (*dto.NginxCertificateInfo, error)
+	DeployCertificate(ctx context.Context, clusterID, certID string) error
+	SetDefaultCertificate(ctx context.Context, clusterID, certID string) error
+	DeleteCertificate(ctx context.Context, clusterID, certID string) error
+	StartCertificateRenewal(ctx context.Context)
 }
 
 type nginxClusterService struct {
@@ -62,6 +121,17 @@ type nginxClusterService struct {
 	dockerSvc     docker.IDockerService
 	kafkaProducer kafka.IKafkaProducer
 	logger        logger.ILogger
+	acmeConfig    env.ACMEEnv
+	keyCipher     *pki.KeyCipher
+
+	// configMu guards configLocks, which serialize the config revisions and rollouts of each cluster
+	configMu    sync.Mutex
+	configLocks map[string]*sync.Mutex
+	// vrrpMu keeps manual failovers and the VRRP monitor from racing on the master record
+	vrrpMu sync.Mutex
+	// metricsMu guards lastScrape, the previous stub_status reading of each node
+	metricsMu  sync.Mutex
+	lastScrape map[string]nodeScrape
 }
 
 // NewNginxClusterService creates a new Nginx cluster service
@@ -70,7 +140,9 @@ func NewNginxClusterService(
 	clusterRepo repositories.INginxClusterRepository,
 	dockerSvc docker.IDockerService,
 	kafkaProducer kafka.IKafkaProducer,
+	keyCipher *pki.KeyCipher,
 	logger logger.ILogger,
+	acmeConfig env.ACMEEnv,
 ) INginxClusterService {
 	return &nginxClusterService{
 		infraRepo:     infraRepo,
@@ -78,6 +150,8 @@ func NewNginxClusterService(
 		dockerSvc:     dockerSvc,
 		kafkaProducer: kafkaProducer,
 		logger:        logger,
+		acmeConfig:    acmeConfig,
+		keyCipher:     keyCipher,
 	}
 }
 
@@ -131,6 +205,11 @@ func (s *nginxClusterService) CreateCluster(ctx context.Context, userID string,
 	if req.SSLProtocols == "" {
 		req.SSLProtocols = "TLSv1.2 TLSv1.3"
 	}
+	if req.SSLCertificate != "" || req.SSLPrivateKey != "" {
+		if _, err := pki.ParseKeyPair([]byte(req.SSLCertificate), []byte(req.SSLPrivateKey)); err != nil {
+			return nil, fmt.Errorf("invalid ssl certificate: %w", err)
+		}
+	}
 
 	// Create infrastructure record
 	infraID := uuid.New().String()
@@ -168,8 +247,6 @@ func (s *nginxClusterService) CreateCluster(ctx context.Context, userID string,
 
 		// SSL
 		SSLEnabled:        req.SSLEnabled,
-		SSLCertificate:    req.SSLCertificate,
-		SSLPrivateKey:     req.SSLPrivateKey,
 		SSLProtocols:      req.SSLProtocols,
 		SSLSessionTimeout: req.SSLSessionTimeout,
 
@@ -207,6 +284,17 @@ func (s *nginxClusterService) CreateCluster(ctx context.Context, userID string,
 		return nil, fmt.Errorf("failed to create cluster: %w", err)
 	}
 
+	// An inline certificate goes into the certificate store as the cluster default
+	if req.SSLCertificate != "" {
+		cert, err := s.importCertificate(clusterID, nginxDefaultCertName, req.SSLCertificate, req.SSLPrivateKey)
+		if err != nil {
+			s.updateInfraStatus(infraID, entities.StatusFailed)
+			return nil, err
+		}
+		cluster.DefaultCertID = cert.ID
+		s.clusterRepo.Update(cluster)
+	}
+
 	// Create dedicated network
 	networkName := fmt.Sprintf("nginx-cluster-%s", clusterID[:8])
 	networkID, err := s.dockerSvc.CreateNetwork(ctx, networkName)
@@ -246,20 +334,20 @@ func (s *nginxClusterService) CreateCluster(ctx context.Context, userID string,
 
 	// Create upstreams if provided
 	for _, upstream := range req.Upstreams {
-		if err := s.createUpstream(ctx, clusterID, upstream); err != nil {
+		if _, err := s.createUpstream(ctx, clusterID, upstream); err != nil {
 			s.logger.Warn("failed to create upstream", zap.String("name", upstream.Name), zap.Error(err))
 		}
 	}
 
 	// Create server blocks if provided
 	for _, block := range req.ServerBlocks {
-		if err := s.createServerBlock(ctx, clusterID, block); err != nil {
+		if _, err := s.createServerBlock(ctx, clusterID, block); err != nil {
 			s.logger.Warn("failed to create server block", zap.String("name", block.ServerName), zap.Error(err))
 		}
 	}
 
 	// Generate and apply nginx config
-	if err := s.generateAndApplyConfig(ctx, cluster); err != nil {
+	if err := s.generateAndApplyConfig(ctx, cluster, userID, "initial configuration"); err != nil {
 		s.logger.Warn("failed to apply initial config", zap.Error(err))
 	}
 
@@ -284,11 +372,16 @@ func (s *nginxClusterService) createNginxNode(ctx context.Context, cluster *enti
 		fmt.Sprintf("NGINX_NODE_ROLE=%s", role),
 		fmt.Sprintf("KEEPALIVED_STATE=%s", strings.ToUpper(role)),
 		fmt.Sprintf("KEEPALIVED_PRIORITY=%d", priority),
-		"KEEPALIVED_INTERFACE=eth0",
+		fmt.Sprintf("KEEPALIVED_INTERFACE=%s", cluster.VRRPInterface),
 		fmt.Sprintf("KEEPALIVED_ROUTER_ID=%d", cluster.VRRPRouterID),
 		fmt.Sprintf("VIRTUAL_IP=%s", cluster.VirtualIP),
 		fmt.Sprintf("HTTP_PORT=%d", cluster.HTTPPort),
 	}
+	vrrpEnv, err := keepalivedEnv(cluster, &entities.NginxNode{Name: nodeName, Role: role, Priority: priority})
+	if err != nil {
+		return nil, err
+	}
+	env = append(env, vrrpEnv...)
 
 	ports := map[string]string{
 		"80": fmt.Sprintf("%d", httpPort),
@@ -296,20 +389,31 @@ func (s *nginxClusterService) createNginxNode(ctx context.Context, cluster *enti
 	if httpsPort > 0 {
 		ports["443"] = fmt.Sprintf("%d", httpsPort)
 	}
+	// Nodes added later publish the stream proxies of the cluster as well
+	if streams, err := s.clusterRepo.ListStreamProxies(cluster.ID); err == nil && len(streams) > 0 {
+		placeholder := entities.NginxNode{ID: nodeID, HTTPPort: httpPort, HTTPSPort: httpsPort}
+		nodes, _ := s.clusterRepo.ListNodes(cluster.ID)
+		ports, err = s.nodePorts(&placeholder, streams, s.reservedHostPorts(append(nodes, placeholder)))
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	containerID, err := s.dockerSvc.CreateContainer(ctx, docker.ContainerConfig{
 		Name:         nodeName,
-		Image:        "nginx:alpine",
+		Image:        nginxKeepalivedImage,
 		Network:      networkName,
 		NetworkAlias: nodeName,
 		Env:          env,
 		Ports:        ports,
+		CapAdd:       keepalivedCapabilities,
 		Resources: docker.ResourceConfig{
 			CPULimit:    cluster.CPULimit,
 			MemoryLimit: cluster.MemoryLimit,
 		},
 	})
 	if err != nil {
+		s.clusterRepo.DeleteStreamPortsByNodeID(nodeID)
 		return nil, fmt.Errorf("failed to create container: %w", err)
 	}
 
@@ -601,6 +705,7 @@ func (s *nginxClusterService) RemoveNode(ctx context.Context, clusterID, nodeID
 		s.dockerSvc.RemoveContainer(ctx, node.ContainerID)
 	}
 
+	s.clusterRepo.DeleteStreamPortsByNodeID(nodeID)
 	s.clusterRepo.DeleteNode(nodeID)
 
 	// Update cluster node count
@@ -611,117 +716,217 @@ func (s *nginxClusterService) RemoveNode(ctx context.Context, clusterID, nodeID
 	return nil
 }
 
-// UpdateClusterConfig updates nginx configuration on all nodes
-func (s *nginxClusterService) UpdateClusterConfig(ctx context.Context, clusterID string, req dto.UpdateNginxClusterConfigRequest) error {
+// ResizeCluster starts a background operation that changes CPU/memory limits node by node,
+// backups first and the master last. Limits are updated live when possible; otherwise the
+// container is recreated and the cluster config re-applied before moving on to the next node.
+func (s *nginxClusterService) ResizeCluster(ctx context.Context, clusterID string, req dto.ResizeNginxClusterRequest) (*dto.ClusterOperationInfo, error) {
 	cluster, err := s.clusterRepo.FindByID(clusterID)
 	if err != nil {
-		return fmt.Errorf("cluster not found: %w", err)
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	if running, err := s.clusterRepo.FindRunningOperation(clusterID, "resize"); err == nil {
+		return nil, fmt.Errorf("resize %s is already running", running.ID)
 	}
 
-	cluster.NginxConfig = req.NginxConfig
-	s.clusterRepo.Update(cluster)
-
-	if req.ReloadAll {
-		return s.syncConfig(ctx, clusterID)
+	op, err := s.startOperation(clusterID, "resize", map[string]interface{}{
+		"from_cpu_per_node":    cluster.CPULimit,
+		"from_memory_per_node": cluster.MemoryLimit,
+		"to_cpu_per_node":      req.CPUPerNode,
+		"to_memory_per_node":   req.MemoryPerNode,
+		"force_recreate":       req.ForceRecreate,
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+
+	go func() {
+		bgCtx, cancel := context.WithTimeout(context.Background(), 1*time.Hour)
+		defer cancel()
+		s.finishOperation(op, s.runClusterResize(bgCtx, op, cluster, req))
+	}()
+
+	info := toNginxOperationDTO(op)
+	return &info, nil
 }
 
-// syncConfig synchronizes configuration to all nodes following NGINX best practices
-func (s *nginxClusterService) syncConfig(ctx context.Context, clusterID string) error {
-	cluster, err := s.clusterRepo.FindByID(clusterID)
+func (s *nginxClusterService) runClusterResize(ctx context.Context, op *entities.NginxClusterOperation, cluster *entities.NginxCluster, req dto.ResizeNginxClusterRequest) error {
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
 	if err != nil {
-		return fmt.Errorf("cluster not found: %w", err)
+		return fmt.Errorf("failed to list nodes: %w", err)
 	}
 
-	s.logger.Info("starting config synchronization", zap.String("cluster_id", clusterID))
+	// Backups first so the master keeps serving until every peer is done
+	ordered := make([]entities.NginxNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Role != "master" {
+			ordered = append(ordered, node)
+		}
+	}
+	for _, node := range nodes {
+		if node.Role == "master" {
+			ordered = append(ordered, node)
+		}
+	}
 
-	// Step 1: Validate config on primary (master) node first
-	masterNode, err := s.getMasterNode(clusterID)
-	if err != nil {
-		return fmt.Errorf("failed to get master node: %w", err)
+	resources := docker.ResourceConfig{
+		CPULimit:    req.CPUPerNode,
+		MemoryLimit: req.MemoryPerNode,
 	}
 
-	// Validate on master
-	if err := s.validateNginxConfig(ctx, masterNode.ContainerID, cluster.NginxConfig); err != nil {
-		s.logger.Error("config validation failed on master", zap.Error(err))
-		return fmt.Errorf("config validation failed on master: %w", err)
+	resized := []dto.NginxNodeResizeInfo{}
+	for i := range ordered {
+		node := &ordered[i]
+		s.setOperationStep(op, 5+90*i/len(ordered), fmt.Sprintf("resizing %s node %s", node.Role, node.Name))
+		method, err := s.resizeNginxNode(ctx, cluster, node, resources, req.ForceRecreate)
+		if err != nil {
+			return fmt.Errorf("failed to resize node %s: %w", node.Name, err)
+		}
+		resized = append(resized, dto.NginxNodeResizeInfo{
+			NodeID: node.ID,
+			Name:   node.Name,
+			Role:   node.Role,
+			Method: method,
+		})
+		s.setOperationDetail(op, "nodes", resized)
 	}
 
-	s.logger.Info("config validated on master node", zap.String("master_node", masterNode.Name))
+	cluster.CPULimit = req.CPUPerNode
+	cluster.MemoryLimit = req.MemoryPerNode
+	if err := s.clusterRepo.Update(cluster); err != nil {
+		return fmt.Errorf("failed to update cluster limits: %w", err)
+	}
 
-	// Step 2: Sync to all peer nodes
-	nodes, _ := s.clusterRepo.ListNodes(clusterID)
-	successCount := 0
-	failedNodes := []string{}
+	s.publishEvent(ctx, "cluster.resized", cluster.InfrastructureID, cluster.ID, string(entities.StatusRunning))
+	s.logger.Info("nginx cluster resized",
+		zap.String("cluster_id", cluster.ID),
+		zap.Int64("cpu_per_node", req.CPUPerNode),
+		zap.Int64("memory_per_node", req.MemoryPerNode))
+	return nil
+}
 
-	for _, node := range nodes {
-		if node.ID == masterNode.ID {
-			// Master already validated, just apply
-			if err := s.applyConfigToNode(ctx, node.ContainerID, cluster.NginxConfig); err != nil {
-				s.logger.Error("failed to apply config to master", zap.String("node_id", node.ID), zap.Error(err))
-				failedNodes = append(failedNodes, node.Name)
-			} else {
-				successCount++
-			}
-			continue
+// resizeNginxNode applies new limits to a single node and returns the method used (live, recreate)
+func (s *nginxClusterService) resizeNginxNode(ctx context.Context, cluster *entities.NginxCluster, node *entities.NginxNode, resources docker.ResourceConfig, forceRecreate bool) (string, error) {
+	if !forceRecreate {
+		err := s.dockerSvc.UpdateContainerResources(ctx, node.ContainerID, resources)
+		if err == nil {
+			return "live", nil
 		}
+		s.logger.Warn("live resize failed, recreating node", zap.String("node_id", node.ID), zap.Error(err))
+	}
 
-		// For peer nodes: backup -> validate -> apply -> reload
-		if err := s.syncConfigToNode(ctx, &node, cluster.NginxConfig); err != nil {
-			s.logger.Error("failed to sync config to peer", zap.String("node_id", node.ID), zap.Error(err))
-			failedNodes = append(failedNodes, node.Name)
-		} else {
-			successCount++
-		}
+	inspect, err := s.dockerSvc.InspectContainer(ctx, node.ContainerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container: %w", err)
+	}
+	config := containerConfigFromInspect(ctx, s.dockerSvc, inspect, cluster.NetworkID)
+	config.Resources = resources
+	if err := s.recreateNginxNode(ctx, cluster, node, config); err != nil {
+		return "", err
+	}
+	return "recreate", nil
+}
+
+// recreateNginxNode replaces the container of a node with one built from config, for changes
+// docker cannot apply to a running container such as published ports
+func (s *nginxClusterService) recreateNginxNode(ctx context.Context, cluster *entities.NginxCluster, node *entities.NginxNode, config docker.ContainerConfig) error {
+	// The recreated node must come up with its current priority, not the one it was created with
+	if vrrpEnv, err := keepalivedEnv(cluster, node); err == nil {
+		config.Env = replaceKeepalivedEnv(config.Env, vrrpEnv)
+	}
+	inspect, err := s.dockerSvc.InspectContainer(ctx, node.ContainerID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+	extraNetworks := secondaryNetworks(inspect, config.Network)
+
+	if err := s.dockerSvc.StopContainer(ctx, node.ContainerID); err != nil {
+		return fmt.Errorf("failed to stop container: %w", err)
+	}
+	if err := s.dockerSvc.RemoveContainer(ctx, node.ContainerID); err != nil {
+		return fmt.Errorf("failed to remove container: %w", err)
 	}
 
-	s.logger.Info("config synchronization completed",
-		zap.Int("success", successCount),
-		zap.Int("failed", len(failedNodes)),
-		zap.Strings("failed_nodes", failedNodes))
+	containerID, err := s.dockerSvc.CreateContainer(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+	if err := connectNetworks(ctx, s.dockerSvc, containerID, extraNetworks); err != nil {
+		return err
+	}
+	if err := s.dockerSvc.StartContainer(ctx, containerID); err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
 
-	if len(failedNodes) > 0 {
-		return fmt.Errorf("config sync failed on %d nodes: %v", len(failedNodes), failedNodes)
+	node.ContainerID = containerID
+	if containerInfo, err := s.dockerSvc.InspectContainer(ctx, containerID); err == nil && containerInfo.NetworkSettings != nil {
+		node.IPAddress = containerInfo.NetworkSettings.IPAddress
 	}
+	if err := s.clusterRepo.UpdateNode(node); err != nil {
+		return fmt.Errorf("failed to update node: %w", err)
+	}
+
+	return s.restoreNodeFiles(ctx, cluster, node)
+}
 
+// restoreNodeFiles pushes nginx.conf, certificates and htpasswd files to a recreated node, since
+// they live in the container layer
+func (s *nginxClusterService) restoreNodeFiles(ctx context.Context, cluster *entities.NginxCluster, node *entities.NginxNode) error {
+	if cluster.NginxConfig == "" {
+		return nil
+	}
+	if err := s.installTLSFiles(ctx, cluster, node.ContainerID); err != nil {
+		return fmt.Errorf("failed to restore certificates: %w", err)
+	}
+	if err := s.installAuthFiles(ctx, cluster, node.ContainerID); err != nil {
+		return fmt.Errorf("failed to restore htpasswd files: %w", err)
+	}
+	if err := s.syncConfigToNode(ctx, node, cluster.NginxConfig); err != nil {
+		return fmt.Errorf("failed to restore config: %w", err)
+	}
 	return nil
 }
 
+// UpdateClusterConfig stores a hand-written nginx.conf as a new revision. With ReloadAll it is
+// rolled out canary first; otherwise it stays pending until it is applied through a rollback.
+func (s *nginxClusterService) UpdateClusterConfig(ctx context.Context, userID, clusterID string, req dto.UpdateNginxClusterConfigRequest) error {
+	defer s.lockConfig(clusterID)()
+
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return fmt.Errorf("cluster not found: %w", err)
+	}
+	_, err = s.commitConfig(ctx, cluster, req.NginxConfig, userID, "manual config update", 0, req.ReloadAll)
+	return err
+}
+
 // syncConfigToNode syncs config to a single peer node with backup and rollback
 func (s *nginxClusterService) syncConfigToNode(ctx context.Context, node *entities.NginxNode, config string) error {
 	containerID := node.ContainerID
 
 	// Step 1: Backup current config
 	backupPath := fmt.Sprintf("/etc/nginx/nginx.conf.backup.%d", time.Now().Unix())
-	backupCmd := fmt.Sprintf("cp /etc/nginx/nginx.conf %s", backupPath)
-	if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", backupCmd}); err != nil {
+	if err := s.dockerSvc.ExecStream(ctx, containerID, []string{"cp", "/etc/nginx/nginx.conf", backupPath}, nil, nil); err != nil {
 		return fmt.Errorf("failed to backup config: %w", err)
 	}
 
 	s.logger.Info("config backed up", zap.String("node", node.Name), zap.String("backup_path", backupPath))
 
-	// Step 2: Write new config
-	writeCmd := fmt.Sprintf("cat > /etc/nginx/nginx.conf << 'EOF'\n%s\nEOF", config)
-	if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", writeCmd}); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
+	// Step 2: Validate new config before it replaces the running one
+	if err := s.validateNginxConfig(ctx, containerID, config); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
 	}
 
-	// Step 3: Validate new config
-	if err := s.validateNginxConfig(ctx, containerID, config); err != nil {
-		// Rollback on validation failure
-		s.logger.Warn("validation failed, rolling back", zap.String("node", node.Name))
-		rollbackCmd := fmt.Sprintf("cp %s /etc/nginx/nginx.conf", backupPath)
-		s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", rollbackCmd})
-		return fmt.Errorf("config validation failed, rolled back: %w", err)
+	// Step 3: Write new config
+	if err := s.writeNginxFile(ctx, containerID, "/etc/nginx/nginx.conf", config); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
 	}
 
 	// Step 4: Reload nginx
-	if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"nginx", "-s", "reload"}); err != nil {
+	if err := s.dockerSvc.ExecStream(ctx, containerID, []string{"nginx", "-s", "reload"}, nil, nil); err != nil {
 		// Rollback on reload failure
 		s.logger.Warn("reload failed, rolling back", zap.String("node", node.Name))
 		rollbackCmd := fmt.Sprintf("cp %s /etc/nginx/nginx.conf && nginx -s reload", backupPath)
-		s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", rollbackCmd})
+		s.dockerSvc.ExecStream(ctx, containerID, []string{"sh", "-c", rollbackCmd}, nil, nil)
 		return fmt.Errorf("nginx reload failed, rolled back: %w", err)
 	}
 
@@ -729,29 +934,21 @@ func (s *nginxClusterService) syncConfigToNode(ctx context.Context, node *entiti
 	return nil
 }
 
-// validateNginxConfig validates nginx configuration
+// validateNginxConfig runs nginx -t against the config in a scratch file
 func (s *nginxClusterService) validateNginxConfig(ctx context.Context, containerID string, config string) error {
-	// Write config to temp file and test
-	testCmd := fmt.Sprintf("cat > /tmp/nginx.conf.test << 'EOF'\n%s\nEOF && nginx -t -c /tmp/nginx.conf.test", config)
-	output, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", testCmd})
-	if err != nil {
-		return fmt.Errorf("nginx -t failed: %w, output: %s", err, output)
+	if err := s.writeNginxFile(ctx, containerID, "/tmp/nginx.conf.test", config); err != nil {
+		return fmt.Errorf("failed to write test config: %w", err)
+	}
+	if err := s.dockerSvc.ExecStream(ctx, containerID, []string{"nginx", "-t", "-q", "-c", "/tmp/nginx.conf.test"}, nil, nil); err != nil {
+		return fmt.Errorf("nginx -t failed: %w", err)
 	}
 	return nil
 }
 
-// applyConfigToNode applies config without validation (already validated)
-func (s *nginxClusterService) applyConfigToNode(ctx context.Context, containerID string, config string) error {
-	writeCmd := fmt.Sprintf("cat > /etc/nginx/nginx.conf << 'EOF'\n%s\nEOF", config)
-	if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", writeCmd}); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
-	}
-
-	if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"nginx", "-s", "reload"}); err != nil {
-		return fmt.Errorf("nginx reload failed: %w", err)
-	}
-
-	return nil
+// writeNginxFile writes a file inside a node through stdin, so the content needs no shell quoting
+func (s *nginxClusterService) writeNginxFile(ctx context.Context, containerID, path, content string) error {
+	cmd := []string{"sh", "-c", fmt.Sprintf("mkdir -p \"$(dirname %s)\" && cat > %s", path, path)}
+	return s.dockerSvc.ExecStream(ctx, containerID, cmd, strings.NewReader(content), nil)
 }
 
 // getMasterNode returns the master node of the cluster
@@ -770,181 +967,29 @@ func (s *nginxClusterService) getMasterNode(clusterID string) (*entities.NginxNo
 	return nil, fmt.Errorf("no master node found")
 }
 
-// generateAndApplyConfig generates default nginx config and applies to all nodes
-func (s *nginxClusterService) generateAndApplyConfig(ctx context.Context, cluster *entities.NginxCluster) error {
-	config := s.generateNginxConfig(cluster)
-	cluster.NginxConfig = config
-	s.clusterRepo.Update(cluster)
-
-	return s.syncConfig(ctx, cluster.ID)
-}
+// generateAndApplyConfig renders nginx.conf and rolls it out as a new revision.
+// Nothing is recorded when the rendered config matches the one already applied.
+func (s *nginxClusterService) generateAndApplyConfig(ctx context.Context, cluster *entities.NginxCluster, author, reason string) error {
+	defer s.lockConfig(cluster.ID)()
 
-// generateNginxConfig generates nginx configuration from cluster settings
-func (s *nginxClusterService) generateNginxConfig(cluster *entities.NginxCluster) string {
-	workerProcesses := "auto"
-	if cluster.WorkerProcesses > 0 {
-		workerProcesses = fmt.Sprintf("%d", cluster.WorkerProcesses)
+	config, err := s.generateNginxConfig(cluster)
+	if err != nil {
+		return err
 	}
-
-	// Build configuration
-	config := fmt.Sprintf(`# Nginx Configuration - Generated by IaaS Platform
-# Cluster: %s
-# Generated at: %s
-
-worker_processes %s;
-error_log /var/log/nginx/error.log %s;
-pid /var/run/nginx.pid;
-
-events {
-    worker_connections %d;
-    use epoll;
-    multi_accept on;
-}
-
-http {
-    include /etc/nginx/mime.types;
-    default_type application/octet-stream;
-
-    # Logging Configuration
-    log_format main '$remote_addr - $remote_user [$time_local] "$request" '
-                    '$status $body_bytes_sent "$http_referer" '
-                    '"$http_user_agent" "$http_x_forwarded_for" '
-                    'rt=$request_time uct="$upstream_connect_time" '
-                    'uht="$upstream_header_time" urt="$upstream_response_time"';
-`,
-		cluster.ClusterName,
-		time.Now().Format(time.RFC3339),
-		workerProcesses,
-		cluster.ErrorLogLevel,
-		cluster.WorkerConnections,
-	)
-
-	// Access log
-	if cluster.AccessLogEnabled {
-		config += "    access_log /var/log/nginx/access.log main;\n"
-	} else {
-		config += "    access_log off;\n"
-	}
-
-	// Basic settings
-	config += fmt.Sprintf(`
-    # Performance Settings
-    sendfile on;
-    tcp_nopush on;
-    tcp_nodelay on;
-    keepalive_timeout %d;
-    types_hash_max_size 2048;
-    server_tokens off;
-    client_max_body_size %s;
-
-`, cluster.KeepaliveTimeout, cluster.ClientMaxBodySize)
-
-	// Gzip compression
-	if cluster.GzipEnabled {
-		config += fmt.Sprintf(`    # Gzip Compression
-    gzip on;
-    gzip_vary on;
-    gzip_proxied any;
-    gzip_comp_level %d;
-    gzip_min_length %d;
-    gzip_types %s;
-
-`, cluster.GzipLevel, cluster.GzipMinLength, cluster.GzipTypes)
-	}
-
-	// Rate limiting
-	if cluster.RateLimitEnabled {
-		config += fmt.Sprintf(`    # Rate Limiting
-    limit_req_zone $binary_remote_addr zone=api_limit:10m rate=%dr/s;
-
-`, cluster.RateLimitRequestsPerSec)
-	}
-
-	// Caching
-	if cluster.CacheEnabled && cluster.CachePath != "" {
-		config += fmt.Sprintf(`    # Proxy Cache
-    proxy_cache_path %s levels=1:2 keys_zone=nginx_cache:10m max_size=%s inactive=60m use_temp_path=off;
-
-`, cluster.CachePath, cluster.CacheSize)
-	}
-
-	// SSL settings if enabled
-	if cluster.SSLEnabled {
-		config += fmt.Sprintf(`    # SSL Settings
-    ssl_protocols %s;
-    ssl_prefer_server_ciphers on;
-    ssl_session_cache shared:SSL:10m;
-    ssl_session_timeout %s;
-    ssl_session_tickets off;
-
-`, cluster.SSLProtocols, cluster.SSLSessionTimeout)
-	}
-
-	// Proxy settings
-	config += `    # Proxy Settings
-    proxy_http_version 1.1;
-    proxy_set_header Host $host;
-    proxy_set_header X-Real-IP $remote_addr;
-    proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
-    proxy_set_header X-Forwarded-Proto $scheme;
-    proxy_set_header Connection "";
-    proxy_connect_timeout 60s;
-    proxy_send_timeout 60s;
-    proxy_read_timeout 60s;
-    proxy_buffering on;
-    proxy_buffer_size 4k;
-    proxy_buffers 8 4k;
-
-`
-
-	// Default server block
-	config += `    # Default Server
-    server {
-        listen 80 default_server;
-        server_name _;
-
-        # Health check endpoint
-        location /health {
-            access_log off;
-            return 200 "{\"status\":\"healthy\",\"cluster\":\"` + cluster.ClusterName + `\"}";
-            add_header Content-Type application/json;
-        }
-
-        # Nginx status for monitoring
-        location /nginx_status {
-            stub_status on;
-            access_log off;
-            allow 127.0.0.1;
-            allow 10.0.0.0/8;
-            allow 172.16.0.0/12;
-            allow 192.168.0.0/16;
-            deny all;
-        }
-
-        # Root
-        location / {
-            root /usr/share/nginx/html;
-            index index.html index.htm;
-            try_files $uri $uri/ =404;
-        }
-`
-
-	// Add rate limiting to default server if enabled
-	if cluster.RateLimitEnabled {
-		config += fmt.Sprintf(`
-        # Apply rate limiting
-        limit_req zone=api_limit burst=%d nodelay;
-`, cluster.RateLimitBurst)
-	}
-
-	config += `    }
-}
-`
-	return config
+	if config == cluster.NginxConfig && cluster.ConfigRevision > 0 {
+		return nil
+	}
+	_, err = s.commitConfig(ctx, cluster, config, author, reason, 0, true)
+	return err
 }
 
-// createUpstream creates an upstream
-func (s *nginxClusterService) createUpstream(ctx context.Context, clusterID string, req dto.CreateUpstreamRequest) error {
+// createUpstream creates an upstream and returns its ID
+func (s *nginxClusterService) createUpstream(ctx context.Context, clusterID string, req dto.CreateUpstreamRequest) (string, error) {
+	for _, srv := range req.Servers {
+		if err := nginxServerAddress("upstream server", srv.Address); err != nil {
+			return "", err
+		}
+	}
 	upstreamID := uuid.New().String()
 	upstream := &entities.NginxClusterUpstream{
 		ID:          upstreamID,
@@ -953,9 +998,10 @@ func (s *nginxClusterService) createUpstream(ctx context.Context, clusterID stri
 		Algorithm:   req.Algorithm,
 		HealthCheck: req.HealthCheck,
 		HealthPath:  req.HealthPath,
+		Version:     req.Version,
 	}
 	if err := s.clusterRepo.CreateUpstream(upstream); err != nil {
-		return err
+		return "", err
 	}
 
 	for _, srv := range req.Servers {
@@ -970,11 +1016,11 @@ func (s *nginxClusterService) createUpstream(ctx context.Context, clusterID stri
 		}
 		s.clusterRepo.CreateUpstreamServer(server)
 	}
-	return nil
+	return upstreamID, nil
 }
 
-// createServerBlock creates a server block
-func (s *nginxClusterService) createServerBlock(ctx context.Context, clusterID string, req dto.CreateServerBlockRequest) error {
+// createServerBlock creates a server block and returns its ID
+func (s *nginxClusterService) createServerBlock(ctx context.Context, clusterID string, req dto.CreateServerBlockRequest) (string, error) {
 	blockID := uuid.New().String()
 	block := &entities.NginxServerBlock{
 		ID:         blockID,
@@ -982,10 +1028,11 @@ func (s *nginxClusterService) createServerBlock(ctx context.Context, clusterID s
 		ServerName: req.ServerName,
 		ListenPort: req.ListenPort,
 		SSLEnabled: req.SSLEnabled,
+		SSLCertID:  req.SSLCertID,
 		RootPath:   req.RootPath,
 	}
 	if err := s.clusterRepo.CreateServerBlock(block); err != nil {
-		return err
+		return "", err
 	}
 
 	for _, loc := range req.Locations {
@@ -993,6 +1040,7 @@ func (s *nginxClusterService) createServerBlock(ctx context.Context, clusterID s
 		location := &entities.NginxLocation{
 			ID:            uuid.New().String(),
 			ServerBlockID: blockID,
+			Modifier:      loc.Modifier,
 			Path:          loc.Path,
 			ProxyPass:     loc.ProxyPass,
 			ProxyHeaders:  string(headers),
@@ -1001,20 +1049,34 @@ func (s *nginxClusterService) createServerBlock(ctx context.Context, clusterID s
 		}
 		s.clusterRepo.CreateLocation(location)
 	}
-	return nil
+	return blockID, nil
 }
 
-// AddUpstream adds an upstream to the cluster
-func (s *nginxClusterService) AddUpstream(ctx context.Context, clusterID string, req dto.AddNginxUpstreamRequest) error {
-	return s.createUpstream(ctx, clusterID, dto.CreateUpstreamRequest(req))
+// AddUpstream adds an upstream to the cluster; it is removed again when the resulting config is rejected
+func (s *nginxClusterService) AddUpstream(ctx context.Context, userID, clusterID string, req dto.AddNginxUpstreamRequest) error {
+	upstreamID, err := s.createUpstream(ctx, clusterID, dto.CreateUpstreamRequest(req))
+	if err != nil {
+		return err
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "add upstream "+req.Name); err != nil {
+		s.clusterRepo.DeleteUpstreamServersByUpstreamID(upstreamID)
+		s.clusterRepo.DeleteUpstream(upstreamID)
+		return err
+	}
+	return nil
 }
 
 // UpdateUpstream updates an upstream
-func (s *nginxClusterService) UpdateUpstream(ctx context.Context, clusterID, upstreamID string, req dto.UpdateNginxUpstreamRequest) error {
+func (s *nginxClusterService) UpdateUpstream(ctx context.Context, userID, clusterID, upstreamID string, req dto.UpdateNginxUpstreamRequest) error {
 	upstream, err := s.clusterRepo.FindUpstreamByID(upstreamID)
 	if err != nil {
 		return fmt.Errorf("upstream not found: %w", err)
 	}
+	for _, srv := range req.Servers {
+		if err := nginxServerAddress("upstream server", srv.Address); err != nil {
+			return err
+		}
+	}
 
 	if req.Algorithm != "" {
 		upstream.Algorithm = req.Algorithm
@@ -1023,6 +1085,9 @@ func (s *nginxClusterService) UpdateUpstream(ctx context.Context, clusterID, ups
 	if req.HealthPath != "" {
 		upstream.HealthPath = req.HealthPath
 	}
+	if req.Version != "" {
+		upstream.Version = req.Version
+	}
 	s.clusterRepo.UpdateUpstream(upstream)
 
 	// Update servers
@@ -1041,13 +1106,106 @@ func (s *nginxClusterService) UpdateUpstream(ctx context.Context, clusterID, ups
 			s.clusterRepo.CreateUpstreamServer(server)
 		}
 	}
-	return nil
+	return s.regenerateConfig(ctx, clusterID, userID, "update upstream "+upstream.Name)
 }
 
 // DeleteUpstream deletes an upstream
-func (s *nginxClusterService) DeleteUpstream(ctx context.Context, clusterID, upstreamID string) error {
+func (s *nginxClusterService) DeleteUpstream(ctx context.Context, userID, clusterID, upstreamID string) error {
+	upstream, err := s.clusterRepo.FindUpstreamByID(upstreamID)
+	if err != nil || upstream.ClusterID != clusterID {
+		return fmt.Errorf("upstream not found")
+	}
+	// Deleting a referenced upstream would leave the cluster with a config that no longer renders
+	refs, err := s.upstreamReferences(clusterID, upstream.Name)
+	if err != nil {
+		return err
+	}
+	if len(refs) > 0 {
+		return fmt.Errorf("upstream %s is still referenced by %s", upstream.Name, strings.Join(refs, ", "))
+	}
+
 	s.clusterRepo.DeleteUpstreamServersByUpstreamID(upstreamID)
-	return s.clusterRepo.DeleteUpstream(upstreamID)
+	if err := s.clusterRepo.DeleteUpstream(upstreamID); err != nil {
+		return err
+	}
+	return s.regenerateConfig(ctx, clusterID, userID, "delete upstream "+upstreamID)
+}
+
+// clusterUpstreamNames maps the upstreams of a cluster to whether they have any servers
+func (s *nginxClusterService) clusterUpstreamNames(clusterID string) (map[string]bool, error) {
+	upstreams, err := s.clusterRepo.ListUpstreams(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upstreams: %w", err)
+	}
+	upstreamNames := make(map[string]bool, len(upstreams))
+	for _, upstream := range upstreams {
+		servers, err := s.clusterRepo.ListUpstreamServers(upstream.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list servers of upstream %s: %w", upstream.Name, err)
+		}
+		upstreamNames[upstream.Name] = len(servers) > 0
+	}
+	return upstreamNames, nil
+}
+
+// upstreamReferences lists the locations and access policies of a cluster that proxy to an upstream
+func (s *nginxClusterService) upstreamReferences(clusterID, name string) ([]string, error) {
+	var refs []string
+	blocks, err := s.clusterRepo.ListServerBlocks(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list server blocks: %w", err)
+	}
+	for _, block := range blocks {
+		locations, err := s.clusterRepo.ListLocations(block.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list locations: %w", err)
+		}
+		for _, loc := range locations {
+			if proxyTargetsUpstream(loc.ProxyPass, name) || (loc.TrafficMode != "" && loc.SecondaryUpstream == name) {
+				refs = append(refs, fmt.Sprintf("location %s of %s", loc.Path, block.ServerName))
+			}
+		}
+	}
+
+	policies, err := s.clusterRepo.ListAccessPolicies(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access policies: %w", err)
+	}
+	for _, policy := range policies {
+		if proxyTargetsUpstream(policy.AuthRequestURL, name) {
+			refs = append(refs, "access policy "+policy.ID)
+		}
+	}
+	return refs, nil
+}
+
+// proxyTargetsUpstream reports whether a proxy target names an upstream directly or as the host of a URL
+func proxyTargetsUpstream(target, name string) bool {
+	if target == "" {
+		return false
+	}
+	if target == name {
+		return true
+	}
+	parsed, err := url.Parse(target)
+	return err == nil && parsed.Host == name
+}
+
+// lockConfig takes the config lock of a cluster and returns its unlock function
+func (s *nginxClusterService) lockConfig(clusterID string) func() {
+	s.configMu.Lock()
+	if s.configLocks == nil {
+		s.configLocks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := s.configLocks[clusterID]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.configLocks[clusterID] = lock
+	}
+	s.configMu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
 }
 
 // ListUpstreams lists all upstreams
@@ -1062,29 +1220,86 @@ func (s *nginxClusterService) ListUpstreams(ctx context.Context, clusterID strin
 		servers, _ := s.clusterRepo.ListUpstreamServers(u.ID)
 		backends := make([]dto.BackendServer, 0, len(servers))
 		for _, srv := range servers {
-			backends = append(backends, dto.BackendServer{
-				Address: srv.Address,
-				Weight:  srv.Weight,
+			backend := dto.BackendServer{
+				Address:      srv.Address,
+				Weight:       srv.Weight,
+				MaxFails:     srv.MaxFails,
+				FailTimeout:  fmt.Sprintf("%ds", srv.FailTimeout),
+				IsBackup:     srv.IsBackup,
+				IsDown:       srv.IsDown,
+				HealthStatus: srv.HealthStatus,
+				LastError:    srv.LastError,
+			}
+			if srv.LastCheckedAt != nil {
+				backend.LastCheckedAt = srv.LastCheckedAt.Format(time.RFC3339)
+			}
+			backends = append(backends, backend)
+		}
+
+		events, _ := s.clusterRepo.ListUpstreamHealthEvents(u.ID, upstreamHealthHistoryLimit)
+		history := make([]dto.UpstreamHealthEventInfo, 0, len(events))
+		for _, event := range events {
+			history = append(history, dto.UpstreamHealthEventInfo{
+				Address:    event.Address,
+				Status:     event.Status,
+				Reason:     event.Reason,
+				OccurredAt: event.OccurredAt.Format(time.RFC3339),
 			})
 		}
+
 		result = append(result, dto.UpstreamInfo{
-			Name:     u.Name,
-			Backends: backends,
-			Policy:   u.Algorithm,
+			ID:            u.ID,
+			Name:          u.Name,
+			Backends:      backends,
+			Policy:        u.Algorithm,
+			HealthCheck:   u.HealthCheck,
+			HealthPath:    u.HealthPath,
+			Version:       u.Version,
+			HealthHistory: history,
 		})
 	}
 	return result, nil
 }
 
-// AddServerBlock adds a server block
-func (s *nginxClusterService) AddServerBlock(ctx context.Context, clusterID string, req dto.AddNginxServerBlockRequest) error {
-	return s.createServerBlock(ctx, clusterID, dto.CreateServerBlockRequest(req))
+// AddServerBlock adds a server block; it is removed again when the resulting config is rejected
+func (s *nginxClusterService) AddServerBlock(ctx context.Context, userID, clusterID string, req dto.AddNginxServerBlockRequest) error {
+	if err := s.checkServerBlockPort(clusterID, req.ListenPort, req.SSLEnabled); err != nil {
+		return err
+	}
+	blockID, err := s.createServerBlock(ctx, clusterID, dto.CreateServerBlockRequest(req))
+	if err != nil {
+		return err
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "add server block "+req.ServerName); err != nil {
+		s.clusterRepo.DeleteLocationsByServerBlockID(blockID)
+		s.clusterRepo.DeleteServerBlock(blockID)
+		return err
+	}
+	return nil
 }
 
 // DeleteServerBlock deletes a server block
-func (s *nginxClusterService) DeleteServerBlock(ctx context.Context, clusterID, blockID string) error {
+func (s *nginxClusterService) DeleteServerBlock(ctx context.Context, userID, clusterID, blockID string) error {
 	s.clusterRepo.DeleteLocationsByServerBlockID(blockID)
-	return s.clusterRepo.DeleteServerBlock(blockID)
+	if err := s.clusterRepo.DeleteServerBlock(blockID); err != nil {
+		return err
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "delete server block "+blockID); err != nil {
+		return err
+	}
+	s.deleteAccessPolicies(ctx, clusterID, func(policy entities.NginxAccessPolicy) bool {
+		return policy.ServerBlockID == blockID
+	})
+	return nil
+}
+
+// regenerateConfig re-renders and applies nginx.conf after upstreams, server blocks or locations changed
+func (s *nginxClusterService) regenerateConfig(ctx context.Context, clusterID, author, reason string) error {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return fmt.Errorf("cluster not found: %w", err)
+	}
+	return s.generateAndApplyConfig(ctx, cluster, author, reason)
 }
 
 // ListServerBlocks lists all server blocks
@@ -1103,6 +1318,7 @@ func (s *nginxClusterService) ListServerBlocks(ctx context.Context, clusterID st
 			json.Unmarshal([]byte(loc.ProxyHeaders), &headers)
 			locInfos = append(locInfos, dto.LocationInfo{
 				ID:           loc.ID,
+				Modifier:     loc.Modifier,
 				Path:         loc.Path,
 				ProxyPass:    loc.ProxyPass,
 				ProxyHeaders: headers,
@@ -1148,7 +1364,7 @@ func (s *nginxClusterService) GetClusterHealth(ctx context.Context, clusterID st
 			Role:             node.Role,
 			IsHealthy:        healthy,
 			NginxStatus:      node.Status,
-			KeepalivedStatus: "running",
+			KeepalivedStatus: keepalivedStatus(s.vrrpState(ctx, &node)),
 			LastCheck:        time.Now().Format(time.RFC3339),
 		})
 	}
@@ -1186,44 +1402,8 @@ func (s *nginxClusterService) checkNodeHealth(ctx context.Context, node *entitie
 	return info.State.Running
 }
 
-// GetClusterMetrics returns cluster metrics
-func (s *nginxClusterService) GetClusterMetrics(ctx context.Context, clusterID string) (*dto.NginxClusterMetricsResponse, error) {
-	nodes, err := s.clusterRepo.ListNodes(clusterID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list nodes: %w", err)
-	}
-
-	nodeMetrics := make([]dto.NginxNodeMetrics, 0, len(nodes))
-	var totalRequests int64
-	var totalActiveConns int
-
-	for _, node := range nodes {
-		// Get nginx stub_status metrics
-		metrics := s.getNginxMetrics(ctx, &node)
-		nodeMetrics = append(nodeMetrics, metrics)
-		totalRequests += metrics.TotalRequests
-		totalActiveConns += metrics.ActiveConns
-	}
-
-	return &dto.NginxClusterMetricsResponse{
-		ClusterID:     clusterID,
-		TotalRequests: totalRequests,
-		ActiveConns:   totalActiveConns,
-		NodeMetrics:   nodeMetrics,
-	}, nil
-}
-
-// getNginxMetrics gets metrics from a single node
-func (s *nginxClusterService) getNginxMetrics(ctx context.Context, node *entities.NginxNode) dto.NginxNodeMetrics {
-	return dto.NginxNodeMetrics{
-		NodeID:      node.ID,
-		NodeName:    node.Name,
-		Role:        node.Role,
-		ActiveConns: 0,
-	}
-}
-
-// TriggerFailover manually triggers failover to a specified node
+// TriggerFailover moves the master role to the target node by raising its keepalived priority
+// above every other node and reloading keepalived, then waits for VRRP to elect it
 func (s *nginxClusterService) TriggerFailover(ctx context.Context, clusterID string, req dto.TriggerNginxFailoverRequest) (*dto.NginxFailoverResponse, error) {
 	cluster, err := s.clusterRepo.FindByID(clusterID)
 	if err != nil {
@@ -1231,24 +1411,75 @@ func (s *nginxClusterService) TriggerFailover(ctx context.Context, clusterID str
 	}
 
 	targetNode, err := s.clusterRepo.FindNodeByID(req.TargetNodeID)
-	if err != nil {
-		return nil, fmt.Errorf("target node not found: %w", err)
+	if err != nil || targetNode.ClusterID != clusterID {
+		return nil, fmt.Errorf("target node not found")
+	}
+	if targetNode.ID == cluster.MasterNodeID {
+		return nil, fmt.Errorf("node %s is already the master", targetNode.Name)
+	}
+	if !s.checkNodeHealth(ctx, targetNode) {
+		return nil, fmt.Errorf("target node %s is not running", targetNode.Name)
 	}
 
-	oldMaster, _ := s.clusterRepo.FindNodeByID(cluster.MasterNodeID)
+	s.vrrpMu.Lock()
+	defer s.vrrpMu.Unlock()
+
+	var oldMaster *entities.NginxNode
+	if cluster.MasterNodeID != "" {
+		if node, err := s.clusterRepo.FindNodeByID(cluster.MasterNodeID); err == nil {
+			oldMaster = node
+		}
+	}
 
 	start := time.Now()
 
-	// Demote old master
+	// The target must outrank every node, including backups added with a custom priority
+	targetPriority := vrrpMasterPriority
+	nodes, _ := s.clusterRepo.ListNodes(clusterID)
+	for _, node := range nodes {
+		if node.ID != targetNode.ID && (oldMaster == nil || node.ID != oldMaster.ID) && node.Priority >= targetPriority {
+			targetPriority = node.Priority + 1
+		}
+	}
+	if targetPriority > vrrpMaxPriority {
+		return nil, fmt.Errorf("cannot give %s a priority above the other nodes", targetNode.Name)
+	}
+
+	previousTarget := *targetNode
+	targetNode.Role = "master"
+	targetNode.Priority = targetPriority
+	var previousOld entities.NginxNode
 	if oldMaster != nil {
+		previousOld = *oldMaster
 		oldMaster.Role = "backup"
-		oldMaster.Priority = 50
-		s.clusterRepo.UpdateNode(oldMaster)
+		oldMaster.Priority = vrrpDemotedPriority
 	}
 
-	// Promote new master
-	targetNode.Role = "master"
-	targetNode.Priority = 100
+	// Clusters created before keepalived was deployed only have the role recorded
+	if s.vrrpState(ctx, targetNode) != "" {
+		if err := s.applyFailoverPriorities(ctx, cluster, targetNode, oldMaster); err == nil {
+			timeout := time.Duration(cluster.HealthCheckInterval*3+10) * time.Second
+			err = s.waitForVRRPMaster(ctx, targetNode, timeout)
+		}
+		if err != nil {
+			s.logger.Error("failover failed, restoring priorities", zap.String("cluster_id", clusterID), zap.Error(err))
+			var restoreOld *entities.NginxNode
+			if oldMaster != nil {
+				restoreOld = &previousOld
+			}
+			if restoreErr := s.applyFailoverPriorities(ctx, cluster, &previousTarget, restoreOld); restoreErr != nil {
+				s.logger.Error("failed to restore keepalived priorities", zap.String("cluster_id", clusterID), zap.Error(restoreErr))
+			}
+			return nil, fmt.Errorf("failover failed: %w", err)
+		}
+	} else {
+		s.logger.Warn("keepalived not running on target node, recording role change only",
+			zap.String("cluster_id", clusterID), zap.String("node", targetNode.Name))
+	}
+
+	if oldMaster != nil {
+		s.clusterRepo.UpdateNode(oldMaster)
+	}
 	s.clusterRepo.UpdateNode(targetNode)
 
 	cluster.MasterNodeID = targetNode.ID
@@ -1258,13 +1489,15 @@ func (s *nginxClusterService) TriggerFailover(ctx context.Context, clusterID str
 	event := &entities.NginxFailoverEvent{
 		ID:            uuid.New().String(),
 		ClusterID:     clusterID,
-		OldMasterID:   oldMaster.ID,
-		OldMasterName: oldMaster.Name,
 		NewMasterID:   targetNode.ID,
 		NewMasterName: targetNode.Name,
 		Reason:        req.Reason,
 		TriggeredBy:   "user",
 	}
+	if oldMaster != nil {
+		event.OldMasterID = oldMaster.ID
+		event.OldMasterName = oldMaster.Name
+	}
 	s.clusterRepo.CreateFailoverEvent(event)
 
 	duration := time.Since(start)
@@ -1272,14 +1505,26 @@ func (s *nginxClusterService) TriggerFailover(ctx context.Context, clusterID str
 	return &dto.NginxFailoverResponse{
 		Success:       true,
 		Message:       "Failover completed successfully",
-		OldMasterID:   oldMaster.ID,
-		OldMasterName: oldMaster.Name,
+		OldMasterID:   event.OldMasterID,
+		OldMasterName: event.OldMasterName,
 		NewMasterID:   targetNode.ID,
 		NewMasterName: targetNode.Name,
 		Duration:      duration.String(),
 	}, nil
 }
 
+// applyFailoverPriorities pushes keepalived configs with the given priorities. The target goes
+// first so it preempts the master directly instead of letting another backup win in between.
+func (s *nginxClusterService) applyFailoverPriorities(ctx context.Context, cluster *entities.NginxCluster, target, oldMaster *entities.NginxNode) error {
+	if err := s.pushKeepalivedConfig(ctx, cluster, target); err != nil {
+		return err
+	}
+	if oldMaster != nil && s.checkNodeHealth(ctx, oldMaster) {
+		return s.pushKeepalivedConfig(ctx, cluster, oldMaster)
+	}
+	return nil
+}
+
 // GetFailoverHistory returns failover history
 func (s *nginxClusterService) GetFailoverHistory(ctx context.Context, clusterID string) (*dto.NginxFailoverHistoryResponse, error) {
 	events, err := s.clusterRepo.ListFailoverEvents(clusterID)
@@ -0,0 +1,997 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+const (
+	nginxSSLDir           = "/etc/nginx/ssl"
+	nginxDefaultCertName  = "default"
+	nginxACMEWebroot      = "/var/www/acme"
+	nginxACMEChallengeDir = "/.well-known/acme-challenge/"
+	nginxDefaultCachePath = "/var/cache/nginx/proxy"
+	nginxDefaultCacheSize = "1g"
+	nginxHtpasswdDir      = "/etc/nginx/htpasswd"
+	nginxAuthRequestPath  = "/_auth_request/"
+
+	trafficModeSplit     = "split"
+	trafficModeBlueGreen = "blue_green"
+)
+
+// nginxConfigData is the input of nginxConfigTemplate
+type nginxConfigData struct {
+	Cluster         *entities.NginxCluster
+	WorkerProcesses string
+	CacheZone       bool
+	CachePath       string
+	CacheSize       string
+	RateZones       []nginxRateZone
+	TrafficSplits   []nginxTrafficSplit
+	TrafficMaps     []nginxTrafficMap
+	Upstreams       []nginxUpstreamView
+	ServerBlocks    []nginxServerView
+	Streams         []nginxStreamView
+}
+
+type nginxRateZone struct {
+	Name string
+	Rate int
+}
+
+// nginxTrafficSplit sends Percent of the requests of a location to Target, keyed by Key
+type nginxTrafficSplit struct {
+	Key      string
+	Variable string
+	Percent  int
+	Target   string
+	Default  string
+}
+
+// nginxTrafficMap overrides the upstream chosen for a location when Source matches Value,
+// or when Source is set at all if Value is empty
+type nginxTrafficMap struct {
+	Source   string
+	Variable string
+	Value    string
+	Target   string
+	Default  string
+}
+
+type nginxUpstreamView struct {
+	Name      string
+	Algorithm string
+	Servers   []entities.NginxUpstreamServer
+}
+
+type nginxServerView struct {
+	ServerName string
+	Listen     int
+	SSL        bool
+	ACME       bool // serve HTTP-01 challenges, plain HTTP blocks only
+	CertFile   string
+	KeyFile    string
+	Root       string
+	Index      string
+	Access     []string // access control directives of the whole block
+	Locations  []nginxLocationView
+	AuthChecks []nginxAuthCheck
+}
+
+// nginxAccess is an access policy rendered for a server block or location
+type nginxAccess struct {
+	Directives []string
+	AuthCheck  *nginxAuthCheck
+	Headers    []nginxHeader // auth response headers passed on to the backend
+}
+
+// nginxAuthCheck is the internal location auth_request sends its subrequests to
+type nginxAuthCheck struct {
+	Path      string
+	ProxyPass string
+}
+
+type nginxStreamView struct {
+	Name           string
+	UDP            bool
+	ListenPort     int
+	Algorithm      string
+	ConnectTimeout int
+	Timeout        int
+	Servers        []entities.NginxStreamServer
+	SSL            bool
+	CertFile       string
+	KeyFile        string
+}
+
+type nginxLocationView struct {
+	Modifier  string
+	Path      string
+	Access    []string
+	ProxyPass string
+	Headers   []nginxHeader
+	Cache     bool
+	RateZone  string
+	Burst     int
+}
+
+type nginxHeader struct {
+	Name  string
+	Value string
+}
+
+var nginxConfigTemplate = template.Must(template.New("nginx.conf").Parse(`# Nginx Configuration - Generated by IaaS Platform
+# Cluster: {{.Cluster.ClusterName}}
+
+worker_processes {{.WorkerProcesses}};
+error_log /var/log/nginx/error.log {{.Cluster.ErrorLogLevel}};
+pid /var/run/nginx.pid;
+
+events {
+    worker_connections {{.Cluster.WorkerConnections}};
+    use epoll;
+    multi_accept on;
+}
+
+http {
+    include /etc/nginx/mime.types;
+    default_type application/octet-stream;
+
+    # Logging Configuration
+    log_format main '$remote_addr - $remote_user [$time_local] "$request" '
+                    '$status $body_bytes_sent "$http_referer" '
+                    '"$http_user_agent" "$http_x_forwarded_for" '
+                    'rt=$request_time uct="$upstream_connect_time" '
+                    'uht="$upstream_header_time" urt="$upstream_response_time"';
+{{- if .Cluster.AccessLogEnabled}}
+    access_log /var/log/nginx/access.log main;
+{{- else}}
+    access_log off;
+{{- end}}
+
+    # Performance Settings
+    sendfile on;
+    tcp_nopush on;
+    tcp_nodelay on;
+    keepalive_timeout {{.Cluster.KeepaliveTimeout}};
+    types_hash_max_size 2048;
+    server_tokens off;
+    client_max_body_size {{.Cluster.ClientMaxBodySize}};
+{{if .Cluster.GzipEnabled}}
+    # Gzip Compression
+    gzip on;
+    gzip_vary on;
+    gzip_proxied any;
+    gzip_comp_level {{.Cluster.GzipLevel}};
+    gzip_min_length {{.Cluster.GzipMinLength}};
+    gzip_types {{.Cluster.GzipTypes}};
+{{end}}
+{{- if or .Cluster.RateLimitEnabled .RateZones}}
+    # Rate Limiting
+{{- if .Cluster.RateLimitEnabled}}
+    limit_req_zone $binary_remote_addr zone=api_limit:10m rate={{.Cluster.RateLimitRequestsPerSec}}r/s;
+{{- end}}
+{{- range .RateZones}}
+    limit_req_zone $binary_remote_addr zone={{.Name}}:10m rate={{.Rate}}r/s;
+{{- end}}
+{{end}}
+{{- if or .TrafficSplits .TrafficMaps}}
+    # Traffic Policies
+{{- range .TrafficSplits}}
+    split_clients "{{.Key}}" ${{.Variable}} {
+        {{.Percent}}% {{.Target}};
+        * {{.Default}};
+    }
+{{- end}}
+{{- range .TrafficMaps}}
+    map {{.Source}} ${{.Variable}} {
+{{- if .Value}}
+        "{{.Value}}" {{.Target}};
+        default {{.Default}};
+{{- else}}
+        "" {{.Default}};
+        default {{.Target}};
+{{- end}}
+    }
+{{- end}}
+{{end}}
+{{- if .CacheZone}}
+    # Proxy Cache
+    proxy_cache_path {{.CachePath}} levels=1:2 keys_zone=nginx_cache:10m max_size={{.CacheSize}} inactive=60m use_temp_path=off;
+{{end}}
+{{- if .Cluster.SSLEnabled}}
+    # SSL Settings
+    ssl_protocols {{.Cluster.SSLProtocols}};
+    ssl_prefer_server_ciphers on;
+    ssl_session_cache shared:SSL:10m;
+    ssl_session_timeout {{.Cluster.SSLSessionTimeout}};
+    ssl_session_tickets off;
+{{end}}
+    # Proxy Settings
+    proxy_http_version 1.1;
+    proxy_set_header Host $host;
+    proxy_set_header X-Real-IP $remote_addr;
+    proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+    proxy_set_header X-Forwarded-Proto $scheme;
+    proxy_set_header Connection "";
+    proxy_connect_timeout 60s;
+    proxy_send_timeout 60s;
+    proxy_read_timeout 60s;
+    proxy_buffering on;
+    proxy_buffer_size 4k;
+    proxy_buffers 8 4k;
+{{range .Upstreams}}
+    upstream {{.Name}} {
+{{- if eq .Algorithm "least_conn"}}
+        least_conn;
+{{- else if eq .Algorithm "ip_hash"}}
+        ip_hash;
+{{- end}}
+{{- range .Servers}}
+        server {{.Address}} weight={{.Weight}} max_fails={{.MaxFails}} fail_timeout={{.FailTimeout}}s{{if .IsBackup}} backup{{end}}{{if .IsDown}} down{{end}};
+{{- end}}
+        keepalive 32;
+    }
+{{end}}
+    # Default Server
+    server {
+        listen 80 default_server;
+        server_name _;
+
+        # ACME HTTP-01 challenges for certificates issued through the cluster
+        location ^~ /.well-known/acme-challenge/ {
+            root /var/www/acme;
+            default_type text/plain;
+        }
+
+        # Health check endpoint
+        location /health {
+            access_log off;
+            return 200 "{\"status\":\"healthy\",\"cluster\":\"{{.Cluster.ClusterName}}\"}";
+            add_header Content-Type application/json;
+        }
+
+        # Nginx status for monitoring
+        location /nginx_status {
+            stub_status on;
+            access_log off;
+            allow 127.0.0.1;
+            allow 10.0.0.0/8;
+            allow 172.16.0.0/12;
+            allow 192.168.0.0/16;
+            deny all;
+        }
+
+        # Root
+        location / {
+            root /usr/share/nginx/html;
+            index index.html index.htm;
+            try_files $uri $uri/ =404;
+        }
+{{- if .Cluster.RateLimitEnabled}}
+
+        # Apply rate limiting
+        limit_req zone=api_limit burst={{.Cluster.RateLimitBurst}} nodelay;
+{{- end}}
+    }
+{{range .ServerBlocks}}
+    server {
+        listen {{.Listen}}{{if .SSL}} ssl{{end}};
+        server_name {{.ServerName}};
+{{- if .SSL}}
+        ssl_certificate {{.CertFile}};
+        ssl_certificate_key {{.KeyFile}};
+{{- end}}
+{{- if .Root}}
+        root {{.Root}};
+        index {{.Index}};
+{{- end}}
+{{- range .Access}}
+        {{.}}
+{{- end}}
+{{- if .ACME}}
+
+        location ^~ /.well-known/acme-challenge/ {
+            root /var/www/acme;
+            default_type text/plain;
+{{- if .Access}}
+            satisfy any;
+            allow all;
+{{- end}}
+        }
+{{- end}}
+{{- range .Locations}}
+
+        location {{if .Modifier}}{{.Modifier}} {{end}}{{.Path}} {
+{{- range .Access}}
+            {{.}}
+{{- end}}
+{{- if .ProxyPass}}
+            proxy_pass {{.ProxyPass}};
+{{- if .Headers}}
+            # proxy_set_header here replaces the inherited http-level headers
+            proxy_set_header Host $host;
+            proxy_set_header X-Real-IP $remote_addr;
+            proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+            proxy_set_header X-Forwarded-Proto $scheme;
+            proxy_set_header Connection "";
+{{- end}}
+{{- range .Headers}}
+            proxy_set_header {{.Name}} "{{.Value}}";
+{{- end}}
+{{- if .Cache}}
+            proxy_cache nginx_cache;
+            proxy_cache_valid 200 302 10m;
+            proxy_cache_valid 404 1m;
+            add_header X-Cache-Status $upstream_cache_status;
+{{- end}}
+{{- else}}
+            try_files $uri $uri/ =404;
+{{- end}}
+{{- if .RateZone}}
+            limit_req zone={{.RateZone}} burst={{.Burst}} nodelay;
+{{- end}}
+        }
+{{- end}}
+{{- range .AuthChecks}}
+
+        location = {{.Path}} {
+            internal;
+            proxy_pass {{.ProxyPass}};
+            proxy_pass_request_body off;
+            proxy_set_header Content-Length "";
+            proxy_set_header X-Original-URI $request_uri;
+            proxy_set_header X-Original-Method $request_method;
+            proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        }
+{{- end}}
+    }
+{{end -}}
+}
+{{- if .Streams}}
+
+stream {
+{{- range .Streams}}
+
+    upstream {{.Name}} {
+{{- if eq .Algorithm "least_conn"}}
+        least_conn;
+{{- else if eq .Algorithm "hash"}}
+        hash $remote_addr consistent;
+{{- end}}
+{{- range .Servers}}
+        server {{.Address}} weight={{.Weight}} max_fails={{.MaxFails}} fail_timeout={{.FailTimeout}}s{{if .IsBackup}} backup{{end}};
+{{- end}}
+    }
+
+    server {
+        listen {{.ListenPort}}{{if .UDP}} udp{{end}}{{if .SSL}} ssl{{end}};
+        proxy_pass {{.Name}};
+        proxy_connect_timeout {{.ConnectTimeout}}s;
+        proxy_timeout {{.Timeout}}s;
+{{- if .SSL}}
+        ssl_certificate {{.CertFile}};
+        ssl_certificate_key {{.KeyFile}};
+        ssl_protocols {{$.Cluster.SSLProtocols}};
+        ssl_session_cache shared:STREAM_SSL:10m;
+{{- end}}
+    }
+{{- end}}
+}
+{{- end}}
+`))
+
+// generateNginxConfig renders nginx.conf from the cluster settings and its upstreams, server blocks and locations
+func (s *nginxClusterService) generateNginxConfig(cluster *entities.NginxCluster) (string, error) {
+	data := nginxConfigData{
+		Cluster:         cluster,
+		WorkerProcesses: "auto",
+		CacheZone:       cluster.CacheEnabled && cluster.CachePath != "",
+		CachePath:       cluster.CachePath,
+		CacheSize:       cluster.CacheSize,
+	}
+	if cluster.WorkerProcesses > 0 {
+		data.WorkerProcesses = fmt.Sprintf("%d", cluster.WorkerProcesses)
+	}
+
+	upstreams, err := s.clusterRepo.ListUpstreams(cluster.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list upstreams: %w", err)
+	}
+	// upstreamNames maps every upstream of the cluster to whether it has servers, so that
+	// references to an empty upstream fail with a clear error instead of an unknown host
+	upstreamNames := make(map[string]bool, len(upstreams))
+	for _, upstream := range upstreams {
+		view, err := s.upstreamView(upstream)
+		if err != nil {
+			return "", err
+		}
+		// nginx rejects an upstream block without servers
+		if len(view.Servers) == 0 {
+			upstreamNames[view.Name] = false
+			continue
+		}
+		data.Upstreams = append(data.Upstreams, *view)
+		upstreamNames[view.Name] = true
+	}
+
+	policies, err := s.clusterRepo.ListAccessPolicies(cluster.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list access policies: %w", err)
+	}
+	policyByScope := make(map[string]*entities.NginxAccessPolicy, len(policies))
+	for i := range policies {
+		policyByScope[accessScope(policies[i].ServerBlockID, policies[i].LocationID)] = &policies[i]
+	}
+
+	blocks, err := s.clusterRepo.ListServerBlocks(cluster.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list server blocks: %w", err)
+	}
+	for _, block := range blocks {
+		view, err := s.serverBlockView(cluster, block, upstreamNames, policyByScope, &data)
+		if err != nil {
+			return "", err
+		}
+		data.ServerBlocks = append(data.ServerBlocks, *view)
+	}
+
+	streams, err := s.clusterRepo.ListStreamProxies(cluster.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list stream proxies: %w", err)
+	}
+	for _, stream := range streams {
+		view, err := s.streamView(cluster, stream)
+		if err != nil {
+			return "", err
+		}
+		data.Streams = append(data.Streams, *view)
+	}
+
+	var buf bytes.Buffer
+	if err := nginxConfigTemplate.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render nginx config: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func (s *nginxClusterService) upstreamView(upstream entities.NginxClusterUpstream) (*nginxUpstreamView, error) {
+	if err := nginxSafeValue("upstream name", upstream.Name); err != nil {
+		return nil, err
+	}
+	servers, err := s.clusterRepo.ListUpstreamServers(upstream.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers of upstream %s: %w", upstream.Name, err)
+	}
+
+	view := &nginxUpstreamView{Name: upstream.Name, Algorithm: upstream.Algorithm}
+	for _, server := range servers {
+		if err := nginxServerAddress("upstream server", server.Address); err != nil {
+			return nil, err
+		}
+		if server.IsBackup && upstream.Algorithm == "ip_hash" {
+			return nil, fmt.Errorf("upstream %s: backup servers cannot be used with ip_hash", upstream.Name)
+		}
+		if server.Weight <= 0 {
+			server.Weight = 1
+		}
+		if server.MaxFails < 0 {
+			server.MaxFails = 0
+		}
+		if server.FailTimeout <= 0 {
+			server.FailTimeout = 10
+		}
+		view.Servers = append(view.Servers, server)
+	}
+	return view, nil
+}
+
+func (s *nginxClusterService) serverBlockView(cluster *entities.NginxCluster, block entities.NginxServerBlock, upstreamNames map[string]bool, policies map[string]*entities.NginxAccessPolicy, data *nginxConfigData) (*nginxServerView, error) {
+	if err := nginxSafeValue("server_name", block.ServerName); err != nil {
+		return nil, err
+	}
+	if err := nginxSafeValue("root path", block.RootPath); err != nil {
+		return nil, err
+	}
+
+	view := &nginxServerView{
+		ServerName: block.ServerName,
+		Listen:     block.ListenPort,
+		SSL:        block.SSLEnabled,
+		Root:       block.RootPath,
+		Index:      block.IndexFiles,
+	}
+	if view.Index == "" {
+		view.Index = "index.html index.htm"
+	}
+	if view.SSL {
+		certFile, keyFile, err := s.certificateFiles(cluster, block.SSLCertID, "server block "+block.ServerName)
+		if err != nil {
+			return nil, err
+		}
+		view.CertFile, view.KeyFile = certFile, keyFile
+		if view.Listen == 0 {
+			view.Listen = 443
+		}
+	}
+	if view.Listen == 0 {
+		view.Listen = 80
+	}
+	view.ACME = !view.SSL
+
+	var blockAuthHeaders []nginxHeader
+	if policy := policies[accessScope(block.ID, "")]; policy != nil {
+		access, err := accessView(policy, upstreamNames)
+		if err != nil {
+			return nil, fmt.Errorf("server block %s: %w", block.ServerName, err)
+		}
+		view.Access = access.Directives
+		if access.AuthCheck != nil {
+			view.AuthChecks = append(view.AuthChecks, *access.AuthCheck)
+		}
+		blockAuthHeaders = access.Headers
+	}
+
+	locations, err := s.clusterRepo.ListLocations(block.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locations of %s: %w", block.ServerName, err)
+	}
+	for _, loc := range locations {
+		locView, err := locationView(cluster, loc, upstreamNames, data)
+		if err != nil {
+			return nil, fmt.Errorf("server block %s: %w", block.ServerName, err)
+		}
+
+		// auth_request_set variables come from whichever auth_request applies to the location
+		authHeaders := blockAuthHeaders
+		if policy := policies[accessScope(block.ID, loc.ID)]; policy != nil {
+			access, err := accessView(policy, upstreamNames)
+			if err != nil {
+				return nil, fmt.Errorf("server block %s: location %s: %w", block.ServerName, loc.Path, err)
+			}
+			locView.Access = access.Directives
+			if access.AuthCheck != nil {
+				view.AuthChecks = append(view.AuthChecks, *access.AuthCheck)
+				authHeaders = access.Headers
+			}
+		}
+		if locView.ProxyPass != "" {
+			locView.Headers = append(locView.Headers, authHeaders...)
+		}
+		view.Locations = append(view.Locations, *locView)
+	}
+	return view, nil
+}
+
+// accessScope keys access policies by server block and location, "" for the whole block
+func accessScope(serverBlockID, locationID string) string {
+	return serverBlockID + "/" + locationID
+}
+
+// accessView validates an access policy and renders it as allow/deny, auth_basic and auth_request directives
+func accessView(policy *entities.NginxAccessPolicy, upstreamNames map[string]bool) (*nginxAccess, error) {
+	var allow, deny, responseHeaders []string
+	for _, field := range []struct {
+		name  string
+		raw   string
+		value *[]string
+	}{
+		{"allow list", policy.AllowCIDRs, &allow},
+		{"deny list", policy.DenyCIDRs, &deny},
+		{"auth response headers", policy.AuthResponseHeaders, &responseHeaders},
+	} {
+		if field.raw == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(field.raw), field.value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", field.name, err)
+		}
+	}
+
+	if len(allow) == 0 && len(deny) == 0 && !policy.BasicAuthEnabled && policy.AuthRequestURL == "" {
+		return nil, fmt.Errorf("access policy has no rules")
+	}
+	for _, address := range append(append([]string{}, allow...), deny...) {
+		if net.ParseIP(address) == nil {
+			if _, _, err := net.ParseCIDR(address); err != nil {
+				return nil, fmt.Errorf("invalid address or CIDR %q", address)
+			}
+		}
+	}
+
+	access := &nginxAccess{}
+	switch policy.Satisfy {
+	case "", "all":
+	case "any":
+		access.Directives = append(access.Directives, "satisfy any;")
+	default:
+		return nil, fmt.Errorf("invalid satisfy %q (allowed: all, any)", policy.Satisfy)
+	}
+	// nginx stops at the first matching rule, so explicit denies win over broader allows
+	for _, address := range deny {
+		access.Directives = append(access.Directives, "deny "+address+";")
+	}
+	for _, address := range allow {
+		access.Directives = append(access.Directives, "allow "+address+";")
+	}
+	if len(allow) > 0 {
+		access.Directives = append(access.Directives, "deny all;")
+	}
+
+	if policy.BasicAuthEnabled {
+		realm := policy.BasicAuthRealm
+		if realm == "" {
+			realm = "Restricted"
+		}
+		if err := nginxSafeValue("basic auth realm", realm); err != nil {
+			return nil, err
+		}
+		if strings.ContainsAny(realm, "\"\\$") {
+			return nil, fmt.Errorf("invalid basic auth realm %q", realm)
+		}
+		access.Directives = append(access.Directives,
+			fmt.Sprintf("auth_basic \"%s\";", realm),
+			fmt.Sprintf("auth_basic_user_file %s/%s;", nginxHtpasswdDir, policy.ID))
+	}
+
+	if policy.AuthRequestURL != "" {
+		target, err := nginxProxyTarget(policy.AuthRequestURL, upstreamNames)
+		if err != nil {
+			return nil, fmt.Errorf("auth request: %w", err)
+		}
+		prefix := strings.ReplaceAll(policy.ID, "-", "")[:12]
+		access.AuthCheck = &nginxAuthCheck{Path: nginxAuthRequestPath + prefix, ProxyPass: target}
+		access.Directives = append(access.Directives, "auth_request "+access.AuthCheck.Path+";")
+		for i, header := range responseHeaders {
+			if !trafficHeaderPattern.MatchString(header) {
+				return nil, fmt.Errorf("invalid auth response header %q", header)
+			}
+			variable := fmt.Sprintf("$auth_%s_%d", prefix, i)
+			access.Directives = append(access.Directives, fmt.Sprintf("auth_request_set %s $upstream_http_%s;",
+				variable, strings.ToLower(strings.ReplaceAll(header, "-", "_"))))
+			access.Headers = append(access.Headers, nginxHeader{Name: header, Value: variable})
+		}
+	}
+	return access, nil
+}
+
+// certificateFiles resolves the certificate of a TLS server block or stream proxy to its files on
+// the nodes, the cluster default certificate when certID is empty
+func (s *nginxClusterService) certificateFiles(cluster *entities.NginxCluster, certID, owner string) (string, string, error) {
+	certName := certID
+	if certName != "" {
+		cert, err := s.clusterRepo.FindCertificateByID(certName)
+		if err != nil || cert.ClusterID != cluster.ID || cert.Status != certStatusActive {
+			return "", "", fmt.Errorf("%s uses certificate %s, which is not an active certificate of this cluster", owner, certName)
+		}
+	} else {
+		if cluster.DefaultCertID == "" && (cluster.SSLCertificate == "" || cluster.SSLPrivateKey == "") {
+			return "", "", fmt.Errorf("%s has TLS enabled but no certificate", owner)
+		}
+		certName = nginxDefaultCertName
+	}
+	return fmt.Sprintf("%s/%s.crt", nginxSSLDir, certName), fmt.Sprintf("%s/%s.key", nginxSSLDir, certName), nil
+}
+
+func (s *nginxClusterService) streamView(cluster *entities.NginxCluster, stream entities.NginxStreamProxy) (*nginxStreamView, error) {
+	if err := nginxSafeValue("stream name", stream.Name); err != nil {
+		return nil, err
+	}
+	servers, err := s.clusterRepo.ListStreamServers(stream.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers of stream %s: %w", stream.Name, err)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("stream %s has no servers", stream.Name)
+	}
+
+	view := &nginxStreamView{
+		Name:           stream.Name,
+		UDP:            stream.Protocol == streamProtocolUDP,
+		ListenPort:     stream.ListenPort,
+		Algorithm:      stream.Algorithm,
+		ConnectTimeout: stream.ConnectTimeout,
+		Timeout:        stream.Timeout,
+		SSL:            stream.TLSEnabled,
+	}
+	for _, server := range servers {
+		if err := nginxServerAddress("stream server", server.Address); err != nil {
+			return nil, err
+		}
+		if server.Weight <= 0 {
+			server.Weight = 1
+		}
+		if server.FailTimeout <= 0 {
+			server.FailTimeout = 10
+		}
+		view.Servers = append(view.Servers, server)
+	}
+	if view.ConnectTimeout <= 0 {
+		view.ConnectTimeout = defaultStreamConnectTimeout
+	}
+	if view.Timeout <= 0 {
+		view.Timeout = defaultStreamTimeout
+	}
+	if view.SSL {
+		certFile, keyFile, err := s.certificateFiles(cluster, stream.SSLCertID, "stream "+stream.Name)
+		if err != nil {
+			return nil, err
+		}
+		view.CertFile, view.KeyFile = certFile, keyFile
+	}
+	return view, nil
+}
+
+func locationView(cluster *entities.NginxCluster, loc entities.NginxLocation, upstreamNames map[string]bool, data *nginxConfigData) (*nginxLocationView, error) {
+	if err := validateLocationPath(loc.Modifier, loc.Path); err != nil {
+		return nil, err
+	}
+	view := &nginxLocationView{Modifier: loc.Modifier, Path: loc.Path}
+
+	if loc.ProxyPass != "" {
+		var target string
+		var err error
+		if loc.TrafficMode != "" {
+			target, err = trafficProxyPass(loc, upstreamNames, data)
+		} else {
+			target, err = nginxProxyTarget(loc.ProxyPass, upstreamNames)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("location %s: %w", loc.Path, err)
+		}
+		if err := validateRegexProxyPass(loc.Modifier, target); err != nil {
+			return nil, fmt.Errorf("location %s: %w", loc.Path, err)
+		}
+		view.ProxyPass = target
+
+		var headers map[string]string
+		if loc.ProxyHeaders != "" {
+			if err := json.Unmarshal([]byte(loc.ProxyHeaders), &headers); err != nil {
+				return nil, fmt.Errorf("location %s: invalid proxy headers: %w", loc.Path, err)
+			}
+		}
+		for name, value := range headers {
+			if err := nginxSafeValue("header name", name); err != nil {
+				return nil, err
+			}
+			if strings.ContainsAny(name, " \t\"") || strings.ContainsAny(value, "\"\\") {
+				return nil, fmt.Errorf("location %s: invalid proxy header %q", loc.Path, name)
+			}
+			if err := nginxSafeValue("header value", value); err != nil {
+				return nil, err
+			}
+			view.Headers = append(view.Headers, nginxHeader{Name: name, Value: value})
+		}
+		sort.Slice(view.Headers, func(i, j int) bool { return view.Headers[i].Name < view.Headers[j].Name })
+
+		if loc.CacheEnabled {
+			view.Cache = true
+			if !data.CacheZone {
+				data.CacheZone = true
+				data.CachePath = nginxDefaultCachePath
+				data.CacheSize = nginxDefaultCacheSize
+			}
+		}
+	}
+
+	if loc.RateLimit > 0 {
+		view.RateZone = "loc_" + strings.ReplaceAll(loc.ID, "-", "")[:12]
+		view.Burst = cluster.RateLimitBurst
+		if view.Burst <= 0 {
+			view.Burst = loc.RateLimit
+		}
+		data.RateZones = append(data.RateZones, nginxRateZone{Name: view.RateZone, Rate: loc.RateLimit})
+	}
+	return view, nil
+}
+
+var (
+	trafficHeaderPattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	trafficCookiePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// validateTrafficPolicy checks the traffic policy of a location against the upstreams of the cluster
+func validateTrafficPolicy(loc entities.NginxLocation, upstreamNames map[string]bool) error {
+	switch loc.TrafficMode {
+	case "":
+		return nil
+	case trafficModeSplit, trafficModeBlueGreen:
+	default:
+		return fmt.Errorf("invalid traffic mode %q (allowed: split, blue_green)", loc.TrafficMode)
+	}
+	if hasServers, ok := upstreamNames[loc.ProxyPass]; !ok {
+		return fmt.Errorf("traffic policies need proxy_pass to name an upstream of this cluster, got %q", loc.ProxyPass)
+	} else if !hasServers {
+		return fmt.Errorf("upstream %q has no servers", loc.ProxyPass)
+	}
+	if hasServers, ok := upstreamNames[loc.SecondaryUpstream]; !ok {
+		return fmt.Errorf("secondary upstream %q is not an upstream of this cluster", loc.SecondaryUpstream)
+	} else if !hasServers {
+		return fmt.Errorf("upstream %q has no servers", loc.SecondaryUpstream)
+	}
+	if loc.SecondaryUpstream == loc.ProxyPass {
+		return fmt.Errorf("secondary upstream must differ from proxy_pass %q", loc.ProxyPass)
+	}
+	if loc.TrafficMode == trafficModeSplit && (loc.SecondaryWeight < 0 || loc.SecondaryWeight > 100) {
+		return fmt.Errorf("secondary weight %d must be between 0 and 100", loc.SecondaryWeight)
+	}
+	if loc.TrafficMode == trafficModeBlueGreen && loc.ActiveUpstream != loc.ProxyPass && loc.ActiveUpstream != loc.SecondaryUpstream {
+		return fmt.Errorf("active upstream %q must be %s or %s", loc.ActiveUpstream, loc.ProxyPass, loc.SecondaryUpstream)
+	}
+	if loc.RouteHeader != "" && !trafficHeaderPattern.MatchString(loc.RouteHeader) {
+		return fmt.Errorf("invalid route header %q", loc.RouteHeader)
+	}
+	if loc.RouteCookie != "" && !trafficCookiePattern.MatchString(loc.RouteCookie) {
+		return fmt.Errorf("invalid route cookie %q", loc.RouteCookie)
+	}
+	for _, value := range []string{loc.RouteHeaderValue, loc.RouteCookieValue} {
+		if err := nginxSafeValue("route value", value); err != nil {
+			return err
+		}
+		if strings.ContainsAny(value, "\"\\$") {
+			return fmt.Errorf("invalid route value %q", value)
+		}
+	}
+	return nil
+}
+
+// trafficProxyPass renders the traffic policy of a location as split_clients and map blocks and
+// returns the proxy_pass target that picks the upstream per request
+func trafficProxyPass(loc entities.NginxLocation, upstreamNames map[string]bool, data *nginxConfigData) (string, error) {
+	if err := validateTrafficPolicy(loc, upstreamNames); err != nil {
+		return "", err
+	}
+	prefix := "tp_" + strings.ReplaceAll(loc.ID, "-", "")[:12]
+
+	// current is the upstream name, or the variable holding it, chosen so far
+	current := loc.ProxyPass
+	override := loc.SecondaryUpstream
+	if loc.TrafficMode == trafficModeBlueGreen {
+		current = loc.ActiveUpstream
+		if current == loc.SecondaryUpstream {
+			override = loc.ProxyPass
+		}
+	} else if loc.SecondaryWeight >= 100 {
+		current = loc.SecondaryUpstream
+	} else if loc.SecondaryWeight > 0 {
+		key := "${request_id}"
+		if loc.StickySplit {
+			key = "${remote_addr}"
+		}
+		split := nginxTrafficSplit{
+			Key:      key,
+			Variable: prefix + "_split",
+			Percent:  loc.SecondaryWeight,
+			Target:   loc.SecondaryUpstream,
+			Default:  loc.ProxyPass,
+		}
+		data.TrafficSplits = append(data.TrafficSplits, split)
+		current = "$" + split.Variable
+	}
+
+	// Testers reach the other upstream with a header or cookie, whatever the split says
+	if loc.RouteHeader != "" {
+		m := nginxTrafficMap{
+			Source:   "$http_" + strings.ToLower(strings.ReplaceAll(loc.RouteHeader, "-", "_")),
+			Variable: prefix + "_header",
+			Value:    loc.RouteHeaderValue,
+			Target:   override,
+			Default:  current,
+		}
+		data.TrafficMaps = append(data.TrafficMaps, m)
+		current = "$" + m.Variable
+	}
+	if loc.RouteCookie != "" {
+		m := nginxTrafficMap{
+			Source:   "$cookie_" + loc.RouteCookie,
+			Variable: prefix + "_cookie",
+			Value:    loc.RouteCookieValue,
+			Target:   override,
+			Default:  current,
+		}
+		data.TrafficMaps = append(data.TrafficMaps, m)
+		current = "$" + m.Variable
+	}
+	return "http://" + current, nil
+}
+
+// nginxProxyTarget resolves proxy_pass to an upstream of the cluster or validates it as an http(s) URL
+func nginxProxyTarget(target string, upstreamNames map[string]bool) (string, error) {
+	if err := nginxSafeValue("proxy_pass", target); err != nil {
+		return "", err
+	}
+	if hasServers, ok := upstreamNames[target]; ok {
+		if !hasServers {
+			return "", fmt.Errorf("upstream %q has no servers", target)
+		}
+		return "http://" + target, nil
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("proxy_pass %q is neither an upstream of this cluster nor an http(s) URL", target)
+	}
+	if hasServers, ok := upstreamNames[parsed.Host]; ok && !hasServers {
+		return "", fmt.Errorf("upstream %q has no servers", parsed.Host)
+	}
+	// A URL may still name an upstream, e.g. http://backend/api
+	return target, nil
+}
+
+// validateLocationPath checks a location modifier and the path or regex it applies to
+func validateLocationPath(modifier, path string) error {
+	if err := nginxSafeValue("location path", path); err != nil {
+		return err
+	}
+	if path == "" || strings.ContainsAny(path, " \t") {
+		return fmt.Errorf("location path %q must be non-empty and contain no whitespace", path)
+	}
+	if strings.HasPrefix(path, strings.TrimSuffix(nginxACMEChallengeDir, "/")) {
+		return fmt.Errorf("location path %q is reserved for ACME challenges", path)
+	}
+	if strings.HasPrefix(path, nginxAuthRequestPath) {
+		return fmt.Errorf("location path %q is reserved for auth requests", path)
+	}
+	switch modifier {
+	case "", "=", "^~":
+		if !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "@") {
+			return fmt.Errorf("prefix location %q must start with /", path)
+		}
+		if strings.HasPrefix(path, "@") && modifier != "" {
+			return fmt.Errorf("named location %q cannot have a modifier", path)
+		}
+	case "~", "~*":
+		// nginx uses PCRE; RE2 accepts most practical location patterns and catches obvious typos early
+		if _, err := regexp.Compile(path); err != nil {
+			return fmt.Errorf("invalid location regex %q: %v", path, err)
+		}
+	default:
+		return fmt.Errorf("invalid location modifier %q (allowed: =, ~, ~*, ^~)", modifier)
+	}
+	return nil
+}
+
+// validateRegexProxyPass mirrors nginx refusing a proxy_pass URI inside regex locations
+func validateRegexProxyPass(modifier, target string) error {
+	if modifier != "~" && modifier != "~*" {
+		return nil
+	}
+	if parsed, err := url.Parse(target); err == nil && parsed.Path != "" {
+		return fmt.Errorf("proxy_pass cannot have a URI part in a regex location")
+	}
+	return nil
+}
+
+var nginxHostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+// nginxServerAddress accepts only host:port, so an address cannot add parameters to its server line
+func nginxServerAddress(field, address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: must be host:port", field, address)
+	}
+	if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 || strconv.Itoa(number) != port {
+		return fmt.Errorf("invalid %s %q: port must be between 1 and 65535", field, address)
+	}
+	if net.ParseIP(host) == nil && (len(host) > 253 || !nginxHostnamePattern.MatchString(host)) {
+		return fmt.Errorf("invalid %s %q: host must be a hostname or an IP address", field, address)
+	}
+	return nil
+}
+
+// nginxSafeValue rejects values that could close or inject nginx directives
+func nginxSafeValue(field, value string) error {
+	if strings.ContainsAny(value, ";{}\n\r#") {
+		return fmt.Errorf("invalid %s %q", field, value)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+)
+
+// fakeNginxRenderRepo serves the rows read while rendering; other repository methods are not used
+type fakeNginxRenderRepo struct {
+	repositories.INginxClusterRepository
+	upstreams []entities.NginxClusterUpstream
+	servers   map[string][]entities.NginxUpstreamServer
+	blocks    []entities.NginxServerBlock
+	locations map[string][]entities.NginxLocation
+	policies  []entities.NginxAccessPolicy
+}
+
+func (r *fakeNginxRenderRepo) ListUpstreams(clusterID string) ([]entities.NginxClusterUpstream, error) {
+	return r.upstreams, nil
+}
+
+func (r *fakeNginxRenderRepo) ListUpstreamServers(upstreamID string) ([]entities.NginxUpstreamServer, error) {
+	return r.servers[upstreamID], nil
+}
+
+func (r *fakeNginxRenderRepo) ListServerBlocks(clusterID string) ([]entities.NginxServerBlock, error) {
+	return r.blocks, nil
+}
+
+func (r *fakeNginxRenderRepo) ListLocations(serverBlockID string) ([]entities.NginxLocation, error) {
+	return r.locations[serverBlockID], nil
+}
+
+func (r *fakeNginxRenderRepo) ListAccessPolicies(clusterID string) ([]entities.NginxAccessPolicy, error) {
+	return r.policies, nil
+}
+
+func (r *fakeNginxRenderRepo) ListStreamProxies(clusterID string) ([]entities.NginxStreamProxy, error) {
+	return nil, nil
+}
+
+func newRenderTestService(proxyPass string, servers map[string][]entities.NginxUpstreamServer) *nginxClusterService {
+	repo := &fakeNginxRenderRepo{
+		upstreams: []entities.NginxClusterUpstream{
+			{ID: "u1", Name: "backend", Algorithm: "round_robin"},
+			{ID: "u2", Name: "empty", Algorithm: "round_robin"},
+		},
+		servers: servers,
+		blocks:  []entities.NginxServerBlock{{ID: "b1", ServerName: "example.com"}},
+		locations: map[string][]entities.NginxLocation{
+			"b1": {{ID: "l1", ServerBlockID: "b1", Path: "/api", ProxyPass: proxyPass}},
+		},
+	}
+	return &nginxClusterService{clusterRepo: repo}
+}
+
+func TestGenerateNginxConfigUpstream(t *testing.T) {
+	svc := newRenderTestService("backend", map[string][]entities.NginxUpstreamServer{
+		"u1": {{Address: "10.0.0.1:8080"}},
+	})
+
+	config, err := svc.generateNginxConfig(&entities.NginxCluster{ID: "c1"})
+	require.NoError(t, err)
+	assert.Contains(t, config, "upstream backend")
+	assert.Contains(t, config, "server 10.0.0.1:8080")
+	assert.Contains(t, config, "proxy_pass http://backend;")
+	// An upstream without servers is left out instead of producing an invalid block
+	assert.NotContains(t, config, "upstream empty")
+}
+
+func TestGenerateNginxConfigEmptyUpstream(t *testing.T) {
+	for _, proxyPass := range []string{"empty", "http://empty/api"} {
+		svc := newRenderTestService(proxyPass, map[string][]entities.NginxUpstreamServer{
+			"u1": {{Address: "10.0.0.1:8080"}},
+		})
+
+		_, err := svc.generateNginxConfig(&entities.NginxCluster{ID: "c1"})
+		require.Error(t, err, proxyPass)
+		assert.Contains(t, err.Error(), `upstream "empty" has no servers`)
+	}
+}
+
+func TestGenerateNginxConfigMissingUpstream(t *testing.T) {
+	svc := newRenderTestService("missing", map[string][]entities.NginxUpstreamServer{
+		"u1": {{Address: "10.0.0.1:8080"}},
+	})
+
+	_, err := svc.generateNginxConfig(&entities.NginxCluster{ID: "c1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "neither an upstream of this cluster nor an http(s) URL")
+}
+
+func TestGenerateNginxConfigRejectsServerParameters(t *testing.T) {
+	for _, address := range []string{"10.0.0.1:80 backup", "x:1 max_fails=0", "10.0.0.1:80\tdown"} {
+		svc := newRenderTestService("backend", map[string][]entities.NginxUpstreamServer{
+			"u1": {{Address: address}},
+		})
+
+		_, err := svc.generateNginxConfig(&entities.NginxCluster{ID: "c1"})
+		require.Error(t, err, address)
+		assert.Contains(t, err.Error(), "invalid upstream server", address)
+	}
+}
+
+func TestNginxServerAddress(t *testing.T) {
+	for _, address := range []string{"10.0.0.1:80", "[::1]:8080", "backend.local:8080", "api-1:65535"} {
+		assert.NoError(t, nginxServerAddress("server", address), address)
+	}
+	for _, address := range []string{
+		"10.0.0.1", "10.0.0.1:", "10.0.0.1:0", "10.0.0.1:65536", "10.0.0.1:080", "10.0.0.1:http",
+		":80", "unix:/tmp/app.sock", "-api:80", "api_1:80", "api..local:80", "x:1 max_fails=0",
+	} {
+		assert.Error(t, nginxServerAddress("server", address), address)
+	}
+}
+
+func TestLocationViewProxyHeaders(t *testing.T) {
+	upstreamNames := map[string]bool{"backend": true}
+	loc := entities.NginxLocation{Path: "/", ProxyPass: "backend", ProxyHeaders: `{"X-B":"2","X-A":"1"}`}
+
+	view, err := locationView(&entities.NginxCluster{}, loc, upstreamNames, &nginxConfigData{})
+	require.NoError(t, err)
+	assert.Equal(t, []nginxHeader{{Name: "X-A", Value: "1"}, {Name: "X-B", Value: "2"}}, view.Headers)
+
+	loc.ProxyHeaders = `{"X-A":`
+	_, err = locationView(&entities.NginxCluster{}, loc, upstreamNames, &nginxConfigData{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid proxy headers")
+}
+
+func TestValidateTrafficPolicyEmptyUpstream(t *testing.T) {
+	loc := entities.NginxLocation{
+		TrafficMode:       trafficModeSplit,
+		ProxyPass:         "stable",
+		SecondaryUpstream: "canary",
+		SecondaryWeight:   10,
+	}
+
+	assert.NoError(t, validateTrafficPolicy(loc, map[string]bool{"stable": true, "canary": true}))
+	assert.EqualError(t, validateTrafficPolicy(loc, map[string]bool{"stable": true, "canary": false}), `upstream "canary" has no servers`)
+	assert.Error(t, validateTrafficPolicy(loc, map[string]bool{"stable": true}))
+}
+
+func TestProxyTargetsUpstream(t *testing.T) {
+	assert.True(t, proxyTargetsUpstream("backend", "backend"))
+	assert.True(t, proxyTargetsUpstream("http://backend/api", "backend"))
+	assert.False(t, proxyTargetsUpstream("http://backend2/api", "backend"))
+	assert.False(t, proxyTargetsUpstream("", "backend"))
+}
@@ -0,0 +1,625 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+const (
+	revisionPending = "pending"
+	revisionApplied = "applied"
+	revisionPartial = "partial"
+	revisionFailed  = "failed"
+
+	canaryProbeAttempts = 3
+	canaryProbeInterval = 2 * time.Second
+	revisionDiffContext = 3
+)
+
+// ListConfigRevisions returns the revision history of a cluster, newest first
+func (s *nginxClusterService) ListConfigRevisions(ctx context.Context, clusterID string, limit int) (*dto.NginxConfigRevisionListResponse, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	revisions, err := s.clusterRepo.ListConfigRevisions(clusterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+
+	resp := &dto.NginxConfigRevisionListResponse{
+		ClusterID:       clusterID,
+		CurrentRevision: cluster.ConfigRevision,
+		Revisions:       make([]dto.NginxConfigRevisionInfo, 0, len(revisions)),
+	}
+	for _, rev := range revisions {
+		resp.Revisions = append(resp.Revisions, toRevisionInfo(&rev, cluster.ConfigRevision))
+	}
+	return resp, nil
+}
+
+// GetConfigRevision returns one revision with its config. When against is set the diff
+// is computed against that revision instead of the one stored at creation time.
+func (s *nginxClusterService) GetConfigRevision(ctx context.Context, clusterID string, revision, against int) (*dto.NginxConfigRevisionInfo, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	rev, err := s.clusterRepo.FindConfigRevision(clusterID, revision)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d not found", revision)
+	}
+
+	info := toRevisionInfo(rev, cluster.ConfigRevision)
+	info.Config = rev.Config
+	info.Diff = rev.Diff
+	if against > 0 {
+		base, err := s.clusterRepo.FindConfigRevision(clusterID, against)
+		if err != nil {
+			return nil, fmt.Errorf("revision %d not found", against)
+		}
+		info.Diff = unifiedDiff(base.Config, rev.Config,
+			fmt.Sprintf("revision %d", against), fmt.Sprintf("revision %d", revision))
+	}
+	return &info, nil
+}
+
+// RollbackConfig stores the config of an earlier revision as a new revision and rolls it out
+// canary first. Upstreams, server blocks and locations are not touched, so the next change to
+// them renders the config from the database again.
+func (s *nginxClusterService) RollbackConfig(ctx context.Context, userID, clusterID string, req dto.RollbackNginxConfigRequest) (*dto.NginxConfigRevisionInfo, error) {
+	defer s.lockConfig(clusterID)()
+
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	target, err := s.clusterRepo.FindConfigRevision(clusterID, req.Revision)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d not found", req.Revision)
+	}
+	if target.Config == cluster.NginxConfig {
+		return nil, fmt.Errorf("revision %d is already applied", req.Revision)
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("rollback to revision %d", req.Revision)
+	}
+	rev, err := s.commitConfig(ctx, cluster, target.Config, userID, reason, target.Revision, true)
+	if rev == nil {
+		return nil, err
+	}
+	info := toRevisionInfo(rev, cluster.ConfigRevision)
+	return &info, err
+}
+
+// commitConfig records config as a new revision and, when apply is set, rolls it out.
+// Callers must hold the config lock of the cluster so revision numbers and rollouts never interleave.
+func (s *nginxClusterService) commitConfig(ctx context.Context, cluster *entities.NginxCluster, config, author, reason string, rollbackOf int, apply bool) (*entities.NginxConfigRevision, error) {
+	number := 1
+	if latest, err := s.clusterRepo.FindLatestConfigRevision(cluster.ID); err == nil {
+		number = latest.Revision + 1
+	}
+
+	sum := sha256.Sum256([]byte(config))
+	rev := &entities.NginxConfigRevision{
+		ID:         uuid.New().String(),
+		ClusterID:  cluster.ID,
+		Revision:   number,
+		Config:     config,
+		Checksum:   hex.EncodeToString(sum[:]),
+		Diff:       unifiedDiff(cluster.NginxConfig, config, "current", fmt.Sprintf("revision %d", number)),
+		Author:     author,
+		Reason:     reason,
+		RollbackOf: rollbackOf,
+		Status:     revisionPending,
+	}
+	if err := s.clusterRepo.CreateConfigRevision(rev); err != nil {
+		return nil, fmt.Errorf("failed to store config revision: %w", err)
+	}
+	if !apply {
+		return rev, nil
+	}
+
+	canaryID, failedNodes, err := s.rolloutConfig(ctx, cluster, config)
+	rev.CanaryNodeID = canaryID
+	if err != nil {
+		rev.Status = revisionFailed
+		rev.ErrorMessage = err.Error()
+		s.clusterRepo.UpdateConfigRevision(rev)
+		return rev, fmt.Errorf("revision %d not applied: %w", number, err)
+	}
+
+	now := time.Now()
+	rev.Status = revisionApplied
+	rev.AppliedAt = &now
+	if len(failedNodes) > 0 {
+		rev.Status = revisionPartial
+		rev.ErrorMessage = fmt.Sprintf("config sync failed on nodes: %s", strings.Join(failedNodes, ", "))
+	}
+	s.clusterRepo.UpdateConfigRevision(rev)
+
+	cluster.NginxConfig = config
+	cluster.ConfigRevision = number
+	if err := s.clusterRepo.Update(cluster); err != nil {
+		return rev, fmt.Errorf("failed to update cluster: %w", err)
+	}
+
+	s.logger.Info("config revision applied",
+		zap.String("cluster_id", cluster.ID),
+		zap.Int("revision", number),
+		zap.String("status", rev.Status))
+	return rev, nil
+}
+
+// rolloutConfig applies config to one canary node, probes it and only then continues with the
+// remaining nodes. A canary that fails is put back on the previous config. Nodes failing after
+// the canary passed are returned so the revision can be marked partial.
+func (s *nginxClusterService) rolloutConfig(ctx context.Context, cluster *entities.NginxCluster, config string) (string, []string, error) {
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil || len(nodes) == 0 {
+		return "", nil, fmt.Errorf("cluster has no nodes")
+	}
+	canary := s.pickCanaryNode(ctx, nodes)
+
+	s.logger.Info("applying config to canary node",
+		zap.String("cluster_id", cluster.ID),
+		zap.String("node", canary.Name))
+
+	if err := s.installTLSFiles(ctx, cluster, canary.ContainerID); err != nil {
+		return canary.ID, nil, fmt.Errorf("canary %s: %w", canary.Name, err)
+	}
+	if err := s.installAuthFiles(ctx, cluster, canary.ContainerID); err != nil {
+		return canary.ID, nil, fmt.Errorf("canary %s: %w", canary.Name, err)
+	}
+	if err := s.syncConfigToNode(ctx, canary, config); err != nil {
+		return canary.ID, nil, fmt.Errorf("canary %s: %w", canary.Name, err)
+	}
+	if err := s.probeCanary(ctx, canary, config); err != nil {
+		if cluster.NginxConfig != "" {
+			if restoreErr := s.syncConfigToNode(ctx, canary, cluster.NginxConfig); restoreErr != nil {
+				s.logger.Error("failed to restore canary config", zap.String("node", canary.Name), zap.Error(restoreErr))
+			}
+		}
+		return canary.ID, nil, fmt.Errorf("canary %s unhealthy: %w", canary.Name, err)
+	}
+
+	failedNodes := []string{}
+	for i := range nodes {
+		node := &nodes[i]
+		if node.ID == canary.ID {
+			continue
+		}
+		if err := s.installTLSFiles(ctx, cluster, node.ContainerID); err != nil {
+			s.logger.Error("failed to install TLS files", zap.String("node_id", node.ID), zap.Error(err))
+			failedNodes = append(failedNodes, node.Name)
+			continue
+		}
+		if err := s.installAuthFiles(ctx, cluster, node.ContainerID); err != nil {
+			s.logger.Error("failed to install htpasswd files", zap.String("node_id", node.ID), zap.Error(err))
+			failedNodes = append(failedNodes, node.Name)
+			continue
+		}
+		if err := s.syncConfigToNode(ctx, node, config); err != nil {
+			s.logger.Error("failed to sync config", zap.String("node_id", node.ID), zap.Error(err))
+			failedNodes = append(failedNodes, node.Name)
+		}
+	}
+	return canary.ID, failedNodes, nil
+}
+
+// pickCanaryNode prefers a healthy backup so the node carrying the VIP sees the config last
+func (s *nginxClusterService) pickCanaryNode(ctx context.Context, nodes []entities.NginxNode) *entities.NginxNode {
+	var master *entities.NginxNode
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Role == "master" {
+			master = node
+			continue
+		}
+		if s.checkNodeHealth(ctx, node) {
+			return node
+		}
+	}
+	if master != nil {
+		return master
+	}
+	return &nodes[0]
+}
+
+// probeCanary checks that the container still runs and nginx answers HTTP on the node itself,
+// on a port and path taken from the config being rolled out. Any non-5xx status counts, so
+// hand-written configs without /health pass as well.
+func (s *nginxClusterService) probeCanary(ctx context.Context, node *entities.NginxNode, config string) error {
+	target := canaryProbeTarget(config)
+	args := "wget -S -q -T 3 -O /dev/null"
+	if target.Scheme == "https" {
+		args += " --no-check-certificate"
+	}
+	if target.Host != "" {
+		args += " --header " + shellQuote("Host: "+target.Host)
+	}
+	probeURL := fmt.Sprintf("%s://127.0.0.1:%d%s", target.Scheme, target.Port, target.Path)
+	probe := []string{"sh", "-c",
+		args + " " + shellQuote(probeURL) + ` 2>&1 | grep -q "HTTP/1\.[01] [234]"`}
+
+	var lastErr error
+	for attempt := 1; attempt <= canaryProbeAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(canaryProbeInterval)
+		}
+		if !s.checkNodeHealth(ctx, node) {
+			lastErr = fmt.Errorf("container is not running")
+			continue
+		}
+		if err := s.dockerSvc.ExecStream(ctx, node.ContainerID, probe, nil, nil); err != nil {
+			lastErr = fmt.Errorf("http probe of %s failed: %w", probeURL, err)
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+type probeTarget struct {
+	Scheme string
+	Port   int
+	Host   string
+	Path   string
+}
+
+type probeServer struct {
+	plainPort int
+	sslPort   int
+	name      string
+	health    bool
+}
+
+// canaryProbeTarget picks what the canary probe requests from the config itself: the first http
+// server listening without TLS, preferring one with a /health location, otherwise the first TLS
+// listener. Configs without any http server are probed on port 80.
+func canaryProbeTarget(config string) probeTarget {
+	servers := parseProbeServers(config)
+
+	var chosen *probeServer
+	for i := range servers {
+		if servers[i].plainPort == 0 {
+			continue
+		}
+		if chosen == nil || (servers[i].health && !chosen.health) {
+			chosen = &servers[i]
+		}
+	}
+	target := probeTarget{Scheme: "http", Port: 80, Path: "/"}
+	if chosen == nil {
+		for i := range servers {
+			if servers[i].sslPort != 0 {
+				chosen = &servers[i]
+				target.Scheme = "https"
+				target.Port = chosen.sslPort
+				break
+			}
+		}
+	} else {
+		target.Port = chosen.plainPort
+	}
+	if chosen == nil {
+		return target
+	}
+	if chosen.health {
+		target.Path = "/health"
+	}
+	// Wildcard, regex and catch-all names cannot be sent as a Host header
+	if chosen.name != "_" && !strings.ContainsAny(chosen.name, "*~") {
+		target.Host = chosen.name
+	}
+	return target
+}
+
+// parseProbeServers walks the blocks of an nginx config and collects the listen ports,
+// first server_name and /health location of every server inside the http block
+func parseProbeServers(config string) []probeServer {
+	var servers []probeServer
+	var stack []string
+	var stmt strings.Builder
+	var quote rune
+	escaped, comment := false, false
+	inServer := func() bool {
+		return len(stack) >= 2 && stack[0] == "http" && stack[1] == "server"
+	}
+
+	for _, r := range config {
+		switch {
+		case comment:
+			if r == '\n' {
+				comment = false
+			}
+			continue
+		case quote != 0:
+			stmt.WriteRune(r)
+			if escaped {
+				escaped = false
+			} else if r == '\\' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch r {
+		case '#':
+			comment = true
+		case '"', '\'':
+			quote = r
+			stmt.WriteRune(r)
+		case '{':
+			fields := strings.Fields(stmt.String())
+			stmt.Reset()
+			name := ""
+			if len(fields) > 0 {
+				name = fields[0]
+			}
+			stack = append(stack, name)
+			if len(stack) == 2 && inServer() {
+				servers = append(servers, probeServer{})
+			}
+			if len(stack) == 3 && inServer() && name == "location" && len(fields) >= 2 {
+				modifier := ""
+				if len(fields) == 3 {
+					modifier = fields[1]
+				}
+				if fields[len(fields)-1] == "/health" && (modifier == "" || modifier == "=" || modifier == "^~") {
+					servers[len(servers)-1].health = true
+				}
+			}
+		case '}':
+			stmt.Reset()
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ';':
+			fields := strings.Fields(stmt.String())
+			stmt.Reset()
+			if len(stack) != 2 || !inServer() || len(fields) < 2 {
+				continue
+			}
+			server := &servers[len(servers)-1]
+			switch fields[0] {
+			case "listen":
+				port := listenPort(fields[1])
+				if port == 0 {
+					continue
+				}
+				tls := false
+				for _, flag := range fields[2:] {
+					if flag == "ssl" || flag == "quic" {
+						tls = true
+					}
+				}
+				if tls && server.sslPort == 0 {
+					server.sslPort = port
+				} else if !tls && server.plainPort == 0 {
+					server.plainPort = port
+				}
+			case "server_name":
+				if server.name == "" {
+					server.name = strings.Trim(fields[1], `"'`)
+				}
+			}
+		default:
+			stmt.WriteRune(r)
+		}
+	}
+	return servers
+}
+
+// listenPort returns the port of a listen address such as 80, 127.0.0.1:8080 or [::]:443,
+// or 0 for unix sockets
+func listenPort(address string) int {
+	if strings.HasPrefix(address, "unix:") {
+		return 0
+	}
+	if i := strings.LastIndex(address, ":"); i >= 0 {
+		address = address[i+1:]
+	}
+	port, err := strconv.Atoi(address)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0
+	}
+	return port
+}
+
+func toRevisionInfo(rev *entities.NginxConfigRevision, current int) dto.NginxConfigRevisionInfo {
+	info := dto.NginxConfigRevisionInfo{
+		Revision:     rev.Revision,
+		Checksum:     rev.Checksum,
+		Author:       rev.Author,
+		Reason:       rev.Reason,
+		Status:       rev.Status,
+		Current:      rev.Revision == current,
+		RollbackOf:   rev.RollbackOf,
+		CanaryNodeID: rev.CanaryNodeID,
+		ErrorMessage: rev.ErrorMessage,
+		CreatedAt:    rev.CreatedAt.Format(time.RFC3339),
+	}
+	if rev.AppliedAt != nil {
+		info.AppliedAt = rev.AppliedAt.Format(time.RFC3339)
+	}
+	return info
+}
+
+// unifiedDiff returns a unified diff of two configs, or "" when they are equal
+func unifiedDiff(from, to, fromLabel, toLabel string) string {
+	if from == to {
+		return ""
+	}
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	// Line numbers in both files before each op, used for hunk headers
+	fromPos := make([]int, len(ops)+1)
+	toPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		fromPos[i+1], toPos[i+1] = fromPos[i], toPos[i]
+		if op.kind != '+' {
+			fromPos[i+1]++
+		}
+		if op.kind != '-' {
+			toPos[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromLabel, toLabel)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - revisionDiffContext
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*revisionDiffContext {
+				end += revisionDiffContext
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = next
+		}
+
+		fromCount := fromPos[end] - fromPos[start]
+		toCount := toPos[end] - toPos[start]
+		fromStart, toStart := fromPos[start], toPos[start]
+		if fromCount > 0 {
+			fromStart++
+		}
+		if toCount > 0 {
+			toStart++
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", fromStart, fromCount, toStart, toCount)
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+		i = end
+	}
+	return out.String()
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLineCells caps the LCS table of diffLines; larger changes are shown as a whole replacement
+const diffLineCells = 4 << 20
+
+// diffLines computes a line diff from the longest common subsequence of a and b.
+// The common prefix and suffix are matched directly so the table only covers the changed middle.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func diffMiddle(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	if (len(a)+1)*(len(b)+1) > diffLineCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
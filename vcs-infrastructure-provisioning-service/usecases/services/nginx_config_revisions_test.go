@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// applyDiff rebuilds both sides of a diff to check that no line was lost or reordered
+func applyDiff(ops []diffOp) (from, to []string) {
+	for _, op := range ops {
+		if op.kind != '+' {
+			from = append(from, op.line)
+		}
+		if op.kind != '-' {
+			to = append(to, op.line)
+		}
+	}
+	return from, to
+}
+
+func TestDiffLines(t *testing.T) {
+	a := []string{"http {", "    listen 80;", "    root /a;", "}"}
+	b := []string{"http {", "    listen 8080;", "    root /a;", "    index x;", "}"}
+
+	ops := diffLines(a, b)
+	assert.Equal(t, []diffOp{
+		{' ', "http {"},
+		{'-', "    listen 80;"},
+		{'+', "    listen 8080;"},
+		{' ', "    root /a;"},
+		{'+', "    index x;"},
+		{' ', "}"},
+	}, ops)
+}
+
+func TestDiffLinesEdges(t *testing.T) {
+	assert.Empty(t, diffLines(nil, nil))
+	assert.Equal(t, []diffOp{{'+', "a"}}, diffLines(nil, []string{"a"}))
+	assert.Equal(t, []diffOp{{'-', "a"}}, diffLines([]string{"a"}, nil))
+	assert.Equal(t, []diffOp{{' ', "a"}, {' ', "b"}}, diffLines([]string{"a", "b"}, []string{"a", "b"}))
+}
+
+func TestDiffLinesLargeInputIsCapped(t *testing.T) {
+	// Both sides differ on every line, so without the cap the LCS table would hold 9M cells
+	a := make([]string, 3000)
+	b := make([]string, 3000)
+	for i := range a {
+		a[i] = fmt.Sprintf("a %d", i)
+		b[i] = fmt.Sprintf("b %d", i)
+	}
+	a = append([]string{"same"}, a...)
+	b = append([]string{"same"}, b...)
+
+	ops := diffLines(a, b)
+	require.Len(t, ops, 1+3000+3000)
+	assert.Equal(t, diffOp{' ', "same"}, ops[0])
+	assert.Equal(t, byte('-'), ops[1].kind)
+	assert.Equal(t, byte('+'), ops[len(ops)-1].kind)
+
+	from, to := applyDiff(ops)
+	assert.Equal(t, a, from)
+	assert.Equal(t, b, to)
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	assert.Equal(t, "", unifiedDiff("a\n", "a\n", "current", "revision 2"))
+
+	diff := unifiedDiff("a\nb\nc\n", "a\nx\nc\n", "current", "revision 2")
+	assert.True(t, strings.HasPrefix(diff, "--- current\n+++ revision 2\n"), diff)
+	assert.Contains(t, diff, "-b\n+x\n")
+}
+
+func TestCanaryProbeTarget(t *testing.T) {
+	rendered := `http {
+    server {
+        listen 80 default_server;
+        server_name _;
+        location /health {
+            return 200 "{\"status\":\"healthy\"}";
+        }
+    }
+    server {
+        listen 8080;
+        server_name app.example.com;
+    }
+}
+stream {
+    server {
+        listen 5432;
+    }
+}`
+	assert.Equal(t, probeTarget{Scheme: "http", Port: 80, Path: "/health"}, canaryProbeTarget(rendered))
+
+	custom := `# listen 80;
+http {
+    server {
+        listen 127.0.0.1:8443 ssl;
+        server_name secure.example.com;
+    }
+    server {
+        listen [::]:8080;
+        server_name 'app.example.com' www.example.com;
+        location / { proxy_pass http://backend; }
+    }
+}`
+	assert.Equal(t, probeTarget{Scheme: "http", Port: 8080, Host: "app.example.com", Path: "/"}, canaryProbeTarget(custom))
+
+	tlsOnly := `http { server { listen 443 ssl; server_name *.example.com; location = /health { return 200; } } }`
+	assert.Equal(t, probeTarget{Scheme: "https", Port: 443, Path: "/health"}, canaryProbeTarget(tlsOnly))
+
+	assert.Equal(t, probeTarget{Scheme: "http", Port: 80, Path: "/"}, canaryProbeTarget("events {}"))
+}
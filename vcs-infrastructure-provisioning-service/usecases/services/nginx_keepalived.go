@@ -0,0 +1,318 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+const (
+	nginxKeepalivedImage   = "iaas-nginx-keepalived:latest"
+	keepalivedConfigPath   = "/etc/keepalived/keepalived.conf"
+	keepalivedStatePath    = "/var/run/keepalived/state"
+	vrrpMonitorInterval    = 5 * time.Second
+	vrrpMasterPriority     = 100
+	vrrpDemotedPriority    = 50
+	vrrpMaxPriority        = 254
+	vrrpStateMaster        = "MASTER"
+	vrrpStateFault         = "FAULT"
+	failoverReasonAuto     = "automatic"
+	failoverReasonNodeDown = "node_failure"
+)
+
+// keepalivedCapabilities lets keepalived add the VIP and send VRRP adverts from inside the container
+var keepalivedCapabilities = []string{"NET_ADMIN", "NET_BROADCAST", "NET_RAW"}
+
+type keepalivedConfigData struct {
+	NodeName   string
+	State      string
+	Interface  string
+	RouterID   int
+	Priority   int
+	AuthPass   string
+	VirtualIP  string
+	HealthPath string
+	Interval   int
+	TrackNginx bool
+}
+
+var keepalivedConfigTemplate = template.Must(template.New("keepalived.conf").Parse(`# Keepalived Configuration - Generated by IaaS Platform
+global_defs {
+    router_id {{.NodeName}}
+    script_user root
+    enable_script_security
+}
+{{if .TrackNginx}}
+vrrp_script chk_nginx {
+    script "/usr/local/bin/check_nginx.sh {{.HealthPath}}"
+    interval {{.Interval}}
+    timeout 3
+    fall 2
+    rise 2
+}
+{{end}}
+vrrp_instance VI_{{.RouterID}} {
+    state {{.State}}
+    interface {{.Interface}}
+    virtual_router_id {{.RouterID}}
+    priority {{.Priority}}
+    advert_int 1
+
+    authentication {
+        auth_type PASS
+        auth_pass {{.AuthPass}}
+    }
+{{- if .VirtualIP}}
+
+    virtual_ipaddress {
+        {{.VirtualIP}}
+    }
+{{- end}}
+{{- if .TrackNginx}}
+
+    track_script {
+        chk_nginx
+    }
+{{- end}}
+
+    notify /usr/local/bin/keepalived_notify.sh
+}
+`))
+
+// generateKeepalivedConfig renders keepalived.conf for one node from the cluster VRRP settings
+func generateKeepalivedConfig(cluster *entities.NginxCluster, node *entities.NginxNode) (string, error) {
+	if cluster.VRRPRouterID < 1 || cluster.VRRPRouterID > 255 {
+		return "", fmt.Errorf("vrrp_router_id must be between 1 and 255")
+	}
+	if node.Priority < 1 || node.Priority > vrrpMaxPriority {
+		return "", fmt.Errorf("priority must be between 1 and %d", vrrpMaxPriority)
+	}
+	healthPath := cluster.HealthCheckPath
+	if healthPath == "" {
+		healthPath = "/health"
+	}
+	if !strings.HasPrefix(healthPath, "/") || strings.ContainsAny(healthPath, " \t\"'\\;{}#\n\r") {
+		return "", fmt.Errorf("invalid health_check_path %q", healthPath)
+	}
+	for _, value := range []string{cluster.VRRPInterface, cluster.VirtualIP} {
+		if strings.ContainsAny(value, " \t\"'\\;{}#\n\r") {
+			return "", fmt.Errorf("invalid VRRP setting %q", value)
+		}
+	}
+
+	data := keepalivedConfigData{
+		NodeName:   node.Name,
+		State:      "BACKUP",
+		Interface:  cluster.VRRPInterface,
+		RouterID:   cluster.VRRPRouterID,
+		Priority:   node.Priority,
+		AuthPass:   strings.ReplaceAll(cluster.ID, "-", "")[:8], // VRRP PASS auth uses 8 characters at most
+		VirtualIP:  cluster.VirtualIP,
+		HealthPath: healthPath,
+		Interval:   cluster.HealthCheckInterval,
+		TrackNginx: cluster.HealthCheckEnabled,
+	}
+	if node.Role == "master" {
+		data.State = vrrpStateMaster
+	}
+	if data.Interface == "" {
+		data.Interface = "eth0"
+	}
+	if data.Interval <= 0 {
+		data.Interval = 5
+	}
+
+	var buf bytes.Buffer
+	if err := keepalivedConfigTemplate.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render keepalived config: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// keepalivedEnv returns the container env that makes the entrypoint start keepalived
+func keepalivedEnv(cluster *entities.NginxCluster, node *entities.NginxNode) ([]string, error) {
+	config, err := generateKeepalivedConfig(cluster, node)
+	if err != nil {
+		return nil, err
+	}
+	return []string{"KEEPALIVED_CONF=" + base64.StdEncoding.EncodeToString([]byte(config))}, nil
+}
+
+// replaceKeepalivedEnv swaps the KEEPALIVED_CONF entry of a container env for the given ones
+func replaceKeepalivedEnv(env []string, keepalived []string) []string {
+	result := make([]string, 0, len(env)+len(keepalived))
+	for _, envVar := range env {
+		if strings.HasPrefix(envVar, "KEEPALIVED_CONF=") {
+			continue
+		}
+		result = append(result, envVar)
+	}
+	return append(result, keepalived...)
+}
+
+// pushKeepalivedConfig writes a node's keepalived.conf into its container and reloads keepalived
+func (s *nginxClusterService) pushKeepalivedConfig(ctx context.Context, cluster *entities.NginxCluster, node *entities.NginxNode) error {
+	config, err := generateKeepalivedConfig(cluster, node)
+	if err != nil {
+		return err
+	}
+	if err := s.writeNginxFile(ctx, node.ContainerID, keepalivedConfigPath, config); err != nil {
+		return fmt.Errorf("failed to write keepalived config on %s: %w", node.Name, err)
+	}
+	reload := []string{"sh", "-c", `kill -HUP "$(cat /var/run/keepalived.pid)"`}
+	if err := s.dockerSvc.ExecStream(ctx, node.ContainerID, reload, nil, nil); err != nil {
+		return fmt.Errorf("failed to reload keepalived on %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// vrrpState returns the VRRP state keepalived last reported on a node, or "" when keepalived is not running there
+func (s *nginxClusterService) vrrpState(ctx context.Context, node *entities.NginxNode) string {
+	if node.ContainerID == "" {
+		return ""
+	}
+	var out bytes.Buffer
+	if err := s.dockerSvc.ExecStream(ctx, node.ContainerID, []string{"cat", keepalivedStatePath}, nil, &out); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// keepalivedStatus maps a reported VRRP state to the health status shown for a node
+func keepalivedStatus(state string) string {
+	if state == "" {
+		return "not_running"
+	}
+	return strings.ToLower(state)
+}
+
+// waitForVRRPMaster polls until keepalived reports MASTER on the node
+func (s *nginxClusterService) waitForVRRPMaster(ctx context.Context, node *entities.NginxNode, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if s.vrrpState(ctx, node) == vrrpStateMaster {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("node %s did not become VRRP master within %s", node.Name, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// StartVRRPMonitor follows the VRRP state of every nginx node and records master changes
+// made by keepalived itself, e.g. when the health script fails or a node goes away
+func (s *nginxClusterService) StartVRRPMonitor(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(vrrpMonitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				clusters, err := s.clusterRepo.ListAll()
+				if err != nil {
+					s.logger.Warn("failed to list nginx clusters for VRRP monitor", zap.Error(err))
+					continue
+				}
+				for i := range clusters {
+					if clusters[i].Infrastructure.Status != entities.StatusRunning {
+						continue
+					}
+					s.reconcileVRRP(ctx, &clusters[i])
+				}
+			}
+		}
+	}()
+}
+
+// reconcileVRRP syncs the recorded master with the node keepalived elected
+func (s *nginxClusterService) reconcileVRRP(ctx context.Context, cluster *entities.NginxCluster) {
+	s.vrrpMu.Lock()
+	defer s.vrrpMu.Unlock()
+
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return
+	}
+	states := make(map[string]string, len(nodes))
+	var masters []*entities.NginxNode
+	for i := range nodes {
+		states[nodes[i].ID] = s.vrrpState(ctx, &nodes[i])
+		if states[nodes[i].ID] == vrrpStateMaster {
+			masters = append(masters, &nodes[i])
+		}
+	}
+	if len(masters) > 1 {
+		s.logger.Warn("multiple VRRP masters reported", zap.String("cluster_id", cluster.ID), zap.Int("masters", len(masters)))
+		return
+	}
+	// No master yet (election running) or keepalived not deployed on this cluster
+	if len(masters) == 0 {
+		return
+	}
+
+	newMaster := masters[0]
+	if newMaster.ID == cluster.MasterNodeID && newMaster.Role == "master" {
+		return
+	}
+
+	var oldMaster *entities.NginxNode
+	for i := range nodes {
+		if nodes[i].ID == cluster.MasterNodeID {
+			oldMaster = &nodes[i]
+		}
+		role := "backup"
+		if nodes[i].ID == newMaster.ID {
+			role = "master"
+		}
+		if nodes[i].Role != role {
+			nodes[i].Role = role
+			s.clusterRepo.UpdateNode(&nodes[i])
+		}
+	}
+
+	cluster.MasterNodeID = newMaster.ID
+	if err := s.clusterRepo.Update(cluster); err != nil {
+		s.logger.Error("failed to record VRRP master", zap.String("cluster_id", cluster.ID), zap.Error(err))
+		return
+	}
+	if oldMaster == nil || oldMaster.ID == newMaster.ID {
+		return
+	}
+
+	reason := failoverReasonAuto
+	if state := states[oldMaster.ID]; state == vrrpStateFault || state == "" {
+		reason = failoverReasonNodeDown
+	}
+	s.clusterRepo.CreateFailoverEvent(&entities.NginxFailoverEvent{
+		ID:            uuid.New().String(),
+		ClusterID:     cluster.ID,
+		OldMasterID:   oldMaster.ID,
+		OldMasterName: oldMaster.Name,
+		NewMasterID:   newMaster.ID,
+		NewMasterName: newMaster.Name,
+		Reason:        reason,
+		TriggeredBy:   "keepalived",
+	})
+	s.publishEvent(ctx, "nginx_cluster.failover", cluster.InfrastructureID, cluster.ID, string(entities.StatusRunning))
+	s.logger.Info("keepalived moved VRRP master",
+		zap.String("cluster_id", cluster.ID),
+		zap.String("old_master", oldMaster.Name),
+		zap.String("new_master", newMaster.Name),
+		zap.String("reason", reason))
+}
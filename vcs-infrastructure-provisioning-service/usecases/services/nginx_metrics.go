@@ -0,0 +1,399 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+const (
+	metricsCollectInterval  = 15 * time.Second
+	metricsRetention        = 7 * 24 * time.Hour
+	metricsHistoryRange     = time.Hour
+	metricsHistoryLimit     = 500
+	metricsHistoryMaxLimit  = 5000
+	nginxStubStatusEndpoint = "http://127.0.0.1/nginx_status"
+)
+
+// accessLogPattern matches the "main" log format of the rendered nginx.conf and captures
+// status, rt, uct, uht and urt
+var accessLogPattern = regexp.MustCompile(`^\S+ - \S+ \[[^\]]*\] ".*" (\d{3}) \d+ ".*" ".*" ".*" rt=([\d.]+) uct="([^"]*)" uht="([^"]*)" urt="([^"]*)"$`)
+
+// nodeScrape is what the previous scrape of a node left behind for the next one
+type nodeScrape struct {
+	at       time.Time
+	requests int64
+}
+
+type stubStatus struct {
+	active, reading, writing, waiting int
+	accepts, handled, requests        int64
+}
+
+// accessLogStats aggregates the access log lines of one scrape window
+type accessLogStats struct {
+	requests         int64
+	statuses         [5]int64 // 1xx..5xx
+	requestTime      []float64
+	upstreamConnect  []float64
+	upstreamHeader   []float64
+	upstreamResponse []float64
+}
+
+// StartMetricsCollector scrapes stub_status and the access log of every running node and stores
+// a sample per node, so GetClusterMetrics and the metrics history read real traffic figures.
+// Samples live only in the nginx_metric_samples table of this service for metricsRetention; the
+// monitoring service does not scrape nginx nodes, so they are not indexed into Elasticsearch.
+func (s *nginxClusterService) StartMetricsCollector(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(metricsCollectInterval)
+		defer ticker.Stop()
+		lastPrune := time.Time{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				clusters, err := s.clusterRepo.ListAll()
+				if err != nil {
+					s.logger.Warn("failed to list nginx clusters for metrics", zap.Error(err))
+					continue
+				}
+				for i := range clusters {
+					if clusters[i].Infrastructure.Status != entities.StatusRunning {
+						continue
+					}
+					s.collectClusterMetrics(ctx, &clusters[i])
+				}
+
+				if time.Since(lastPrune) > time.Hour {
+					s.clusterRepo.DeleteMetricSamplesBefore(time.Now().Add(-metricsRetention))
+					lastPrune = time.Now()
+				}
+			}
+		}
+	}()
+}
+
+func (s *nginxClusterService) collectClusterMetrics(ctx context.Context, cluster *entities.NginxCluster) {
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return
+	}
+	for i := range nodes {
+		if !s.checkNodeHealth(ctx, &nodes[i]) {
+			continue
+		}
+		sample, err := s.scrapeNode(ctx, cluster, &nodes[i])
+		if err != nil {
+			s.logger.Debug("failed to scrape nginx node", zap.String("node", nodes[i].Name), zap.Error(err))
+			continue
+		}
+		if err := s.clusterRepo.CreateMetricSample(sample); err != nil {
+			s.logger.Warn("failed to store nginx metrics", zap.String("node", nodes[i].Name), zap.Error(err))
+		}
+	}
+}
+
+// scrapeNode reads stub_status and the access log lines written since the previous scrape
+func (s *nginxClusterService) scrapeNode(ctx context.Context, cluster *entities.NginxCluster, node *entities.NginxNode) (*entities.NginxMetricSample, error) {
+	now := time.Now()
+	var out bytes.Buffer
+	probe := []string{"wget", "-q", "-T", "3", "-O", "-", nginxStubStatusEndpoint}
+	if err := s.dockerSvc.ExecStream(ctx, node.ContainerID, probe, nil, &out); err != nil {
+		return nil, fmt.Errorf("stub_status: %w", err)
+	}
+	status := parseStubStatus(out.String())
+
+	s.metricsMu.Lock()
+	if s.lastScrape == nil {
+		s.lastScrape = make(map[string]nodeScrape)
+	}
+	prev, seen := s.lastScrape[node.ID]
+	s.lastScrape[node.ID] = nodeScrape{at: now, requests: status.requests}
+	s.metricsMu.Unlock()
+
+	since := now.Add(-metricsCollectInterval)
+	if seen {
+		since = prev.at
+	}
+	window := now.Sub(since).Seconds()
+
+	sample := &entities.NginxMetricSample{
+		ID:            uuid.New().String(),
+		ClusterID:     cluster.ID,
+		NodeID:        node.ID,
+		NodeName:      node.Name,
+		CollectedAt:   now,
+		WindowSeconds: window,
+		ActiveConns:   status.active,
+		Reading:       status.reading,
+		Writing:       status.writing,
+		Waiting:       status.waiting,
+		Accepts:       status.accepts,
+		Handled:       status.handled,
+		Requests:      status.requests,
+	}
+	// A lower counter means nginx restarted since the previous scrape
+	if seen && status.requests >= prev.requests {
+		sample.RequestsPerSec = float64(status.requests-prev.requests) / window
+	}
+
+	if cluster.AccessLogEnabled {
+		lines, err := s.dockerSvc.GetContainerLogsRange(ctx, node.ContainerID, since, now)
+		if err != nil {
+			s.logger.Debug("failed to read access log", zap.String("node", node.Name), zap.Error(err))
+		}
+		stats := parseAccessLog(lines)
+		sample.LoggedRequests = stats.requests
+		sample.Status1xx = stats.statuses[0]
+		sample.Status2xx = stats.statuses[1]
+		sample.Status3xx = stats.statuses[2]
+		sample.Status4xx = stats.statuses[3]
+		sample.Status5xx = stats.statuses[4]
+		sample.RequestTimeAvg = average(stats.requestTime)
+		sample.RequestTimeP50, sample.RequestTimeP95, sample.RequestTimeP99 = percentiles(stats.requestTime)
+		sample.UpstreamConnectP50, sample.UpstreamConnectP95, sample.UpstreamConnectP99 = percentiles(stats.upstreamConnect)
+		sample.UpstreamHeaderP50, sample.UpstreamHeaderP95, sample.UpstreamHeaderP99 = percentiles(stats.upstreamHeader)
+		sample.UpstreamResponseP50, sample.UpstreamResponseP95, sample.UpstreamResponseP99 = percentiles(stats.upstreamResponse)
+	}
+	return sample, nil
+}
+
+// GetClusterMetrics returns the latest sample of every node and cluster totals
+func (s *nginxClusterService) GetClusterMetrics(ctx context.Context, clusterID string) (*dto.NginxClusterMetricsResponse, error) {
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	result := &dto.NginxClusterMetricsResponse{
+		ClusterID:   clusterID,
+		NodeMetrics: make([]dto.NginxNodeMetrics, 0, len(nodes)),
+	}
+	var latencySum float64
+	var latencyCount int64
+	for _, node := range nodes {
+		sample, err := s.clusterRepo.FindLatestMetricSample(node.ID)
+		if err != nil {
+			// Not scraped yet
+			result.NodeMetrics = append(result.NodeMetrics, dto.NginxNodeMetrics{
+				NodeID:   node.ID,
+				NodeName: node.Name,
+				Role:     node.Role,
+			})
+			continue
+		}
+		metrics := toNodeMetrics(sample)
+		metrics.Role = node.Role
+		result.NodeMetrics = append(result.NodeMetrics, metrics)
+
+		result.TotalRequests += sample.Requests
+		result.RequestsPerSec += sample.RequestsPerSec
+		result.ActiveConns += sample.ActiveConns
+		result.Status2xx += sample.Status2xx
+		result.Status3xx += sample.Status3xx
+		result.Status4xx += sample.Status4xx
+		result.Status5xx += sample.Status5xx
+		latencySum += sample.RequestTimeAvg * float64(sample.LoggedRequests)
+		latencyCount += sample.LoggedRequests
+	}
+	if latencyCount > 0 {
+		result.AvgLatencyMs = round2(latencySum / float64(latencyCount))
+	}
+	result.RequestsPerSec = round2(result.RequestsPerSec)
+	return result, nil
+}
+
+// GetMetricsHistory returns the stored samples of a cluster between from and to, newest first
+func (s *nginxClusterService) GetMetricsHistory(ctx context.Context, clusterID, nodeID string, from, to time.Time, limit int) (*dto.NginxMetricsHistoryResponse, error) {
+	if _, err := s.clusterRepo.FindByID(clusterID); err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-metricsHistoryRange)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	if limit <= 0 {
+		limit = metricsHistoryLimit
+	}
+	if limit > metricsHistoryMaxLimit {
+		limit = metricsHistoryMaxLimit
+	}
+
+	samples, err := s.clusterRepo.ListMetricSamples(clusterID, nodeID, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metric samples: %w", err)
+	}
+	result := &dto.NginxMetricsHistoryResponse{
+		ClusterID: clusterID,
+		From:      from.Format(time.RFC3339),
+		To:        to.Format(time.RFC3339),
+		Samples:   make([]dto.NginxNodeMetrics, 0, len(samples)),
+	}
+	for i := range samples {
+		result.Samples = append(result.Samples, toNodeMetrics(&samples[i]))
+	}
+	return result, nil
+}
+
+func toNodeMetrics(sample *entities.NginxMetricSample) dto.NginxNodeMetrics {
+	return dto.NginxNodeMetrics{
+		NodeID:         sample.NodeID,
+		NodeName:       sample.NodeName,
+		CollectedAt:    sample.CollectedAt.Format(time.RFC3339),
+		WindowSeconds:  round2(sample.WindowSeconds),
+		TotalRequests:  sample.Requests,
+		RequestsPerSec: round2(sample.RequestsPerSec),
+		ActiveConns:    sample.ActiveConns,
+		Reading:        sample.Reading,
+		Writing:        sample.Writing,
+		Waiting:        sample.Waiting,
+		Accepts:        sample.Accepts,
+		Handled:        sample.Handled,
+		LoggedRequests: sample.LoggedRequests,
+		Status1xx:      sample.Status1xx,
+		Status2xx:      sample.Status2xx,
+		Status3xx:      sample.Status3xx,
+		Status4xx:      sample.Status4xx,
+		Status5xx:      sample.Status5xx,
+		AvgLatencyMs:   sample.RequestTimeAvg,
+		RequestTime: dto.LatencyPercentiles{
+			P50: sample.RequestTimeP50, P95: sample.RequestTimeP95, P99: sample.RequestTimeP99,
+		},
+		UpstreamConnect: dto.LatencyPercentiles{
+			P50: sample.UpstreamConnectP50, P95: sample.UpstreamConnectP95, P99: sample.UpstreamConnectP99,
+		},
+		UpstreamHeader: dto.LatencyPercentiles{
+			P50: sample.UpstreamHeaderP50, P95: sample.UpstreamHeaderP95, P99: sample.UpstreamHeaderP99,
+		},
+		UpstreamResponse: dto.LatencyPercentiles{
+			P50: sample.UpstreamResponseP50, P95: sample.UpstreamResponseP95, P99: sample.UpstreamResponseP99,
+		},
+	}
+}
+
+// parseStubStatus parses the ngx_http_stub_status_module page:
+//
+//	Active connections: 2
+//	server accepts handled requests
+//	 16 16 31
+//	Reading: 0 Writing: 1 Waiting: 1
+func parseStubStatus(body string) stubStatus {
+	var status stubStatus
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Active connections:"):
+			status.active, _ = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Active connections:")))
+		case strings.HasPrefix(line, "server accepts handled requests") && i+1 < len(lines):
+			fields := strings.Fields(lines[i+1])
+			if len(fields) >= 3 {
+				status.accepts, _ = strconv.ParseInt(fields[0], 10, 64)
+				status.handled, _ = strconv.ParseInt(fields[1], 10, 64)
+				status.requests, _ = strconv.ParseInt(fields[2], 10, 64)
+			}
+		case strings.HasPrefix(line, "Reading:"):
+			fields := strings.Fields(line)
+			if len(fields) >= 6 {
+				status.reading, _ = strconv.Atoi(fields[1])
+				status.writing, _ = strconv.Atoi(fields[3])
+				status.waiting, _ = strconv.Atoi(fields[5])
+			}
+		}
+	}
+	return status
+}
+
+// parseAccessLog aggregates access log lines; other container output (error log, keepalived) is skipped
+func parseAccessLog(lines []string) accessLogStats {
+	var stats accessLogStats
+	for _, line := range lines {
+		match := accessLogPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		stats.requests++
+		if code, err := strconv.Atoi(match[1]); err == nil && code >= 100 && code < 600 {
+			stats.statuses[code/100-1]++
+		}
+		if rt, err := strconv.ParseFloat(match[2], 64); err == nil {
+			stats.requestTime = append(stats.requestTime, rt*1000)
+		}
+		if v, ok := parseUpstreamTime(match[3]); ok {
+			stats.upstreamConnect = append(stats.upstreamConnect, v)
+		}
+		if v, ok := parseUpstreamTime(match[4]); ok {
+			stats.upstreamHeader = append(stats.upstreamHeader, v)
+		}
+		if v, ok := parseUpstreamTime(match[5]); ok {
+			stats.upstreamResponse = append(stats.upstreamResponse, v)
+		}
+	}
+	return stats
+}
+
+// parseUpstreamTime converts an upstream timing to milliseconds. nginx logs "-" when no upstream
+// was involved and one value per tried server ("0.001, 0.004" or "0.001 : 0.004"); the last one
+// is the server that answered.
+func parseUpstreamTime(value string) (float64, bool) {
+	fields := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ':' || r == ' ' })
+	if len(fields) == 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return v * 1000, true
+}
+
+// percentiles returns p50, p95 and p99 by nearest rank
+func percentiles(values []float64) (float64, float64, float64) {
+	if len(values) == 0 {
+		return 0, 0, 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := func(p float64) float64 {
+		index := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		if index < 0 {
+			index = 0
+		}
+		return round2(sorted[index])
+	}
+	return rank(50), rank(95), rank(99)
+}
+
+func average(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return round2(sum / float64(len(values)))
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
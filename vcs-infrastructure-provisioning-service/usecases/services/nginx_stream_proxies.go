@@ -0,0 +1,515 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+const (
+	streamProtocolTCP = "tcp"
+	streamProtocolUDP = "udp"
+
+	defaultStreamConnectTimeout = 10  // seconds
+	defaultStreamTimeout        = 600 // seconds
+	streamPortSearchRange       = 100 // host ports tried from the preferred one
+)
+
+var streamNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ListStreamProxies lists the TCP/UDP proxies of a cluster with the host ports of every node
+func (s *nginxClusterService) ListStreamProxies(ctx context.Context, clusterID string) ([]dto.NginxStreamProxyInfo, error) {
+	if _, err := s.clusterRepo.FindByID(clusterID); err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	streams, err := s.clusterRepo.ListStreamProxies(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	ports := s.streamPortInfos(clusterID)
+	result := make([]dto.NginxStreamProxyInfo, 0, len(streams))
+	for _, stream := range streams {
+		servers, _ := s.clusterRepo.ListStreamServers(stream.ID)
+		result = append(result, toStreamProxyInfo(stream, servers, ports[stream.ID]))
+	}
+	return result, nil
+}
+
+// AddStreamProxy adds a TCP/UDP proxy, applies the regenerated config and publishes its port on
+// every node. The proxy is removed again when nginx rejects the config.
+func (s *nginxClusterService) AddStreamProxy(ctx context.Context, userID, clusterID string, req dto.AddNginxStreamProxyRequest) (*dto.NginxStreamProxyInfo, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+
+	stream := &entities.NginxStreamProxy{
+		ID:             uuid.New().String(),
+		ClusterID:      clusterID,
+		Name:           req.Name,
+		Protocol:       req.Protocol,
+		ListenPort:     req.ListenPort,
+		HostPort:       req.HostPort,
+		Algorithm:      req.Algorithm,
+		ConnectTimeout: req.ConnectTimeout,
+		Timeout:        req.Timeout,
+		TLSEnabled:     req.TLSEnabled,
+		SSLCertID:      req.SSLCertID,
+	}
+	servers := toStreamServers(stream.ID, req.Servers)
+	if err := s.validateStreamProxy(cluster, stream, servers); err != nil {
+		return nil, err
+	}
+
+	if err := s.clusterRepo.CreateStreamProxy(stream); err != nil {
+		return nil, fmt.Errorf("failed to save stream proxy: %w", err)
+	}
+	for i := range servers {
+		s.clusterRepo.CreateStreamServer(&servers[i])
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "add stream "+stream.Name); err != nil {
+		s.clusterRepo.DeleteStreamServersByStreamID(stream.ID)
+		s.clusterRepo.DeleteStreamProxy(stream.ID)
+		return nil, err
+	}
+	if err := s.publishStreamPorts(ctx, clusterID); err != nil {
+		return nil, fmt.Errorf("stream %s is configured but not published on every node: %w", stream.Name, err)
+	}
+
+	info := toStreamProxyInfo(*stream, servers, s.streamPortInfos(clusterID)[stream.ID])
+	return &info, nil
+}
+
+// UpdateStreamProxy replaces a stream proxy; the previous version is restored when nginx rejects
+// the result. Changing the port or protocol moves the published host ports as well.
+func (s *nginxClusterService) UpdateStreamProxy(ctx context.Context, userID, clusterID, streamID string, req dto.UpdateNginxStreamProxyRequest) (*dto.NginxStreamProxyInfo, error) {
+	cluster, stream, err := s.findStreamProxy(clusterID, streamID)
+	if err != nil {
+		return nil, err
+	}
+	previous := *stream
+	previousServers, _ := s.clusterRepo.ListStreamServers(streamID)
+
+	stream.Name = req.Name
+	stream.Protocol = req.Protocol
+	stream.ListenPort = req.ListenPort
+	stream.HostPort = req.HostPort
+	stream.Algorithm = req.Algorithm
+	stream.ConnectTimeout = req.ConnectTimeout
+	stream.Timeout = req.Timeout
+	stream.TLSEnabled = req.TLSEnabled
+	stream.SSLCertID = req.SSLCertID
+	servers := toStreamServers(stream.ID, req.Servers)
+	if err := s.validateStreamProxy(cluster, stream, servers); err != nil {
+		return nil, err
+	}
+
+	if err := s.clusterRepo.UpdateStreamProxy(stream); err != nil {
+		return nil, fmt.Errorf("failed to save stream proxy: %w", err)
+	}
+	s.clusterRepo.DeleteStreamServersByStreamID(streamID)
+	for i := range servers {
+		s.clusterRepo.CreateStreamServer(&servers[i])
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "update stream "+stream.Name); err != nil {
+		if restoreErr := s.clusterRepo.UpdateStreamProxy(&previous); restoreErr != nil {
+			s.logger.Error("failed to restore stream proxy", zap.String("stream_id", streamID), zap.Error(restoreErr))
+		}
+		s.clusterRepo.DeleteStreamServersByStreamID(streamID)
+		for i := range previousServers {
+			s.clusterRepo.CreateStreamServer(&previousServers[i])
+		}
+		return nil, err
+	}
+
+	if stream.ListenPort != previous.ListenPort || stream.Protocol != previous.Protocol || stream.HostPort != previous.HostPort {
+		s.clusterRepo.DeleteStreamPortsByStreamID(streamID)
+	}
+	if err := s.publishStreamPorts(ctx, clusterID); err != nil {
+		return nil, fmt.Errorf("stream %s is configured but not published on every node: %w", stream.Name, err)
+	}
+
+	info := toStreamProxyInfo(*stream, servers, s.streamPortInfos(clusterID)[stream.ID])
+	return &info, nil
+}
+
+// DeleteStreamProxy removes a stream proxy and unpublishes its host ports
+func (s *nginxClusterService) DeleteStreamProxy(ctx context.Context, userID, clusterID, streamID string) error {
+	_, stream, err := s.findStreamProxy(clusterID, streamID)
+	if err != nil {
+		return err
+	}
+	servers, _ := s.clusterRepo.ListStreamServers(streamID)
+
+	s.clusterRepo.DeleteStreamServersByStreamID(streamID)
+	if err := s.clusterRepo.DeleteStreamProxy(streamID); err != nil {
+		return fmt.Errorf("failed to delete stream proxy: %w", err)
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, "delete stream "+stream.Name); err != nil {
+		if restoreErr := s.clusterRepo.CreateStreamProxy(stream); restoreErr != nil {
+			s.logger.Error("failed to restore stream proxy", zap.String("stream_id", streamID), zap.Error(restoreErr))
+		}
+		for i := range servers {
+			s.clusterRepo.CreateStreamServer(&servers[i])
+		}
+		return err
+	}
+
+	s.clusterRepo.DeleteStreamPortsByStreamID(streamID)
+	return s.publishStreamPorts(ctx, clusterID)
+}
+
+// validateStreamProxy fills in defaults and rejects listen ports that clash with the HTTP/HTTPS
+// ports of the nodes, a server block or another stream of the cluster
+func (s *nginxClusterService) validateStreamProxy(cluster *entities.NginxCluster, stream *entities.NginxStreamProxy, servers []entities.NginxStreamServer) error {
+	if !streamNamePattern.MatchString(stream.Name) {
+		return fmt.Errorf("invalid stream name %q (allowed: letters, digits, _ . -)", stream.Name)
+	}
+	if stream.Protocol == "" {
+		stream.Protocol = streamProtocolTCP
+	}
+	if stream.Protocol != streamProtocolTCP && stream.Protocol != streamProtocolUDP {
+		return fmt.Errorf("invalid protocol %q (allowed: tcp, udp)", stream.Protocol)
+	}
+	if stream.Algorithm == "" {
+		stream.Algorithm = "round_robin"
+	}
+	if stream.Algorithm != "round_robin" && stream.Algorithm != "least_conn" && stream.Algorithm != "hash" {
+		return fmt.Errorf("invalid algorithm %q (allowed: round_robin, least_conn, hash)", stream.Algorithm)
+	}
+	if stream.ConnectTimeout < 0 || stream.Timeout < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	if stream.ConnectTimeout == 0 {
+		stream.ConnectTimeout = defaultStreamConnectTimeout
+	}
+	if stream.Timeout == 0 {
+		stream.Timeout = defaultStreamTimeout
+	}
+	if stream.ListenPort < 1 || stream.ListenPort > 65535 {
+		return fmt.Errorf("listen port %d out of range", stream.ListenPort)
+	}
+	if stream.TLSEnabled {
+		if stream.Protocol == streamProtocolUDP {
+			return fmt.Errorf("TLS termination is only supported for tcp streams")
+		}
+		if _, _, err := s.certificateFiles(cluster, stream.SSLCertID, "stream "+stream.Name); err != nil {
+			return err
+		}
+	}
+	for _, server := range servers {
+		if err := nginxServerAddress("stream server", server.Address); err != nil {
+			return err
+		}
+		if server.IsBackup && stream.Algorithm == "hash" {
+			return fmt.Errorf("stream %s: backup servers cannot be used with hash", stream.Name)
+		}
+	}
+	if len(servers) == 0 {
+		return fmt.Errorf("stream %s needs at least one server", stream.Name)
+	}
+
+	// Node containers publish 80 and 443 for HTTP/HTTPS; server blocks listen on their own ports
+	if stream.ListenPort == 80 || stream.ListenPort == 443 {
+		return fmt.Errorf("listen port %d is reserved for HTTP/HTTPS", stream.ListenPort)
+	}
+	blocks, err := s.clusterRepo.ListServerBlocks(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list server blocks: %w", err)
+	}
+	for _, block := range blocks {
+		if serverBlockPort(block.ListenPort, block.SSLEnabled) == stream.ListenPort {
+			return fmt.Errorf("listen port %d is used by server block %s", stream.ListenPort, block.ServerName)
+		}
+	}
+	streams, err := s.clusterRepo.ListStreamProxies(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list stream proxies: %w", err)
+	}
+	for _, other := range streams {
+		if other.ID == stream.ID {
+			continue
+		}
+		if other.Name == stream.Name {
+			return fmt.Errorf("stream %s already exists", stream.Name)
+		}
+		if other.ListenPort == stream.ListenPort && other.Protocol == stream.Protocol {
+			return fmt.Errorf("listen port %d/%s is used by stream %s", stream.ListenPort, stream.Protocol, other.Name)
+		}
+	}
+	return nil
+}
+
+// checkServerBlockPort rejects a server block port a tcp stream of the cluster already listens on
+func (s *nginxClusterService) checkServerBlockPort(clusterID string, listenPort int, ssl bool) error {
+	port := serverBlockPort(listenPort, ssl)
+	streams, err := s.clusterRepo.ListStreamProxies(clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to list stream proxies: %w", err)
+	}
+	for _, stream := range streams {
+		if stream.Protocol == streamProtocolTCP && stream.ListenPort == port {
+			return fmt.Errorf("port %d is used by stream %s", port, stream.Name)
+		}
+	}
+	return nil
+}
+
+// publishStreamPorts makes every node publish the host ports of the cluster's stream proxies and
+// nothing else. Containers whose bindings differ are recreated, backups first so the VIP moves once.
+func (s *nginxClusterService) publishStreamPorts(ctx context.Context, clusterID string) error {
+	defer s.lockConfig(clusterID)()
+
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return fmt.Errorf("cluster not found: %w", err)
+	}
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	streams, err := s.clusterRepo.ListStreamProxies(clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to list stream proxies: %w", err)
+	}
+	reserved := s.reservedHostPorts(nodes)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].ID != cluster.MasterNodeID && nodes[j].ID == cluster.MasterNodeID
+	})
+
+	failedNodes := []string{}
+	for i := range nodes {
+		node := &nodes[i]
+		ports, err := s.nodePorts(node, streams, reserved)
+		if err != nil {
+			return err
+		}
+		inspect, err := s.dockerSvc.InspectContainer(ctx, node.ContainerID)
+		if err != nil {
+			s.logger.Error("failed to inspect nginx node", zap.String("node", node.Name), zap.Error(err))
+			failedNodes = append(failedNodes, node.Name)
+			continue
+		}
+		config := containerConfigFromInspect(ctx, s.dockerSvc, inspect, cluster.NetworkID)
+		if samePortBindings(config.Ports, ports) {
+			continue
+		}
+
+		s.logger.Info("recreating nginx node to publish stream ports", zap.String("node", node.Name))
+		config.Ports = ports
+		if err := s.recreateNginxNode(ctx, cluster, node, config); err != nil {
+			s.logger.Error("failed to publish stream ports", zap.String("node", node.Name), zap.Error(err))
+			failedNodes = append(failedNodes, node.Name)
+		}
+	}
+	if len(failedNodes) > 0 {
+		return fmt.Errorf("failed to publish stream ports on nodes: %s", strings.Join(failedNodes, ", "))
+	}
+	return nil
+}
+
+// nodePorts is the port map a node container should publish: HTTP/HTTPS plus one host port per
+// stream proxy, allocated on first use
+func (s *nginxClusterService) nodePorts(node *entities.NginxNode, streams []entities.NginxStreamProxy, reserved map[int]bool) (map[string]string, error) {
+	ports := map[string]string{"80": strconv.Itoa(node.HTTPPort)}
+	if node.HTTPSPort > 0 {
+		ports["443"] = strconv.Itoa(node.HTTPSPort)
+	}
+
+	existing, err := s.clusterRepo.ListStreamPortsByNode(node.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stream ports: %w", err)
+	}
+	hostPorts := make(map[string]int, len(existing))
+	for _, port := range existing {
+		hostPorts[port.StreamID] = port.HostPort
+	}
+
+	for _, stream := range streams {
+		hostPort, ok := hostPorts[stream.ID]
+		if !ok {
+			hostPort, err = s.allocateStreamHostPort(&stream, reserved)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.clusterRepo.CreateStreamPort(&entities.NginxStreamPort{
+				ID:       uuid.New().String(),
+				StreamID: stream.ID,
+				NodeID:   node.ID,
+				Protocol: stream.Protocol,
+				HostPort: hostPort,
+			}); err != nil {
+				return nil, fmt.Errorf("failed to save stream port: %w", err)
+			}
+		}
+		ports[streamPortKey(&stream)] = strconv.Itoa(hostPort)
+	}
+	return ports, nil
+}
+
+// allocateStreamHostPort finds a free host port from the stream's preferred port upwards
+func (s *nginxClusterService) allocateStreamHostPort(stream *entities.NginxStreamProxy, reserved map[int]bool) (int, error) {
+	start := stream.HostPort
+	if start == 0 {
+		start = stream.ListenPort
+	}
+	for port := start; port < start+streamPortSearchRange && port <= 65535; port++ {
+		if reserved[port] {
+			continue
+		}
+		available := s.isPortAvailable(port)
+		if stream.Protocol == streamProtocolUDP {
+			available = isUDPPortAvailable(port)
+		}
+		if available {
+			reserved[port] = true
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free host port for stream %s in %d-%d", stream.Name, start, start+streamPortSearchRange-1)
+}
+
+// reservedHostPorts collects the host ports already handed out to the cluster's nodes and to
+// stream proxies of any cluster, whether or not a container publishes them right now
+func (s *nginxClusterService) reservedHostPorts(nodes []entities.NginxNode) map[int]bool {
+	reserved := map[int]bool{}
+	for _, node := range nodes {
+		reserved[node.HTTPPort] = true
+		if node.HTTPSPort > 0 {
+			reserved[node.HTTPSPort] = true
+		}
+	}
+	if ports, err := s.clusterRepo.ListStreamPorts(); err == nil {
+		for _, port := range ports {
+			reserved[port.HostPort] = true
+		}
+	}
+	return reserved
+}
+
+// streamPortInfos groups the published host ports of a cluster by stream
+func (s *nginxClusterService) streamPortInfos(clusterID string) map[string][]dto.NginxStreamPortInfo {
+	result := map[string][]dto.NginxStreamPortInfo{}
+	nodes, _ := s.clusterRepo.ListNodes(clusterID)
+	for _, node := range nodes {
+		ports, _ := s.clusterRepo.ListStreamPortsByNode(node.ID)
+		for _, port := range ports {
+			result[port.StreamID] = append(result[port.StreamID], dto.NginxStreamPortInfo{
+				NodeID:   node.ID,
+				NodeName: node.Name,
+				HostPort: port.HostPort,
+			})
+		}
+	}
+	return result
+}
+
+func (s *nginxClusterService) findStreamProxy(clusterID, streamID string) (*entities.NginxCluster, *entities.NginxStreamProxy, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	stream, err := s.clusterRepo.FindStreamProxyByID(streamID)
+	if err != nil || stream.ClusterID != clusterID {
+		return nil, nil, fmt.Errorf("stream proxy not found")
+	}
+	return cluster, stream, nil
+}
+
+// streamPortKey is the container port of a stream in docker.ContainerConfig.Ports
+func streamPortKey(stream *entities.NginxStreamProxy) string {
+	if stream.Protocol == streamProtocolUDP {
+		return fmt.Sprintf("%d/udp", stream.ListenPort)
+	}
+	return strconv.Itoa(stream.ListenPort)
+}
+
+// serverBlockPort is the port a server block listens on inside the node containers
+func serverBlockPort(listenPort int, ssl bool) int {
+	if listenPort > 0 {
+		return listenPort
+	}
+	if ssl {
+		return 443
+	}
+	return 80
+}
+
+func samePortBindings(current, desired map[string]string) bool {
+	if len(current) != len(desired) {
+		return false
+	}
+	for port, hostPort := range desired {
+		if current[port] != hostPort {
+			return false
+		}
+	}
+	return true
+}
+
+func isUDPPortAvailable(port int) bool {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func toStreamServers(streamID string, servers []dto.NginxStreamServer) []entities.NginxStreamServer {
+	result := make([]entities.NginxStreamServer, 0, len(servers))
+	for _, srv := range servers {
+		result = append(result, entities.NginxStreamServer{
+			ID:          uuid.New().String(),
+			StreamID:    streamID,
+			Address:     srv.Address,
+			Weight:      srv.Weight,
+			MaxFails:    srv.MaxFails,
+			FailTimeout: srv.FailTimeout,
+			IsBackup:    srv.IsBackup,
+		})
+	}
+	return result
+}
+
+func toStreamProxyInfo(stream entities.NginxStreamProxy, servers []entities.NginxStreamServer, ports []dto.NginxStreamPortInfo) dto.NginxStreamProxyInfo {
+	info := dto.NginxStreamProxyInfo{
+		ID:             stream.ID,
+		Name:           stream.Name,
+		Protocol:       stream.Protocol,
+		ListenPort:     stream.ListenPort,
+		Algorithm:      stream.Algorithm,
+		ConnectTimeout: stream.ConnectTimeout,
+		Timeout:        stream.Timeout,
+		TLSEnabled:     stream.TLSEnabled,
+		SSLCertID:      stream.SSLCertID,
+		Servers:        make([]dto.NginxStreamServer, 0, len(servers)),
+		Ports:          ports,
+		CreatedAt:      stream.CreatedAt.Format(time.RFC3339),
+	}
+	for _, server := range servers {
+		info.Servers = append(info.Servers, dto.NginxStreamServer{
+			Address:     server.Address,
+			Weight:      server.Weight,
+			MaxFails:    server.MaxFails,
+			FailTimeout: server.FailTimeout,
+			IsBackup:    server.IsBackup,
+		})
+	}
+	if info.Ports == nil {
+		info.Ports = []dto.NginxStreamPortInfo{}
+	}
+	return info
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+const trafficPolicyHistoryLimit = 20
+
+// trafficPolicySnapshot is what a traffic policy revision stores, enough to restore the location routing
+type trafficPolicySnapshot struct {
+	ProxyPass string                 `json:"proxy_pass"`
+	Policy    dto.NginxTrafficPolicy `json:"policy"`
+}
+
+// GetTrafficPolicy returns the traffic policy of a location and its latest versions
+func (s *nginxClusterService) GetTrafficPolicy(ctx context.Context, clusterID, blockID, locationID string) (*dto.NginxTrafficPolicyInfo, error) {
+	location, err := s.findLocation(clusterID, blockID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	return s.trafficPolicyInfo(clusterID, location), nil
+}
+
+// SetTrafficPolicy replaces the traffic policy of a location, e.g. to start or ramp up a canary
+func (s *nginxClusterService) SetTrafficPolicy(ctx context.Context, userID, clusterID, blockID, locationID string, req dto.SetNginxTrafficPolicyRequest) (*dto.NginxTrafficPolicyInfo, error) {
+	location, err := s.findLocation(clusterID, blockID, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := req.NginxTrafficPolicy
+	if policy.Mode == trafficModeBlueGreen && policy.ActiveUpstream == "" {
+		policy.ActiveUpstream = location.ProxyPass
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = describeTrafficPolicy(location.ProxyPass, policy)
+	}
+	if err := s.applyTrafficPolicy(ctx, userID, clusterID, location, location.ProxyPass, policy, reason); err != nil {
+		return nil, err
+	}
+	return s.trafficPolicyInfo(clusterID, location), nil
+}
+
+// SwitchTraffic atomically moves a blue/green location to the upstream that is not serving traffic
+func (s *nginxClusterService) SwitchTraffic(ctx context.Context, userID, clusterID, blockID, locationID string, req dto.SwitchNginxTrafficRequest) (*dto.NginxTrafficPolicyInfo, error) {
+	location, err := s.findLocation(clusterID, blockID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	if location.TrafficMode != trafficModeBlueGreen {
+		return nil, fmt.Errorf("location %s has no blue/green traffic policy", location.Path)
+	}
+
+	policy := toTrafficPolicy(*location)
+	if policy.ActiveUpstream == location.SecondaryUpstream {
+		policy.ActiveUpstream = location.ProxyPass
+	} else {
+		policy.ActiveUpstream = location.SecondaryUpstream
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = "switch traffic to " + policy.ActiveUpstream
+	}
+	if err := s.applyTrafficPolicy(ctx, userID, clusterID, location, location.ProxyPass, policy, reason); err != nil {
+		return nil, err
+	}
+	return s.trafficPolicyInfo(clusterID, location), nil
+}
+
+// RollbackTrafficPolicy restores an earlier traffic policy version as a new version
+func (s *nginxClusterService) RollbackTrafficPolicy(ctx context.Context, userID, clusterID, blockID, locationID string, req dto.RollbackNginxTrafficPolicyRequest) (*dto.NginxTrafficPolicyInfo, error) {
+	location, err := s.findLocation(clusterID, blockID, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	version := req.Version
+	if version == 0 {
+		version = location.TrafficVersion - 1
+	}
+	if version <= 0 || version >= location.TrafficVersion {
+		return nil, fmt.Errorf("no earlier traffic policy version to roll back to")
+	}
+	revision, err := s.clusterRepo.FindTrafficPolicyRevision(locationID, version)
+	if err != nil {
+		return nil, fmt.Errorf("traffic policy version %d not found", version)
+	}
+	var snapshot trafficPolicySnapshot
+	if err := json.Unmarshal([]byte(revision.Policy), &snapshot); err != nil {
+		return nil, fmt.Errorf("traffic policy version %d is unreadable: %w", version, err)
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("roll back traffic policy to version %d", version)
+	}
+	if err := s.applyTrafficPolicy(ctx, userID, clusterID, location, snapshot.ProxyPass, snapshot.Policy, reason); err != nil {
+		return nil, err
+	}
+	return s.trafficPolicyInfo(clusterID, location), nil
+}
+
+// applyTrafficPolicy stores the policy as the next version of the location and applies the
+// regenerated config. The previous routing is restored when nginx rejects the result.
+func (s *nginxClusterService) applyTrafficPolicy(ctx context.Context, userID, clusterID string, location *entities.NginxLocation, proxyPass string, policy dto.NginxTrafficPolicy, reason string) error {
+	previous := *location
+
+	location.ProxyPass = proxyPass
+	location.TrafficMode = policy.Mode
+	location.SecondaryUpstream = policy.SecondaryUpstream
+	location.SecondaryWeight = policy.SecondaryWeight
+	location.ActiveUpstream = policy.ActiveUpstream
+	location.StickySplit = policy.Sticky
+	location.RouteHeader = policy.RouteHeader
+	location.RouteHeaderValue = policy.RouteHeaderValue
+	location.RouteCookie = policy.RouteCookie
+	location.RouteCookieValue = policy.RouteCookieValue
+	if location.TrafficMode != trafficModeSplit {
+		location.SecondaryWeight = 0
+		location.StickySplit = false
+	}
+	if location.TrafficMode != trafficModeBlueGreen {
+		location.ActiveUpstream = ""
+	}
+	if location.TrafficMode == "" {
+		location.SecondaryUpstream = ""
+		location.RouteHeader, location.RouteHeaderValue = "", ""
+		location.RouteCookie, location.RouteCookieValue = "", ""
+	}
+	location.TrafficVersion++
+
+	if err := s.validateLocation(clusterID, location); err != nil {
+		*location = previous
+		return err
+	}
+	if err := s.clusterRepo.UpdateLocation(location); err != nil {
+		*location = previous
+		return fmt.Errorf("failed to save location: %w", err)
+	}
+	if err := s.regenerateConfig(ctx, clusterID, userID, fmt.Sprintf("location %s: %s", location.Path, reason)); err != nil {
+		if restoreErr := s.clusterRepo.UpdateLocation(&previous); restoreErr != nil {
+			s.logger.Error("failed to restore location", zap.String("location_id", location.ID), zap.Error(restoreErr))
+		}
+		*location = previous
+		return err
+	}
+
+	snapshot, _ := json.Marshal(trafficPolicySnapshot{ProxyPass: location.ProxyPass, Policy: toTrafficPolicy(*location)})
+	revision := &entities.NginxTrafficPolicyRevision{
+		ID:         uuid.New().String(),
+		ClusterID:  clusterID,
+		LocationID: location.ID,
+		Version:    location.TrafficVersion,
+		Policy:     string(snapshot),
+		Author:     userID,
+		Reason:     truncate(reason, 255),
+	}
+	if cluster, err := s.clusterRepo.FindByID(clusterID); err == nil {
+		revision.ConfigRevision = cluster.ConfigRevision
+	}
+	if err := s.clusterRepo.CreateTrafficPolicyRevision(revision); err != nil {
+		s.logger.Warn("failed to record traffic policy revision", zap.String("location_id", location.ID), zap.Error(err))
+	}
+
+	s.logger.Info("traffic policy applied",
+		zap.String("cluster_id", clusterID),
+		zap.String("location", location.Path),
+		zap.Int("version", location.TrafficVersion),
+		zap.String("reason", reason))
+	return nil
+}
+
+func (s *nginxClusterService) trafficPolicyInfo(clusterID string, location *entities.NginxLocation) *dto.NginxTrafficPolicyInfo {
+	info := &dto.NginxTrafficPolicyInfo{
+		LocationID:      location.ID,
+		Path:            location.Path,
+		PrimaryUpstream: location.ProxyPass,
+		Version:         location.TrafficVersion,
+		Policy:          toTrafficPolicy(*location),
+	}
+	if upstreams, err := s.clusterRepo.ListUpstreams(clusterID); err == nil {
+		for _, upstream := range upstreams {
+			switch upstream.Name {
+			case location.ProxyPass:
+				info.PrimaryVersion = upstream.Version
+			case location.SecondaryUpstream:
+				info.SecondaryVersion = upstream.Version
+			}
+		}
+	}
+
+	revisions, _ := s.clusterRepo.ListTrafficPolicyRevisions(location.ID, trafficPolicyHistoryLimit)
+	for _, revision := range revisions {
+		var snapshot trafficPolicySnapshot
+		json.Unmarshal([]byte(revision.Policy), &snapshot)
+		info.History = append(info.History, dto.NginxTrafficPolicyRevisionInfo{
+			Version:         revision.Version,
+			PrimaryUpstream: snapshot.ProxyPass,
+			Policy:          snapshot.Policy,
+			ConfigRevision:  revision.ConfigRevision,
+			Author:          revision.Author,
+			Reason:          revision.Reason,
+			CreatedAt:       revision.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return info
+}
+
+func toTrafficPolicy(loc entities.NginxLocation) dto.NginxTrafficPolicy {
+	return dto.NginxTrafficPolicy{
+		Mode:              loc.TrafficMode,
+		SecondaryUpstream: loc.SecondaryUpstream,
+		SecondaryWeight:   loc.SecondaryWeight,
+		ActiveUpstream:    loc.ActiveUpstream,
+		Sticky:            loc.StickySplit,
+		RouteHeader:       loc.RouteHeader,
+		RouteHeaderValue:  loc.RouteHeaderValue,
+		RouteCookie:       loc.RouteCookie,
+		RouteCookieValue:  loc.RouteCookieValue,
+	}
+}
+
+// describeTrafficPolicy is the default revision reason for a policy change
+func describeTrafficPolicy(primary string, policy dto.NginxTrafficPolicy) string {
+	switch policy.Mode {
+	case trafficModeSplit:
+		return fmt.Sprintf("send %d%% to %s, rest to %s", policy.SecondaryWeight, policy.SecondaryUpstream, primary)
+	case trafficModeBlueGreen:
+		return fmt.Sprintf("blue/green between %s and %s, active %s", primary, policy.SecondaryUpstream, policy.ActiveUpstream)
+	default:
+		return "remove traffic policy, all traffic to " + primary
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+const (
+	upstreamHealthCheckInterval = 10 * time.Second
+	upstreamHealthProbeTimeout  = 3 // seconds, passed to wget -T
+	upstreamHealthFall          = 3 // consecutive failures before a server is marked down
+	upstreamHealthRise          = 2 // consecutive successes before it is marked up again
+	upstreamHealthHistoryLimit  = 20
+	upstreamHealthRetention     = 7 * 24 * time.Hour
+	upstreamHealthAuthor        = "health-checker"
+
+	upstreamHealthUnknown   = "unknown"
+	upstreamHealthHealthy   = "healthy"
+	upstreamHealthUnhealthy = "unhealthy"
+)
+
+// StartUpstreamHealthChecker probes every upstream server with health checks enabled and
+// ejects servers from the nginx config after repeated failures
+func (s *nginxClusterService) StartUpstreamHealthChecker(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(upstreamHealthCheckInterval)
+		defer ticker.Stop()
+		lastPrune := time.Time{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				clusters, err := s.clusterRepo.ListAll()
+				if err != nil {
+					s.logger.Warn("failed to list nginx clusters for upstream health checks", zap.Error(err))
+					continue
+				}
+				for i := range clusters {
+					if clusters[i].Infrastructure.Status != entities.StatusRunning {
+						continue
+					}
+					s.checkUpstreams(ctx, &clusters[i])
+				}
+
+				if time.Since(lastPrune) > time.Hour {
+					s.clusterRepo.DeleteUpstreamHealthEventsBefore(time.Now().Add(-upstreamHealthRetention))
+					lastPrune = time.Now()
+				}
+			}
+		}
+	}()
+}
+
+// checkUpstreams probes the upstream servers of one cluster and re-renders nginx.conf when a
+// server crossed the fall or rise threshold
+func (s *nginxClusterService) checkUpstreams(ctx context.Context, cluster *entities.NginxCluster) {
+	upstreams, err := s.clusterRepo.ListUpstreams(cluster.ID)
+	if err != nil || len(upstreams) == 0 {
+		return
+	}
+	// Probes run from a node so they see the backends the way nginx does
+	node := s.upstreamProbeNode(ctx, cluster)
+	if node == nil {
+		return
+	}
+
+	var changes []string
+	for _, upstream := range upstreams {
+		servers, err := s.clusterRepo.ListUpstreamServers(upstream.ID)
+		if err != nil {
+			continue
+		}
+		path := upstream.HealthPath
+		if path == "" {
+			path = "/health"
+		}
+		for i := range servers {
+			server := &servers[i]
+			if !upstream.HealthCheck && server.HealthStatus == upstreamHealthUnknown && !server.IsDown {
+				continue
+			}
+			var change string
+			if upstream.HealthCheck {
+				change = s.probeUpstreamServer(ctx, node, server, path)
+			} else {
+				change = resetUpstreamHealth(server)
+			}
+			if err := s.clusterRepo.UpdateUpstreamServerHealth(server); err != nil {
+				s.logger.Warn("failed to save upstream health", zap.String("server", server.Address), zap.Error(err))
+				continue
+			}
+			if change == "" {
+				continue
+			}
+
+			status := "up"
+			if server.IsDown {
+				status = "down"
+			}
+			s.clusterRepo.CreateUpstreamHealthEvent(&entities.NginxUpstreamHealthEvent{
+				ID:         uuid.New().String(),
+				ClusterID:  cluster.ID,
+				UpstreamID: upstream.ID,
+				Address:    server.Address,
+				Status:     status,
+				Reason:     change,
+			})
+			s.publishEvent(ctx, "nginx_cluster.upstream_"+status, cluster.InfrastructureID, cluster.ID, string(entities.StatusRunning))
+			s.logger.Info("upstream server health changed",
+				zap.String("cluster_id", cluster.ID),
+				zap.String("upstream", upstream.Name),
+				zap.String("server", server.Address),
+				zap.String("status", status),
+				zap.String("reason", change))
+			changes = append(changes, fmt.Sprintf("mark %s %s in %s", server.Address, status, upstream.Name))
+		}
+	}
+
+	if len(changes) > 0 {
+		if err := s.regenerateConfig(ctx, cluster.ID, upstreamHealthAuthor, strings.Join(changes, ", ")); err != nil {
+			s.logger.Error("failed to apply upstream health changes", zap.String("cluster_id", cluster.ID), zap.Error(err))
+		}
+	}
+}
+
+// probeUpstreamServer runs one probe and applies the fall/rise thresholds. It returns the reason
+// when the server was marked down or up, and "" otherwise.
+func (s *nginxClusterService) probeUpstreamServer(ctx context.Context, node *entities.NginxNode, server *entities.NginxUpstreamServer, path string) string {
+	url := "http://" + server.Address + path
+	probe := []string{"wget", "-q", "-T", fmt.Sprint(upstreamHealthProbeTimeout), "-O", "/dev/null", url}
+	err := s.dockerSvc.ExecStream(ctx, node.ContainerID, probe, nil, nil)
+
+	now := time.Now()
+	server.LastCheckedAt = &now
+	if err != nil {
+		server.ConsecutiveFailures++
+		server.ConsecutiveSuccesses = 0
+		server.LastError = truncate(strings.TrimSpace(err.Error()), 255)
+		if server.ConsecutiveFailures < upstreamHealthFall || server.HealthStatus == upstreamHealthUnhealthy {
+			return ""
+		}
+		server.HealthStatus = upstreamHealthUnhealthy
+		if server.IsDown {
+			return ""
+		}
+		server.IsDown = true
+		return fmt.Sprintf("%d consecutive failed checks: %s", server.ConsecutiveFailures, server.LastError)
+	}
+
+	server.ConsecutiveSuccesses++
+	server.ConsecutiveFailures = 0
+	server.LastError = ""
+	if server.ConsecutiveSuccesses < upstreamHealthRise || server.HealthStatus == upstreamHealthHealthy {
+		return ""
+	}
+	server.HealthStatus = upstreamHealthHealthy
+	if !server.IsDown {
+		return ""
+	}
+	server.IsDown = false
+	return fmt.Sprintf("%d consecutive successful checks", server.ConsecutiveSuccesses)
+}
+
+// resetUpstreamHealth clears the check state when health checks are off for the upstream,
+// bringing back a server the checker had ejected
+func resetUpstreamHealth(server *entities.NginxUpstreamServer) string {
+	wasDown := server.IsDown
+	server.IsDown = false
+	server.HealthStatus = upstreamHealthUnknown
+	server.ConsecutiveFailures = 0
+	server.ConsecutiveSuccesses = 0
+	server.LastError = ""
+	if wasDown {
+		return "health check disabled"
+	}
+	return ""
+}
+
+// upstreamProbeNode picks the master node, or any running node when the master is unavailable
+func (s *nginxClusterService) upstreamProbeNode(ctx context.Context, cluster *entities.NginxCluster) *entities.NginxNode {
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return nil
+	}
+	for i := range nodes {
+		if nodes[i].ID == cluster.MasterNodeID && s.checkNodeHealth(ctx, &nodes[i]) {
+			return &nodes[i]
+		}
+	}
+	for i := range nodes {
+		if nodes[i].ID != cluster.MasterNodeID && s.checkNodeHealth(ctx, &nodes[i]) {
+			return &nodes[i]
+		}
+	}
+	return nil
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max]
+}
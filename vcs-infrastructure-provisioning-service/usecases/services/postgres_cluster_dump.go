@@ -0,0 +1,323 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"go.uber.org/zap"
+)
+
+// ExportDatabase streams a pg_dump of one database from the leader into w, tracked as an "export" operation
+func (s *postgreSQLClusterService) ExportDatabase(ctx context.Context, clusterID, database string, opts dto.DumpOptions, w io.Writer) error {
+	if opts.Format == "" {
+		opts.Format = "custom"
+	}
+	if opts.SchemaOnly && opts.DataOnly {
+		return fmt.Errorf("schema_only and data_only are mutually exclusive")
+	}
+
+	leader, err := s.extensionTarget(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkDatabaseExists(ctx, leader, database); err != nil {
+		return err
+	}
+
+	op, err := s.startOperation(clusterID, "export", map[string]interface{}{
+		"database":       database,
+		"format":         opts.Format,
+		"tables":         opts.Tables,
+		"exclude_tables": opts.ExcludeTables,
+	})
+	if err != nil {
+		return err
+	}
+	s.setOperationStep(op, 10, fmt.Sprintf("dumping %s", database))
+
+	counter := &countingWriter{w: w}
+	err = s.dockerSvc.ExecStream(ctx, leader.ContainerID, pgDumpCommand(database, opts), nil, counter)
+	s.setOperationDetail(op, "bytes", counter.n)
+	s.finishOperation(op, err)
+	return err
+}
+
+// ImportDatabase spools an uploaded dump to disk and restores it into the leader as a background "import" operation.
+// Custom-format dumps go through pg_restore, plain SQL through psql; objects end up owned by the cluster user.
+func (s *postgreSQLClusterService) ImportDatabase(ctx context.Context, clusterID, database string, req dto.ImportDatabaseRequest, dump io.Reader) (*dto.ClusterOperationInfo, error) {
+	cluster, err := s.writableCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "pg-import-*.dump")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	size, err := io.Copy(file, dump)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to store upload: %w", err)
+	}
+	if size == 0 {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("uploaded dump is empty")
+	}
+
+	header := make([]byte, 5)
+	file.ReadAt(header, 0)
+	format := "plain"
+	if bytes.Equal(header, []byte("PGDMP")) {
+		format = "custom"
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	op, err := s.startOperation(clusterID, "import", map[string]interface{}{
+		"database": database,
+		"format":   format,
+		"bytes":    size,
+		"clean":    req.Clean,
+	})
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	go func() {
+		defer os.Remove(file.Name())
+		defer file.Close()
+		bgCtx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
+		defer cancel()
+		s.finishOperation(op, s.runRestore(bgCtx, op, cluster, database, format, req.Clean, file))
+	}()
+
+	info := toOperationDTO(op)
+	return &info, nil
+}
+
+// CopyDatabase pipes pg_dump of a database in another managed cluster straight into pg_restore on this
+// cluster's leader, e.g. to refresh staging from prod. Runs as a background "copy" operation.
+func (s *postgreSQLClusterService) CopyDatabase(ctx context.Context, clusterID, database string, req dto.CopyDatabaseRequest) (*dto.ClusterOperationInfo, error) {
+	if req.SourceDatabase == "" {
+		req.SourceDatabase = database
+	}
+	if req.SourceClusterID == clusterID && req.SourceDatabase == database {
+		return nil, fmt.Errorf("source and target database are the same")
+	}
+	if req.SchemaOnly && req.DataOnly {
+		return nil, fmt.Errorf("schema_only and data_only are mutually exclusive")
+	}
+
+	cluster, err := s.writableCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	source, err := s.clusterRepo.FindByID(req.SourceClusterID)
+	if err != nil {
+		return nil, fmt.Errorf("source cluster not found: %w", err)
+	}
+	// pg_restore cannot read archives written by a newer pg_dump
+	sourceMajor, _, _ := parsePostgresVersion(source.Version)
+	targetMajor, _, _ := parsePostgresVersion(cluster.Version)
+	if sourceMajor > targetMajor {
+		return nil, fmt.Errorf("cannot copy from PostgreSQL %d into older PostgreSQL %d", sourceMajor, targetMajor)
+	}
+
+	sourceLeader, err := s.extensionTarget(ctx, source.ID)
+	if err != nil {
+		return nil, fmt.Errorf("source cluster: %w", err)
+	}
+	if err := s.checkDatabaseExists(ctx, sourceLeader, req.SourceDatabase); err != nil {
+		return nil, err
+	}
+
+	op, err := s.startOperation(clusterID, "copy", map[string]interface{}{
+		"source_cluster_id": source.ID,
+		"source_database":   req.SourceDatabase,
+		"target_database":   database,
+		"tables":            req.Tables,
+		"exclude_tables":    req.ExcludeTables,
+		"clean":             req.Clean,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		bgCtx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
+		defer cancel()
+		s.finishOperation(op, s.runDatabaseCopy(bgCtx, op, cluster, sourceLeader, database, req))
+	}()
+
+	info := toOperationDTO(op)
+	return &info, nil
+}
+
+func (s *postgreSQLClusterService) runDatabaseCopy(ctx context.Context, op *entities.ClusterOperation, cluster *entities.PostgreSQLCluster, sourceLeader *entities.ClusterNode, database string, req dto.CopyDatabaseRequest) error {
+	opts := dto.DumpOptions{
+		Format:        "custom",
+		Tables:        req.Tables,
+		ExcludeTables: req.ExcludeTables,
+		SchemaOnly:    req.SchemaOnly,
+		DataOnly:      req.DataOnly,
+	}
+
+	reader, writer := io.Pipe()
+	counter := &countingWriter{w: writer}
+	dumpErr := make(chan error, 1)
+	go func() {
+		err := s.dockerSvc.ExecStream(ctx, sourceLeader.ContainerID, pgDumpCommand(req.SourceDatabase, opts), nil, counter)
+		writer.CloseWithError(err)
+		dumpErr <- err
+	}()
+
+	restoreErr := s.runRestore(ctx, op, cluster, database, "custom", req.Clean, reader)
+	// Unblocks pg_dump when the restore stopped reading early
+	reader.CloseWithError(io.ErrClosedPipe)
+
+	err := <-dumpErr
+	s.setOperationDetail(op, "bytes", counter.n)
+	if restoreErr != nil {
+		// A failed dump truncates the archive, so report it alongside the restore failure
+		if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			return fmt.Errorf("%w (pg_dump: %v)", restoreErr, err)
+		}
+		return restoreErr
+	}
+	if err != nil {
+		return fmt.Errorf("pg_dump failed: %w", err)
+	}
+
+	s.publishEvent(ctx, "database.copied", cluster.InfrastructureID, cluster.ID, string(entities.StatusRunning))
+	return nil
+}
+
+// runRestore loads a dump into a database on the current leader, creating the database when missing
+func (s *postgreSQLClusterService) runRestore(ctx context.Context, op *entities.ClusterOperation, cluster *entities.PostgreSQLCluster, database, format string, clean bool, dump io.Reader) error {
+	leader, err := s.extensionTarget(ctx, cluster.ID)
+	if err != nil {
+		return err
+	}
+
+	s.setOperationStep(op, 10, fmt.Sprintf("preparing database %s", database))
+	exists, err := s.databaseExists(ctx, leader, database)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := s.psql(ctx, leader.ContainerID, "postgres",
+			fmt.Sprintf("CREATE DATABASE %s OWNER %s", sqlIdent(database), sqlIdent(cluster.Username))); err != nil {
+			return fmt.Errorf("failed to create database %s: %w", database, err)
+		}
+		s.setOperationDetail(op, "database_created", true)
+	}
+
+	s.setOperationStep(op, 20, fmt.Sprintf("restoring into %s", database))
+	var cmd []string
+	if format == "custom" {
+		cmd = []string{"pg_restore", "-U", "postgres", "-d", database,
+			"--no-owner", "--no-privileges", "--role=" + cluster.Username, "--exit-on-error"}
+		if clean {
+			cmd = append(cmd, "--clean", "--if-exists")
+		}
+	} else {
+		cmd = []string{"psql", "-U", "postgres", "-d", database, "-q", "-v", "ON_ERROR_STOP=1",
+			"-c", "SET ROLE " + sqlIdent(cluster.Username), "-f", "-"}
+	}
+	if err := s.dockerSvc.ExecStream(ctx, leader.ContainerID, cmd, dump, nil); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	// Restored tables have no planner statistics yet
+	s.setOperationStep(op, 90, "analyzing restored tables")
+	if _, err := s.psql(ctx, leader.ContainerID, database, "ANALYZE"); err != nil {
+		s.logger.Warn("analyze after restore failed", zap.String("cluster_id", cluster.ID), zap.String("database", database), zap.Error(err))
+	}
+
+	s.cacheService.InvalidateClusterInfo(ctx, cluster.ID)
+	return nil
+}
+
+// writableCluster returns a running cluster that accepts writes, i.e. not a standby
+func (s *postgreSQLClusterService) writableCluster(clusterID string) (*entities.PostgreSQLCluster, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	if cluster.Infrastructure.Status != entities.StatusRunning {
+		return nil, fmt.Errorf("cluster must be running (status: %s)", cluster.Infrastructure.Status)
+	}
+	if cluster.StandbyOfClusterID != "" {
+		return nil, fmt.Errorf("cluster is a read-only standby of %s", cluster.StandbyOfClusterID)
+	}
+	return cluster, nil
+}
+
+func (s *postgreSQLClusterService) databaseExists(ctx context.Context, node *entities.ClusterNode, database string) (bool, error) {
+	output, err := s.psql(ctx, node.ContainerID, "postgres",
+		fmt.Sprintf("SELECT count(*) FROM pg_database WHERE datname = %s", sqlLiteral(database)))
+	if err != nil {
+		return false, fmt.Errorf("failed to check database: %w", err)
+	}
+	return output != "0", nil
+}
+
+func (s *postgreSQLClusterService) checkDatabaseExists(ctx context.Context, node *entities.ClusterNode, database string) error {
+	exists, err := s.databaseExists(ctx, node, database)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("database %s not found", database)
+	}
+	return nil
+}
+
+// pgDumpCommand builds a pg_dump invocation; ownership and grants are left out so dumps load into any cluster
+func pgDumpCommand(database string, opts dto.DumpOptions) []string {
+	cmd := []string{"pg_dump", "-U", "postgres", "-d", database, "--no-owner", "--no-privileges"}
+	if opts.Format == "plain" {
+		cmd = append(cmd, "--format=plain")
+	} else {
+		cmd = append(cmd, "--format=custom")
+	}
+	for _, table := range opts.Tables {
+		cmd = append(cmd, "--table="+table)
+	}
+	for _, table := range opts.ExcludeTables {
+		cmd = append(cmd, "--exclude-table="+table)
+	}
+	if opts.SchemaOnly {
+		cmd = append(cmd, "--schema-only")
+	}
+	if opts.DataOnly {
+		cmd = append(cmd, "--data-only")
+	}
+	return cmd
+}
+
+// countingWriter counts the bytes passed through to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
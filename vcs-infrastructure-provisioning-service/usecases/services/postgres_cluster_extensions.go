@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"go.uber.org/zap"
+)
+
+// preloadExtensions maps extensions to the library they need in shared_preload_libraries
+var preloadExtensions = map[string]string{
+	"pg_stat_statements": "pg_stat_statements",
+	"pg_cron":            "pg_cron",
+	"pgaudit":            "pgaudit",
+	"timescaledb":        "timescaledb",
+	"citus":              "citus",
+	"pg_wait_sampling":   "pg_wait_sampling",
+	"pg_stat_kcache":     "pg_stat_kcache",
+	"pg_squeeze":         "pg_squeeze",
+}
+
+// ListExtensions returns the extensions shipped in the image and which of them are installed in the database
+func (s *postgreSQLClusterService) ListExtensions(ctx context.Context, clusterID, database string) (*dto.ListExtensionsResponse, error) {
+	leader, err := s.extensionTarget(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	preloaded, err := s.sharedPreloadLibraries(ctx, leader)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := s.psql(ctx, leader.ContainerID, database, `SELECT a.name, coalesce(a.default_version, ''),
+		coalesce(e.extversion, ''), coalesce(n.nspname, ''), coalesce(replace(a.comment, '|', '/'), '')
+		FROM pg_available_extensions a
+		LEFT JOIN pg_extension e ON e.extname = a.name
+		LEFT JOIN pg_namespace n ON n.oid = e.extnamespace
+		ORDER BY a.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list extensions: %w", err)
+	}
+
+	extensions := make([]dto.ExtensionInfo, 0)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) != 5 {
+			continue
+		}
+		library, requiresPreload := preloadExtensions[fields[0]]
+		extensions = append(extensions, dto.ExtensionInfo{
+			Name:             fields[0],
+			DefaultVersion:   fields[1],
+			InstalledVersion: fields[2],
+			Schema:           fields[3],
+			Installed:        fields[2] != "",
+			RequiresPreload:  requiresPreload,
+			Preloaded:        requiresPreload && containsString(preloaded, library),
+			Comment:          fields[4],
+		})
+	}
+
+	return &dto.ListExtensionsResponse{
+		ClusterID:              clusterID,
+		Database:               database,
+		SharedPreloadLibraries: preloaded,
+		Extensions:             extensions,
+	}, nil
+}
+
+// CreateExtension runs CREATE EXTENSION on the leader. Extensions that must be preloaded are added to
+// shared_preload_libraries through the Patroni config first, followed by a tracked rolling restart.
+func (s *postgreSQLClusterService) CreateExtension(ctx context.Context, clusterID, database string, req dto.CreateExtensionRequest) (*dto.ExtensionChangeResponse, error) {
+	leader, err := s.extensionTarget(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	available, err := s.psql(ctx, leader.ContainerID, database,
+		fmt.Sprintf("SELECT count(*) FROM pg_available_extensions WHERE name = %s", sqlLiteral(req.Name)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check extension: %w", err)
+	}
+	if available == "0" {
+		return nil, fmt.Errorf("extension %s is not available in the cluster image", req.Name)
+	}
+
+	response := &dto.ExtensionChangeResponse{
+		ClusterID: clusterID,
+		Database:  database,
+		Extension: req.Name,
+	}
+
+	library, requiresPreload := preloadExtensions[req.Name]
+	if requiresPreload {
+		preloaded, err := s.sharedPreloadLibraries(ctx, leader)
+		if err != nil {
+			return nil, err
+		}
+		if !containsString(preloaded, library) {
+			op, err := s.startOperation(clusterID, "extension", map[string]interface{}{
+				"extension": req.Name,
+				"database":  database,
+				"library":   library,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			libraries := strings.Join(append(preloaded, library), ",")
+			go func() {
+				bgCtx, cancel := context.WithTimeout(context.Background(), 1*time.Hour)
+				defer cancel()
+				s.finishOperation(op, s.runPreloadExtension(bgCtx, op, clusterID, database, libraries, req))
+			}()
+
+			info := toOperationDTO(op)
+			response.Action = "pending"
+			response.RequiresRestart = true
+			response.Operation = &info
+			return response, nil
+		}
+	}
+
+	if _, err := s.psql(ctx, leader.ContainerID, database, createExtensionSQL(req)); err != nil {
+		return nil, fmt.Errorf("failed to create extension: %w", err)
+	}
+
+	s.logger.Info("extension created", zap.String("cluster_id", clusterID), zap.String("database", database), zap.String("extension", req.Name))
+	response.Action = "created"
+	return response, nil
+}
+
+// DropExtension runs DROP EXTENSION on the leader. A preloaded library stays in
+// shared_preload_libraries, removing it would need another restart for no benefit.
+func (s *postgreSQLClusterService) DropExtension(ctx context.Context, clusterID, database, name string, cascade bool) (*dto.ExtensionChangeResponse, error) {
+	leader, err := s.extensionTarget(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("DROP EXTENSION %s", sqlIdent(name))
+	if cascade {
+		query += " CASCADE"
+	}
+	if _, err := s.psql(ctx, leader.ContainerID, database, query); err != nil {
+		return nil, fmt.Errorf("failed to drop extension: %w", err)
+	}
+
+	s.logger.Info("extension dropped", zap.String("cluster_id", clusterID), zap.String("database", database), zap.String("extension", name))
+	return &dto.ExtensionChangeResponse{
+		ClusterID: clusterID,
+		Database:  database,
+		Extension: name,
+		Action:    "dropped",
+	}, nil
+}
+
+func (s *postgreSQLClusterService) runPreloadExtension(ctx context.Context, op *entities.ClusterOperation, clusterID, database, libraries string, req dto.CreateExtensionRequest) error {
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+	leader, err := s.findPatroniLeader(ctx, members)
+	if err != nil {
+		return err
+	}
+
+	s.setOperationStep(op, 10, "updating shared_preload_libraries")
+	patch := map[string]interface{}{
+		"postgresql": map[string]interface{}{
+			"parameters": map[string]interface{}{"shared_preload_libraries": libraries},
+		},
+	}
+	if err := s.patroniPatchConfig(ctx, leader, patch); err != nil {
+		return err
+	}
+
+	s.setOperationStep(op, 20, "waiting for members to pick up the new config")
+	if err := s.waitForPendingRestart(ctx, members); err != nil {
+		return err
+	}
+
+	s.setOperationStep(op, 30, "rolling restart")
+	if err := s.patroniRollingRestart(ctx, op, clusterID, "extension"); err != nil {
+		return err
+	}
+
+	s.setOperationStep(op, 90, fmt.Sprintf("creating extension %s", req.Name))
+	target, err := s.extensionTarget(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.psql(ctx, target.ContainerID, database, createExtensionSQL(req)); err != nil {
+		return fmt.Errorf("failed to create extension: %w", err)
+	}
+
+	s.cacheService.InvalidateClusterInfo(ctx, clusterID)
+	return nil
+}
+
+// extensionTarget returns the current leader, where extension DDL has to run
+func (s *postgreSQLClusterService) extensionTarget(ctx context.Context, clusterID string) (*entities.ClusterNode, error) {
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return s.findPatroniLeader(ctx, patroniMembers(nodes))
+}
+
+// sharedPreloadLibraries returns the libraries currently loaded at server start
+func (s *postgreSQLClusterService) sharedPreloadLibraries(ctx context.Context, node *entities.ClusterNode) ([]string, error) {
+	output, err := s.psql(ctx, node.ContainerID, "postgres", "SHOW shared_preload_libraries")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shared_preload_libraries: %w", err)
+	}
+	libraries := make([]string, 0)
+	for _, library := range strings.Split(output, ",") {
+		if library = strings.Trim(strings.TrimSpace(library), `"`); library != "" {
+			libraries = append(libraries, library)
+		}
+	}
+	return libraries, nil
+}
+
+func createExtensionSQL(req dto.CreateExtensionRequest) string {
+	query := fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s", sqlIdent(req.Name))
+	if req.Schema != "" {
+		query += " SCHEMA " + sqlIdent(req.Schema)
+	}
+	if req.Version != "" {
+		query += " VERSION " + sqlLiteral(req.Version)
+	}
+	if req.Cascade {
+		query += " CASCADE"
+	}
+	return query
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
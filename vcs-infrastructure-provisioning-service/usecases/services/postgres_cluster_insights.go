@@ -0,0 +1,474 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	querySnapshotInterval   = 15 * time.Minute
+	querySnapshotRetention  = 7 * 24 * time.Hour
+	querySnapshotStatements = 200
+)
+
+// cleanQueryText collapses whitespace and strips the psql field separator from query text
+const cleanQueryText = `left(replace(regexp_replace(%s, '\s+', ' ', 'g'), '|', '/'), 1000)`
+
+// GetQueryInsights reads pg_stat_statements, pg_stat_activity and lock waits from every Patroni node
+func (s *postgreSQLClusterService) GetQueryInsights(ctx context.Context, clusterID string, limit int, minDuration time.Duration) (*dto.QueryInsightsResponse, error) {
+	if _, err := s.clusterRepo.FindByID(clusterID); err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+
+	members := patroniMembers(nodes)
+	response := &dto.QueryInsightsResponse{
+		ClusterID:   clusterID,
+		Nodes:       make([]dto.NodeQueryInsight, 0, len(members)),
+		CollectedAt: time.Now().Format(time.RFC3339),
+	}
+	for i := range members {
+		response.Nodes = append(response.Nodes, s.nodeQueryInsight(ctx, &members[i], limit, minDuration))
+	}
+
+	return response, nil
+}
+
+func (s *postgreSQLClusterService) nodeQueryInsight(ctx context.Context, node *entities.ClusterNode, limit int, minDuration time.Duration) dto.NodeQueryInsight {
+	insight := dto.NodeQueryInsight{
+		NodeID:         node.ID,
+		Role:           "replica",
+		TopByTotalTime: []dto.QueryStatistic{},
+		TopByMeanTime:  []dto.QueryStatistic{},
+		LongRunning:    []dto.ActiveQuery{},
+		BlockingChains: []dto.LockWaitInfo{},
+	}
+	insight.NodeName, _ = s.patroniMemberName(ctx, node)
+	if output, err := s.dockerSvc.ExecCommand(ctx, node.ContainerID, []string{"curl", "-s", "http://localhost:8008"}); err == nil && isPatroniLeader(output) {
+		insight.Role = "leader"
+	}
+
+	enabled, err := s.statStatementsEnabled(ctx, node)
+	if err != nil {
+		insight.Error = err.Error()
+		return insight
+	}
+	insight.StatStatementsEnabled = enabled
+	if enabled {
+		if insight.TopByTotalTime, err = s.topStatements(ctx, node, "total_exec_time", limit); err != nil {
+			insight.Error = err.Error()
+		}
+		if insight.TopByMeanTime, err = s.topStatements(ctx, node, "mean_exec_time", limit); err != nil {
+			insight.Error = err.Error()
+		}
+	}
+	if insight.LongRunning, err = s.longRunningQueries(ctx, node, minDuration); err != nil {
+		insight.Error = err.Error()
+	}
+	if insight.BlockingChains, err = s.blockingChains(ctx, node); err != nil {
+		insight.Error = err.Error()
+	}
+
+	return insight
+}
+
+// statStatementsEnabled reports whether pg_stat_statements is installed in the postgres database
+func (s *postgreSQLClusterService) statStatementsEnabled(ctx context.Context, node *entities.ClusterNode) (bool, error) {
+	output, err := s.psql(ctx, node.ContainerID, "postgres",
+		"SELECT count(*) FROM pg_extension WHERE extname = 'pg_stat_statements'")
+	if err != nil {
+		return false, err
+	}
+	return output != "0", nil
+}
+
+func (s *postgreSQLClusterService) topStatements(ctx context.Context, node *entities.ClusterNode, orderBy string, limit int) ([]dto.QueryStatistic, error) {
+	query := fmt.Sprintf(`SELECT s.queryid, coalesce(d.datname, ''), s.calls,
+		round(s.total_exec_time::numeric, 2), round(s.mean_exec_time::numeric, 2), s.rows, `+cleanQueryText+`
+		FROM pg_stat_statements s LEFT JOIN pg_database d ON d.oid = s.dbid
+		WHERE s.queryid IS NOT NULL
+		ORDER BY s.%s DESC LIMIT %d`, "s.query", orderBy, limit)
+	output, err := s.psql(ctx, node.ContainerID, "postgres", query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pg_stat_statements: %w", err)
+	}
+
+	statements := make([]dto.QueryStatistic, 0)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, "|", 7)
+		if len(fields) != 7 {
+			continue
+		}
+		stat := dto.QueryStatistic{
+			QueryID:  fields[0],
+			Database: fields[1],
+			Query:    fields[6],
+		}
+		stat.Calls, _ = strconv.ParseInt(fields[2], 10, 64)
+		stat.TotalTimeMs, _ = strconv.ParseFloat(fields[3], 64)
+		stat.MeanTimeMs, _ = strconv.ParseFloat(fields[4], 64)
+		stat.Rows, _ = strconv.ParseInt(fields[5], 10, 64)
+		statements = append(statements, stat)
+	}
+	return statements, nil
+}
+
+func (s *postgreSQLClusterService) longRunningQueries(ctx context.Context, node *entities.ClusterNode, minDuration time.Duration) ([]dto.ActiveQuery, error) {
+	query := fmt.Sprintf(`SELECT pid, coalesce(datname, ''), coalesce(usename, ''), coalesce(application_name, ''),
+		coalesce(client_addr::text, ''), coalesce(state, ''), coalesce(wait_event_type, ''),
+		round(extract(epoch FROM now() - query_start)::numeric, 1), `+cleanQueryText+`
+		FROM pg_stat_activity
+		WHERE state <> 'idle' AND backend_type = 'client backend' AND pid <> pg_backend_pid()
+		AND now() - query_start >= interval '%d milliseconds'
+		ORDER BY query_start`, "query", minDuration.Milliseconds())
+	output, err := s.psql(ctx, node.ContainerID, "postgres", query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pg_stat_activity: %w", err)
+	}
+
+	queries := make([]dto.ActiveQuery, 0)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, "|", 9)
+		if len(fields) != 9 {
+			continue
+		}
+		active := dto.ActiveQuery{
+			Database:        fields[1],
+			Username:        fields[2],
+			ApplicationName: fields[3],
+			ClientAddr:      fields[4],
+			State:           fields[5],
+			WaitEventType:   fields[6],
+			Query:           fields[8],
+		}
+		active.PID, _ = strconv.Atoi(fields[0])
+		active.DurationSeconds, _ = strconv.ParseFloat(fields[7], 64)
+		queries = append(queries, active)
+	}
+	return queries, nil
+}
+
+// blockingChains lists backends waiting on locks and follows pg_blocking_pids up to the root blocker
+func (s *postgreSQLClusterService) blockingChains(ctx context.Context, node *entities.ClusterNode) ([]dto.LockWaitInfo, error) {
+	query := fmt.Sprintf(`SELECT a.pid, array_to_string(pg_blocking_pids(a.pid), ','), coalesce(a.usename, ''),
+		coalesce((SELECT string_agg(DISTINCT l.mode || ' on ' || coalesce(l.relation::regclass::text, l.locktype), ', ')
+			FROM pg_locks l WHERE l.pid = a.pid AND NOT l.granted), ''),
+		round(extract(epoch FROM now() - a.query_start)::numeric, 1), `+cleanQueryText+`
+		FROM pg_stat_activity a
+		WHERE a.pid IN (SELECT pid FROM pg_stat_activity WHERE cardinality(pg_blocking_pids(pid)) > 0
+			UNION SELECT unnest(pg_blocking_pids(pid)) FROM pg_stat_activity)`, "a.query")
+	output, err := s.psql(ctx, node.ContainerID, "postgres", query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock waits: %w", err)
+	}
+
+	type backend struct {
+		info     dto.LockWaitInfo
+		blockers []int
+	}
+	backends := map[int]*backend{}
+	order := make([]int, 0)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, "|", 6)
+		if len(fields) != 6 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		b := &backend{info: dto.LockWaitInfo{
+			BlockedPID:   pid,
+			BlockedUser:  fields[2],
+			WaitingFor:   fields[3],
+			BlockedQuery: fields[5],
+			BlockingPIDs: []int{},
+		}}
+		b.info.WaitSeconds, _ = strconv.ParseFloat(fields[4], 64)
+		for _, blocker := range strings.Split(fields[1], ",") {
+			if blockerPID, err := strconv.Atoi(blocker); err == nil {
+				b.blockers = append(b.blockers, blockerPID)
+			}
+		}
+		b.info.BlockingPIDs = append(b.info.BlockingPIDs, b.blockers...)
+		backends[pid] = b
+		order = append(order, pid)
+	}
+
+	chains := make([]dto.LockWaitInfo, 0)
+	for _, pid := range order {
+		b := backends[pid]
+		if len(b.blockers) == 0 {
+			continue // root blockers only appear as the end of a chain
+		}
+		chain := []int{pid}
+		seen := map[int]bool{pid: true}
+		current := b
+		for len(current.blockers) > 0 {
+			next := current.blockers[0]
+			if seen[next] {
+				break // deadlock cycle, the deadlock detector will resolve it
+			}
+			chain = append(chain, next)
+			seen[next] = true
+			nextBackend, ok := backends[next]
+			if !ok {
+				break
+			}
+			current = nextBackend
+		}
+		b.info.Chain = chain
+		b.info.RootBlockerPID = chain[len(chain)-1]
+		if root, ok := backends[b.info.RootBlockerPID]; ok {
+			b.info.RootBlockerQuery = root.info.BlockedQuery
+		}
+		chains = append(chains, b.info)
+	}
+	return chains, nil
+}
+
+// CancelQuery cancels the running query of a backend, or terminates the backend
+func (s *postgreSQLClusterService) CancelQuery(ctx context.Context, clusterID string, req dto.CancelQueryRequest) error {
+	node, err := s.clusterRepo.FindNodeByID(req.NodeID)
+	if err != nil || node.ClusterID != clusterID {
+		return fmt.Errorf("node %s not found in cluster", req.NodeID)
+	}
+
+	function := "pg_cancel_backend"
+	if req.Terminate {
+		function = "pg_terminate_backend"
+	}
+	output, err := s.psql(ctx, node.ContainerID, "postgres", fmt.Sprintf("SELECT %s(%d)", function, req.PID))
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", function, err)
+	}
+	if output != "t" {
+		return fmt.Errorf("backend %d not found or could not be signalled", req.PID)
+	}
+
+	s.logger.Info("backend signalled",
+		zap.String("cluster_id", clusterID),
+		zap.String("node_id", req.NodeID),
+		zap.Int("pid", req.PID),
+		zap.String("function", function))
+	return nil
+}
+
+// CreateQuerySnapshot stores the current pg_stat_statements counters of the leader
+func (s *postgreSQLClusterService) CreateQuerySnapshot(ctx context.Context, clusterID string, req dto.CreateQuerySnapshotRequest) (*dto.QuerySnapshotInfo, error) {
+	snapshot, err := s.captureQuerySnapshot(ctx, clusterID, req.Label, "manual")
+	if err != nil {
+		return nil, err
+	}
+	info, err := toQuerySnapshotDTO(snapshot, true)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ListQuerySnapshots returns stored snapshots without their statements, newest first
+func (s *postgreSQLClusterService) ListQuerySnapshots(ctx context.Context, clusterID string, limit int) ([]dto.QuerySnapshotInfo, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	snapshots, err := s.clusterRepo.ListQuerySnapshots(clusterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	result := make([]dto.QuerySnapshotInfo, 0, len(snapshots))
+	for i := range snapshots {
+		info, _ := toQuerySnapshotDTO(&snapshots[i], false)
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// CompareQuerySnapshots computes per-query activity between two snapshots, e.g. before and after a deployment
+func (s *postgreSQLClusterService) CompareQuerySnapshots(ctx context.Context, clusterID, fromID, toID string) (*dto.QuerySnapshotComparison, error) {
+	fromSnapshot, err := s.clusterRepo.FindQuerySnapshotByID(fromID)
+	if err != nil || fromSnapshot.ClusterID != clusterID {
+		return nil, fmt.Errorf("snapshot %s not found", fromID)
+	}
+	toSnapshot, err := s.clusterRepo.FindQuerySnapshotByID(toID)
+	if err != nil || toSnapshot.ClusterID != clusterID {
+		return nil, fmt.Errorf("snapshot %s not found", toID)
+	}
+	if toSnapshot.CapturedAt.Before(fromSnapshot.CapturedAt) {
+		fromSnapshot, toSnapshot = toSnapshot, fromSnapshot
+	}
+
+	from, err := toQuerySnapshotDTO(fromSnapshot, true)
+	if err != nil {
+		return nil, err
+	}
+	to, err := toQuerySnapshotDTO(toSnapshot, true)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := queryDeltas(from, to)
+
+	from.Statements = nil
+	to.Statements = nil
+	return &dto.QuerySnapshotComparison{
+		ClusterID: clusterID,
+		From:      from,
+		To:        to,
+		Queries:   deltas,
+	}, nil
+}
+
+// queryDeltas computes the activity of each statement of the later snapshot since the earlier one
+func queryDeltas(from, to dto.QuerySnapshotInfo) []dto.QueryDelta {
+	before := map[string]dto.QueryStatistic{}
+	for _, stat := range from.Statements {
+		before[stat.QueryID+"/"+stat.Database] = stat
+	}
+
+	deltas := make([]dto.QueryDelta, 0, len(to.Statements))
+	for _, stat := range to.Statements {
+		delta := dto.QueryDelta{
+			QueryID:     stat.QueryID,
+			Database:    stat.Database,
+			Query:       stat.Query,
+			Calls:       stat.Calls,
+			TotalTimeMs: stat.TotalTimeMs,
+		}
+		prev, ok := before[stat.QueryID+"/"+stat.Database]
+		// Counters going backwards mean a stats reset or restart, so the new values are the delta
+		if ok && stat.Calls >= prev.Calls {
+			delta.Calls = stat.Calls - prev.Calls
+			delta.TotalTimeMs = stat.TotalTimeMs - prev.TotalTimeMs
+			delta.MeanTimeBefore = prev.MeanTimeMs
+		}
+		// A truncated first snapshot may have dropped the statement, so its absence proves nothing
+		delta.New = !ok && !from.Truncated
+		delta.Unknown = !ok && from.Truncated
+		if delta.Calls == 0 {
+			continue
+		}
+		delta.MeanTimeMs = delta.TotalTimeMs / float64(delta.Calls)
+		if delta.MeanTimeBefore > 0 {
+			delta.MeanTimeChange = (delta.MeanTimeMs - delta.MeanTimeBefore) / delta.MeanTimeBefore * 100
+		}
+		deltas = append(deltas, delta)
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].TotalTimeMs > deltas[j].TotalTimeMs })
+	return deltas
+}
+
+// StartQuerySnapshots periodically snapshots pg_stat_statements of every running cluster
+// and trims scheduled snapshots past the retention period
+func (s *postgreSQLClusterService) StartQuerySnapshots(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(querySnapshotInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.captureScheduledSnapshots(ctx)
+			}
+		}
+	}()
+}
+
+func (s *postgreSQLClusterService) captureScheduledSnapshots(ctx context.Context) {
+	clusters, err := s.clusterRepo.ListAll()
+	if err != nil {
+		s.logger.Warn("failed to list clusters for query snapshots", zap.Error(err))
+		return
+	}
+	for _, cluster := range clusters {
+		if cluster.Infrastructure.Status != entities.StatusRunning {
+			continue
+		}
+		if _, err := s.captureQuerySnapshot(ctx, cluster.ID, "", "scheduled"); err != nil {
+			s.logger.Debug("skipped query snapshot", zap.String("cluster_id", cluster.ID), zap.Error(err))
+		}
+	}
+
+	if deleted, err := s.clusterRepo.DeleteQuerySnapshotsBefore(time.Now().Add(-querySnapshotRetention)); err != nil {
+		s.logger.Warn("failed to trim query snapshots", zap.Error(err))
+	} else if deleted > 0 {
+		s.logger.Info("trimmed query snapshots", zap.Int64("deleted", deleted))
+	}
+}
+
+func (s *postgreSQLClusterService) captureQuerySnapshot(ctx context.Context, clusterID, label, source string) (*entities.QuerySnapshot, error) {
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	leader, err := s.findPatroniLeader(ctx, patroniMembers(nodes))
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.statStatementsEnabled(ctx, leader)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, fmt.Errorf("pg_stat_statements is not installed in the postgres database")
+	}
+
+	statements, err := s.topStatements(ctx, leader, "total_exec_time", querySnapshotStatements)
+	if err != nil {
+		return nil, err
+	}
+	statementsJSON, err := json.Marshal(statements)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode statements: %w", err)
+	}
+
+	snapshot := &entities.QuerySnapshot{
+		ID:         uuid.New().String(),
+		ClusterID:  clusterID,
+		Label:      label,
+		Source:     source,
+		NodeID:     leader.ID,
+		Statements: string(statementsJSON),
+		Truncated:  len(statements) >= querySnapshotStatements,
+	}
+	if err := s.clusterRepo.CreateQuerySnapshot(snapshot); err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+func toQuerySnapshotDTO(snapshot *entities.QuerySnapshot, withStatements bool) (dto.QuerySnapshotInfo, error) {
+	info := dto.QuerySnapshotInfo{
+		ID:         snapshot.ID,
+		ClusterID:  snapshot.ClusterID,
+		Label:      snapshot.Label,
+		Source:     snapshot.Source,
+		NodeID:     snapshot.NodeID,
+		CapturedAt: snapshot.CapturedAt.Format(time.RFC3339),
+		Truncated:  snapshot.Truncated,
+	}
+	if withStatements && snapshot.Statements != "" {
+		if err := json.Unmarshal([]byte(snapshot.Statements), &info.Statements); err != nil {
+			return info, fmt.Errorf("failed to decode snapshot %s: %w", snapshot.ID, err)
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+)
+
+func TestQueryDeltas(t *testing.T) {
+	from := dto.QuerySnapshotInfo{Statements: []dto.QueryStatistic{
+		{QueryID: "1", Database: "app", Calls: 10, TotalTimeMs: 100, MeanTimeMs: 10},
+		{QueryID: "2", Database: "app", Calls: 5, TotalTimeMs: 50, MeanTimeMs: 10},
+	}}
+	to := dto.QuerySnapshotInfo{Statements: []dto.QueryStatistic{
+		{QueryID: "1", Database: "app", Calls: 20, TotalTimeMs: 300},
+		{QueryID: "2", Database: "app", Calls: 5, TotalTimeMs: 50},
+		{QueryID: "3", Database: "app", Calls: 4, TotalTimeMs: 400},
+	}}
+
+	deltas := queryDeltas(from, to)
+	require.Len(t, deltas, 2, "statements without calls between the snapshots are left out")
+
+	assert.Equal(t, "3", deltas[0].QueryID)
+	assert.True(t, deltas[0].New)
+	assert.False(t, deltas[0].Unknown)
+
+	assert.Equal(t, "1", deltas[1].QueryID)
+	assert.Equal(t, int64(10), deltas[1].Calls)
+	assert.Equal(t, 200.0, deltas[1].TotalTimeMs)
+	assert.Equal(t, 20.0, deltas[1].MeanTimeMs)
+	assert.Equal(t, 100.0, deltas[1].MeanTimeChange)
+	assert.False(t, deltas[1].New)
+}
+
+func TestQueryDeltasTruncatedSnapshot(t *testing.T) {
+	from := dto.QuerySnapshotInfo{Truncated: true, Statements: []dto.QueryStatistic{
+		{QueryID: "1", Database: "app", Calls: 10, TotalTimeMs: 100, MeanTimeMs: 10},
+	}}
+	to := dto.QuerySnapshotInfo{Statements: []dto.QueryStatistic{
+		{QueryID: "2", Database: "app", Calls: 7, TotalTimeMs: 70},
+	}}
+
+	deltas := queryDeltas(from, to)
+	require.Len(t, deltas, 1)
+	assert.False(t, deltas[0].New)
+	assert.True(t, deltas[0].Unknown)
+}
+
+func TestQueryDeltasStatsReset(t *testing.T) {
+	from := dto.QuerySnapshotInfo{Statements: []dto.QueryStatistic{
+		{QueryID: "1", Database: "app", Calls: 100, TotalTimeMs: 1000, MeanTimeMs: 10},
+	}}
+	to := dto.QuerySnapshotInfo{Statements: []dto.QueryStatistic{
+		{QueryID: "1", Database: "app", Calls: 3, TotalTimeMs: 60},
+	}}
+
+	deltas := queryDeltas(from, to)
+	require.Len(t, deltas, 1)
+	assert.Equal(t, int64(3), deltas[0].Calls)
+	assert.Equal(t, 60.0, deltas[0].TotalTimeMs)
+}
@@ -0,0 +1,739 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ListOperations returns tracked operations for a cluster, newest first
+func (s *postgreSQLClusterService) ListOperations(ctx context.Context, clusterID string) ([]dto.ClusterOperationInfo, error) {
+	ops, err := s.clusterRepo.ListOperations(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+
+	result := make([]dto.ClusterOperationInfo, len(ops))
+	for i := range ops {
+		result[i] = toOperationDTO(&ops[i])
+	}
+	return result, nil
+}
+
+// GetOperation returns a single tracked operation
+func (s *postgreSQLClusterService) GetOperation(ctx context.Context, clusterID, operationID string) (*dto.ClusterOperationInfo, error) {
+	op, err := s.clusterRepo.FindOperationByID(operationID)
+	if err != nil {
+		return nil, fmt.Errorf("operation not found: %w", err)
+	}
+	if op.ClusterID != clusterID {
+		return nil, fmt.Errorf("operation does not belong to this cluster")
+	}
+
+	info := toOperationDTO(op)
+	return &info, nil
+}
+
+func toOperationDTO(op *entities.ClusterOperation) dto.ClusterOperationInfo {
+	info := dto.ClusterOperationInfo{
+		ID:            op.ID,
+		ClusterID:     op.ClusterID,
+		OperationType: op.OperationType,
+		Status:        op.Status,
+		Progress:      op.Progress,
+		CurrentStep:   op.CurrentStep,
+		ErrorMessage:  op.ErrorMessage,
+		StartedAt:     op.StartedAt.Format(time.RFC3339),
+	}
+	if op.Details != "" {
+		json.Unmarshal([]byte(op.Details), &info.Details)
+	}
+	if op.CompletedAt != nil {
+		info.CompletedAt = op.CompletedAt.Format(time.RFC3339)
+	}
+	return info
+}
+
+// startOperation records a new running operation for the cluster. Upgrades, resizes, TLS
+// changes, extension installs and dumps all restart or read nodes, so only one runs at a time.
+func (s *postgreSQLClusterService) startOperation(clusterID, opType string, details map[string]interface{}) (*entities.ClusterOperation, error) {
+	s.operationsMu.Lock()
+	defer s.operationsMu.Unlock()
+	if running, err := s.clusterRepo.FindRunningOperation(clusterID); err == nil {
+		return nil, fmt.Errorf("%s operation %s is already running on this cluster", running.OperationType, running.ID)
+	}
+
+	detailsJSON, _ := json.Marshal(details)
+	op := &entities.ClusterOperation{
+		ID:            uuid.New().String(),
+		ClusterID:     clusterID,
+		OperationType: opType,
+		Status:        "running",
+		CurrentStep:   "starting",
+		Details:       string(detailsJSON),
+	}
+	if err := s.clusterRepo.CreateOperation(op); err != nil {
+		return nil, fmt.Errorf("failed to create operation record: %w", err)
+	}
+	return op, nil
+}
+
+// setOperationStep records progress of a running operation
+func (s *postgreSQLClusterService) setOperationStep(op *entities.ClusterOperation, progress int, step string) {
+	op.Progress = progress
+	op.CurrentStep = step
+	if err := s.clusterRepo.UpdateOperation(op); err != nil {
+		s.logger.Warn("failed to update operation", zap.String("operation_id", op.ID), zap.Error(err))
+	}
+	s.logger.Info("cluster operation progress",
+		zap.String("operation_id", op.ID),
+		zap.String("type", op.OperationType),
+		zap.Int("progress", progress),
+		zap.String("step", step))
+}
+
+// setOperationDetail adds a key to the operation details JSON
+func (s *postgreSQLClusterService) setOperationDetail(op *entities.ClusterOperation, key string, value interface{}) {
+	details := map[string]interface{}{}
+	if op.Details != "" {
+		json.Unmarshal([]byte(op.Details), &details)
+	}
+	details[key] = value
+	detailsJSON, _ := json.Marshal(details)
+	op.Details = string(detailsJSON)
+	s.clusterRepo.UpdateOperation(op)
+}
+
+// finishOperation marks an operation completed, or failed when err is set
+func (s *postgreSQLClusterService) finishOperation(op *entities.ClusterOperation, err error) {
+	now := time.Now()
+	op.CompletedAt = &now
+	if err != nil {
+		op.Status = "failed"
+		op.ErrorMessage = err.Error()
+		s.logger.Error("cluster operation failed", zap.String("operation_id", op.ID), zap.String("type", op.OperationType), zap.Error(err))
+	} else {
+		op.Status = "completed"
+		op.Progress = 100
+		op.CurrentStep = "done"
+		s.logger.Info("cluster operation completed", zap.String("operation_id", op.ID), zap.String("type", op.OperationType))
+	}
+	if updateErr := s.clusterRepo.UpdateOperation(op); updateErr != nil {
+		s.logger.Warn("failed to update operation", zap.String("operation_id", op.ID), zap.Error(updateErr))
+	}
+}
+
+// RecoverOperations fails operations left running by a previous process, in the background
+// since clusters may need minutes to come back. Node containers stopped halfway through a
+// rolling change are started again, an interrupted major upgrade is rolled back unless it got
+// past the cutover, and leftover upgrade probe containers are removed.
+func (s *postgreSQLClusterService) RecoverOperations(ctx context.Context) {
+	go func() {
+		s.removeUpgradeProbes(ctx)
+		s.recoverOperations(ctx)
+	}()
+}
+
+func (s *postgreSQLClusterService) recoverOperations(ctx context.Context) {
+	ops, err := s.clusterRepo.ListRunningOperations()
+	if err != nil {
+		s.logger.Warn("failed to list interrupted cluster operations", zap.Error(err))
+		return
+	}
+	for i := range ops {
+		op := &ops[i]
+		message := "interrupted by a service restart"
+		if problems := s.recoverInterruptedOperation(ctx, op); len(problems) > 0 {
+			message = fmt.Sprintf("%s; %s", message, strings.Join(problems, "; "))
+		}
+		s.finishOperation(op, errors.New(message))
+	}
+}
+
+// recoverInterruptedOperation brings the cluster of an interrupted operation back to a usable
+// state and returns what could not be repaired
+func (s *postgreSQLClusterService) recoverInterruptedOperation(ctx context.Context, op *entities.ClusterOperation) []string {
+	cluster, err := s.clusterRepo.FindByID(op.ClusterID)
+	if err != nil {
+		return nil
+	}
+	details := map[string]interface{}{}
+	if op.Details != "" {
+		json.Unmarshal([]byte(op.Details), &details)
+	}
+	if cutOver, _ := details["cut_over"].(bool); cutOver {
+		// The source may have been stopped on purpose and the target already holds the data
+		return []string{fmt.Sprintf("the upgrade got past the cutover, target cluster %v holds the data", details["target_cluster_id"])}
+	}
+
+	var problems []string
+	if cluster.Infrastructure.Status == entities.StatusRunning {
+		problems = s.startInterruptedNodes(ctx, cluster.ID)
+	}
+	if op.OperationType == "upgrade" && details["method"] == "logical" {
+		if err := s.rollbackInterruptedUpgrade(ctx, op, cluster, details); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// startInterruptedNodes starts node containers that an operation stopped, and picks up
+// containers it recreated without storing their new ID
+func (s *postgreSQLClusterService) startInterruptedNodes(ctx context.Context, clusterID string) []string {
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to list nodes: %v", err)}
+	}
+
+	var problems []string
+	for i := range nodes {
+		node := &nodes[i]
+		info, err := s.dockerSvc.InspectContainer(ctx, node.ContainerID)
+		if err != nil {
+			if info = s.findNodeContainer(ctx, node); info == nil {
+				problems = append(problems, fmt.Sprintf("container of node %s is missing", node.ID))
+				continue
+			}
+			node.ContainerID = info.ID
+			if err := s.clusterRepo.UpdateNode(node); err != nil {
+				problems = append(problems, fmt.Sprintf("failed to update node %s: %v", node.ID, err))
+			}
+		}
+		if info.State.Running {
+			continue
+		}
+		if err := s.dockerSvc.StartContainer(ctx, node.ContainerID); err != nil {
+			problems = append(problems, fmt.Sprintf("failed to start node %s: %v", node.ID, err))
+			continue
+		}
+		if node.Role == "primary" || node.Role == "replica" {
+			if err := s.waitForPatroniReady(ctx, node.ContainerID, 5*time.Minute); err != nil {
+				problems = append(problems, fmt.Sprintf("node %s did not become ready: %v", node.ID, err))
+			}
+		}
+	}
+	return problems
+}
+
+// findNodeContainer finds the container mounting the data volume of a node
+func (s *postgreSQLClusterService) findNodeContainer(ctx context.Context, node *entities.ClusterNode) *types.ContainerJSON {
+	if node.VolumeID == "" {
+		return nil
+	}
+	containers, err := s.dockerSvc.GetClient().ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("volume", node.VolumeID)),
+	})
+	if err != nil || len(containers) != 1 {
+		return nil
+	}
+	info, err := s.dockerSvc.InspectContainer(ctx, containers[0].ID)
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// rollbackInterruptedUpgrade rebuilds what a logical upgrade may have changed from the details
+// it recorded and rolls it back
+func (s *postgreSQLClusterService) rollbackInterruptedUpgrade(ctx context.Context, op *entities.ClusterOperation, cluster *entities.PostgreSQLCluster, details map[string]interface{}) error {
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	leader, err := s.findPatroniLeader(ctx, patroniMembers(nodes))
+	if err != nil {
+		return fmt.Errorf("cannot roll back the upgrade: %w", err)
+	}
+
+	state := &logicalUpgradeState{sourceLeader: leader, subscriptions: map[string]string{}}
+	if targetID, ok := details["target_cluster_id"].(string); ok {
+		state.targetClusterID = targetID
+		if targetNodes, err := s.clusterRepo.ListNodes(targetID); err == nil {
+			if targetLeader, err := s.findPatroniLeader(ctx, patroniMembers(targetNodes)); err == nil {
+				state.targetLeader = targetLeader
+			}
+		}
+	}
+	if frozen, ok := details["frozen_databases"].([]interface{}); ok {
+		for _, db := range frozen {
+			if name, ok := db.(string); ok {
+				state.frozen = append(state.frozen, name)
+			}
+		}
+	}
+	// Dropping a publication or slot that was never created is harmless
+	databases, err := s.listUserDatabases(ctx, leader.ContainerID)
+	if err != nil {
+		return fmt.Errorf("failed to list databases: %w", err)
+	}
+	for _, db := range databases {
+		state.publications = append(state.publications, db)
+		state.subscriptions[db] = upgradeSubscriptionName(db)
+	}
+
+	s.rollbackLogicalUpgrade(op, cluster, state)
+	return nil
+}
+
+// removeUpgradeProbes removes image probe containers a previous process did not get to remove
+func (s *postgreSQLClusterService) removeUpgradeProbes(ctx context.Context) {
+	cli := s.dockerSvc.GetClient()
+	probes, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", upgradeProbeLabel+"=true")),
+	})
+	if err != nil {
+		s.logger.Warn("failed to list upgrade probe containers", zap.Error(err))
+		return
+	}
+	for _, probe := range probes {
+		if err := cli.ContainerRemove(ctx, probe.ID, container.RemoveOptions{Force: true}); err != nil {
+			s.logger.Warn("failed to remove upgrade probe container", zap.String("container_id", probe.ID), zap.Error(err))
+		}
+	}
+}
+
+// psql runs a query with unaligned, pipe-separated output and surfaces SQL errors
+func (s *postgreSQLClusterService) psql(ctx context.Context, containerID, database, query string) (string, error) {
+	return execPSQL(ctx, s.dockerSvc, containerID, database, query)
+}
+
+func execPSQL(ctx context.Context, dockerSvc docker.IDockerService, containerID, database, query string) (string, error) {
+	if database == "" {
+		database = "postgres"
+	}
+	cmd := []string{"psql", "-U", "postgres", "-d", database, "-t", "-A", "-F", "|", "-c", query}
+	output, err := dockerSvc.ExecCommand(ctx, containerID, cmd)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(output, "ERROR:") || strings.Contains(output, "FATAL:") || strings.Contains(output, "psql: error") {
+		return "", fmt.Errorf("%s", strings.TrimSpace(output))
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// patroniMembers returns the Patroni-managed nodes (primary and replicas) of a cluster
+func patroniMembers(nodes []entities.ClusterNode) []entities.ClusterNode {
+	members := make([]entities.ClusterNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Role == "primary" || node.Role == "replica" {
+			members = append(members, node)
+		}
+	}
+	return members
+}
+
+// isPatroniLeader reports whether a Patroni REST response belongs to the leader (or standby leader)
+func isPatroniLeader(output string) bool {
+	return strings.Contains(output, `"role": "master"`) ||
+		strings.Contains(output, `"role": "leader"`) ||
+		strings.Contains(output, `"role": "primary"`) ||
+		strings.Contains(output, `"role": "standby_leader"`)
+}
+
+// findPatroniLeader asks each node's Patroni API which one currently holds the leader lock
+func (s *postgreSQLClusterService) findPatroniLeader(ctx context.Context, members []entities.ClusterNode) (*entities.ClusterNode, error) {
+	return patroniLeader(ctx, s.dockerSvc, members)
+}
+
+func patroniLeader(ctx context.Context, dockerSvc docker.IDockerService, members []entities.ClusterNode) (*entities.ClusterNode, error) {
+	for i := range members {
+		output, err := dockerSvc.ExecCommand(ctx, members[i].ContainerID, []string{"curl", "-s", "http://localhost:8008"})
+		if err != nil {
+			continue
+		}
+		if isPatroniLeader(output) {
+			return &members[i], nil
+		}
+	}
+	return nil, fmt.Errorf("leader not found via Patroni API")
+}
+
+// patroniMemberName returns the Patroni member name (PATRONI_NAME) of a node
+func (s *postgreSQLClusterService) patroniMemberName(ctx context.Context, node *entities.ClusterNode) (string, error) {
+	return patroniNodeName(ctx, s.dockerSvc, node)
+}
+
+func patroniNodeName(ctx context.Context, dockerSvc docker.IDockerService, node *entities.ClusterNode) (string, error) {
+	inspect, err := dockerSvc.InspectContainer(ctx, node.ContainerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect node %s: %w", node.ID, err)
+	}
+	for _, envVar := range inspect.Config.Env {
+		if strings.HasPrefix(envVar, "PATRONI_NAME=") {
+			return strings.TrimPrefix(envVar, "PATRONI_NAME="), nil
+		}
+	}
+	return strings.TrimPrefix(inspect.Name, "/"), nil
+}
+
+// patroniSwitchover hands leadership from leader to candidate through the Patroni API,
+// waits for the candidate to take over and records the change
+func (s *postgreSQLClusterService) patroniSwitchover(ctx context.Context, clusterID string, leader, candidate *entities.ClusterNode, reason string) error {
+	leaderName, err := s.patroniMemberName(ctx, leader)
+	if err != nil {
+		return err
+	}
+	candidateName, err := s.patroniMemberName(ctx, candidate)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("patroni switchover",
+		zap.String("cluster_id", clusterID),
+		zap.String("leader", leaderName),
+		zap.String("candidate", candidateName))
+
+	body := fmt.Sprintf(`{"leader": "%s", "candidate": "%s"}`, leaderName, candidateName)
+	output, err := s.dockerSvc.ExecCommand(ctx, leader.ContainerID, []string{
+		"curl", "-s", "-X", "POST", "-H", "Content-Type: application/json", "-d", body, "http://localhost:8008/switchover",
+	})
+	if err != nil {
+		return fmt.Errorf("switchover request failed: %w", err)
+	}
+	if !strings.Contains(strings.ToLower(output), "switched over") {
+		return fmt.Errorf("switchover rejected: %s", strings.TrimSpace(output))
+	}
+
+	deadline := time.Now().Add(60 * time.Second)
+	for {
+		roleOutput, _ := s.dockerSvc.ExecCommand(ctx, candidate.ContainerID, []string{"curl", "-s", "http://localhost:8008"})
+		if isPatroniLeader(roleOutput) {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("candidate %s did not become leader in time", candidateName)
+		}
+		time.Sleep(2 * time.Second)
+	}
+
+	event := &entities.FailoverEvent{
+		ID:             uuid.New().String(),
+		ClusterID:      clusterID,
+		OldPrimaryID:   leader.ID,
+		OldPrimaryName: leaderName,
+		NewPrimaryID:   candidate.ID,
+		NewPrimaryName: candidateName,
+		Reason:         reason,
+		TriggeredBy:    "system",
+	}
+	if err := s.clusterRepo.CreateFailoverEvent(event); err != nil {
+		s.logger.Error("failed to record failover event", zap.Error(err))
+	}
+
+	leader.Role = "replica"
+	candidate.Role = "primary"
+	s.clusterRepo.UpdateNode(leader)
+	s.clusterRepo.UpdateNode(candidate)
+	if cluster, err := s.clusterRepo.FindByID(clusterID); err == nil {
+		cluster.PrimaryNodeID = candidate.ID
+		s.clusterRepo.Update(cluster)
+	}
+	s.cacheService.InvalidateClusterInfo(ctx, clusterID)
+
+	return nil
+}
+
+// patroniPatchConfig merges a change into the Patroni dynamic configuration stored in the DCS
+func (s *postgreSQLClusterService) patroniPatchConfig(ctx context.Context, node *entities.ClusterNode, patch map[string]interface{}) error {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to encode config patch: %w", err)
+	}
+	output, err := s.dockerSvc.ExecCommand(ctx, node.ContainerID, []string{
+		"curl", "-s", "-X", "PATCH", "-H", "Content-Type: application/json", "-d", string(body), "http://localhost:8008/config",
+	})
+	if err != nil {
+		return fmt.Errorf("config patch request failed: %w", err)
+	}
+	// Patroni answers with the merged config as JSON, anything else is an error message
+	if !strings.HasPrefix(strings.TrimSpace(output), "{") {
+		return fmt.Errorf("config patch rejected: %s", strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// waitForPendingRestart waits until every member has picked up a config change on its next HA
+// loop and flags the restart it needs
+func (s *postgreSQLClusterService) waitForPendingRestart(ctx context.Context, members []entities.ClusterNode) error {
+	for i := range members {
+		deadline := time.Now().Add(60 * time.Second)
+		for {
+			output, _ := s.dockerSvc.ExecCommand(ctx, members[i].ContainerID, []string{"curl", "-s", "http://localhost:8008"})
+			if strings.Contains(output, `"pending_restart": true`) {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("node %s did not pick up the new config in time", members[i].ID)
+			}
+			time.Sleep(2 * time.Second)
+		}
+	}
+	return nil
+}
+
+// patroniRestartNode restarts PostgreSQL on a node through Patroni and waits until it accepts connections
+func (s *postgreSQLClusterService) patroniRestartNode(ctx context.Context, node *entities.ClusterNode) error {
+	output, err := s.dockerSvc.ExecCommand(ctx, node.ContainerID, []string{
+		"curl", "-s", "-X", "POST", "-H", "Content-Type: application/json", "-d", "{}", "http://localhost:8008/restart",
+	})
+	if err != nil {
+		return fmt.Errorf("restart request failed: %w", err)
+	}
+	if !strings.Contains(strings.ToLower(output), "restarted successfully") {
+		return fmt.Errorf("restart failed: %s", strings.TrimSpace(output))
+	}
+	return s.waitForPatroniReady(ctx, node.ContainerID, 5*time.Minute)
+}
+
+// patroniRollingRestart restarts replicas one at a time, then switches over and restarts the former
+// leader so postmaster-level settings apply without taking writes down for the whole cluster
+func (s *postgreSQLClusterService) patroniRollingRestart(ctx context.Context, op *entities.ClusterOperation, clusterID, reason string) error {
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+	leader, err := s.findPatroniLeader(ctx, members)
+	if err != nil {
+		return err
+	}
+
+	replicas := make([]*entities.ClusterNode, 0)
+	for i := range members {
+		if members[i].ID != leader.ID {
+			replicas = append(replicas, &members[i])
+		}
+	}
+
+	for _, replica := range replicas {
+		s.setOperationStep(op, op.Progress, fmt.Sprintf("restarting replica %s", replica.ID))
+		if err := s.patroniRestartNode(ctx, replica); err != nil {
+			return fmt.Errorf("failed to restart replica %s: %w", replica.ID, err)
+		}
+	}
+
+	if len(replicas) > 0 {
+		s.setOperationStep(op, op.Progress, fmt.Sprintf("switching over to %s", replicas[0].ID))
+		if err := s.patroniSwitchover(ctx, clusterID, leader, replicas[0], reason); err != nil {
+			return fmt.Errorf("switchover failed: %w", err)
+		}
+	}
+
+	s.setOperationStep(op, op.Progress, fmt.Sprintf("restarting former leader %s", leader.ID))
+	if err := s.patroniRestartNode(ctx, leader); err != nil {
+		return fmt.Errorf("failed to restart former leader %s: %w", leader.ID, err)
+	}
+	return nil
+}
+
+// recreatePatroniNode replaces a node's container while keeping its name, volumes and Patroni identity.
+// A non-empty image or non-nil resources override the current container settings.
+func (s *postgreSQLClusterService) recreatePatroniNode(ctx context.Context, node *entities.ClusterNode, image string, resources *docker.ResourceConfig) error {
+	inspect, err := s.dockerSvc.InspectContainer(ctx, node.ContainerID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect node %s: %w", node.ID, err)
+	}
+	cluster, err := s.clusterRepo.FindByID(node.ClusterID)
+	if err != nil {
+		return fmt.Errorf("failed to load cluster of node %s: %w", node.ID, err)
+	}
+
+	config := containerConfigFromInspect(ctx, s.dockerSvc, inspect, cluster.NetworkID)
+	extraNetworks := secondaryNetworks(inspect, config.Network)
+	if image != "" {
+		config.Image = image
+	}
+	if resources != nil {
+		config.Resources = *resources
+	}
+	// The certificate lives in the container filesystem and may have been rotated since it was created
+	config.Env = stripTLSEnv(config.Env)
+	tlsFiles, err := s.storedNodeTLSFiles(node)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate of node %s: %w", node.ID, err)
+	}
+
+	s.logger.Info("recreating patroni node",
+		zap.String("node_id", node.ID),
+		zap.String("name", config.Name),
+		zap.String("image", config.Image))
+
+	if err := s.dockerSvc.StopContainer(ctx, node.ContainerID); err != nil {
+		return fmt.Errorf("failed to stop node %s: %w", config.Name, err)
+	}
+	if err := s.dockerSvc.RemoveContainer(ctx, node.ContainerID); err != nil {
+		return fmt.Errorf("failed to remove node %s: %w", config.Name, err)
+	}
+
+	containerID, err := s.dockerSvc.CreateContainer(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to create container for %s: %w", config.Name, err)
+	}
+	if err := connectNetworks(ctx, s.dockerSvc, containerID, extraNetworks); err != nil {
+		return fmt.Errorf("failed to reconnect %s: %w", config.Name, err)
+	}
+	if tlsFiles != nil {
+		if err := s.installNodeTLSFiles(ctx, containerID, tlsFiles); err != nil {
+			return fmt.Errorf("failed to install certificate on %s: %w", config.Name, err)
+		}
+	}
+	if err := s.dockerSvc.StartContainer(ctx, containerID); err != nil {
+		return fmt.Errorf("failed to start container for %s: %w", config.Name, err)
+	}
+
+	node.ContainerID = containerID
+	if err := s.clusterRepo.UpdateNode(node); err != nil {
+		return fmt.Errorf("failed to update node: %w", err)
+	}
+	s.cacheService.RegisterContainerForMonitoring(ctx, node.ID, containerID)
+	s.cacheService.InvalidateClusterInfo(ctx, node.ClusterID)
+
+	return s.waitForPatroniReady(ctx, containerID, 5*time.Minute)
+}
+
+// containerConfigFromInspect rebuilds the create config of an existing container on network,
+// the network of its cluster given by name or ID. Other networks it is attached to are left to
+// secondaryNetworks. Env entries inherited from the image are dropped so a new image can supply
+// its own.
+func containerConfigFromInspect(ctx context.Context, dockerSvc docker.IDockerService, inspect *types.ContainerJSON, network string) docker.ContainerConfig {
+	name := strings.TrimPrefix(inspect.Name, "/")
+
+	imageEnv := map[string]bool{}
+	if imageInfo, _, err := dockerSvc.GetClient().ImageInspectWithRaw(ctx, inspect.Image); err == nil && imageInfo.Config != nil {
+		for _, envVar := range imageInfo.Config.Env {
+			imageEnv[envVar] = true
+		}
+	}
+	env := make([]string, 0, len(inspect.Config.Env))
+	for _, envVar := range inspect.Config.Env {
+		if !imageEnv[envVar] {
+			env = append(env, envVar)
+		}
+	}
+
+	ports := map[string]string{}
+	for port, bindings := range inspect.HostConfig.PortBindings {
+		hostPort := "0"
+		if len(bindings) > 0 && bindings[0].HostPort != "" {
+			hostPort = bindings[0].HostPort
+		}
+		key := port.Port()
+		if port.Proto() != "tcp" {
+			key = string(port)
+		}
+		ports[key] = hostPort
+	}
+
+	// Named volumes and bind mounts, read-only ones staying read-only
+	volumes := map[string]string{}
+	for _, m := range inspect.Mounts {
+		source := ""
+		switch {
+		case m.Type == mount.TypeVolume && m.Name != "":
+			source = m.Name
+		case m.Type == mount.TypeBind:
+			source = m.Source
+		default:
+			continue
+		}
+		target := m.Destination
+		if !m.RW {
+			target += ":ro"
+		}
+		volumes[source] = target
+	}
+
+	networkName := network
+	if inspect.NetworkSettings != nil {
+		for netName, endpoint := range inspect.NetworkSettings.Networks {
+			if netName == network || (endpoint != nil && endpoint.NetworkID == network) {
+				networkName = netName
+			}
+		}
+	}
+
+	return docker.ContainerConfig{
+		Name:         name,
+		Image:        inspect.Config.Image,
+		Env:          env,
+		Ports:        ports,
+		Volumes:      volumes,
+		Network:      networkName,
+		NetworkAlias: name,
+		Labels:       inspect.Config.Labels,
+		CapAdd:       inspect.HostConfig.CapAdd,
+		Resources: docker.ResourceConfig{
+			CPULimit:    inspect.HostConfig.NanoCPUs,
+			MemoryLimit: inspect.HostConfig.Memory,
+		},
+	}
+}
+
+// secondaryNetworks lists the networks a container is attached to besides primary, with the
+// aliases it has on each, such as the source network joined by an upgrade target
+func secondaryNetworks(inspect *types.ContainerJSON, primary string) map[string][]string {
+	networks := map[string][]string{}
+	if inspect.NetworkSettings == nil {
+		return networks
+	}
+	// Docker adds the short container ID as an alias; the new container gets its own
+	shortID := inspect.ID
+	if len(shortID) > 12 {
+		shortID = shortID[:12]
+	}
+	for name, endpoint := range inspect.NetworkSettings.Networks {
+		if name == primary || endpoint == nil || endpoint.NetworkID == primary {
+			continue
+		}
+		var aliases []string
+		for _, alias := range endpoint.Aliases {
+			if alias != shortID {
+				aliases = append(aliases, alias)
+			}
+		}
+		networks[name] = aliases
+	}
+	return networks
+}
+
+// connectNetworks attaches a container to networks with their aliases
+func connectNetworks(ctx context.Context, dockerSvc docker.IDockerService, containerID string, networks map[string][]string) error {
+	for name, aliases := range networks {
+		if err := dockerSvc.ConnectNetwork(ctx, name, containerID, aliases); err != nil {
+			return fmt.Errorf("failed to connect to network %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// shellQuote wraps a value in single quotes for use inside sh -c
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// sqlLiteral quotes a value as a SQL string literal
+func sqlLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// sqlIdent quotes a value as a SQL identifier
+func sqlIdent(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
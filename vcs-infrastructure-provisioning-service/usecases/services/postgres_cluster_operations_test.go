@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+)
+
+// fakeOperationRepo keeps operations, clusters and nodes in memory; other repository methods are not used
+type fakeOperationRepo struct {
+	repositories.IPostgreSQLClusterRepository
+	ops      map[string]*entities.ClusterOperation
+	clusters map[string]*entities.PostgreSQLCluster
+	nodes    map[string][]entities.ClusterNode
+}
+
+func newFakeOperationRepo() *fakeOperationRepo {
+	return &fakeOperationRepo{
+		ops:      map[string]*entities.ClusterOperation{},
+		clusters: map[string]*entities.PostgreSQLCluster{},
+		nodes:    map[string][]entities.ClusterNode{},
+	}
+}
+
+func (r *fakeOperationRepo) CreateOperation(op *entities.ClusterOperation) error {
+	stored := *op
+	r.ops[op.ID] = &stored
+	return nil
+}
+
+func (r *fakeOperationRepo) UpdateOperation(op *entities.ClusterOperation) error {
+	stored := *op
+	r.ops[op.ID] = &stored
+	return nil
+}
+
+func (r *fakeOperationRepo) FindRunningOperation(clusterID string) (*entities.ClusterOperation, error) {
+	for _, op := range r.ops {
+		if op.ClusterID == clusterID && op.Status == "running" {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func (r *fakeOperationRepo) ListRunningOperations() ([]entities.ClusterOperation, error) {
+	var ops []entities.ClusterOperation
+	for _, op := range r.ops {
+		if op.Status == "running" {
+			ops = append(ops, *op)
+		}
+	}
+	return ops, nil
+}
+
+func (r *fakeOperationRepo) FindByID(id string) (*entities.PostgreSQLCluster, error) {
+	if cluster, ok := r.clusters[id]; ok {
+		return cluster, nil
+	}
+	return nil, fmt.Errorf("record not found")
+}
+
+func (r *fakeOperationRepo) ListNodes(clusterID string) ([]entities.ClusterNode, error) {
+	return r.nodes[clusterID], nil
+}
+
+// fakeNodeDocker knows which containers exist and which of them run
+type fakeNodeDocker struct {
+	docker.IDockerService
+	running map[string]bool
+}
+
+func (d *fakeNodeDocker) InspectContainer(ctx context.Context, containerID string) (*types.ContainerJSON, error) {
+	running, ok := d.running[containerID]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", containerID)
+	}
+	return &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: containerID, State: &types.ContainerState{Running: running}},
+	}, nil
+}
+
+func (d *fakeNodeDocker) StartContainer(ctx context.Context, containerID string) error {
+	d.running[containerID] = true
+	return nil
+}
+
+func TestStartOperationRejectsConcurrentOperation(t *testing.T) {
+	repo := newFakeOperationRepo()
+	svc := &postgreSQLClusterService{clusterRepo: repo, logger: nopLogger{}}
+
+	upgrade, err := svc.startOperation("c1", "upgrade", nil)
+	require.NoError(t, err)
+
+	for _, opType := range []string{"resize", "tls", "extension", "import", "export"} {
+		_, err := svc.startOperation("c1", opType, nil)
+		require.Error(t, err, opType)
+		assert.Contains(t, err.Error(), "upgrade operation "+upgrade.ID+" is already running")
+	}
+
+	// Other clusters are not affected
+	_, err = svc.startOperation("c2", "resize", nil)
+	assert.NoError(t, err)
+
+	svc.finishOperation(upgrade, nil)
+	_, err = svc.startOperation("c1", "resize", nil)
+	assert.NoError(t, err)
+}
+
+func TestRecoverOperationsFailsInterruptedOperations(t *testing.T) {
+	repo := newFakeOperationRepo()
+	repo.clusters["c1"] = &entities.PostgreSQLCluster{ID: "c1", Infrastructure: entities.Infrastructure{Status: entities.StatusRunning}}
+	repo.nodes["c1"] = []entities.ClusterNode{
+		{ID: "n1", ClusterID: "c1", Role: "haproxy", ContainerID: "haproxy"},
+		{ID: "n2", ClusterID: "c1", Role: "etcd", ContainerID: "etcd"},
+	}
+	dockerSvc := &fakeNodeDocker{running: map[string]bool{"haproxy": true, "etcd": false}}
+	svc := &postgreSQLClusterService{clusterRepo: repo, dockerSvc: dockerSvc, logger: nopLogger{}}
+
+	resize, err := svc.startOperation("c1", "resize", nil)
+	require.NoError(t, err)
+	done, err := svc.startOperation("c2", "tls", nil)
+	require.NoError(t, err)
+	svc.finishOperation(done, nil)
+
+	svc.recoverOperations(context.Background())
+
+	recovered := repo.ops[resize.ID]
+	assert.Equal(t, "failed", recovered.Status)
+	assert.Equal(t, "interrupted by a service restart", recovered.ErrorMessage)
+	assert.NotNil(t, recovered.CompletedAt)
+	assert.True(t, dockerSvc.running["etcd"], "stopped node is started again")
+	assert.Equal(t, "completed", repo.ops[done.ID].Status)
+
+	// The cluster accepts new operations again
+	_, err = svc.startOperation("c1", "resize", nil)
+	assert.NoError(t, err)
+}
+
+func TestRecoverOperationsKeepsUpgradeAfterCutover(t *testing.T) {
+	repo := newFakeOperationRepo()
+	repo.clusters["c1"] = &entities.PostgreSQLCluster{ID: "c1", Infrastructure: entities.Infrastructure{Status: entities.StatusStopped}}
+	svc := &postgreSQLClusterService{clusterRepo: repo, logger: nopLogger{}}
+
+	upgrade, err := svc.startOperation("c1", "upgrade", map[string]interface{}{"method": "logical"})
+	require.NoError(t, err)
+	svc.setOperationDetail(upgrade, "target_cluster_id", "c2")
+	svc.setOperationDetail(upgrade, "cut_over", true)
+
+	svc.recoverOperations(context.Background())
+
+	recovered := repo.ops[upgrade.ID]
+	assert.Equal(t, "failed", recovered.Status)
+	assert.Contains(t, recovered.ErrorMessage, "target cluster c2 holds the data")
+}
+
+// unreachableDocker has a client that cannot connect, so image lookups fail quickly
+type unreachableDocker struct {
+	docker.IDockerService
+	cli *client.Client
+}
+
+func (d *unreachableDocker) GetClient() *client.Client {
+	return d.cli
+}
+
+func TestContainerConfigFromInspectNetworksAndMounts(t *testing.T) {
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://127.0.0.1:1"))
+	require.NoError(t, err)
+	dockerSvc := &unreachableDocker{cli: cli}
+
+	inspect := &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         "0123456789abcdef",
+			Name:       "/pg-cluster-app-node1",
+			HostConfig: &container.HostConfig{},
+		},
+		Config: &container.Config{Image: "iaas-patroni-postgres:16"},
+		Mounts: []types.MountPoint{
+			{Type: mount.TypeVolume, Name: "pg-1234-data-1", Destination: "/var/lib/postgresql/data", RW: true},
+			{Type: mount.TypeBind, Source: "/srv/pg/conf", Destination: "/etc/patroni", RW: false},
+			{Type: mount.TypeTmpfs, Destination: "/run"},
+		},
+		NetworkSettings: &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{
+			"pg-cluster-app_default": {NetworkID: "net-app", Aliases: []string{"pg-cluster-app-node1", "0123456789ab"}},
+			"pg-cluster-old_default": {NetworkID: "net-old", Aliases: []string{"0123456789ab"}},
+			"standby-source":         {NetworkID: "net-standby", Aliases: []string{"source-leader", "0123456789ab"}},
+		}},
+	}
+
+	// Whatever order the networks come out of the map, the cluster network is the primary one
+	for i := 0; i < 20; i++ {
+		config := containerConfigFromInspect(context.Background(), dockerSvc, inspect, "net-app")
+		require.Equal(t, "pg-cluster-app_default", config.Network)
+		assert.Equal(t, "pg-cluster-app-node1", config.NetworkAlias)
+		assert.Equal(t, map[string]string{
+			"pg-1234-data-1": "/var/lib/postgresql/data",
+			"/srv/pg/conf":   "/etc/patroni:ro",
+		}, config.Volumes)
+	}
+
+	assert.Equal(t, map[string][]string{
+		"pg-cluster-old_default": nil,
+		"standby-source":         {"source-leader"},
+	}, secondaryNetworks(inspect, "pg-cluster-app_default"))
+}
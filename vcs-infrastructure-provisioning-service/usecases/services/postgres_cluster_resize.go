@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"go.uber.org/zap"
+)
+
+// ResizeCluster changes CPU/memory limits of every Patroni node as a tracked rolling operation.
+// Limits are updated in place through the Docker update API; nodes where that fails (or when
+// force_recreate is set) are recreated on the same volumes, the leader only after a switchover.
+func (s *postgreSQLClusterService) ResizeCluster(ctx context.Context, clusterID string, req dto.ResizeClusterRequest) (*dto.ClusterOperationInfo, error) {
+	s.logger.Info("cluster resize requested",
+		zap.String("cluster_id", clusterID),
+		zap.Int64("cpu_per_node", req.CPUPerNode),
+		zap.Int64("memory_per_node", req.MemoryPerNode))
+
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	if cluster.Infrastructure.Status != entities.StatusRunning {
+		return nil, fmt.Errorf("cluster must be running to resize (status: %s)", cluster.Infrastructure.Status)
+	}
+	if req.CPUPerNode == cluster.CPULimit && req.MemoryPerNode == cluster.MemoryLimit && !req.ForceRecreate {
+		return nil, fmt.Errorf("cluster already has %d CPU / %d MB per node", cluster.CPULimit, cluster.MemoryLimit)
+	}
+
+	op, err := s.startOperation(clusterID, "resize", map[string]interface{}{
+		"from_cpu_per_node":    cluster.CPULimit,
+		"from_memory_per_node": cluster.MemoryLimit,
+		"to_cpu_per_node":      req.CPUPerNode,
+		"to_memory_per_node":   req.MemoryPerNode,
+		"force_recreate":       req.ForceRecreate,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resources := docker.ResourceConfig{
+		CPULimit:    req.CPUPerNode * 1000000000,     // cores to nanocores
+		MemoryLimit: req.MemoryPerNode * 1024 * 1024, // MB to bytes
+	}
+
+	go func() {
+		bgCtx, cancel := context.WithTimeout(context.Background(), 1*time.Hour)
+		defer cancel()
+		s.finishOperation(op, s.runRollingResize(bgCtx, op, cluster, req, resources))
+	}()
+
+	info := toOperationDTO(op)
+	return &info, nil
+}
+
+func (s *postgreSQLClusterService) runRollingResize(ctx context.Context, op *entities.ClusterOperation, cluster *entities.PostgreSQLCluster, req dto.ResizeClusterRequest, resources docker.ResourceConfig) error {
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+	leader, err := s.findPatroniLeader(ctx, members)
+	if err != nil {
+		return err
+	}
+
+	replicas := make([]*entities.ClusterNode, 0)
+	for i := range members {
+		if members[i].ID != leader.ID {
+			replicas = append(replicas, &members[i])
+		}
+	}
+
+	methods := map[string]string{}
+	for i, replica := range replicas {
+		s.setOperationStep(op, (i+1)*90/len(members), fmt.Sprintf("resizing replica %s", replica.ID))
+		method, err := s.resizePatroniNode(ctx, replica, resources, !req.ForceRecreate)
+		if err != nil {
+			return fmt.Errorf("failed to resize replica %s: %w", replica.ID, err)
+		}
+		methods[replica.ID] = method
+	}
+
+	s.setOperationStep(op, 90, fmt.Sprintf("resizing leader %s", leader.ID))
+	// A live update keeps the leader serving; a recreate needs a switchover first
+	liveErr := fmt.Errorf("recreate forced")
+	if !req.ForceRecreate {
+		liveErr = s.dockerSvc.UpdateContainerResources(ctx, leader.ContainerID, resources)
+	}
+	if liveErr == nil {
+		methods[leader.ID] = "live"
+	} else {
+		if len(replicas) > 0 {
+			s.setOperationStep(op, 92, fmt.Sprintf("switching over to %s", replicas[0].ID))
+			if err := s.patroniSwitchover(ctx, cluster.ID, leader, replicas[0], "resize"); err != nil {
+				return fmt.Errorf("switchover failed: %w", err)
+			}
+		}
+		s.setOperationStep(op, 95, fmt.Sprintf("recreating former leader %s", leader.ID))
+		if err := s.recreatePatroniNode(ctx, leader, "", &resources); err != nil {
+			return fmt.Errorf("failed to resize former leader %s: %w", leader.ID, err)
+		}
+		methods[leader.ID] = "recreate"
+	}
+	s.setOperationDetail(op, "node_methods", methods)
+
+	cluster.CPULimit = req.CPUPerNode
+	cluster.MemoryLimit = req.MemoryPerNode
+	if err := s.clusterRepo.Update(cluster); err != nil {
+		return fmt.Errorf("failed to update cluster limits: %w", err)
+	}
+	s.cacheService.InvalidateClusterInfo(ctx, cluster.ID)
+	s.publishEvent(ctx, "cluster.resized", cluster.InfrastructureID, cluster.ID, string(entities.StatusRunning))
+
+	return nil
+}
+
+// resizePatroniNode applies new limits to a node, live when allowed and possible, otherwise by recreating it
+func (s *postgreSQLClusterService) resizePatroniNode(ctx context.Context, node *entities.ClusterNode, resources docker.ResourceConfig, allowLive bool) (string, error) {
+	if allowLive {
+		err := s.dockerSvc.UpdateContainerResources(ctx, node.ContainerID, resources)
+		if err == nil {
+			return "live", nil
+		}
+		s.logger.Warn("live resize failed, recreating node", zap.String("node_id", node.ID), zap.Error(err))
+	}
+
+	if err := s.recreatePatroniNode(ctx, node, "", &resources); err != nil {
+		return "", err
+	}
+	return "recreate", nil
+}
@@ -3,8 +3,10 @@ package services
 import (
 	"context"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
@@ -12,6 +14,7 @@ import (
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/kafka"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/pki"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
 	"github.com/docker/docker/api/types"
 	"github.com/google/uuid"
@@ -59,6 +62,45 @@ type IPostgreSQLClusterService interface {
 	GetTables(ctx context.Context, clusterID, database string) ([]dto.TableInfo, error)
 	GetTableSchema(ctx context.Context, clusterID, database, table string) (*dto.TableSchemaResponse, error)
 	GetTableData(ctx context.Context, clusterID, database, table, page, limit string) (*dto.QueryResult, error)
+
+	// Version upgrades, resizing & operations
+	UpgradeCluster(ctx context.Context, clusterID string, req dto.UpgradeClusterRequest) (*dto.UpgradeClusterResponse, error)
+	ResizeCluster(ctx context.Context, clusterID string, req dto.ResizeClusterRequest) (*dto.ClusterOperationInfo, error)
+	ListOperations(ctx context.Context, clusterID string) ([]dto.ClusterOperationInfo, error)
+	GetOperation(ctx context.Context, clusterID, operationID string) (*dto.ClusterOperationInfo, error)
+
+	// Standby (disaster recovery) clusters
+	CreateStandbyCluster(ctx context.Context, userID, sourceClusterID string, req dto.CreateStandbyClusterRequest) (*dto.ClusterInfoResponse, error)
+	GetStandbyStatus(ctx context.Context, clusterID string) (*dto.StandbyStatusResponse, error)
+	PromoteStandbyCluster(ctx context.Context, clusterID string, req dto.PromoteStandbyRequest) (*dto.ClusterInfoResponse, error)
+
+	// Extensions
+	ListExtensions(ctx context.Context, clusterID, database string) (*dto.ListExtensionsResponse, error)
+	CreateExtension(ctx context.Context, clusterID, database string, req dto.CreateExtensionRequest) (*dto.ExtensionChangeResponse, error)
+	DropExtension(ctx context.Context, clusterID, database, name string, cascade bool) (*dto.ExtensionChangeResponse, error)
+
+	// Query insights
+	GetQueryInsights(ctx context.Context, clusterID string, limit int, minDuration time.Duration) (*dto.QueryInsightsResponse, error)
+	CancelQuery(ctx context.Context, clusterID string, req dto.CancelQueryRequest) error
+	CreateQuerySnapshot(ctx context.Context, clusterID string, req dto.CreateQuerySnapshotRequest) (*dto.QuerySnapshotInfo, error)
+	ListQuerySnapshots(ctx context.Context, clusterID string, limit int) ([]dto.QuerySnapshotInfo, error)
+	CompareQuerySnapshots(ctx context.Context, clusterID, fromID, toID string) (*dto.QuerySnapshotComparison, error)
+	StartQuerySnapshots(ctx context.Context)
+
+	// Logical dump/restore
+	ExportDatabase(ctx context.Context, clusterID, database string, opts dto.DumpOptions, w io.Writer) error
+	ImportDatabase(ctx context.Context, clusterID, database string, req dto.ImportDatabaseRequest, dump io.Reader) (*dto.ClusterOperationInfo, error)
+	CopyDatabase(ctx context.Context, clusterID, database string, req dto.CopyDatabaseRequest) (*dto.ClusterOperationInfo, error)
+
+	// TLS
+	GetTLSStatus(ctx context.Context, clusterID string) (*dto.ClusterTLSStatus, error)
+	EnableTLS(ctx context.Context, clusterID string) (*dto.ClusterOperationInfo, error)
+	DisableTLS(ctx context.Context, clusterID string) (*dto.ClusterOperationInfo, error)
+	RotateCertificates(ctx context.Context, clusterID string) (*dto.ClusterOperationInfo, error)
+	StartCertificateRotation(ctx context.Context)
+
+	// Operations
+	RecoverOperations(ctx context.Context)
 }
 
 type postgreSQLClusterService struct {
@@ -67,7 +109,11 @@ type postgreSQLClusterService struct {
 	dockerSvc     docker.IDockerService
 	kafkaProducer kafka.IKafkaProducer
 	cacheService  ICacheService
+	keyCipher     *pki.KeyCipher
 	logger        logger.ILogger
+
+	// operationsMu makes checking for a running operation and recording a new one atomic
+	operationsMu sync.Mutex
 }
 
 func NewPostgreSQLClusterService(
@@ -76,6 +122,7 @@ func NewPostgreSQLClusterService(
 	dockerSvc docker.IDockerService,
 	kafkaProducer kafka.IKafkaProducer,
 	cacheService ICacheService,
+	keyCipher *pki.KeyCipher,
 	logger logger.ILogger,
 ) IPostgreSQLClusterService {
 	return &postgreSQLClusterService{
@@ -84,12 +131,18 @@ func NewPostgreSQLClusterService(
 		dockerSvc:     dockerSvc,
 		kafkaProducer: kafkaProducer,
 		cacheService:  cacheService,
+		keyCipher:     keyCipher,
 		logger:        logger,
 	}
 }
 
 // CreateCluster creates a PostgreSQL HA cluster with Patroni + etcd + HAProxy
 func (s *postgreSQLClusterService) CreateCluster(ctx context.Context, userID string, req dto.CreateClusterRequest) (*dto.ClusterInfoResponse, error) {
+	return s.createCluster(ctx, userID, req, nil)
+}
+
+// createCluster provisions etcd, Patroni nodes and HAProxy; a non-nil source makes it a standby cluster
+func (s *postgreSQLClusterService) createCluster(ctx context.Context, userID string, req dto.CreateClusterRequest, source *standbySource) (*dto.ClusterInfoResponse, error) {
 	s.logger.Info("creating PostgreSQL HA cluster with Patroni", zap.String("name", req.ClusterName), zap.Int("nodes", req.NodeCount))
 
 	if req.NodeCount < 1 {
@@ -144,6 +197,7 @@ func (s *postgreSQLClusterService) CreateCluster(ctx context.Context, userID str
 		Password:         req.PostgreSQLPassword,
 		CPULimit:         req.CPUPerNode,
 		MemoryLimit:      req.MemoryPerNode,
+		TLSEnabled:       req.EnableTLS,
 	}
 	if err := s.clusterRepo.Create(cluster); err != nil {
 		return nil, fmt.Errorf("failed to create cluster: %w", err)
@@ -158,8 +212,19 @@ func (s *postgreSQLClusterService) CreateCluster(ctx context.Context, userID str
 	}
 
 	cluster.NetworkID = networkID
+	if source != nil {
+		cluster.StandbyOfClusterID = source.clusterID
+	}
 	s.clusterRepo.Update(cluster)
 
+	// Standby nodes reach the source primary through its HAProxy, attached to this network
+	if source != nil {
+		if err := s.dockerSvc.ConnectNetwork(ctx, networkID, source.proxyContainerID, []string{standbySourceAlias}); err != nil {
+			s.cleanup(ctx, cluster, networkID)
+			return nil, fmt.Errorf("failed to attach source proxy: %w", err)
+		}
+	}
+
 	// Step 1: Create a single etcd node for DCS (faster bootstrap)
 	s.logger.Info("creating single etcd node for DCS")
 	if _, err := s.createEtcdNode(ctx, cluster, req, networkName); err != nil {
@@ -371,6 +436,22 @@ func (s *postgreSQLClusterService) createPatroniNode(ctx context.Context, cluste
 		"PGDATA=/data/patroni",
 	}
 
+	var tlsFiles *nodeTLSFiles
+	if cluster.TLSEnabled {
+		var err error
+		tlsFiles, err = s.newNodeTLSFiles(cluster.ID, nodeID, []string{nodeName, fmt.Sprintf("%s-haproxy", projectName)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to issue node certificate: %w", err)
+		}
+	}
+
+	if cluster.StandbyOfClusterID != "" {
+		env = append(env,
+			fmt.Sprintf("STANDBY_HOST=%s", standbySourceAlias),
+			"STANDBY_PORT=5000",
+		)
+	}
+
 	// PgBackRest configuration
 	if req.EnableBackup {
 		env = append(env,
@@ -388,9 +469,14 @@ func (s *postgreSQLClusterService) createPatroniNode(ctx context.Context, cluste
 		serviceRole = "primary"
 	}
 
+	image := "postgre_db" // Short tag for Patroni-based PostgreSQL HA image
+	if req.Image != "" {
+		image = req.Image
+	}
+
 	config := docker.ContainerConfig{
 		Name:  containerName,
-		Image: "postgre_db", // Short tag for Patroni-based PostgreSQL HA image
+		Image: image,
 		Env:   env,
 		Ports: map[string]string{"5432": "0", "8008": "0"},
 		Volumes: map[string]string{
@@ -416,6 +502,12 @@ func (s *postgreSQLClusterService) createPatroniNode(ctx context.Context, cluste
 	if err != nil {
 		return nil, fmt.Errorf("failed to create patroni container: %w", err)
 	}
+	if tlsFiles != nil {
+		if err := s.installNodeTLSFiles(ctx, containerID, tlsFiles); err != nil {
+			s.dockerSvc.RemoveContainer(ctx, containerID)
+			return nil, fmt.Errorf("failed to install node certificate: %w", err)
+		}
+	}
 
 	if err := s.dockerSvc.StartContainer(ctx, containerID); err != nil {
 		return nil, fmt.Errorf("failed to start patroni container: %w", err)
@@ -565,6 +657,7 @@ func (s *postgreSQLClusterService) updateInfraStatus(infraID string, status enti
 }
 
 func (s *postgreSQLClusterService) cleanup(ctx context.Context, cluster *entities.PostgreSQLCluster, networkID string) {
+	s.detachStandbySource(ctx, cluster)
 	nodes, _ := s.clusterRepo.ListNodes(cluster.ID)
 	for _, node := range nodes {
 		s.dockerSvc.StopContainer(ctx, node.ContainerID)
@@ -679,16 +772,18 @@ func (s *postgreSQLClusterService) GetClusterInfo(ctx context.Context, clusterID
 	}
 
 	response := &dto.ClusterInfoResponse{
-		ClusterID:         cluster.ID,
-		InfrastructureID:  cluster.InfrastructureID,
-		ClusterName:       infra.Name,
-		PostgreSQLVersion: cluster.Version,
-		Status:            string(infra.Status),
-		ReplicationMode:   cluster.ReplicationMode,
-		WriteEndpoint:     writeEndpoint,
-		ReadEndpoints:     readEndpoints,
-		HAProxyPort:       cluster.HAProxyPort,
-		Nodes:             nodeInfos,
+		ClusterID:          cluster.ID,
+		InfrastructureID:   cluster.InfrastructureID,
+		ClusterName:        infra.Name,
+		PostgreSQLVersion:  cluster.Version,
+		Status:             string(infra.Status),
+		ReplicationMode:    cluster.ReplicationMode,
+		WriteEndpoint:      writeEndpoint,
+		ReadEndpoints:      readEndpoints,
+		HAProxyPort:        cluster.HAProxyPort,
+		Nodes:              nodeInfos,
+		StandbyOfClusterID: cluster.StandbyOfClusterID,
+		TLSEnabled:         cluster.TLSEnabled,
 		ConnectionInfo: &dto.PostgresConnectionInfo{
 			Host:     writeEndpoint.Host,
 			Port:     connPort,
@@ -700,6 +795,20 @@ func (s *postgreSQLClusterService) GetClusterInfo(ctx context.Context, clusterID
 		UpdatedAt: cluster.UpdatedAt.Format(time.RFC3339),
 	}
 
+	// Server certificates carry localhost, so clients on the host can verify the HAProxy endpoint
+	connInfo := response.ConnectionInfo
+	if cluster.TLSEnabled {
+		connInfo.SSLMode = "verify-full"
+		if ca, err := s.clusterRepo.FindCertificateAuthority(platformCAName); err == nil {
+			connInfo.CACertificate = ca.CertPEM
+		}
+	}
+	connInfo.ConnectionString = fmt.Sprintf("postgresql://%s@%s:%d/%s?sslmode=%s",
+		connInfo.Username, connInfo.Host, connInfo.Port, connInfo.Database, connInfo.SSLMode)
+	if cluster.TLSEnabled {
+		connInfo.ConnectionString += "&sslrootcert=platform-ca.crt"
+	}
+
 	s.cacheService.SetClusterInfo(ctx, clusterID, response, 5*time.Minute)
 
 	return response, nil
@@ -815,6 +924,7 @@ func (s *postgreSQLClusterService) DeleteCluster(ctx context.Context, clusterID
 
 	// Remove network
 	if cluster.NetworkID != "" {
+		s.detachStandbySource(ctx, cluster)
 		s.dockerSvc.RemoveNetwork(ctx, cluster.NetworkID)
 	}
 
@@ -1013,11 +1123,16 @@ func (s *postgreSQLClusterService) AddNode(ctx context.Context, clusterID string
 		scope = "admin" // Fallback
 	}
 	namespace := "percona_lab" // Default namespace same as createPatroniNode
+	image := "postgre_db"
 
-	// Get namespace from existing patroni container for consistency
+	// Get namespace and image from existing patroni container for consistency
 	if existingPatroniNode != nil && existingPatroniNode.ContainerID != "" {
 		inspect, err := s.dockerSvc.InspectContainer(ctx, existingPatroniNode.ContainerID)
 		if err == nil && inspect != nil {
+			// Keep new replicas on the same PostgreSQL version after upgrades
+			if inspect.Config.Image != "" {
+				image = inspect.Config.Image
+			}
 			for _, envVar := range inspect.Config.Env {
 				if len(envVar) > 10 && envVar[:10] == "NAMESPACE=" {
 					namespace = envVar[10:]
@@ -1053,9 +1168,17 @@ func (s *postgreSQLClusterService) AddNode(ctx context.Context, clusterID string
 		"PGDATA=/data/patroni",
 	}
 
+	var tlsFiles *nodeTLSFiles
+	if cluster.TLSEnabled {
+		tlsFiles, err = s.newNodeTLSFiles(cluster.ID, nodeID, []string{nodeName, fmt.Sprintf("%s-haproxy", projectName)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to issue node certificate: %w", err)
+		}
+	}
+
 	config := docker.ContainerConfig{
 		Name:  containerName,
-		Image: "postgre_db", // Patroni-based PostgreSQL HA image (same as createPatroniNode)
+		Image: image, // Patroni-based PostgreSQL HA image (same as existing nodes)
 		Env:   env,
 		Ports: map[string]string{"5432": "0", "8008": "0"},
 		Volumes: map[string]string{
@@ -1081,6 +1204,14 @@ func (s *postgreSQLClusterService) AddNode(ctx context.Context, clusterID string
 	if err != nil {
 		return nil, fmt.Errorf("failed to create container: %w", err)
 	}
+	if tlsFiles != nil {
+		if err := s.installNodeTLSFiles(ctx, containerID, tlsFiles); err != nil {
+			s.dockerSvc.RemoveContainer(ctx, containerID)
+			s.dockerSvc.RemoveVolume(ctx, volumeName)
+			s.dockerSvc.RemoveVolume(ctx, backupVolumeName)
+			return nil, fmt.Errorf("failed to install node certificate: %w", err)
+		}
+	}
 
 	if err := s.dockerSvc.StartContainer(ctx, containerID); err != nil {
 		// Cleanup on failure
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// standbySourceAlias is the name the source HAProxy gets on a standby cluster's network
+const standbySourceAlias = "standby-source"
+
+// standbySource describes the cluster a new standby cluster replicates from
+type standbySource struct {
+	clusterID        string
+	proxyContainerID string
+}
+
+// CreateStandbyCluster creates a cluster that bootstraps as a Patroni standby_cluster of the source
+// and keeps streaming WAL from the source primary (through its HAProxy) until it is promoted.
+func (s *postgreSQLClusterService) CreateStandbyCluster(ctx context.Context, userID, sourceClusterID string, req dto.CreateStandbyClusterRequest) (*dto.ClusterInfoResponse, error) {
+	source, err := s.clusterRepo.FindByID(sourceClusterID)
+	if err != nil {
+		return nil, fmt.Errorf("source cluster not found: %w", err)
+	}
+	if source.Infrastructure.Status != entities.StatusRunning {
+		return nil, fmt.Errorf("source cluster must be running (status: %s)", source.Infrastructure.Status)
+	}
+	if source.StandbyOfClusterID != "" {
+		return nil, fmt.Errorf("source cluster is itself a standby cluster, cascading standbys are not supported")
+	}
+
+	proxy, err := s.clusterProxyNode(sourceClusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := s.clusterRepo.ListNodes(sourceClusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+	leader, err := s.findPatroniLeader(ctx, members)
+	if err != nil {
+		return nil, err
+	}
+	inspect, err := s.dockerSvc.InspectContainer(ctx, leader.ContainerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect source leader: %w", err)
+	}
+
+	// The standby is a physical copy, so version, image and superuser password follow the source
+	createReq := dto.CreateClusterRequest{
+		ClusterName:        req.ClusterName,
+		PostgreSQLVersion:  source.Version,
+		NodeCount:          req.NodeCount,
+		CPUPerNode:         req.CPUPerNode,
+		MemoryPerNode:      req.MemoryPerNode,
+		PostgreSQLPassword: source.Password,
+		ReplicationMode:    source.ReplicationMode,
+		Image:              inspect.Config.Image,
+	}
+	if createReq.NodeCount == 0 {
+		createReq.NodeCount = len(members)
+	}
+	if createReq.CPUPerNode == 0 {
+		createReq.CPUPerNode = source.CPULimit
+	}
+	if createReq.MemoryPerNode == 0 {
+		createReq.MemoryPerNode = source.MemoryLimit
+	}
+
+	s.logger.Info("creating standby cluster",
+		zap.String("source_cluster_id", sourceClusterID),
+		zap.String("name", req.ClusterName),
+		zap.Int("nodes", createReq.NodeCount))
+
+	info, err := s.createCluster(ctx, userID, createReq, &standbySource{
+		clusterID:        sourceClusterID,
+		proxyContainerID: proxy.ContainerID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishEvent(ctx, "cluster.standby_created", info.InfrastructureID, info.ClusterID, string(entities.StatusRunning))
+	return info, nil
+}
+
+// GetStandbyStatus compares the source primary WAL position with what the standby has received and replayed
+func (s *postgreSQLClusterService) GetStandbyStatus(ctx context.Context, clusterID string) (*dto.StandbyStatusResponse, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	if cluster.StandbyOfClusterID == "" {
+		return nil, fmt.Errorf("cluster is not a standby cluster")
+	}
+
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	standbyLeader, err := s.findPatroniLeader(ctx, patroniMembers(nodes))
+	if err != nil {
+		return nil, fmt.Errorf("standby leader: %w", err)
+	}
+
+	sourceNodes, err := s.clusterRepo.ListNodes(cluster.StandbyOfClusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source nodes: %w", err)
+	}
+	sourceLeader, err := s.findPatroniLeader(ctx, patroniMembers(sourceNodes))
+	if err != nil {
+		return nil, fmt.Errorf("source leader: %w", err)
+	}
+
+	sourceLSN, err := s.psql(ctx, sourceLeader.ContainerID, "postgres", "SELECT pg_current_wal_lsn()")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source WAL position: %w", err)
+	}
+
+	query := fmt.Sprintf(`SELECT coalesce(pg_last_wal_receive_lsn()::text, ''),
+		coalesce(pg_last_wal_replay_lsn()::text, ''),
+		coalesce(pg_wal_lsn_diff(%s, pg_last_wal_replay_lsn())::bigint, 0),
+		coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0),
+		coalesce(to_char(pg_last_xact_replay_timestamp() AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'), ''),
+		(SELECT count(*) FROM pg_stat_wal_receiver WHERE status = 'streaming')`, sqlLiteral(sourceLSN))
+	output, err := s.psql(ctx, standbyLeader.ContainerID, "postgres", query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read standby WAL position: %w", err)
+	}
+	fields := strings.Split(output, "|")
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("unexpected standby status output: %s", output)
+	}
+
+	standbyName, _ := s.patroniMemberName(ctx, standbyLeader)
+	sourceName, _ := s.patroniMemberName(ctx, sourceLeader)
+
+	status := &dto.StandbyStatusResponse{
+		ClusterID:       clusterID,
+		SourceClusterID: cluster.StandbyOfClusterID,
+		StandbyLeader:   standbyName,
+		SourceLeader:    sourceName,
+		Streaming:       fields[5] != "0",
+		SourceLSN:       sourceLSN,
+		ReceiveLSN:      fields[0],
+		ReplayLSN:       fields[1],
+		LastReplayedAt:  fields[4],
+		CheckedAt:       time.Now().Format(time.RFC3339),
+	}
+	status.LagBytes, _ = strconv.ParseInt(fields[2], 10, 64)
+	// Replay timestamp only moves with new transactions, so an idle source is not lag
+	if status.LagBytes > 0 {
+		status.ReplayLagSeconds, _ = strconv.ParseFloat(fields[3], 64)
+	}
+
+	return status, nil
+}
+
+// PromoteStandbyCluster removes the standby_cluster section from the Patroni config so the standby
+// leader promotes, then detaches the cluster from its source and records the event on both sides.
+func (s *postgreSQLClusterService) PromoteStandbyCluster(ctx context.Context, clusterID string, req dto.PromoteStandbyRequest) (*dto.ClusterInfoResponse, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	if cluster.StandbyOfClusterID == "" {
+		return nil, fmt.Errorf("cluster is not a standby cluster")
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "standby_promotion"
+	}
+
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	leader, err := s.findPatroniLeader(ctx, patroniMembers(nodes))
+	if err != nil {
+		return nil, err
+	}
+	leaderName, _ := s.patroniMemberName(ctx, leader)
+
+	s.logger.Info("promoting standby cluster",
+		zap.String("cluster_id", clusterID),
+		zap.String("source_cluster_id", cluster.StandbyOfClusterID),
+		zap.String("standby_leader", leaderName))
+
+	if _, err := s.dockerSvc.ExecCommand(ctx, leader.ContainerID, []string{
+		"curl", "-s", "-X", "PATCH", "-H", "Content-Type: application/json",
+		"-d", `{"standby_cluster": null}`, "http://localhost:8008/config",
+	}); err != nil {
+		return nil, fmt.Errorf("failed to update patroni config: %w", err)
+	}
+
+	deadline := time.Now().Add(90 * time.Second)
+	for {
+		output, _ := s.dockerSvc.ExecCommand(ctx, leader.ContainerID, []string{"curl", "-s", "http://localhost:8008"})
+		if isPatroniLeader(output) && !strings.Contains(output, "standby_leader") {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("standby leader %s was not promoted in time", leaderName)
+		}
+		time.Sleep(3 * time.Second)
+	}
+
+	sourceClusterID := cluster.StandbyOfClusterID
+	s.detachStandbySource(ctx, cluster)
+	cluster.StandbyOfClusterID = ""
+	cluster.PrimaryNodeID = leader.ID
+	if err := s.clusterRepo.Update(cluster); err != nil {
+		return nil, fmt.Errorf("failed to update cluster: %w", err)
+	}
+
+	// Standby side: the standby leader became a read-write primary
+	standbyEvent := &entities.FailoverEvent{
+		ID:             uuid.New().String(),
+		ClusterID:      clusterID,
+		OldPrimaryID:   sourceClusterID,
+		OldPrimaryName: "standby_of:" + sourceClusterID,
+		NewPrimaryID:   leader.ID,
+		NewPrimaryName: leaderName,
+		Reason:         reason,
+		TriggeredBy:    "user",
+	}
+	if err := s.clusterRepo.CreateFailoverEvent(standbyEvent); err != nil {
+		s.logger.Error("failed to record failover event", zap.Error(err))
+	}
+
+	// Source side: the data set now has a second, independent primary; the source may be gone in a real disaster
+	if source, err := s.clusterRepo.FindByID(sourceClusterID); err == nil {
+		sourceEvent := &entities.FailoverEvent{
+			ID:             uuid.New().String(),
+			ClusterID:      sourceClusterID,
+			OldPrimaryID:   source.PrimaryNodeID,
+			NewPrimaryID:   leader.ID,
+			NewPrimaryName: fmt.Sprintf("%s/%s", cluster.Infrastructure.Name, leaderName),
+			Reason:         reason,
+			TriggeredBy:    "user",
+		}
+		if sourceNodes, err := s.clusterRepo.ListNodes(sourceClusterID); err == nil {
+			if sourceLeader, err := s.findPatroniLeader(ctx, patroniMembers(sourceNodes)); err == nil {
+				sourceEvent.OldPrimaryID = sourceLeader.ID
+				sourceEvent.OldPrimaryName, _ = s.patroniMemberName(ctx, sourceLeader)
+			}
+		}
+		if err := s.clusterRepo.CreateFailoverEvent(sourceEvent); err != nil {
+			s.logger.Error("failed to record failover event", zap.Error(err))
+		}
+		s.cacheService.InvalidateClusterInfo(ctx, sourceClusterID)
+	}
+
+	s.cacheService.InvalidateClusterInfo(ctx, clusterID)
+	s.publishEvent(ctx, "cluster.standby_promoted", cluster.InfrastructureID, clusterID, string(entities.StatusRunning))
+
+	return s.GetClusterInfo(ctx, clusterID)
+}
+
+// clusterProxyNode returns the HAProxy node of a cluster
+func (s *postgreSQLClusterService) clusterProxyNode(clusterID string) (*entities.ClusterNode, error) {
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for i := range nodes {
+		if nodes[i].Role == "haproxy" {
+			return &nodes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("cluster %s has no HAProxy node", clusterID)
+}
+
+// detachStandbySource disconnects the source cluster's HAProxy from a standby cluster's network
+func (s *postgreSQLClusterService) detachStandbySource(ctx context.Context, cluster *entities.PostgreSQLCluster) {
+	if cluster.StandbyOfClusterID == "" || cluster.NetworkID == "" {
+		return
+	}
+	proxy, err := s.clusterProxyNode(cluster.StandbyOfClusterID)
+	if err != nil {
+		return
+	}
+	if err := s.dockerSvc.DisconnectNetwork(ctx, cluster.NetworkID, proxy.ContainerID); err != nil {
+		s.logger.Warn("failed to detach source proxy", zap.String("cluster_id", cluster.ID), zap.Error(err))
+	}
+}
@@ -0,0 +1,646 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/pki"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	platformCAName        = "platform-internal"
+	platformCAValidity    = 10 * 365 * 24 * time.Hour
+	nodeCertValidity      = 365 * 24 * time.Hour
+	nodeCertRenewBefore   = 30 * 24 * time.Hour
+	certRotationInterval  = 6 * time.Hour
+	patroniTLSDir         = "/etc/patroni/tls"
+	patroniTLSCertFile    = patroniTLSDir + "/server.crt"
+	patroniTLSKeyFile     = patroniTLSDir + "/server.key"
+	patroniTLSCAFile      = patroniTLSDir + "/ca.crt"
+	patroniConfigFile     = "/etc/patroni/patroni.yml"
+	tlsSettingsApplyLimit = 2 * time.Minute
+)
+
+// GetTLSStatus returns whether TLS is on and the active certificate of every node
+func (s *postgreSQLClusterService) GetTLSStatus(ctx context.Context, clusterID string) (*dto.ClusterTLSStatus, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	status := &dto.ClusterTLSStatus{
+		ClusterID: clusterID,
+		Enabled:   cluster.TLSEnabled,
+		Nodes:     make([]dto.NodeCertificateInfo, 0),
+	}
+	if ca, err := s.clusterRepo.FindCertificateAuthority(platformCAName); err == nil {
+		status.CACertificate = ca.CertPEM
+		status.CAExpiresAt = ca.NotAfter.Format(time.RFC3339)
+	}
+
+	for _, node := range patroniMembers(nodes) {
+		cert, err := s.clusterRepo.FindLatestNodeCertificate(node.ID)
+		if err != nil {
+			continue
+		}
+		var dnsNames []string
+		json.Unmarshal([]byte(cert.DNSNames), &dnsNames)
+		fingerprint, _ := pki.Fingerprint([]byte(cert.CertPEM))
+		status.Nodes = append(status.Nodes, dto.NodeCertificateInfo{
+			NodeID:       node.ID,
+			CommonName:   cert.CommonName,
+			DNSNames:     dnsNames,
+			SerialNumber: cert.SerialNumber,
+			Fingerprint:  fingerprint,
+			NotBefore:    cert.NotBefore.Format(time.RFC3339),
+			NotAfter:     cert.NotAfter.Format(time.RFC3339),
+			DaysLeft:     int(time.Until(cert.NotAfter).Hours() / 24),
+		})
+	}
+	return status, nil
+}
+
+// EnableTLS issues server certificates for every node, installs them and turns on ssl through the
+// Patroni DCS. ssl and the certificate paths are reload-only settings, so no node is restarted.
+func (s *postgreSQLClusterService) EnableTLS(ctx context.Context, clusterID string) (*dto.ClusterOperationInfo, error) {
+	cluster, err := s.runningCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	op, err := s.startOperation(clusterID, "tls", map[string]interface{}{"action": "enable"})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		bgCtx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		defer cancel()
+		s.finishOperation(op, s.runEnableTLS(bgCtx, op, cluster))
+	}()
+
+	info := toOperationDTO(op)
+	return &info, nil
+}
+
+// DisableTLS turns ssl off again; certificates stay on the nodes so TLS can be re-enabled quickly
+func (s *postgreSQLClusterService) DisableTLS(ctx context.Context, clusterID string) (*dto.ClusterOperationInfo, error) {
+	cluster, err := s.runningCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	if !cluster.TLSEnabled {
+		return nil, fmt.Errorf("TLS is not enabled on this cluster")
+	}
+
+	op, err := s.startOperation(clusterID, "tls", map[string]interface{}{"action": "disable"})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		bgCtx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		s.finishOperation(op, s.runDisableTLS(bgCtx, op, cluster))
+	}()
+
+	info := toOperationDTO(op)
+	return &info, nil
+}
+
+// RotateCertificates issues new certificates and swaps them in one node at a time, reloading
+// PostgreSQL after each swap. A node that fails verification gets its previous certificate back.
+func (s *postgreSQLClusterService) RotateCertificates(ctx context.Context, clusterID string) (*dto.ClusterOperationInfo, error) {
+	cluster, err := s.runningCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	if !cluster.TLSEnabled {
+		return nil, fmt.Errorf("TLS is not enabled on this cluster")
+	}
+	return s.startCertificateRotation(cluster, "manual")
+}
+
+// StartCertificateRotation periodically rotates node certificates that are about to expire
+func (s *postgreSQLClusterService) StartCertificateRotation(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(certRotationInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.rotateExpiringCertificates()
+			}
+		}
+	}()
+}
+
+func (s *postgreSQLClusterService) rotateExpiringCertificates() {
+	clusters, err := s.clusterRepo.ListAll()
+	if err != nil {
+		s.logger.Warn("failed to list clusters for certificate rotation", zap.Error(err))
+		return
+	}
+	for i := range clusters {
+		cluster := &clusters[i]
+		if !cluster.TLSEnabled || cluster.Infrastructure.Status != entities.StatusRunning {
+			continue
+		}
+		nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+		if err != nil {
+			continue
+		}
+		expiring := false
+		for _, node := range patroniMembers(nodes) {
+			cert, err := s.clusterRepo.FindLatestNodeCertificate(node.ID)
+			if err != nil || time.Until(cert.NotAfter) < nodeCertRenewBefore {
+				expiring = true
+				break
+			}
+		}
+		if !expiring {
+			continue
+		}
+		if _, err := s.startCertificateRotation(cluster, "expiry"); err != nil {
+			s.logger.Warn("failed to start certificate rotation", zap.String("cluster_id", cluster.ID), zap.Error(err))
+		}
+	}
+}
+
+func (s *postgreSQLClusterService) startCertificateRotation(cluster *entities.PostgreSQLCluster, reason string) (*dto.ClusterOperationInfo, error) {
+	op, err := s.startOperation(cluster.ID, "tls", map[string]interface{}{"action": "rotate", "reason": reason})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		bgCtx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		defer cancel()
+		s.finishOperation(op, s.runRotateCertificates(bgCtx, op, cluster))
+	}()
+
+	info := toOperationDTO(op)
+	return &info, nil
+}
+
+func (s *postgreSQLClusterService) runEnableTLS(ctx context.Context, op *entities.ClusterOperation, cluster *entities.PostgreSQLCluster) error {
+	ca, err := s.platformCA()
+	if err != nil {
+		return err
+	}
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+	if len(members) == 0 {
+		return fmt.Errorf("cluster has no patroni nodes")
+	}
+
+	// Every node needs its files before ssl is switched on, otherwise the reload fails on that node
+	for i := range members {
+		node := &members[i]
+		s.setOperationStep(op, 10+50*i/len(members), fmt.Sprintf("installing certificate on %s", node.ID))
+		cert, err := s.issueCertificateForNode(ctx, cluster, node, ca)
+		if err != nil {
+			return err
+		}
+		if err := s.writeNodeCertificate(ctx, node, string(cert.CertPEM), string(cert.KeyPEM), string(ca.CertPEM)); err != nil {
+			return fmt.Errorf("failed to install certificate on %s: %w", node.ID, err)
+		}
+	}
+
+	leader, err := s.findPatroniLeader(ctx, members)
+	if err != nil {
+		return err
+	}
+	s.setOperationStep(op, 65, "enabling ssl")
+	if err := s.patroniPatchConfig(ctx, leader, tlsConfigPatch(true)); err != nil {
+		return err
+	}
+
+	for i := range members {
+		node := &members[i]
+		s.setOperationStep(op, 70+25*i/len(members), fmt.Sprintf("verifying TLS on %s", node.ID))
+		if err := s.waitForSSLSetting(ctx, node, "on"); err != nil {
+			return err
+		}
+		if err := s.verifyNodeTLS(ctx, node); err != nil {
+			return fmt.Errorf("TLS verification failed on %s: %w", node.ID, err)
+		}
+	}
+
+	// Only once every node serves TLS can plain connections be refused
+	s.setOperationStep(op, 95, "requiring TLS for remote connections")
+	for i := range members {
+		if err := s.setLocalTLSConfig(ctx, &members[i], true); err != nil {
+			return fmt.Errorf("failed to require TLS on %s: %w", members[i].ID, err)
+		}
+	}
+
+	cluster.TLSEnabled = true
+	if err := s.clusterRepo.Update(cluster); err != nil {
+		return fmt.Errorf("failed to update cluster: %w", err)
+	}
+	s.cacheService.InvalidateClusterInfo(ctx, cluster.ID)
+	s.publishEvent(ctx, "tls.enabled", cluster.InfrastructureID, cluster.ID, string(entities.StatusRunning))
+	return nil
+}
+
+func (s *postgreSQLClusterService) runDisableTLS(ctx context.Context, op *entities.ClusterOperation, cluster *entities.PostgreSQLCluster) error {
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+	leader, err := s.findPatroniLeader(ctx, members)
+	if err != nil {
+		return err
+	}
+
+	// Plain connections have to be accepted again before ssl goes off
+	s.setOperationStep(op, 10, "allowing plain connections")
+	for i := range members {
+		if err := s.setLocalTLSConfig(ctx, &members[i], false); err != nil {
+			return fmt.Errorf("failed to allow plain connections on %s: %w", members[i].ID, err)
+		}
+	}
+
+	s.setOperationStep(op, 20, "disabling ssl")
+	if err := s.patroniPatchConfig(ctx, leader, tlsConfigPatch(false)); err != nil {
+		return err
+	}
+	for i := range members {
+		s.setOperationStep(op, 30+60*i/len(members), fmt.Sprintf("waiting for %s", members[i].ID))
+		if err := s.waitForSSLSetting(ctx, &members[i], "off"); err != nil {
+			return err
+		}
+		// The entrypoint turns TLS on whenever the files are present
+		if err := s.execNodeShell(ctx, &members[i], fmt.Sprintf("rm -rf %s", patroniTLSDir)); err != nil {
+			return fmt.Errorf("failed to remove certificate from %s: %w", members[i].ID, err)
+		}
+	}
+
+	cluster.TLSEnabled = false
+	if err := s.clusterRepo.Update(cluster); err != nil {
+		return fmt.Errorf("failed to update cluster: %w", err)
+	}
+	s.cacheService.InvalidateClusterInfo(ctx, cluster.ID)
+	s.publishEvent(ctx, "tls.disabled", cluster.InfrastructureID, cluster.ID, string(entities.StatusRunning))
+	return nil
+}
+
+func (s *postgreSQLClusterService) runRotateCertificates(ctx context.Context, op *entities.ClusterOperation, cluster *entities.PostgreSQLCluster) error {
+	ca, err := s.platformCA()
+	if err != nil {
+		return err
+	}
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+
+	rotated := make([]string, 0, len(members))
+	for i := range members {
+		node := &members[i]
+		s.setOperationStep(op, 5+90*i/len(members), fmt.Sprintf("rotating certificate on %s", node.ID))
+		if err := s.rotateNodeCertificate(ctx, cluster, node, ca); err != nil {
+			s.setOperationDetail(op, "rotated_nodes", rotated)
+			return fmt.Errorf("rotation stopped at %s: %w", node.ID, err)
+		}
+		rotated = append(rotated, node.ID)
+	}
+	s.setOperationDetail(op, "rotated_nodes", rotated)
+
+	s.cacheService.InvalidateClusterInfo(ctx, cluster.ID)
+	s.publishEvent(ctx, "tls.rotated", cluster.InfrastructureID, cluster.ID, string(entities.StatusRunning))
+	return nil
+}
+
+// rotateNodeCertificate swaps the certificate of one node and reloads it, restoring the previous files on failure
+func (s *postgreSQLClusterService) rotateNodeCertificate(ctx context.Context, cluster *entities.PostgreSQLCluster, node *entities.ClusterNode, ca *pki.Certificate) error {
+	if err := s.execNodeShell(ctx, node, fmt.Sprintf("cd %s && cp -p server.crt server.crt.prev && cp -p server.key server.key.prev && cp -p ca.crt ca.crt.prev", patroniTLSDir)); err != nil {
+		return fmt.Errorf("failed to back up current certificate: %w", err)
+	}
+
+	cert, err := s.issueCertificateForNode(ctx, cluster, node, ca)
+	if err != nil {
+		return err
+	}
+	err = s.writeNodeCertificate(ctx, node, string(cert.CertPEM), string(cert.KeyPEM), string(ca.CertPEM))
+	if err == nil {
+		_, err = s.psql(ctx, node.ContainerID, "postgres", "SELECT pg_reload_conf()")
+	}
+	if err == nil {
+		err = s.verifyNodeTLS(ctx, node)
+	}
+	if err == nil {
+		return nil
+	}
+
+	s.logger.Error("certificate rotation failed, restoring previous certificate", zap.String("node_id", node.ID), zap.Error(err))
+	if restoreErr := s.execNodeShell(ctx, node, fmt.Sprintf("cd %s && mv -f server.crt.prev server.crt && mv -f server.key.prev server.key && mv -f ca.crt.prev ca.crt", patroniTLSDir)); restoreErr != nil {
+		s.logger.Error("failed to restore previous certificate", zap.String("node_id", node.ID), zap.Error(restoreErr))
+	} else {
+		s.psql(ctx, node.ContainerID, "postgres", "SELECT pg_reload_conf()")
+	}
+	return err
+}
+
+// platformCA loads the internal CA, creating it on first use
+func (s *postgreSQLClusterService) platformCA() (*pki.Certificate, error) {
+	if ca, err := s.clusterRepo.FindCertificateAuthority(platformCAName); err == nil {
+		return s.openCertificateAuthority(ca)
+	}
+
+	generated, err := pki.GenerateCA("IaaS Platform Internal CA", platformCAValidity)
+	if err != nil {
+		return nil, err
+	}
+	sealedKey, err := s.keyCipher.Seal(generated.KeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	record := &entities.CertificateAuthority{
+		ID:       uuid.New().String(),
+		Name:     platformCAName,
+		CertPEM:  string(generated.CertPEM),
+		KeyPEM:   sealedKey,
+		NotAfter: generated.NotAfter,
+	}
+	if err := s.clusterRepo.CreateCertificateAuthority(record); err != nil {
+		// Another operation created it concurrently
+		if ca, findErr := s.clusterRepo.FindCertificateAuthority(platformCAName); findErr == nil {
+			return s.openCertificateAuthority(ca)
+		}
+		return nil, fmt.Errorf("failed to store CA: %w", err)
+	}
+	s.logger.Info("created platform certificate authority", zap.Time("not_after", generated.NotAfter))
+	return generated, nil
+}
+
+func (s *postgreSQLClusterService) openCertificateAuthority(ca *entities.CertificateAuthority) (*pki.Certificate, error) {
+	keyPEM, err := s.keyCipher.Open(ca.KeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+	return &pki.Certificate{CertPEM: []byte(ca.CertPEM), KeyPEM: keyPEM, NotAfter: ca.NotAfter}, nil
+}
+
+// issueCertificateForNode issues a certificate for an existing node, valid for its container name and the cluster HAProxy
+func (s *postgreSQLClusterService) issueCertificateForNode(ctx context.Context, cluster *entities.PostgreSQLCluster, node *entities.ClusterNode, ca *pki.Certificate) (*pki.Certificate, error) {
+	nodeName, err := patroniNodeName(ctx, s.dockerSvc, node)
+	if err != nil {
+		return nil, err
+	}
+	hosts := []string{nodeName}
+	nodes, _ := s.clusterRepo.ListNodes(cluster.ID)
+	for _, n := range nodes {
+		if n.Role != "haproxy" || n.ContainerID == "" {
+			continue
+		}
+		if inspect, err := s.dockerSvc.InspectContainer(ctx, n.ContainerID); err == nil {
+			hosts = append(hosts, strings.TrimPrefix(inspect.Name, "/"))
+		}
+	}
+	return s.issueNodeCertificate(cluster.ID, node.ID, ca, hosts)
+}
+
+// issueNodeCertificate signs and stores a server certificate, its key encrypted; localhost is always included
+// for in-container checks
+func (s *postgreSQLClusterService) issueNodeCertificate(clusterID, nodeID string, ca *pki.Certificate, hosts []string) (*pki.Certificate, error) {
+	hosts = append(hosts, "localhost", "127.0.0.1")
+	issued, err := pki.IssueServerCertificate(ca, hosts[0], hosts, nodeCertValidity)
+	if err != nil {
+		return nil, err
+	}
+	sealedKey, err := s.keyCipher.Seal(issued.KeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	dnsNames, _ := json.Marshal(hosts)
+	cert := &entities.NodeCertificate{
+		ID:           uuid.New().String(),
+		ClusterID:    clusterID,
+		NodeID:       nodeID,
+		CommonName:   hosts[0],
+		DNSNames:     string(dnsNames),
+		SerialNumber: issued.SerialNumber,
+		CertPEM:      string(issued.CertPEM),
+		KeyPEM:       sealedKey,
+		NotBefore:    issued.NotBefore,
+		NotAfter:     issued.NotAfter,
+	}
+	if err := s.clusterRepo.CreateNodeCertificate(cert); err != nil {
+		return nil, fmt.Errorf("failed to store certificate: %w", err)
+	}
+	return issued, nil
+}
+
+// writeNodeCertificate installs certificate files in the node; each file is written aside and then moved into place
+func (s *postgreSQLClusterService) writeNodeCertificate(ctx context.Context, node *entities.ClusterNode, certPEM, keyPEM, caPEM string) error {
+	files := []struct {
+		path    string
+		content string
+	}{
+		{patroniTLSCertFile, certPEM},
+		{patroniTLSKeyFile, keyPEM},
+		{patroniTLSCAFile, caPEM},
+	}
+	for _, file := range files {
+		cmd := []string{"sh", "-c", fmt.Sprintf("umask 077 && mkdir -p %s && cat > %s.new", patroniTLSDir, file.path)}
+		if err := s.dockerSvc.ExecStream(ctx, node.ContainerID, cmd, strings.NewReader(file.content), nil); err != nil {
+			return err
+		}
+	}
+	return s.execNodeShell(ctx, node, fmt.Sprintf("cd %s && mv -f server.crt.new server.crt && mv -f server.key.new server.key && mv -f ca.crt.new ca.crt && chmod 600 server.key", patroniTLSDir))
+}
+
+func (s *postgreSQLClusterService) execNodeShell(ctx context.Context, node *entities.ClusterNode, script string) error {
+	return s.dockerSvc.ExecStream(ctx, node.ContainerID, []string{"sh", "-c", script}, nil, nil)
+}
+
+// verifyNodeTLS opens a verify-full connection over TCP inside the node, which checks the chain and host name
+func (s *postgreSQLClusterService) verifyNodeTLS(ctx context.Context, node *entities.ClusterNode) error {
+	conninfo := fmt.Sprintf("host=localhost hostaddr=127.0.0.1 port=5432 dbname=postgres user=postgres sslmode=verify-full sslrootcert=%s", patroniTLSCAFile)
+	var out bytes.Buffer
+	err := s.dockerSvc.ExecStream(ctx, node.ContainerID, []string{
+		"sh", "-c", fmt.Sprintf("PGPASSFILE=/opt/secretpg/pgpass psql %s -t -A -c %s",
+			shellQuote(conninfo), shellQuote("SELECT ssl FROM pg_stat_ssl WHERE pid = pg_backend_pid()")),
+	}, nil, &out)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(out.String()) != "t" {
+		return fmt.Errorf("connection is not encrypted")
+	}
+	return nil
+}
+
+// waitForSSLSetting waits until Patroni has applied the ssl setting from the DCS on a node
+func (s *postgreSQLClusterService) waitForSSLSetting(ctx context.Context, node *entities.ClusterNode, want string) error {
+	deadline := time.Now().Add(tlsSettingsApplyLimit)
+	for time.Now().Before(deadline) {
+		if value, err := s.psql(ctx, node.ContainerID, "postgres", "SHOW ssl"); err == nil && value == want {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(3 * time.Second):
+		}
+	}
+	return fmt.Errorf("node %s did not apply ssl=%s within %s", node.ID, want, tlsSettingsApplyLimit)
+}
+
+// runningCluster returns a cluster that is currently running
+func (s *postgreSQLClusterService) runningCluster(clusterID string) (*entities.PostgreSQLCluster, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	if cluster.Infrastructure.Status != entities.StatusRunning {
+		return nil, fmt.Errorf("cluster must be running (status: %s)", cluster.Infrastructure.Status)
+	}
+	return cluster, nil
+}
+
+func tlsConfigPatch(enabled bool) map[string]interface{} {
+	parameters := map[string]interface{}{"ssl": "off"}
+	if enabled {
+		parameters = map[string]interface{}{
+			"ssl":           "on",
+			"ssl_cert_file": patroniTLSCertFile,
+			"ssl_key_file":  patroniTLSKeyFile,
+			"ssl_ca_file":   patroniTLSCAFile,
+		}
+	}
+	return map[string]interface{}{"postgresql": map[string]interface{}{"parameters": parameters}}
+}
+
+// setLocalTLSConfig switches the local Patroni config between plain and TLS-only remote connections
+// (host or hostssl pg_hba rules, replication with sslmode prefer or verify-ca) and reloads it.
+// The entrypoint derives the same settings from the certificate files when the container restarts.
+func (s *postgreSQLClusterService) setLocalTLSConfig(ctx context.Context, node *entities.ClusterNode, enabled bool) error {
+	hba := `/0\.0\.0\.0\/0/ s/- hostssl /- host /`
+	sslmode := `s/^( +)sslmode: .*/\1sslmode: prefer/`
+	if enabled {
+		hba = `/0\.0\.0\.0\/0/ s/- host /- hostssl /`
+		sslmode = fmt.Sprintf(`s|^( +)sslmode: .*|\1sslmode: verify-ca\n\1sslrootcert: %s|`, patroniTLSCAFile)
+	}
+	script := fmt.Sprintf("sed -i -E -e %s -e %s -e %s %s && curl -sf -X POST http://localhost:8008/reload",
+		shellQuote("/^ +sslrootcert: /d"), shellQuote(hba), shellQuote(sslmode), patroniConfigFile)
+	return s.execNodeShell(ctx, node, script)
+}
+
+// nodeTLSFiles are the certificate files of a node, copied into its container before it starts
+type nodeTLSFiles struct {
+	certPEM []byte
+	keyPEM  []byte
+	caPEM   []byte
+}
+
+// installNodeTLSFiles copies the certificate files into a created container, owned by the postgres user,
+// so the private key never passes through the container env
+func (s *postgreSQLClusterService) installNodeTLSFiles(ctx context.Context, containerID string, files *nodeTLSFiles) error {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	dir := path.Base(patroniTLSDir)
+	if err := tw.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0700, ModTime: time.Now()}); err != nil {
+		return err
+	}
+	entries := []struct {
+		file    string
+		content []byte
+		mode    int64
+	}{
+		{patroniTLSCertFile, files.certPEM, 0644},
+		{patroniTLSKeyFile, files.keyPEM, 0600},
+		{patroniTLSCAFile, files.caPEM, 0644},
+	}
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:    dir + "/" + path.Base(entry.file),
+			Mode:    entry.mode,
+			Size:    int64(len(entry.content)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return s.dockerSvc.CopyToContainerAsOwner(ctx, containerID, path.Dir(patroniTLSDir), &archive)
+}
+
+// stripTLSEnv drops the TLS_* entries of containers created when certificates were passed in the env
+func stripTLSEnv(env []string) []string {
+	result := make([]string, 0, len(env))
+	for _, envVar := range env {
+		if strings.HasPrefix(envVar, "TLS_CERT=") || strings.HasPrefix(envVar, "TLS_KEY=") || strings.HasPrefix(envVar, "TLS_CA=") {
+			continue
+		}
+		result = append(result, envVar)
+	}
+	return result
+}
+
+// storedNodeTLSFiles returns the latest stored certificate of a node, or nil when the cluster has TLS off
+func (s *postgreSQLClusterService) storedNodeTLSFiles(node *entities.ClusterNode) (*nodeTLSFiles, error) {
+	cluster, err := s.clusterRepo.FindByID(node.ClusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	if !cluster.TLSEnabled {
+		return nil, nil
+	}
+	cert, err := s.clusterRepo.FindLatestNodeCertificate(node.ID)
+	if err != nil {
+		return nil, fmt.Errorf("no certificate for node %s: %w", node.ID, err)
+	}
+	keyPEM, err := s.keyCipher.Open(cert.KeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := s.clusterRepo.FindCertificateAuthority(platformCAName)
+	if err != nil {
+		return nil, fmt.Errorf("platform CA not found: %w", err)
+	}
+	return &nodeTLSFiles{certPEM: []byte(cert.CertPEM), keyPEM: keyPEM, caPEM: []byte(ca.CertPEM)}, nil
+}
+
+// newNodeTLSFiles issues a certificate for a node that is about to be created
+func (s *postgreSQLClusterService) newNodeTLSFiles(clusterID, nodeID string, hosts []string) (*nodeTLSFiles, error) {
+	ca, err := s.platformCA()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := s.issueNodeCertificate(clusterID, nodeID, ca, hosts)
+	if err != nil {
+		return nil, err
+	}
+	return &nodeTLSFiles{certPEM: cert.CertPEM, keyPEM: cert.KeyPEM, caPEM: ca.CertPEM}, nil
+}
@@ -0,0 +1,774 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"go.uber.org/zap"
+)
+
+const (
+	upgradePublicationName = "iaas_upgrade_pub"
+
+	// upgradeProbeLabel marks the throwaway containers that check a target image
+	upgradeProbeLabel = "iaas.postgres.upgrade_probe"
+
+	// patroniImageRepository is the Patroni image built by build-cluster-images, tagged by major version
+	patroniImageRepository = "iaas-patroni-postgres"
+)
+
+var nonIdentChars = regexp.MustCompile(`[^a-z0-9_]`)
+
+// UpgradeCluster runs pre-flight checks and, unless dry_run is set, starts a tracked upgrade.
+// Minor upgrades roll node by node (replicas, switchover, former leader) on the same volumes.
+// Major upgrades build a new cluster on the target version, replicate into it with logical
+// replication and cut over once it has caught up.
+func (s *postgreSQLClusterService) UpgradeCluster(ctx context.Context, clusterID string, req dto.UpgradeClusterRequest) (*dto.UpgradeClusterResponse, error) {
+	s.logger.Info("cluster upgrade requested",
+		zap.String("cluster_id", clusterID),
+		zap.String("target_version", req.TargetVersion),
+		zap.Bool("dry_run", req.DryRun))
+
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	if cluster.Infrastructure.Status != entities.StatusRunning {
+		return nil, fmt.Errorf("cluster must be running to upgrade (status: %s)", cluster.Infrastructure.Status)
+	}
+
+	currentMajor, currentMinor, err := parsePostgresVersion(cluster.Version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid current version: %w", err)
+	}
+	targetMajor, targetMinor, err := parsePostgresVersion(req.TargetVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target version: %w", err)
+	}
+	if targetMajor < currentMajor || (targetMajor == currentMajor && targetMinor <= currentMinor) {
+		return nil, fmt.Errorf("target version %s must be newer than current version %s", req.TargetVersion, cluster.Version)
+	}
+
+	upgradeType, method := "minor", "rolling"
+	if targetMajor != currentMajor {
+		upgradeType, method = "major", "logical"
+	}
+	if req.Method != "" && req.Method != method {
+		return nil, fmt.Errorf("%s upgrade requires method %s", upgradeType, method)
+	}
+
+	image := req.Image
+	if image == "" {
+		image = fmt.Sprintf("%s:%d", patroniImageRepository, targetMajor)
+	}
+
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+	leader, err := s.findPatroniLeader(ctx, members)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := s.upgradePreflight(ctx, members, leader, image, req.TargetVersion, upgradeType)
+
+	response := &dto.UpgradeClusterResponse{
+		ClusterID:      clusterID,
+		CurrentVersion: cluster.Version,
+		TargetVersion:  req.TargetVersion,
+		UpgradeType:    upgradeType,
+		Method:         method,
+		Image:          image,
+		DryRun:         req.DryRun,
+		Checks:         checks,
+		Plan:           upgradePlan(cluster, members, leader, upgradeType, targetMajor, req.KeepSource),
+	}
+
+	if req.DryRun {
+		return response, nil
+	}
+
+	failed := make([]string, 0)
+	for _, check := range checks {
+		if !check.Passed {
+			failed = append(failed, fmt.Sprintf("%s: %s", check.Name, check.Message))
+		}
+	}
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("pre-flight checks failed: %s", strings.Join(failed, "; "))
+	}
+
+	op, err := s.startOperation(clusterID, "upgrade", map[string]interface{}{
+		"from_version": cluster.Version,
+		"to_version":   req.TargetVersion,
+		"upgrade_type": upgradeType,
+		"method":       method,
+		"image":        image,
+	})
+	if err != nil {
+		return nil, err
+	}
+	opInfo := toOperationDTO(op)
+	response.Operation = &opInfo
+
+	// Upgrades outlive the HTTP request
+	go func() {
+		bgCtx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+		defer cancel()
+
+		var runErr error
+		if upgradeType == "minor" {
+			runErr = s.runRollingUpgrade(bgCtx, op, cluster, req.TargetVersion, image)
+		} else {
+			runErr = s.runLogicalUpgrade(bgCtx, op, cluster, req, image, targetMajor)
+		}
+		s.finishOperation(op, runErr)
+	}()
+
+	return response, nil
+}
+
+// upgradePreflight checks node health, target image, extension availability, free space
+// and, for logical upgrades, publisher settings
+func (s *postgreSQLClusterService) upgradePreflight(ctx context.Context, members []entities.ClusterNode, leader *entities.ClusterNode, image, targetVersion, upgradeType string) []dto.PreflightCheck {
+	checks := make([]dto.PreflightCheck, 0)
+
+	// All nodes must accept connections
+	unhealthy := make([]string, 0)
+	for _, node := range members {
+		output, err := s.dockerSvc.ExecCommand(ctx, node.ContainerID, []string{"pg_isready", "-h", "localhost", "-p", "5432"})
+		if err != nil || !strings.Contains(output, "accepting connections") {
+			unhealthy = append(unhealthy, node.ID)
+		}
+	}
+	healthCheck := dto.PreflightCheck{Name: "nodes_healthy", Passed: len(unhealthy) == 0, Message: fmt.Sprintf("%d/%d nodes accepting connections", len(members)-len(unhealthy), len(members))}
+	if len(unhealthy) > 0 {
+		healthCheck.Message += fmt.Sprintf(" (unhealthy: %s)", strings.Join(unhealthy, ", "))
+	}
+	checks = append(checks, healthCheck)
+
+	// Installed extensions across all databases
+	extensions := map[string]bool{}
+	databases, dbErr := s.listUserDatabases(ctx, leader.ContainerID)
+	for _, db := range databases {
+		output, err := s.psql(ctx, leader.ContainerID, db, "SELECT extname FROM pg_extension;")
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(output, "\n") {
+			if ext := strings.TrimSpace(line); ext != "" {
+				extensions[ext] = true
+			}
+		}
+	}
+	extList := make([]string, 0, len(extensions))
+	for ext := range extensions {
+		extList = append(extList, ext)
+	}
+
+	// Target image must exist, ship the requested version and provide every installed extension
+	probedVersion, missing, probeErr := s.probeUpgradeImage(ctx, image, extList)
+	if probeErr != nil {
+		checks = append(checks, dto.PreflightCheck{Name: "target_image", Passed: false, Message: probeErr.Error()})
+	} else {
+		checks = append(checks, dto.PreflightCheck{
+			Name:    "target_image",
+			Passed:  postgresVersionMatches(probedVersion, targetVersion),
+			Message: fmt.Sprintf("%s ships PostgreSQL %s", image, probedVersion),
+		})
+		extCheck := dto.PreflightCheck{Name: "extensions", Passed: len(missing) == 0 && dbErr == nil, Message: fmt.Sprintf("%d installed extensions available in target image", len(extList))}
+		if dbErr != nil {
+			extCheck.Message = fmt.Sprintf("failed to list databases: %v", dbErr)
+		} else if len(missing) > 0 {
+			extCheck.Message = fmt.Sprintf("missing in target image: %s", strings.Join(missing, ", "))
+		}
+		checks = append(checks, extCheck)
+	}
+
+	// Free space: minor upgrades only need WAL headroom, major upgrades copy all data
+	dataSize := int64(0)
+	if output, err := s.psql(ctx, leader.ContainerID, "", "SELECT sum(pg_database_size(datname))::bigint FROM pg_database;"); err == nil {
+		dataSize, _ = strconv.ParseInt(output, 10, 64)
+	}
+	required := dataSize / 10
+	if upgradeType == "major" {
+		required = dataSize + dataSize/5
+	}
+	available, spaceErr := s.availableDataSpace(ctx, leader.ContainerID)
+	if spaceErr != nil {
+		checks = append(checks, dto.PreflightCheck{Name: "free_space", Passed: false, Message: spaceErr.Error()})
+	} else {
+		checks = append(checks, dto.PreflightCheck{
+			Name:    "free_space",
+			Passed:  available >= required,
+			Message: fmt.Sprintf("%d MB available, %d MB required (data size %d MB)", available/1024/1024, required/1024/1024, dataSize/1024/1024),
+		})
+	}
+
+	if upgradeType == "major" {
+		// A replica wal_level is raised by the upgrade itself before replication starts
+		walLevel, err := s.psql(ctx, leader.ContainerID, "", "SHOW wal_level;")
+		walCheck := dto.PreflightCheck{Name: "wal_level", Passed: err == nil && walLevel == "logical", Message: "wal_level is logical"}
+		if err != nil {
+			walCheck.Message = fmt.Sprintf("failed to read wal_level: %v", err)
+		} else if walLevel == "replica" {
+			walCheck.Passed = true
+			walCheck.Message = "wal_level is replica, it is set to logical with a rolling restart before replication starts"
+		} else if walLevel != "logical" {
+			walCheck.Message = fmt.Sprintf("wal_level is %q, logical replication requires \"logical\"", walLevel)
+		}
+		checks = append(checks, walCheck)
+
+		// UPDATE/DELETE on published tables without a replica identity would fail on the source
+		noIdentity := make([]string, 0)
+		for _, db := range databases {
+			output, err := s.psql(ctx, leader.ContainerID, db, `SELECT n.nspname || '.' || c.relname FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind = 'r' AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+AND c.relreplident <> 'f'
+AND NOT EXISTS (SELECT 1 FROM pg_index i WHERE i.indrelid = c.oid AND (i.indisprimary OR i.indisreplident));`)
+			if err != nil {
+				continue
+			}
+			for _, line := range strings.Split(output, "\n") {
+				if table := strings.TrimSpace(line); table != "" {
+					noIdentity = append(noIdentity, fmt.Sprintf("%s:%s", db, table))
+				}
+			}
+		}
+		identityCheck := dto.PreflightCheck{Name: "replica_identity", Passed: len(noIdentity) == 0, Message: "all tables have a primary key or replica identity"}
+		if len(noIdentity) > 0 {
+			identityCheck.Message = fmt.Sprintf("tables without primary key or replica identity: %s", strings.Join(noIdentity, ", "))
+		}
+		checks = append(checks, identityCheck)
+	}
+
+	return checks
+}
+
+// upgradePlan describes the steps an upgrade will take
+func upgradePlan(cluster *entities.PostgreSQLCluster, members []entities.ClusterNode, leader *entities.ClusterNode, upgradeType string, targetMajor int, keepSource bool) []string {
+	plan := make([]string, 0)
+	if upgradeType == "minor" {
+		for _, node := range members {
+			if node.ID != leader.ID {
+				plan = append(plan, fmt.Sprintf("recreate replica %s on the target image (same volumes)", node.ID))
+			}
+		}
+		if len(members) > 1 {
+			plan = append(plan, "switch over leadership to an upgraded replica")
+		} else {
+			plan = append(plan, "single-node cluster: leader restart causes a short outage")
+		}
+		plan = append(plan, fmt.Sprintf("recreate former leader %s on the target image", leader.ID))
+		return plan
+	}
+
+	plan = append(plan,
+		"set wal_level to logical with a rolling restart, if not already",
+		fmt.Sprintf("create cluster %s-pg%d with %d nodes on the target version", cluster.Infrastructure.Name, targetMajor, len(members)),
+		"copy schema of every database with pg_dump --schema-only",
+		"publish all tables on the source and subscribe from the new cluster",
+		"wait for initial sync and streaming catch-up",
+		"set source databases read-only and disconnect clients",
+		"sync sequences, drop subscriptions and publications",
+		"on failure: make source databases writable again, drop replication and the target cluster",
+	)
+	if keepSource {
+		plan = append(plan, "keep source cluster running (read-only)")
+	} else {
+		plan = append(plan, "stop source cluster")
+	}
+	return plan
+}
+
+// runRollingUpgrade upgrades replicas, switches over, then upgrades the former leader
+func (s *postgreSQLClusterService) runRollingUpgrade(ctx context.Context, op *entities.ClusterOperation, cluster *entities.PostgreSQLCluster, targetVersion, image string) error {
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+	leader, err := s.findPatroniLeader(ctx, members)
+	if err != nil {
+		return err
+	}
+
+	replicas := make([]*entities.ClusterNode, 0)
+	for i := range members {
+		if members[i].ID != leader.ID {
+			replicas = append(replicas, &members[i])
+		}
+	}
+
+	totalSteps := len(members) + 1
+	step := 0
+	for _, replica := range replicas {
+		step++
+		s.setOperationStep(op, step*100/totalSteps-1, fmt.Sprintf("upgrading replica %s", replica.ID))
+		if err := s.recreatePatroniNode(ctx, replica, image, nil); err != nil {
+			return fmt.Errorf("failed to upgrade replica %s: %w", replica.ID, err)
+		}
+	}
+
+	if len(replicas) > 0 {
+		step++
+		s.setOperationStep(op, step*100/totalSteps-1, fmt.Sprintf("switching over to %s", replicas[0].ID))
+		if err := s.patroniSwitchover(ctx, cluster.ID, leader, replicas[0], "upgrade"); err != nil {
+			return fmt.Errorf("switchover failed: %w", err)
+		}
+	}
+
+	s.setOperationStep(op, 95, fmt.Sprintf("upgrading former leader %s", leader.ID))
+	if err := s.recreatePatroniNode(ctx, leader, image, nil); err != nil {
+		return fmt.Errorf("failed to upgrade former leader %s: %w", leader.ID, err)
+	}
+
+	cluster.Version = targetVersion
+	if err := s.clusterRepo.Update(cluster); err != nil {
+		return fmt.Errorf("failed to update cluster version: %w", err)
+	}
+	s.cacheService.InvalidateClusterInfo(ctx, cluster.ID)
+	s.publishEvent(ctx, "cluster.upgraded", cluster.InfrastructureID, cluster.ID, string(entities.StatusRunning))
+
+	return nil
+}
+
+// logicalUpgradeState records what a logical upgrade has set up so far, for rollback
+type logicalUpgradeState struct {
+	sourceLeader    *entities.ClusterNode
+	targetClusterID string
+	targetLeader    *entities.ClusterNode
+	publications    []string          // databases with a publication on the source
+	subscriptions   map[string]string // database -> subscription on the target
+	frozen          []string          // source databases set read-only
+}
+
+// runLogicalUpgrade replicates the cluster into a new cluster on the target major version and cuts over.
+// If any step fails the source is made writable again and the replication and target cluster removed.
+func (s *postgreSQLClusterService) runLogicalUpgrade(ctx context.Context, op *entities.ClusterOperation, cluster *entities.PostgreSQLCluster, req dto.UpgradeClusterRequest, image string, targetMajor int) (err error) {
+	s.setOperationStep(op, 2, "enabling logical decoding")
+	if err := s.ensureLogicalWAL(ctx, op, cluster.ID); err != nil {
+		return err
+	}
+
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+	sourceLeader, err := s.findPatroniLeader(ctx, members)
+	if err != nil {
+		return err
+	}
+	sourceHost, err := s.patroniMemberName(ctx, sourceLeader)
+	if err != nil {
+		return err
+	}
+
+	replicationMode := cluster.ReplicationMode
+	if replicationMode == "" {
+		replicationMode = "async"
+	}
+
+	state := &logicalUpgradeState{sourceLeader: sourceLeader, subscriptions: map[string]string{}}
+	defer func() {
+		if err != nil {
+			s.rollbackLogicalUpgrade(op, cluster, state)
+		}
+	}()
+
+	s.setOperationStep(op, 5, "creating target cluster")
+	target, err := s.CreateCluster(ctx, cluster.Infrastructure.UserID, dto.CreateClusterRequest{
+		ClusterName:        fmt.Sprintf("%s-pg%d", cluster.Infrastructure.Name, targetMajor),
+		PostgreSQLVersion:  req.TargetVersion,
+		NodeCount:          len(members),
+		CPUPerNode:         cluster.CPULimit,
+		MemoryPerNode:      cluster.MemoryLimit,
+		StoragePerNode:     cluster.StorageSize,
+		PostgreSQLPassword: cluster.Password,
+		ReplicationMode:    replicationMode,
+		Image:              image,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create target cluster: %w", err)
+	}
+	state.targetClusterID = target.ClusterID
+	s.setOperationDetail(op, "target_cluster_id", target.ClusterID)
+
+	targetNodes, err := s.clusterRepo.ListNodes(target.ClusterID)
+	if err != nil {
+		return fmt.Errorf("failed to list target nodes: %w", err)
+	}
+	targetLeader, err := s.findPatroniLeader(ctx, patroniMembers(targetNodes))
+	if err != nil {
+		return fmt.Errorf("target cluster: %w", err)
+	}
+	state.targetLeader = targetLeader
+
+	// The subscriber connects to the source leader by its container name
+	if err := s.dockerSvc.ConnectNetwork(ctx, cluster.NetworkID, targetLeader.ContainerID, nil); err != nil {
+		return fmt.Errorf("failed to connect target leader to source network: %w", err)
+	}
+
+	databases, err := s.listUserDatabases(ctx, sourceLeader.ContainerID)
+	if err != nil {
+		return fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	for i, db := range databases {
+		s.setOperationStep(op, 15+i*30/len(databases), fmt.Sprintf("setting up logical replication for %s", db))
+
+		if db != "postgres" {
+			if _, err := s.psql(ctx, targetLeader.ContainerID, "", fmt.Sprintf("CREATE DATABASE %s;", sqlIdent(db))); err != nil {
+				return fmt.Errorf("failed to create database %s on target: %w", db, err)
+			}
+		}
+
+		schemaCmd := fmt.Sprintf("PGPASSWORD=%s pg_dump -h %s -U postgres --schema-only %s | psql -U postgres -d %s",
+			shellQuote(cluster.Password), shellQuote(sourceHost), shellQuote(db), shellQuote(db))
+		if output, err := s.dockerSvc.ExecCommand(ctx, targetLeader.ContainerID, []string{"sh", "-c", schemaCmd}); err != nil {
+			return fmt.Errorf("failed to copy schema of %s: %w", db, err)
+		} else if strings.Contains(output, "pg_dump: error") {
+			return fmt.Errorf("failed to copy schema of %s: %s", db, strings.TrimSpace(output))
+		}
+
+		if _, err := s.psql(ctx, sourceLeader.ContainerID, db, fmt.Sprintf("CREATE PUBLICATION %s FOR ALL TABLES;", upgradePublicationName)); err != nil {
+			return fmt.Errorf("failed to create publication in %s: %w", db, err)
+		}
+		state.publications = append(state.publications, db)
+
+		subName := upgradeSubscriptionName(db)
+		conn := fmt.Sprintf("host=%s port=5432 dbname=%s user=postgres password=%s", sourceHost, db, cluster.Password)
+		if _, err := s.psql(ctx, targetLeader.ContainerID, db, fmt.Sprintf("CREATE SUBSCRIPTION %s CONNECTION %s PUBLICATION %s;",
+			subName, sqlLiteral(conn), upgradePublicationName)); err != nil {
+			return fmt.Errorf("failed to create subscription in %s: %w", db, err)
+		}
+		state.subscriptions[db] = subName
+	}
+
+	s.setOperationStep(op, 50, "waiting for initial table sync")
+	if err := s.waitForSubscriptionSync(ctx, sourceLeader.ContainerID, targetLeader.ContainerID, state.subscriptions, 60*time.Minute); err != nil {
+		return err
+	}
+
+	// Cutover: freeze writes on the source, drain, then detach the new cluster
+	s.setOperationStep(op, 75, "freezing writes on source")
+	for _, db := range databases {
+		if _, err := s.psql(ctx, sourceLeader.ContainerID, "", fmt.Sprintf("ALTER DATABASE %s SET default_transaction_read_only = on;", sqlIdent(db))); err != nil {
+			return fmt.Errorf("failed to set %s read-only: %w", db, err)
+		}
+		state.frozen = append(state.frozen, db)
+		// Recorded so a restart of the service can make the source writable again
+		s.setOperationDetail(op, "frozen_databases", state.frozen)
+		s.psql(ctx, sourceLeader.ContainerID, "", fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = %s AND pid <> pg_backend_pid() AND backend_type = 'client backend';", sqlLiteral(db)))
+	}
+
+	s.setOperationStep(op, 80, "waiting for final catch-up")
+	if err := s.waitForSubscriptionSync(ctx, sourceLeader.ContainerID, targetLeader.ContainerID, state.subscriptions, 10*time.Minute); err != nil {
+		return err
+	}
+
+	s.setOperationStep(op, 90, "syncing sequences and removing replication")
+	for db := range state.subscriptions {
+		output, err := s.psql(ctx, sourceLeader.ContainerID, db, "SELECT schemaname, sequencename, last_value FROM pg_sequences WHERE last_value IS NOT NULL;")
+		if err != nil {
+			return fmt.Errorf("failed to read sequences of %s: %w", db, err)
+		}
+		for _, line := range strings.Split(output, "\n") {
+			parts := strings.Split(line, "|")
+			if len(parts) < 3 {
+				continue
+			}
+			seq := sqlIdent(parts[0]) + "." + sqlIdent(parts[1])
+			if _, err := s.psql(ctx, targetLeader.ContainerID, db, fmt.Sprintf("SELECT setval(%s, %s, true);", sqlLiteral(seq), parts[2])); err != nil {
+				return fmt.Errorf("failed to sync sequence %s in %s: %w", seq, db, err)
+			}
+		}
+	}
+	for db, subName := range state.subscriptions {
+		if _, err := s.psql(ctx, targetLeader.ContainerID, db, fmt.Sprintf("DROP SUBSCRIPTION %s;", subName)); err != nil {
+			return fmt.Errorf("failed to drop subscription in %s: %w", db, err)
+		}
+		delete(state.subscriptions, db)
+	}
+	for _, db := range state.publications {
+		s.psql(ctx, sourceLeader.ContainerID, db, fmt.Sprintf("DROP PUBLICATION IF EXISTS %s;", upgradePublicationName))
+	}
+	state.publications = nil
+	// From here the target cluster holds the data; an interrupted upgrade must not delete it
+	s.setOperationDetail(op, "cut_over", true)
+
+	if !req.KeepSource {
+		s.setOperationStep(op, 95, "stopping source cluster")
+		if err := s.StopCluster(ctx, cluster.ID); err != nil {
+			s.logger.Warn("failed to stop source cluster after cutover", zap.String("cluster_id", cluster.ID), zap.Error(err))
+		}
+	}
+
+	s.publishEvent(ctx, "cluster.upgraded", cluster.InfrastructureID, cluster.ID, "cutover")
+	s.publishEvent(ctx, "cluster.upgraded", target.InfrastructureID, target.ClusterID, string(entities.StatusRunning))
+
+	return nil
+}
+
+// rollbackLogicalUpgrade undoes a failed logical upgrade: source databases become writable again,
+// subscriptions, their replication slots and publications are dropped and the target cluster deleted.
+// It runs on its own context since the upgrade may have failed by running out of time.
+func (s *postgreSQLClusterService) rollbackLogicalUpgrade(op *entities.ClusterOperation, cluster *entities.PostgreSQLCluster, state *logicalUpgradeState) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	s.setOperationStep(op, op.Progress, "rolling back")
+	s.logger.Warn("rolling back logical upgrade", zap.String("cluster_id", cluster.ID), zap.String("target_cluster_id", state.targetClusterID))
+
+	// Leadership may have moved while the upgrade ran
+	source := state.sourceLeader
+	if nodes, err := s.clusterRepo.ListNodes(cluster.ID); err == nil {
+		if leader, err := s.findPatroniLeader(ctx, patroniMembers(nodes)); err == nil {
+			source = leader
+		}
+	}
+
+	failures := make([]string, 0)
+	for _, db := range state.frozen {
+		if _, err := s.psql(ctx, source.ContainerID, "", fmt.Sprintf("ALTER DATABASE %s RESET default_transaction_read_only;", sqlIdent(db))); err != nil {
+			failures = append(failures, fmt.Sprintf("reset read-only on %s: %v", db, err))
+		}
+	}
+
+	for db, subName := range state.subscriptions {
+		// Dropping the subscription also drops its slot on the source; the slot is dropped
+		// directly in case the target is not reachable
+		if state.targetLeader != nil {
+			s.psql(ctx, state.targetLeader.ContainerID, db, fmt.Sprintf("DROP SUBSCRIPTION IF EXISTS %s;", subName))
+		}
+		s.psql(ctx, source.ContainerID, "", fmt.Sprintf("SELECT pg_drop_replication_slot(slot_name) FROM pg_replication_slots WHERE slot_name = %s AND NOT active;", sqlLiteral(subName)))
+	}
+	for _, db := range state.publications {
+		if _, err := s.psql(ctx, source.ContainerID, db, fmt.Sprintf("DROP PUBLICATION IF EXISTS %s;", upgradePublicationName)); err != nil {
+			failures = append(failures, fmt.Sprintf("drop publication in %s: %v", db, err))
+		}
+	}
+
+	if state.targetClusterID != "" {
+		if err := s.DeleteCluster(ctx, state.targetClusterID); err != nil {
+			failures = append(failures, fmt.Sprintf("delete target cluster %s: %v", state.targetClusterID, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		s.setOperationDetail(op, "rollback_errors", failures)
+		s.logger.Error("logical upgrade rollback incomplete", zap.String("cluster_id", cluster.ID), zap.Strings("errors", failures))
+		return
+	}
+	s.setOperationDetail(op, "rolled_back", true)
+}
+
+// ensureLogicalWAL raises wal_level to logical through the Patroni config, which needs a
+// rolling restart to take effect
+func (s *postgreSQLClusterService) ensureLogicalWAL(ctx context.Context, op *entities.ClusterOperation, clusterID string) error {
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	members := patroniMembers(nodes)
+	leader, err := s.findPatroniLeader(ctx, members)
+	if err != nil {
+		return err
+	}
+	if walLevel, err := s.psql(ctx, leader.ContainerID, "", "SHOW wal_level;"); err == nil && walLevel == "logical" {
+		return nil
+	}
+
+	patch := map[string]interface{}{
+		"postgresql": map[string]interface{}{
+			"parameters": map[string]interface{}{"wal_level": "logical"},
+		},
+	}
+	if err := s.patroniPatchConfig(ctx, leader, patch); err != nil {
+		return err
+	}
+	if err := s.waitForPendingRestart(ctx, members); err != nil {
+		return err
+	}
+	if err := s.patroniRollingRestart(ctx, op, clusterID, "upgrade"); err != nil {
+		return err
+	}
+
+	// The restart ends with a switchover, so the check runs against the new leader
+	leader, err = s.findPatroniLeader(ctx, members)
+	if err != nil {
+		return err
+	}
+	walLevel, err := s.psql(ctx, leader.ContainerID, "", "SHOW wal_level;")
+	if err != nil {
+		return fmt.Errorf("failed to read wal_level: %w", err)
+	}
+	if walLevel != "logical" {
+		return fmt.Errorf("wal_level is %q after restart, logical replication requires \"logical\"", walLevel)
+	}
+	return nil
+}
+
+// waitForSubscriptionSync waits until every table is synced and each subscription has replayed the source's current LSN
+func (s *postgreSQLClusterService) waitForSubscriptionSync(ctx context.Context, sourceContainer, targetContainer string, subscriptions map[string]string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for db, subName := range subscriptions {
+		sourceLSN, err := s.psql(ctx, sourceContainer, db, "SELECT pg_current_wal_lsn();")
+		if err != nil {
+			return fmt.Errorf("failed to read source LSN: %w", err)
+		}
+
+		for {
+			query := fmt.Sprintf(`SELECT (SELECT count(*) FROM pg_subscription_rel r JOIN pg_subscription s ON s.oid = r.srsubid WHERE s.subname = %s AND r.srsubstate <> 'r') = 0
+AND COALESCE((SELECT latest_end_lsn >= %s::pg_lsn FROM pg_stat_subscription WHERE subname = %s AND relid IS NULL), false);`,
+				sqlLiteral(subName), sqlLiteral(sourceLSN), sqlLiteral(subName))
+			output, err := s.psql(ctx, targetContainer, db, query)
+			if err == nil && output == "t" {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("subscription %s did not catch up within %s", subName, timeout)
+			}
+			time.Sleep(5 * time.Second)
+		}
+	}
+	return nil
+}
+
+// listUserDatabases lists connectable non-template databases
+func (s *postgreSQLClusterService) listUserDatabases(ctx context.Context, containerID string) ([]string, error) {
+	output, err := s.psql(ctx, containerID, "", "SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate ORDER BY datname;")
+	if err != nil {
+		return nil, err
+	}
+	databases := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if db := strings.TrimSpace(line); db != "" {
+			databases = append(databases, db)
+		}
+	}
+	return databases, nil
+}
+
+// availableDataSpace returns free bytes on the data volume of a node
+func (s *postgreSQLClusterService) availableDataSpace(ctx context.Context, containerID string) (int64, error) {
+	output, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"df", "-Pk", "/data/patroni"})
+	if err != nil {
+		return 0, fmt.Errorf("failed to check free space: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("unexpected df output: %s", output)
+	}
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("unexpected df output: %s", output)
+	}
+	availableKB, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected df output: %s", output)
+	}
+	return availableKB * 1024, nil
+}
+
+// probeUpgradeImage starts a throwaway container from the target image and reports its
+// PostgreSQL version and which of the given extensions it does not ship
+func (s *postgreSQLClusterService) probeUpgradeImage(ctx context.Context, image string, extensions []string) (string, []string, error) {
+	cli := s.dockerSvc.GetClient()
+
+	if _, _, err := cli.ImageInspectWithRaw(ctx, image); err != nil {
+		reader, pullErr := cli.ImagePull(ctx, image, types.ImagePullOptions{})
+		if pullErr != nil {
+			return "", nil, fmt.Errorf("image %s not available: %w", image, pullErr)
+		}
+		io.Copy(io.Discard, reader)
+		reader.Close()
+	}
+
+	resp, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:      image,
+		Entrypoint: []string{"sleep"},
+		Cmd:        []string{"300"},
+		Labels:     map[string]string{upgradeProbeLabel: "true"},
+	}, nil, nil, nil, "")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create probe container: %w", err)
+	}
+	defer cli.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true})
+
+	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return "", nil, fmt.Errorf("failed to start probe container: %w", err)
+	}
+
+	output, err := s.dockerSvc.ExecCommand(ctx, resp.ID, []string{"pg_config", "--version"})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read version from %s: %w", image, err)
+	}
+	// "PostgreSQL 16.4 (Debian 16.4-1.pgdg120+1)"
+	fields := strings.Fields(output)
+	if len(fields) < 2 || fields[0] != "PostgreSQL" {
+		return "", nil, fmt.Errorf("unexpected pg_config output from %s: %s", image, strings.TrimSpace(output))
+	}
+	version := fields[1]
+
+	missing := make([]string, 0)
+	for _, ext := range extensions {
+		check := fmt.Sprintf(`test -f "$(pg_config --sharedir)/extension/%s.control" && echo ok`, ext)
+		out, _ := s.dockerSvc.ExecCommand(ctx, resp.ID, []string{"sh", "-c", check})
+		if strings.TrimSpace(out) != "ok" {
+			missing = append(missing, ext)
+		}
+	}
+
+	return version, missing, nil
+}
+
+// upgradeSubscriptionName is the subscription, and replication slot, used to upgrade a database
+func upgradeSubscriptionName(db string) string {
+	return "iaas_upgrade_sub_" + nonIdentChars.ReplaceAllString(strings.ToLower(db), "_")
+}
+
+// postgresVersionMatches reports whether a version satisfies a requested one compared by whole
+// components, so "16" matches "16.4" and "16.1" does not match "16.10"
+func postgresVersionMatches(version, requested string) bool {
+	versionParts := strings.Split(strings.TrimSpace(version), ".")
+	requestedParts := strings.Split(strings.TrimSpace(requested), ".")
+	if len(requestedParts) > len(versionParts) {
+		return false
+	}
+	for i := range requestedParts {
+		if requestedParts[i] != versionParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePostgresVersion splits "16.4" into major 16 and minor 4 ("16" has minor 0)
+func parsePostgresVersion(version string) (int, int, error) {
+	parts := strings.Split(strings.TrimSpace(version), ".")
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major < 10 {
+		return 0, 0, fmt.Errorf("unsupported PostgreSQL version %q", version)
+	}
+	minor := 0
+	if len(parts) > 1 {
+		if minor, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, fmt.Errorf("unsupported PostgreSQL version %q", version)
+		}
+	}
+	return major, minor, nil
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresVersionMatches(t *testing.T) {
+	tests := []struct {
+		version   string
+		requested string
+		want      bool
+	}{
+		{"16.4", "16", true},
+		{"16.4", "16.4", true},
+		{"16.10", "16.1", false},
+		{"16.1", "16.10", false},
+		{"17.0", "16", false},
+		{"16", "16.4", false},
+		{" 16.4\n", "16.4", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, postgresVersionMatches(tt.version, tt.requested), "%q against %q", tt.version, tt.requested)
+	}
+}
+
+func TestParsePostgresVersion(t *testing.T) {
+	major, minor, err := parsePostgresVersion("16.4")
+	require.NoError(t, err)
+	assert.Equal(t, 16, major)
+	assert.Equal(t, 4, minor)
+
+	major, minor, err = parsePostgresVersion("17")
+	require.NoError(t, err)
+	assert.Equal(t, 17, major)
+	assert.Equal(t, 0, minor)
+
+	for _, version := range []string{"", "9.6", "16.x", "latest"} {
+		_, _, err := parsePostgresVersion(version)
+		assert.Error(t, err, version)
+	}
+}
+
+func TestUpgradeSubscriptionName(t *testing.T) {
+	assert.Equal(t, "iaas_upgrade_sub_my_app_db", upgradeSubscriptionName("My-App.DB"))
+}